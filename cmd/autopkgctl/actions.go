@@ -0,0 +1,52 @@
+// cmd/autopkgctl/actions.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/actions"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// applyActionInputs sets every flag of the command that wasn't given on the
+// command line from its INPUT_ environment variable, e.g. --prefs-path from
+// INPUT_PREFS-PATH, so the GitHub Action can pass its inputs straight through
+func applyActionInputs(cmd *cobra.Command) error {
+	var applyErr error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if applyErr != nil || flag.Changed || flag.Name == "help" {
+			return
+		}
+		value, ok := actions.Input(flag.Name)
+		if !ok || value == "" {
+			return
+		}
+		if err := cmd.Flags().Set(flag.Name, value); err != nil {
+			applyErr = fmt.Errorf("invalid value for input %s: %w", flag.Name, err)
+			return
+		}
+		logger.Logger(fmt.Sprintf("📥 Set --%s from action input", flag.Name), logger.LogDebug)
+	})
+	return applyErr
+}
+
+// setActionOutputs publishes the outputs of a subcommand to the GitHub Actions step
+func setActionOutputs(outputs map[string]string) {
+	if err := actions.SetOutputs(outputs); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to set action outputs: %v", err), logger.LogWarning)
+	}
+}
+
+// addActionPath puts a directory on PATH for the later steps of the GitHub
+// Actions job, and tells the user to add it themselves elsewhere
+func addActionPath(dir string) {
+	if !actions.Running() {
+		fmt.Printf("ℹ️ Add %s to PATH to run autopkg outside autopkgctl\n", dir)
+		return
+	}
+	if err := actions.AddPath(dir); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to add %s to the job's PATH: %v", dir, err), logger.LogWarning)
+	}
+}
@@ -0,0 +1,205 @@
+// cmd/autopkgctl/annotate.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Annotate command flags
+	annotationAuthor string
+
+	// Runs command flags
+	runsSince     time.Duration
+	runsHTMLPath  string
+	runsJUnitPath string
+)
+
+// newAnnotateCmd creates the annotate command for attaching notes to a run
+func newAnnotateCmd() *cobra.Command {
+	annotateCmd := &cobra.Command{
+		Use:   "annotate [run-id] [note]",
+		Short: "Attach a note to a run",
+		Long:  "Attach a note to a run, e.g. autopkgctl annotate 20250101T020000Z-a1b2c3 \"Zoom failure is known vendor issue\"",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			author := annotationAuthor
+			if author == "" {
+				author = defaultAnnotationAuthor()
+			}
+
+			record, err := autopkg.AnnotateRun(stateDir, args[0], author, strings.Join(args[1:], " "))
+			if err != nil {
+				fmt.Printf("❌ Failed to annotate run: %v\n", err)
+				return err
+			}
+
+			setResult(record)
+			fmt.Printf("✅ Run %s now has %d annotation(s)\n", record.RunID, len(record.Annotations))
+			return nil
+		},
+	}
+
+	annotateCmd.Flags().StringVar(&annotationAuthor, "author", "", "Author of the note (defaults to $GITHUB_ACTOR or $USER)")
+
+	return annotateCmd
+}
+
+// newRunsCmd creates the runs command for querying recorded runs
+func newRunsCmd() *cobra.Command {
+	runsCmd := &cobra.Command{
+		Use:   "runs [run-id]",
+		Short: "List recorded runs with their annotations",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var records []*autopkg.RunRecord
+			if len(args) == 1 {
+				record, err := autopkg.LoadRunRecord(stateDir, args[0])
+				if err != nil {
+					return err
+				}
+				records = append(records, record)
+			} else {
+				var since time.Time
+				if runsSince > 0 {
+					since = time.Now().Add(-runsSince)
+				}
+				var err error
+				if records, err = autopkg.ListRunRecords(stateDir, since); err != nil {
+					return err
+				}
+			}
+
+			// The newest run is the one the action reports on
+			if len(records) > 0 {
+				setActionOutputs(runRecordOutputs(records[0]))
+			}
+
+			if (runsHTMLPath != "" || runsJUnitPath != "") && len(args) == 0 {
+				return configError(fmt.Errorf("--html and --junit need the run id of the run to report on"))
+			}
+			if runsHTMLPath != "" {
+				if err := autopkg.WriteHTMLReport(runsHTMLPath, records[0], nil); err != nil {
+					return withExitCode(exitError, err)
+				}
+				if !structuredOutput() {
+					fmt.Printf("📄 Wrote HTML report of run %s to %s\n", records[0].RunID, runsHTMLPath)
+				}
+			}
+			if runsJUnitPath != "" {
+				if err := autopkg.WriteJUnitReport(runsJUnitPath, records[0], nil); err != nil {
+					return withExitCode(exitError, err)
+				}
+				if !structuredOutput() {
+					fmt.Printf("📄 Wrote JUnit report of run %s to %s\n", records[0].RunID, runsJUnitPath)
+				}
+			}
+
+			setResult(records)
+			if structuredOutput() {
+				return nil
+			}
+
+			if len(records) == 0 {
+				fmt.Println("ℹ️ No runs recorded")
+				return nil
+			}
+
+			for _, record := range records {
+				printRunRecord(record, len(args) == 1)
+			}
+			return nil
+		},
+	}
+
+	runsCmd.Flags().DurationVar(&runsSince, "since", 7*24*time.Hour, "Only list runs started within this duration (0 = all)")
+	runsCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output runs as JSON, shorthand for --output json")
+	runsCmd.Flags().StringVar(&runsHTMLPath, "html", "", "Write a standalone HTML report of the run to this path")
+	runsCmd.Flags().StringVar(&runsJUnitPath, "junit", "", "Write the run as JUnit XML to this path")
+
+	return runsCmd
+}
+
+// printRunRecord prints a run, its annotations and optionally its recipes
+func printRunRecord(record *autopkg.RunRecord, detailed bool) {
+	icon := "✅"
+	if record.Status != "success" {
+		icon = "❌"
+	}
+	if record.Chaos {
+		icon += "🐒"
+	}
+	if record.CheckOnly {
+		icon += "🔎"
+	}
+	fmt.Printf("%s %s  %s  %s  %s\n", icon, record.RunID, record.StartTime.Local().Format("2006-01-02 15:04"), i18n.T("report.run_recipes", len(record.Recipes)), record.EndTime.Sub(record.StartTime).Round(time.Second))
+
+	printAnnotations(record.Annotations, "    ")
+
+	for _, alert := range record.Health {
+		fmt.Printf("    🩺 %s\n", alert.Message)
+	}
+
+	if detailed && len(record.Changes) > 0 {
+		fmt.Printf("    %s\n", i18n.T("report.changes"))
+		for _, change := range record.Changes {
+			fmt.Printf("      • %s\n", change.Summary())
+		}
+	}
+
+	if detailed {
+		for _, recipe := range record.Recipes {
+			fmt.Printf("    • %-40s %-10s %s\n", recipe.Recipe, recipe.Status, recipe.Duration.Round(time.Second))
+			if recipe.Error != "" {
+				fmt.Printf("      %s\n", recipe.Error)
+			}
+			if recipe.SkipReason != "" {
+				fmt.Printf("      %s\n", recipe.SkipReason)
+			}
+		}
+	}
+}
+
+// printAnnotations prints the notes attached to a run, each with its author and date
+func printAnnotations(annotations []autopkg.RunAnnotation, indent string) {
+	for _, annotation := range annotations {
+		attribution := annotation.Timestamp.Local().Format("2006-01-02")
+		if annotation.Author != "" {
+			attribution = annotation.Author + ", " + attribution
+		}
+		fmt.Printf("%s📝 %s (%s)\n", indent, annotation.Note, attribution)
+	}
+}
+
+// defaultAnnotationAuthor returns the CI actor or local user name
+func defaultAnnotationAuthor() string {
+	if actor := os.Getenv("GITHUB_ACTOR"); actor != "" {
+		return actor
+	}
+	return os.Getenv("USER")
+}
+
+// runRecordOutputs returns the action outputs describing a run
+func runRecordOutputs(record *autopkg.RunRecord) map[string]string {
+	failed := 0
+	for _, recipe := range record.Recipes {
+		if recipe.Status == "failed" {
+			failed++
+		}
+	}
+	return map[string]string{
+		"run-id":  record.RunID,
+		"status":  record.Status,
+		"recipes": strconv.Itoa(len(record.Recipes)),
+		"failed":  strconv.Itoa(failed),
+		"changes": strconv.Itoa(len(record.Changes)),
+	}
+}
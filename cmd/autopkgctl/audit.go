@@ -0,0 +1,82 @@
+// cmd/autopkgctl/audit.go
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Audit command flags
+	auditRecipes      []string
+	auditRecipeList   string
+	auditSearchDirs   []string
+	auditOverrideDirs []string
+	auditAllowIssues  bool
+)
+
+// newAuditCmd creates the audit command for checking recipes with autopkg audit
+func newAuditCmd() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit [recipe...]",
+		Short: "Audit recipes for missing code signature checks, insecure URLs and non-core processors",
+		Long:  "Run autopkg audit on recipes given as arguments, with --recipes or with --recipe-list, list the checks each recipe fails and fail if any do. With --json, or --output json or yaml, output the issues of each recipe for downstream tooling.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			recipes := append(append([]string{}, args...), auditRecipes...)
+			if len(recipes) == 0 && auditRecipeList == "" {
+				return configError(fmt.Errorf("no recipes to audit, pass recipes, --recipes or --recipe-list"))
+			}
+
+			audits, err := autopkg.AuditRecipes(recipes, &autopkg.AuditOptions{
+				PrefsPath:    prefsPath,
+				SearchDirs:   auditSearchDirs,
+				OverrideDirs: auditOverrideDirs,
+				RecipeList:   auditRecipeList,
+			})
+			if err != nil {
+				return err
+			}
+
+			setResult(audits)
+			if !structuredOutput() {
+				printRecipeAudits(audits)
+			}
+
+			if !auditAllowIssues && len(audits) > 0 {
+				return withExitCode(exitError, fmt.Errorf("%d recipes have audit issues", len(audits)))
+			}
+			return nil
+		},
+	}
+
+	auditCmd.Flags().StringSliceVar(&auditRecipes, "recipes", []string{}, "Recipes to audit")
+	auditCmd.Flags().StringVar(&auditRecipeList, "recipe-list", "", "Path to a text file listing recipes to audit")
+	auditCmd.Flags().StringSliceVar(&auditSearchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	auditCmd.Flags().StringSliceVar(&auditOverrideDirs, "override-dir", []string{}, "Additional recipe override directories")
+	auditCmd.Flags().BoolVar(&auditAllowIssues, "allow-issues", false, "Don't fail when recipes have audit issues")
+	auditCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the audit as JSON, shorthand for --output json")
+
+	return auditCmd
+}
+
+// printRecipeAudits prints the issues found in each recipe
+func printRecipeAudits(audits []autopkg.RecipeAudit) {
+	if len(audits) == 0 {
+		fmt.Println("✅ No audit issues found")
+		return
+	}
+
+	for _, audit := range audits {
+		fmt.Printf("\n⚠️ %s\n", audit.Recipe)
+		for _, issue := range audit.Issues {
+			fmt.Printf("    • %s\n", strings.ReplaceAll(issue.Check, "_", " "))
+			for _, detail := range issue.Details {
+				fmt.Printf("        %s\n", detail)
+			}
+		}
+	}
+	fmt.Printf("\n❌ %d recipes have audit issues\n", len(audits))
+}
@@ -0,0 +1,110 @@
+// cmd/autopkgctl/check.go
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Check command flags
+	checkPlanPath string
+)
+
+// newCheckCmd creates the check command for polling recipes for new downloads
+func newCheckCmd() *cobra.Command {
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check recipes for new downloads without packaging or uploading",
+		Long: `Run recipes with autopkg --check, which stops each recipe after its
+download, and report which recipes have a new or changed download.
+
+The plan written with --plan is read by run --plan, which only runs the
+recipes with updates, or whose check failed. Checking is cheap enough to
+poll often, with full runs only when something changed:
+
+  autopkgctl check --recipe-list recipes.txt --plan plan.json
+  autopkgctl run --plan plan.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCheck()
+		},
+	}
+
+	checkCmd.Flags().StringVar(&recipePath, "recipe", "", "Path to an autopkg recipe to check")
+	checkCmd.Flags().StringVar(&recipesPath, "recipes", "", "Comma-separated list of autopkg recipes to check")
+	checkCmd.Flags().StringVar(&recipesListPath, "recipe-list", "", "Path to an autopkg recipe list to check. Can be a .txt or json file in array format")
+	checkCmd.Flags().StringVar(&checkPlanPath, "plan", "", "Path to write the plan of recipes with updates to, for run --plan")
+	checkCmd.Flags().StringVar(&reportPath, "report", "", "Path to save the report")
+	checkCmd.Flags().IntVar(&verboseLevel, "verbose", 2, "autopkg run verbosity level (0-3)")
+	checkCmd.Flags().StringVar(&filterName, "filter-name", "", "Only check recipes whose name matches this regular expression")
+	checkCmd.Flags().StringVar(&filterExclude, "exclude", "", "Skip recipes whose name matches this regular expression")
+	checkCmd.Flags().StringSliceVar(&filterTypes, "type", []string{}, "Only check recipes of these types (download, pkg, install, munki, jamf, intune, ws1, kandji)")
+	checkCmd.Flags().BoolVar(&verifyTrust, "verify-trust", true, "Verify trust info before checking recipes")
+	checkCmd.Flags().BoolVar(&updateTrustOnFailure, "update-trust", true, "Update trust info if verification fails")
+	checkCmd.Flags().BoolVar(&ignoreVerifyFailures, "ignore-verify-failures", false, "Check recipes even if trust verification fails")
+	checkCmd.Flags().StringSliceVar(&searchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	checkCmd.Flags().StringSliceVar(&overrideDirs, "override-dir", []string{}, "Additional recipe override directories")
+	addDownloadProxyFlags(checkCmd)
+
+	return checkCmd
+}
+
+// runCheck checks the selected recipes for new downloads and writes the plan
+func runCheck() error {
+	recipeInput, err := resolveRecipeInput()
+	if err != nil || recipeInput == "" {
+		return err
+	}
+
+	options, err := newRecipeBatchOptions()
+	if err != nil {
+		return configError(err)
+	}
+	options.CheckOnly = true
+
+	results, runErr := autopkg.RunRecipeBatch(recipeInput, options)
+	options.Tracer.Shutdown()
+	if runErr != nil {
+		logger.Logger(fmt.Sprintf("❌ Error during recipe check: %v", runErr), logger.LogError)
+	}
+
+	plan := autopkg.NewCheckPlan(options.RunID, results)
+	if checkPlanPath != "" {
+		if err := autopkg.WriteCheckPlan(checkPlanPath, plan); err != nil {
+			return withExitCode(exitError, err)
+		}
+	}
+	setResult(plan)
+
+	setActionOutputs(map[string]string{
+		"run-id":      plan.RunID,
+		"updates":     strconv.Itoa(len(plan.Updates)),
+		"has-updates": strconv.FormatBool(len(plan.Recipes()) > 0),
+		"plan":        checkPlanPath,
+	})
+
+	if !structuredOutput() {
+		printCheckPlan(plan)
+	}
+
+	if len(plan.Failed) > 0 {
+		code := recipeBatchExitCode(len(plan.Updates)+len(plan.Current), len(plan.Failed), 0)
+		return withExitCode(code, fmt.Errorf("check failed for %d recipes", len(plan.Failed)))
+	}
+	return nil
+}
+
+// printCheckPlan prints the recipes with updates and those whose check failed
+func printCheckPlan(plan *autopkg.CheckPlan) {
+	fmt.Printf("\nCheck %s: %d updates, %d current, %d failed\n", plan.RunID, len(plan.Updates), len(plan.Current), len(plan.Failed))
+	for _, recipe := range plan.Updates {
+		fmt.Printf("  🆕 %s\n", recipe)
+	}
+	for _, recipe := range plan.Failed {
+		fmt.Printf("  ❌ %s\n", recipe)
+	}
+}
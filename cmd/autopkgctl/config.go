@@ -0,0 +1,436 @@
+// cmd/autopkgctl/config.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultConfigFile is discovered in the working directory when --config isn't given
+const defaultConfigFile = "autopkgctl.yaml"
+
+// configEnvVar names the config file when neither --config nor discovery finds one
+const configEnvVar = "AUTOPKGCTL_CONFIG"
+
+var (
+	// Config flags
+	configPath string
+)
+
+// Config is the declarative autopkgctl.yaml file. Every value fills in the
+// flag of the same meaning when it isn't given on the command line or as an
+// action input. String values may reference environment variables as
+// ${NAME}, which keeps credentials out of the file.
+type Config struct {
+	Prefs       string   `yaml:"prefs"`
+	Profile     string   `yaml:"profile"`
+	StateDir    string   `yaml:"state_dir"`
+	Locale      string   `yaml:"locale"`
+	LogLevel    string   `yaml:"log_level"`
+	Repos       []string `yaml:"repos"`     // repo-add --repos
+	RepoList    string   `yaml:"repo_list"` // repo-add --repo-list
+	Concurrency int      `yaml:"concurrency"`
+	Recipes     []string `yaml:"recipes"`     // run, tui and verify-trust --recipes
+	RecipeList  string   `yaml:"recipe_list"` // run --recipe-list
+	Catalog     string   `yaml:"catalog"`
+
+	Notifications ConfigNotifications `yaml:"notifications"`
+	Credentials   ConfigCredentials   `yaml:"credentials"`
+	Downloads     ConfigDownloads     `yaml:"downloads"`
+
+	// Commands sets any other flag per command, e.g. run: {verbose: 1}
+	Commands map[string]map[string]interface{} `yaml:"commands"`
+}
+
+// ConfigNotifications holds notification settings
+type ConfigNotifications struct {
+	SlackWebhook  string `yaml:"slack_webhook"`
+	SlackChannel  string `yaml:"slack_channel"`
+	SlackUsername string `yaml:"slack_username"`
+	SlackIcon     string `yaml:"slack_icon"`
+	TeamsWebhook  string `yaml:"teams_webhook"`
+	ChangesOnly   bool   `yaml:"changes_only"`
+	Webhooks      string `yaml:"webhooks"` // Path to a webhook subscriptions file
+}
+
+// ConfigCredentials holds integration credentials, best given as ${ENV} references
+type ConfigCredentials struct {
+	GitHubToken  string `yaml:"github_token"`
+	JamfURL      string `yaml:"jamf_url"`
+	APIUsername  string `yaml:"api_username"`
+	APIPassword  string `yaml:"api_password"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	TenantID     string `yaml:"tenant_id"`
+	SMBURL       string `yaml:"smb_url"`
+	SMBUsername  string `yaml:"smb_username"`
+	SMBPassword  string `yaml:"smb_password"`
+
+	WS1APIURL       string `yaml:"ws1_api_url"`
+	WS1ClientID     string `yaml:"ws1_client_id"`
+	WS1ClientSecret string `yaml:"ws1_client_secret"`
+	WS1GroupID      string `yaml:"ws1_group_id"`
+
+	KandjiURL   string `yaml:"kandji_url"`
+	KandjiToken string `yaml:"kandji_token"`
+}
+
+// ConfigDownloads routes recipe downloads through a proxy and mirrors
+type ConfigDownloads struct {
+	HTTPProxy  string            `yaml:"http_proxy"`
+	HTTPSProxy string            `yaml:"https_proxy"`
+	NoProxy    string            `yaml:"no_proxy"`
+	Mirrors    map[string]string `yaml:"mirrors"` // Host or URL prefix to mirror URL
+}
+
+// mirrorFlagValue returns the mirrors as --download-mirror values, sorted for a stable order
+func (d ConfigDownloads) mirrorFlagValue() string {
+	pairs := make([]string, 0, len(d.Mirrors))
+	for source, mirror := range d.Mirrors {
+		pairs = append(pairs, source+"="+mirror)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// envReferencePattern matches ${NAME} environment variable references
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadConfig reads an autopkgctl.yaml file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// findConfigFile returns the config file to load: --config, then
+// ./autopkgctl.yaml, then $AUTOPKGCTL_CONFIG, or an empty string for none
+func findConfigFile() string {
+	if configPath != "" {
+		return configPath
+	}
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		return defaultConfigFile
+	}
+	return os.Getenv(configEnvVar)
+}
+
+// flagValues maps the config to flag values. Settings with a different flag
+// name per command, such as the Slack webhook, set every name they go by.
+func (c *Config) flagValues() map[string]string {
+	values := map[string]string{
+		"prefs":               c.Prefs,
+		"profile":             c.Profile,
+		"state-dir":           c.StateDir,
+		"locale":              c.Locale,
+		"log-level":           c.LogLevel,
+		"repos":               strings.Join(c.Repos, ","),
+		"repo-list":           c.RepoList,
+		"recipes":             strings.Join(c.Recipes, ","),
+		"recipe-list":         c.RecipeList,
+		"catalog":             c.Catalog,
+		"notify-slack":        c.Notifications.SlackWebhook,
+		"slack-webhook":       c.Notifications.SlackWebhook,
+		"slack-channel":       c.Notifications.SlackChannel,
+		"slack-username":      c.Notifications.SlackUsername,
+		"slack-icon":          c.Notifications.SlackIcon,
+		"notify-teams":        c.Notifications.TeamsWebhook,
+		"teams-webhook":       c.Notifications.TeamsWebhook,
+		"webhooks":            c.Notifications.Webhooks,
+		"github-token":        c.Credentials.GitHubToken,
+		"jss-url":             c.Credentials.JamfURL,
+		"api-username":        c.Credentials.APIUsername,
+		"api-password":        c.Credentials.APIPassword,
+		"client-id":           c.Credentials.ClientID,
+		"client-secret":       c.Credentials.ClientSecret,
+		"tenant-id":           c.Credentials.TenantID,
+		"smb-url":             c.Credentials.SMBURL,
+		"smb-username":        c.Credentials.SMBUsername,
+		"smb-password":        c.Credentials.SMBPassword,
+		"ws1-api-url":         c.Credentials.WS1APIURL,
+		"ws1-client-id":       c.Credentials.WS1ClientID,
+		"ws1-client-secret":   c.Credentials.WS1ClientSecret,
+		"ws1-group-id":        c.Credentials.WS1GroupID,
+		"kandji-url":          c.Credentials.KandjiURL,
+		"kandji-token":        c.Credentials.KandjiToken,
+		"http-proxy":          c.Downloads.HTTPProxy,
+		"https-proxy":         c.Downloads.HTTPSProxy,
+		"no-proxy":            c.Downloads.NoProxy,
+		"download-mirror":     c.Downloads.mirrorFlagValue(),
+		"notify-changes-only": "",
+		"concurrency":         "",
+	}
+	if c.Notifications.ChangesOnly {
+		values["notify-changes-only"] = "true"
+	}
+	if c.Concurrency > 0 {
+		values["concurrency"] = fmt.Sprint(c.Concurrency)
+	}
+	return values
+}
+
+// secretFlags are credentials that should be environment references rather than literals
+var secretFlags = map[string]bool{
+	"github-token":      true,
+	"api-password":      true,
+	"client-secret":     true,
+	"smb-password":      true,
+	"ws1-client-secret": true,
+	"kandji-token":      true,
+}
+
+// exclusiveFlagGroups are flags that select the same thing, so a config value
+// for one of them is ignored when another is given on the command line
+var exclusiveFlagGroups = [][]string{
+	{"recipe", "recipes", "recipe-list"},
+	{"repos", "repo-list"},
+	{"prefs", "profile"},
+}
+
+// commandFlagValues returns the flag values the config sets for a command,
+// with its commands section taking precedence over the general settings
+func (c *Config) commandFlagValues(cmd *cobra.Command) map[string]string {
+	values := c.flagValues()
+	for name, value := range c.Commands[cmd.Name()] {
+		switch v := value.(type) {
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
+
+// applyConfigFile sets every flag of the command that wasn't given on the
+// command line or as an action input from the config file, if there is one
+func applyConfigFile(cmd *cobra.Command) error {
+	path := findConfigFile()
+	if path == "" {
+		return nil
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	values := config.commandFlagValues(cmd)
+	for _, group := range exclusiveFlagGroups {
+		for _, name := range group {
+			if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+				for _, other := range group {
+					delete(values, other)
+				}
+				break
+			}
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := values[name]
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || flag.Changed || value == "" {
+			continue
+		}
+
+		resolved, err := resolveEnvReferences(value)
+		if err != nil {
+			return fmt.Errorf("config %s for --%s: %w", path, name, err)
+		}
+		if secretFlags[name] && resolved == value {
+			logger.Logger(fmt.Sprintf("⚠️ --%s is stored in plain text in %s, reference an environment variable as ${NAME} instead", name, path), logger.LogWarning)
+		}
+
+		if err := setConfigFlag(cmd.Flags(), flag, resolved); err != nil {
+			return fmt.Errorf("invalid value in %s for --%s: %w", path, name, err)
+		}
+		logger.Logger(fmt.Sprintf("📄 Set --%s from %s", name, path), logger.LogDebug)
+	}
+
+	// A commands section naming flags the command doesn't have is most likely a typo
+	for name := range config.Commands[cmd.Name()] {
+		if cmd.Flags().Lookup(name) == nil {
+			return fmt.Errorf("config %s sets unknown flag --%s for %s", path, name, cmd.Name())
+		}
+	}
+	return nil
+}
+
+// setConfigFlag sets a flag from a config value, replacing rather than
+// appending to the defaults of slice flags
+func setConfigFlag(flags *pflag.FlagSet, flag *pflag.Flag, value string) error {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		if err := slice.Replace(strings.Split(value, ",")); err != nil {
+			return err
+		}
+		flag.Changed = true
+		return nil
+	}
+	return flags.Set(flag.Name, value)
+}
+
+// resolveEnvReferences replaces ${NAME} references with the environment
+// variable's value, failing when a referenced variable isn't set
+func resolveEnvReferences(value string) (string, error) {
+	var missing []string
+	resolved := envReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReferencePattern.FindStringSubmatch(reference)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return envValue
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// Validate checks the config file for settings that contradict each other,
+// environment references that aren't set and malformed URLs. Credentials may
+// be split between the config and the preferences, so missing ones are left
+// to the preferences validation. It returns an *autopkg.ConfigValidationError
+// listing every problem found.
+func (c *Config) Validate(path string) error {
+	var problems []string
+
+	for _, exclusive := range []struct {
+		names string
+		set   bool
+	}{
+		{"recipes and recipe_list", len(c.Recipes) > 0 && c.RecipeList != ""},
+		{"repos and repo_list", len(c.Repos) > 0 && c.RepoList != ""},
+		{"prefs and profile", c.Prefs != "" && c.Profile != ""},
+	} {
+		if exclusive.set {
+			problems = append(problems, fmt.Sprintf("%s select the same thing, keep one of them", exclusive.names))
+		}
+	}
+	if c.Concurrency < 0 {
+		problems = append(problems, fmt.Sprintf("concurrency must be 0 or more, got %d", c.Concurrency))
+	}
+
+	resolve := func(name string, value string) string {
+		resolved, err := resolveEnvReferences(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v, export it before running autopkgctl", name, err))
+			return ""
+		}
+		return resolved
+	}
+
+	for _, setting := range []struct{ name, value string }{
+		{"credentials.jamf_url", c.Credentials.JamfURL},
+		{"credentials.ws1_api_url", c.Credentials.WS1APIURL},
+		{"credentials.kandji_url", c.Credentials.KandjiURL},
+		{"notifications.slack_webhook", c.Notifications.SlackWebhook},
+		{"notifications.teams_webhook", c.Notifications.TeamsWebhook},
+	} {
+		if value := resolve(setting.name, setting.value); value != "" {
+			if err := autopkg.ValidateHTTPSURL(setting.name, value); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	if smbURL := resolve("credentials.smb_url", c.Credentials.SMBURL); smbURL != "" {
+		if err := autopkg.ValidateSMBURL("credentials.smb_url", smbURL); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	downloads := &autopkg.DownloadProxy{
+		HTTPProxy:  resolve("downloads.http_proxy", c.Downloads.HTTPProxy),
+		HTTPSProxy: resolve("downloads.https_proxy", c.Downloads.HTTPSProxy),
+		Mirrors:    c.Downloads.Mirrors,
+	}
+	if err := downloads.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("downloads: %v", err))
+	}
+
+	// Without a tenant, client credentials are Jamf Pro's API client
+	if c.Credentials.TenantID == "" && (c.Credentials.APIUsername != "" || c.Credentials.APIPassword != "") &&
+		(c.Credentials.ClientID != "" || c.Credentials.ClientSecret != "") {
+		problems = append(problems, "credentials sets both api_username/api_password and client_id/client_secret for Jamf Pro, keep only one of them, preferably the API client")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &autopkg.ConfigValidationError{Source: path, Problems: problems}
+}
+
+// validateConfiguration validates the config file, if there is one, and the
+// preferences, so misconfiguration is reported up front rather than mid-run
+func validateConfiguration(prefsPaths ...string) error {
+	var problems []string
+	var sources []string
+	collect := func(err error) error {
+		var validationErr *autopkg.ConfigValidationError
+		if !errors.As(err, &validationErr) {
+			return err
+		}
+		sources = append(sources, validationErr.Source)
+		problems = append(problems, validationErr.Problems...)
+		return nil
+	}
+
+	if path := findConfigFile(); path != "" {
+		config, err := LoadConfig(path)
+		if err != nil {
+			return err
+		}
+		if err := collect(config.Validate(path)); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range prefsPaths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		prefs, err := autopkg.LoadPreferencesData(path)
+		if err != nil {
+			return err
+		}
+		if err := collect(prefs.Validate()); err != nil {
+			return err
+		}
+	}
+
+	if len(problems) == 0 {
+		logger.Logger("✅ Configuration is valid", logger.LogSuccess)
+		return nil
+	}
+	return &autopkg.ConfigValidationError{Source: strings.Join(sources, " and "), Problems: problems}
+}
@@ -0,0 +1,117 @@
+// cmd/autopkgctl/digest.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Digest command flags
+	digestLedgerPath string
+	digestMonths     int
+	digestTopApps    int
+	digestCostPerGB  float64
+)
+
+// newDigestCmd creates the digest command summarising run history over time
+func newDigestCmd() *cobra.Command {
+	digestCmd := &cobra.Command{
+		Use:   "digest",
+		Short: "Show monthly aggregates of AutoPkg runs",
+		Long:  "Show monthly aggregates of AutoPkg runs, including the MDM storage consumed by uploaded artifacts per app and any runs operators have annotated",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDigest()
+		},
+	}
+
+	digestCmd.Flags().StringVar(&digestLedgerPath, "storage-ledger", "", "Path to the storage ledger written by 'run --storage-ledger' (storage section is omitted if unset)")
+	digestCmd.Flags().IntVar(&digestMonths, "months", 3, "Number of most recent months to include (0 = all)")
+	digestCmd.Flags().IntVar(&digestTopApps, "top", 5, "Number of apps to list per month, ordered by storage consumed")
+	digestCmd.Flags().Float64Var(&digestCostPerGB, "cost-per-gb", 0, "Optional storage price per GiB used to estimate monthly cost")
+	digestCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the digest as JSON, shorthand for --output json")
+
+	return digestCmd
+}
+
+// digestReport is the JSON representation of the digest
+type digestReport struct {
+	Storage       []autopkg.MonthlyStorage `json:"storage"`
+	AnnotatedRuns []*autopkg.RunRecord     `json:"annotated_runs"`
+}
+
+func runDigest() error {
+	report := digestReport{
+		Storage:       []autopkg.MonthlyStorage{},
+		AnnotatedRuns: []*autopkg.RunRecord{},
+	}
+
+	if digestLedgerPath != "" {
+		ledger, err := autopkg.LoadStorageLedger(digestLedgerPath)
+		if err != nil {
+			return err
+		}
+		report.Storage = autopkg.BuildStorageDigest(ledger, digestMonths)
+	}
+
+	var since time.Time
+	if digestMonths > 0 {
+		now := time.Now()
+		since = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -(digestMonths - 1), 0)
+	}
+	runs, err := autopkg.ListRunRecords(stateDir, since)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if len(run.Annotations) > 0 {
+			report.AnnotatedRuns = append(report.AnnotatedRuns, run)
+		}
+	}
+
+	setResult(report)
+	if structuredOutput() {
+		return nil
+	}
+
+	if len(report.Storage) == 0 && len(report.AnnotatedRuns) == 0 {
+		fmt.Println(i18n.T("report.nothing_recorded"))
+		return nil
+	}
+
+	if len(report.Storage) > 0 {
+		fmt.Println(i18n.T("report.storage_heading"))
+	}
+	for _, month := range report.Storage {
+		fmt.Printf("\n%s\n", i18n.T("report.storage_month", month.Month, autopkg.FormatBytes(month.TotalBytes), month.Runs))
+		destinations := make([]string, 0, len(month.ByDestination))
+		for destination := range month.ByDestination {
+			destinations = append(destinations, destination)
+		}
+		sort.Strings(destinations)
+		for _, destination := range destinations {
+			fmt.Printf("  • %s: %s\n", destination, autopkg.FormatBytes(month.ByDestination[destination]))
+		}
+		if digestCostPerGB > 0 {
+			cost := float64(month.TotalBytes) / (1 << 30) * digestCostPerGB
+			fmt.Printf("  • %s\n", i18n.T("report.estimated_cost", cost))
+		}
+		for _, app := range autopkg.TopStorageApps(month, digestTopApps) {
+			fmt.Printf("    → %s: %s\n", app, autopkg.FormatBytes(month.ByApp[app]))
+		}
+	}
+
+	if len(report.AnnotatedRuns) > 0 {
+		fmt.Println("\n" + i18n.T("report.annotated_runs"))
+		for _, run := range report.AnnotatedRuns {
+			printRunRecord(run, false)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+// cmd/autopkgctl/doctor.go
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+// Doctor check statuses
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorCheck is the outcome of one environment check
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// doctorResult is the result document of the doctor command
+type doctorResult struct {
+	Checks     []doctorCheck             `json:"checks"`
+	RateLimits []autopkg.GitHubRateLimit `json:"github_rate_limits"`
+}
+
+// newDoctorCmd creates the doctor command for checking the runner environment
+func newDoctorCmd() *cobra.Command {
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the runner environment, GitHub rate limits and MDM credentials",
+		Long:  "Check that autopkg and git are installed and the preferences file is readable, and show the remaining GitHub API rate limit of every token in GITHUB_TOKEN and GITHUB_TOKENS. Runners sharing a token can check here how close it is to exhaustion. Jamf Pro and Intune credentials in the preferences are signed in with, showing token expiry, missing privileges or permissions and, for Intune, the throttling headroom of the app.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result := &doctorResult{}
+			result.Checks = append(result.Checks, checkTool("autopkg"), checkTool("git"), checkPreferences())
+
+			if autopkg.Offline() {
+				result.Checks = append(result.Checks, doctorCheck{Name: "github", Status: checkOK, Detail: "skipped, offline"})
+			} else {
+				result.RateLimits = autopkg.GitHubRateLimits()
+				result.Checks = append(result.Checks, checkRateLimits(result.RateLimits))
+				result.Checks = append(result.Checks, checkMDMCredentials()...)
+			}
+
+			setResult(result)
+			if !structuredOutput() {
+				printDoctorResult(result)
+			}
+
+			failed := 0
+			for _, check := range result.Checks {
+				if check.Status == checkFail {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return withExitCode(exitError, fmt.Errorf("%d environment checks failed", failed))
+			}
+			return nil
+		},
+	}
+
+	return doctorCmd
+}
+
+// checkTool checks a command line tool is on the PATH
+func checkTool(name string) doctorCheck {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return doctorCheck{Name: name, Status: checkFail, Detail: "not found on PATH"}
+	}
+	return doctorCheck{Name: name, Status: checkOK, Detail: path}
+}
+
+// checkPreferences checks the AutoPkg preferences file can be read
+func checkPreferences() doctorCheck {
+	prefs, err := autopkg.GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		return doctorCheck{Name: "preferences", Status: checkFail, Detail: err.Error()}
+	}
+	return doctorCheck{Name: "preferences", Status: checkOK, Detail: fmt.Sprintf("%d keys set", len(prefs))}
+}
+
+// checkMDMCredentials signs in to every MDM the preferences configure
+// credentials for, reporting token expiry and, for Intune, how close the app
+// is to being throttled
+func checkMDMCredentials() []doctorCheck {
+	prefs, err := autopkg.GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		return nil
+	}
+
+	var checks []doctorCheck
+	if autopkg.Integration("jamf").Enabled(prefs) {
+		checks = append(checks, checkJamfCredentials(prefs))
+	}
+	if autopkg.Integration("intune").Enabled(prefs) {
+		checks = append(checks, checkIntuneCredentials(prefs))
+	}
+	return checks
+}
+
+// checkJamfCredentials checks the Jamf Pro credentials and privileges
+func checkJamfCredentials(prefs map[string]interface{}) doctorCheck {
+	result, err := autopkg.CheckJamfCredentials(prefs)
+	if err != nil {
+		return doctorCheck{Name: "jamf", Status: checkFail, Detail: err.Error()}
+	}
+
+	check := doctorCheck{Name: "jamf", Status: checkOK, Detail: fmt.Sprintf("%s, %s auth", result.Account, result.AuthMethod)}
+	if !result.TokenExpires.IsZero() {
+		check.Detail += fmt.Sprintf(", token expires %s", result.TokenExpires.Local().Format(time.Kitchen))
+	}
+	switch {
+	case len(result.MissingPrivileges) > 0:
+		check.Status = checkFail
+		check.Detail += ", missing " + strings.Join(result.MissingPrivileges, ", ")
+	case !result.PrivilegesChecked:
+		check.Status = checkWarn
+		check.Detail += ", privileges could not be read"
+	}
+	return check
+}
+
+// checkIntuneCredentials checks the Intune app registration's Graph token,
+// permission and throttling headroom
+func checkIntuneCredentials(prefs map[string]interface{}) doctorCheck {
+	result, err := autopkg.CheckIntuneCredentials(prefs)
+	if err != nil {
+		return doctorCheck{Name: "intune", Status: checkFail, Detail: err.Error()}
+	}
+
+	check := doctorCheck{
+		Name:   "intune",
+		Status: checkOK,
+		Detail: fmt.Sprintf("app %s, token expires %s, %s", result.ClientID, result.TokenExpires.Local().Format(time.Kitchen), result.ThrottleHeadroom()),
+	}
+	switch {
+	case !result.PermissionGranted:
+		check.Status = checkFail
+		check.Detail += ", " + autopkg.IntuneRequiredPermission + " not consented"
+	case result.Throttled || result.ThrottleLimitUsage >= 0.9:
+		check.Status = checkWarn
+	}
+	return check
+}
+
+// checkRateLimits summarises the GitHub rate limits, warning when every token is running low
+func checkRateLimits(limits []autopkg.GitHubRateLimit) doctorCheck {
+	check := doctorCheck{Name: "github", Status: checkOK}
+
+	remaining, total, readable := 0, 0, 0
+	for _, limit := range limits {
+		if limit.Error != "" {
+			continue
+		}
+		readable++
+		remaining += limit.Remaining
+		total += limit.Limit
+	}
+
+	switch {
+	case readable == 0:
+		check.Status = checkWarn
+		check.Detail = "rate limits could not be read"
+	case remaining == 0:
+		check.Status = checkFail
+		check.Detail = fmt.Sprintf("rate limit exhausted for all %d tokens", len(limits))
+	case remaining*10 < total:
+		check.Status = checkWarn
+		check.Detail = fmt.Sprintf("%d of %d requests left across %d tokens", remaining, total, len(limits))
+	default:
+		check.Detail = fmt.Sprintf("%d of %d requests left across %d tokens", remaining, total, len(limits))
+	}
+	if len(limits) == 1 && limits[0].Token == "anonymous" {
+		check.Detail += ", unauthenticated: set GITHUB_TOKEN to raise the limit"
+		if check.Status == checkOK {
+			check.Status = checkWarn
+		}
+	}
+	return check
+}
+
+// printDoctorResult prints the environment checks and per-token rate limits
+func printDoctorResult(result *doctorResult) {
+	icons := map[string]string{checkOK: "✅", checkWarn: "⚠️", checkFail: "❌"}
+	for _, check := range result.Checks {
+		fmt.Printf("%s %-12s %s\n", icons[check.Status], check.Name, check.Detail)
+	}
+
+	if len(result.RateLimits) == 0 {
+		return
+	}
+	fmt.Println("\nGitHub rate limits:")
+	for _, limit := range result.RateLimits {
+		if limit.Error != "" {
+			fmt.Printf("  %-10s %s\n", limit.Token, limit.Error)
+			continue
+		}
+		fmt.Printf("  %-10s %5d/%-5d resets %s\n", limit.Token, limit.Remaining, limit.Limit, limit.Reset.Local().Format(time.Kitchen))
+	}
+}
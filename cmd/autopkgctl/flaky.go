@@ -0,0 +1,111 @@
+// cmd/autopkgctl/flaky.go
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Flaky command flags
+	flakySince    time.Duration
+	flakyMinRuns  int
+	flakyMinScore float64
+	flakyTop      int
+)
+
+// newFlakyCmd creates the flaky command for finding recipes that alternate between success and failure
+func newFlakyCmd() *cobra.Command {
+	flakyCmd := &cobra.Command{
+		Use:   "flaky",
+		Short: "List recipes that alternate between success and failure",
+		Long: `Score every recipe in the run history by how often its outcome flipped
+between consecutive runs: 0 for a recipe that always succeeds or always
+fails, 1 for one that alternates every run. Skipped and blocked runs are
+ignored. Recipes scoring at least --min-score over --min-runs are listed,
+flakiest first.
+
+With --notify-slack or --notify-teams the list is sent as one summary, e.g.
+from a weekly scheduled workflow:
+
+  autopkgctl flaky --since 168h --top 10 --notify-slack "$SLACK_WEBHOOK"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := historyPath
+			if path == "" {
+				path = autopkg.DefaultHistoryPath(stateDir)
+			}
+
+			history, err := autopkg.OpenHistory(path)
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+
+			options := autopkg.FlakinessOptions{
+				MinRuns:  flakyMinRuns,
+				MinScore: flakyMinScore,
+				Top:      flakyTop,
+			}
+			if flakySince > 0 {
+				options.Since = time.Now().Add(-flakySince)
+			}
+
+			flaky, err := autopkg.FindFlakyRecipes(history, options)
+			if err != nil {
+				return err
+			}
+			setResult(flaky)
+
+			if !structuredOutput() {
+				printFlakyRecipes(flaky)
+			}
+
+			notification := autopkg.NotificationOptions{
+				EnableTeams:   teamsWebhook != "",
+				TeamsWebhook:  teamsWebhook,
+				EnableSlack:   slackWebhook != "",
+				SlackWebhook:  slackWebhook,
+				SlackUsername: slackUsername,
+				SlackChannel:  slackChannel,
+				SlackIcon:     slackIcon,
+			}
+			if err := autopkg.NotifyFlakyRecipes(notification, flaky); err != nil {
+				return withExitCode(exitError, err)
+			}
+			return nil
+		},
+	}
+
+	flakyCmd.Flags().StringVar(&historyPath, "history", "", "Path to the run history database (defaults to history.db in the state directory)")
+	flakyCmd.Flags().DurationVar(&flakySince, "since", 30*24*time.Hour, "Only score runs within this duration (0 = all)")
+	flakyCmd.Flags().IntVar(&flakyMinRuns, "min-runs", 4, "Runs a recipe needs within --since to be scored")
+	flakyCmd.Flags().Float64Var(&flakyMinScore, "min-score", 0.3, "Lowest flakiness score listed, from 0 to 1")
+	flakyCmd.Flags().IntVar(&flakyTop, "top", 0, "List at most this many recipes (0 = all)")
+	flakyCmd.Flags().StringVar(&slackWebhook, "notify-slack", "", "Slack webhook to send the flaky recipes to")
+	flakyCmd.Flags().StringVar(&teamsWebhook, "notify-teams", "", "Microsoft Teams webhook to send the flaky recipes to")
+	flakyCmd.Flags().StringVar(&slackUsername, "slack-username", "AutoPkg Bot", "Username to display in Slack notifications")
+	flakyCmd.Flags().StringVar(&slackChannel, "slack-channel", "", "Slack channel for notifications")
+	flakyCmd.Flags().StringVar(&slackIcon, "slack-icon", ":package:", "Emoji icon for Slack notifications")
+	flakyCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output flaky recipes as JSON, shorthand for --output json")
+
+	return flakyCmd
+}
+
+// printFlakyRecipes lists flaky recipes with their scores and last failure
+func printFlakyRecipes(flaky []autopkg.RecipeFlakiness) {
+	if len(flaky) == 0 {
+		fmt.Println("ℹ️ No flaky recipes")
+		return
+	}
+
+	fmt.Printf("🎲 %d flaky recipes\n", len(flaky))
+	for _, recipe := range flaky {
+		fmt.Printf("  • %-40s %3.0f%%  %d flips, %d of %d runs failed\n", recipe.Recipe, recipe.Score*100, recipe.Flips, recipe.Failures, recipe.Runs)
+		if recipe.LastError != "" {
+			fmt.Printf("      last failure %s: %s\n", recipe.LastFailure.Local().Format("2006-01-02 15:04"), recipe.LastError)
+		}
+	}
+}
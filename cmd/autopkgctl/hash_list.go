@@ -0,0 +1,155 @@
+// cmd/autopkgctl/hash_list.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Hash-list command flags
+	hashListSigningKey string
+	hashListDeny       bool
+	hashListReason     string
+	hashListAddedBy    string
+	hashListName       string
+)
+
+// newHashListCmd creates the hash-list command group for the known good and bad artifact hashes
+func newHashListCmd() *cobra.Command {
+	hashListCmd := &cobra.Command{
+		Use:   "hash-list",
+		Short: "List, add or remove known good and bad artifact hashes",
+		Long: `The hash list is a JSON file of artifact SHA256s, each on the allowlist or
+the denylist with who added it and why. Runs with --hash-list fail recipes
+that produce a denylisted package or disk image, and skip the notarization
+check and artifact diff of recipes whose artifacts are all allowlisted.
+
+Sign the list with --signing-key, an ed25519 PEM private key, and runs given
+--hash-list-public-key refuse a list that was edited without it:
+
+  autopkgctl hash-list add ~/Downloads/Zoom.pkg --hash-list configuration/hash_list.json --reason "Reviewed by security" --signing-key hash_list.pem
+  autopkgctl hash-list add 3f2a… --deny --hash-list configuration/hash_list.json --reason "Trojanised installer"
+  autopkgctl run --recipes Zoom.pkg --hash-list configuration/hash_list.json --hash-list-public-key hash_list.pub`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Show the hashes on the allowlist and denylist",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := loadHashListFlag()
+			if err != nil {
+				return err
+			}
+			setResult(list.Entries)
+			if structuredOutput() {
+				return nil
+			}
+			if len(list.Entries) == 0 {
+				fmt.Println("ℹ️ The hash list is empty")
+			}
+			for _, entry := range list.Entries {
+				fmt.Printf("%-5s %s %s\n      added by %s on %s: %s\n", entry.List, entry.SHA256, entry.Name,
+					entry.AddedBy, entry.AddedAt.Format("2006-01-02"), entry.Reason)
+			}
+			return nil
+		},
+	}
+
+	addCmd := &cobra.Command{
+		Use:   "add <sha256_or_file>",
+		Short: "Put a hash, or the hash of a file, on the allowlist or with --deny the denylist",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checksum, name, err := autopkg.HashListTarget(args[0])
+			if err != nil {
+				return configError(err)
+			}
+			if hashListName != "" {
+				name = hashListName
+			}
+			list, err := loadHashListFlag()
+			if err != nil {
+				return err
+			}
+
+			entry := autopkg.HashListEntry{SHA256: checksum, List: autopkg.HashAllowed, Name: name, AddedBy: hashListAddedBy, Reason: hashListReason}
+			if hashListDeny {
+				entry.List = autopkg.HashDenied
+			}
+			if entry.AddedBy == "" {
+				entry.AddedBy = defaultAnnotationAuthor()
+			}
+			added, err := list.Add(entry)
+			if err != nil {
+				return configError(err)
+			}
+			if err := list.Save(hashListSigningKey); err != nil {
+				return err
+			}
+
+			setResult(added)
+			fmt.Printf("✅ Added %s to the %slist\n", added.SHA256, added.List)
+			return nil
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <sha256_or_file>",
+		Short: "Take a hash, or the hash of a file, off the hash list",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checksum, _, err := autopkg.HashListTarget(args[0])
+			if err != nil {
+				return configError(err)
+			}
+			list, err := loadHashListFlag()
+			if err != nil {
+				return err
+			}
+
+			removed := list.Remove(checksum)
+			if removed == nil {
+				return configError(fmt.Errorf("%s is not on the hash list", checksum))
+			}
+			if err := list.Save(hashListSigningKey); err != nil {
+				return err
+			}
+
+			setResult(removed)
+			fmt.Printf("✅ Removed %s from the %slist\n", removed.SHA256, removed.List)
+			return nil
+		},
+	}
+
+	hashListCmd.PersistentFlags().StringVar(&hashListPath, "hash-list", "", "Path to the JSON hash list")
+	hashListCmd.PersistentFlags().StringVar(&hashListPublicKey, "hash-list-public-key", "", "Path to an ed25519 PEM public key the hash list must be signed with")
+	for _, command := range []*cobra.Command{addCmd, removeCmd} {
+		command.Flags().StringVar(&hashListSigningKey, "signing-key", "", "Path to an ed25519 PEM private key to sign the hash list with; without it the list is saved unsigned")
+	}
+	addCmd.Flags().BoolVar(&hashListDeny, "deny", false, "Put the hash on the denylist instead of the allowlist")
+	addCmd.Flags().StringVar(&hashListReason, "reason", "", "Why the hash is listed, required")
+	addCmd.Flags().StringVar(&hashListAddedBy, "by", "", "Who listed the hash (defaults to $GITHUB_ACTOR or $USER)")
+	addCmd.Flags().StringVar(&hashListName, "name", "", "What the hash is of (defaults to the file name)")
+
+	hashListCmd.AddCommand(listCmd)
+	hashListCmd.AddCommand(addCmd)
+	hashListCmd.AddCommand(removeCmd)
+
+	return hashListCmd
+}
+
+// loadHashListFlag loads the hash list --hash-list points to
+func loadHashListFlag() (*autopkg.HashList, error) {
+	if hashListPath == "" {
+		return nil, configError(fmt.Errorf("--hash-list is required"))
+	}
+	list, err := autopkg.LoadHashList(hashListPath, hashListPublicKey)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return list, nil
+}
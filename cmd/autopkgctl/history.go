@@ -0,0 +1,150 @@
+// cmd/autopkgctl/history.go
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// History command flags
+	historyPath        string
+	historySince       time.Duration
+	historyTrendPeriod time.Duration
+)
+
+// recipeHistoryReport is the JSON representation of a recipe's history
+type recipeHistoryReport struct {
+	Recipe string                       `json:"recipe"`
+	Runs   []autopkg.HistoryEntry       `json:"runs"`
+	Trend  []autopkg.DurationTrendPoint `json:"duration_trend"`
+}
+
+// runAnnotations caches the notes of the runs history entries belong to, by run ID
+type runAnnotations map[string][]autopkg.RunAnnotation
+
+// of returns the notes attached to a run, none when its record is missing
+func (a runAnnotations) of(runID string) []autopkg.RunAnnotation {
+	if runID == "" {
+		return nil
+	}
+	annotations, loaded := a[runID]
+	if !loaded {
+		if record, err := autopkg.LoadRunRecord(stateDir, runID); err == nil {
+			annotations = record.Annotations
+		}
+		a[runID] = annotations
+	}
+	return annotations
+}
+
+// newHistoryCmd creates the history command for querying the run history database
+func newHistoryCmd() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:   "history [recipe]",
+		Short: "Query the recipe run history",
+		Long:  "Without a recipe, list the apps that updated within --since. With a recipe, list its runs and the average run duration per --trend-period. Notes attached to a run with annotate are shown under its entries.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := historyPath
+			if path == "" {
+				path = autopkg.DefaultHistoryPath(stateDir)
+			}
+
+			history, err := autopkg.OpenHistory(path)
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+
+			var since time.Time
+			if historySince > 0 {
+				since = time.Now().Add(-historySince)
+			}
+
+			if len(args) == 0 {
+				return printUpdatedApps(history, since)
+			}
+			return printRecipeHistory(history, args[0], since)
+		},
+	}
+
+	historyCmd.Flags().StringVar(&historyPath, "history", "", "Path to the run history database (defaults to history.db in the state directory)")
+	historyCmd.Flags().DurationVar(&historySince, "since", 7*24*time.Hour, "Only include runs within this duration (0 = all)")
+	historyCmd.Flags().DurationVar(&historyTrendPeriod, "trend-period", 7*24*time.Hour, "Period used to average run durations")
+	historyCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output history as JSON, shorthand for --output json")
+
+	return historyCmd
+}
+
+// printUpdatedApps lists the latest update of every recipe that updated since a time
+func printUpdatedApps(history *autopkg.History, since time.Time) error {
+	updated, err := history.UpdatedSince(since)
+	if err != nil {
+		return err
+	}
+
+	setResult(updated)
+	if structuredOutput() {
+		return nil
+	}
+
+	if len(updated) == 0 {
+		fmt.Println("ℹ️ No recipes updated")
+		return nil
+	}
+
+	annotations := runAnnotations{}
+	fmt.Printf("🆕 %d recipes updated\n", len(updated))
+	for _, entry := range updated {
+		fmt.Printf("  • %-40s %-15s %s\n", entry.Recipe, entry.Version, entry.Timestamp.Local().Format("2006-01-02 15:04"))
+		printAnnotations(annotations.of(entry.RunID), "      ")
+	}
+	return nil
+}
+
+// printRecipeHistory lists a recipe's runs and its duration trend
+func printRecipeHistory(history *autopkg.History, recipe string, since time.Time) error {
+	report := recipeHistoryReport{Recipe: recipe}
+
+	var err error
+	if report.Runs, err = history.RecipeHistory(recipe, since); err != nil {
+		return err
+	}
+	if report.Trend, err = history.DurationTrend(recipe, historyTrendPeriod, since); err != nil {
+		return err
+	}
+
+	setResult(report)
+	if structuredOutput() {
+		return nil
+	}
+
+	if len(report.Runs) == 0 {
+		fmt.Printf("ℹ️ No runs recorded for %s\n", recipe)
+		return nil
+	}
+
+	annotations := runAnnotations{}
+	fmt.Printf("📜 %s: %d runs\n", recipe, len(report.Runs))
+	for _, entry := range report.Runs {
+		icon := "✅"
+		if entry.Status == "failed" {
+			icon = "❌"
+		}
+		fmt.Printf("  %s %s  %-10s %-15s %s\n", icon, entry.Timestamp.Local().Format("2006-01-02 15:04"), entry.Status, entry.Version, entry.Duration.Round(time.Second))
+		if entry.Error != "" {
+			fmt.Printf("      %s\n", entry.Error)
+		}
+		printAnnotations(annotations.of(entry.RunID), "      ")
+	}
+
+	fmt.Println("\n⏱️ Average duration")
+	for _, point := range report.Trend {
+		fmt.Printf("  • %s: %s over %d runs\n", point.PeriodStart.Local().Format("2006-01-02"), point.AverageDuration.Round(time.Second), point.Runs)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// cmd/autopkgctl/latest.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Latest command flags
+	latestHistoryPath string
+)
+
+// newLatestCmd creates the latest command for querying the newest built version of an app
+func newLatestCmd() *cobra.Command {
+	latestCmd := &cobra.Command{
+		Use:   "latest <app>",
+		Short: "Show the latest built version of an app and where it was uploaded",
+		Long:  "Answer the latest built version, artifact hash and MDM destinations of an app from the run history, matching the app name against recipe names, e.g. Firefox matches Firefox.pkg and Firefox.jamf.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := latestHistoryPath
+			if path == "" {
+				path = autopkg.DefaultHistoryPath(stateDir)
+			}
+
+			history, err := autopkg.OpenHistory(path)
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+
+			build, err := history.Latest(args[0])
+			if err != nil {
+				return err
+			}
+			if build == nil {
+				return fmt.Errorf("no successful build recorded for %s", args[0])
+			}
+
+			setActionOutputs(map[string]string{
+				"version":         build.Version,
+				"recipe":          build.Recipe,
+				"artifact-sha256": build.ArtifactSHA256,
+			})
+
+			setResult(build)
+			if structuredOutput() {
+				return nil
+			}
+
+			printLatestBuild(build)
+			return nil
+		},
+	}
+
+	latestCmd.Flags().StringVar(&latestHistoryPath, "history", "", "Path to the run history database (defaults to history.db in the state directory)")
+	latestCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the latest build as JSON, shorthand for --output json")
+
+	return latestCmd
+}
+
+// printLatestBuild prints the latest build of an app
+func printLatestBuild(build *autopkg.LatestBuild) {
+	fmt.Printf("📦 %s %s\n", build.App, build.Version)
+	fmt.Printf("  Recipe:   %s\n", build.Recipe)
+	fmt.Printf("  Built:    %s (run %s)\n", build.BuiltAt.Local().Format("2006-01-02 15:04"), build.RunID)
+	if build.ArtifactPath != "" {
+		fmt.Printf("  Artifact: %s\n", build.ArtifactPath)
+	}
+	if build.ArtifactSHA256 != "" {
+		fmt.Printf("  SHA-256:  %s\n", build.ArtifactSHA256)
+	}
+
+	if len(build.Destinations) == 0 {
+		fmt.Println("  Destinations: none recorded")
+		return
+	}
+	fmt.Println("  Destinations:")
+	for _, receipt := range build.Destinations {
+		destination := receipt.Tenant
+		if receipt.Location != "" {
+			destination += " " + receipt.Location
+		}
+		fmt.Printf("    • %-8s %s (%s)\n", receipt.Phase, destination, receipt.Timestamp.Local().Format("2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,58 @@
+// cmd/autopkgctl/list_recipes.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// List-recipes command flags
+	listShowAll      bool
+	listSearchDirs   []string
+	listOverrideDirs []string
+)
+
+// newListRecipesCmd creates the list-recipes command
+func newListRecipesCmd() *cobra.Command {
+	listRecipesCmd := &cobra.Command{
+		Use:   "list-recipes",
+		Short: "List recipes available locally",
+		Long:  "List recipes available locally. With --output json or yaml, output each recipe's name, identifier, path, type and override status for downstream tooling.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options := &autopkg.ListRecipeOptions{
+				PrefsPath:    prefsPath,
+				ShowAll:      listShowAll,
+				SearchDirs:   listSearchDirs,
+				OverrideDirs: listOverrideDirs,
+			}
+
+			if !structuredOutput() {
+				options.WithIdentifiers = true
+				output, err := autopkg.ListRecipes(options)
+				if err != nil {
+					return err
+				}
+				fmt.Print(output)
+				return nil
+			}
+
+			recipes, err := autopkg.ListRecipeInfo(options)
+			if err != nil {
+				return err
+			}
+			setResult(recipes)
+			return nil
+		},
+	}
+
+	listRecipesCmd.Flags().BoolVar(&listShowAll, "show-all", false, "Include recipes shadowed by overrides")
+	listRecipesCmd.Flags().StringSliceVar(&listSearchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	listRecipesCmd.Flags().StringSliceVar(&listOverrideDirs, "override-dir", []string{}, "Additional recipe override directories")
+	listRecipesCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output recipes as JSON, shorthand for --output json")
+	listRecipesCmd.Flags().BoolVar(&yamlOutput, "yaml", false, "Output recipes as YAML, shorthand for --output yaml")
+
+	return listRecipesCmd
+}
@@ -0,0 +1,488 @@
+// cmd/autopkgctl/logs.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/server"
+	"github.com/spf13/cobra"
+)
+
+// logsPollInterval is how often a followed run is checked for new output
+const logsPollInterval = 500 * time.Millisecond
+
+var (
+	// Logs command flags
+	logsDir     string
+	logsFollow  bool
+	logsRecipes []string
+	logsTail    int
+	logsLimit   int
+)
+
+// logsRun is a recent run in the logs listing
+type logsRun struct {
+	RunID     string    `json:"run_id"`
+	Status    string    `json:"status"`
+	Trigger   string    `json:"trigger,omitempty"` // Set for runs started by autopkgctl serve
+	StartTime time.Time `json:"start_time"`
+	Duration  string    `json:"duration,omitempty"`
+	Recipes   int       `json:"recipes"`
+	Failed    int       `json:"failed"`
+	LogDir    string    `json:"log_dir,omitempty"`
+}
+
+// runLogs is the result document of the logs of a run
+type runLogs struct {
+	RunID   string      `json:"run_id"`
+	Dir     string      `json:"dir"`
+	Recipes []recipeLog `json:"recipes"`
+}
+
+// recipeLog is the archived output of a recipe
+type recipeLog struct {
+	Recipe string `json:"recipe"`
+	Output string `json:"output"`
+}
+
+// newLogsCmd creates the logs command listing recent runs and showing their recipe logs
+func newLogsCmd() *cobra.Command {
+	logsCmd := &cobra.Command{
+		Use:   "logs [run-id]",
+		Short: "List recent runs, or show and follow the recipe logs of a run",
+		Long: `Without a run ID, list recent runs: those in the run history, those with
+archived recipe logs and those autopkgctl serve has queued or is running.
+
+With a run ID, print the archived autopkg output of the run's recipes, each
+under a ==> recipe <== header. --recipe narrows it to recipes by name or glob,
+e.g. Firefox or *.jamf. With --follow, keep printing output as the recipes
+write it until the run finishes, waiting for a queued run to start; without
+a run ID it follows the newest run.
+
+Logs are read from the state directory, so use the same --state-dir (and
+--log-dir) as the runs, e.g. those the daemon started from webhooks.`,
+		Example: `  autopkgctl logs
+  autopkgctl logs -f
+  autopkgctl logs 20240611T020000Z-a1b2c3 --recipe Firefox -f
+  autopkgctl logs 20240611T020000Z-d4e5f6 --recipe '*.jamf' --tail 50`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if logsFollow && structuredOutput() {
+				return configError(fmt.Errorf("--follow can't be used with --output %s", outputFormat))
+			}
+			if logsTail < 0 {
+				return configError(fmt.Errorf("--tail can't be negative"))
+			}
+
+			runs, err := listRecentRuns()
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 && !logsFollow {
+				if logsLimit > 0 && len(runs) > logsLimit {
+					runs = runs[:logsLimit]
+				}
+				setResult(runs)
+				if !structuredOutput() {
+					printRecentRuns(runs)
+				}
+				return nil
+			}
+
+			runID := ""
+			if len(args) > 0 {
+				runID = args[0]
+			} else if len(runs) > 0 {
+				runID = runs[0].RunID
+			} else {
+				return fmt.Errorf("no runs to follow")
+			}
+			return showRunLogs(runID)
+		},
+	}
+
+	logsCmd.Flags().StringVar(&logsDir, "log-dir", "", "Directory of archived recipe logs (defaults to logs in the state directory)")
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep printing the run's output until it finishes")
+	logsCmd.Flags().StringSliceVar(&logsRecipes, "recipe", []string{}, "Only show recipes matching this name or glob (can be specified multiple times)")
+	logsCmd.Flags().IntVarP(&logsTail, "tail", "n", 0, "Only show the last lines of each recipe's log so far, 0 shows all")
+	logsCmd.Flags().IntVar(&logsLimit, "limit", 20, "Number of recent runs to list, 0 lists all")
+	logsCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output runs or logs as JSON, shorthand for --output json")
+
+	return logsCmd
+}
+
+// logArchiveDir returns the directory of archived recipe logs
+func logArchiveDir() string {
+	if logsDir != "" {
+		return logsDir
+	}
+	return autopkg.DefaultLogDir(stateDir)
+}
+
+// listRecentRuns merges the run records, archived logs and server runs into
+// one list, newest first
+func listRecentRuns() ([]*logsRun, error) {
+	byID := make(map[string]*logsRun)
+	get := func(runID string) *logsRun {
+		if byID[runID] == nil {
+			byID[runID] = &logsRun{RunID: runID, Status: "unfinished"}
+		}
+		return byID[runID]
+	}
+
+	archived, err := autopkg.ListArchivedRuns(logArchiveDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, archive := range archived {
+		run := get(archive.RunID)
+		run.LogDir = archive.Dir
+		run.Recipes = len(archive.Recipes)
+		run.StartTime = archive.ModTime
+	}
+
+	records, err := autopkg.ListRunRecords(stateDir, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		run := get(record.RunID)
+		run.Status = record.Status
+		run.StartTime = record.StartTime
+		run.Duration = record.EndTime.Sub(record.StartTime).Round(time.Second).String()
+		run.Recipes = len(record.Recipes)
+		for _, recipe := range record.Recipes {
+			if recipe.Status == "failed" {
+				run.Failed++
+			}
+		}
+	}
+
+	serverRuns, err := server.ReadRuns(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, serverRun := range serverRuns {
+		run := get(serverRun.ID)
+		run.Trigger = serverRun.Trigger
+		if run.StartTime.IsZero() {
+			run.StartTime = serverRun.CreatedAt
+		}
+		if run.Recipes == 0 {
+			run.Recipes = len(serverRun.Recipes)
+		}
+		// The server knows a run is still going, or ended without a record
+		if !serverRun.Finished() || run.Status == "unfinished" {
+			run.Status = serverRun.Status
+		}
+	}
+
+	runs := make([]*logsRun, 0, len(byID))
+	for _, run := range byID {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].StartTime.Equal(runs[j].StartTime) {
+			return runs[i].StartTime.After(runs[j].StartTime)
+		}
+		return runs[i].RunID > runs[j].RunID
+	})
+	return runs, nil
+}
+
+// printRecentRuns prints the recent runs listing
+func printRecentRuns(runs []*logsRun) {
+	if len(runs) == 0 {
+		fmt.Println("ℹ️ No runs recorded")
+		return
+	}
+
+	fmt.Printf("🗂️ %d recent runs\n", len(runs))
+	for _, run := range runs {
+		icon := "✅"
+		switch run.Status {
+		case "failure", server.StatusFailed:
+			icon = "❌"
+		case server.StatusQueued:
+			icon = "⏳"
+		case server.StatusRunning, "unfinished":
+			icon = "🚀"
+		}
+		recipes := fmt.Sprintf("%d recipes", run.Recipes)
+		if run.Failed > 0 {
+			recipes += fmt.Sprintf(", %d failed", run.Failed)
+		}
+		logs := ""
+		if run.LogDir == "" {
+			logs = "  (no logs)"
+		}
+		fmt.Printf("  %s %-24s %-10s %s %-8s %-12s %s%s\n", icon, run.RunID, run.Status, run.StartTime.Local().Format("2006-01-02 15:04"), run.Duration, run.Trigger, recipes, logs)
+	}
+}
+
+// runFinished reports whether a run has ended: it wrote its run record, or
+// the server ended it without one
+func runFinished(runID string) bool {
+	if _, err := autopkg.LoadRunRecord(stateDir, runID); err == nil {
+		return true
+	}
+	if serverRun := findServerRun(runID); serverRun != nil {
+		return serverRun.Finished()
+	}
+	return false
+}
+
+// findServerRun returns the autopkgctl serve run of an ID, nil when the server didn't start it
+func findServerRun(runID string) *server.Run {
+	runs, err := server.ReadRuns(stateDir)
+	if err != nil {
+		return nil
+	}
+	for _, run := range runs {
+		if run.ID == runID {
+			return run
+		}
+	}
+	return nil
+}
+
+// runLogDir returns the directory of a run's archived logs. Runs archiving to
+// another --log-dir are found through the log paths of their run record.
+func runLogDir(runID string) (string, error) {
+	if err := autopkg.ValidateRunID(runID); err != nil {
+		return "", err
+	}
+	dir := autopkg.RunLogDir(logArchiveDir(), runID)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	if record, err := autopkg.LoadRunRecord(stateDir, runID); err == nil {
+		for _, recipe := range record.Recipes {
+			if recipe.LogPath == "" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Dir(recipe.LogPath)); err == nil {
+				return filepath.Dir(recipe.LogPath), nil
+			}
+		}
+		return "", fmt.Errorf("run %s has no archived logs, it ran without a log archive or its logs were pruned", runID)
+	}
+	if findServerRun(runID) == nil {
+		return "", fmt.Errorf("run %s not found", runID)
+	}
+	// Not started yet, its logs show up once it does
+	return dir, nil
+}
+
+// matchRecipeLog reports whether a recipe log is selected by --recipe
+func matchRecipeLog(name string) bool {
+	if len(logsRecipes) == 0 {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, pattern := range logsRecipes {
+		pattern = strings.ToLower(autopkg.RecipeLogName(pattern))
+		if name == pattern || strings.HasPrefix(name, pattern+".") {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// showRunLogs prints the recipe logs of a run, following them with --follow
+func showRunLogs(runID string) error {
+	dir, err := runLogDir(runID)
+	if err != nil {
+		return err
+	}
+
+	if structuredOutput() {
+		result := &runLogs{RunID: runID, Dir: dir, Recipes: []recipeLog{}}
+		names, err := autopkg.RecipeLogNames(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read logs of run %s: %w", runID, err)
+		}
+		for _, name := range names {
+			if !matchRecipeLog(name) {
+				continue
+			}
+			output, err := readRecipeLog(dir, name)
+			if err != nil {
+				return err
+			}
+			result.Recipes = append(result.Recipes, recipeLog{Recipe: name, Output: tailLines(output, logsTail)})
+		}
+		setResult(result)
+		return nil
+	}
+
+	tail := &logTailer{dir: dir, offsets: make(map[string]int64), sizes: make(map[string][2]int64), out: os.Stdout}
+	if !logsFollow {
+		if err := tail.poll(); err != nil {
+			return err
+		}
+		tail.endLine()
+		if len(tail.offsets) == 0 {
+			fmt.Printf("ℹ️ No logs of run %s match\n", runID)
+		}
+		return nil
+	}
+
+	waiting := false
+	for {
+		finished := runFinished(runID)
+		if err := tail.poll(); err != nil {
+			return err
+		}
+		if finished {
+			tail.endLine()
+			return nil
+		}
+		if len(tail.offsets) == 0 && !waiting {
+			if serverRun := findServerRun(runID); serverRun != nil && serverRun.Status == server.StatusQueued {
+				fmt.Printf("⏳ Waiting for run %s to start\n", runID)
+				waiting = true
+			}
+		}
+		time.Sleep(logsPollInterval)
+	}
+}
+
+// readRecipeLog reads a recipe's whole archived log
+func readRecipeLog(dir string, name string) (string, error) {
+	log, err := autopkg.OpenRecipeLog(dir, name)
+	if err != nil {
+		return "", err
+	}
+	defer log.Close()
+	data, err := io.ReadAll(log)
+	if err != nil {
+		return "", fmt.Errorf("failed to read log of %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// tailLines returns the last lines of output, all of it when lines is 0
+func tailLines(output string, lines int) string {
+	if lines <= 0 {
+		return output
+	}
+	trimmed := strings.TrimSuffix(output, "\n")
+	index := len(trimmed)
+	for i := 0; i < lines; i++ {
+		index = strings.LastIndex(trimmed[:index], "\n")
+		if index < 0 {
+			return output
+		}
+	}
+	return output[index+1:]
+}
+
+// logTailer prints what the recipe logs of a run directory gained since it
+// last looked, tail -f style with a header whenever the recipe changes
+type logTailer struct {
+	dir     string
+	offsets map[string]int64    // Bytes of each recipe's log printed so far
+	sizes   map[string][2]int64 // Compressed and plain file sizes when last read completely
+	out     io.Writer
+
+	current    string // Recipe whose output was printed last
+	midLine    bool   // The last output didn't end with a newline
+	hasPrinted bool
+}
+
+// poll prints the new output of every selected recipe log
+func (t *logTailer) poll() error {
+	names, err := autopkg.RecipeLogNames(t.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read logs: %w", err)
+	}
+
+	for _, name := range names {
+		if !matchRecipeLog(name) {
+			continue
+		}
+		sizes := [2]int64{fileSize(filepath.Join(t.dir, name+autopkg.CompressedRecipeLogExtension)), fileSize(filepath.Join(t.dir, name+autopkg.RecipeLogExtension))}
+		if previous, ok := t.sizes[name]; ok && previous == sizes {
+			continue
+		}
+
+		_, seen := t.offsets[name]
+		data, complete := t.read(name)
+		if !seen {
+			data = []byte(tailLines(string(data), logsTail))
+		}
+		if len(data) > 0 {
+			t.print(name, data)
+		}
+		if complete {
+			t.sizes[name] = sizes
+		}
+	}
+	return nil
+}
+
+// read returns a recipe log's output past what was printed, and whether it
+// read to the end. A log being compressed ends early and is read again.
+func (t *logTailer) read(name string) ([]byte, bool) {
+	offset := t.offsets[name]
+	t.offsets[name] = offset
+	log, err := autopkg.OpenRecipeLog(t.dir, name)
+	if err != nil {
+		return nil, false
+	}
+	defer log.Close()
+
+	if skipped, err := io.CopyN(io.Discard, log, offset); err != nil || skipped < offset {
+		return nil, false
+	}
+	data, err := io.ReadAll(log)
+	t.offsets[name] = offset + int64(len(data))
+	return data, err == nil
+}
+
+// print writes output of a recipe, with a header when another recipe printed last
+func (t *logTailer) print(name string, data []byte) {
+	if name != t.current {
+		t.endLine()
+		if t.hasPrinted {
+			fmt.Fprintln(t.out)
+		}
+		fmt.Fprintf(t.out, "==> %s <==\n", name)
+		t.current = name
+	}
+	t.out.Write(data)
+	t.midLine = data[len(data)-1] != '\n'
+	t.hasPrinted = true
+}
+
+// endLine ends a partly printed line
+func (t *logTailer) endLine() {
+	if t.midLine {
+		fmt.Fprintln(t.out)
+		t.midLine = false
+	}
+}
+
+// fileSize returns the size of a file, -1 when it doesn't exist
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
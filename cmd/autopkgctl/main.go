@@ -2,13 +2,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
 	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
 	"github.com/spf13/cobra"
 )
@@ -18,15 +22,30 @@ var (
 	logLevel     string
 	prefsPath    string
 	repoListPath string
+	stateDir     string
+	locale       string
+	offlineMode  bool
 
 	// Setup command flags
-	forceUpdate bool
-	useBeta     bool
-	checkGit    bool
-	checkRoot   bool
+	forceUpdate    bool
+	useBeta        bool
+	checkGit       bool
+	userSpace      bool
+	installPrefix  string
+	pinVersion     string
+	setupRecipes   string
+	installBackend string
+	checkRoot      bool
+
+	processorReposPath string
 
 	// Repo-add command flags
-	reposStr string
+	reposStr         string
+	repoAddListPath  string
+	nativeClone      bool
+	cloneConcurrency int
+	fullClone        bool
+	cloneBenchmark   []int
 
 	// Recipe-repo-deps command flags
 	recipesStr   string
@@ -54,6 +73,68 @@ var (
 	variables            map[string]string
 	preprocessors        []string
 	postprocessors       []string
+	storageLedgerPath    string
+	catalogPath          string
+	recipeOverridesPath  string
+	recipePolicyPath     string
+	policyBranch         string
+	targetsPath          string
+	webhooksPath         string
+	runnerArch           string
+	runnerOSVersion      string
+	scanPackageOS        bool
+	checkNotarization    bool
+	diffArtifacts        bool
+	hashListPath         string
+	hashListPublicKey    string
+	runPlanPath          string
+	requireNotarization  bool
+	stapleNotarization   bool
+	isolateRun           bool
+	skipPreflight        bool
+	quarantineRun        bool
+	keepSandbox          bool
+	httpProxy            string
+	httpsProxy           string
+	noProxy              string
+	downloadMirrors      []string
+	metricsPath          string
+	logDir               string
+	logRetention         time.Duration
+	logKeepRuns          int
+	noLogCompress        bool
+	noLogArchive         bool
+	eventsPath           string
+	htmlReportPath       string
+	junitReportPath      string
+	otlpEndpoint         string
+	otlpHeaders          map[string]string
+	manifestDir          string
+	manifestSigningKey   string
+	runSBOMFormat        string
+	runSBOMDir           string
+	chaosFailurePercent  float64
+	chaosTimeoutPercent  float64
+	chaosTimeoutDelay    time.Duration
+	chaosSeed            int64
+	chaosSimulate        bool
+	notifyChangesOnly    bool
+	rerunOf              string
+	runID                string
+	confirmProd          bool
+	noTokenFile          bool
+	noTrustCache         bool
+	retries              int
+	retryBackoff         time.Duration
+	filterName           string
+	filterExclude        string
+	filterTypes          []string
+	filterModified       time.Duration
+	filterMax            int
+
+	// Run lock flags, shared by the run and cleanup commands
+	lockWait    bool
+	lockTimeout time.Duration
 
 	// Cleanup command flags
 	removeDownloads   bool
@@ -71,6 +152,9 @@ var (
 	clientID                    string
 	clientSecret                string
 	tenantID                    string
+	ws1Options                  autopkg.WorkspaceOneOptions
+	kandjiURL                   string
+	kandjiToken                 string
 	teamsWebhookUrl             string
 	slackUsername               string
 	slackWebhook                string
@@ -78,6 +162,8 @@ var (
 	overrideDir                 string
 	cacheDir                    string
 	jcds2Mode                   bool
+	markProduction              bool
+	validateConfig              bool
 
 	// Make-override command flags
 	overrideSearchDirs   []string
@@ -94,12 +180,39 @@ func main() {
 	rootCmd := &cobra.Command{
 		Use:   "autopkgctl",
 		Short: "A CLI tool for managing AutoPkg",
-		Long:  "autopkgctl is a command-line interface for managing AutoPkg operations in CI/CD environments",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		Long: `autopkgctl is a command-line interface for managing AutoPkg operations in CI/CD environments
+
+Exit codes: 0 success, 1 unexpected error, 2 configuration error, 3 trust
+verification failure, 4 recipe failure, 5 partial success. With --output json
+or yaml, stdout holds a single result document and logs go to stderr.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Flags not given on the command line fall back to GitHub Action inputs
+			if err := applyActionInputs(cmd); err != nil {
+				return configError(err)
+			}
+
+			// The config file fills in what neither flags nor action inputs set
+			if err := applyConfigFile(cmd); err != nil {
+				return configError(err)
+			}
+
+			if err := applyOutputFormat(cmd); err != nil {
+				return err
+			}
 
 			level := getLogLevel(logLevel)
 			logger.SetLogLevel(level)
 
+			autopkg.SetOffline(offlineMode)
+
+			if sandboxMode {
+				if err := enterSandbox(cmd); err != nil {
+					return err
+				}
+			} else if err := applyProfile(cmd); err != nil {
+				return configError(err)
+			}
+
 			// Debug command arguments
 			if level == logger.LogDebug {
 				logger.Logger("Command-line arguments:", logger.LogDebug)
@@ -107,12 +220,29 @@ func main() {
 					logger.Logger(fmt.Sprintf("Arg[%d]: '%s'", i, arg), logger.LogDebug)
 				}
 			}
+
+			// Notifications and reports follow the configured locale, logs stay in English
+			if locale == "" {
+				locale = i18n.LocaleFromEnv()
+			}
+			if err := i18n.SetLocale(locale); err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ %v, falling back to %s", err, i18n.DefaultLocale), logger.LogWarning)
+			}
+			return nil
 		},
 	}
 
 	// Add global flags
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "Set log level (DEBUG, INFO, WARNING, ERROR, SUCCESS)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to an autopkgctl.yaml config file (defaults to ./autopkgctl.yaml, then $AUTOPKGCTL_CONFIG)")
 	rootCmd.PersistentFlags().StringVar(&prefsPath, "prefs", "", "Path to AutoPkg preferences file")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Named preferences profile to use instead of --prefs (defaults to the profile set with profile switch)")
+	rootCmd.PersistentFlags().StringVar(&stateDir, "state-dir", "", "Directory for run records (defaults to $AUTOPKGCTL_STATE_DIR or ~/Library/AutoPkg/autopkgctl)")
+	rootCmd.PersistentFlags().StringVar(&locale, "locale", "", "Language for notifications and reports, e.g. en or de (defaults to $AUTOPKGCTL_LOCALE)")
+	rootCmd.PersistentFlags().BoolVar(&sandboxMode, "sandbox", false, "Use a bundled fake recipe repo and stub uploaders, without credentials or real infrastructure")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text, or json or yaml for a result document with status and exit code")
+	rootCmd.PersistentFlags().BoolVar(&offlineMode, "offline", false, "Air-gapped mode: no GitHub API calls, repo fetches or downloads, only pre-seeded local caches and $AUTOPKG_INSTALLER_PKG")
+	rootCmd.PersistentFlags().StringVar(&sandboxDir, "sandbox-dir", "", "Directory for the sandbox environment (defaults to autopkgctl-sandbox in the temp directory)")
 
 	setupCmd := &cobra.Command{
 		Use:   "setup",
@@ -124,8 +254,14 @@ func main() {
 
 	setupCmd.Flags().BoolVar(&forceUpdate, "force-update", false, "Force update AutoPkg if already installed")
 	setupCmd.Flags().BoolVar(&useBeta, "use-beta", false, "Use beta version of AutoPkg")
+	setupCmd.Flags().StringVar(&pinVersion, "autopkg-version", "", "AutoPkg release to install and require, e.g. 2.7.3, replacing an installed AutoPkg of another version")
+	setupCmd.Flags().StringVar(&installBackend, "backend", autopkg.InstallBackendPkg, "Install AutoPkg from its release package (pkg) or with Homebrew along with git and python (brew), falling back to pkg without Homebrew")
+	setupCmd.Flags().StringVar(&setupRecipes, "recipe-list", "", "Recipes, or a recipe list file, to warn about when they declare a MinimumVersion above the installed AutoPkg")
 	setupCmd.Flags().BoolVar(&checkGit, "check-git", true, "Check if Git is installed")
+	setupCmd.Flags().BoolVar(&userSpace, "user-space", false, "Install AutoPkg under --prefix without sudo, putting it on PATH and setting GIT_PATH")
+	setupCmd.Flags().StringVar(&installPrefix, "prefix", "", "Directory of a user-space install (defaults to ~/"+autopkg.DefaultUserSpacePrefix+")")
 	setupCmd.Flags().BoolVar(&checkRoot, "check-root", true, "Check if running as root")
+	setupCmd.Flags().StringVar(&processorReposPath, "processor-repos", "", "YAML file declaring shared processor repos to clone, pin and verify")
 
 	configureCmd := &cobra.Command{
 		Use:   "configure",
@@ -152,6 +288,20 @@ func main() {
 	configureCmd.Flags().StringVar(&clientSecret, "client-secret", "", "Client Secret for Microsoft Graph API authentication or Client secret for Jamf Pro API")
 	configureCmd.Flags().StringVar(&tenantID, "tenant-id", "", "Microsoft Entra Tenant ID for Graph API authentication")
 
+	// Workspace ONE UEM
+	configureCmd.Flags().StringVar(&ws1Options.APIURL, "ws1-api-url", "", "Workspace ONE UEM API server URL (e.g., https://as1234.awmdm.com)")
+	configureCmd.Flags().StringVar(&ws1Options.ConsoleURL, "ws1-console-url", "", "Workspace ONE UEM console URL (defaults to the API URL)")
+	configureCmd.Flags().StringVar(&ws1Options.OAuthClientID, "ws1-client-id", "", "OAuth client ID for the Workspace ONE UEM API")
+	configureCmd.Flags().StringVar(&ws1Options.OAuthClientSecret, "ws1-client-secret", "", "OAuth client secret for the Workspace ONE UEM API")
+	configureCmd.Flags().StringVar(&ws1Options.OAuthTokenURL, "ws1-token-url", "", "Regional Workspace ONE OAuth token URL (defaults to "+autopkg.DefaultWS1TokenURL+")")
+	configureCmd.Flags().StringVar(&ws1Options.GroupID, "ws1-group-id", "", "Numeric ID of the Workspace ONE organization group apps are imported into")
+	configureCmd.Flags().StringVar(&ws1Options.SmartGroup, "ws1-smart-group", "", "Smart group new Workspace ONE apps are assigned to by default")
+	configureCmd.Flags().StringVar(&ws1Options.PushMode, "ws1-push-mode", "", "Workspace ONE assignment push mode: Auto or OnDemand (default OnDemand)")
+
+	// Kandji
+	configureCmd.Flags().StringVar(&kandjiURL, "kandji-url", "", "Kandji API URL (e.g., https://example.api.kandji.io)")
+	configureCmd.Flags().StringVar(&kandjiToken, "kandji-token", "", "Kandji API token with library item permissions")
+
 	// Notification services
 	configureCmd.Flags().StringVar(&teamsWebhookUrl, "teams-webhook", "", "Microsoft Teams webhook URL for notifications")
 	configureCmd.Flags().StringVar(&slackUsername, "slack-username", "", "Username to show in Slack notifications")
@@ -160,8 +310,11 @@ func main() {
 	// AutoPkg behavior settings
 	configureCmd.Flags().BoolVar(&failRecipesWithoutTrustInfo, "fail-recipes-without-trust-info", false, "Fail recipes without trust info for improved security")
 	configureCmd.Flags().StringVar(&overrideDir, "override-dir", "", "Directory path for storing recipe overrides")
+	configureCmd.Flags().BoolVar(&markProduction, "production", false, "Flag these preferences as targeting production, requiring --confirm-prod for runs outside CI")
+	configureCmd.Flags().BoolVar(&validateConfig, "validate", false, "Validate the preferences and config file after writing them, failing with what to fix")
 	configureCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Custom directory for AutoPkg cache storage")
 	configureCmd.Flags().StringVar(&gitHubToken, "github-token", "", "GitHub API token for accessing private repositories and higher rate limits")
+	configureCmd.Flags().BoolVar(&noTokenFile, "no-token-file", false, "Never write the GitHub token to disk; pass GITHUB_TOKEN from the environment to autopkg run instead")
 
 	repoAddCmd := &cobra.Command{
 		Use:   "repo-add",
@@ -172,6 +325,11 @@ func main() {
 	}
 
 	repoAddCmd.Flags().StringVar(&reposStr, "repos", "", "Comma-separated list of repositories to add")
+	repoAddCmd.Flags().StringVar(&repoAddListPath, "repo-list", "", "Path to a text file with one repository per line")
+	repoAddCmd.Flags().BoolVar(&nativeClone, "native", false, "Clone repositories in parallel with git, falling back to autopkg repo-add on failure")
+	repoAddCmd.Flags().IntVar(&cloneConcurrency, "concurrency", 0, fmt.Sprintf("Number of parallel clone workers when using --native (defaults to the fastest level recorded by --benchmark, else %d)", autopkg.DefaultCloneConcurrency))
+	repoAddCmd.Flags().BoolVar(&fullClone, "full-clone", false, "Clone full history instead of a shallow --depth 1 clone")
+	repoAddCmd.Flags().IntSliceVar(&cloneBenchmark, "benchmark", nil, "Benchmark native cloning at the given concurrency levels (e.g. 1,4,8,16) without changing preferences")
 
 	recipeDepsCmd := &cobra.Command{
 		Use:   "recipe-repo-deps",
@@ -225,6 +383,7 @@ func main() {
 				return err
 			}
 
+			setResult(map[string]string{"recipe": recipe, "output": output})
 			fmt.Println(output)
 			return nil
 		},
@@ -251,14 +410,60 @@ func main() {
 	runCmd.Flags().StringVar(&recipePath, "recipe", "", "Path to an autopkg recipe to run")
 	runCmd.Flags().StringVar(&recipesPath, "recipes", "", "Path to a comma-separated list of autopkg recipes to run")
 	runCmd.Flags().StringVar(&recipesListPath, "recipe-list", "", "Path to an autopkg recipe list to run. Can be a .txt or json file in array format")
+	runCmd.Flags().StringVar(&runPlanPath, "plan", "", "Path to a plan written by autopkgctl check; only the recipes with updates, or whose check failed, are run")
 	runCmd.Flags().StringVar(&reportPath, "report", "", "Path to save the report")
 	runCmd.Flags().BoolVar(&stopOnFirstError, "stop-on-error", false, "Stop processing if any recipe fails")
 	runCmd.Flags().IntVar(&verboseLevel, "verbose", 2, "autopkg run verbosity level (0-3)")
+	runCmd.Flags().BoolVar(&confirmProd, "confirm-prod", false, "Confirm running against production-flagged preferences outside a CI environment")
+	runCmd.Flags().StringVar(&manifestDir, "manifest-dir", "", "Directory to write a manifest.json and SHA256SUMS of produced artifacts to (requires --report)")
+	runCmd.Flags().StringVar(&manifestSigningKey, "manifest-signing-key", "", "Path to an ed25519 PEM private key used to sign the artifact manifest")
+	runCmd.Flags().StringVar(&runSBOMFormat, "sbom-format", "", "Generate an SBOM for each produced pkg/dmg: cyclonedx or spdx (requires --report)")
+	runCmd.Flags().StringVar(&runSBOMDir, "sbom-dir", "", "Directory to write SBOM files to (defaults to next to each artifact)")
+	runCmd.Flags().StringVar(&catalogPath, "catalog", "", "Path to a recipe catalog YAML file used to apply per-recipe feature flags")
+	runCmd.Flags().StringVar(&targetsPath, "targets", "", "Path to a YAML file of MDM tenants to fan upload recipes (.jamf, .intune, .ws1) out to")
+	runCmd.Flags().StringVar(&recipeOverridesPath, "recipe-overrides", "", "Path to a YAML file mapping recipes to their own prefs path, variables, verbosity and processors")
+	runCmd.Flags().StringVar(&recipePolicyPath, "recipe-policy", "", "Path to a YAML policy of recipe patterns denied from running, optionally per branch; denied recipes are reported as blocked")
+	runCmd.Flags().StringVar(&policyBranch, "branch", "", "Branch matched by recipe policy rules (defaults to $GITHUB_HEAD_REF, $GITHUB_REF_NAME or the checked out branch)")
+	runCmd.Flags().StringVar(&storageLedgerPath, "storage-ledger", "", "Path to a JSON ledger recording the size of artifacts uploaded to Jamf/Intune (requires --report)")
+	runCmd.Flags().StringVar(&eventsPath, "events-file", "", "Path to append the run's events to as JSON lines: recipe.started, recipe.finished, trust.failed, artifact.produced and run.finished")
+	runCmd.Flags().StringVar(&htmlReportPath, "html-report", "", "Path to write a standalone HTML report of the run to: summary, sortable recipe table with logs, and security scans")
+	runCmd.Flags().StringVar(&junitReportPath, "junit-report", "", "Path to write the run to as JUnit XML, a test case per recipe, for CI test reports")
+	runCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint to export OpenTelemetry spans of the batch, its recipes, trust verification and processors to, e.g. http://tempo:4318 (defaults to $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	runCmd.Flags().StringToStringVar(&otlpHeaders, "otlp-header", map[string]string{}, "Headers sent with exported spans, as key=value, on top of $OTEL_EXPORTER_OTLP_HEADERS")
+	runCmd.Flags().StringVar(&metricsPath, "metrics-file", "", "Path to write run metrics to in the Prometheus text format, e.g. for node_exporter's textfile collector: recipe durations, bytes downloaded, cache growth and peak disk use")
+	runCmd.Flags().StringVar(&logDir, "log-dir", "", "Directory to archive each recipe's full autopkg output to, a directory per run (defaults to logs in the state directory)")
+	runCmd.Flags().DurationVar(&logRetention, "log-retention", autopkg.DefaultLogRetention, "Remove archived logs of runs older than this when a run starts, 0 keeps them")
+	runCmd.Flags().IntVar(&logKeepRuns, "log-keep-runs", 0, "Keep the archived logs of at most this many runs, 0 keeps every run within --log-retention")
+	runCmd.Flags().BoolVar(&noLogCompress, "no-log-compress", false, "Don't gzip archived recipe logs once the recipe finished")
+	runCmd.Flags().BoolVar(&noLogArchive, "no-log-archive", false, "Don't archive recipe output to log files")
+
+	runCmd.Flags().BoolVar(&noTokenFile, "no-token-file", false, "Pass GITHUB_TOKEN from the environment to autopkg via --key and the process environment, without a token file")
+	runCmd.Flags().BoolVar(&quarantineRun, "quarantine", false, "Build upload recipes with their package parent and hold what they build for approval with autopkgctl release instead of uploading it (requires --report)")
+	runCmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Don't sign in to Jamf Pro and Intune before the batch to check the credentials and permissions its upload recipes need")
+	runCmd.Flags().IntVar(&retries, "retries", 0, "Retry recipes that fail transiently (network timeouts, server errors, rate limits) up to this many times")
+	runCmd.Flags().DurationVar(&retryBackoff, "retry-backoff", 30*time.Second, "Delay before the first retry, doubled for each retry after it up to 5m")
+	runCmd.Flags().StringVar(&runID, "run-id", "", "Identifier for the batch run, generated when empty, e.g. by autopkgctl serve to track the runs it starts")
+	runCmd.Flags().StringVar(&rerunOf, "rerun", "", "Run ID of a partially failed batch to re-run, skipping recipes whose uploads already have receipts (requires --report on the original run)")
+
+	// Chaos testing options
+	runCmd.Flags().Float64Var(&chaosFailurePercent, "chaos-failure-percent", 0, "Percentage of recipes forced to fail without running, to test alerting and reporting")
+	runCmd.Flags().Float64Var(&chaosTimeoutPercent, "chaos-timeout-percent", 0, "Percentage of recipes forced to time out without running")
+	runCmd.Flags().DurationVar(&chaosTimeoutDelay, "chaos-timeout-delay", 5*time.Second, "How long a synthetic timeout blocks before failing")
+	runCmd.Flags().Int64Var(&chaosSeed, "chaos-seed", 0, "Seed for reproducible chaos fault selection (0 = random)")
+	runCmd.Flags().BoolVar(&chaosSimulate, "chaos-simulate", false, "In chaos mode, report recipes without a fault as unchanged instead of running them")
+
+	// Recipe selection options
+	runCmd.Flags().StringVar(&filterName, "filter-name", "", "Only run recipes whose name matches this regular expression")
+	runCmd.Flags().StringVar(&filterExclude, "exclude", "", "Skip recipes whose name matches this regular expression")
+	runCmd.Flags().StringSliceVar(&filterTypes, "type", []string{}, "Only run recipes of these types (download, pkg, install, munki, jamf, intune, ws1, kandji)")
+	runCmd.Flags().DurationVar(&filterModified, "modified-within", 0, "Only run recipes modified within this duration, e.g. 168h")
+	runCmd.Flags().IntVar(&filterMax, "max", 0, "Maximum number of selected recipes to run (0 = all)")
 
 	// Trust verification options
 	runCmd.Flags().BoolVar(&verifyTrust, "verify-trust", true, "Verify trust info before running recipes")
 	runCmd.Flags().BoolVar(&updateTrustOnFailure, "update-trust", true, "Update trust info if verification fails")
 	runCmd.Flags().BoolVar(&ignoreVerifyFailures, "ignore-verify-failures", false, "Run recipes even if trust verification fails")
+	runCmd.Flags().BoolVar(&noTrustCache, "no-trust-cache", false, "Verify trust for every recipe, even when its override and parent recipes are unchanged since they last verified")
 
 	// Search and override directories
 	runCmd.Flags().StringSliceVar(&searchDirs, "search-dir", []string{}, "Additional recipe search directories")
@@ -269,10 +474,32 @@ func main() {
 
 	// Notification options - Slack
 	runCmd.Flags().StringVar(&slackWebhook, "notify-slack", "", "Slack webhook for notifications")
+	runCmd.Flags().StringVar(&webhooksPath, "webhooks", "", "Path to a YAML file of webhook subscriptions receiving signed recipe.updated, recipe.failed and run.completed events")
+	runCmd.Flags().StringVar(&runnerArch, "runner-arch", "", "Runner architecture for catalog arch requirements, arm64 or x86_64 (detected when empty)")
+	runCmd.Flags().StringVar(&runnerOSVersion, "runner-os", "", "Runner macOS version for minimum OS requirements (detected when empty)")
+	runCmd.Flags().BoolVar(&scanPackageOS, "scan-package-os", false, "Record the minimum macOS of built packages with Suspicious Package to skip them on older runners")
+	runCmd.Flags().BoolVar(&checkNotarization, "check-notarization", false, "Record whether the pkgs, dmgs and apps produced are notarized, with stapler and spctl")
+	runCmd.Flags().BoolVar(&diffArtifacts, "diff-artifacts", false, "Diff updated packages against the previous version's components, files, entitlements, launch items and scripts")
+	runCmd.Flags().StringVar(&hashListPath, "hash-list", "", "Path to a JSON hash list: denylisted artifacts fail their recipe, allowlisted ones skip notarization checks and diffs")
+	runCmd.Flags().StringVar(&hashListPublicKey, "hash-list-public-key", "", "Path to an ed25519 PEM public key the hash list must be signed with")
+	runCmd.Flags().BoolVar(&requireNotarization, "require-notarization", false, "Stop MDM upload recipes whose package isn't notarized before they upload (implies --check-notarization)")
+	runCmd.Flags().BoolVar(&stapleNotarization, "staple-notarization", false, "Staple notarization tickets to notarized artifacts that don't have one")
+	runCmd.Flags().BoolVar(&notifyChangesOnly, "notify-changes-only", false, "Only notify about failures, plus one summary of new versions since the previous successful run")
 	runCmd.Flags().StringVar(&slackUsername, "slack-username", "AutoPkg Bot", "Username to display in Slack notifications")
 	runCmd.Flags().StringVar(&slackChannel, "slack-channel", "", "Slack channel for notifications")
 	runCmd.Flags().StringVar(&slackIcon, "slack-icon", ":package:", "Emoji icon for Slack notifications")
 
+	// Isolation options
+	runCmd.Flags().BoolVar(&isolateRun, "isolate", false, "Run the batch with its own HOME, a copy of the preferences, its own cache and a snapshot of the overrides, so parallel pipelines on one runner can't interfere; trust updated during the run stays in the snapshot")
+	runCmd.Flags().BoolVar(&keepSandbox, "keep-sandbox", false, "Keep the isolated environment of an --isolate run instead of removing it")
+
+	// Download proxy options
+	addDownloadProxyFlags(runCmd)
+
+	// Run lock options
+	runCmd.Flags().BoolVar(&lockWait, "wait", false, "Wait for another run or cleanup on the same preferences to finish instead of failing")
+	runCmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 0, "Wait up to this long for another run or cleanup on the same preferences to finish")
+
 	// Cleanup command
 	cleanupCmd := &cobra.Command{
 		Use:   "cleanup",
@@ -285,6 +512,8 @@ func main() {
 	cleanupCmd.Flags().BoolVar(&removeDownloads, "remove-downloads", true, "Remove downloads cache")
 	cleanupCmd.Flags().BoolVar(&removeRecipeCache, "remove-recipe-cache", true, "Remove recipe cache")
 	cleanupCmd.Flags().IntVar(&keepDays, "keep-days", 0, "Keep files newer than this many days")
+	cleanupCmd.Flags().BoolVar(&lockWait, "wait", false, "Wait for another run or cleanup on the same preferences to finish instead of failing")
+	cleanupCmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 0, "Wait up to this long for another run or cleanup on the same preferences to finish")
 
 	// Add commands to root
 	rootCmd.AddCommand(setupCmd)
@@ -295,11 +524,57 @@ func main() {
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(cleanupCmd)
 	rootCmd.AddCommand(makeOverrideCmd)
-
-	if err := rootCmd.Execute(); err != nil {
+	rootCmd.AddCommand(newDigestCmd())
+	rootCmd.AddCommand(newAnnotateCmd())
+	rootCmd.AddCommand(newRunsCmd())
+	rootCmd.AddCommand(newHistoryCmd())
+	rootCmd.AddCommand(newFlakyCmd())
+	rootCmd.AddCommand(newStaleCmd())
+	rootCmd.AddCommand(newOracleCmd())
+	rootCmd.AddCommand(newScanCmd())
+	rootCmd.AddCommand(newHashListCmd())
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newQueueCmd())
+	rootCmd.AddCommand(newScheduleCmd())
+	rootCmd.AddCommand(newLogsCmd())
+	rootCmd.AddCommand(newRepoFreezeCmd())
+	rootCmd.AddCommand(newRepoRestoreCmd())
+	rootCmd.AddCommand(newRepoCacheCmd())
+	rootCmd.AddCommand(newRecipeMapCmd())
+	rootCmd.AddCommand(newSBOMCmd())
+	rootCmd.AddCommand(newListRecipesCmd())
+	rootCmd.AddCommand(newProcessorsCmd())
+	rootCmd.AddCommand(newLatestCmd())
+	rootCmd.AddCommand(newMakeOverridesCmd())
+	rootCmd.AddCommand(newSearchCmd())
+	rootCmd.AddCommand(newTUICmd())
+	rootCmd.AddCommand(newProfileCmd())
+	rootCmd.AddCommand(newPrefsCmd())
+	rootCmd.AddCommand(newDoctorCmd())
+	rootCmd.AddCommand(newWorkflowCmd())
+	rootCmd.AddCommand(newCheckCmd())
+	rootCmd.AddCommand(newReleaseCmd())
+	rootCmd.AddCommand(newRollbackCmd())
+	rootCmd.AddCommand(newRecipeInfoCmd())
+	rootCmd.AddCommand(newNewRecipeCmd())
+	rootCmd.AddCommand(newAuditCmd())
+	rootCmd.AddCommand(newProcessorInfoCmd())
+	rootCmd.AddCommand(newTrustBootstrapCmd())
+
+	// Flag errors are usage mistakes, so they exit as configuration errors
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return configError(err)
+	})
+
+	cmd, err := rootCmd.ExecuteC()
+	if structuredOutput() {
+		if writeErr := writeCommandResult(cmd, err); writeErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", writeErr)
+		}
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-		os.Exit(1)
 	}
+	os.Exit(exitCodeFor(err))
 }
 
 func runSetup() error {
@@ -322,6 +597,11 @@ func runSetup() error {
 	config := &autopkg.InstallConfig{
 		ForceUpdate: forceUpdate,
 		UseBeta:     useBeta,
+		Version:     pinVersion,
+		Backend:     installBackend,
+		UserSpace:   userSpace,
+		Prefix:      installPrefix,
+		PrefsPath:   prefsPath,
 	}
 
 	version, err := autopkg.InstallAutoPkg(config)
@@ -330,6 +610,54 @@ func runSetup() error {
 		return err
 	}
 	fmt.Printf("✅ AutoPkg %s installed successfully\n", version)
+	outputs := map[string]string{"autopkg-version": version}
+
+	result := &setupResult{AutoPkgVersion: version}
+	if userSpace {
+		prefix, err := autopkg.UserSpacePrefix(installPrefix)
+		if err != nil {
+			return err
+		}
+		binDir := autopkg.UserSpaceBinDir(prefix)
+		result.AutoPkgBinDir = binDir
+		outputs["autopkg-bin-dir"] = binDir
+		addActionPath(binDir)
+	}
+	setActionOutputs(outputs)
+
+	if setupRecipes != "" {
+		recipes, err := autopkg.ParseRecipeInput(setupRecipes).Parse()
+		if err != nil {
+			return configError(fmt.Errorf("failed to read recipes: %w", err))
+		}
+		requirements, err := autopkg.CheckAutoPkgCompatibility(recipes, version, &autopkg.ListRecipeOptions{PrefsPath: prefsPath})
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to check recipe compatibility: %v", err), logger.LogWarning)
+		}
+		result.NeedNewerAutoPkg = requirements
+		if len(requirements) == 0 && err == nil {
+			fmt.Printf("✅ %d recipes are compatible with AutoPkg %s\n", len(recipes), version)
+		}
+	}
+	setResult(result)
+
+	if processorReposPath != "" {
+		repos, err := autopkg.LoadProcessorRepos(processorReposPath)
+		if err != nil {
+			return configError(err)
+		}
+		repoResults, err := autopkg.EnsureProcessorRepos(repos, &autopkg.ProcessorReposOptions{PrefsPath: prefsPath})
+		for _, repoResult := range repoResults {
+			if repoResult.Error == nil && len(repoResult.Missing) == 0 {
+				result.ProcessorRepos = append(result.ProcessorRepos, repoResult.Path)
+			}
+		}
+		if err != nil {
+			fmt.Printf("❌ Shared processor setup failed: %v\n", err)
+			return configError(err)
+		}
+		fmt.Printf("✅ %d shared processor repos ready\n", len(repos))
+	}
 
 	return nil
 }
@@ -360,17 +688,14 @@ func runConfigure(cmd *cobra.Command) error {
 	updates := make(map[string]interface{})
 
 	// GitHub token
-	if gitHubToken != "" {
-		// Save token to the autopkg token file
-		homeDir, err := os.UserHomeDir()
-		if err == nil {
-			tokenPath := filepath.Join(homeDir, ".autopkg_gh_token")
-			if err := os.WriteFile(tokenPath, []byte(gitHubToken), 0600); err == nil {
-				logger.Logger(fmt.Sprintf("✅ Wrote GitHub token to %s", tokenPath), logger.LogSuccess)
-				updates["GITHUB_TOKEN_PATH"] = tokenPath
-			} else {
-				logger.Logger(fmt.Sprintf("❌ Failed to write GitHub token file: %v", err), logger.LogError)
-			}
+	if gitHubToken != "" && noTokenFile {
+		logger.Logger("ℹ️ Not writing GitHub token to disk, set GITHUB_TOKEN and use run --no-token-file", logger.LogInfo)
+	} else if gitHubToken != "" {
+		if tokenPath, err := autopkg.WriteGitHubTokenFile(gitHubToken); err == nil {
+			logger.Logger(fmt.Sprintf("✅ Wrote GitHub token to %s", tokenPath), logger.LogSuccess)
+			updates["GITHUB_TOKEN_PATH"] = tokenPath
+		} else {
+			logger.Logger(fmt.Sprintf("❌ %v", err), logger.LogError)
 		}
 	}
 
@@ -408,6 +733,14 @@ func runConfigure(cmd *cobra.Command) error {
 		updates["TENANT_ID"] = tenantID
 	}
 
+	// Kandji
+	if kandjiURL != "" {
+		updates[autopkg.KandjiAPIURLKey] = kandjiURL
+	}
+	if kandjiToken != "" {
+		updates[autopkg.KandjiTokenKey] = kandjiToken
+	}
+
 	// Notification services
 	if teamsWebhookUrl != "" {
 		updates["TEAMS_WEBHOOK"] = teamsWebhookUrl
@@ -423,23 +756,19 @@ func runConfigure(cmd *cobra.Command) error {
 	if cmd.Flags().Changed("fail-recipes-without-trust-info") {
 		updates["FAIL_RECIPES_WITHOUT_TRUST_INFO"] = failRecipesWithoutTrustInfo
 	}
-	if overrideDir != "" {
-		updates["RECIPE_OVERRIDE_DIRS"] = overrideDir
-	}
 	if cacheDir != "" {
 		updates["CACHE_DIR"] = cacheDir
 	}
+	if cmd.Flags().Changed("production") {
+		updates[autopkg.ProductionPrefsKey] = markProduction
+	}
 
 	// Check environment variables if flags weren't provided
 	// GitHub token from environment
-	if gitHubToken == "" && os.Getenv("GITHUB_TOKEN") != "" {
-		homeDir, err := os.UserHomeDir()
-		if err == nil {
-			tokenPath := filepath.Join(homeDir, ".autopkg_gh_token")
-			if err := os.WriteFile(tokenPath, []byte(os.Getenv("GITHUB_TOKEN")), 0600); err == nil {
-				logger.Logger(fmt.Sprintf("✅ Wrote GitHub token from environment to %s", tokenPath), logger.LogSuccess)
-				updates["GITHUB_TOKEN_PATH"] = tokenPath
-			}
+	if gitHubToken == "" && !noTokenFile && autopkg.GitHubTokenFromEnv() != "" {
+		if tokenPath, err := autopkg.WriteGitHubTokenFile(autopkg.GitHubTokenFromEnv()); err == nil {
+			logger.Logger(fmt.Sprintf("✅ Wrote GitHub token from environment to %s", tokenPath), logger.LogSuccess)
+			updates["GITHUB_TOKEN_PATH"] = tokenPath
 		}
 	}
 
@@ -474,6 +803,33 @@ func runConfigure(cmd *cobra.Command) error {
 		updates["TENANT_ID"] = os.Getenv("TENANT_ID")
 	}
 
+	// Kandji environment variables
+	if kandjiURL == "" && os.Getenv(autopkg.KandjiAPIURLKey) != "" {
+		updates[autopkg.KandjiAPIURLKey] = os.Getenv(autopkg.KandjiAPIURLKey)
+	}
+	if kandjiToken == "" && os.Getenv(autopkg.KandjiTokenKey) != "" {
+		updates[autopkg.KandjiTokenKey] = os.Getenv(autopkg.KandjiTokenKey)
+	}
+
+	// Workspace ONE environment variables
+	for _, setting := range []struct {
+		value *string
+		env   string
+	}{
+		{&ws1Options.APIURL, autopkg.WS1APIURLKey},
+		{&ws1Options.ConsoleURL, autopkg.WS1ConsoleURLKey},
+		{&ws1Options.OAuthClientID, autopkg.WS1OAuthClientIDKey},
+		{&ws1Options.OAuthClientSecret, autopkg.WS1OAuthClientSecretKey},
+		{&ws1Options.OAuthTokenURL, autopkg.WS1OAuthTokenURLKey},
+		{&ws1Options.GroupID, autopkg.WS1GroupIDKey},
+		{&ws1Options.SmartGroup, autopkg.WS1SmartGroupKey},
+		{&ws1Options.PushMode, autopkg.WS1PushModeKey},
+	} {
+		if *setting.value == "" {
+			*setting.value = os.Getenv(setting.env)
+		}
+	}
+
 	// Notification services environment variables
 	if teamsWebhookUrl == "" && os.Getenv("TEAMS_WEBHOOK") != "" {
 		updates["TEAMS_WEBHOOK"] = os.Getenv("TEAMS_WEBHOOK")
@@ -486,9 +842,6 @@ func runConfigure(cmd *cobra.Command) error {
 	}
 
 	// AutoPkg behavior environment variables
-	if overrideDir == "" && os.Getenv("RECIPE_OVERRIDE_DIRS") != "" {
-		updates["RECIPE_OVERRIDE_DIRS"] = os.Getenv("RECIPE_OVERRIDE_DIRS")
-	}
 	if cacheDir == "" && os.Getenv("CACHE_DIR") != "" {
 		updates["CACHE_DIR"] = os.Getenv("CACHE_DIR")
 	}
@@ -503,6 +856,41 @@ func runConfigure(cmd *cobra.Command) error {
 		logger.Logger("ℹ️ No changes to preferences", logger.LogInfo)
 	}
 
+	// RECIPE_OVERRIDE_DIRS is a list, so the override directory is added to it rather than replacing it
+	newOverrideDir := overrideDir
+	if envOverrideDir := os.Getenv("RECIPE_OVERRIDE_DIRS"); envOverrideDir != "" {
+		newOverrideDir = envOverrideDir
+	}
+	if newOverrideDir != "" {
+		if strings.HasPrefix(newOverrideDir, "~/") {
+			if homeDir, err := os.UserHomeDir(); err == nil {
+				newOverrideDir = filepath.Join(homeDir, newOverrideDir[2:])
+			}
+		}
+		if err := os.MkdirAll(newOverrideDir, 0755); err != nil {
+			return fmt.Errorf("failed to create override directory: %w", err)
+		}
+		if err := autopkg.AddOverrideDir(expandedPrefsPath, newOverrideDir); err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to add override directory: %v", err), logger.LogError)
+			return err
+		}
+	}
+
+	// Workspace ONE settings only make sense together, so they are validated as a set
+	if ws1Options != (autopkg.WorkspaceOneOptions{}) {
+		if err := autopkg.ConfigureWorkspaceOne(expandedPrefsPath, &ws1Options); err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to configure Workspace ONE: %v", err), logger.LogError)
+			return configError(err)
+		}
+	}
+
+	if validateConfig {
+		if err := validateConfiguration(expandedPrefsPath); err != nil {
+			logger.Logger(fmt.Sprintf("❌ %v", err), logger.LogError)
+			return configError(err)
+		}
+	}
+
 	// Verify the configuration by running autopkg repo-list
 	cmdExec := exec.Command("autopkg", "repo-list")
 	if prefsPath != "" {
@@ -517,6 +905,35 @@ func runConfigure(cmd *cobra.Command) error {
 		logger.Logger(fmt.Sprintf("Repository list:\n%s", string(output)), logger.LogInfo)
 	}
 
+	// Every MDM the preferences configure is validated, so uploads don't fail mid-run
+	result := &configureResult{PrefsPath: expandedPrefsPath}
+	setActionOutputs(map[string]string{"prefs-path": expandedPrefsPath})
+	setResult(result)
+
+	statuses, err := autopkg.ValidateIntegrations(expandedPrefsPath)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to validate MDM integrations: %v", err), logger.LogWarning)
+		return nil
+	}
+	var invalid []string
+	for _, status := range statuses {
+		if !status.Enabled {
+			continue
+		}
+		result.Integrations = append(result.Integrations, status)
+		if len(status.Problems) == 0 {
+			logger.Logger(fmt.Sprintf("✅ %s configured for %s", status.DisplayName, status.Tenant), logger.LogSuccess)
+			continue
+		}
+		for _, problem := range status.Problems {
+			logger.Logger(fmt.Sprintf("❌ %s: %s", status.DisplayName, problem), logger.LogError)
+		}
+		invalid = append(invalid, status.DisplayName)
+	}
+	if len(invalid) > 0 {
+		return configError(fmt.Errorf("invalid MDM configuration for %s", strings.Join(invalid, ", ")))
+	}
+
 	return nil
 }
 
@@ -531,11 +948,84 @@ func runRepoAdd() error {
 		}
 	}
 
+	if repoAddListPath != "" {
+		data, err := os.ReadFile(repoAddListPath)
+		if err != nil {
+			return configError(fmt.Errorf("failed to read repo list: %w", err))
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				repos = append(repos, line)
+			}
+		}
+	}
+
 	if len(repos) == 0 {
-		return fmt.Errorf("no repositories specified")
+		return configError(fmt.Errorf("no repositories specified"))
+	}
+
+	if len(cloneBenchmark) > 0 {
+		benchmarks, err := autopkg.BenchmarkRepoClone(repos, cloneBenchmark)
+		if err != nil {
+			fmt.Printf("❌ Benchmark failed: %v\n", err)
+			return err
+		}
+		setResult(benchmarks)
+		if err := autopkg.SaveCloneBenchmark(stateDir, len(repos), benchmarks); err != nil {
+			return err
+		}
+		fmt.Printf("Clone benchmark for %d repositories:\n", len(repos))
+		for _, benchmark := range benchmarks {
+			fmt.Printf("  concurrency %-3d %10s  (%d failed)\n", benchmark.Concurrency, benchmark.Duration.Round(time.Millisecond), benchmark.Failed)
+		}
+		if level, ok := autopkg.BenchmarkedCloneConcurrency(stateDir); ok {
+			fmt.Printf("✅ repo-add --native now clones with %d workers by default\n", level)
+		} else {
+			fmt.Println("⚠️ Every level had failed clones, the default concurrency is unchanged")
+		}
+		return nil
+	}
+
+	if nativeClone {
+		cloneResults, err := autopkg.CloneRepos(repos, &autopkg.CloneReposOptions{
+			PrefsPath:         prefsPath,
+			Concurrency:       cloneConcurrency,
+			StateDir:          stateDir,
+			FullClone:         fullClone,
+			FallbackToRepoAdd: true,
+		})
+		repoResults := make([]repoResult, 0, len(cloneResults))
+		for _, clone := range cloneResults {
+			repoResults = append(repoResults, repoResult{
+				Repo:     clone.Repo,
+				Path:     clone.Path,
+				Existing: clone.Existing,
+				Fallback: clone.Fallback,
+				Error:    errorString(clone.Error),
+			})
+		}
+		setResult(repoResults)
+		if err != nil {
+			fmt.Printf("❌ Failed to add repositories: %v\n", err)
+			return err
+		}
+		fmt.Println("✅ Repositories added successfully")
+		return nil
 	}
 
 	output, err := autopkg.AddRepo(repos, prefsPath)
+	var addErr *autopkg.AddRepoError
+	errors.As(err, &addErr)
+	repoResults := make([]repoResult, 0, len(repos))
+	for _, repo := range repos {
+		repoErr := err
+		if addErr != nil {
+			repoErr = addErr.RepoError(repo)
+		}
+		repoResults = append(repoResults, repoResult{Repo: repo, Error: errorString(repoErr)})
+	}
+	setResult(repoResults)
 	if err != nil {
 		fmt.Printf("❌ Failed to add repositories: %v\n", err)
 		fmt.Println(output)
@@ -563,23 +1053,30 @@ func runRecipeDeps() error {
 	logger.Logger(fmt.Sprintf("📋 Parsed Recipes: %v", recipes), logger.LogDebug)
 
 	if len(recipes) == 0 {
-		return fmt.Errorf("no recipes specified")
+		return configError(fmt.Errorf("no recipes specified"))
 	}
 
+	var results []recipeDepsResult
 	for _, recipe := range recipes {
 		logger.Logger(fmt.Sprintf("🔄 Resolving dependencies for: %s", recipe), logger.LogInfo)
+		result := recipeDepsResult{Recipe: recipe, Repositories: []string{}}
 
 		dependencies, err := autopkg.ResolveRecipeDependencies(recipe, useToken, prefsPath, dryRun, repoListPath)
 		if err != nil {
 			logger.Logger(fmt.Sprintf("❌ Failed to resolve dependencies for %s: %v", recipe, err), logger.LogError)
+			result.Error = err.Error()
+			results = append(results, result)
 			continue
 		}
 
 		logger.Logger(fmt.Sprintf("✅ Found %d dependencies for %s", len(dependencies), recipe), logger.LogSuccess)
 		for _, dep := range dependencies {
 			fmt.Printf("- %s: %s\n", dep.RecipeIdentifier, dep.RepoURL)
+			result.Repositories = append(result.Repositories, dep.RepoURL)
 		}
+		results = append(results, result)
 	}
+	setResult(results)
 
 	return nil
 }
@@ -596,7 +1093,7 @@ func runVerifyTrust() error {
 	}
 
 	if len(recipes) == 0 {
-		return fmt.Errorf("no recipes specified")
+		return configError(fmt.Errorf("no recipes specified"))
 	}
 
 	verifyOptions := &autopkg.VerifyTrustInfoOptions{
@@ -607,6 +1104,9 @@ func runVerifyTrust() error {
 	success, failedRecipes, output, err := autopkg.VerifyTrustInfoForRecipes(recipes, verifyOptions)
 	fmt.Println(output)
 
+	result := &verifyTrustResult{Recipes: recipes, FailedRecipes: failedRecipes}
+	setResult(result)
+
 	if err != nil || !success {
 		fmt.Printf("⚠️ Trust verification failed for %d recipes\n", len(failedRecipes))
 
@@ -622,13 +1122,14 @@ func runVerifyTrust() error {
 
 			if updateErr != nil {
 				fmt.Printf("❌ Failed to update trust info: %v\n", updateErr)
-				return updateErr
+				return withExitCode(exitTrustFailure, updateErr)
 			}
 
+			result.TrustUpdated = true
 			fmt.Println("✅ Trust info updated successfully")
 		} else {
 			fmt.Println("❌ Trust verification failed and update not requested")
-			return fmt.Errorf("trust verification failed")
+			return withExitCode(exitTrustFailure, fmt.Errorf("trust verification failed"))
 		}
 	} else {
 		fmt.Println("✅ Trust verification passed for all recipes")
@@ -639,9 +1140,120 @@ func runVerifyTrust() error {
 
 // runRecipes executes recipes based on CLI flags, delegating execution to RunRecipeBatch
 func runRecipes() error {
-	if recipePath == "" && recipesPath == "" && recipesListPath == "" && os.Getenv("RUN_RECIPE") == "" {
-		logger.Logger("❌ No recipes specified via --recipe, --recipes, --recipe-list flags, or RUN_RECIPE environment variable", logger.LogError)
-		return fmt.Errorf("no recipes specified")
+	var recipeInput string
+	if runPlanPath != "" {
+		if recipePath != "" || recipesPath != "" || recipesListPath != "" {
+			return configError(fmt.Errorf("--plan can't be combined with --recipe, --recipes or --recipe-list"))
+		}
+		plan, err := autopkg.LoadCheckPlan(runPlanPath)
+		if err != nil {
+			return configError(err)
+		}
+		if recipeInput = plan.RecipeInput(); recipeInput == "" {
+			logger.Logger(fmt.Sprintf("ℹ️ Check run %s found no updates, nothing to run", plan.RunID), logger.LogInfo)
+			return nil
+		}
+		logger.Logger(fmt.Sprintf("🗺️ Running %d recipes with updates from check run %s", len(plan.Recipes()), plan.RunID), logger.LogInfo)
+	} else {
+		var err error
+		if recipeInput, err = resolveRecipeInput(); err != nil || recipeInput == "" {
+			return err
+		}
+	}
+
+	if err := autopkg.ConfirmProductionRun(prefsPath, confirmProd, os.Stdin, os.Stdout); err != nil {
+		logger.Logger(fmt.Sprintf("🛑 %v", err), logger.LogError)
+		return configError(err)
+	}
+
+	options, err := newRecipeBatchOptions()
+	if err != nil {
+		return configError(err)
+	}
+
+	// Isolated batches have a cache of their own, so they don't need the lock
+	if !isolateRun {
+		lock, err := acquireRunLock(prefsPath, "run")
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	results, err := autopkg.RunRecipeBatch(recipeInput, options)
+	options.Tracer.Shutdown()
+	var preflightErr *autopkg.PreflightError
+	if errors.As(err, &preflightErr) {
+		logger.Logger(fmt.Sprintf("🔑 %v", err), logger.LogError)
+		return configError(err)
+	}
+	if err != nil {
+		logger.Logger(fmt.Sprintf("❌ Error during recipe execution: %v", err), logger.LogError)
+	}
+
+	successCount, failCount, updatedCount := 0, 0, 0
+	for recipe, result := range results {
+		if result.ExecutionError != nil {
+			failCount++
+			logger.Logger(fmt.Sprintf("❌ Recipe failed: %s | Error: %v", recipe, result.ExecutionError), logger.LogError)
+			if result.LogPath != "" {
+				logger.Logger(fmt.Sprintf("🗄️ Full output of %s: %s", recipe, result.LogPath), logger.LogInfo)
+			}
+		} else if result.Status == autopkg.StatusBlocked {
+			logger.Logger(fmt.Sprintf("🛡️ Recipe blocked: %s | %s", recipe, result.Output), logger.LogWarning)
+		} else {
+			successCount++
+			logger.Logger(fmt.Sprintf("✅ Recipe succeeded: %s", recipe), logger.LogSuccess)
+		}
+		if result.Status == "updated" {
+			updatedCount++
+		}
+	}
+
+	summary := newRunResult(options.RunID, reportPath, results)
+	setResult(summary)
+
+	code := summary.exitCode()
+	if code == exitSuccess && err != nil {
+		code = exitRecipeFailure
+	}
+
+	status := "success"
+	if failCount > 0 || err != nil {
+		status = "failure"
+	}
+	setActionOutputs(map[string]string{
+		"run-id":    options.RunID,
+		"status":    status,
+		"succeeded": strconv.Itoa(successCount),
+		"failed":    strconv.Itoa(failCount),
+		"updated":   strconv.Itoa(updatedCount),
+		"report":    reportPath,
+		"exit-code": strconv.Itoa(code),
+	})
+
+	switch code {
+	case exitSuccess:
+		return nil
+	case exitTrustFailure:
+		return withExitCode(code, fmt.Errorf("trust verification failed for %d recipes", summary.TrustFailed))
+	case exitPartialSuccess:
+		return withExitCode(code, fmt.Errorf("recipe execution partially failed: %d recipes failed, %d failed trust verification", summary.Failed, summary.TrustFailed))
+	default:
+		if failCount == 0 && err != nil {
+			return withExitCode(code, err)
+		}
+		return withExitCode(code, fmt.Errorf("recipe execution failed: %d recipes failed", failCount))
+	}
+}
+
+// resolveRecipeInput returns the recipes selected by --recipe, --recipes,
+// --recipe-list, RUN_RECIPE and the filter flags, or "" when the filters match none
+func resolveRecipeInput() (string, error) {
+	filtering := filterName != "" || filterExclude != "" || len(filterTypes) > 0 || filterModified > 0 || filterMax > 0
+	if !filtering && recipePath == "" && recipesPath == "" && recipesListPath == "" && os.Getenv("RUN_RECIPE") == "" {
+		logger.Logger("❌ No recipes specified via --recipe, --recipes, --recipe-list, filter flags, or RUN_RECIPE environment variable", logger.LogError)
+		return "", configError(fmt.Errorf("no recipes specified"))
 	}
 
 	var recipeInput string
@@ -655,6 +1267,24 @@ func runRecipes() error {
 		recipeInput = os.Getenv("RUN_RECIPE")
 	}
 
+	if filtering {
+		selected, err := selectRecipes(recipeInput)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to select recipes: %v", err), logger.LogError)
+			return "", err
+		}
+		if len(selected) == 0 {
+			logger.Logger("ℹ️ No recipes match the filter, nothing to run", logger.LogInfo)
+			return "", nil
+		}
+		recipeInput = strings.Join(selected, ",")
+	}
+	return recipeInput, nil
+}
+
+// newRecipeBatchOptions builds batch run options from the run flags, loading
+// the catalog, webhooks and per-recipe overrides they point to
+func newRecipeBatchOptions() (*autopkg.RecipeBatchRunOptions, error) {
 	options := &autopkg.RecipeBatchRunOptions{
 		PrefsPath:            prefsPath,
 		SearchDirs:           searchDirs,
@@ -668,6 +1298,29 @@ func runRecipes() error {
 		PreProcessors:        preprocessors,
 		PostProcessors:       postprocessors,
 		StopOnFirstError:     stopOnFirstError,
+		StorageLedgerPath:    storageLedgerPath,
+		StateDir:             stateDir,
+		ManifestDir:          manifestDir,
+		ManifestSigningKey:   manifestSigningKey,
+		SBOMFormat:           runSBOMFormat,
+		SBOMDir:              runSBOMDir,
+		RerunOf:              rerunOf,
+		RunID:                runID,
+		NoTokenFile:          noTokenFile,
+		NoTrustCache:         noTrustCache,
+		RunnerArch:           autopkg.NormalizeArch(runnerArch),
+		RunnerOSVersion:      runnerOSVersion,
+		ScanPackageOS:        scanPackageOS,
+		CheckNotarization:    checkNotarization,
+		DiffArtifacts:        diffArtifacts,
+		RequireNotarization:  requireNotarization,
+		StapleNotarization:   stapleNotarization,
+		Isolate:              isolateRun,
+		KeepSandbox:          keepSandbox,
+		MetricsPath:          metricsPath,
+		SkipPreflight:        skipPreflight,
+		Quarantine:           quarantineRun,
+		Branch:               policyBranch,
 		Notification: autopkg.NotificationOptions{
 			EnableTeams:   teamsWebhook != "",
 			TeamsWebhook:  teamsWebhook,
@@ -676,33 +1329,175 @@ func runRecipes() error {
 			SlackUsername: slackUsername,
 			SlackChannel:  slackChannel,
 			SlackIcon:     slackIcon,
+			ChangesOnly:   notifyChangesOnly,
 		},
 	}
 
-	results, err := autopkg.RunRecipeBatch(recipeInput, options)
+	if !noLogArchive {
+		if logKeepRuns < 0 {
+			return nil, fmt.Errorf("--log-keep-runs can't be negative")
+		}
+		options.LogArchive = &autopkg.LogArchiveOptions{
+			Dir:       logDir,
+			Compress:  !noLogCompress,
+			Retention: logRetention,
+			KeepRuns:  logKeepRuns,
+		}
+	}
+
+	if retries < 0 {
+		return nil, fmt.Errorf("--retries can't be negative")
+	}
+	if retries > 0 {
+		options.RetryPolicy = &autopkg.RetryPolicy{MaxRetries: retries, Backoff: retryBackoff}
+	}
+
+	if chaosFailurePercent > 0 || chaosTimeoutPercent > 0 || chaosSimulate {
+		options.Chaos = &autopkg.ChaosOptions{
+			FailureRate:  chaosFailurePercent / 100,
+			TimeoutRate:  chaosTimeoutPercent / 100,
+			TimeoutDelay: chaosTimeoutDelay,
+			Seed:         chaosSeed,
+			Simulate:     chaosSimulate,
+		}
+	}
+
+	if httpProxy != "" || httpsProxy != "" || noProxy != "" || len(downloadMirrors) > 0 {
+		mirrors, err := autopkg.ParseDownloadMirrors(downloadMirrors)
+		if err != nil {
+			return nil, err
+		}
+		options.DownloadProxy = &autopkg.DownloadProxy{
+			HTTPProxy:  httpProxy,
+			HTTPSProxy: httpsProxy,
+			NoProxy:    noProxy,
+			Mirrors:    mirrors,
+		}
+		if err := options.DownloadProxy.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if catalogPath != "" {
+		catalog, err := autopkg.LoadCatalog(catalogPath)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to load catalog: %v", err), logger.LogError)
+			return nil, err
+		}
+		options.Catalog = catalog
+	}
+
+	if hashListPath != "" {
+		hashList, err := autopkg.LoadHashList(hashListPath, hashListPublicKey)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to load hash list: %v", err), logger.LogError)
+			return nil, err
+		}
+		options.HashList = hashList
+	}
+
+	if eventsPath != "" {
+		options.EventSinks = append(options.EventSinks, &autopkg.FileEventSink{Path: eventsPath})
+	}
+	if htmlReportPath != "" {
+		options.EventSinks = append(options.EventSinks, &autopkg.HTMLReportEventSink{Path: htmlReportPath})
+	}
+	if junitReportPath != "" {
+		options.EventSinks = append(options.EventSinks, &autopkg.JUnitReportEventSink{Path: junitReportPath})
+	}
+
+	tracer, err := autopkg.NewTracer(autopkg.TracingOptions{Endpoint: otlpEndpoint, Headers: otlpHeaders})
 	if err != nil {
-		logger.Logger(fmt.Sprintf("❌ Error during recipe execution: %v", err), logger.LogError)
+		return nil, err
 	}
+	options.Tracer = tracer
 
-	successCount, failCount := 0, 0
-	for recipe, result := range results {
-		if result.ExecutionError != nil {
-			failCount++
-			logger.Logger(fmt.Sprintf("❌ Recipe failed: %s | Error: %v", recipe, result.ExecutionError), logger.LogError)
-		} else {
-			successCount++
-			logger.Logger(fmt.Sprintf("✅ Recipe succeeded: %s", recipe), logger.LogSuccess)
+	if webhooksPath != "" {
+		webhooks, err := autopkg.LoadWebhookSubscriptions(webhooksPath)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to load webhooks: %v", err), logger.LogError)
+			return nil, err
 		}
+		options.Webhooks = webhooks
 	}
 
-	if failCount > 0 {
-		return fmt.Errorf("recipe execution failed: %d recipes failed", failCount)
+	if recipeOverridesPath != "" {
+		perRecipe, err := autopkg.LoadRecipeOverrides(recipeOverridesPath)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to load recipe overrides: %v", err), logger.LogError)
+			return nil, err
+		}
+		options.PerRecipe = perRecipe
 	}
 
-	return nil
+	if recipePolicyPath != "" {
+		policy, err := autopkg.LoadRecipePolicy(recipePolicyPath)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to load recipe policy: %v", err), logger.LogError)
+			return nil, err
+		}
+		options.Policy = policy
+	}
+
+	if targetsPath != "" {
+		targets, err := autopkg.LoadTargetSet(targetsPath)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to load targets: %v", err), logger.LogError)
+			return nil, err
+		}
+		options.Targets = targets
+	}
+
+	return options, nil
+}
+
+// addDownloadProxyFlags adds the flags routing recipe downloads through a proxy and mirrors
+func addDownloadProxyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&httpProxy, "http-proxy", "", "Proxy for http downloads, passed to autopkg as http_proxy")
+	cmd.Flags().StringVar(&httpsProxy, "https-proxy", "", "Proxy for https downloads, passed to autopkg as https_proxy")
+	cmd.Flags().StringVar(&noProxy, "no-proxy", "", "Comma-separated hosts downloaded from directly, passed to autopkg as no_proxy")
+	cmd.Flags().StringSliceVar(&downloadMirrors, "download-mirror", []string{}, "Rewrite downloads from a host or URL prefix to a mirror, as host=mirror URL, e.g. download.mozilla.org=https://mirror.example.com/mozilla; recipes opt out with no_download_proxy in --recipe-overrides")
+}
+
+// selectRecipes applies the run filter flags to every available recipe, or
+// to the recipes given on the command line when there are any
+func selectRecipes(recipeInput string) ([]string, error) {
+	var candidates []string
+	if recipeInput != "" {
+		parsed, err := autopkg.ParseRecipeInput(recipeInput).Parse()
+		if err != nil {
+			return nil, err
+		}
+		candidates = parsed
+	}
+
+	criteria := &autopkg.RecipeFilterCriteria{
+		NamePattern:      filterName,
+		ExcludePattern:   filterExclude,
+		RecipeTypes:      filterTypes,
+		IncludeOverrides: true,
+		MaxRecipes:       filterMax,
+	}
+	if filterModified > 0 {
+		criteria.ModifiedAfter = time.Now().Add(-filterModified)
+	}
+
+	selected, err := autopkg.SelectRecipes(candidates, criteria, prefsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Logger(fmt.Sprintf("🔍 Selected %d recipes: %s", len(selected), strings.Join(selected, ", ")), logger.LogInfo)
+	return selected, nil
 }
 
 func runCleanup() error {
+	lock, err := acquireRunLock(prefsPath, "cleanup")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	options := &autopkg.CleanupOptions{
 		PrefsPath:         prefsPath,
 		RemoveDownloads:   removeDownloads,
@@ -719,6 +1514,21 @@ func runCleanup() error {
 	return nil
 }
 
+// acquireRunLock takes the lock on a preferences file for a run or cleanup,
+// waiting as long as --wait and --lock-timeout allow
+func acquireRunLock(prefs string, command string) (*autopkg.RunLock, error) {
+	timeout := lockTimeout
+	if lockWait && timeout == 0 {
+		timeout = -1
+	}
+	lock, err := autopkg.AcquireRunLock(prefs, "autopkgctl "+command, timeout)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("🔒 %v", err), logger.LogError)
+		return nil, err
+	}
+	return lock, nil
+}
+
 func getLogLevel(cliLogLevel string) int {
 	// Use CLI flag if set, otherwise check the environment variable
 	level := cliLogLevel
@@ -0,0 +1,80 @@
+// cmd/autopkgctl/make_overrides.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Make-overrides command flags
+	overridesCatalogPath string
+	overridesSearchDirs  []string
+	overridesDirs        []string
+	overridesPull        bool
+	overridesIgnoreDepr  bool
+	overridesSkipTrust   bool
+)
+
+// newMakeOverridesCmd creates the make-overrides command for generating overrides in bulk from a catalog
+func newMakeOverridesCmd() *cobra.Command {
+	makeOverridesCmd := &cobra.Command{
+		Use:   "make-overrides",
+		Short: "Create or update YAML overrides for every recipe in a catalog",
+		Long:  "For each catalog recipe, create a YAML override if it is missing (converting plist overrides), write the Input keys from its target's override template and its own input, then update trust info.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if overridesCatalogPath == "" {
+				return configError(fmt.Errorf("--catalog is required"))
+			}
+
+			catalog, err := autopkg.LoadCatalog(overridesCatalogPath)
+			if err != nil {
+				return configError(err)
+			}
+
+			results, err := autopkg.MakeOverridesFromCatalog(catalog, &autopkg.MakeOverridesOptions{
+				PrefsPath:         prefsPath,
+				SearchDirs:        overridesSearchDirs,
+				OverrideDirs:      overridesDirs,
+				Pull:              overridesPull,
+				IgnoreDeprecation: overridesIgnoreDepr,
+				SkipTrustUpdate:   overridesSkipTrust,
+			})
+
+			created, updated := 0, 0
+			documents := make([]overrideResult, 0, len(results))
+			for _, result := range results {
+				documents = append(documents, overrideResult{
+					Recipe:  result.Recipe,
+					Path:    result.Path,
+					Created: result.Created,
+					Input:   result.Input,
+					Error:   errorString(result.Error),
+				})
+				if result.Error != nil {
+					continue
+				}
+				if result.Created {
+					created++
+				} else {
+					updated++
+				}
+			}
+			setResult(documents)
+			fmt.Printf("🏭 %d overrides created, %d updated, %d failed\n", created, updated, len(results)-created-updated)
+
+			return err
+		},
+	}
+
+	makeOverridesCmd.Flags().StringVar(&overridesCatalogPath, "catalog", "", "Path to the recipe catalog YAML file")
+	makeOverridesCmd.Flags().StringSliceVar(&overridesSearchDirs, "search-dir", []string{}, "Directories to search for recipes (can be specified multiple times)")
+	makeOverridesCmd.Flags().StringSliceVar(&overridesDirs, "override-dir", []string{}, "Directories to search for recipe overrides, new overrides go to the first (can be specified multiple times)")
+	makeOverridesCmd.Flags().BoolVar(&overridesPull, "pull", false, "Pull the parent repos if they are missing")
+	makeOverridesCmd.Flags().BoolVar(&overridesIgnoreDepr, "ignore-deprecation", false, "Create overrides even for deprecated recipes")
+	makeOverridesCmd.Flags().BoolVar(&overridesSkipTrust, "skip-trust", false, "Do not update trust info after writing the overrides")
+
+	return makeOverridesCmd
+}
@@ -0,0 +1,66 @@
+// cmd/autopkgctl/new_recipe.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// New-recipe command flags
+	newRecipeIdentifier       string
+	newRecipeParentIdentifier string
+	newRecipeFormat           string
+)
+
+// newRecipeResult is the result document of the new-recipe command
+type newRecipeResult struct {
+	Path             string `json:"path"`
+	Identifier       string `json:"identifier,omitempty"`
+	ParentIdentifier string `json:"parent_identifier,omitempty"`
+	Format           string `json:"format"`
+}
+
+// newNewRecipeCmd creates the new-recipe command for starting a recipe from AutoPkg's template
+func newNewRecipeCmd() *cobra.Command {
+	newRecipeCmd := &cobra.Command{
+		Use:   "new-recipe <path>",
+		Short: "Create a recipe from AutoPkg's template",
+		Long:  "Create a template recipe at path with autopkg new-recipe, with the given identifier and, for a child recipe, the identifier of its parent.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if newRecipeFormat != "plist" && newRecipeFormat != "yaml" {
+				return configError(fmt.Errorf("unknown format %q, expected plist or yaml", newRecipeFormat))
+			}
+
+			output, err := autopkg.NewRecipeFile(args[0], &autopkg.NewRecipeOptions{
+				PrefsPath:        prefsPath,
+				Identifier:       newRecipeIdentifier,
+				ParentIdentifier: newRecipeParentIdentifier,
+				Format:           newRecipeFormat,
+			})
+			if err != nil {
+				return err
+			}
+
+			setResult(&newRecipeResult{
+				Path:             args[0],
+				Identifier:       newRecipeIdentifier,
+				ParentIdentifier: newRecipeParentIdentifier,
+				Format:           newRecipeFormat,
+			})
+			if !structuredOutput() {
+				fmt.Print(output)
+			}
+			return nil
+		},
+	}
+
+	newRecipeCmd.Flags().StringVar(&newRecipeIdentifier, "identifier", "", "Identifier of the new recipe, e.g. com.github.example.download.Firefox")
+	newRecipeCmd.Flags().StringVar(&newRecipeParentIdentifier, "parent-identifier", "", "Identifier of the parent recipe, for a child recipe")
+	newRecipeCmd.Flags().StringVar(&newRecipeFormat, "format", "plist", "Recipe format: plist or yaml")
+
+	return newRecipeCmd
+}
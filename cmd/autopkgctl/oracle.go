@@ -0,0 +1,134 @@
+// cmd/autopkgctl/oracle.go
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	versionoracle "github.com/deploymenttheory/macos-autopkg-factory/tools/version_oracle"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Oracle command flags
+	oracleGrace       time.Duration
+	oracleHomebrewAPI string
+	oracleNoHomebrew  bool
+	oracleFailOnLag   bool
+)
+
+// newOracleCmd creates the oracle command comparing built versions with versions listed outside AutoPkg
+func newOracleCmd() *cobra.Command {
+	oracleCmd := &cobra.Command{
+		Use:   "oracle [app...]",
+		Short: "Compare the versions we built with the latest versions Homebrew and vendors list",
+		Long: `Look up the latest version of every app in the run history, or the apps
+given, from the Homebrew cask API and the vendor version_url of its recipes in
+--catalog, and compare it with the newest version we built. A recipe whose
+download URL or version regex broke keeps "succeeding" with an old version,
+which AutoPkg itself can't detect.
+
+Casks are found by the app name, GoogleChrome as google-chrome; set cask in
+the catalog when it differs. An app lagging behind for longer than --grace,
+measured from the first check that saw the newer version, is significant:
+it's alerted with --notify-slack or --notify-teams and fails the command with
+--fail-on-lag.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options := autopkg.VersionLagOptions{Apps: args, Grace: oracleGrace}
+			if catalogPath != "" {
+				catalog, err := autopkg.LoadCatalog(catalogPath)
+				if err != nil {
+					return configError(err)
+				}
+				options.Catalog = catalog
+			}
+			options.Sources = []versionoracle.Source{&versionoracle.VendorURL{}}
+			if !oracleNoHomebrew {
+				options.Sources = append(options.Sources, &versionoracle.HomebrewCask{APIURL: oracleHomebrewAPI})
+			}
+
+			path := historyPath
+			if path == "" {
+				path = autopkg.DefaultHistoryPath(stateDir)
+			}
+			history, err := autopkg.OpenHistory(path)
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+
+			lags, err := autopkg.CheckVersionLag(history, options)
+			if err != nil {
+				return err
+			}
+			setResult(lags)
+
+			if !structuredOutput() {
+				printVersionLags(lags)
+			}
+
+			notification := autopkg.NotificationOptions{
+				EnableTeams:   teamsWebhook != "",
+				TeamsWebhook:  teamsWebhook,
+				EnableSlack:   slackWebhook != "",
+				SlackWebhook:  slackWebhook,
+				SlackUsername: slackUsername,
+				SlackChannel:  slackChannel,
+				SlackIcon:     slackIcon,
+			}
+			if err := autopkg.NotifyVersionLag(notification, lags); err != nil {
+				return withExitCode(exitError, err)
+			}
+
+			if oracleFailOnLag {
+				for _, lag := range lags {
+					if lag.Significant {
+						return withExitCode(exitError, fmt.Errorf("%s is behind %s %s", lag.App, lag.Source, lag.Latest))
+					}
+				}
+			}
+			return nil
+		},
+	}
+
+	oracleCmd.Flags().StringVar(&catalogPath, "catalog", "", "Path to a recipe catalog YAML file with the cask, version_url and name of recipes")
+	oracleCmd.Flags().StringVar(&historyPath, "history", "", "Path to the run history database (defaults to history.db in the state directory)")
+	oracleCmd.Flags().DurationVar(&oracleGrace, "grace", 72*time.Hour, "How long an app may lag behind a newer version before it's significant")
+	oracleCmd.Flags().StringVar(&oracleHomebrewAPI, "homebrew-api", versionoracle.DefaultHomebrewCaskAPI, "Homebrew cask API URL, e.g. a mirror")
+	oracleCmd.Flags().BoolVar(&oracleNoHomebrew, "no-homebrew", false, "Only compare with the vendor version_url of recipes in --catalog")
+	oracleCmd.Flags().BoolVar(&oracleFailOnLag, "fail-on-lag", false, "Exit with an error when an app lags significantly")
+	oracleCmd.Flags().StringVar(&slackWebhook, "notify-slack", "", "Slack webhook to alert apps lagging significantly to")
+	oracleCmd.Flags().StringVar(&teamsWebhook, "notify-teams", "", "Microsoft Teams webhook to alert apps lagging significantly to")
+	oracleCmd.Flags().StringVar(&slackUsername, "slack-username", "AutoPkg Bot", "Username to display in Slack notifications")
+	oracleCmd.Flags().StringVar(&slackChannel, "slack-channel", "", "Slack channel for notifications")
+	oracleCmd.Flags().StringVar(&slackIcon, "slack-icon", ":package:", "Emoji icon for Slack notifications")
+	oracleCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the comparison as JSON, shorthand for --output json")
+
+	return oracleCmd
+}
+
+// printVersionLags lists the apps behind their oracles, and how many are current
+func printVersionLags(lags []autopkg.VersionLag) {
+	current, unknown := 0, 0
+	for _, lag := range lags {
+		switch {
+		case lag.Behind:
+			icon := "🕒"
+			if lag.Significant {
+				icon = "⚠️"
+			}
+			fmt.Printf("%s %-30s built %-15s %s lists %s, seen %s ago\n", icon, lag.App, lag.Version, lag.Source, lag.Latest, lag.Lag.Round(time.Minute))
+		case lag.Latest != "":
+			current++
+		default:
+			unknown++
+		}
+		for _, answer := range lag.Answers {
+			if answer.Error != "" {
+				fmt.Printf("    %s: %s\n", answer.Source, answer.Error)
+			}
+		}
+	}
+	fmt.Printf("🔮 %d apps checked: %d current, %d unknown to every source\n", len(lags), current, unknown)
+}
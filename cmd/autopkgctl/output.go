@@ -0,0 +1,186 @@
+// cmd/autopkgctl/output.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats for --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// Exit codes, so CI pipelines can branch on the kind of failure without parsing output
+const (
+	exitSuccess        = 0
+	exitError          = 1 // Unexpected error, e.g. autopkg or git failing to start
+	exitConfigError    = 2 // Invalid flags, arguments or configuration files
+	exitTrustFailure   = 3 // Trust verification failed
+	exitRecipeFailure  = 4 // Every recipe that ran failed
+	exitPartialSuccess = 5 // Some recipes failed, others succeeded
+)
+
+var (
+	// Output flags
+	outputFormat string
+	jsonOutput   bool // Shorthand for --output json kept by commands that had a --json flag
+	yamlOutput   bool // Shorthand for --output yaml kept by commands that had a --yaml flag
+
+	// commandResult is the result document of the command being run, set by its RunE
+	commandResult interface{}
+
+	// documentOutput is where the result document is written, stdout before it is redirected
+	documentOutput io.Writer = os.Stdout
+)
+
+// CommandResult is the document written for every command with --output json
+// or yaml. YAML is converted from the JSON document, so both use the same keys.
+type CommandResult struct {
+	Command  string      `json:"command"`
+	Status   string      `json:"status"` // success, partial, failure or error
+	ExitCode int         `json:"exit_code"`
+	Error    string      `json:"error,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+}
+
+// exitCodeError carries the exit code of a failed command
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// withExitCode marks an error with the exit code the process should end with
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitCodeError{code: code, err: err}
+}
+
+// configError marks an error caused by invalid flags, arguments or configuration
+func configError(err error) error {
+	return withExitCode(exitConfigError, err)
+}
+
+// exitCodeFor returns the exit code for a command's error
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+	var coded *exitCodeError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return exitError
+}
+
+// exitStatus names an exit code for result documents and action outputs
+func exitStatus(code int) string {
+	switch code {
+	case exitSuccess:
+		return "success"
+	case exitPartialSuccess:
+		return "partial"
+	case exitTrustFailure, exitRecipeFailure:
+		return "failure"
+	default:
+		return "error"
+	}
+}
+
+// recipeBatchExitCode returns the exit code for a batch with the given
+// numbers of succeeded, failed and trust-failed recipes
+func recipeBatchExitCode(succeeded, failed, trustFailed int) int {
+	switch {
+	case failed == 0 && trustFailed == 0:
+		return exitSuccess
+	case succeeded > 0:
+		return exitPartialSuccess
+	case failed == 0:
+		return exitTrustFailure
+	default:
+		return exitRecipeFailure
+	}
+}
+
+// applyOutputFormat validates --output and, for structured formats, sends
+// logs and any other text to stderr, keeping stdout a single parseable document
+func applyOutputFormat(cmd *cobra.Command) error {
+	if flag := cmd.Flags().Lookup("json"); flag != nil && flag.Changed && jsonOutput {
+		outputFormat = outputJSON
+	}
+	if flag := cmd.Flags().Lookup("yaml"); flag != nil && flag.Changed && yamlOutput {
+		if jsonOutput {
+			return configError(fmt.Errorf("--json and --yaml are mutually exclusive"))
+		}
+		outputFormat = outputYAML
+	}
+
+	switch outputFormat {
+	case outputText:
+	case outputJSON, outputYAML:
+		documentOutput = os.Stdout
+		os.Stdout = os.Stderr
+		logger.SetOutput(os.Stderr)
+	default:
+		return configError(fmt.Errorf("unknown output format %q, use text, json or yaml", outputFormat))
+	}
+	return nil
+}
+
+// structuredOutput reports whether the command writes a result document instead of text
+func structuredOutput() bool {
+	return outputFormat == outputJSON || outputFormat == outputYAML
+}
+
+// setResult records the result document of the command
+func setResult(result interface{}) {
+	commandResult = result
+}
+
+// writeCommandResult writes the result document of a finished command in the selected format
+func writeCommandResult(cmd *cobra.Command, err error) error {
+	code := exitCodeFor(err)
+	document := CommandResult{
+		Command:  cmd.CommandPath(),
+		Status:   exitStatus(code),
+		ExitCode: code,
+		Result:   commandResult,
+	}
+	if err != nil {
+		document.Error = err.Error()
+	}
+
+	data, marshalErr := json.MarshalIndent(document, "", "  ")
+	if marshalErr != nil {
+		return fmt.Errorf("failed to marshal result: %w", marshalErr)
+	}
+
+	// JSON is valid YAML, and a MapSlice keeps the key order when re-encoding it
+	if outputFormat == outputYAML {
+		var ordered yaml.MapSlice
+		if err := yaml.Unmarshal(data, &ordered); err != nil {
+			return fmt.Errorf("failed to convert result to YAML: %w", err)
+		}
+		if data, marshalErr = yaml.Marshal(ordered); marshalErr != nil {
+			return fmt.Errorf("failed to marshal result: %w", marshalErr)
+		}
+	}
+
+	fmt.Fprintln(documentOutput, strings.TrimSuffix(string(data), "\n"))
+	return nil
+}
@@ -0,0 +1,160 @@
+// cmd/autopkgctl/prefs.go
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Prefs command flags
+	prefsFormat         string
+	prefsFile           string
+	prefsIncludeSecrets bool
+	prefsReplace        bool
+	prefsDryRun         bool
+)
+
+// prefsChangesResult is the result document of the prefs import and diff commands
+type prefsChangesResult struct {
+	Source  string                   `json:"source"`
+	Changes []autopkg.PreferenceDiff `json:"changes"`
+	DryRun  bool                     `json:"dry_run,omitempty"`
+}
+
+// newPrefsCmd creates the prefs command group for codifying and syncing AutoPkg preferences
+func newPrefsCmd() *cobra.Command {
+	prefsCmd := &cobra.Command{
+		Use:   "prefs",
+		Short: "Export, import and compare AutoPkg preferences",
+		Long:  "Export AutoPkg preferences to a file that can be reviewed and kept in git, import them on other runners and compare a runner's preferences with another file. Credentials are masked on export unless --include-secrets is set, and masked values keep the runner's own credentials on import.",
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the preferences as YAML, JSON or a plist",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prefs, err := autopkg.ExportPreferences(prefsPath, prefsIncludeSecrets)
+			if err != nil {
+				return configError(err)
+			}
+
+			data, err := autopkg.MarshalPreferences(prefs, prefsFormat)
+			if err != nil {
+				return configError(err)
+			}
+
+			if prefsFile != "" {
+				if err := os.WriteFile(prefsFile, data, 0600); err != nil {
+					return fmt.Errorf("failed to write %s: %w", prefsFile, err)
+				}
+				setResult(prefs)
+				if !structuredOutput() {
+					fmt.Printf("✅ Exported %d preferences to %s\n", len(prefs), prefsFile)
+				}
+				return nil
+			}
+
+			setResult(prefs)
+			if !structuredOutput() {
+				fmt.Print(string(data))
+			}
+			return nil
+		},
+	}
+
+	exportCmd.Flags().StringVar(&prefsFormat, "format", autopkg.PrefsFormatYAML, "Export format: yaml, json or plist")
+	exportCmd.Flags().StringVar(&prefsFile, "file", "", "File to write the export to instead of standard output")
+	exportCmd.Flags().BoolVar(&prefsIncludeSecrets, "include-secrets", false, "Export credentials instead of masking them")
+
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Merge preferences from an export into the preferences",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			changes, err := autopkg.ImportPreferences(prefsPath, args[0], &autopkg.PrefsImportOptions{
+				Replace: prefsReplace,
+				DryRun:  prefsDryRun,
+			})
+			if err != nil {
+				return configError(err)
+			}
+
+			setResult(&prefsChangesResult{Source: args[0], Changes: autopkg.MaskPreferenceDiffs(changes), DryRun: prefsDryRun})
+			if !structuredOutput() {
+				printPreferenceDiffs(autopkg.MaskPreferenceDiffs(changes))
+				if prefsDryRun && len(changes) > 0 {
+					fmt.Println("Dry run, no preferences written")
+				}
+			}
+			return nil
+		},
+	}
+
+	importCmd.Flags().BoolVar(&prefsReplace, "replace", false, "Remove preferences the file doesn't set instead of merging")
+	importCmd.Flags().BoolVar(&prefsDryRun, "dry-run", false, "Show the changes without writing them")
+
+	diffCmd := &cobra.Command{
+		Use:   "diff <other>",
+		Short: "Compare the preferences with another preferences file or export",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			current, err := autopkg.GetAutoPkgPreferences(prefsPath)
+			if err != nil {
+				return configError(err)
+			}
+			other, err := autopkg.LoadPreferencesFile(args[0])
+			if err != nil {
+				return configError(err)
+			}
+			// A masked export can only be compared with masked preferences
+			if !prefsIncludeSecrets {
+				current = autopkg.MaskPreferences(current)
+				other = autopkg.MaskPreferences(other)
+			}
+
+			changes := autopkg.DiffPreferences(current, other)
+			if !prefsIncludeSecrets {
+				changes = autopkg.MaskPreferenceDiffs(changes)
+			}
+
+			setResult(&prefsChangesResult{Source: args[0], Changes: changes})
+			if !structuredOutput() {
+				printPreferenceDiffs(changes)
+			}
+			return nil
+		},
+	}
+
+	diffCmd.Flags().BoolVar(&prefsIncludeSecrets, "include-secrets", false, "Compare and show credentials instead of masking them")
+
+	prefsCmd.AddCommand(exportCmd)
+	prefsCmd.AddCommand(importCmd)
+	prefsCmd.AddCommand(diffCmd)
+
+	return prefsCmd
+}
+
+// printPreferenceDiffs prints preference changes, one line per key
+func printPreferenceDiffs(changes []autopkg.PreferenceDiff) {
+	if len(changes) == 0 {
+		fmt.Println("✅ Preferences are identical")
+		return
+	}
+
+	for _, change := range changes {
+		switch change.Change {
+		case autopkg.PrefsAdded:
+			fmt.Printf("+ %s: %v\n", change.Key, change.New)
+		case autopkg.PrefsRemoved:
+			fmt.Printf("- %s: %v\n", change.Key, change.Old)
+		default:
+			fmt.Printf("~ %s: %v → %v\n", change.Key, change.Old, change.New)
+		}
+	}
+	fmt.Printf("%d preferences differ\n", len(changes))
+}
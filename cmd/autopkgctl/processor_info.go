@@ -0,0 +1,102 @@
+// cmd/autopkgctl/processor_info.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Processor-info command flags
+	processorInfoRecipe       string
+	processorInfoSearchDirs   []string
+	processorInfoOverrideDirs []string
+	processorInfoRefresh      bool
+)
+
+// newProcessorInfoCmd creates the processor-info command
+func newProcessorInfoCmd() *cobra.Command {
+	processorInfoCmd := &cobra.Command{
+		Use:   "processor-info <processor>",
+		Short: "Show a processor's description and input and output variables",
+		Long: `Show what autopkg processor-info reports for a processor. Shared processors
+can be given as recipes reference them, <recipe identifier>/<name>, and are
+looked up from that recipe; processors next to a recipe need --recipe.
+
+Results are cached in processor-info.json in the state directory, where
+processors audit picks them up. --refresh runs autopkg again.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, err := autopkg.LoadProcessorInfoCache(autopkg.ProcessorInfoCachePath(stateDir))
+			if err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Processor info cache unavailable: %v", err), logger.LogWarning)
+			}
+			if processorInfoRefresh {
+				cache.Forget(autopkg.ResolveProcessorReference(args[0], processorInfoRecipe))
+			}
+
+			info, err := autopkg.DescribeProcessor(args[0], &autopkg.ProcessorInfoOptions{
+				PrefsPath:    prefsPath,
+				Recipe:       processorInfoRecipe,
+				SearchDirs:   processorInfoSearchDirs,
+				OverrideDirs: processorInfoOverrideDirs,
+			}, cache)
+			if err != nil {
+				return err
+			}
+			if err := cache.Save(); err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Failed to save processor info cache: %v", err), logger.LogWarning)
+			}
+
+			setResult(info)
+			if structuredOutput() {
+				return nil
+			}
+
+			printProcessorInfo(info)
+			return nil
+		},
+	}
+
+	processorInfoCmd.Flags().StringVar(&processorInfoRecipe, "recipe", "", "Recipe to look the processor up from, for processors next to a recipe")
+	processorInfoCmd.Flags().StringSliceVar(&processorInfoSearchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	processorInfoCmd.Flags().StringSliceVar(&processorInfoOverrideDirs, "override-dir", []string{}, "Additional recipe override directories")
+	processorInfoCmd.Flags().BoolVar(&processorInfoRefresh, "refresh", false, "Run autopkg processor-info even when the processor is cached")
+	processorInfoCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the processor info as JSON, shorthand for --output json")
+
+	return processorInfoCmd
+}
+
+// printProcessorInfo prints a processor's description and variables
+func printProcessorInfo(info *autopkg.ProcessorInfo) {
+	fmt.Printf("⚙️ %s\n", info.Reference)
+	if info.Description != "" {
+		fmt.Printf("  %s\n", info.Description)
+	}
+
+	for _, section := range []struct {
+		title     string
+		variables []autopkg.ProcessorVariable
+	}{{"Input variables", info.Input}, {"Output variables", info.Output}} {
+		if len(section.variables) == 0 {
+			continue
+		}
+		fmt.Printf("\n  %s\n", section.title)
+		for _, variable := range section.variables {
+			line := fmt.Sprintf("    • %s", variable.Name)
+			if variable.Required {
+				line += " (required)"
+			}
+			if variable.Default != "" {
+				line += fmt.Sprintf(" [default: %s]", variable.Default)
+			}
+			fmt.Println(line)
+			if variable.Description != "" {
+				fmt.Printf("        %s\n", variable.Description)
+			}
+		}
+	}
+}
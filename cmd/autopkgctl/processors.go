@@ -0,0 +1,114 @@
+// cmd/autopkgctl/processors.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Processors command flags
+	processorsSearchDirs   []string
+	processorsOverrideDirs []string
+	processorsAllowMissing bool
+)
+
+// newProcessorsCmd creates the processors command for inspecting processor usage
+func newProcessorsCmd() *cobra.Command {
+	processorsCmd := &cobra.Command{
+		Use:   "processors",
+		Short: "Inspect the processors used by the recipe set",
+	}
+
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "List every processor referenced by recipes and overrides, and flag missing ones",
+		Long:  "Walk all recipes and overrides in the search, repo and override directories, list every processor they reference with the repos providing shared processors, and fail if any processor or parent recipe can't be found",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Processors described with processor-info carry their variable documentation
+			cache, err := autopkg.LoadProcessorInfoCache(autopkg.ProcessorInfoCachePath(stateDir))
+			if err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Processor info cache unavailable: %v", err), logger.LogWarning)
+			}
+
+			audit, err := autopkg.AuditProcessors(&autopkg.ProcessorAuditOptions{
+				PrefsPath:    prefsPath,
+				SearchDirs:   processorsSearchDirs,
+				OverrideDirs: processorsOverrideDirs,
+				InfoCache:    cache,
+			})
+			if err != nil {
+				return err
+			}
+
+			setResult(audit)
+			if !structuredOutput() {
+				printProcessorAudit(audit)
+			}
+
+			if !processorsAllowMissing && (len(audit.Missing) > 0 || len(audit.UnresolvedParents) > 0) {
+				return configError(fmt.Errorf("%d missing processors and %d unresolved parent recipes", len(audit.Missing), len(audit.UnresolvedParents)))
+			}
+			return nil
+		},
+	}
+
+	auditCmd.Flags().StringSliceVar(&processorsSearchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	auditCmd.Flags().StringSliceVar(&processorsOverrideDirs, "override-dir", []string{}, "Override directories to scan (defaults to RECIPE_OVERRIDE_DIRS)")
+	auditCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the audit as JSON, shorthand for --output json")
+	auditCmd.Flags().BoolVar(&processorsAllowMissing, "allow-missing", false, "Don't fail when processors or parent recipes are missing")
+
+	processorsCmd.AddCommand(auditCmd)
+	return processorsCmd
+}
+
+// printProcessorAudit prints the processor inventory grouped by kind
+func printProcessorAudit(audit *autopkg.ProcessorAudit) {
+	fmt.Printf("🔬 %d processors referenced by %d recipes\n", len(audit.Processors), audit.RecipesScanned)
+
+	for _, kind := range []string{autopkg.ProcessorCore, autopkg.ProcessorShared, autopkg.ProcessorLocal} {
+		var lines []string
+		for _, usage := range audit.Processors {
+			if usage.Kind != kind {
+				continue
+			}
+			line := fmt.Sprintf("    • %-50s %d recipes", usage.Name, len(usage.UsedBy))
+			if len(usage.ProvidedBy) > 0 {
+				line += "  (" + strings.Join(usage.ProvidedBy, ", ") + ")"
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Printf("\n  %s\n%s\n", kind, strings.Join(lines, "\n"))
+	}
+
+	if len(audit.Missing) > 0 {
+		fmt.Println("\n❌ Missing processors")
+		for _, usage := range audit.Missing {
+			fmt.Printf("    • %s, used by %s\n", usage.Name, strings.Join(usage.UsedBy, ", "))
+		}
+	}
+
+	if len(audit.UnresolvedParents) > 0 {
+		fmt.Println("\n❌ Unresolved parent recipes")
+		recipes := make([]string, 0, len(audit.UnresolvedParents))
+		for recipe := range audit.UnresolvedParents {
+			recipes = append(recipes, recipe)
+		}
+		sort.Strings(recipes)
+		for _, recipe := range recipes {
+			fmt.Printf("    • %s → %s\n", recipe, audit.UnresolvedParents[recipe])
+		}
+	}
+
+	if len(audit.Missing) == 0 && len(audit.UnresolvedParents) == 0 {
+		fmt.Println("\n✅ All processors and parent recipes resolved")
+	}
+}
@@ -0,0 +1,168 @@
+// cmd/autopkgctl/profile.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Profile flags
+	profileName        string
+	profileDescription string
+	profileFromPrefs   string
+	profileOverrideDir string
+	profileProduction  bool
+)
+
+// profileResult is the result document of the profile commands
+type profileResult struct {
+	Current  string             `json:"current,omitempty"`
+	Profiles []*autopkg.Profile `json:"profiles"`
+}
+
+// newProfileCmd creates the profile command group for named preference profiles
+func newProfileCmd() *cobra.Command {
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage named preference profiles for separate MDM tenants",
+		Long:  "Create, list and switch between named profiles, each with its own AutoPkg preferences file, override directory and credentials. Commands use the current profile, or the one given with --profile, when --prefs isn't set. Write a profile's credentials with configure --profile.",
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a profile with its own preferences and override directory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profile, err := autopkg.CreateProfile(stateDir, args[0], &autopkg.ProfileOptions{
+				Description: profileDescription,
+				FromPrefs:   profileFromPrefs,
+				OverrideDir: profileOverrideDir,
+				Production:  profileProduction,
+			})
+			if err != nil {
+				return configError(err)
+			}
+
+			setResult(&profileResult{Profiles: []*autopkg.Profile{profile}})
+			if !structuredOutput() {
+				fmt.Printf("✅ Created profile %s\n", profile.Name)
+				fmt.Printf("  Preferences: %s\n", profile.PrefsPath)
+				fmt.Printf("  Overrides:   %s\n", profile.OverrideDir)
+				fmt.Printf("Add credentials with: autopkgctl configure --profile %s ...\n", profile.Name)
+			}
+			return nil
+		},
+	}
+
+	createCmd.Flags().StringVar(&profileDescription, "description", "", "Description of the profile, e.g. the tenant it targets")
+	createCmd.Flags().StringVar(&profileFromPrefs, "from-prefs", "", "AutoPkg preferences file to copy settings and credentials from")
+	createCmd.Flags().StringVar(&profileOverrideDir, "override-dir", "", "Recipe override directory (defaults to RecipeOverrides within the profile)")
+	createCmd.Flags().BoolVar(&profileProduction, "production", false, "Flag the profile as targeting production, requiring --confirm-prod for runs outside CI")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List profiles and show the current one",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profiles, err := autopkg.ListProfiles(stateDir)
+			if err != nil {
+				return err
+			}
+			current, err := autopkg.CurrentProfile(stateDir)
+			if err != nil {
+				return err
+			}
+
+			result := &profileResult{Current: current, Profiles: profiles}
+			if result.Profiles == nil {
+				result.Profiles = []*autopkg.Profile{}
+			}
+			setResult(result)
+			if structuredOutput() {
+				return nil
+			}
+
+			if len(profiles) == 0 {
+				fmt.Println("No profiles, create one with autopkgctl profile create <name>")
+				return nil
+			}
+			for _, profile := range profiles {
+				marker := " "
+				if profile.Name == current {
+					marker = "*"
+				}
+				production := ""
+				if autopkg.IsProductionPrefs(profile.PrefsPath) {
+					production = " 🏭"
+				}
+				fmt.Printf("%s %-16s %s%s\n", marker, profile.Name, profile.Description, production)
+			}
+			return nil
+		},
+	}
+
+	switchCmd := &cobra.Command{
+		Use:   "switch <name>",
+		Short: "Make a profile the current one",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profile, err := autopkg.SwitchProfile(stateDir, args[0])
+			if err != nil {
+				return configError(err)
+			}
+
+			setResult(&profileResult{Current: profile.Name, Profiles: []*autopkg.Profile{profile}})
+			if !structuredOutput() {
+				fmt.Printf("✅ Switched to profile %s (%s)\n", profile.Name, profile.PrefsPath)
+			}
+			return nil
+		},
+	}
+
+	profileCmd.AddCommand(createCmd)
+	profileCmd.AddCommand(listCmd)
+	profileCmd.AddCommand(switchCmd)
+
+	return profileCmd
+}
+
+// applyProfile points --prefs at the preferences of the profile given with
+// --profile, or of the current profile when neither flag is set
+func applyProfile(cmd *cobra.Command) error {
+	// Profile management works on profiles directly rather than through one
+	if cmd.Parent() != nil && cmd.Parent().Name() == "profile" {
+		return nil
+	}
+
+	prefsFlag := cmd.Flags().Lookup("prefs")
+	if profileName != "" && prefsFlag != nil && prefsFlag.Changed {
+		return fmt.Errorf("--profile and --prefs are mutually exclusive")
+	}
+
+	name := profileName
+	if name == "" {
+		if prefsPath != "" {
+			return nil
+		}
+		current, err := autopkg.CurrentProfile(stateDir)
+		if err != nil {
+			return err
+		}
+		name = current
+	}
+	if name == "" {
+		return nil
+	}
+
+	profile, err := autopkg.LoadProfile(stateDir, name)
+	if err != nil {
+		return err
+	}
+	prefsPath = profile.PrefsPath
+	logger.Logger(fmt.Sprintf("👤 Using profile %s (%s)", profile.Name, profile.PrefsPath), logger.LogInfo)
+	return nil
+}
@@ -0,0 +1,80 @@
+// cmd/autopkgctl/queue.go
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/server"
+	"github.com/spf13/cobra"
+)
+
+// newQueueCmd creates the queue command showing the run queue of autopkgctl serve
+func newQueueCmd() *cobra.Command {
+	queueCmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Show the runs autopkgctl serve is running and has queued",
+		Long: `Show the runs autopkgctl serve is running, and the queued ones in the
+order they start: high priority before normal before low, then oldest first.
+A queued run waits for any running or earlier queued run sharing one of its
+recipes, so no two runs process the same recipe at once.
+
+The queue is read from the serve directory of the state directory, so use the
+same --state-dir as the daemon. Remotely, GET /api/v1/queue returns the same.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queue, err := server.ReadQueue(stateDir)
+			if err != nil {
+				return err
+			}
+
+			setResult(queue)
+			if structuredOutput() {
+				return nil
+			}
+			printQueue(queue)
+			return nil
+		},
+	}
+
+	queueCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the queue as JSON, shorthand for --output json")
+
+	return queueCmd
+}
+
+// printQueue prints the running and queued runs
+func printQueue(queue *server.Queue) {
+	if len(queue.Running) == 0 && len(queue.Queued) == 0 {
+		fmt.Println("ℹ️ No runs running or queued")
+		return
+	}
+
+	fmt.Printf("🚀 %d running\n", len(queue.Running))
+	for _, run := range queue.Running {
+		started := ""
+		if run.StartedAt != nil {
+			started = "for " + time.Since(*run.StartedAt).Round(time.Second).String()
+		}
+		fmt.Printf("  • %s  %-6s %-12s %s  %s\n", run.ID, run.Priority, run.Trigger, started, queueRecipes(run))
+	}
+
+	fmt.Printf("⏳ %d queued\n", len(queue.Queued))
+	for _, entry := range queue.Queued {
+		fmt.Printf("  %d. %s  %-6s %-12s %s\n", entry.Position, entry.ID, entry.Priority, entry.Trigger, queueRecipes(entry.Run))
+		if len(entry.WaitingFor) > 0 {
+			fmt.Printf("      waiting for %s\n", strings.Join(entry.WaitingFor, ", "))
+		}
+	}
+}
+
+// queueRecipes describes what a run processes, shortened for long lists
+func queueRecipes(run *server.Run) string {
+	if run.Request.RecipeList != "" {
+		return fmt.Sprintf("%s (%d recipes)", run.Request.RecipeList, len(run.Recipes))
+	}
+	if len(run.Recipes) > 3 {
+		return fmt.Sprintf("%s and %d more", strings.Join(run.Recipes[:3], ", "), len(run.Recipes)-3)
+	}
+	return strings.Join(run.Recipes, ", ")
+}
@@ -0,0 +1,91 @@
+// cmd/autopkgctl/recipe_info.go
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Recipe-info command flags
+	recipeInfoSearchDirs   []string
+	recipeInfoOverrideDirs []string
+	recipeInfoPull         bool
+)
+
+// newRecipeInfoCmd creates the recipe-info command
+func newRecipeInfoCmd() *cobra.Command {
+	recipeInfoCmd := &cobra.Command{
+		Use:   "recipe-info <recipe>",
+		Short: "Show a recipe's parent chain, input variables, processors and repo",
+		Long:  "Show what autopkg info reports for a recipe. With --json, or --output json or yaml, output its identifier, path, parent chain, input variables, processors in run order and repo of origin for downstream tooling.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := autopkg.DescribeRecipe(args[0], &autopkg.InfoOptions{
+				PrefsPath:    prefsPath,
+				SearchDirs:   recipeInfoSearchDirs,
+				OverrideDirs: recipeInfoOverrideDirs,
+				Pull:         recipeInfoPull,
+			})
+			if err != nil {
+				return err
+			}
+
+			setResult(info)
+			if structuredOutput() {
+				return nil
+			}
+
+			printRecipeInfo(info)
+			return nil
+		},
+	}
+
+	recipeInfoCmd.Flags().StringSliceVar(&recipeInfoSearchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	recipeInfoCmd.Flags().StringSliceVar(&recipeInfoOverrideDirs, "override-dir", []string{}, "Additional recipe override directories")
+	recipeInfoCmd.Flags().BoolVar(&recipeInfoPull, "pull", false, "Add repos the parent recipes come from when they're missing")
+	recipeInfoCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the recipe info as JSON, shorthand for --output json")
+
+	return recipeInfoCmd
+}
+
+// printRecipeInfo prints a recipe's info
+func printRecipeInfo(info *autopkg.RecipeInfo) {
+	fmt.Printf("📄 %s (%s)\n", info.Name, info.Identifier)
+	if info.Description != "" {
+		fmt.Printf("  %s\n", info.Description)
+	}
+	fmt.Printf("  Path: %s\n", info.Path)
+	if info.Repo != "" {
+		fmt.Printf("  Repo: %s\n", info.Repo)
+	}
+
+	if len(info.ParentRecipes) > 0 {
+		fmt.Println("  Parents:")
+		for _, parent := range info.ParentRecipes {
+			fmt.Printf("    • %s\n", parent)
+		}
+	}
+
+	if len(info.Input) > 0 {
+		keys := make([]string, 0, len(info.Input))
+		for key := range info.Input {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Println("  Input:")
+		for _, key := range keys {
+			fmt.Printf("    %s = %s\n", key, info.Input[key])
+		}
+	}
+
+	if len(info.Processors) > 0 {
+		fmt.Println("  Processors:")
+		for i, processor := range info.Processors {
+			fmt.Printf("    %d. %s\n", i+1, processor)
+		}
+	}
+}
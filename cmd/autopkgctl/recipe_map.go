@@ -0,0 +1,63 @@
+// cmd/autopkgctl/recipe_map.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Recipe-map command flags
+	recipeMapOverrideDirs []string
+	recipeMapCatalogPath  string
+	recipeMapOutputDir    string
+)
+
+// newRecipeMapCmd creates the recipe-map command that generates recipe lists from overrides
+func newRecipeMapCmd() *cobra.Command {
+	recipeMapCmd := &cobra.Command{
+		Use:   "recipe-map",
+		Short: "Generate categorized recipe list files from recipe overrides",
+		Long:  "Scan RECIPE_OVERRIDE_DIRS and write recipe list files grouped by recipe type and catalog tag, for use with run --recipe-list",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options := &autopkg.RecipeMapOptions{
+				PrefsPath:    prefsPath,
+				OverrideDirs: recipeMapOverrideDirs,
+				OutputDir:    recipeMapOutputDir,
+			}
+
+			if recipeMapCatalogPath != "" {
+				catalog, err := autopkg.LoadCatalog(recipeMapCatalogPath)
+				if err != nil {
+					return configError(err)
+				}
+				options.Catalog = catalog
+			}
+
+			recipeMap, err := autopkg.BuildRecipeMap(options)
+			if err != nil {
+				return err
+			}
+
+			written, err := autopkg.WriteRecipeMap(recipeMap, options.OutputDir)
+			if err != nil {
+				fmt.Printf("❌ Failed to write recipe lists: %v\n", err)
+				return err
+			}
+
+			setResult(written)
+			for _, path := range written {
+				fmt.Printf("✅ %s\n", path)
+			}
+			return nil
+		},
+	}
+
+	recipeMapCmd.Flags().StringSliceVar(&recipeMapOverrideDirs, "override-dir", []string{}, "Override directories to scan (defaults to RECIPE_OVERRIDE_DIRS)")
+	recipeMapCmd.Flags().StringVar(&recipeMapCatalogPath, "catalog", "", "Path to a recipe catalog YAML file used to group recipes by tag")
+	recipeMapCmd.Flags().StringVar(&recipeMapOutputDir, "output-dir", "configuration/recipe_lists", "Directory to write recipe list files to")
+
+	return recipeMapCmd
+}
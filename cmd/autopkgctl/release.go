@@ -0,0 +1,248 @@
+// cmd/autopkgctl/release.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Release command flags
+	releaseApprove  []string
+	releaseReject   []string
+	releaseApprover string
+
+	githubApprovalIssue string
+	githubApprovers     []string
+	approvalEventPath   string
+	approvalTimeout     time.Duration
+	approvalPoll        time.Duration
+)
+
+// newReleaseCmd creates the release command for approving quarantined builds
+func newReleaseCmd() *cobra.Command {
+	releaseCmd := &cobra.Command{
+		Use:   "release",
+		Short: "List, approve or reject builds held in quarantine",
+		Long: `Builds of upload recipes run with run --quarantine, or marked quarantine
+in --recipe-overrides, are staged in the state directory instead of being
+uploaded. Without flags, release lists the builds awaiting approval.
+
+--approve runs the upload recipe of each build with its staged package,
+after checking the package is unchanged since it was staged. --reject drops
+builds without uploading them. Builds are named App==version, or by app
+alone when only one of its versions is pending:
+
+  autopkgctl run --recipes Firefox.jamf --report report.plist --quarantine
+  autopkgctl release
+  autopkgctl release --approve Firefox==128.0
+
+With --github-approval, the pending builds are summarised in a comment on a
+GitHub issue or pull request, and approved or rejected by /approve and
+/reject comments from --approvers, or from the repository's owners, members
+and collaborators. release waits up to --approval-timeout for them, or, with
+--approval-event, decides from the comment of the issue_comment event a
+workflow was triggered by:
+
+  autopkgctl release --github-approval org/packages#42 --approval-timeout 2h
+  autopkgctl release --github-approval org/packages#42 --approval-event "$GITHUB_EVENT_PATH"`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(releaseApprove) > 0 && len(releaseReject) > 0 {
+				return configError(fmt.Errorf("--approve and --reject can't be combined"))
+			}
+			if githubApprovalIssue != "" && (len(releaseApprove) > 0 || len(releaseReject) > 0) {
+				return configError(fmt.Errorf("--github-approval can't be combined with --approve or --reject"))
+			}
+			switch {
+			case githubApprovalIssue != "":
+				return runGitHubApproval()
+			case len(releaseApprove) > 0:
+				return runRelease(approvedBy(releaseApprove, releaseApprover), nil)
+			case len(releaseReject) > 0:
+				rejected, err := autopkg.RejectQuarantined(stateDir, approvedBy(releaseReject, releaseApprover))
+				if err != nil {
+					return configError(err)
+				}
+				setResult(rejected)
+				return nil
+			default:
+				return listQuarantine()
+			}
+		},
+	}
+
+	releaseCmd.Flags().StringSliceVar(&releaseApprove, "approve", []string{}, "Upload these quarantined builds, as App==version")
+	releaseCmd.Flags().StringSliceVar(&releaseReject, "reject", []string{}, "Drop these quarantined builds without uploading them, as App==version")
+	releaseCmd.Flags().StringVar(&releaseApprover, "approver", os.Getenv("USER"), "Who approved or rejected the builds, recorded in the quarantine manifest")
+	releaseCmd.Flags().StringVar(&githubApprovalIssue, "github-approval", "", "Ask for approval of the pending builds on a GitHub issue or pull request, as owner/name#number, and release those approved with /approve comments")
+	releaseCmd.Flags().StringSliceVar(&githubApprovers, "approvers", []string{}, "GitHub logins allowed to approve with --github-approval (defaults to the repository's owners, members and collaborators)")
+	releaseCmd.Flags().StringVar(&approvalEventPath, "approval-event", "", "Decide from the comment of this issue_comment event file, e.g. $GITHUB_EVENT_PATH, instead of asking and polling")
+	releaseCmd.Flags().DurationVar(&approvalTimeout, "approval-timeout", 0, "Wait up to this long for /approve comments after asking; 0 asks and exits")
+	releaseCmd.Flags().DurationVar(&approvalPoll, "approval-poll", autopkg.DefaultApprovalPollInterval, "How often to check for /approve comments while waiting")
+	releaseCmd.Flags().BoolVar(&confirmProd, "confirm-prod", false, "Confirm uploading to production-flagged preferences outside a CI environment")
+	releaseCmd.Flags().StringVar(&reportPath, "report", "", "Path to save the report")
+	releaseCmd.Flags().IntVar(&verboseLevel, "verbose", 2, "autopkg run verbosity level (0-3)")
+	releaseCmd.Flags().BoolVar(&verifyTrust, "verify-trust", true, "Verify trust info before running upload recipes")
+	releaseCmd.Flags().BoolVar(&updateTrustOnFailure, "update-trust", true, "Update trust info if verification fails")
+	releaseCmd.Flags().StringSliceVar(&searchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	releaseCmd.Flags().StringSliceVar(&overrideDirs, "override-dir", []string{}, "Additional recipe override directories")
+	releaseCmd.Flags().StringVar(&recipeOverridesPath, "recipe-overrides", "", "Path to a YAML file mapping recipes to their own prefs path, variables, verbosity and processors")
+	releaseCmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Don't sign in to Jamf Pro and Intune before uploading to check the credentials and permissions")
+	releaseCmd.Flags().BoolVar(&lockWait, "wait", false, "Wait for another run or cleanup on the same preferences to finish instead of failing")
+	releaseCmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 0, "Wait up to this long for another run or cleanup on the same preferences to finish")
+
+	return releaseCmd
+}
+
+// runRelease uploads the approved quarantined builds, reporting the outcome
+// on the issue approval was asked for on, if any
+func runRelease(approvals map[string]string, approval *autopkg.GitHubApproval) error {
+	if err := autopkg.ConfirmProductionRun(prefsPath, confirmProd, os.Stdin, os.Stdout); err != nil {
+		logger.Logger(fmt.Sprintf("🛑 %v", err), logger.LogError)
+		return configError(err)
+	}
+
+	options, err := newRecipeBatchOptions()
+	if err != nil {
+		return configError(err)
+	}
+
+	lock, err := acquireRunLock(prefsPath, "release")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	results, err := autopkg.ReleaseQuarantined(approvals, options)
+	options.Tracer.Shutdown()
+	if results == nil && err != nil {
+		return configError(err)
+	}
+
+	if approval != nil {
+		reportGitHubRelease(approval, options.RunID, approvals)
+	}
+
+	summary := newRunResult(options.RunID, reportPath, results)
+	setResult(summary)
+	if code := summary.exitCode(); code != exitSuccess {
+		return withExitCode(code, fmt.Errorf("%d quarantined builds failed to upload", summary.Failed))
+	}
+	if err != nil {
+		return withExitCode(exitRecipeFailure, err)
+	}
+	return nil
+}
+
+// runGitHubApproval asks for approval of the pending builds on a GitHub issue,
+// or reads the comment of an event, and releases or rejects the builds decided
+func runGitHubApproval() error {
+	repo, issue, err := autopkg.ParseGitHubIssueRef(githubApprovalIssue)
+	if err != nil {
+		return configError(err)
+	}
+	approval := &autopkg.GitHubApproval{Repo: repo, Issue: issue, Approvers: githubApprovers, PollInterval: approvalPoll}
+
+	manifest, err := autopkg.LoadQuarantine(stateDir)
+	if err != nil {
+		return withExitCode(exitError, err)
+	}
+	pending := manifest.Pending()
+	if len(pending) == 0 {
+		logger.Logger("ℹ️ Nothing in quarantine to approve", logger.LogInfo)
+		return nil
+	}
+
+	var decisions *autopkg.ApprovalDecisions
+	if approvalEventPath != "" {
+		decisions, err = approval.DecideFromEvent(approvalEventPath, pending)
+	} else {
+		if err := approval.RequestApproval(manifest, pending); err != nil {
+			return withExitCode(exitError, err)
+		}
+		if approvalTimeout <= 0 {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), approvalTimeout)
+		defer cancel()
+		decisions, err = approval.WaitForApproval(ctx, pending)
+	}
+	if err != nil {
+		return withExitCode(exitError, err)
+	}
+	setResult(decisions)
+
+	if len(decisions.Rejected) > 0 {
+		if _, err := autopkg.RejectQuarantined(stateDir, decisions.Rejected); err != nil {
+			return withExitCode(exitError, err)
+		}
+	}
+	if len(decisions.Approved) == 0 {
+		logger.Logger(fmt.Sprintf("ℹ️ No builds approved on %s", githubApprovalIssue), logger.LogInfo)
+		return nil
+	}
+	return runRelease(decisions.Approved, approval)
+}
+
+// reportGitHubRelease comments on the approval issue which of the approved
+// builds were uploaded by the release run
+func reportGitHubRelease(approval *autopkg.GitHubApproval, runID string, approvals map[string]string) {
+	manifest, err := autopkg.LoadQuarantine(stateDir)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ %v", err), logger.LogWarning)
+		return
+	}
+
+	var released, failed []string
+	for _, entry := range manifest.Entries {
+		if _, approved := approvals[entry.ID]; !approved {
+			continue
+		}
+		if entry.Status == autopkg.QuarantineReleased && entry.ReleaseRunID == runID {
+			released = append(released, entry.ID)
+		} else if entry.Status == autopkg.QuarantinePending {
+			failed = append(failed, entry.ID)
+		}
+	}
+	if err := approval.ReportRelease(runID, released, failed); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to report the release on %s#%d: %v", approval.Repo, approval.Issue, err), logger.LogWarning)
+	}
+}
+
+// approvedBy maps builds named on the command line to who decided on them
+func approvedBy(ids []string, decider string) map[string]string {
+	decisions := make(map[string]string, len(ids))
+	for _, id := range ids {
+		decisions[id] = decider
+	}
+	return decisions
+}
+
+// listQuarantine prints the builds awaiting approval
+func listQuarantine() error {
+	manifest, err := autopkg.LoadQuarantine(stateDir)
+	if err != nil {
+		return withExitCode(exitError, err)
+	}
+
+	pending := manifest.Pending()
+	setResult(pending)
+	if structuredOutput() {
+		return nil
+	}
+	if len(pending) == 0 {
+		fmt.Println("Nothing in quarantine")
+		return nil
+	}
+	for _, entry := range pending {
+		fmt.Printf("🧪 %-32s %-28s staged %s by run %s\n", entry.ID, entry.Recipe, entry.StagedAt.Local().Format(time.RFC822), entry.RunID)
+	}
+	return nil
+}
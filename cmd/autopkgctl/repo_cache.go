@@ -0,0 +1,63 @@
+// cmd/autopkgctl/repo_cache.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Repo-cache command flags
+	repoCacheIncludeDownloads bool
+)
+
+// newRepoCacheCmd creates the repo-cache command group
+func newRepoCacheCmd() *cobra.Command {
+	repoCacheCmd := &cobra.Command{
+		Use:   "repo-cache",
+		Short: "Export or import a pre-warmed recipe repo cache",
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export [archive.tar.zst]",
+		Short: "Package RECIPE_REPO_DIR into a compressed archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := autopkg.ExportRepoCache(args[0], &autopkg.RepoCacheOptions{
+				PrefsPath:        prefsPath,
+				IncludeDownloads: repoCacheIncludeDownloads,
+			}); err != nil {
+				fmt.Printf("❌ Failed to export repo cache: %v\n", err)
+				return err
+			}
+			fmt.Printf("✅ Repo cache exported to %s\n", args[0])
+			return nil
+		},
+	}
+
+	importCmd := &cobra.Command{
+		Use:   "import [archive.tar.zst]",
+		Short: "Restore recipe repos from a compressed archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := autopkg.ImportRepoCache(args[0], &autopkg.RepoCacheOptions{
+				PrefsPath:        prefsPath,
+				IncludeDownloads: repoCacheIncludeDownloads,
+			}); err != nil {
+				fmt.Printf("❌ Failed to import repo cache: %v\n", err)
+				return err
+			}
+			fmt.Printf("✅ Repo cache imported from %s\n", args[0])
+			return nil
+		},
+	}
+
+	repoCacheCmd.PersistentFlags().BoolVar(&repoCacheIncludeDownloads, "include-downloads", false, "Include the AutoPkg downloads cache")
+
+	repoCacheCmd.AddCommand(exportCmd)
+	repoCacheCmd.AddCommand(importCmd)
+
+	return repoCacheCmd
+}
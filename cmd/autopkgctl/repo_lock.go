@@ -0,0 +1,62 @@
+// cmd/autopkgctl/repo_lock.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Repo-freeze / repo-restore command flags
+	repoLockfilePath string
+)
+
+// newRepoFreezeCmd creates the repo-freeze command
+func newRepoFreezeCmd() *cobra.Command {
+	repoFreezeCmd := &cobra.Command{
+		Use:   "repo-freeze",
+		Short: "Write a lockfile of all recipe repos and their commit SHAs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lock, err := autopkg.FreezeRepos(prefsPath)
+			if err != nil {
+				fmt.Printf("❌ Failed to freeze repositories: %v\n", err)
+				return err
+			}
+			setResult(lock)
+			return autopkg.WriteRepoLockfile(repoLockfilePath, lock)
+		},
+	}
+
+	repoFreezeCmd.Flags().StringVar(&repoLockfilePath, "lockfile", autopkg.DefaultRepoLockfile, "Path to write the repo lockfile")
+
+	return repoFreezeCmd
+}
+
+// newRepoRestoreCmd creates the repo-restore command
+func newRepoRestoreCmd() *cobra.Command {
+	repoRestoreCmd := &cobra.Command{
+		Use:   "repo-restore",
+		Short: "Clone or reset every recipe repo to the commit in the lockfile",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lock, err := autopkg.ReadRepoLockfile(repoLockfilePath)
+			if err != nil {
+				return configError(err)
+			}
+			setResult(lock)
+
+			if err := autopkg.RestoreRepos(lock, prefsPath); err != nil {
+				fmt.Printf("❌ Failed to restore repositories: %v\n", err)
+				return err
+			}
+
+			fmt.Printf("✅ Restored %d repositories from %s\n", len(lock.Repos), repoLockfilePath)
+			return nil
+		},
+	}
+
+	repoRestoreCmd.Flags().StringVar(&repoLockfilePath, "lockfile", autopkg.DefaultRepoLockfile, "Path to the repo lockfile")
+
+	return repoRestoreCmd
+}
@@ -0,0 +1,176 @@
+// cmd/autopkgctl/results.go
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+)
+
+// setupResult is the result document of the setup command
+type setupResult struct {
+	AutoPkgVersion   string                              `json:"autopkg_version"`
+	AutoPkgBinDir    string                              `json:"autopkg_bin_dir,omitempty"`    // PATH entry of a user-space install
+	NeedNewerAutoPkg []autopkg.AutoPkgVersionRequirement `json:"need_newer_autopkg,omitempty"` // Recipes declaring a MinimumVersion above the installed one
+	ProcessorRepos   []string                            `json:"processor_repos,omitempty"`
+}
+
+// configureResult is the result document of the configure command
+type configureResult struct {
+	PrefsPath    string                      `json:"prefs_path"`
+	Integrations []autopkg.IntegrationStatus `json:"integrations,omitempty"`
+}
+
+// repoResult is the outcome of adding a single recipe repository
+type repoResult struct {
+	Repo     string `json:"repo"`
+	Path     string `json:"path,omitempty"`
+	Existing bool   `json:"existing,omitempty"`
+	Fallback bool   `json:"fallback,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// recipeDepsResult lists the repositories a recipe depends on
+type recipeDepsResult struct {
+	Recipe       string   `json:"recipe"`
+	Repositories []string `json:"repositories"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// verifyTrustResult is the result document of the verify-trust command
+type verifyTrustResult struct {
+	Recipes       []string `json:"recipes"`
+	FailedRecipes []string `json:"failed_recipes,omitempty"`
+	TrustUpdated  bool     `json:"trust_updated"`
+}
+
+// overrideResult is the outcome of generating a single override
+type overrideResult struct {
+	Recipe  string   `json:"recipe"`
+	Path    string   `json:"path,omitempty"`
+	Created bool     `json:"created"`
+	Input   []string `json:"input,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// sbomResult is the outcome of generating the SBOM of a single artifact
+type sbomResult struct {
+	Artifact string `json:"artifact"`
+	SBOM     string `json:"sbom,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// runResult is the result document of a batch run
+type runResult struct {
+	RunID       string            `json:"run_id,omitempty"`
+	Succeeded   int               `json:"succeeded"`
+	Failed      int               `json:"failed"`
+	TrustFailed int               `json:"trust_failed"`
+	Blocked     int               `json:"blocked"`
+	Updated     int               `json:"updated"`
+	Report      string            `json:"report,omitempty"`
+	Recipes     []runRecipeResult `json:"recipes"`
+}
+
+// runRecipeResult is the outcome of a single recipe in a batch run
+type runRecipeResult struct {
+	Recipe       string                     `json:"recipe"`
+	Status       string                     `json:"status"`
+	Duration     time.Duration              `json:"duration_ns"`
+	SkipReason   string                     `json:"skip_reason,omitempty"`
+	BlockReason  string                     `json:"block_reason,omitempty"`
+	Error        string                     `json:"error,omitempty"`
+	TrustError   string                     `json:"trust_error,omitempty"`
+	FailureKind  string                     `json:"failure_kind,omitempty"`
+	Attempts     int                        `json:"attempts,omitempty"`
+	Artifacts    []autopkg.ProducedArtifact `json:"artifacts,omitempty"`
+	Notarization []notarization.Result      `json:"notarization,omitempty"`
+	Uploads      []autopkg.UploadedArtifact `json:"uploads,omitempty"`
+	Targets      []runTargetResult          `json:"targets,omitempty"`
+	LogPath      string                     `json:"log_path,omitempty"`
+}
+
+// runTargetResult is the outcome of an upload recipe on a single target
+type runTargetResult struct {
+	Target      string                     `json:"target"`
+	Status      string                     `json:"status"`
+	Duration    time.Duration              `json:"duration_ns"`
+	Error       string                     `json:"error,omitempty"`
+	FailureKind string                     `json:"failure_kind,omitempty"`
+	Uploads     []autopkg.UploadedArtifact `json:"uploads,omitempty"`
+}
+
+// newRunResult summarises batch results, counting recipes skipped for failed
+// trust verification apart from recipes that failed to run
+func newRunResult(runID string, report string, results map[string]*autopkg.RecipeBatchResult) *runResult {
+	summary := &runResult{RunID: runID, Report: report, Recipes: []runRecipeResult{}}
+
+	recipes := make([]string, 0, len(results))
+	for recipe := range results {
+		recipes = append(recipes, recipe)
+	}
+	sort.Strings(recipes)
+
+	for _, recipe := range recipes {
+		result := results[recipe]
+		entry := runRecipeResult{
+			Recipe:       recipe,
+			Status:       result.Status,
+			Duration:     result.ExecutionTime,
+			SkipReason:   result.SkipReason,
+			Error:        errorString(result.ExecutionError),
+			TrustError:   errorString(result.VerificationError),
+			FailureKind:  result.FailureKind,
+			Attempts:     result.Attempts,
+			Artifacts:    result.Artifacts,
+			Notarization: result.Notarization,
+			Uploads:      result.Uploads,
+			LogPath:      result.LogPath,
+		}
+		if result.Status == autopkg.StatusBlocked {
+			entry.BlockReason = result.Output
+		}
+		for _, target := range result.Targets {
+			entry.Targets = append(entry.Targets, runTargetResult{
+				Target:      target.Target,
+				Status:      target.Status,
+				Duration:    target.ExecutionTime,
+				Error:       errorString(target.ExecutionError),
+				FailureKind: target.FailureKind,
+				Uploads:     target.Uploads,
+			})
+		}
+		summary.Recipes = append(summary.Recipes, entry)
+
+		switch {
+		case result.ExecutionError != nil:
+			summary.Failed++
+		case result.SkipReason == autopkg.SkipReasonTrustFailed:
+			summary.TrustFailed++
+		case result.Status == autopkg.StatusBlocked:
+			summary.Blocked++
+		case result.Status != "skipped":
+			summary.Succeeded++
+		}
+		if result.Status == "updated" {
+			summary.Updated++
+		}
+	}
+
+	return summary
+}
+
+// exitCode returns the exit code for the batch
+func (r *runResult) exitCode() int {
+	return recipeBatchExitCode(r.Succeeded, r.Failed, r.TrustFailed)
+}
+
+// errorString returns an error's message, or an empty string for nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
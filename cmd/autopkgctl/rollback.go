@@ -0,0 +1,111 @@
+// cmd/autopkgctl/rollback.go
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Rollback command flags
+	rollbackTenant    string
+	rollbackToVersion string
+	rollbackDryRun    bool
+)
+
+// newRollbackCmd creates the rollback command for re-deploying the previous version of an app
+func newRollbackCmd() *cobra.Command {
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback <app>",
+		Short: "Re-point the Jamf Pro policy or Intune app of an app at its previous version",
+		Long: `Every upload to Jamf Pro or Intune is recorded in the run history with the
+package and policy it deployed. rollback finds the version of the app deployed
+to a tenant before the current one, and points the Jamf Pro policy
+JamfPolicyUploader deployed it with back at that version's package, or commits
+the Intune app's earlier content version.
+
+--tenant names a target in --targets, or a profile; without it the tenant
+configured in --prefs is rolled back:
+
+  autopkgctl rollback Firefox --tenant prod --targets targets.yaml
+  autopkgctl rollback Firefox --tenant prod --to-version 127.0.2 --dry-run
+
+Rolling back again goes a further version back. The next run of the upload
+recipe deploys the newer version again unless it's left out of the batch.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := rollbackPrefsPath()
+			if err != nil {
+				return configError(err)
+			}
+
+			// Re-pointing policies changes the tenant just as an upload does
+			if !rollbackDryRun {
+				if err := autopkg.ConfirmProductionRun(path, confirmProd, os.Stdin, os.Stdout); err != nil {
+					logger.Logger(fmt.Sprintf("🛑 %v", err), logger.LogError)
+					return configError(err)
+				}
+			}
+
+			plans, err := autopkg.Rollback(&autopkg.RollbackOptions{
+				App:         args[0],
+				PrefsPath:   path,
+				StateDir:    stateDir,
+				HistoryPath: historyPath,
+				ToVersion:   rollbackToVersion,
+				DryRun:      rollbackDryRun,
+			})
+			setResult(plans)
+			if err != nil {
+				if plans == nil {
+					return configError(err)
+				}
+				return withExitCode(exitError, err)
+			}
+
+			if !structuredOutput() {
+				for _, plan := range plans {
+					verb := "Rolled back"
+					if rollbackDryRun {
+						verb = "Would roll back"
+					}
+					fmt.Printf("⏪ %s %s on %s from %s to %s (deployed: %s)\n", verb, plan.App, plan.Tenant, plan.From.Version, plan.To.Version, plan.Deployed)
+				}
+			}
+			return nil
+		},
+	}
+
+	rollbackCmd.Flags().StringVar(&rollbackTenant, "tenant", "", "Target in --targets, or profile, whose tenant to roll back (defaults to the tenant in --prefs)")
+	rollbackCmd.Flags().StringVar(&targetsPath, "targets", "", "Path to the YAML file of MDM tenants --tenant names a target of")
+	rollbackCmd.Flags().StringVar(&rollbackToVersion, "to-version", "", "Version to roll back to (defaults to the version deployed before the current one)")
+	rollbackCmd.Flags().BoolVar(&rollbackDryRun, "dry-run", false, "Show what would be rolled back without changing the MDM")
+	rollbackCmd.Flags().BoolVar(&confirmProd, "confirm-prod", false, "Confirm rolling back a tenant of production-flagged preferences outside a CI environment")
+	rollbackCmd.Flags().StringVar(&historyPath, "history", "", "Path to the run history database (defaults to history.db in the state directory)")
+
+	return rollbackCmd
+}
+
+// rollbackPrefsPath resolves --tenant to the preferences of a target or profile
+func rollbackPrefsPath() (string, error) {
+	switch {
+	case rollbackTenant == "":
+		return prefsPath, nil
+	case targetsPath != "":
+		targets, err := autopkg.LoadTargetSet(targetsPath)
+		if err != nil {
+			return "", err
+		}
+		return targets.TargetPrefsPath(rollbackTenant, stateDir)
+	default:
+		profile, err := autopkg.LoadProfile(stateDir, rollbackTenant)
+		if err != nil {
+			return "", fmt.Errorf("%w, or name a target with --targets", err)
+		}
+		return profile.PrefsPath, nil
+	}
+}
@@ -0,0 +1,58 @@
+// cmd/autopkgctl/sandbox.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Sandbox flags
+	sandboxMode bool
+	sandboxDir  string
+)
+
+// enterSandbox points the command at the bundled sandbox environment: its own
+// preferences and state, the fake recipe repo and notifications written to a
+// local file, so nothing real is touched and no credentials are needed
+func enterSandbox(cmd *cobra.Command) error {
+	sandbox, err := autopkg.PrepareSandbox(sandboxDir)
+	if err != nil {
+		return err
+	}
+
+	if prefsPath != "" && prefsPath != sandbox.PrefsPath {
+		logger.Logger(fmt.Sprintf("⚠️ Ignoring --prefs %s in sandbox mode", prefsPath), logger.LogWarning)
+	}
+	prefsPath = sandbox.PrefsPath
+	stateDir = sandbox.StateDir
+
+	if cmd.Name() == "run" || cmd.Name() == "tui" {
+		if recipePath == "" && recipesPath == "" && recipesListPath == "" && os.Getenv("RUN_RECIPE") == "" {
+			recipesPath = strings.Join(sandbox.Recipes, ",")
+		}
+		if !cmd.Flags().Changed("report") {
+			reportPath = sandbox.ReportPath
+		}
+		if !cmd.Flags().Changed("notify-slack") {
+			slackWebhook = sandbox.NotificationsURL()
+		}
+		// Per-recipe notifications are only sent up to verbosity 1
+		if !cmd.Flags().Changed("verbose") {
+			verboseLevel = 1
+		}
+		// The sandbox recipes are run directly rather than through overrides, so there is no trust info to verify
+		if !cmd.Flags().Changed("verify-trust") {
+			verifyTrust = false
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("🧪 Sandbox mode: preferences %s, state %s", prefsPath, stateDir), logger.LogInfo)
+	logger.Logger(fmt.Sprintf("🧪 Notifications go to %s, uploads to %s", sandbox.NotificationsPath, sandbox.UploadsPath), logger.LogInfo)
+	return nil
+}
@@ -0,0 +1,61 @@
+// cmd/autopkgctl/sbom.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/sbom"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// SBOM command flags
+	sbomFormat    string
+	sbomOutputDir string
+	sbomName      string
+	sbomVersion   string
+)
+
+// newSBOMCmd creates the sbom command that inspects packages and disk images
+func newSBOMCmd() *cobra.Command {
+	sbomCmd := &cobra.Command{
+		Use:   "sbom <artifact>...",
+		Short: "Generate a software bill of materials for packages and disk images",
+		Long:  "Inspect .pkg, .dmg or .app payloads for app bundles, embedded frameworks and command line binaries and write a CycloneDX or SPDX JSON SBOM per artifact",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options := &sbom.Options{
+				Format:    sbomFormat,
+				OutputDir: sbomOutputDir,
+				Name:      sbomName,
+				Version:   sbomVersion,
+			}
+
+			var failed int
+			results := make([]sbomResult, 0, len(args))
+			for _, artifactPath := range args {
+				sbomPath, err := sbom.Generate(artifactPath, options)
+				results = append(results, sbomResult{Artifact: artifactPath, SBOM: sbomPath, Error: errorString(err)})
+				if err != nil {
+					fmt.Printf("❌ %s: %v\n", artifactPath, err)
+					failed++
+					continue
+				}
+				fmt.Printf("✅ %s\n", sbomPath)
+			}
+			setResult(results)
+
+			if failed > 0 {
+				return fmt.Errorf("failed to generate %d of %d SBOMs", failed, len(args))
+			}
+			return nil
+		},
+	}
+
+	sbomCmd.Flags().StringVar(&sbomFormat, "format", sbom.FormatCycloneDX, "SBOM format: cyclonedx or spdx")
+	sbomCmd.Flags().StringVar(&sbomOutputDir, "output-dir", "", "Directory to write SBOM files to (defaults to next to each artifact)")
+	sbomCmd.Flags().StringVar(&sbomName, "name", "", "Name of the top level component (defaults to the artifact file name)")
+	sbomCmd.Flags().StringVar(&sbomVersion, "version", "", "Version of the top level component")
+
+	return sbomCmd
+}
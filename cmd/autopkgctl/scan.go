@@ -0,0 +1,131 @@
+// cmd/autopkgctl/scan.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	securityscan "github.com/deploymenttheory/macos-autopkg-factory/tools/security_scan"
+	virustotal "github.com/deploymenttheory/macos-autopkg-factory/tools/virus_total"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Scan command flags
+	scanPath              string
+	scanSuspiciousPackage bool
+	scanVirusTotal        bool
+	scanVTAPIKey          string
+	scanVTSubmit          bool
+	scanVTCache           string
+	scanVTCacheTTL        time.Duration
+	scanMalwareBazaar     bool
+	scanMBAuthKey         string
+	scanCodesign          bool
+	scanScripts           bool
+	scanFailOn            string
+)
+
+// newScanCmd creates the scan command running the security checks outside of batch runs
+func newScanCmd() *cobra.Command {
+	scanCmd := &cobra.Command{
+		Use:   "scan --path <pkg_or_dir>",
+		Short: "Run the security checks on a package, disk image, app or directory",
+		Long: `Scan a package, disk image, app or directory and combine the findings of the
+security checks into one report, most severe first.
+
+Packages are scanned with Suspicious Package on macOS, which also lists their
+entitlements, launch items, extensions and privacy needs; the payload of
+anything else is inspected directly. --codesign checks signatures and
+notarization, --vt looks packages and disk images up on VirusTotal, reusing
+analyses cached by SHA256 in --vt-cache for --vt-cache-ttl,
+--malwarebazaar looks them up on abuse.ch MalwareBazaar as a second opinion,
+and --scripts matches install scripts against rules for what they shouldn't
+need to do, like disabling Gatekeeper or running downloaded code. In a
+directory, the packages, disk images and apps at its top level are checked
+with codesign, VirusTotal and MalwareBazaar.
+
+The command fails when a finding is at least as severe as --fail-on: info,
+low, medium, high or critical, or none to never fail.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if scanPath == "" {
+				return configError(fmt.Errorf("--path is required"))
+			}
+			if !securityscan.ValidSeverity(scanFailOn) {
+				return configError(fmt.Errorf("invalid --fail-on %q: use none, info, low, medium, high or critical", scanFailOn))
+			}
+
+			options := securityscan.Options{
+				SuspiciousPackage: scanSuspiciousPackage,
+				Codesign:          scanCodesign,
+				VirusTotal:        scanVirusTotal,
+				Scripts:           scanScripts,
+			}
+			if scanVirusTotal {
+				options.VirusTotalConfig = virustotal.DefaultConfig()
+				options.VirusTotalConfig.AutoSubmit = scanVTSubmit
+				options.VirusTotalConfig.CachePath = scanVTCache
+				options.VirusTotalConfig.CacheTTL = scanVTCacheTTL
+				if scanVTAPIKey != "" {
+					options.VirusTotalConfig.APIKey = scanVTAPIKey
+				}
+			}
+
+			if scanMalwareBazaar {
+				options.Reputation = append(options.Reputation, &securityscan.MalwareBazaar{AuthKey: scanMBAuthKey})
+			}
+
+			report, err := securityscan.Scan(scanPath, options)
+			if err != nil {
+				return configError(err)
+			}
+			setResult(report)
+
+			if !structuredOutput() {
+				printScanReport(report)
+			}
+
+			if report.Exceeds(scanFailOn) {
+				return withExitCode(exitError, fmt.Errorf("%s has %s findings", scanPath, report.Severity))
+			}
+			return nil
+		},
+	}
+
+	scanCmd.Flags().StringVar(&scanPath, "path", "", "Package, disk image, app or directory to scan")
+	scanCmd.Flags().BoolVar(&scanSuspiciousPackage, "suspicious-package", true, "Scan packages with Suspicious Package and inspect payloads")
+	scanCmd.Flags().BoolVar(&scanVirusTotal, "vt", false, "Look up packages and disk images on VirusTotal")
+	scanCmd.Flags().StringVar(&scanVTAPIKey, "vt-api-key", "", "VirusTotal API key (defaults to the tool's shared key)")
+	scanCmd.Flags().BoolVar(&scanVTSubmit, "vt-submit", false, "Submit files VirusTotal doesn't know for analysis")
+	scanCmd.Flags().StringVar(&scanVTCache, "vt-cache", virustotal.DefaultCachePath(), "JSON file VirusTotal analyses are cached in by SHA256; empty to always ask VirusTotal")
+	scanCmd.Flags().DurationVar(&scanVTCacheTTL, "vt-cache-ttl", virustotal.DefaultCacheTTL, "How long cached VirusTotal analyses are used before asking again")
+	scanCmd.Flags().BoolVar(&scanMalwareBazaar, "malwarebazaar", false, "Look up packages and disk images on abuse.ch MalwareBazaar")
+	scanCmd.Flags().StringVar(&scanMBAuthKey, "malwarebazaar-auth-key", os.Getenv("MALWAREBAZAAR_AUTH_KEY"), "abuse.ch Auth-Key for MalwareBazaar (defaults to $MALWAREBAZAAR_AUTH_KEY)")
+	scanCmd.Flags().BoolVar(&scanCodesign, "codesign", false, "Check signatures and notarization with stapler and spctl")
+	scanCmd.Flags().BoolVar(&scanScripts, "scripts", false, "Match install scripts against the script rules")
+	scanCmd.Flags().StringVar(&scanFailOn, "fail-on", securityscan.SeverityCritical, "Fail when a finding is at least this severe: none, info, low, medium, high or critical")
+	scanCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the report as JSON, shorthand for --output json")
+
+	return scanCmd
+}
+
+// printScanReport lists the findings of a scan and the checks that couldn't run
+func printScanReport(report *securityscan.Report) {
+	icons := map[string]string{
+		securityscan.SeverityCritical: "❌",
+		securityscan.SeverityHigh:     "❌",
+		securityscan.SeverityMedium:   "⚠️",
+		securityscan.SeverityLow:      "ℹ️",
+		securityscan.SeverityInfo:     "ℹ️",
+	}
+	for _, finding := range report.Findings {
+		fmt.Printf("%s %-8s %-18s %s\n", icons[finding.Severity], finding.Severity, finding.Check, finding.Message)
+	}
+	for _, scanError := range report.Errors {
+		fmt.Printf("⚠️ not checked: %s\n", scanError)
+	}
+	fmt.Printf("🛡️ %s: %d findings, highest severity %s (%s)\n", report.Path, len(report.Findings), report.Severity, strings.Join(report.Checks, ", "))
+}
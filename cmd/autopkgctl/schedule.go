@@ -0,0 +1,293 @@
+// cmd/autopkgctl/schedule.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/launchd"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/spf13/cobra"
+)
+
+// defaultScheduleLabel is the launchd label of the scheduled job
+const defaultScheduleLabel = "com.github.autopkgctl.schedule"
+
+var (
+	// Schedule command flags
+	scheduleLabel    string
+	scheduleInterval time.Duration
+	scheduleAt       []string
+	scheduleWorkflow string
+	scheduleEnv      []string
+)
+
+// scheduleResult is the result document of the schedule commands
+type scheduleResult struct {
+	Label     string             `json:"label"`
+	Path      string             `json:"path"`
+	Installed bool               `json:"installed"`
+	Command   []string           `json:"command,omitempty"`
+	Interval  string             `json:"interval,omitempty"`
+	At        []string           `json:"at,omitempty"`
+	LogPath   string             `json:"log_path,omitempty"`
+	Launchd   *launchd.Status    `json:"launchd,omitempty"`
+	LastRun   *autopkg.RunRecord `json:"last_run,omitempty"`
+}
+
+// newScheduleCmd creates the schedule command group managing a LaunchAgent that runs autopkgctl
+func newScheduleCmd() *cobra.Command {
+	scheduleCmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Run autopkgctl on a schedule with a launchd LaunchAgent",
+		Long: `Install, remove and inspect a LaunchAgent running autopkgctl as the current
+user, so dedicated Mac runners don't need hand-written launchd jobs.`,
+	}
+
+	installCmd := &cobra.Command{
+		Use:   "install [-- run flags]",
+		Short: "Write and load a LaunchAgent running the configured recipes or a workflow",
+		Long: `Write a LaunchAgent to ~/Library/LaunchAgents and load it, running
+autopkgctl run every --interval and/or every day --at a time of day. With
+--workflow it runs autopkgctl workflow run on that pipeline instead. Flags
+after -- are added to the command.
+
+The job runs with the current --prefs (or profile), --config, --state-dir,
+--locale and --log-level, in the current directory, with the current PATH so
+AutoPkg and git are found. Credentials the config references as ${NAME} need
+--env NAME, which copies the variable into the LaunchAgent; the property
+list is readable by anyone on the Mac, so prefer credentials in the AutoPkg
+preferences. Output goes to the schedule directory of the state directory.
+
+Installing again replaces the job of the same --label.`,
+		Example: `  autopkgctl schedule install --interval 6h
+  autopkgctl schedule install --at 03:00 --workflow configuration/pipeline.yaml
+  autopkgctl schedule install --at 03:00 --at 15:00 -- --notify-changes-only`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return installSchedule(args)
+		},
+	}
+
+	installCmd.Flags().DurationVar(&scheduleInterval, "interval", 0, "Run every interval, e.g. 6h")
+	installCmd.Flags().StringSliceVar(&scheduleAt, "at", []string{}, "Run every day at a time of day, HH:MM (can be specified multiple times)")
+	installCmd.Flags().StringVar(&scheduleWorkflow, "workflow", "", "Workflow pipeline to run with workflow run, instead of autopkgctl run")
+	installCmd.Flags().StringSliceVar(&scheduleEnv, "env", []string{}, "Environment variable to copy into the job, e.g. one the config references (can be specified multiple times)")
+
+	removeCmd := &cobra.Command{
+		Use:   "remove",
+		Short: "Unload and delete the LaunchAgent",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := launchd.UserAgentPath(scheduleLabel)
+			if err != nil {
+				return err
+			}
+			if err := launchd.Bootout(scheduleLabel); err != nil {
+				return err
+			}
+			removed := true
+			if err := os.Remove(path); os.IsNotExist(err) {
+				removed = false
+			} else if err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+
+			setResult(&scheduleResult{Label: scheduleLabel, Path: path})
+			if !structuredOutput() {
+				if removed {
+					logger.Logger(fmt.Sprintf("🗑️ Removed schedule %s", scheduleLabel), logger.LogSuccess)
+				} else {
+					logger.Logger(fmt.Sprintf("ℹ️ No schedule %s installed", scheduleLabel), logger.LogInfo)
+				}
+			}
+			return nil
+		},
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the schedule, whether launchd has it loaded and the latest run",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return scheduleStatus()
+		},
+	}
+
+	scheduleCmd.PersistentFlags().StringVar(&scheduleLabel, "label", defaultScheduleLabel, "launchd label of the job, to keep several schedules")
+
+	scheduleCmd.AddCommand(installCmd, removeCmd, statusCmd)
+	return scheduleCmd
+}
+
+// installSchedule writes the LaunchAgent and loads it
+func installSchedule(extraArgs []string) error {
+	if err := launchd.Available(); err != nil {
+		return configError(err)
+	}
+	if scheduleInterval == 0 && len(scheduleAt) == 0 {
+		return configError(fmt.Errorf("--interval or --at is required"))
+	}
+	if scheduleInterval != 0 && scheduleInterval < time.Minute {
+		return configError(fmt.Errorf("--interval must be at least a minute"))
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the autopkgctl executable: %w", err)
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	path, err := launchd.UserAgentPath(scheduleLabel)
+	if err != nil {
+		return err
+	}
+
+	dir := stateDir
+	if dir == "" {
+		dir = autopkg.DefaultStateDir()
+	}
+	logPath, err := filepath.Abs(filepath.Join(dir, "schedule", scheduleLabel+".log"))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return fmt.Errorf("failed to create schedule log directory: %w", err)
+	}
+
+	command := append([]string{executable}, forwardedGlobalArgs()...)
+	if scheduleWorkflow != "" {
+		workflow, err := filepath.Abs(scheduleWorkflow)
+		if err != nil {
+			return err
+		}
+		command = append(command, "workflow", "run", workflow)
+	} else {
+		command = append(command, "run")
+	}
+	command = append(command, extraArgs...)
+
+	job := &launchd.Job{
+		Label:                scheduleLabel,
+		ProgramArguments:     command,
+		WorkingDirectory:     workingDir,
+		EnvironmentVariables: map[string]string{"PATH": os.Getenv("PATH")},
+		StartInterval:        int(scheduleInterval.Seconds()),
+		StandardOutPath:      logPath,
+		StandardErrorPath:    logPath,
+		ProcessType:          "Background",
+	}
+	for _, at := range scheduleAt {
+		interval, err := launchd.ParseTimeOfDay(at)
+		if err != nil {
+			return configError(err)
+		}
+		job.StartCalendarInterval = append(job.StartCalendarInterval, interval)
+	}
+	for _, name := range scheduleEnv {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return configError(fmt.Errorf("environment variable %s for --env isn't set", name))
+		}
+		job.EnvironmentVariables[name] = value
+	}
+
+	if err := launchd.WriteJob(path, job); err != nil {
+		return err
+	}
+	if err := launchd.Bootstrap(path, scheduleLabel); err != nil {
+		return err
+	}
+
+	result := scheduleResultFor(path, job)
+	setResult(result)
+	if !structuredOutput() {
+		logger.Logger(fmt.Sprintf("✅ Installed schedule %s", scheduleLabel), logger.LogSuccess)
+		printSchedule(result)
+	}
+	return nil
+}
+
+// scheduleStatus shows the installed schedule and what launchd reports about it
+func scheduleStatus() error {
+	path, err := launchd.UserAgentPath(scheduleLabel)
+	if err != nil {
+		return err
+	}
+	job, err := launchd.ReadJob(path)
+	if os.IsNotExist(err) {
+		setResult(&scheduleResult{Label: scheduleLabel, Path: path})
+		if !structuredOutput() {
+			fmt.Printf("ℹ️ No schedule %s installed, add one with autopkgctl schedule install\n", scheduleLabel)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	result := scheduleResultFor(path, job)
+	if result.Launchd, err = launchd.Print(scheduleLabel); err != nil {
+		return err
+	}
+	if records, err := autopkg.ListRunRecords(stateDir, time.Time{}); err == nil && len(records) > 0 {
+		result.LastRun = records[0]
+	}
+
+	setResult(result)
+	if structuredOutput() {
+		return nil
+	}
+	printSchedule(result)
+	if result.Launchd.Loaded {
+		fmt.Printf("  launchd:  loaded in %s, %s, %d runs", result.Launchd.Domain, result.Launchd.State, result.Launchd.Runs)
+		if result.Launchd.LastExitCode != "" {
+			fmt.Printf(", last exit code %s", result.Launchd.LastExitCode)
+		}
+		fmt.Println()
+	} else {
+		fmt.Println("  launchd:  ⚠️ not loaded, reload it with autopkgctl schedule install")
+	}
+	if result.LastRun != nil {
+		fmt.Printf("  Last run: %s %s at %s\n", result.LastRun.RunID, result.LastRun.Status, result.LastRun.StartTime.Local().Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// scheduleResultFor describes an installed job
+func scheduleResultFor(path string, job *launchd.Job) *scheduleResult {
+	result := &scheduleResult{
+		Label:     job.Label,
+		Path:      path,
+		Installed: true,
+		Command:   job.ProgramArguments,
+		LogPath:   job.StandardOutPath,
+	}
+	if job.StartInterval > 0 {
+		result.Interval = (time.Duration(job.StartInterval) * time.Second).String()
+	}
+	for _, interval := range job.StartCalendarInterval {
+		result.At = append(result.At, interval.String())
+	}
+	return result
+}
+
+// printSchedule prints an installed schedule
+func printSchedule(result *scheduleResult) {
+	var when []string
+	if result.Interval != "" {
+		when = append(when, "every "+result.Interval)
+	}
+	if len(result.At) > 0 {
+		when = append(when, "daily at "+strings.Join(result.At, ", "))
+	}
+	fmt.Printf("🗓️ %s runs %s\n", result.Label, strings.Join(when, " and "))
+	fmt.Printf("  Command:  %s\n", strings.Join(result.Command, " "))
+	fmt.Printf("  Agent:    %s\n", result.Path)
+	fmt.Printf("  Log:      %s\n", result.LogPath)
+}
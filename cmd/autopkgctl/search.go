@@ -0,0 +1,73 @@
+// cmd/autopkgctl/search.go
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Search command flags
+	searchUser     string
+	searchUseToken bool
+	searchAddRepo  bool
+)
+
+// newSearchCmd creates the search command for finding recipes on GitHub
+func newSearchCmd() *cobra.Command {
+	searchCmd := &cobra.Command{
+		Use:   "search <term>...",
+		Short: "Search GitHub for recipes matching one or more terms",
+		Long:  "Search GitHub for recipes matching each term. Results are merged, and recipes matching more terms are listed first.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := autopkg.SearchRecipeResults(args, &autopkg.SearchOptions{
+				PrefsPath: prefsPath,
+				User:      searchUser,
+				UseToken:  searchUseToken,
+			})
+			if err != nil {
+				return err
+			}
+
+			setResult(results)
+			if !structuredOutput() {
+				printSearchResults(results)
+			}
+
+			if searchAddRepo && len(results) > 0 {
+				added, err := autopkg.OfferRepoAdd(results[0], prefsPath, os.Stdin, os.Stderr)
+				if err != nil {
+					return err
+				}
+				if added {
+					fmt.Fprintf(os.Stderr, "✅ Added %s\n", results[0].Repo)
+				}
+			}
+			return nil
+		},
+	}
+
+	searchCmd.Flags().StringVar(&searchUser, "user", "", "Only search recipe repos owned by this GitHub user or organisation")
+	searchCmd.Flags().BoolVar(&searchUseToken, "use-token", false, "Use the GitHub token to avoid search rate limits")
+	searchCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output results as JSON, shorthand for --output json")
+	searchCmd.Flags().BoolVar(&searchAddRepo, "add-repo", false, "Offer to add the repository of the top result")
+
+	return searchCmd
+}
+
+// printSearchResults prints search results as a table
+func printSearchResults(results []autopkg.RecipeSearchResult) {
+	if len(results) == 0 {
+		fmt.Println("ℹ️ No recipes found")
+		return
+	}
+
+	fmt.Printf("🔍 %d recipes found\n", len(results))
+	for _, result := range results {
+		fmt.Printf("  • %-45s %-30s %s\n", result.Name, result.Repo, result.Path)
+	}
+}
@@ -0,0 +1,125 @@
+// cmd/autopkgctl/serve.go
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/server"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Serve command flags
+	serveAddr        string
+	serveTokens      []string
+	serveTriggers    string
+	serveConcurrency int
+)
+
+// newServeCmd creates the serve command running autopkgctl as a daemon with an HTTP API
+func newServeCmd() *cobra.Command {
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run as a daemon with an HTTP API for triggering and following recipe runs",
+		Long: `Run as a long-lived daemon serving an HTTP API, so a portal or other
+automation can drive recipe runs on a dedicated Mac without SSH:
+
+  POST /api/v1/runs               start a run: {"recipes": [...]} or {"recipe_list": "..."},
+                                  with optional "args" and "priority" (low, normal or high)
+  GET  /api/v1/runs               runs started by the daemon
+  GET  /api/v1/runs/{id}          status of a run, with its run record once it finished
+  GET  /api/v1/runs/{id}/logs     its log, ?follow=true streams it until the run ends
+  GET  /api/v1/runs/{id}/report   its report plist
+  GET  /api/v1/queue              running runs, and queued runs in the order they start
+  GET  /api/v1/history            run records of every run, ?since=168h
+  GET  /api/v1/health             liveness, without a token
+  POST /api/v1/webhooks/{trigger} a webhook delivery, signed instead of using a token
+
+Every other request needs an Authorization: Bearer header with a token from
+--token or $AUTOPKGCTL_API_TOKENS. Each run is an autopkgctl run process with
+the daemon's preferences, --config and --state-dir, waiting for the run
+lock so runs on the same preferences go one after the other. Runs, logs and
+reports are kept in the serve directory of the state directory, and on the
+Mac autopkgctl logs -f <run-id> follows a run's recipe output.
+
+Runs are queued and started by priority, then oldest first, --concurrency at
+a time. Runs sharing a recipe go one after the other, in queue order. A run
+identical to one still queued, or a webhook delivery already received, isn't
+queued again; the existing run is returned instead, raised to the higher
+priority. See autopkgctl queue.
+
+--triggers maps webhooks to recipes, from a YAML list of triggers:
+
+  - name: overrides          # POST /api/v1/webhooks/overrides
+    source: github           # push events, signed with X-Hub-Signature-256
+    secret_env: OVERRIDES_WEBHOOK_SECRET
+    branches: [main]
+    paths: ["*.recipe", "*.recipe.yaml"]
+    changed_recipes: true    # run the overrides the push added or modified
+  - name: releases
+    source: release          # {"app": "Firefox", "version": "128.0"}, signed with X-AutoPkg-Signature
+    secret_env: RELEASE_WEBHOOK_SECRET
+    apps: [Firefox, "Google*"]
+    recipes: ["{app}.upload.jamf"]
+    priority: high           # ahead of the nightly batch`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var triggers []server.Trigger
+			if serveTriggers != "" {
+				var err error
+				if triggers, err = server.LoadTriggers(serveTriggers); err != nil {
+					return configError(err)
+				}
+			}
+
+			srv, err := server.New(&server.Config{
+				Addr:        serveAddr,
+				Tokens:      serveTokens,
+				StateDir:    stateDir,
+				GlobalArgs:  forwardedGlobalArgs(),
+				Concurrency: serveConcurrency,
+				Triggers:    triggers,
+			})
+			if err != nil {
+				return configError(err)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return srv.ListenAndServe(ctx)
+		},
+	}
+
+	serveCmd.Flags().StringVar(&serveAddr, "addr", server.DefaultAddr, "Address to listen on, host:port")
+	serveCmd.Flags().StringSliceVar(&serveTokens, "token", []string{}, "Bearer token accepted by the API (can be specified multiple times, or set $AUTOPKGCTL_API_TOKENS)")
+	serveCmd.Flags().StringVar(&serveTriggers, "triggers", "", "YAML file of webhook triggers mapping GitHub push and app release events to recipes")
+	serveCmd.Flags().IntVar(&serveConcurrency, "concurrency", server.DefaultConcurrency, "Runs to run at once, further runs wait in the queue")
+
+	return serveCmd
+}
+
+// forwardedGlobalArgs returns the global flags passed on to the autopkgctl
+// processes the daemon and scheduled jobs start. A profile is already
+// resolved to its preferences by now, and a discovered config is passed
+// explicitly.
+func forwardedGlobalArgs() []string {
+	var args []string
+	for _, flag := range [][2]string{
+		{"--prefs", prefsPath},
+		{"--config", findConfigFile()},
+		{"--state-dir", stateDir},
+		{"--locale", locale},
+		{"--log-level", logLevel},
+	} {
+		if flag[1] != "" {
+			args = append(args, flag[0], flag[1])
+		}
+	}
+	if offlineMode {
+		args = append(args, "--offline")
+	}
+	return args
+}
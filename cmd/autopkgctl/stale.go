@@ -0,0 +1,95 @@
+// cmd/autopkgctl/stale.go
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Stale command flags
+	staleDays int
+)
+
+// newStaleCmd creates the stale command for finding recipes that stopped producing new versions
+func newStaleCmd() *cobra.Command {
+	staleCmd := &cobra.Command{
+		Use:   "stale",
+		Short: "List recipes that still run but haven't produced a new version in --days",
+		Long: `List the recipes in the run history that ran within --days but haven't
+produced a new version in that time. A dead download URL or a broken version
+regex often "succeeds" with the version found long ago, which only shows as a
+recipe going quiet.
+
+Recipes with a version_url in --catalog are cross-referenced with the latest
+version their vendor lists; recipes behind it are listed first:
+
+  recipes:
+    - recipe: Firefox.pkg
+      version_url: https://product-details.mozilla.org/1.0/firefox_versions.json
+      version_pattern: '"LATEST_FIREFOX_VERSION":\s*"([\d.]+)"'`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if staleDays <= 0 {
+				return configError(fmt.Errorf("--days must be positive"))
+			}
+
+			options := autopkg.StaleOptions{Window: time.Duration(staleDays) * 24 * time.Hour}
+			if catalogPath != "" {
+				catalog, err := autopkg.LoadCatalog(catalogPath)
+				if err != nil {
+					return configError(err)
+				}
+				options.Catalog = catalog
+			}
+
+			path := historyPath
+			if path == "" {
+				path = autopkg.DefaultHistoryPath(stateDir)
+			}
+			history, err := autopkg.OpenHistory(path)
+			if err != nil {
+				return err
+			}
+			defer history.Close()
+
+			stale, err := autopkg.FindStaleRecipes(history, options)
+			if err != nil {
+				return err
+			}
+
+			setResult(stale)
+			if structuredOutput() {
+				return nil
+			}
+
+			if len(stale) == 0 {
+				fmt.Printf("✅ Every recipe that ran produced a new version in the last %d days\n", staleDays)
+				return nil
+			}
+
+			fmt.Printf("🕸️ %d recipes without a new version in %d days\n", len(stale), staleDays)
+			for _, recipe := range stale {
+				fmt.Printf("  • %-40s %-15s last updated %s (%d days), last run %s\n", recipe.Recipe, recipe.Version, recipe.LastUpdated.Local().Format("2006-01-02"), recipe.DaysSinceUpdate, recipe.LastStatus)
+				switch {
+				case recipe.Behind:
+					fmt.Printf("      ⚠️ vendor lists %s, check the recipe's download URL\n", recipe.VendorVersion)
+				case recipe.VendorVersion != "":
+					fmt.Printf("      vendor lists %s\n", recipe.VendorVersion)
+				case recipe.VendorError != "":
+					fmt.Printf("      vendor version unknown: %s\n", recipe.VendorError)
+				}
+			}
+			return nil
+		},
+	}
+
+	staleCmd.Flags().IntVar(&staleDays, "days", 180, "Recipes without a new version in this many days are stale")
+	staleCmd.Flags().StringVar(&catalogPath, "catalog", "", "Path to a recipe catalog YAML file whose version_url entries give vendors' latest versions")
+	staleCmd.Flags().StringVar(&historyPath, "history", "", "Path to the run history database (defaults to history.db in the state directory)")
+	staleCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output stale recipes as JSON, shorthand for --output json")
+
+	return staleCmd
+}
@@ -0,0 +1,101 @@
+// cmd/autopkgctl/trust_bootstrap.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Trust-bootstrap command flags
+	trustBootstrapSearchDirs   []string
+	trustBootstrapOverrideDirs []string
+	trustBootstrapSkipPull     bool
+	trustBootstrapConcurrency  int
+	trustBootstrapReportPath   string
+)
+
+// newTrustBootstrapCmd creates the trust-bootstrap command for preparing a new runner
+func newTrustBootstrapCmd() *cobra.Command {
+	trustBootstrapCmd := &cobra.Command{
+		Use:   "trust-bootstrap",
+		Short: "Pull the repos an overrides checkout needs and verify the trust of every override",
+		Long: `Prepare a fresh checkout of an overrides repo on a new runner. The repos
+the overrides' trust info says their parent recipes and processors come from
+are cloned, every override's trust is verified in parallel, and the overrides
+that failed, or can't be verified, are reported for review.
+
+Trust info is never updated: an override that fails may be pinned to a parent
+recipe that changed upstream, which needs a human to look at.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := autopkg.BootstrapTrust(&autopkg.TrustBootstrapOptions{
+				PrefsPath:    prefsPath,
+				SearchDirs:   trustBootstrapSearchDirs,
+				OverrideDirs: trustBootstrapOverrideDirs,
+				SkipPull:     trustBootstrapSkipPull,
+				Concurrency:  trustBootstrapConcurrency,
+			})
+			if err != nil {
+				return err
+			}
+
+			if trustBootstrapReportPath != "" {
+				if err := autopkg.WriteTrustBootstrapReport(trustBootstrapReportPath, report); err != nil {
+					return err
+				}
+			}
+
+			setResult(report)
+			if !structuredOutput() {
+				printTrustBootstrapReport(report)
+			}
+
+			if len(report.NeedsAttention) > 0 {
+				return withExitCode(exitTrustFailure, fmt.Errorf("%d of %d overrides need attention", len(report.NeedsAttention), report.Overrides))
+			}
+			return nil
+		},
+	}
+
+	trustBootstrapCmd.Flags().StringSliceVar(&trustBootstrapSearchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	trustBootstrapCmd.Flags().StringSliceVar(&trustBootstrapOverrideDirs, "override-dir", []string{}, "Override directories to bootstrap, defaults to RECIPE_OVERRIDE_DIRS")
+	trustBootstrapCmd.Flags().BoolVar(&trustBootstrapSkipPull, "skip-pull", false, "Don't clone missing parent repos, only report them")
+	trustBootstrapCmd.Flags().IntVar(&trustBootstrapConcurrency, "concurrency", autopkg.DefaultTrustBootstrapConcurrency, "Number of overrides to verify at once")
+	trustBootstrapCmd.Flags().StringVar(&trustBootstrapReportPath, "report", "", "Path to write the report to as JSON")
+	trustBootstrapCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the report as JSON, shorthand for --output json")
+
+	return trustBootstrapCmd
+}
+
+// printTrustBootstrapReport prints the repos pulled and the overrides needing attention
+func printTrustBootstrapReport(report *autopkg.TrustBootstrapReport) {
+	if len(report.Repos) > 0 {
+		fmt.Println("📦 Parent repos")
+		for _, repo := range report.Repos {
+			switch {
+			case repo.Error != "":
+				fmt.Printf("    ❌ %s: %s\n", repo.Repo, repo.Error)
+			case repo.Existing:
+				fmt.Printf("    ✅ %s (already present)\n", repo.Repo)
+			default:
+				fmt.Printf("    ✅ %s (cloned)\n", repo.Repo)
+			}
+		}
+		fmt.Println()
+	}
+
+	for _, issue := range report.NeedsAttention {
+		fmt.Printf("⚠️ %s (%s)\n", issue.Override, issue.Path)
+		for _, reason := range issue.Reasons {
+			fmt.Printf("    • %s\n", reason)
+		}
+	}
+
+	if len(report.NeedsAttention) == 0 {
+		fmt.Printf("✅ All %d overrides are trusted\n", report.Overrides)
+		return
+	}
+	fmt.Printf("\n❌ %d of %d overrides need attention\n", len(report.NeedsAttention), report.Overrides)
+}
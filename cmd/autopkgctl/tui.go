@@ -0,0 +1,100 @@
+// cmd/autopkgctl/tui.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/tui"
+	"github.com/spf13/cobra"
+)
+
+// newTUICmd creates the tui command for running recipes locally with a live status table
+func newTUICmd() *cobra.Command {
+	tuiCmd := &cobra.Command{
+		Use:   "tui [recipe...]",
+		Short: "Run recipes locally with a live status table",
+		Long: `Run recipes in an interactive terminal UI showing each recipe's status, elapsed
+time and current processor. Use up/down (or j/k) to select a recipe, c to cancel
+the selected running recipe, r to re-run failures once the batch is done and q to quit.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTUI(args)
+		},
+	}
+
+	tuiCmd.Flags().StringVar(&recipesPath, "recipes", "", "Comma-separated recipes, or a .txt or .json recipe list, to run when none are given as arguments")
+	tuiCmd.Flags().IntVar(&verboseLevel, "verbose", 2, "autopkg run verbosity level (1-3), processors are shown from 1")
+	tuiCmd.Flags().BoolVar(&verifyTrust, "verify-trust", true, "Verify trust info before running recipes")
+	tuiCmd.Flags().BoolVar(&updateTrustOnFailure, "update-trust", true, "Update trust info if verification fails")
+	tuiCmd.Flags().BoolVar(&noTrustCache, "no-trust-cache", false, "Verify trust for every recipe, even when its override and parent recipes are unchanged")
+	tuiCmd.Flags().StringSliceVar(&searchDirs, "search-dir", []string{}, "Additional recipe search directories")
+	tuiCmd.Flags().StringSliceVar(&overrideDirs, "override-dir", []string{}, "Additional recipe override directories")
+	tuiCmd.Flags().StringVar(&catalogPath, "catalog", "", "Path to a recipe catalog YAML file used to apply per-recipe feature flags")
+	tuiCmd.Flags().StringVar(&recipeOverridesPath, "recipe-overrides", "", "Path to a YAML file mapping recipes to their own prefs path, variables, verbosity and processors")
+	tuiCmd.Flags().BoolVar(&lockWait, "wait", false, "Wait for another run or cleanup on the same preferences to finish instead of failing")
+	tuiCmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 0, "Wait up to this long for another run or cleanup on the same preferences to finish")
+	addDownloadProxyFlags(tuiCmd)
+
+	return tuiCmd
+}
+
+// runTUI runs the selected recipes in the TUI and prints their final statuses
+func runTUI(args []string) error {
+	recipeInput := strings.Join(args, ",")
+	if recipeInput == "" {
+		recipeInput = recipesPath
+	}
+	if recipeInput == "" {
+		recipeInput = os.Getenv("RUN_RECIPE")
+	}
+	if recipeInput == "" {
+		return configError(fmt.Errorf("no recipes specified via arguments, --recipes or RUN_RECIPE"))
+	}
+
+	recipes, err := autopkg.ParseRecipeInput(recipeInput).Parse()
+	if err != nil {
+		return configError(fmt.Errorf("failed to parse recipes: %w", err))
+	}
+
+	// autopkg only names the processors it runs from verbosity 1
+	if verboseLevel < 1 {
+		verboseLevel = 1
+	}
+
+	options, err := newRecipeBatchOptions()
+	if err != nil {
+		return configError(err)
+	}
+
+	lock, err := acquireRunLock(prefsPath, "tui")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	results, err := tui.Run(&tui.Options{Recipes: recipes, Batch: options})
+	options.Tracer.Shutdown()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(results))
+	for recipe := range results {
+		names = append(names, recipe)
+	}
+	sort.Strings(names)
+
+	for _, recipe := range names {
+		fmt.Printf("%-10s %s\n", results[recipe].Status, recipe)
+	}
+
+	summary := newRunResult("", "", results)
+	setResult(summary)
+	if code := summary.exitCode(); code != exitSuccess {
+		return withExitCode(code, fmt.Errorf("%d recipes failed, %d failed trust verification", summary.Failed, summary.TrustFailed))
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// cmd/autopkgctl/workflow.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/munki"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Workflow run command flags
+	workflowResume     bool
+	workflowCheckpoint string
+)
+
+// unsafeFileNameChars matches the characters replaced in checkpoint file names
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// workflowResult is the result document of the workflow run command
+type workflowResult struct {
+	Workflow      string                            `json:"workflow"`
+	RunID         string                            `json:"run_id"`
+	Steps         []workflowStepResult              `json:"steps"`
+	Recipes       *runResult                        `json:"recipes,omitempty"`
+	Gatekeeper    []notarization.Result             `json:"gatekeeper,omitempty"`
+	SecurityScans []orchestrator.SecurityGateResult `json:"security_scans,omitempty"`
+	Munki         []munki.Result                    `json:"munki,omitempty"`
+}
+
+// workflowStepResult is the outcome of a single workflow step
+type workflowStepResult struct {
+	Name     string                `json:"name"`
+	Type     orchestrator.StepType `json:"type"`
+	Skipped  bool                  `json:"skipped,omitempty"`
+	Resumed  bool                  `json:"resumed,omitempty"`
+	Duration time.Duration         `json:"duration_ns"`
+	Error    string                `json:"error,omitempty"`
+}
+
+// newWorkflowCmd creates the workflow command group
+func newWorkflowCmd() *cobra.Command {
+	workflowCmd := &cobra.Command{
+		Use:   "workflow",
+		Short: "Run multi-step pipelines declared in YAML",
+	}
+
+	runCmd := &cobra.Command{
+		Use:   "run [pipeline.yaml]",
+		Short: "Run the steps of a YAML workflow in order",
+		Long: `Run a workflow declared in YAML: a name and a list of steps, each with a
+type (run-recipes, gatekeeper, security-gate, munki-repo, artifact-upload or a registered custom type), options,
+an optional condition such as "recipes_updated > 0" or
+"step:verify.success == true" and continue_on_error.
+Run recipes steps without prefs or state_dir use --prefs and --state-dir.
+
+Progress is checkpointed after every step and recipe. After a crash or
+failure, --resume picks the run up again: completed steps are skipped and
+recipes that already succeeded aren't run again.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, err := orchestrator.LoadWorkflow(args[0])
+			if err != nil {
+				return configError(err)
+			}
+			applyWorkflowDefaults(workflow)
+			if err := validateConfiguration(workflowPrefsPaths(workflow)...); err != nil {
+				return configError(err)
+			}
+			for _, path := range workflowPrefsPaths(workflow) {
+				if err := autopkg.ConfirmProductionRun(path, confirmProd, os.Stdin, os.Stdout); err != nil {
+					logger.Logger(fmt.Sprintf("🛑 %v", err), logger.LogError)
+					return configError(err)
+				}
+			}
+
+			// Each run recipes step locks its preferences for the whole workflow,
+			// taken in order so two workflows can't each hold what the other waits for
+			locked := workflowPrefsPaths(workflow)
+			sort.Strings(locked)
+			for _, path := range locked {
+				lock, err := acquireRunLock(path, "workflow run")
+				if err != nil {
+					return err
+				}
+				defer lock.Release()
+			}
+
+			checkpoint := workflowCheckpoint
+			if checkpoint == "" {
+				dir := stateDir
+				if dir == "" {
+					dir = autopkg.DefaultStateDir()
+				}
+				checkpoint = filepath.Join(dir, "workflows", unsafeFileNameChars.ReplaceAllString(workflow.Name, "_")+".checkpoint.json")
+			}
+			orchestrator.WithCheckpoint(checkpoint, workflowResume)(workflow)
+			if eventsPath != "" {
+				orchestrator.WithEventSinks(&autopkg.FileEventSink{Path: eventsPath})(workflow)
+			}
+			tracer, err := autopkg.NewTracer(autopkg.TracingOptions{Endpoint: otlpEndpoint, Headers: otlpHeaders})
+			if err != nil {
+				return configError(err)
+			}
+			orchestrator.WithTracer(tracer)(workflow)
+
+			ctx, err := workflow.Execute()
+			tracer.Shutdown()
+
+			result := &workflowResult{Workflow: workflow.Name, RunID: ctx.RunID, Steps: []workflowStepResult{}, Gatekeeper: ctx.Gatekeeper, SecurityScans: ctx.SecurityScans, Munki: ctx.Munki}
+			for _, step := range ctx.StepResults {
+				result.Steps = append(result.Steps, workflowStepResult{
+					Name:     step.Name,
+					Type:     step.Type,
+					Skipped:  step.Skipped,
+					Resumed:  step.Resumed,
+					Duration: step.Duration,
+					Error:    errorString(step.Error),
+				})
+			}
+			if len(ctx.RecipeResults) > 0 {
+				result.Recipes = newRunResult(ctx.RunID, "", ctx.RecipeResults)
+			}
+			setResult(result)
+
+			if !structuredOutput() {
+				printWorkflowResult(result)
+			}
+
+			if err == nil {
+				return nil
+			}
+			if result.Recipes != nil {
+				if code := result.Recipes.exitCode(); code != exitSuccess {
+					return withExitCode(code, err)
+				}
+			}
+			return withExitCode(exitError, err)
+		},
+	}
+
+	runCmd.Flags().BoolVar(&confirmProd, "confirm-prod", false, "Confirm running steps against production-flagged preferences outside a CI environment")
+	runCmd.Flags().BoolVar(&workflowResume, "resume", false, "Resume the last run of the workflow from its checkpoint, skipping completed steps and recipes")
+	runCmd.Flags().StringVar(&eventsPath, "events-file", "", "Path to append the events of the workflow and its recipe runs to as JSON lines")
+	runCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint to export OpenTelemetry spans of the workflow, its steps and recipe runs to, e.g. http://tempo:4318 (defaults to $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	runCmd.Flags().StringToStringVar(&otlpHeaders, "otlp-header", map[string]string{}, "Headers sent with exported spans, as key=value, on top of $OTEL_EXPORTER_OTLP_HEADERS")
+	runCmd.Flags().BoolVar(&lockWait, "wait", false, "Wait for other runs on the workflow's preferences to finish instead of failing")
+	runCmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 0, "Wait up to this long for other runs on the workflow's preferences to finish")
+	runCmd.Flags().StringVar(&workflowCheckpoint, "checkpoint", "", "Checkpoint file (defaults to workflows/<name>.checkpoint.json in the state directory)")
+
+	workflowCmd.AddCommand(runCmd)
+
+	return workflowCmd
+}
+
+// applyWorkflowDefaults fills in the global preferences and state directory
+// for run recipes steps that don't set their own
+func applyWorkflowDefaults(workflow *orchestrator.Workflow) {
+	for _, step := range workflow.Steps {
+		options, ok := step.Options.(*orchestrator.RunRecipesStepOptions)
+		if !ok || options.BatchOptions == nil {
+			continue
+		}
+		if options.BatchOptions.PrefsPath == "" {
+			options.BatchOptions.PrefsPath = prefsPath
+		}
+		if options.BatchOptions.StateDir == "" {
+			options.BatchOptions.StateDir = stateDir
+		}
+	}
+}
+
+// workflowPrefsPaths returns the preferences the run recipes steps of a workflow use, each once
+func workflowPrefsPaths(workflow *orchestrator.Workflow) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, step := range workflow.Steps {
+		if options, ok := step.Options.(*orchestrator.RunRecipesStepOptions); ok && options.BatchOptions != nil && !seen[options.BatchOptions.PrefsPath] {
+			seen[options.BatchOptions.PrefsPath] = true
+			paths = append(paths, options.BatchOptions.PrefsPath)
+		}
+	}
+	return paths
+}
+
+// printWorkflowResult prints the outcome of every workflow step
+func printWorkflowResult(result *workflowResult) {
+	fmt.Printf("\nWorkflow %s (run %s)\n", result.Workflow, result.RunID)
+	for _, step := range result.Steps {
+		switch {
+		case step.Resumed:
+			fmt.Printf("  ⏭️  %-24s completed in an earlier attempt\n", step.Name)
+		case step.Skipped:
+			fmt.Printf("  ⏭️  %-24s skipped\n", step.Name)
+		case step.Error != "":
+			fmt.Printf("  ❌ %-24s %s: %s\n", step.Name, step.Duration.Round(time.Millisecond), step.Error)
+		default:
+			fmt.Printf("  ✅ %-24s %s\n", step.Name, step.Duration.Round(time.Millisecond))
+		}
+	}
+
+	if len(result.Munki) > 0 {
+		fmt.Println("\nMunki imports")
+		for _, item := range result.Munki {
+			status := "✅"
+			if !item.Verified {
+				status = "❌"
+			}
+			line := fmt.Sprintf("  %s %s %s", status, item.Name, item.Version)
+			if len(item.AddedCatalogs) > 0 {
+				line += fmt.Sprintf(", added to %s", strings.Join(item.AddedCatalogs, ", "))
+			}
+			if len(item.Manifests) > 0 {
+				line += fmt.Sprintf(", in manifests %s", strings.Join(item.Manifests, ", "))
+			}
+			fmt.Println(line)
+			for _, problem := range item.Problems {
+				fmt.Printf("      %s\n", problem)
+			}
+		}
+	}
+}
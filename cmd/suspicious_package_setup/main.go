@@ -1,22 +1,41 @@
 package main
 
 import (
+	"flag"
 	"log"
 
 	sp "github.com/deploymenttheory/macos-autopkg-factory/tools/suspicious_package"
 )
 
 func main() {
+	// Parse command line arguments
+	version := flag.String("version", "", "Suspicious Package version to require, e.g. 4.5 (optional)")
+	downloadURL := flag.String("url", "", "Disk image to install from, needed to pin a version other than the latest (optional)")
+	checksum := flag.String("sha256", "", "Published SHA256 the downloaded disk image must match (optional)")
+	checksumURL := flag.String("sha256-url", "", "URL publishing the SHA256 of the disk image (optional)")
+	installDir := flag.String("install-dir", "", "Directory to install the app to, defaults to /Applications (optional)")
+	userSpace := flag.Bool("user", false, "Install to ~/Applications, for runners without sudo (optional)")
+	force := flag.Bool("force", true, "Reinstall even when Suspicious Package is already installed (optional)")
+	flag.Parse()
+
 	// Create a configuration object
 	config := &sp.Config{
-		ForceUpdate: true, // Or get this from environment variables
+		ForceUpdate: *force,
+		Version:     *version,
+		DownloadURL: *downloadURL,
+		SHA256:      *checksum,
+		SHA256URL:   *checksumURL,
+		InstallDir:  *installDir,
+		UserSpace:   *userSpace,
 	}
 
-	// Call SetupGitHubActionsRunner with the config and capture both return values
-	version, err := sp.InstallSuspiciousPackage(config)
+	installation, err := sp.SetupSuspiciousPackage(config)
 	if err != nil {
 		log.Fatalf("Failed to set up Suspicious Package: %v", err)
 	}
 
-	log.Printf("Successfully installed Suspicious Package version: %s", version)
+	log.Printf("Successfully installed Suspicious Package version: %s at %s", installation.Version, installation.AppPath)
+	if installation.CLIPath != "" {
+		log.Printf("Command line tool: %s", installation.CLIPath)
+	}
 }
@@ -3,12 +3,15 @@ module github.com/deploymenttheory/macos-autopkg-factory
 go 1.22.5
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/spf13/cobra v1.9.1
+	github.com/spf13/pflag v1.0.6
+	go.etcd.io/bbolt v1.3.11
 	gopkg.in/yaml.v2 v2.4.0
 	howett.net/plist v1.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.6 // indirect
+	golang.org/x/sys v0.22.0 // indirect
 )
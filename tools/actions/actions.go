@@ -0,0 +1,114 @@
+// Package actions reads GitHub Actions inputs and writes step outputs, so the
+// published action can call autopkgctl directly without shell glue
+package actions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// InputPrefix is the prefix GitHub Actions uses for action input environment variables
+const InputPrefix = "INPUT_"
+
+// OutputEnvVar names the file step outputs are appended to
+const OutputEnvVar = "GITHUB_OUTPUT"
+
+// PathEnvVar names the file directories are appended to for later steps' PATH
+const PathEnvVar = "GITHUB_PATH"
+
+// Running reports whether the process runs inside a GitHub Actions job
+func Running() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// Input returns the value of an action input. GitHub upper-cases the input
+// name and keeps hyphens, so both INPUT_PREFS-PATH and INPUT_PREFS_PATH are
+// accepted for an input named prefs-path.
+func Input(name string) (string, bool) {
+	key := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+	for _, candidate := range []string{key, strings.ReplaceAll(key, "-", "_")} {
+		if value, ok := os.LookupEnv(InputPrefix + candidate); ok {
+			return strings.TrimSpace(value), true
+		}
+	}
+	return "", false
+}
+
+// SetOutput writes a step output. Outside of GitHub Actions, where no output
+// file is configured, it does nothing.
+func SetOutput(name string, value string) error {
+	outputPath := os.Getenv(OutputEnvVar)
+	if outputPath == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(outputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open step output file: %w", err)
+	}
+	defer file.Close()
+
+	entry := fmt.Sprintf("%s=%s\n", name, value)
+	if strings.Contains(value, "\n") {
+		delimiter, err := outputDelimiter()
+		if err != nil {
+			return err
+		}
+		entry = fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+	}
+
+	if _, err := file.WriteString(entry); err != nil {
+		return fmt.Errorf("failed to write step output %s: %w", name, err)
+	}
+	return nil
+}
+
+// SetOutputs writes several step outputs in name order
+func SetOutputs(outputs map[string]string) error {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := SetOutput(name, outputs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddPath puts a directory on PATH for the job's later steps. Outside of
+// GitHub Actions it does nothing.
+func AddPath(dir string) error {
+	pathFile := os.Getenv(PathEnvVar)
+	if pathFile == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(pathFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open path file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(dir + "\n"); err != nil {
+		return fmt.Errorf("failed to add %s to path: %w", dir, err)
+	}
+	return nil
+}
+
+// outputDelimiter returns a random heredoc delimiter for multiline outputs,
+// so a value can't terminate its own output early
+func outputDelimiter() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate output delimiter: %w", err)
+	}
+	return "ghadelimiter_" + hex.EncodeToString(buf), nil
+}
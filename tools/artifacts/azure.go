@@ -0,0 +1,176 @@
+package artifacts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const azureStorageVersion = "2021-08-06"
+
+// azureBackend uploads to Azure Blob Storage using Shared Key or SAS token authentication
+type azureBackend struct {
+	config *Config
+	client *http.Client
+}
+
+// Upload stores a file as a block blob with a single PUT request
+func (b *azureBackend) Upload(key string, path string, contentType string) error {
+	if b.config.AccountKey == "" && b.config.SASToken == "" {
+		return fmt.Errorf("azure storage key or SAS token is not configured")
+	}
+
+	file, size, err := openForUpload(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	blobURL := b.blobURL(key)
+	if b.config.AccountKey == "" {
+		blobURL.RawQuery = strings.TrimPrefix(b.config.SASToken, "?")
+	}
+
+	req, err := http.NewRequest(http.MethodPut, blobURL.String(), file)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureStorageVersion)
+
+	if b.config.AccountKey != "" {
+		signature, err := b.sharedKeySignature(req, blobURL, size, contentType)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", b.config.Account, signature))
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// URL returns the blob URL, with a read-only service SAS unless the container is public
+func (b *azureBackend) URL(key string) (string, error) {
+	blobURL := b.blobURL(key)
+	if b.config.Public {
+		return blobURL.String(), nil
+	}
+
+	// A configured SAS token is usually write-capable, so never hand it out in links
+	if b.config.AccountKey == "" {
+		return "", fmt.Errorf("presigned azure URLs require an account key")
+	}
+
+	expiry := time.Now().UTC().Add(b.config.PresignExpiry).Format("2006-01-02T15:04:05Z")
+	canonicalResource := fmt.Sprintf("/blob/%s/%s/%s", b.config.Account, b.config.Bucket, key)
+
+	stringToSign := strings.Join([]string{
+		"r",               // signed permissions
+		"",                // signed start
+		expiry,            // signed expiry
+		canonicalResource, // canonicalized resource
+		"",                // signed identifier
+		"",                // signed IP
+		"https",           // signed protocol
+		azureStorageVersion,
+		"b", // signed resource
+		"",  // signed snapshot time
+		"",  // signed encryption scope
+		"", "", "", "", "",
+	}, "\n")
+
+	signature, err := b.hmac(stringToSign)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("sv", azureStorageVersion)
+	query.Set("sr", "b")
+	query.Set("sp", "r")
+	query.Set("se", expiry)
+	query.Set("spr", "https")
+	query.Set("sig", signature)
+	blobURL.RawQuery = query.Encode()
+
+	return blobURL.String(), nil
+}
+
+// blobURL builds the URL for a blob in the configured container
+func (b *azureBackend) blobURL(key string) *url.URL {
+	host := fmt.Sprintf("%s.blob.core.windows.net", b.config.Account)
+	scheme := "https"
+	if b.config.Endpoint != "" {
+		if endpoint, err := url.Parse(b.config.Endpoint); err == nil && endpoint.Host != "" {
+			host, scheme = endpoint.Host, endpoint.Scheme
+		}
+	}
+
+	return &url.URL{
+		Scheme:  scheme,
+		Host:    host,
+		Path:    "/" + b.config.Bucket + "/" + key,
+		RawPath: "/" + sigV4Escape(b.config.Bucket, true) + "/" + sigV4Escape(key, false),
+	}
+}
+
+// sharedKeySignature signs a Blob service request with the storage account key
+func (b *azureBackend) sharedKeySignature(req *http.Request, blobURL *url.URL, size int64, contentType string) (string, error) {
+	contentLength := ""
+	if size > 0 {
+		contentLength = strconv.FormatInt(size, 10)
+	}
+
+	canonicalHeaders := fmt.Sprintf("x-ms-blob-type:%s\nx-ms-date:%s\nx-ms-version:%s\n",
+		req.Header.Get("x-ms-blob-type"), req.Header.Get("x-ms-date"), req.Header.Get("x-ms-version"))
+
+	stringToSign := strings.Join([]string{
+		http.MethodPut,
+		"", // Content-Encoding
+		"", // Content-Language
+		contentLength,
+		"", // Content-MD5
+		contentType,
+		"", // Date
+		"", // If-Modified-Since
+		"", // If-Match
+		"", // If-None-Match
+		"", // If-Unmodified-Since
+		"", // Range
+		canonicalHeaders + "/" + b.config.Account + blobURL.EscapedPath(),
+	}, "\n")
+
+	return b.hmac(stringToSign)
+}
+
+// hmac signs a string with the decoded storage account key
+func (b *azureBackend) hmac(stringToSign string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(b.config.AccountKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode azure storage key: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,99 @@
+// Package artifacts publishes built packages, disk images and reports to object storage
+package artifacts
+
+import (
+	"os"
+	"time"
+)
+
+// Supported storage backends
+const (
+	BackendS3    = "s3"
+	BackendAzure = "azure"
+	BackendGCS   = "gcs"
+)
+
+// DefaultKeyTemplate is the object key layout used when no template is configured
+const DefaultKeyTemplate = "{app}/{version}/{filename}"
+
+// DefaultPresignExpiry is how long presigned download URLs stay valid
+const DefaultPresignExpiry = 7 * 24 * time.Hour
+
+// Config holds the configuration for an artifact storage backend
+type Config struct {
+	// Backend is one of "s3", "azure" or "gcs"
+	Backend string
+
+	// Bucket is the S3/GCS bucket or Azure container name
+	Bucket string
+
+	// Region is the S3 region, defaults to AWS_REGION
+	Region string
+
+	// Endpoint overrides the service endpoint, e.g. for S3 compatible storage
+	Endpoint string
+
+	// Account is the Azure storage account name, defaults to AZURE_STORAGE_ACCOUNT
+	Account string
+
+	// KeyTemplate lays out object keys using {app}, {version}, {recipe},
+	// {date}, {run_id} and {filename} placeholders
+	KeyTemplate string
+
+	// Public returns plain object URLs instead of presigned URLs, for buckets
+	// that already allow anonymous reads
+	Public bool
+
+	// PresignExpiry is how long presigned URLs remain valid
+	PresignExpiry time.Duration
+
+	// Credentials for the backend, read from the environment by DefaultConfig
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	AccountKey      string
+	SASToken        string
+}
+
+// Artifact is a local file to publish
+type Artifact struct {
+	Path    string
+	App     string
+	Version string
+	Recipe  string
+}
+
+// UploadResult describes a published artifact
+type UploadResult struct {
+	Artifact Artifact `json:"artifact"`
+	Key      string   `json:"key"`
+	URL      string   `json:"url"`
+	Error    error    `json:"-"`
+}
+
+// DefaultConfig creates a Config for the given backend using credentials from the environment
+func DefaultConfig(backend string) *Config {
+	config := &Config{
+		Backend:       backend,
+		KeyTemplate:   DefaultKeyTemplate,
+		PresignExpiry: DefaultPresignExpiry,
+		Region:        os.Getenv("AWS_REGION"),
+	}
+
+	switch backend {
+	case BackendS3:
+		config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	case BackendGCS:
+		// GCS is accessed through its S3 compatible XML API using HMAC keys
+		config.AccessKeyID = os.Getenv("GCS_HMAC_ACCESS_ID")
+		config.SecretAccessKey = os.Getenv("GCS_HMAC_SECRET")
+	case BackendAzure:
+		config.Account = os.Getenv("AZURE_STORAGE_ACCOUNT")
+		config.AccountKey = os.Getenv("AZURE_STORAGE_KEY")
+		config.SASToken = os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+	}
+
+	return config
+}
@@ -0,0 +1,182 @@
+package artifacts
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Backend uploads files to object storage and returns URLs to download them
+type Backend interface {
+	// Upload stores the file at path under key
+	Upload(key string, path string, contentType string) error
+	// URL returns a public or presigned download URL for key
+	URL(key string) (string, error)
+}
+
+// Publisher uploads artifacts to a configured backend
+type Publisher struct {
+	config  *Config
+	backend Backend
+}
+
+// NewPublisher creates a publisher for the backend named in the configuration
+func NewPublisher(config *Config) (*Publisher, error) {
+	if config == nil {
+		return nil, fmt.Errorf("artifact storage configuration is required")
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("bucket or container name is required")
+	}
+	if config.KeyTemplate == "" {
+		config.KeyTemplate = DefaultKeyTemplate
+	}
+	if config.PresignExpiry <= 0 {
+		config.PresignExpiry = DefaultPresignExpiry
+	}
+
+	client := &http.Client{Timeout: 30 * time.Minute}
+
+	var backend Backend
+	switch config.Backend {
+	case BackendS3:
+		if config.Region == "" {
+			config.Region = "us-east-1"
+		}
+		backend = &s3Backend{config: config, client: client, service: "s3"}
+	case BackendGCS:
+		if config.Endpoint == "" {
+			config.Endpoint = "https://storage.googleapis.com"
+		}
+		if config.Region == "" {
+			config.Region = "auto"
+		}
+		backend = &s3Backend{config: config, client: client, service: "s3"}
+	case BackendAzure:
+		if config.Account == "" {
+			return nil, fmt.Errorf("azure storage account is required")
+		}
+		backend = &azureBackend{config: config, client: client}
+	default:
+		return nil, fmt.Errorf("unsupported artifact backend: %s", config.Backend)
+	}
+
+	return &Publisher{config: config, backend: backend}, nil
+}
+
+// Publish uploads each artifact and returns its object key and download URL.
+// Failures are recorded per artifact so one bad upload does not stop the rest.
+func (p *Publisher) Publish(artifacts []Artifact, runID string) ([]UploadResult, error) {
+	results := make([]UploadResult, 0, len(artifacts))
+	failed := 0
+	now := time.Now().UTC()
+
+	for _, artifact := range artifacts {
+		result := UploadResult{
+			Artifact: artifact,
+			Key:      RenderKey(p.config.KeyTemplate, artifact, runID, now),
+		}
+
+		logger.Logger(fmt.Sprintf("☁️ Uploading %s to %s://%s/%s", filepath.Base(artifact.Path), p.config.Backend, p.config.Bucket, result.Key), logger.LogInfo)
+
+		if err := p.backend.Upload(result.Key, artifact.Path, contentTypeFor(artifact.Path)); err != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to upload %s: %v", artifact.Path, err), logger.LogError)
+			result.Error = err
+			failed++
+			results = append(results, result)
+			continue
+		}
+
+		url, err := p.backend.URL(result.Key)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Uploaded %s but could not build download URL: %v", artifact.Path, err), logger.LogWarning)
+		}
+		result.URL = url
+		results = append(results, result)
+
+		logger.Logger(fmt.Sprintf("✅ Uploaded %s", result.Key), logger.LogSuccess)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("failed to upload %d of %d artifacts", failed, len(artifacts))
+	}
+	return results, nil
+}
+
+// URL returns a download URL for an object uploaded earlier
+func (p *Publisher) URL(key string) (string, error) {
+	return p.backend.URL(key)
+}
+
+// Target identifies the backend and bucket artifacts are published to, e.g. "s3:my-bucket"
+func (p *Publisher) Target() string {
+	return p.config.Backend + ":" + p.config.Bucket
+}
+
+// RenderKey expands a key template for an artifact
+func RenderKey(template string, artifact Artifact, runID string, now time.Time) string {
+	app := artifact.App
+	if app == "" {
+		app = strings.TrimSuffix(filepath.Base(artifact.Path), filepath.Ext(artifact.Path))
+	}
+	version := artifact.Version
+	if version == "" {
+		version = "unknown"
+	}
+
+	replacer := strings.NewReplacer(
+		"{app}", keySegment(app),
+		"{version}", keySegment(version),
+		"{recipe}", keySegment(artifact.Recipe),
+		"{date}", now.Format("2006-01-02"),
+		"{run_id}", keySegment(runID),
+		"{filename}", filepath.Base(artifact.Path),
+	)
+
+	key := replacer.Replace(template)
+	for strings.Contains(key, "//") {
+		key = strings.ReplaceAll(key, "//", "/")
+	}
+	return strings.TrimPrefix(key, "/")
+}
+
+// keySegment makes a value safe for use as a single object key segment
+func keySegment(value string) string {
+	return strings.ReplaceAll(strings.TrimSpace(value), "/", "-")
+}
+
+// contentTypeFor returns the content type to store an artifact with
+func contentTypeFor(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pkg":
+		return "application/octet-stream"
+	case ".dmg":
+		return "application/x-apple-diskimage"
+	case ".plist":
+		return "application/xml"
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// openForUpload opens a file and returns it with its size
+func openForUpload(path string) (*os.File, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	return file, info.Size(), nil
+}
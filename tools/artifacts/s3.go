@@ -0,0 +1,241 @@
+package artifacts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	maxS3Presign    = 7 * 24 * time.Hour
+)
+
+// s3Backend uploads to Amazon S3, or any S3 compatible API such as the GCS
+// XML API, using AWS Signature Version 4.
+type s3Backend struct {
+	config  *Config
+	client  *http.Client
+	service string
+}
+
+// Upload stores a file with a single signed PUT request
+func (b *s3Backend) Upload(key string, path string, contentType string) error {
+	if b.config.AccessKeyID == "" || b.config.SecretAccessKey == "" {
+		return fmt.Errorf("%s credentials are not configured", b.config.Backend)
+	}
+
+	file, size, err := openForUpload(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	objectURL := b.objectURL(key)
+	req, err := http.NewRequest(http.MethodPut, objectURL.String(), file)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+
+	now := time.Now().UTC()
+	headers := map[string]string{
+		"content-type":         contentType,
+		"host":                 objectURL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	if b.config.SessionToken != "" {
+		headers["x-amz-security-token"] = b.config.SessionToken
+	}
+
+	signedHeaders, canonicalHeaders := canonicalizeHeaders(headers)
+	canonicalRequest := strings.Join([]string{
+		http.MethodPut,
+		objectURL.EscapedPath(),
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := b.credentialScope(now)
+	signature := b.sign(now, scope, canonicalRequest)
+
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, b.config.AccessKeyID, scope, signedHeaders, signature))
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// URL returns the object URL, presigned unless the bucket is public
+func (b *s3Backend) URL(key string) (string, error) {
+	objectURL := b.objectURL(key)
+	if b.config.Public {
+		return objectURL.String(), nil
+	}
+
+	return b.presign(objectURL, time.Now().UTC()), nil
+}
+
+// presign adds SigV4 query authentication to an object URL
+func (b *s3Backend) presign(objectURL *url.URL, now time.Time) string {
+	expiry := b.config.PresignExpiry
+	if expiry > maxS3Presign {
+		expiry = maxS3Presign
+	}
+
+	scope := b.credentialScope(now)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     sigV4Algorithm,
+		"X-Amz-Credential":    b.config.AccessKeyID + "/" + scope,
+		"X-Amz-Date":          now.Format("20060102T150405Z"),
+		"X-Amz-Expires":       strconv.Itoa(int(expiry.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if b.config.SessionToken != "" {
+		query["X-Amz-Security-Token"] = b.config.SessionToken
+	}
+	canonicalQuery := canonicalizeQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		objectURL.EscapedPath(),
+		canonicalQuery,
+		"host:" + objectURL.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	objectURL.RawQuery = canonicalQuery + "&X-Amz-Signature=" + b.sign(now, scope, canonicalRequest)
+	return objectURL.String()
+}
+
+// objectURL builds the URL for a key, path-style for custom endpoints and
+// virtual-hosted style for AWS
+func (b *s3Backend) objectURL(key string) *url.URL {
+	escapedKey := sigV4Escape(key, false)
+
+	if b.config.Endpoint != "" {
+		endpoint, err := url.Parse(strings.TrimSuffix(b.config.Endpoint, "/"))
+		if err == nil && endpoint.Host != "" {
+			return &url.URL{
+				Scheme:  endpoint.Scheme,
+				Host:    endpoint.Host,
+				Path:    endpoint.Path + "/" + b.config.Bucket + "/" + key,
+				RawPath: endpoint.Path + "/" + sigV4Escape(b.config.Bucket, true) + "/" + escapedKey,
+			}
+		}
+	}
+
+	return &url.URL{
+		Scheme:  "https",
+		Host:    fmt.Sprintf("%s.s3.%s.amazonaws.com", b.config.Bucket, b.config.Region),
+		Path:    "/" + key,
+		RawPath: "/" + escapedKey,
+	}
+}
+
+// credentialScope returns the SigV4 credential scope for a signing time
+func (b *s3Backend) credentialScope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", now.Format("20060102"), b.config.Region, b.service)
+}
+
+// sign returns the SigV4 signature for a canonical request
+func (b *s3Backend) sign(now time.Time, scope string, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format("20060102T150405Z"),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+b.config.SecretAccessKey), now.Format("20060102"))
+	signingKey = hmacSHA256(signingKey, b.config.Region)
+	signingKey = hmacSHA256(signingKey, b.service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+// canonicalizeHeaders returns the signed header list and canonical header block
+func canonicalizeHeaders(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// canonicalizeQuery encodes query parameters sorted by name
+func canonicalizeQuery(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, sigV4Escape(name, true)+"="+sigV4Escape(query[name], true))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything except unreserved characters, and
+// optionally the slash
+func sigV4Escape(value string, encodeSlash bool) string {
+	var escaped strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			escaped.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+// hmacSHA256 computes an HMAC-SHA256 digest
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
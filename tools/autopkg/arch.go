@@ -0,0 +1,121 @@
+// arch.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Runner and recipe architectures
+const (
+	ArchARM64  = "arm64"
+	ArchX86_64 = "x86_64"
+)
+
+// SkipReasonArchMismatch marks recipes skipped because the runner can't run their architecture
+const SkipReasonArchMismatch = "arch-mismatch"
+
+// rosettaPath is the Rosetta 2 runtime, present once Rosetta is installed
+const rosettaPath = "/Library/Apple/usr/share/rosetta/rosetta"
+
+var (
+	rosettaOnce      sync.Once
+	rosettaInstalled bool
+)
+
+// RunnerArch returns the native architecture of the runner. A binary running
+// under Rosetta reports x86_64 itself, so the kernel is asked whether the
+// process is translated.
+func RunnerArch() string {
+	arch := NormalizeArch(runtime.GOARCH)
+	if runtime.GOOS == "darwin" && arch == ArchX86_64 {
+		output, err := exec.Command("sysctl", "-in", "sysctl.proc_translated").Output()
+		if err == nil && strings.TrimSpace(string(output)) == "1" {
+			return ArchARM64
+		}
+	}
+	return arch
+}
+
+// NormalizeArch maps architecture spellings to arm64 or x86_64. Universal or
+// empty values mean no requirement and return an empty string.
+func NormalizeArch(arch string) string {
+	switch strings.ToLower(strings.TrimSpace(arch)) {
+	case "arm64", "aarch64", "apple", "apple-silicon":
+		return ArchARM64
+	case "x86_64", "amd64", "x64", "intel":
+		return ArchX86_64
+	case "", "universal", "any":
+		return ""
+	default:
+		return strings.ToLower(strings.TrimSpace(arch))
+	}
+}
+
+// rosettaAvailable reports whether x86_64 code can run on this arm64 runner
+func rosettaAvailable() bool {
+	rosettaOnce.Do(func() {
+		if runtime.GOOS != "darwin" {
+			return
+		}
+		_, err := os.Stat(rosettaPath)
+		rosettaInstalled = err == nil
+	})
+	return rosettaInstalled
+}
+
+// planRecipeArch decides how a recipe requiring an architecture runs on a
+// runner: natively, under Rosetta (returning the arch to run with), or not at all
+func planRecipeArch(required string, runner string, rosetta bool) (runArch string, skip bool) {
+	required = NormalizeArch(required)
+	if required == "" || required == runner {
+		return "", false
+	}
+	if required == ArchX86_64 && runner == ArchARM64 && rosetta {
+		return ArchX86_64, false
+	}
+	return "", true
+}
+
+// RequiredArch returns the architecture a recipe is tagged with in the catalog, or an empty string
+func (c *Catalog) RequiredArch(recipe string) string {
+	if entry := c.Entry(recipe); entry != nil {
+		return NormalizeArch(entry.Arch)
+	}
+	return ""
+}
+
+// recipeArchPlan returns how a recipe of the batch runs on the runner architecture
+func (o *RecipeBatchRunOptions) recipeArchPlan(recipe string) (runArch string, skip bool) {
+	required := o.Catalog.RequiredArch(recipe)
+	if required == "" {
+		return "", false
+	}
+	return planRecipeArch(required, o.RunnerArch, o.RunnerArch == ArchARM64 && rosettaAvailable())
+}
+
+// hasArchRequirements reports whether any of the recipes is tagged with an architecture
+func (o *RecipeBatchRunOptions) hasArchRequirements(recipes []string) bool {
+	for _, recipe := range recipes {
+		if o.Catalog.RequiredArch(recipe) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// archMismatchResult records a recipe skipped because the runner can't run its architecture
+func archMismatchResult(recipe string, required string, runner string) *RecipeBatchResult {
+	logger.Logger(fmt.Sprintf("⏩ Skipping %s: requires %s, runner is %s without a way to run it", recipe, required, runner), logger.LogWarning)
+	return &RecipeBatchResult{
+		Recipe:     recipe,
+		Status:     "skipped",
+		SkipReason: SkipReasonArchMismatch,
+	}
+}
@@ -0,0 +1,85 @@
+// artifact_diff.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/sbom"
+)
+
+// diffRunArtifacts compares the packages and disk images of recipes that
+// produced a new version with those their previous successful run produced,
+// so a security review sees which components, files, entitlements, launch
+// items and install scripts a vendor update changed. The previous artifact
+// has to still be on disk, e.g. in the AutoPkg cache.
+func diffRunArtifacts(options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult, before time.Time) {
+	historyPath := options.HistoryPath
+	if historyPath == "" {
+		historyPath = DefaultHistoryPath(options.StateDir)
+	}
+	history, err := OpenHistory(historyPath)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to open run history to diff artifacts: %v", err), logger.LogWarning)
+		return
+	}
+	defer history.Close()
+
+	for _, result := range results {
+		if result.Status != "updated" || result.Allowlisted {
+			continue
+		}
+
+		previous, err := history.LastSuccessful(result.Recipe, before)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to find the previous artifact of %s: %v", result.Recipe, err), logger.LogWarning)
+			continue
+		}
+		if previous == nil || previous.ArtifactPath == "" {
+			logger.Logger(fmt.Sprintf("ℹ️ No previous artifact of %s to diff against", result.Recipe), logger.LogDebug)
+			continue
+		}
+		if _, err := os.Stat(previous.ArtifactPath); err != nil {
+			logger.Logger(fmt.Sprintf("ℹ️ Previous artifact of %s is gone, not diffing: %s", result.Recipe, previous.ArtifactPath), logger.LogDebug)
+			continue
+		}
+
+		for _, artifact := range result.Artifacts {
+			if (artifact.Type != "pkg" && artifact.Type != "dmg") || artifact.Path == previous.ArtifactPath ||
+				!strings.EqualFold(filepath.Ext(artifact.Path), filepath.Ext(previous.ArtifactPath)) {
+				continue
+			}
+
+			delta, err := diffArtifacts(previous.ArtifactPath, artifact.Path)
+			if err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Failed to diff %s against %s: %v", filepath.Base(artifact.Path), filepath.Base(previous.ArtifactPath), err), logger.LogWarning)
+				continue
+			}
+			result.ArtifactDiffs = append(result.ArtifactDiffs, *delta)
+
+			logger.Logger(fmt.Sprintf("🔍 %s %s → %s: %d component changes, %d files added, %d removed",
+				result.Recipe, previous.Version, artifact.Version, len(delta.Components), len(delta.AddedFiles), len(delta.RemovedFiles)), logger.LogInfo)
+			for _, highlight := range delta.Highlights() {
+				logger.Logger(fmt.Sprintf("🔍 %s: %s", result.Recipe, highlight), logger.LogWarning)
+			}
+			break
+		}
+	}
+}
+
+// diffArtifacts inspects two versions of an artifact and returns what changed
+func diffArtifacts(previousPath, currentPath string) (*sbom.Delta, error) {
+	previous, err := sbom.InspectContents(previousPath)
+	if err != nil {
+		return nil, err
+	}
+	current, err := sbom.InspectContents(currentPath)
+	if err != nil {
+		return nil, err
+	}
+	return sbom.Diff(previous, current), nil
+}
@@ -0,0 +1,121 @@
+// artifact_discovery.go
+package autopkg
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// DiscoverArtifacts returns what a recipe run left behind for later steps to
+// scan or upload: the pkgs, dmgs and zips listed in its report, which are
+// collected into the result as the recipe finishes, and the .app bundles
+// unpacked into the recipe's cache directory. Bundle IDs, and versions the
+// report doesn't have, are read from the app's Info.plist.
+func DiscoverArtifacts(result *RecipeBatchResult) []ProducedArtifact {
+	if result == nil {
+		return nil
+	}
+
+	apps := discoverCacheApps(result.Recipe, result.CacheDir)
+	main := mainApp(apps, artifactAppName(result.Recipe, "", ""))
+
+	discovered := []ProducedArtifact{}
+	for _, artifact := range result.Artifacts {
+		if _, err := os.Stat(artifact.Path); err != nil {
+			continue
+		}
+		if main != nil {
+			if artifact.BundleID == "" {
+				artifact.BundleID = main.BundleID
+			}
+			if artifact.Version == "" {
+				artifact.Version = main.Version
+			}
+		}
+		discovered = append(discovered, artifact)
+	}
+
+	return append(discovered, apps...)
+}
+
+// discoverCacheApps lists the .app bundles in a recipe's cache directory,
+// without descending into them, so helper apps inside a bundle aren't listed
+func discoverCacheApps(recipe string, cacheDir string) []ProducedArtifact {
+	if cacheDir == "" {
+		return nil
+	}
+
+	var apps []ProducedArtifact
+	filepath.WalkDir(cacheDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".app") {
+			return nil
+		}
+
+		bundleID, version := readAppInfo(path)
+		apps = append(apps, ProducedArtifact{
+			Recipe:   recipe,
+			App:      strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+			Version:  version,
+			Path:     path,
+			Type:     "app",
+			BundleID: bundleID,
+		})
+		return filepath.SkipDir
+	})
+
+	return apps
+}
+
+// mainApp returns the app named after the recipe, or the only app found.
+// With several apps and none named after the recipe, there is no main app.
+func mainApp(apps []ProducedArtifact, name string) *ProducedArtifact {
+	for i := range apps {
+		if strings.EqualFold(apps[i].App, name) {
+			return &apps[i]
+		}
+	}
+	if len(apps) == 1 {
+		return &apps[0]
+	}
+	return nil
+}
+
+// readAppInfo returns the bundle ID and version from an app's Info.plist
+func readAppInfo(appPath string) (string, string) {
+	data, err := os.ReadFile(filepath.Join(appPath, "Contents", "Info.plist"))
+	if err != nil {
+		return "", ""
+	}
+
+	var info map[string]interface{}
+	if _, err := plist.Unmarshal(data, &info); err != nil {
+		return "", ""
+	}
+
+	bundleID, _ := info["CFBundleIdentifier"].(string)
+	version, _ := info["CFBundleShortVersionString"].(string)
+	if version == "" {
+		version, _ = info["CFBundleVersion"].(string)
+	}
+	return bundleID, version
+}
+
+// recipeCacheDir returns the AutoPkg cache directory a recipe's artifacts were
+// written to, CACHE_DIR/<recipe identifier>, or "" when none are under cacheRoot
+func recipeCacheDir(cacheRoot string, artifacts []ProducedArtifact) string {
+	for _, artifact := range artifacts {
+		rel, err := filepath.Rel(cacheRoot, artifact.Path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		identifier := strings.Split(rel, string(filepath.Separator))[0]
+		if identifier != rel {
+			return filepath.Join(cacheRoot, identifier)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+// brew_install.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// AutoPkg install backends
+const (
+	InstallBackendPkg  = "pkg"  // The release package from GitHub, installed with installer
+	InstallBackendBrew = "brew" // The Homebrew cask, with git and python from Homebrew
+)
+
+// brewDependencies are the formulae the Homebrew backend installs next to AutoPkg
+var brewDependencies = []string{"git", "python"}
+
+// autopkgCask is the Homebrew cask of AutoPkg
+const autopkgCask = "autopkg"
+
+// backend returns the install backend, the package unless Homebrew is
+// configured and available
+func (c *InstallConfig) backend() (string, error) {
+	switch c.Backend {
+	case "", InstallBackendPkg:
+		return InstallBackendPkg, nil
+	case InstallBackendBrew:
+		if _, err := exec.LookPath("brew"); err != nil {
+			logger.Logger("⚠️ Homebrew not found, installing AutoPkg from its release package", logger.LogWarning)
+			return InstallBackendPkg, nil
+		}
+		if c.UseBeta || c.UserSpace {
+			return "", fmt.Errorf("beta and user-space installs need the %s backend", InstallBackendPkg)
+		}
+		return InstallBackendBrew, nil
+	default:
+		return "", fmt.Errorf("unknown install backend %q, expected %s or %s", c.Backend, InstallBackendPkg, InstallBackendBrew)
+	}
+}
+
+// installBrewAutoPkg installs AutoPkg with Homebrew, along with git and
+// python, so runner images managed with brew bundle keep one source of
+// tooling. The cask only serves its current version, so a pinned version
+// other than that fails rather than installing something else.
+func installBrewAutoPkg(installConfig *InstallConfig) (string, error) {
+	for _, formula := range brewDependencies {
+		if brewInstalled(formula, false) {
+			logger.Logger(fmt.Sprintf("✅ %s is installed with Homebrew", formula), logger.LogInfo)
+			continue
+		}
+		logger.Logger(fmt.Sprintf("🔄 Installing %s via Homebrew...", formula), logger.LogInfo)
+		if err := runBrew("install", formula); err != nil {
+			return "", fmt.Errorf("failed to install %s via Homebrew: %w", formula, err)
+		}
+	}
+
+	installed := brewInstalled(autopkgCask, true)
+	if installed && !installConfig.ForceUpdate {
+		version, err := autopkgVersionAt("autopkg")
+		if err != nil {
+			return "", err
+		}
+		if installConfig.pinned(version) {
+			logger.Logger(fmt.Sprintf("✅ AutoPkg %s is already installed. Skipping installation.", version), logger.LogSuccess)
+			return version, nil
+		}
+		logger.Logger(fmt.Sprintf("🔄 AutoPkg %s is installed but %s is pinned, upgrading it...", version, installConfig.Version), logger.LogInfo)
+	}
+
+	if installConfig.Version != "" {
+		caskVersion, err := brewCaskVersion(autopkgCask)
+		if err != nil {
+			return "", err
+		}
+		if !installConfig.pinned(caskVersion) {
+			return "", fmt.Errorf("the Homebrew cask serves AutoPkg %s, not the pinned %s; use the %s backend to install %s", caskVersion, installConfig.Version, InstallBackendPkg, installConfig.Version)
+		}
+	}
+
+	switch {
+	case !installed:
+		logger.Logger("⬇️ AutoPkg not found. Installing AutoPkg via Homebrew...", logger.LogInfo)
+		if err := runBrew("install", "--cask", autopkgCask); err != nil {
+			return "", fmt.Errorf("failed to install AutoPkg via Homebrew: %w", err)
+		}
+	default:
+		logger.Logger("🔄 Updating AutoPkg via Homebrew...", logger.LogInfo)
+		if err := runBrew("upgrade", "--cask", autopkgCask); err != nil {
+			return "", fmt.Errorf("failed to upgrade AutoPkg via Homebrew: %w", err)
+		}
+	}
+
+	version, err := autopkgVersionAt("autopkg")
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AutoPkg version after installation: %w", err)
+	}
+	if !installConfig.pinned(version) {
+		return "", fmt.Errorf("installed AutoPkg is %s, not the pinned %s", version, installConfig.Version)
+	}
+	logger.Logger(fmt.Sprintf("✅ AutoPkg %s successfully installed via Homebrew", version), logger.LogSuccess)
+	return version, nil
+}
+
+// brewInstalled reports whether Homebrew has a formula, or cask, installed
+func brewInstalled(name string, cask bool) bool {
+	args := []string{"list", "--formula", name}
+	if cask {
+		args = []string{"list", "--cask", name}
+	}
+	return exec.Command("brew", args...).Run() == nil
+}
+
+// brewCaskVersion returns the version a Homebrew cask currently serves
+func brewCaskVersion(cask string) (string, error) {
+	output, err := exec.Command("brew", "info", "--cask", "--json=v2", cask).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read Homebrew cask %s: %w", cask, err)
+	}
+	var info struct {
+		Casks []struct {
+			Version string `json:"version"`
+		} `json:"casks"`
+	}
+	if err := json.Unmarshal(output, &info); err != nil || len(info.Casks) == 0 {
+		return "", fmt.Errorf("failed to parse Homebrew cask %s", cask)
+	}
+	return strings.TrimSpace(info.Casks[0].Version), nil
+}
+
+// runBrew runs a Homebrew command, showing its output
+func runBrew(args ...string) error {
+	cmd := exec.Command("brew", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,156 @@
+// catalog.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// Catalog describes the recipes managed by the factory and the pipeline
+// features that individual recipes have opted in to.
+type Catalog struct {
+	Features          map[string]FeatureFlag      `yaml:"features"`
+	OverrideTemplates map[string]OverrideTemplate `yaml:"override_templates,omitempty"` // Keyed by target, e.g. jamf or intune
+	Recipes           []CatalogEntry              `yaml:"recipes"`
+}
+
+// FeatureFlag describes an experimental pipeline feature that recipes can opt in to
+type FeatureFlag struct {
+	Description    string   `yaml:"description,omitempty"`
+	Enabled        bool     `yaml:"enabled"` // Global kill switch, disabling removes the feature from every recipe
+	PreProcessors  []string `yaml:"pre_processors,omitempty"`
+	PostProcessors []string `yaml:"post_processors,omitempty"`
+}
+
+// CatalogEntry contains catalog metadata for a single recipe
+type CatalogEntry struct {
+	Recipe         string            `yaml:"recipe"`
+	Name           string            `yaml:"name,omitempty"`   // App name used in override templates, defaults to the recipe's app part
+	Target         string            `yaml:"target,omitempty"` // Upload target selecting the override template, e.g. jamf or intune
+	Arch           string            `yaml:"arch,omitempty"`   // Required runner architecture, arm64 or x86_64, empty runs anywhere
+	MinOSVersion   string            `yaml:"min_os,omitempty"` // Minimum macOS version the runner needs for this recipe
+	Input          map[string]string `yaml:"input,omitempty"`  // Override Input keys, applied over the target template
+	Tags           []string          `yaml:"tags,omitempty"`
+	Features       []string          `yaml:"features,omitempty"`
+	VersionURL     string            `yaml:"version_url,omitempty"`     // Vendor page or API listing the latest version, checked by FindStaleRecipes
+	VersionPattern string            `yaml:"version_pattern,omitempty"` // Regular expression whose first group is the version in VersionURL's response
+	Cask           string            `yaml:"cask,omitempty"`            // Homebrew cask token of the app, when it isn't derived from the name
+}
+
+// LoadCatalog reads a recipe catalog from a YAML file
+func LoadCatalog(catalogPath string) (*Catalog, error) {
+	data, err := os.ReadFile(catalogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog file: %w", err)
+	}
+
+	catalog := &Catalog{}
+	if err := yaml.Unmarshal(data, catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog file: %w", err)
+	}
+
+	if catalog.Features == nil {
+		catalog.Features = make(map[string]FeatureFlag)
+	}
+
+	for _, entry := range catalog.Recipes {
+		for _, feature := range entry.Features {
+			if _, exists := catalog.Features[feature]; !exists {
+				logger.Logger(fmt.Sprintf("⚠️ Recipe %s opts in to unknown feature %s", entry.Recipe, feature), logger.LogWarning)
+			}
+		}
+		if entry.Target != "" {
+			if _, exists := catalog.OverrideTemplates[entry.Target]; !exists {
+				logger.Logger(fmt.Sprintf("⚠️ Recipe %s targets %s, which has no override template", entry.Recipe, entry.Target), logger.LogWarning)
+			}
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("📚 Loaded catalog with %d recipes and %d features", len(catalog.Recipes), len(catalog.Features)), logger.LogDebug)
+	return catalog, nil
+}
+
+// Entry returns the catalog entry for a recipe, or nil if the recipe is not in the catalog
+func (c *Catalog) Entry(recipe string) *CatalogEntry {
+	if c == nil {
+		return nil
+	}
+
+	name := normalizeCatalogRecipeName(recipe)
+	for i := range c.Recipes {
+		if normalizeCatalogRecipeName(c.Recipes[i].Recipe) == name {
+			return &c.Recipes[i]
+		}
+	}
+	return nil
+}
+
+// EnabledFeatures returns the features a recipe has opted in to that are globally enabled
+func (c *Catalog) EnabledFeatures(recipe string) []string {
+	entry := c.Entry(recipe)
+	if entry == nil {
+		return nil
+	}
+
+	var features []string
+	for _, feature := range entry.Features {
+		if flag, exists := c.Features[feature]; exists && flag.Enabled {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// FeatureProcessors returns the extra pre- and post-processors contributed by
+// the enabled features a recipe has opted in to.
+func (c *Catalog) FeatureProcessors(recipe string) (preProcessors []string, postProcessors []string) {
+	for _, feature := range c.EnabledFeatures(recipe) {
+		flag := c.Features[feature]
+		preProcessors = append(preProcessors, flag.PreProcessors...)
+		postProcessors = append(postProcessors, flag.PostProcessors...)
+	}
+	return preProcessors, postProcessors
+}
+
+// hasCatalogFeatures reports whether any of the recipes has opted in to an
+// enabled feature, whose processors only a recipe run on its own can take
+func (o *RecipeBatchRunOptions) hasCatalogFeatures(recipes []string) bool {
+	for _, recipe := range recipes {
+		if len(o.Catalog.EnabledFeatures(recipe)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeCatalogRecipeName strips path and recipe file suffixes so catalog
+// names match however a recipe was specified on the command line.
+func normalizeCatalogRecipeName(recipe string) string {
+	name := recipe
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	for _, suffix := range []string{".yaml", ".plist", ".recipe"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return strings.ToLower(name)
+}
+
+// appendUnique appends values to a slice, skipping any already present
+func appendUnique(values []string, extra ...string) []string {
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		seen[value] = true
+	}
+	for _, value := range extra {
+		if !seen[value] {
+			values = append(values, value)
+			seen[value] = true
+		}
+	}
+	return values
+}
@@ -0,0 +1,103 @@
+// chaos.go
+package autopkg
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Synthetic faults injected by chaos mode
+const (
+	ChaosFaultFailure = "failure"
+	ChaosFaultTimeout = "timeout"
+)
+
+// ChaosOptions configures synthetic failure injection, used to exercise
+// alerting, retries and reporting end to end. Recipes picked for a fault are
+// never run, so nothing reaches AutoPkg, the MDM or the download servers.
+type ChaosOptions struct {
+	FailureRate  float64       // Fraction of recipes (0-1) forced to fail
+	TimeoutRate  float64       // Fraction of recipes (0-1) forced to time out
+	TimeoutDelay time.Duration // How long a synthetic timeout blocks before failing
+	Seed         int64         // Random seed for reproducible fault selection, 0 picks one
+	Simulate     bool          // Don't run the remaining recipes either, report them as unchanged
+}
+
+// chaosInjector picks which recipes receive a synthetic fault
+type chaosInjector struct {
+	options *ChaosOptions
+	rng     *rand.Rand
+}
+
+// newChaosInjector validates the chaos options and seeds the fault selection
+func newChaosInjector(options *ChaosOptions) (*chaosInjector, error) {
+	if options.FailureRate < 0 || options.TimeoutRate < 0 || options.FailureRate+options.TimeoutRate > 1 {
+		return nil, fmt.Errorf("chaos failure and timeout rates must be between 0 and 1 and add up to at most 1")
+	}
+
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	logger.Logger(fmt.Sprintf("🐒 Chaos mode enabled: %.0f%% failures, %.0f%% timeouts (seed %d)", options.FailureRate*100, options.TimeoutRate*100, seed), logger.LogWarning)
+
+	return &chaosInjector{
+		options: options,
+		rng:     rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// pick returns the fault to inject for a recipe, or "" to leave it alone
+func (c *chaosInjector) pick() string {
+	roll := c.rng.Float64()
+	switch {
+	case roll < c.options.FailureRate:
+		return ChaosFaultFailure
+	case roll < c.options.FailureRate+c.options.TimeoutRate:
+		return ChaosFaultTimeout
+	}
+	return ""
+}
+
+// result builds the batch result for a recipe with an injected fault
+func (c *chaosInjector) result(recipe string, fault string) *RecipeBatchResult {
+	startTime := time.Now()
+
+	var err error
+	switch fault {
+	case ChaosFaultTimeout:
+		time.Sleep(c.options.TimeoutDelay)
+		err = fmt.Errorf("chaos: injected timeout for %s: %w", recipe, context.DeadlineExceeded)
+	default:
+		err = fmt.Errorf("chaos: injected failure for %s", recipe)
+	}
+
+	logger.Logger(fmt.Sprintf("🐒 Injected %s for recipe %s", fault, recipe), logger.LogWarning)
+	return &RecipeBatchResult{
+		Recipe:         recipe,
+		Output:         err.Error(),
+		Executed:       false,
+		ExecutionError: err,
+		TrustVerified:  true,
+		ExecutionTime:  time.Since(startTime),
+		Status:         "failed",
+		ChaosFault:     fault,
+		FailureKind:    ClassifyFailure(err.Error(), err),
+	}
+}
+
+// simulatedResult builds the result for a recipe that chaos mode did not run
+func (c *chaosInjector) simulatedResult(recipe string) *RecipeBatchResult {
+	logger.Logger(fmt.Sprintf("🐒 Simulated run for recipe %s", recipe), logger.LogInfo)
+	return &RecipeBatchResult{
+		Recipe:        recipe,
+		Output:        "chaos: simulated run",
+		Executed:      false,
+		TrustVerified: true,
+		Status:        "unchanged",
+	}
+}
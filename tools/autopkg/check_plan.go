@@ -0,0 +1,100 @@
+// check_plan.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// CheckPlan is the outcome of a check-only run: the recipes with a new
+// download available, for a later full run to process without running the
+// recipes that are still current
+type CheckPlan struct {
+	RunID     string    `json:"run_id"`
+	CheckedAt time.Time `json:"checked_at"`
+	Updates   []string  `json:"updates"`          // Recipes with a new or changed download
+	Current   []string  `json:"current"`          // Recipes whose download hasn't changed
+	Failed    []string  `json:"failed,omitempty"` // Recipes whose check failed, run again by the full run
+	Skipped   []string  `json:"skipped,omitempty"`
+}
+
+// NewCheckPlan builds the plan of a check-only batch run from its results
+func NewCheckPlan(runID string, results map[string]*RecipeBatchResult) *CheckPlan {
+	plan := &CheckPlan{
+		RunID:     runID,
+		CheckedAt: time.Now().UTC(),
+		Updates:   []string{},
+		Current:   []string{},
+	}
+
+	for recipe, result := range results {
+		switch {
+		case result.ExecutionError != nil:
+			plan.Failed = append(plan.Failed, recipe)
+		case result.Status == "updated":
+			plan.Updates = append(plan.Updates, recipe)
+		case result.Status == "unchanged":
+			plan.Current = append(plan.Current, recipe)
+		default:
+			plan.Skipped = append(plan.Skipped, recipe)
+		}
+	}
+
+	sort.Strings(plan.Updates)
+	sort.Strings(plan.Current)
+	sort.Strings(plan.Failed)
+	sort.Strings(plan.Skipped)
+	return plan
+}
+
+// Recipes returns the recipes a full run following the plan processes: those
+// with updates, and those whose check failed so the failure isn't lost
+func (p *CheckPlan) Recipes() []string {
+	return append(append([]string{}, p.Updates...), p.Failed...)
+}
+
+// RecipeInput returns the plan's recipes as batch run input, or "" when
+// there is nothing to run
+func (p *CheckPlan) RecipeInput() string {
+	return strings.Join(p.Recipes(), ",")
+}
+
+// WriteCheckPlan saves a check plan as JSON
+func WriteCheckPlan(path string, plan *CheckPlan) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create plan directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal check plan: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write check plan: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("🗺️ Wrote check plan with %d updates to %s", len(plan.Updates), path), logger.LogInfo)
+	return nil
+}
+
+// LoadCheckPlan reads a check plan written by WriteCheckPlan
+func LoadCheckPlan(path string) (*CheckPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read check plan: %w", err)
+	}
+
+	var plan CheckPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse check plan: %w", err)
+	}
+	return &plan, nil
+}
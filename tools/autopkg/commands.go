@@ -3,7 +3,9 @@ package autopkg
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -87,6 +89,12 @@ func GetRecipeInfo(recipe string, options *InfoOptions) (string, error) {
 		options = &InfoOptions{}
 	}
 
+	if options.Pull {
+		if err := requireNetwork("info --pull", "drop --pull to use the local parent recipes"); err != nil {
+			return "", err
+		}
+	}
+
 	args := []string{"info"}
 
 	if options.PrefsPath != "" {
@@ -322,6 +330,47 @@ func ListRecipes(options *ListRecipeOptions) (string, error) {
 	return outputBuffer.String(), nil
 }
 
+// ListRecipeInfo lists recipes available locally as structured records, parsed
+// from the list-recipes output with identifiers and paths
+func ListRecipeInfo(options *ListRecipeOptions) ([]RecipeInfo, error) {
+	listOptions := ListRecipeOptions{}
+	if options != nil {
+		listOptions = *options
+	}
+	listOptions.WithIdentifiers = true
+	listOptions.WithPaths = true
+	listOptions.PlistOutput = false
+
+	output, err := ListRecipes(&listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	recipes := []RecipeInfo{}
+	for _, line := range strings.Split(output, "\n") {
+		name, identifier, path, ok := parseRecipeListLine(strings.TrimSpace(line))
+		if !ok {
+			continue
+		}
+
+		info := RecipeInfo{
+			Name:       name,
+			Identifier: identifier,
+			Path:       path,
+			Type:       knownRecipeType(name),
+			IsOverride: isRecipeOverride(identifier, path),
+			IsDisabled: strings.Contains(strings.ToLower(name), "disabled"),
+		}
+		if fileInfo, err := os.Stat(path); err == nil {
+			info.ModTime = fileInfo.ModTime()
+		}
+		recipes = append(recipes, info)
+	}
+
+	logger.Logger(fmt.Sprintf("📋 Parsed %d recipes", len(recipes)), logger.LogDebug)
+	return recipes, nil
+}
+
 // ListRepos lists installed recipe repositories
 func ListRepos(prefsPath string) (string, error) {
 
@@ -385,6 +434,12 @@ func MakeOverride(recipe string, options *MakeOverrideOptions) (string, error) {
 		options = &MakeOverrideOptions{}
 	}
 
+	if options.Pull {
+		if err := requireNetwork("make-override --pull", "drop --pull to use the local parent recipes"); err != nil {
+			return "", err
+		}
+	}
+
 	args := []string{"make-override"}
 
 	if options.PrefsPath != "" {
@@ -548,13 +603,60 @@ func GetProcessorInfo(processor string, options *ProcessorInfoOptions) (string,
 	return outputBuffer.String(), nil
 }
 
-// AddRepo adds one or more recipe repositories from URLs
+// AddRepoError is returned by AddRepo when some repositories couldn't be
+// added, the others were
+type AddRepoError struct {
+	Failed []string         // Repository URLs that failed, as given
+	Errors map[string]error // Error of each failed repository URL
+}
+
+// Error implements error
+func (e *AddRepoError) Error() string {
+	return fmt.Sprintf("failed to add %d repositories: %s", len(e.Failed), strings.Join(e.Failed, ", "))
+}
+
+// Unwrap returns the errors of the failed repositories
+func (e *AddRepoError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, repoURL := range e.Failed {
+		errs = append(errs, e.Errors[repoURL])
+	}
+	return errs
+}
+
+// RepoError returns the error of a repository URL, or nil if it was added
+func (e *AddRepoError) RepoError(repoURL string) error {
+	return e.Errors[repoURL]
+}
+
+// AddRepo adds one or more recipe repositories from URLs. When some fail,
+// the others are still added and an *AddRepoError lists the failed ones.
 func AddRepo(repoURLs []string, prefsPath string) (string, error) {
 	logger.Logger(fmt.Sprintf("📦 Adding recipe repositories: %s", strings.Join(repoURLs, ", ")), logger.LogInfo)
 
 	var fullOutput bytes.Buffer
+	failed := &AddRepoError{Errors: make(map[string]error)}
+	fail := func(repoURL string, err error) {
+		failed.Failed = append(failed.Failed, repoURL)
+		failed.Errors[repoURL] = err
+	}
 
 	for _, repoURL := range repoURLs {
+		// Offline, a repo can only be used if it was seeded beforehand
+		if Offline() {
+			repoPath := filepath.Join(recipeRepoDir(prefsPath), RepoDirName(ResolveRepoURL(repoURL)))
+			if _, err := os.Stat(filepath.Join(repoPath, ".git")); err != nil {
+				err := requireNetwork(fmt.Sprintf("repo-add %s", repoURL), "seed it with repo-cache import first")
+				logger.Logger(fmt.Sprintf("⚠️ Failed to add repo %s: %v", repoURL, err), logger.LogWarning)
+				fail(repoURL, err)
+				continue
+			}
+			msg := fmt.Sprintf("⏭️ Offline, using local copy of %s at %s", repoURL, repoPath)
+			logger.Logger(msg, logger.LogInfo)
+			fullOutput.WriteString(msg + "\n")
+			continue
+		}
+
 		args := []string{"repo-add", repoURL}
 		if prefsPath != "" {
 			args = append(args, "--prefs", prefsPath)
@@ -572,6 +674,7 @@ func AddRepo(repoURLs []string, prefsPath string) (string, error) {
 			msg := fmt.Sprintf("⚠️ Failed to add repo %s: %v", repoURL, err)
 			logger.Logger(msg, logger.LogWarning)
 			fullOutput.WriteString(msg + "\n" + outputBuffer.String() + "\n")
+			fail(repoURL, fmt.Errorf("autopkg repo-add %s failed: %w", repoURL, err))
 			continue
 		}
 
@@ -580,6 +683,9 @@ func AddRepo(repoURLs []string, prefsPath string) (string, error) {
 		fullOutput.WriteString(msg + "\n" + outputBuffer.String() + "\n")
 	}
 
+	if len(failed.Failed) > 0 {
+		return fullOutput.String(), failed
+	}
 	return fullOutput.String(), nil
 }
 
@@ -621,6 +727,10 @@ func UpdateRepo(repos []string, prefsPath string) (string, error) {
 		repoDesc = strings.Join(repos, ", ")
 	}
 
+	if err := requireNetwork("repo-update", "refresh the local repos with repo-cache import instead"); err != nil {
+		return "", err
+	}
+
 	args := []string{"repo-update"}
 	args = append(args, repos...)
 	if prefsPath != "" {
@@ -665,6 +775,10 @@ func SearchRecipes(term string, options *SearchOptions) (string, error) {
 		return "", fmt.Errorf("search term is required")
 	}
 
+	if err := requireNetwork("search", "list the local recipes with list-recipes instead"); err != nil {
+		return "", err
+	}
+
 	args := []string{"search"}
 
 	if options.PrefsPath != "" {
@@ -742,6 +856,13 @@ type RunOptions struct {
 	OverrideDirs             []string
 	UpdateTrust              bool
 	VerboseLevel             int
+	GitHubToken              string          // Passed via --key and the environment instead of a token file
+	Arch                     string          // Run autopkg as this architecture with arch(1), e.g. x86_64 under Rosetta
+	Context                  context.Context // Kills autopkg when cancelled
+	OutputLine               func(string)    // Called with each output line while autopkg runs
+	Log                      io.Writer       // Also receives the output while autopkg runs, e.g. the recipe's archived log
+	Home                     string          // Runs autopkg with HOME set to this directory, for isolated batches
+	Env                      []string        // Extra environment variables for autopkg, e.g. download proxies
 }
 
 // RunRecipe runs a recipe and captures the output
@@ -781,6 +902,11 @@ func RunRecipe(recipe string, options *RunOptions) (string, error) {
 		options = &RunOptions{}
 	}
 
+	// Without a cached download the recipe's download step would reach the network
+	if Offline() && options.PkgOrDmgPath == "" {
+		return "", requireNetwork(fmt.Sprintf("run %s", recipe), "no cached download found for it in the AutoPkg cache")
+	}
+
 	args := []string{"run"}
 
 	if options.PrefsPath != "" {
@@ -839,17 +965,40 @@ func RunRecipe(recipe string, options *RunOptions) (string, error) {
 		args = append(args, "--update-trust-info")
 	}
 
+	args = append(args, githubTokenArgs(options.GitHubToken)...)
+
 	if options.RecipeList == "" && recipe != "" {
 		args = append(args, recipe)
 	}
 
-	logger.Logger(fmt.Sprintf("🖥️ Running command: autopkg %s", strings.Join(args, " ")), logger.LogDebug)
+	logger.Logger(fmt.Sprintf("🖥️ Running command: autopkg %s", strings.Join(redactArgs(args), " ")), logger.LogDebug)
 
-	cmd := exec.Command("autopkg", args...)
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cmd := exec.CommandContext(ctx, "autopkg", args...)
+	if options.Arch != "" {
+		cmd = exec.CommandContext(ctx, "arch", append([]string{"-" + options.Arch, "autopkg"}, args...)...)
+	}
+	cmd.Env = githubTokenEnv(options.GitHubToken)
+	if options.Home != "" {
+		cmd.Env = append(cmd.Env, "HOME="+options.Home)
+	}
+	cmd.Env = append(cmd.Env, options.Env...)
 
 	var outputBuffer bytes.Buffer
-	cmd.Stdout = &outputBuffer
-	cmd.Stderr = &outputBuffer
+	writers := []io.Writer{&outputBuffer}
+	if options.OutputLine != nil {
+		writers = append(writers, &lineWriter{onLine: options.OutputLine})
+	}
+	if options.Log != nil {
+		writers = append(writers, options.Log)
+	}
+	output := io.MultiWriter(writers...)
+	cmd.Stdout = output
+	cmd.Stderr = output
 
 	if err := cmd.Run(); err != nil {
 		outputStr := outputBuffer.String()
@@ -967,19 +1116,109 @@ func VerifyTrustInfoForRecipes(recipes []string, options *VerifyTrustInfoOptions
 
 	logger.Logger(fmt.Sprintf("DEBUG: verify-trust-info output:\n%s", outputStr), logger.LogDebug)
 
+	failedRecipes, failureReasons, _ := parseVerifyTrustOutput(outputStr)
+
+	if execErr != nil || len(failedRecipes) > 0 {
+		logger.Logger(fmt.Sprintf("❌ Trust verification failed for %d recipes", len(failedRecipes)), logger.LogError)
+		for _, recipe := range failedRecipes {
+			logger.Logger(fmt.Sprintf("  - %s:", recipe), logger.LogWarning)
+			for _, reason := range failureReasons[recipe] {
+				logger.Logger(fmt.Sprintf("    • %s", reason), logger.LogWarning)
+			}
+		}
+
+		if options.VerboseLevel > 0 {
+			logger.Logger(outputStr, logger.LogDebug)
+		}
+		return false, failedRecipes, outputStr, fmt.Errorf("verify trust info failed for %d recipes", len(failedRecipes))
+	}
+
+	logger.Logger("✅ Trust verification passed for all recipes", logger.LogSuccess)
+	return true, nil, outputStr, nil
+}
+
+// TrustVerification is the outcome of one recipe in a batched trust verification
+type TrustVerification struct {
+	Recipe  string
+	Passed  bool
+	Reasons []string // Why verification failed, as reported by autopkg
+}
+
+// VerifyTrustInfoBatch verifies the trust info of many recipes with a single
+// verify-trust-info invocation, rather than starting autopkg once per recipe,
+// and maps the combined output back to each recipe. Recipes whose outcome
+// can't be told from the output, e.g. because autopkg failed before reaching
+// them, are left out of the result so callers can verify them on their own.
+func VerifyTrustInfoBatch(recipes []string, options *VerifyTrustInfoOptions) (map[string]*TrustVerification, error) {
+	if len(recipes) == 0 {
+		return map[string]*TrustVerification{}, nil
+	}
+	if options == nil {
+		options = &VerifyTrustInfoOptions{}
+	}
+
+	batchOptions := *options
+	batchOptions.RecipeList = ""
+	// -v makes autopkg print an OK line for every recipe that passes
+	if batchOptions.VerboseLevel == 0 {
+		batchOptions.VerboseLevel = 1
+	}
+
+	logger.Logger(fmt.Sprintf("🔒 Verifying trust info for %d recipes in one autopkg run", len(recipes)), logger.LogInfo)
+	success, _, output, err := VerifyTrustInfoForRecipes(recipes, &batchOptions)
+
+	// autopkg may report a recipe by path or name, so match on the base name
+	failed, reasons, passed := parseVerifyTrustOutput(output)
+	failedReasons := make(map[string][]string, len(failed))
+	for _, name := range failed {
+		failedReasons[recipeBaseName(name)] = reasons[name]
+	}
+	passedNames := make(map[string]bool, len(passed))
+	for name := range passed {
+		passedNames[recipeBaseName(name)] = true
+	}
+
+	results := make(map[string]*TrustVerification, len(recipes))
+	for _, recipe := range recipes {
+		name := recipeBaseName(recipe)
+		if recipeReasons, found := failedReasons[name]; found {
+			results[recipe] = &TrustVerification{Recipe: recipe, Reasons: recipeReasons}
+		} else if passedNames[name] || success {
+			results[recipe] = &TrustVerification{Recipe: recipe, Passed: true}
+		}
+	}
+
+	if err != nil && len(failed) == 0 && len(passed) == 0 {
+		return results, fmt.Errorf("batched trust verification failed without per-recipe results: %w", err)
+	}
+	return results, nil
+}
+
+// parseVerifyTrustOutput reads verify-trust-info output, returning the recipes
+// that failed with the reasons given, and the recipes reported as OK
+func parseVerifyTrustOutput(output string) ([]string, map[string][]string, map[string]bool) {
 	var failedRecipes []string
 	failureReasons := make(map[string][]string)
+	passedRecipes := make(map[string]bool)
 	var currentRecipe string
 
-	lines := strings.Split(outputStr, "\n")
+	lines := strings.Split(output, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 
 		// Detect trust failures
 		if strings.HasSuffix(line, ": FAILED") {
-			currentRecipe = strings.Split(line, ":")[0]
+			currentRecipe = strings.TrimSuffix(line, ": FAILED")
 			failedRecipes = append(failedRecipes, currentRecipe)
 			failureReasons[currentRecipe] = []string{"Unknown failure reason. try including -vvv in the options"}
+		} else if strings.HasSuffix(line, ": OK") {
+			currentRecipe = ""
+			passedRecipes[strings.TrimSuffix(line, ": OK")] = true
+		} else if name, found := strings.CutPrefix(line, "No valid recipe found for "); found {
+			// Missing recipes fail verification without a FAILED line
+			currentRecipe = ""
+			failedRecipes = append(failedRecipes, name)
+			failureReasons[name] = []string{"Recipe not found"}
 		} else if strings.HasPrefix(line, "No trust information present.") && currentRecipe != "" {
 			// Capture missing trust info
 			failureReasons[currentRecipe] = []string{"No trust information present."}
@@ -995,23 +1234,7 @@ func VerifyTrustInfoForRecipes(recipes []string, options *VerifyTrustInfoOptions
 		}
 	}
 
-	if execErr != nil || len(failedRecipes) > 0 {
-		logger.Logger(fmt.Sprintf("❌ Trust verification failed for %d recipes", len(failedRecipes)), logger.LogError)
-		for _, recipe := range failedRecipes {
-			logger.Logger(fmt.Sprintf("  - %s:", recipe), logger.LogWarning)
-			for _, reason := range failureReasons[recipe] {
-				logger.Logger(fmt.Sprintf("    • %s", reason), logger.LogWarning)
-			}
-		}
-
-		if options.VerboseLevel > 0 {
-			logger.Logger(outputStr, logger.LogDebug)
-		}
-		return false, failedRecipes, outputStr, fmt.Errorf("verify trust info failed for %d recipes", len(failedRecipes))
-	}
-
-	logger.Logger("✅ Trust verification passed for all recipes", logger.LogSuccess)
-	return true, nil, outputStr, nil
+	return failedRecipes, failureReasons, passedRecipes
 }
 
 // UpdateTrustInfoForRecipes updates or adds parent recipe trust info for one or more recipe overrides
@@ -0,0 +1,120 @@
+// credential_preflight.go
+package autopkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// PreflightError lists the MDM credentials that failed their check before a
+// batch, which then runs none of its recipes
+type PreflightError struct {
+	Problems []string
+}
+
+// Error implements error
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("credential preflight failed, no recipes were run:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// credentialPreflights check the credentials of an integration before a batch
+// uploads with them, returning a description of what was checked, by
+// integration name
+var credentialPreflights = map[string]func(prefs map[string]interface{}) (string, error){
+	"jamf":   preflightJamf,
+	"intune": preflightIntune,
+}
+
+// preflightCredentials checks the credentials of every MDM the upload recipes
+// of a batch upload to, once per tenant, so a wrong password or a missing
+// privilege fails the batch up front rather than every upload recipe in it
+// with an uploader error. It returns a *PreflightError listing every problem.
+func (o *RecipeBatchRunOptions) preflightCredentials(recipes []string) error {
+	checked := make(map[string]bool)
+	var problems []string
+	for _, recipe := range recipes {
+		name := recipeUploadType(recipe)
+		preflight := credentialPreflights[name]
+		if preflight == nil {
+			continue
+		}
+		integration := Integration(name)
+
+		for _, prefsPath := range o.uploadPrefsPaths(recipe) {
+			prefs, err := GetAutoPkgPreferences(prefsPath)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", integration.DisplayName(), err))
+				continue
+			}
+			// Variables are passed with --key, overriding the preferences
+			if !o.fansOut(recipe) {
+				for key, value := range o.Variables {
+					prefs[key] = value
+				}
+				if overrides := o.recipeOverrides(recipe); overrides != nil {
+					for key, value := range overrides.Variables {
+						prefs[key] = value
+					}
+				}
+			}
+
+			tenant := name + "|" + prefsPath + "|" + integration.Tenant(prefs)
+			if checked[tenant] {
+				continue
+			}
+			checked[tenant] = true
+
+			detail, err := preflight(prefs)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%s): %v", integration.DisplayName(), prefsPath, err))
+				continue
+			}
+			logger.Logger(fmt.Sprintf("🔑 %s credentials OK: %s", integration.DisplayName(), detail), logger.LogSuccess)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &PreflightError{Problems: problems}
+}
+
+// preflightJamf signs in to Jamf Pro and checks the account can upload
+// packages and update policies
+func preflightJamf(prefs map[string]interface{}) (string, error) {
+	check, err := CheckJamfCredentials(prefs)
+	if err != nil {
+		return "", err
+	}
+	if len(check.MissingPrivileges) > 0 {
+		return "", fmt.Errorf("%s on %s is missing the privileges %s, grant them in Jamf Pro or JamfUploader can't upload packages and update policies", check.Account, check.Server, strings.Join(check.MissingPrivileges, ", "))
+	}
+
+	detail := fmt.Sprintf("%s signed in to %s with %s auth", check.Account, check.Server, check.AuthMethod)
+	if !check.TokenExpires.IsZero() {
+		detail += fmt.Sprintf(", token valid until %s", check.TokenExpires.Local().Format("15:04"))
+	}
+	if !check.PrivilegesChecked {
+		logger.Logger(fmt.Sprintf("⚠️ Jamf Pro %s didn't list the privileges of %s, make sure it can %s", check.Server, check.Account, strings.ToLower(strings.Join(JamfRequiredPrivileges, ", "))), logger.LogWarning)
+	}
+	return detail, nil
+}
+
+// preflightIntune gets a Graph token for the Intune app registration and
+// checks it was granted IntuneRequiredPermission and isn't being throttled
+func preflightIntune(prefs map[string]interface{}) (string, error) {
+	check, err := CheckIntuneCredentials(prefs)
+	if err != nil {
+		return "", err
+	}
+	if !check.PermissionGranted {
+		return "", fmt.Errorf("app %s in tenant %s hasn't been granted %s, add the application permission and grant admin consent or IntuneAppUploader can't upload apps", check.ClientID, check.TenantID, IntuneRequiredPermission)
+	}
+	if check.Throttled {
+		return "", fmt.Errorf("app %s in tenant %s is being throttled by Intune (%s), run the batch later", check.ClientID, check.TenantID, check.ThrottleHeadroom())
+	}
+
+	return fmt.Sprintf("app %s signed in to tenant %s, token valid until %s, %s", check.ClientID, check.TenantID, check.TokenExpires.Local().Format("15:04"), check.ThrottleHeadroom()), nil
+}
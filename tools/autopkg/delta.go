@@ -0,0 +1,142 @@
+// delta.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+// VersionChange is a new version of an app since the previous successful run
+type VersionChange struct {
+	Recipe     string `json:"recipe"`
+	App        string `json:"app"`
+	OldVersion string `json:"old_version,omitempty"` // Empty when the app has not been built before
+	NewVersion string `json:"new_version"`
+}
+
+// Summary describes the change in the configured locale, e.g. "Firefox: 120.0 → 121.0 (Firefox.jamf)"
+func (c VersionChange) Summary() string {
+	if c.OldVersion == "" {
+		return i18n.T("notify.version_new", c.App, c.NewVersion, c.Recipe)
+	}
+	return i18n.T("notify.version_changed", c.App, c.OldVersion, c.NewVersion, c.Recipe)
+}
+
+// LastSuccessful returns the latest run of a recipe before a time that
+// produced a version, or nil if there is none
+func (h *History) LastSuccessful(recipe string, before time.Time) (*HistoryEntry, error) {
+	var found *HistoryEntry
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyRecipesBucket).Bucket([]byte(recipe))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		key, value := cursor.Seek([]byte(before.UTC().Format(historyKeyFormat)))
+		if key == nil {
+			key, value = cursor.Last()
+		} else {
+			key, value = cursor.Prev()
+		}
+
+		for ; key != nil; key, value = cursor.Prev() {
+			var entry HistoryEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return fmt.Errorf("failed to parse history entry %s: %w", key, err)
+			}
+			if !entry.Timestamp.Before(before) {
+				continue
+			}
+			if entry.Status != "failed" && entry.Status != "skipped" && entry.Status != StatusBlocked && entry.Version != "" {
+				found = &entry
+				return nil
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// DetectVersionChanges compares the versions produced by a batch with the
+// previous successful run of each recipe, and returns only those that changed
+func DetectVersionChanges(history *History, results map[string]*RecipeBatchResult, before time.Time) ([]VersionChange, error) {
+	var changes []VersionChange
+	for recipe, result := range results {
+		if result.Status == "failed" || result.Status == "skipped" || result.Status == StatusBlocked || len(result.Artifacts) == 0 {
+			continue
+		}
+
+		current := result.Artifacts[0]
+		if current.Version == "" {
+			continue
+		}
+
+		previous, err := history.LastSuccessful(recipe, before)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil && previous.Version == current.Version {
+			continue
+		}
+
+		change := VersionChange{
+			Recipe:     recipe,
+			App:        current.App,
+			NewVersion: current.Version,
+		}
+		if previous != nil {
+			change.OldVersion = previous.Version
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].App < changes[j].App
+	})
+	return changes, nil
+}
+
+// notifyVersionChanges sends a single notification listing the new versions of a batch
+func notifyVersionChanges(options *RecipeBatchRunOptions, changes []VersionChange) {
+	if len(changes) == 0 {
+		logger.Logger("ℹ️ No new versions since the previous run, skipping change notification", logger.LogInfo)
+		return
+	}
+
+	var slackLines, teamsLines []string
+	for _, change := range changes {
+		slackLines = append(slackLines, "• "+change.Summary())
+		teamsLines = append(teamsLines, "- "+change.Summary())
+	}
+
+	title := i18n.T("notify.version_changes", len(changes))
+
+	if options.Notification.EnableSlack {
+		slackNotifier := &SlackNotifier{
+			WebhookURL: options.Notification.SlackWebhook,
+			Username:   options.Notification.SlackUsername,
+			Channel:    options.Notification.SlackChannel,
+			IconEmoji:  options.Notification.SlackIcon,
+		}
+		if err := slackNotifier.Notify(title, strings.Join(slackLines, "\n"), "good"); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to send version changes to Slack: %v", err), logger.LogWarning)
+		}
+	}
+
+	if options.Notification.EnableTeams {
+		teamsNotifier := &MSTeamsNotifier{
+			WebhookURL: options.Notification.TeamsWebhook,
+		}
+		if err := teamsNotifier.NotifyMSTeams(title, strings.Join(teamsLines, "\n"), false, false, "", ""); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to send version changes to Teams: %v", err), logger.LogWarning)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// download_proxy.go
+package autopkg
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// defaultCurlPath is the curl AutoPkg downloads with when CURL_PATH isn't set
+const defaultCurlPath = "/usr/bin/curl"
+
+// curlPathKey is the AutoPkg variable and preference naming the curl binary
+const curlPathKey = "CURL_PATH"
+
+// DownloadProxy routes recipe downloads through a proxy and rewrites download
+// URLs to internal mirrors, for runners without direct internet access.
+// Proxies are passed to autopkg as the usual *_proxy environment variables.
+// AutoPkg has no URL rewriting of its own, so mirrors are applied by a curl
+// wrapper passed to autopkg as CURL_PATH, which covers URLDownloader,
+// URLTextSearcher and the GitHub processors alike.
+type DownloadProxy struct {
+	HTTPProxy  string            `yaml:"http_proxy,omitempty"`
+	HTTPSProxy string            `yaml:"https_proxy,omitempty"`
+	NoProxy    string            `yaml:"no_proxy,omitempty"` // Comma-separated hosts reached directly
+	Mirrors    map[string]string `yaml:"mirrors,omitempty"`  // Host or URL prefix to the mirror URL replacing it, e.g. download.mozilla.org: https://mirror.example.com/mozilla
+}
+
+// ParseDownloadMirrors parses mirrors given as source=mirror pairs
+func ParseDownloadMirrors(pairs []string) (map[string]string, error) {
+	mirrors := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		source, mirror, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(source) == "" || strings.TrimSpace(mirror) == "" {
+			return nil, fmt.Errorf("invalid download mirror %q, expected host=mirror URL", pair)
+		}
+		mirrors[strings.TrimSpace(source)] = strings.TrimSpace(mirror)
+	}
+	return mirrors, nil
+}
+
+// IsZero reports whether the download proxy changes nothing
+func (p *DownloadProxy) IsZero() bool {
+	return p == nil || (p.HTTPProxy == "" && p.HTTPSProxy == "" && p.NoProxy == "" && len(p.Mirrors) == 0)
+}
+
+// Validate checks the proxies and mirrors are URLs curl can use
+func (p *DownloadProxy) Validate() error {
+	if p == nil {
+		return nil
+	}
+
+	for _, proxy := range []struct{ name, value string }{{"http_proxy", p.HTTPProxy}, {"https_proxy", p.HTTPSProxy}} {
+		if proxy.value == "" {
+			continue
+		}
+		parsed, err := url.Parse(proxy.value)
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("%s %q is not a URL, expected e.g. http://proxy.example.com:3128", proxy.name, proxy.value)
+		}
+		switch parsed.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("%s %q must use http, https, socks5 or socks5h", proxy.name, proxy.value)
+		}
+	}
+
+	for _, source := range p.mirrorSources() {
+		if _, err := mirrorPrefixes(source); err != nil {
+			return err
+		}
+		mirror, err := url.Parse(p.Mirrors[source])
+		if err != nil || mirror.Host == "" || (mirror.Scheme != "http" && mirror.Scheme != "https") {
+			return fmt.Errorf("mirror %q for %s must be an http or https URL", p.Mirrors[source], source)
+		}
+	}
+	return nil
+}
+
+// mirrorSources returns the mirrored hosts and prefixes, longest first so a
+// mirror for a path wins over one for its whole host
+func (p *DownloadProxy) mirrorSources() []string {
+	sources := make([]string, 0, len(p.Mirrors))
+	for source := range p.Mirrors {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if len(sources[i]) != len(sources[j]) {
+			return len(sources[i]) > len(sources[j])
+		}
+		return sources[i] < sources[j]
+	})
+	return sources
+}
+
+// mirrorPrefixes returns the URL prefixes a mirror source matches: a bare
+// host matches it over http and https, a URL matches only itself
+func mirrorPrefixes(source string) ([]string, error) {
+	if !strings.Contains(source, "://") {
+		if strings.ContainsAny(source, "/?#") {
+			return nil, fmt.Errorf("mirror source %q must be a host or an http or https URL", source)
+		}
+		return []string{"https://" + source, "http://" + source}, nil
+	}
+
+	parsed, err := url.Parse(source)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("mirror source %q must be a host or an http or https URL", source)
+	}
+	return []string{strings.TrimSuffix(source, "/")}, nil
+}
+
+// env returns the proxy environment of autopkg. Both cases are set, as curl
+// only reads http_proxy in lower case and Python reads either.
+func (p *DownloadProxy) env() []string {
+	var env []string
+	for _, variable := range []struct{ name, value string }{
+		{"http_proxy", p.HTTPProxy},
+		{"https_proxy", p.HTTPSProxy},
+		{"no_proxy", p.NoProxy},
+	} {
+		if variable.value == "" {
+			continue
+		}
+		env = append(env, variable.name+"="+variable.value, strings.ToUpper(variable.name)+"="+variable.value)
+	}
+	return env
+}
+
+// curlWrapper returns a POSIX shell script that rewrites mirrored URLs among
+// its arguments and then runs curl with them. Only whole prefixes are
+// rewritten, so download.mozilla.org doesn't match download.mozilla.org.evil.com.
+func (p *DownloadProxy) curlWrapper(curlPath string) string {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	script.WriteString("# Generated by autopkgctl: rewrites download URLs to their mirrors, then runs curl\n")
+	script.WriteString("for arg do\n\tshift\n\tcase \"$arg\" in\n")
+	for _, source := range p.mirrorSources() {
+		prefixes, _ := mirrorPrefixes(source)
+		mirror := strings.TrimSuffix(p.Mirrors[source], "/")
+		for _, prefix := range prefixes {
+			quoted := shellQuote(prefix)
+			fmt.Fprintf(&script, "\t%s|%s/*|%s\\?*) arg=%s\"${arg#%s}\" ;;\n", quoted, quoted, quoted, shellQuote(mirror), quoted)
+		}
+	}
+	script.WriteString("\tesac\n\tset -- \"$@\" \"$arg\"\ndone\n")
+	fmt.Fprintf(&script, "exec %s \"$@\"\n", shellQuote(curlPath))
+	return script.String()
+}
+
+// shellQuote quotes a value for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// downloadProxyRun is the download proxy of a running batch
+type downloadProxyRun struct {
+	proxy       *DownloadProxy
+	wrapperPath string // curl wrapper applying the mirrors, "" without mirrors
+}
+
+// newDownloadProxyRun writes the curl wrapper of a batch's mirrors. The real
+// curl is the batch's CURL_PATH variable or preference, or the system curl.
+func newDownloadProxyRun(options *RecipeBatchRunOptions) (*downloadProxyRun, error) {
+	if err := options.DownloadProxy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid download proxy: %w", err)
+	}
+	run := &downloadProxyRun{proxy: options.DownloadProxy}
+	if len(run.proxy.Mirrors) == 0 {
+		return run, nil
+	}
+
+	curlPath := options.Variables[curlPathKey]
+	if curlPath == "" {
+		if prefs, err := GetAutoPkgPreferences(options.PrefsPath); err == nil {
+			curlPath, _ = prefs[curlPathKey].(string)
+		}
+	}
+	if curlPath == "" {
+		curlPath = defaultCurlPath
+	}
+
+	file, err := os.CreateTemp("", fmt.Sprintf("autopkgctl-curl-%s-", options.RunID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create curl wrapper: %w", err)
+	}
+	if _, err := file.WriteString(run.proxy.curlWrapper(curlPath)); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to write curl wrapper: %w", err)
+	}
+	file.Close()
+	if err := os.Chmod(file.Name(), 0755); err != nil {
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to make curl wrapper executable: %w", err)
+	}
+
+	run.wrapperPath = file.Name()
+	logger.Logger(fmt.Sprintf("🪞 Rewriting downloads from %s to mirrors with %s", strings.Join(run.proxy.mirrorSources(), ", "), filepath.Base(run.wrapperPath)), logger.LogInfo)
+	return run, nil
+}
+
+// apply routes a recipe run's downloads through the proxy and mirrors
+func (r *downloadProxyRun) apply(runOpts *RunOptions) {
+	if r == nil {
+		return
+	}
+	runOpts.Env = append(runOpts.Env, r.proxy.env()...)
+	if r.wrapperPath == "" {
+		return
+	}
+
+	variables := make(map[string]string, len(runOpts.Variables)+1)
+	for key, value := range runOpts.Variables {
+		variables[key] = value
+	}
+	variables[curlPathKey] = r.wrapperPath
+	runOpts.Variables = variables
+}
+
+// remove deletes the curl wrapper
+func (r *downloadProxyRun) remove() {
+	if r.wrapperPath == "" {
+		return
+	}
+	if err := os.Remove(r.wrapperPath); err != nil && !os.IsNotExist(err) {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to remove curl wrapper %s: %v", r.wrapperPath, err), logger.LogWarning)
+	}
+}
@@ -0,0 +1,226 @@
+// events.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Event types published while a batch or workflow runs
+const (
+	EventRecipeStarted    = "recipe.started"
+	EventRecipeFinished   = "recipe.finished"
+	EventTrustFailed      = "trust.failed"
+	EventArtifactProduced = "artifact.produced"
+	EventRunFinished      = "run.finished"
+	EventWorkflowFinished = "workflow.finished"
+)
+
+// Event is something that happened during a batch or workflow. Which fields
+// are set depends on the type: recipe events carry the recipe and, once it
+// finished, its result; artifact.produced the artifact; run.finished the run
+// record and every result; workflow.finished the workflow.
+type Event struct {
+	Type      string                        `json:"type"`
+	RunID     string                        `json:"run_id"`
+	Timestamp time.Time                     `json:"timestamp"`
+	Chaos     bool                          `json:"chaos,omitempty"`
+	Recipe    string                        `json:"recipe,omitempty"`
+	Status    string                        `json:"status,omitempty"` // Recipe or run status
+	Error     string                        `json:"error,omitempty"`
+	Artifact  *ProducedArtifact             `json:"artifact,omitempty"`
+	Record    *RunRecord                    `json:"run,omitempty"`
+	Workflow  *WorkflowEvent                `json:"workflow,omitempty"`
+	Result    *RecipeBatchResult            `json:"-"`
+	Results   map[string]*RecipeBatchResult `json:"-"`
+}
+
+// WorkflowEvent summarises a workflow for workflow.finished events
+type WorkflowEvent struct {
+	Name     string  `json:"name"`
+	Steps    int     `json:"steps"`
+	Failed   int     `json:"failed"`
+	Skipped  int     `json:"skipped"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// EventSink receives the events published on an EventBus. Handle is called
+// from the goroutine publishing, one event at a time; an error is logged and
+// doesn't stop the event reaching the other sinks.
+type EventSink interface {
+	Name() string
+	Handle(event Event) error
+}
+
+// EventBus passes events to its sinks, so notifications, webhooks, metrics
+// and other integrations follow a batch without the batch knowing about them
+type EventBus struct {
+	mu    sync.Mutex
+	sinks []EventSink
+}
+
+// NewEventBus creates a bus passing events to the sinks
+func NewEventBus(sinks ...EventSink) *EventBus {
+	return &EventBus{sinks: append([]EventSink{}, sinks...)}
+}
+
+// Subscribe adds a sink to the bus
+func (b *EventBus) Subscribe(sink EventSink) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sinks = append(b.sinks, sink)
+}
+
+// Publish passes an event to every sink in the order they subscribed,
+// stamping it with the current time when it has none. A nil bus drops events.
+func (b *EventBus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sink := range b.sinks {
+		if err := sink.Handle(event); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Event sink %s failed to handle %s: %v", sink.Name(), event.Type, err), logger.LogWarning)
+		}
+	}
+}
+
+// LogEventSink logs every event at debug level
+type LogEventSink struct{}
+
+// Name implements EventSink
+func (LogEventSink) Name() string { return "log" }
+
+// Handle implements EventSink
+func (LogEventSink) Handle(event Event) error {
+	message := fmt.Sprintf("📣 %s", event.Type)
+	switch {
+	case event.Artifact != nil:
+		message += fmt.Sprintf(" %s: %s", event.Recipe, event.Artifact.Path)
+	case event.Recipe != "":
+		message += " " + event.Recipe
+	case event.Workflow != nil:
+		message += " " + event.Workflow.Name
+	}
+	if event.Status != "" {
+		message += fmt.Sprintf(" (%s)", event.Status)
+	}
+	logger.Logger(message, logger.LogDebug)
+	return nil
+}
+
+// FileEventSink appends every event to a file as one JSON line
+type FileEventSink struct {
+	Path string
+}
+
+// Name implements EventSink
+func (s *FileEventSink) Name() string { return "file " + s.Path }
+
+// Handle implements EventSink
+func (s *FileEventSink) Handle(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return appendLocalNotification(s.Path, data)
+}
+
+// MetricsEventSink writes the Prometheus metrics of a run when it finishes,
+// see WriteRunMetrics
+type MetricsEventSink struct {
+	Path string
+}
+
+// Name implements EventSink
+func (s *MetricsEventSink) Name() string { return "metrics " + s.Path }
+
+// Handle implements EventSink
+func (s *MetricsEventSink) Handle(event Event) error {
+	if event.Type != EventRunFinished || event.Record == nil {
+		return nil
+	}
+	return WriteRunMetrics(s.Path, event.RunID, event.Results, event.Record.StartTime)
+}
+
+// WebhookEventSink delivers a finished run to a webhook subscription as
+// recipe.updated and recipe.failed events followed by run.completed, once
+// the results are final
+type WebhookEventSink struct {
+	Subscription WebhookSubscription
+}
+
+// Name implements EventSink
+func (s *WebhookEventSink) Name() string { return "webhook " + s.Subscription.URL }
+
+// Handle implements EventSink
+func (s *WebhookEventSink) Handle(event Event) error {
+	if event.Type != EventRunFinished || event.Record == nil {
+		return nil
+	}
+	sendRunWebhooks(s.Subscription, event.RunID, event.Results, event.Record)
+	return nil
+}
+
+// notificationEventSink sends Teams and Slack notifications for the recipes
+// of a batch as they finish, and the version changes when it finishes
+type notificationEventSink struct {
+	options *RecipeBatchRunOptions
+}
+
+// Name implements EventSink
+func (s *notificationEventSink) Name() string { return "notifications" }
+
+// Handle implements EventSink
+func (s *notificationEventSink) Handle(event Event) error {
+	switch event.Type {
+	case EventRecipeFinished:
+		// Only recipes that ran, failed trust or had a fault injected are
+		// notified, and downloads are notified through the recipes they feed
+		result := event.Result
+		if result == nil || s.options.Phase == PhaseDownload {
+			return nil
+		}
+		if result.Executed || result.VerificationError != nil || result.ChaosFault != "" {
+			handleNotifications(result, s.options)
+		}
+	case EventRunFinished:
+		if s.options.Notification.ChangesOnly && event.Record != nil {
+			notifyVersionChanges(s.options, event.Record.Changes)
+		}
+	}
+	return nil
+}
+
+// newEventBus creates the bus of a batch: its own sinks, then notifications,
+// metrics and webhooks as the options configure them, and the debug log
+func (o *RecipeBatchRunOptions) newEventBus() *EventBus {
+	bus := NewEventBus(o.EventSinks...)
+	if o.Notification.EnableTeams || o.Notification.EnableSlack {
+		bus.Subscribe(&notificationEventSink{options: o})
+	}
+	if o.MetricsPath != "" {
+		bus.Subscribe(&MetricsEventSink{Path: o.MetricsPath})
+	}
+	for _, subscription := range o.Webhooks {
+		bus.Subscribe(&WebhookEventSink{Subscription: subscription})
+	}
+	bus.Subscribe(LogEventSink{})
+	return bus
+}
+
+// publish passes an event of the batch to its bus, if it's running
+func (o *RecipeBatchRunOptions) publish(event Event) {
+	event.RunID = o.RunID
+	event.Chaos = o.Chaos != nil
+	o.events.Publish(event)
+}
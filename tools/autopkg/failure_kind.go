@@ -0,0 +1,128 @@
+// failure_kind.go
+package autopkg
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Failure kinds classify why a recipe failed, from its autopkg output
+const (
+	FailureKindDownloadNotFound   = "download-404"
+	FailureKindChecksumMismatch   = "checksum-mismatch"
+	FailureKindSignatureCheck     = "signature-check-failed"
+	FailureKindUploaderAuth       = "uploader-auth"
+	FailureKindTrust              = "trust-failed"
+	FailureKindProcessorException = "processor-exception"
+	FailureKindNetworkTimeout     = "network-timeout"
+	FailureKindServerError        = "server-error"
+	FailureKindRateLimited        = "rate-limited"
+	FailureKindCancelled          = "cancelled"
+	FailureKindNotNotarized       = "not-notarized"       // Set by the notarization requirement, not classified from output
+	FailureKindGatekeeperRejected = "gatekeeper-rejected" // Set by the workflow Gatekeeper step, not classified from output
+	FailureKindSecurityScan       = "security-scan"       // Set by the workflow security gate step, not classified from output
+	FailureKindDenylisted         = "denylisted"          // Set by the hash list, not classified from output
+	FailureKindUnknown            = "unknown"
+)
+
+// failureClassifier matches autopkg output that identifies a failure kind
+type failureClassifier struct {
+	kind    string
+	pattern *regexp.Regexp
+	hint    string // What to do about failures of this kind
+}
+
+// failureClassifiers are tried in order, so deterministic failures are matched
+// before transient ones, and specific failures before the generic processor
+// error that autopkg wraps them in
+var failureClassifiers = []failureClassifier{
+	{
+		kind:    FailureKindTrust,
+		pattern: regexp.MustCompile(`(?i)failed (local )?trust verification|no trust information present|parent recipe trust|trust info[^\n]*(fail|mismatch|differ)`),
+		hint:    "Review the parent recipe changes, then run update-trust-info for the override",
+	},
+	{
+		kind:    FailureKindDownloadNotFound,
+		pattern: regexp.MustCompile(`(?i)(http error|returned error|status( code)?|response)[:\s]*404|404:? not found`),
+		hint:    "The download URL no longer exists; check the vendor site and the recipe's URL or search pattern",
+	},
+	{
+		kind:    FailureKindChecksumMismatch,
+		pattern: regexp.MustCompile(`(?i)(checksum|hash|sha-?256|md5)[^\n]*(mismatch|does not match|doesn't match|differs)|does not match expected (checksum|hash)`),
+		hint:    "The download changed without a new version; confirm it is genuine before updating the expected checksum",
+	},
+	{
+		kind:    FailureKindSignatureCheck,
+		pattern: regexp.MustCompile(`(?i)code ?signature verification failed|authority name chain|mismatch in authority names|signature (check|verification) failed|team ?id (mismatch|does not match)|codesign[^\n]*(fail|invalid)`),
+		hint:    "The vendor's signing identity changed; verify the new signature before updating the override's requirement",
+	},
+	{
+		kind:    FailureKindRateLimited,
+		pattern: regexp.MustCompile(`(?i)rate limit (exceeded|reached)|too many requests|\b429\b`),
+		hint:    "GitHub or the CDN is rate limiting the runner; set a GitHub token or spread runs out",
+	},
+	{
+		kind:    FailureKindServerError,
+		pattern: regexp.MustCompile(`(?i)(http error|returned error|status( code)?|response)[:\s]*5\d\d|\b(500 internal server error|502 bad gateway|503 service unavailable|504 gateway time-?out)`),
+		hint:    "The server had an error; it usually passes, so retry later",
+	},
+	{
+		kind:    FailureKindNetworkTimeout,
+		pattern: regexp.MustCompile(`(?i)timed out|timeout|curl: \((6|7|28|35|52|56)\)|connection (reset|refused)|temporary failure in name resolution|network is unreachable`),
+		hint:    "The network timed out; it usually passes, so retry later",
+	},
+	{
+		kind:    FailureKindUploaderAuth,
+		pattern: regexp.MustCompile(`(?i)(http (error|response|status)|status code|returned)[^\n]*\b40[13]\b|\b401 unauthorized|\b403 forbidden|invalid_client|invalid_grant|authentication failed|(failed to (get|obtain|retrieve)|could not (get|obtain)) (an? )?(access |bearer |api )?token`),
+		hint:    "Check the MDM credentials in the preferences and the API client's permissions",
+	},
+	{
+		kind:    FailureKindProcessorException,
+		pattern: regexp.MustCompile(`(?m)(^Error in [^\n]*: Processor: |Traceback \(most recent call last\)|ProcessorError)`),
+		hint:    "A processor raised an error; run the recipe with -vvv to see where",
+	},
+}
+
+// transientFailureKinds are the failure kinds that can pass on their own,
+// while every other kind fails the same way each time it is run
+var transientFailureKinds = map[string]bool{
+	FailureKindNetworkTimeout: true,
+	FailureKindServerError:    true,
+	FailureKindRateLimited:    true,
+}
+
+// IsTransientFailure reports whether a failure kind may pass when retried
+func IsTransientFailure(kind string) bool {
+	return transientFailureKinds[kind]
+}
+
+// ClassifyFailure returns the failure kind of a failed recipe from its output,
+// or "" when the recipe didn't fail
+func ClassifyFailure(output string, err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "recipe cancelled") {
+		return FailureKindCancelled
+	}
+
+	text := output + "\n" + err.Error()
+	for _, classifier := range failureClassifiers {
+		if classifier.pattern.MatchString(text) {
+			return classifier.kind
+		}
+	}
+	return FailureKindUnknown
+}
+
+// FailureHint returns the suggested remedy for a failure kind, or "" when there is none
+func FailureHint(kind string) string {
+	for _, classifier := range failureClassifiers {
+		if classifier.kind == kind {
+			return classifier.hint
+		}
+	}
+	return ""
+}
@@ -34,13 +34,20 @@ type FilterRecipesResult struct {
 
 // RecipeInfo contains metadata about a recipe
 type RecipeInfo struct {
-	Path          string
-	Identifier    string
-	Type          string
-	ParentRecipes []string
-	IsOverride    bool
-	IsDisabled    bool
-	ModTime       time.Time
+	Name          string    `json:"name" yaml:"name"`
+	Path          string    `json:"path" yaml:"path"`
+	Identifier    string    `json:"identifier" yaml:"identifier"`
+	Type          string    `json:"type,omitempty" yaml:"type,omitempty"`
+	ParentRecipes []string  `json:"parent_recipes,omitempty" yaml:"parent_recipes,omitempty"`
+	IsOverride    bool      `json:"is_override" yaml:"is_override"`
+	IsDisabled    bool      `json:"is_disabled" yaml:"is_disabled"`
+	ModTime       time.Time `json:"mod_time" yaml:"mod_time,omitempty"`
+
+	// Set by DescribeRecipe
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Input       map[string]string `json:"input,omitempty" yaml:"input,omitempty"`           // Input variables after the parent chain's are merged
+	Processors  []string          `json:"processors,omitempty" yaml:"processors,omitempty"` // Processors in run order, parents' first
+	Repo        string            `json:"repo,omitempty" yaml:"repo,omitempty"`             // Repo, or directory, the recipe comes from
 }
 
 // FilterRecipes filters recipes based on various criteria
@@ -98,21 +105,11 @@ func FilterRecipes(options *RecipeFilterCriteria, prefsPath string) (*FilterReci
 			continue
 		}
 
-		// The format is: name (identifier) - path
-		parts := strings.SplitN(line, " (", 2)
-		if len(parts) != 2 {
+		name, identifier, path, ok := parseRecipeListLine(line)
+		if !ok {
 			continue
 		}
 
-		name := strings.TrimSpace(parts[0])
-		remainingParts := strings.SplitN(parts[1], ") - ", 2)
-		if len(remainingParts) != 2 {
-			continue
-		}
-
-		identifier := strings.TrimSpace(remainingParts[0])
-		path := strings.TrimSpace(remainingParts[1])
-
 		// Apply name pattern filter
 		if nameRegex != nil && !nameRegex.MatchString(name) {
 			continue
@@ -129,21 +126,7 @@ func FilterRecipes(options *RecipeFilterCriteria, prefsPath string) (*FilterReci
 			continue
 		}
 
-		// Determine recipe type
-		recipeType := ""
-		if strings.HasSuffix(name, ".download") {
-			recipeType = "download"
-		} else if strings.HasSuffix(name, ".pkg") {
-			recipeType = "pkg"
-		} else if strings.HasSuffix(name, ".install") {
-			recipeType = "install"
-		} else if strings.HasSuffix(name, ".munki") {
-			recipeType = "munki"
-		} else if strings.HasSuffix(name, ".jamf") {
-			recipeType = "jamf"
-		} else if strings.HasSuffix(name, ".intune") {
-			recipeType = "intune"
-		}
+		recipeType := knownRecipeType(name)
 
 		// Filter by recipe type if specified
 		if len(options.RecipeTypes) > 0 {
@@ -159,8 +142,7 @@ func FilterRecipes(options *RecipeFilterCriteria, prefsPath string) (*FilterReci
 			}
 		}
 
-		// Check if it's an override
-		isOverride := strings.Contains(path, "RecipeOverrides") || strings.Contains(identifier, ".override.")
+		isOverride := isRecipeOverride(identifier, path)
 
 		// Get file modification time
 		fileInfo, err := os.Stat(path)
@@ -180,6 +162,7 @@ func FilterRecipes(options *RecipeFilterCriteria, prefsPath string) (*FilterReci
 
 		// Create recipe info
 		recipeInfo := RecipeInfo{
+			Name:       name,
 			Path:       path,
 			Identifier: identifier,
 			Type:       recipeType,
@@ -254,3 +237,82 @@ func FilterRecipes(options *RecipeFilterCriteria, prefsPath string) (*FilterReci
 	logger.Logger(fmt.Sprintf("✅ Found %d matching recipes", len(result.MatchingRecipes)), logger.LogSuccess)
 	return result, nil
 }
+
+// SelectRecipes filters the available recipes with the criteria. When
+// candidates are given, only those that also match are returned, in
+// candidate order. Candidates match by recipe name, so paths and any recipe
+// extension are ignored.
+func SelectRecipes(candidates []string, criteria *RecipeFilterCriteria, prefsPath string) ([]string, error) {
+	if criteria == nil {
+		criteria = &RecipeFilterCriteria{IncludeOverrides: true}
+	}
+
+	// The limit applies to the final selection, not to every available recipe
+	unlimited := *criteria
+	if len(candidates) > 0 {
+		unlimited.MaxRecipes = 0
+	}
+
+	filtered, err := FilterRecipes(&unlimited, prefsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) == 0 {
+		return filtered.MatchingRecipes, nil
+	}
+
+	matching := make(map[string]bool, len(filtered.MatchingRecipes))
+	for _, recipe := range filtered.MatchingRecipes {
+		matching[recipeBaseName(recipe)] = true
+	}
+
+	var selected []string
+	for _, candidate := range candidates {
+		if !matching[recipeBaseName(candidate)] {
+			continue
+		}
+		selected = append(selected, candidate)
+		if criteria.MaxRecipes > 0 && len(selected) >= criteria.MaxRecipes {
+			break
+		}
+	}
+	return selected, nil
+}
+
+// parseRecipeListLine splits a line of `autopkg list-recipes --with-identifiers
+// --with-paths` output, in the format "name (identifier) - path"
+func parseRecipeListLine(line string) (name string, identifier string, path string, ok bool) {
+	parts := strings.SplitN(line, " (", 2)
+	if len(parts) != 2 {
+		return "", "", "", false
+	}
+
+	remainingParts := strings.SplitN(parts[1], ") - ", 2)
+	if len(remainingParts) != 2 {
+		return "", "", "", false
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(remainingParts[0]), strings.TrimSpace(remainingParts[1]), true
+}
+
+// knownRecipeType returns the recipe type from its name suffix, e.g. "jamf"
+// for Firefox.jamf, or "" when the type isn't one the factory knows about.
+// Upload types come from the registered MDM integrations.
+func knownRecipeType(name string) string {
+	recipeTypes := []string{"download", "pkg", "install", "munki"}
+	for _, integration := range Integrations() {
+		recipeTypes = append(recipeTypes, integration.Name())
+	}
+	for _, recipeType := range recipeTypes {
+		if strings.HasSuffix(name, "."+recipeType) {
+			return recipeType
+		}
+	}
+	return ""
+}
+
+// isRecipeOverride reports whether a listed recipe is a local override
+func isRecipeOverride(identifier string, path string) bool {
+	return strings.Contains(path, "RecipeOverrides") || strings.Contains(identifier, ".override.")
+}
@@ -0,0 +1,160 @@
+// flakiness.go
+package autopkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// FlakinessOptions configures which recipes FindFlakyRecipes reports
+type FlakinessOptions struct {
+	Since    time.Time // Only consider runs since this time, zero for all
+	MinRuns  int       // Runs a recipe needs before it's scored, defaults to 4
+	MinScore float64   // Lowest score reported, 0 to 1, defaults to 0.3
+	Top      int       // Report at most this many recipes, 0 for all
+}
+
+// RecipeFlakiness scores how often a recipe alternates between success and
+// failure. A recipe failing every run is broken rather than flaky and scores 0.
+type RecipeFlakiness struct {
+	Recipe      string    `json:"recipe"`
+	Runs        int       `json:"runs"`
+	Failures    int       `json:"failures"`
+	Flips       int       `json:"flips"`        // Consecutive runs whose outcome differs
+	Score       float64   `json:"score"`        // Flips over the runs that could have flipped, 0 to 1
+	FailureRate float64   `json:"failure_rate"` // Failures over runs, 0 to 1
+	LastStatus  string    `json:"last_status"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// FindFlakyRecipes scores every recipe in the run history by how often its
+// outcome flipped between consecutive runs, ignoring skipped and blocked
+// runs, and returns those scoring at least MinScore, flakiest first
+func FindFlakyRecipes(history *History, options FlakinessOptions) ([]RecipeFlakiness, error) {
+	if options.MinRuns <= 0 {
+		options.MinRuns = 4
+	}
+	if options.MinScore <= 0 {
+		options.MinScore = 0.3
+	}
+
+	recipes, err := history.Recipes()
+	if err != nil {
+		return nil, err
+	}
+
+	flaky := []RecipeFlakiness{}
+	for _, recipe := range recipes {
+		entries, err := history.RecipeHistory(recipe, options.Since)
+		if err != nil {
+			return nil, err
+		}
+
+		score := scoreFlakiness(recipe, entries)
+		if score.Runs < options.MinRuns || score.Score < options.MinScore {
+			continue
+		}
+		flaky = append(flaky, score)
+	}
+
+	sort.Slice(flaky, func(i, j int) bool {
+		if flaky[i].Score != flaky[j].Score {
+			return flaky[i].Score > flaky[j].Score
+		}
+		return flaky[i].Runs > flaky[j].Runs
+	})
+	if options.Top > 0 && len(flaky) > options.Top {
+		flaky = flaky[:options.Top]
+	}
+	return flaky, nil
+}
+
+// scoreFlakiness scores a recipe's runs, oldest first
+func scoreFlakiness(recipe string, entries []HistoryEntry) RecipeFlakiness {
+	score := RecipeFlakiness{Recipe: recipe}
+
+	var previous string
+	for _, entry := range entries {
+		if entry.Status == "skipped" || entry.Status == StatusBlocked {
+			continue
+		}
+
+		outcome := "success"
+		if entry.Status == "failed" {
+			outcome = "failed"
+			score.Failures++
+			score.LastFailure = entry.Timestamp
+			score.LastError = entry.Error
+		}
+		if previous != "" && outcome != previous {
+			score.Flips++
+		}
+		previous = outcome
+		score.LastStatus = entry.Status
+		score.Runs++
+	}
+
+	if score.Runs > 1 {
+		score.Score = float64(score.Flips) / float64(score.Runs-1)
+	}
+	if score.Runs > 0 {
+		score.FailureRate = float64(score.Failures) / float64(score.Runs)
+	}
+	return score
+}
+
+// NotifyFlakyRecipes sends the flakiest recipes as one Slack and Teams
+// summary, e.g. weekly, so maintainers know which overrides need attention
+func NotifyFlakyRecipes(notification NotificationOptions, flaky []RecipeFlakiness) error {
+	if len(flaky) == 0 || (!notification.EnableSlack && !notification.EnableTeams) {
+		return nil
+	}
+
+	var lines []string
+	for _, recipe := range flaky {
+		lines = append(lines, i18n.T("notify.flaky_recipe", recipe.Recipe, recipe.Score*100, recipe.Flips, recipe.Failures, recipe.Runs))
+	}
+	title := i18n.T("notify.flaky.title", len(flaky))
+
+	var errs []string
+	if notification.EnableSlack {
+		slackLines := make([]string, len(lines))
+		for i, line := range lines {
+			slackLines[i] = "• " + line
+		}
+		slackNotifier := &SlackNotifier{
+			WebhookURL: notification.SlackWebhook,
+			Username:   notification.SlackUsername,
+			Channel:    notification.SlackChannel,
+			IconEmoji:  notification.SlackIcon,
+		}
+		if err := slackNotifier.Notify(title, strings.Join(slackLines, "\n"), "warning"); err != nil {
+			errs = append(errs, fmt.Sprintf("Slack: %v", err))
+		}
+	}
+
+	if notification.EnableTeams {
+		teamsLines := make([]string, len(lines))
+		for i, line := range lines {
+			teamsLines[i] = "- " + line
+		}
+		teamsNotifier := &MSTeamsNotifier{
+			WebhookURL: notification.TeamsWebhook,
+		}
+		if err := teamsNotifier.NotifyMSTeams(title, strings.Join(teamsLines, "\n"), false, false, "", ""); err != nil {
+			errs = append(errs, fmt.Sprintf("Teams: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send flaky recipe summary: %s", strings.Join(errs, "; "))
+	}
+	logger.Logger(fmt.Sprintf("🎲 Sent summary of %d flaky recipes", len(flaky)), logger.LogSuccess)
+	return nil
+}
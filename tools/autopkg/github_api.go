@@ -0,0 +1,297 @@
+// github_api.go
+package autopkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// GitHubTokensEnvVar lists further GitHub tokens, comma separated, that
+// requests rotate through along with GITHUB_TOKEN. Runners sharing one token
+// exhaust its hourly limit quickly, so each token added raises the budget.
+const GitHubTokensEnvVar = "GITHUB_TOKENS"
+
+// gitHubRateLowWater is the number of remaining requests below which a token
+// is passed over while another token has more left
+const gitHubRateLowWater = 10
+
+// GitHubRateLimitMaxWait is the longest a request waits for a rate limit to
+// reset before failing, rather than holding a runner for up to an hour
+var GitHubRateLimitMaxWait = 2 * time.Minute
+
+// GitHubRateLimit is the core API rate limit of one token
+type GitHubRateLimit struct {
+	Token     string    `json:"token"` // Masked token, or "anonymous" for unauthenticated requests
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Error     string    `json:"error,omitempty"` // Why the limit couldn't be read
+}
+
+// gitHubTokenPool rotates GitHub API requests across the configured tokens,
+// tracking each token's rate limit from the X-RateLimit response headers
+type gitHubTokenPool struct {
+	mu     sync.Mutex
+	tokens []string
+	limits map[string]GitHubRateLimit
+	next   int
+}
+
+var (
+	gitHubPoolOnce sync.Once
+	gitHubPool     *gitHubTokenPool
+)
+
+// gitHubTokens returns the process-wide token pool, read from the environment on first use
+func gitHubTokens() *gitHubTokenPool {
+	gitHubPoolOnce.Do(func() {
+		tokens := GitHubTokens()
+		if len(tokens) == 0 {
+			// Unauthenticated requests have their own, much lower, limit
+			tokens = []string{""}
+		}
+		gitHubPool = &gitHubTokenPool{tokens: tokens, limits: make(map[string]GitHubRateLimit)}
+	})
+	return gitHubPool
+}
+
+// GitHubTokens returns GITHUB_TOKEN followed by the tokens in GITHUB_TOKENS, without duplicates
+func GitHubTokens() []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, token := range append([]string{GitHubTokenFromEnv()}, strings.Split(os.Getenv(GitHubTokensEnvVar), ",")...) {
+		token = strings.TrimSpace(token)
+		if token != "" && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// pick returns the next token in rotation, passing over tokens near
+// exhaustion. When every token is near exhaustion, it returns the one that
+// resets first along with how long until it does.
+func (p *gitHubTokenPool) pick() (string, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < len(p.tokens); i++ {
+		token := p.tokens[(p.next+i)%len(p.tokens)]
+		limit, known := p.limits[token]
+		if !known || limit.Remaining >= gitHubRateLowWater || !now.Before(limit.Reset) {
+			p.next = (p.next + i + 1) % len(p.tokens)
+			return token, 0
+		}
+	}
+
+	// Use up what is left before waiting for a reset
+	best := p.tokens[0]
+	for _, token := range p.tokens {
+		limit := p.limits[token]
+		if limit.Remaining > 0 {
+			return token, 0
+		}
+		if limit.Reset.Before(p.limits[best].Reset) {
+			best = token
+		}
+	}
+	return best, time.Until(p.limits[best].Reset)
+}
+
+// token returns the token to hand to a process that calls GitHub itself, e.g. autopkg
+func (p *gitHubTokenPool) token() string {
+	token, _ := p.pick()
+	return token
+}
+
+// update records the rate limit a response reports for a token
+func (p *gitHubTokenPool) update(token string, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	status := GitHubRateLimit{Token: maskGitHubToken(token), Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+
+	// Secondary limits say how long to back off with Retry-After instead
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && isRateLimited(resp) {
+		status.Remaining = 0
+		status.Reset = time.Now().Add(time.Duration(retryAfter) * time.Second)
+	}
+
+	p.mu.Lock()
+	p.limits[token] = status
+	p.mu.Unlock()
+}
+
+// isRateLimited reports whether GitHub refused a request for exceeding a rate limit
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return resp.StatusCode == http.StatusForbidden &&
+		(resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "")
+}
+
+// githubGet requests a GitHub URL with the next token in rotation. Requests
+// refused for a rate limit move on to another token, and when every token is
+// exhausted the request waits for the earliest reset, up to GitHubRateLimitMaxWait.
+func githubGet(url string) (*http.Response, error) {
+	if err := requireNetwork("GitHub API request to "+url, ""); err != nil {
+		return nil, err
+	}
+
+	pool := gitHubTokens()
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	for attempt := 0; attempt <= len(pool.tokens); attempt++ {
+		token, wait := pool.pick()
+		if wait > 0 {
+			if wait > GitHubRateLimitMaxWait {
+				return nil, fmt.Errorf("GitHub rate limit exhausted for all %d tokens until %s", len(pool.tokens), time.Now().Add(wait).Format(time.Kitchen))
+			}
+			logger.Logger(fmt.Sprintf("⏳ GitHub rate limit nearly exhausted, waiting %s for it to reset", wait.Round(time.Second)), logger.LogWarning)
+			time.Sleep(wait)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "token "+token)
+		}
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		req.Header.Set("User-Agent", "AutoPkgGitHubActions/1.0")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to GitHub: %w", err)
+		}
+		pool.update(token, resp)
+
+		if isRateLimited(resp) {
+			resp.Body.Close()
+			logger.Logger(fmt.Sprintf("⚠️ GitHub rate limit hit for token %s, rotating", maskGitHubToken(token)), logger.LogWarning)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("GitHub rate limit exhausted for all %d tokens", len(pool.tokens))
+}
+
+// githubPost sends a JSON payload to a GitHub API URL with the next token in
+// rotation. Writes need a token, so it fails when none is configured.
+func githubPost(url string, payload interface{}) (*http.Response, error) {
+	if err := requireNetwork("GitHub API request to "+url, ""); err != nil {
+		return nil, err
+	}
+	if len(GitHubTokens()) == 0 {
+		return nil, fmt.Errorf("%s isn't set, GitHub needs a token to post to %s", GitHubTokenEnvVar, url)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal GitHub request: %w", err)
+	}
+
+	pool := gitHubTokens()
+	token, _ := pool.pick()
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AutoPkgGitHubActions/1.0")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to GitHub: %w", err)
+	}
+	pool.update(token, resp)
+	return resp, nil
+}
+
+// GitHubRateLimits reads the core API rate limit of every configured token.
+// Checking the rate limit doesn't count against it.
+func GitHubRateLimits() []GitHubRateLimit {
+	pool := gitHubTokens()
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	var limits []GitHubRateLimit
+	for _, token := range pool.tokens {
+		status := GitHubRateLimit{Token: maskGitHubToken(token)}
+
+		req, err := http.NewRequest(http.MethodGet, "https://api.github.com/rate_limit", nil)
+		if err != nil {
+			status.Error = err.Error()
+			limits = append(limits, status)
+			continue
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "token "+token)
+		}
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		req.Header.Set("User-Agent", "AutoPkgGitHubActions/1.0")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			status.Error = fmt.Sprintf("failed to connect to GitHub: %v", err)
+			limits = append(limits, status)
+			continue
+		}
+
+		var body struct {
+			Resources struct {
+				Core struct {
+					Limit     int   `json:"limit"`
+					Remaining int   `json:"remaining"`
+					Reset     int64 `json:"reset"`
+				} `json:"core"`
+			} `json:"resources"`
+			Message string `json:"message"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		switch {
+		case err != nil:
+			status.Error = fmt.Sprintf("failed to parse rate limit: %v", err)
+		case resp.StatusCode != http.StatusOK:
+			status.Error = fmt.Sprintf("GitHub API returned status %d: %s", resp.StatusCode, body.Message)
+		default:
+			status.Limit = body.Resources.Core.Limit
+			status.Remaining = body.Resources.Core.Remaining
+			status.Reset = time.Unix(body.Resources.Core.Reset, 0)
+			pool.mu.Lock()
+			pool.limits[token] = status
+			pool.mu.Unlock()
+		}
+		limits = append(limits, status)
+	}
+	return limits
+}
+
+// maskGitHubToken identifies a token by its last characters, so it can be shown
+func maskGitHubToken(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+	if len(token) <= 8 {
+		return redactedValue
+	}
+	return "…" + token[len(token)-4:]
+}
@@ -0,0 +1,331 @@
+// github_approval.go
+package autopkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// DefaultApprovalPollInterval is how often GitHubApproval checks for new comments
+const DefaultApprovalPollInterval = time.Minute
+
+// gitHubApproverAssociations are the author associations allowed to approve
+// when no approvers are listed
+var gitHubApproverAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// GitHubApproval gates the release of quarantined builds on /approve and
+// /reject comments on a GitHub issue or pull request. A comment of /approve
+// alone approves every build asked about; /approve Firefox==128.0 only that
+// build. Comments are read by polling, or from the issue_comment event file a
+// workflow triggered by the comment is given.
+type GitHubApproval struct {
+	Repo         string        // Repository as owner/name
+	Issue        int           // Issue or pull request number
+	Approvers    []string      // Logins allowed to decide, empty allows owners, members and collaborators
+	PollInterval time.Duration // Defaults to DefaultApprovalPollInterval
+	APIURL       string        // Defaults to https://api.github.com, or GITHUB_API_URL on GitHub Enterprise
+}
+
+// ApprovalDecisions are the builds decided on, mapping entry IDs to who
+// decided, as ReleaseQuarantined and RejectQuarantined take them
+type ApprovalDecisions struct {
+	Approved map[string]string `json:"approved"`
+	Rejected map[string]string `json:"rejected"`
+}
+
+// gitHubComment is an issue comment, as listed by the API and in issue_comment events
+type gitHubComment struct {
+	ID                int64     `json:"id"`
+	Body              string    `json:"body"`
+	HTMLURL           string    `json:"html_url"`
+	CreatedAt         time.Time `json:"created_at"`
+	AuthorAssociation string    `json:"author_association"`
+	User              struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+// ParseGitHubIssueRef parses an issue or pull request reference of the form owner/name#123
+func ParseGitHubIssueRef(ref string) (string, int, error) {
+	repo, number, found := strings.Cut(strings.TrimSpace(ref), "#")
+	issue, err := strconv.Atoi(number)
+	if !found || err != nil || issue <= 0 || strings.Count(repo, "/") != 1 {
+		return "", 0, fmt.Errorf("invalid GitHub issue %q, expected owner/name#number", ref)
+	}
+	return repo, issue, nil
+}
+
+// issueURL returns the API URL of the issue
+func (g *GitHubApproval) issueURL() string {
+	apiURL := g.APIURL
+	if apiURL == "" {
+		apiURL = os.Getenv("GITHUB_API_URL")
+	}
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	return fmt.Sprintf("%s/repos/%s/issues/%d", strings.TrimRight(apiURL, "/"), g.Repo, g.Issue)
+}
+
+// RequestApproval posts a comment on the issue summarising the builds not yet
+// asked about there, recording the request on them. Builds already asked
+// about aren't asked about again.
+func (g *GitHubApproval) RequestApproval(manifest *QuarantineManifest, entries []*QuarantineEntry) error {
+	ref := fmt.Sprintf("%s#%d", g.Repo, g.Issue)
+	var asking []*QuarantineEntry
+	for _, entry := range entries {
+		if entry.ApprovalRequest != ref {
+			asking = append(asking, entry)
+		}
+	}
+	if len(asking) == 0 {
+		return nil
+	}
+
+	var body strings.Builder
+	body.WriteString("### 🧪 Builds awaiting approval\n\n| Build | Upload recipe | Run | Artifacts |\n|---|---|---|---|\n")
+	for _, entry := range asking {
+		var artifacts []string
+		for _, artifact := range entry.Artifacts {
+			name := filepath.Base(artifact.Path)
+			if artifact.SHA256 != "" {
+				name += fmt.Sprintf(" (`%s…`, %s)", artifact.SHA256[:12], FormatBytes(artifact.Size))
+			}
+			artifacts = append(artifacts, name)
+		}
+		fmt.Fprintf(&body, "| `%s` | %s | %s | %s |\n", entry.ID, entry.Recipe, entry.RunID, strings.Join(artifacts, "<br>"))
+	}
+	body.WriteString("\nComment `/approve` to upload all of them, or `/approve <build>` and `/reject <build>` to decide one at a time.")
+	if len(g.Approvers) > 0 {
+		fmt.Fprintf(&body, " Only @%s can decide.", strings.Join(g.Approvers, ", @"))
+	}
+
+	resp, err := githubPost(g.issueURL()+"/comments", map[string]string{"body": body.String()})
+	if err != nil {
+		return fmt.Errorf("failed to ask for approval on %s#%d: %w", g.Repo, g.Issue, err)
+	}
+	defer resp.Body.Close()
+
+	var comment gitHubComment
+	if resp.StatusCode != http.StatusCreated {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("GitHub returned status %d asking for approval on %s#%d", resp.StatusCode, g.Repo, g.Issue)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&comment); err != nil {
+		return fmt.Errorf("failed to parse GitHub comment: %w", err)
+	}
+
+	for _, entry := range asking {
+		entry.ApprovalRequest = ref
+		entry.ApprovalRequested = comment.CreatedAt
+	}
+	logger.Logger(fmt.Sprintf("🙋 Asked for approval of %d builds on %s", len(asking), comment.HTMLURL), logger.LogInfo)
+	return manifest.Save()
+}
+
+// WaitForApproval polls the issue's comments until every build is decided or
+// the context is done, returning the decisions made so far either way
+func (g *GitHubApproval) WaitForApproval(ctx context.Context, entries []*QuarantineEntry) (*ApprovalDecisions, error) {
+	interval := g.PollInterval
+	if interval <= 0 {
+		interval = DefaultApprovalPollInterval
+	}
+
+	since := time.Now()
+	for _, entry := range entries {
+		if !entry.ApprovalRequested.IsZero() && entry.ApprovalRequested.Before(since) {
+			since = entry.ApprovalRequested
+		}
+	}
+
+	decisions := newApprovalDecisions()
+	for {
+		comments, err := g.comments(since)
+		if err != nil {
+			return decisions, err
+		}
+		for _, comment := range comments {
+			g.decide(comment, entries, decisions)
+		}
+		if len(decisions.Approved)+len(decisions.Rejected) == len(entries) {
+			return decisions, nil
+		}
+
+		logger.Logger(fmt.Sprintf("⏳ %d of %d builds decided on %s#%d, checking again in %s", len(decisions.Approved)+len(decisions.Rejected), len(entries), g.Repo, g.Issue, interval), logger.LogInfo)
+		select {
+		case <-ctx.Done():
+			return decisions, nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DecideFromEvent reads the decisions in the comment of an issue_comment
+// event file, such as GITHUB_EVENT_PATH in a workflow the comment triggered.
+// Comments on another issue, or by someone who can't approve, decide nothing.
+func (g *GitHubApproval) DecideFromEvent(path string, entries []*QuarantineEntry) (*ApprovalDecisions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub event: %w", err)
+	}
+	var event struct {
+		Action string `json:"action"`
+		Issue  struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+		Comment    *gitHubComment `json:"comment"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub event %s: %w", path, err)
+	}
+	if event.Comment == nil {
+		return nil, fmt.Errorf("%s isn't an issue_comment event", path)
+	}
+
+	decisions := newApprovalDecisions()
+	if event.Action != "created" || event.Issue.Number != g.Issue || !strings.EqualFold(event.Repository.FullName, g.Repo) {
+		logger.Logger(fmt.Sprintf("ℹ️ Comment isn't a new comment on %s#%d, nothing decided", g.Repo, g.Issue), logger.LogInfo)
+		return decisions, nil
+	}
+	g.decide(*event.Comment, entries, decisions)
+	return decisions, nil
+}
+
+// ReportRelease posts the outcome of releasing approved builds on the issue
+func (g *GitHubApproval) ReportRelease(runID string, released, failed []string) error {
+	var body strings.Builder
+	fmt.Fprintf(&body, "### 🔓 Release run %s\n\n", runID)
+	for _, id := range released {
+		fmt.Fprintf(&body, "- ✅ `%s` uploaded\n", id)
+	}
+	for _, id := range failed {
+		fmt.Fprintf(&body, "- ❌ `%s` failed to upload and stays in quarantine\n", id)
+	}
+
+	resp, err := githubPost(g.issueURL()+"/comments", map[string]string{"body": body.String()})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("GitHub returned status %d reporting the release on %s#%d", resp.StatusCode, g.Repo, g.Issue)
+	}
+	return nil
+}
+
+// comments lists the issue's comments created since a time, oldest first
+func (g *GitHubApproval) comments(since time.Time) ([]gitHubComment, error) {
+	var comments []gitHubComment
+	for page := 1; ; page++ {
+		resp, err := githubGet(fmt.Sprintf("%s/comments?since=%s&per_page=100&page=%d", g.issueURL(), since.UTC().Format(time.RFC3339), page))
+		if err != nil {
+			return nil, err
+		}
+		var batch []gitHubComment
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("GitHub returned status %d listing comments on %s#%d", resp.StatusCode, g.Repo, g.Issue)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&batch)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub comments: %w", err)
+		}
+		comments = append(comments, batch...)
+		if len(batch) < 100 {
+			return comments, nil
+		}
+	}
+}
+
+// decide applies the /approve and /reject commands of a comment by someone
+// allowed to decide to the builds asked about before it was made. The first
+// decision on a build stands.
+func (g *GitHubApproval) decide(comment gitHubComment, entries []*QuarantineEntry, decisions *ApprovalDecisions) {
+	if !g.canApprove(comment) {
+		if strings.HasPrefix(strings.TrimSpace(comment.Body), "/approve") || strings.HasPrefix(strings.TrimSpace(comment.Body), "/reject") {
+			logger.Logger(fmt.Sprintf("⚠️ Ignoring %s from %s, who can't approve builds", strings.Fields(comment.Body)[0], comment.User.Login), logger.LogWarning)
+		}
+		return
+	}
+	decider := "github:" + comment.User.Login
+
+	for _, line := range strings.Split(comment.Body, "\n") {
+		fields := strings.Fields(strings.ReplaceAll(line, ",", " "))
+		if len(fields) == 0 {
+			continue
+		}
+		var decided map[string]string
+		var verb string
+		switch fields[0] {
+		case "/approve":
+			decided, verb = decisions.Approved, "approved"
+		case "/reject":
+			decided, verb = decisions.Rejected, "rejected"
+		default:
+			continue
+		}
+
+		for _, entry := range entries {
+			if decisions.Approved[entry.ID] != "" || decisions.Rejected[entry.ID] != "" {
+				continue
+			}
+			if !entry.ApprovalRequested.IsZero() && comment.CreatedAt.Before(entry.ApprovalRequested) {
+				continue
+			}
+			if len(fields) == 1 || approvalNames(fields[1:], entry) {
+				decided[entry.ID] = decider
+				logger.Logger(fmt.Sprintf("🙋 %s %s %s", comment.User.Login, verb, entry.ID), logger.LogInfo)
+			}
+		}
+	}
+}
+
+// canApprove reports whether the author of a comment may decide on builds
+func (g *GitHubApproval) canApprove(comment gitHubComment) bool {
+	if len(g.Approvers) > 0 {
+		for _, approver := range g.Approvers {
+			if strings.EqualFold(strings.TrimPrefix(approver, "@"), comment.User.Login) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, association := range gitHubApproverAssociations {
+		if comment.AuthorAssociation == association {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalNames reports whether any of the builds named in a command is an
+// entry, by ID or by app name alone
+func approvalNames(names []string, entry *QuarantineEntry) bool {
+	for _, name := range names {
+		name = strings.Trim(name, "`")
+		if strings.EqualFold(name, entry.ID) || strings.EqualFold(name, entry.App) {
+			return true
+		}
+	}
+	return false
+}
+
+// newApprovalDecisions returns empty decisions
+func newApprovalDecisions() *ApprovalDecisions {
+	return &ApprovalDecisions{Approved: make(map[string]string), Rejected: make(map[string]string)}
+}
@@ -0,0 +1,92 @@
+// github_token.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitHubTokenEnvVar is the environment variable the GitHub token is read from
+const GitHubTokenEnvVar = "GITHUB_TOKEN"
+
+// DefaultGitHubTokenFile is the token file AutoPkg reads when GITHUB_TOKEN_PATH is not set
+const DefaultGitHubTokenFile = ".autopkg_gh_token"
+
+// redactedValue replaces secrets in logged command lines
+const redactedValue = "********"
+
+// GitHubTokenFromEnv returns the GitHub token from the environment, or "" if unset
+func GitHubTokenFromEnv() string {
+	return strings.TrimSpace(os.Getenv(GitHubTokenEnvVar))
+}
+
+// DefaultGitHubTokenPath returns the path of AutoPkg's default token file
+func DefaultGitHubTokenPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, DefaultGitHubTokenFile), nil
+}
+
+// WriteGitHubTokenFile writes the token to AutoPkg's default token file,
+// readable only by the current user, and returns its path
+func WriteGitHubTokenFile(token string) (string, error) {
+	tokenPath, err := DefaultGitHubTokenPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(tokenPath, []byte(token), 0600); err != nil {
+		return "", fmt.Errorf("failed to write GitHub token file: %w", err)
+	}
+	return tokenPath, nil
+}
+
+// githubTokenArgs passes the token to autopkg as a recipe input variable, so
+// processors that accept GITHUB_TOKEN don't need a token file on disk
+func githubTokenArgs(token string) []string {
+	if token == "" {
+		return nil
+	}
+	return []string{"--key", fmt.Sprintf("%s=%s", GitHubTokenEnvVar, token)}
+}
+
+// githubTokenEnv returns the environment for an autopkg child process with the
+// token set, so GitHub requests made outside of recipe processors use it too
+func githubTokenEnv(token string) []string {
+	env := os.Environ()
+	if token == "" {
+		return env
+	}
+	return append(env, fmt.Sprintf("%s=%s", GitHubTokenEnvVar, token))
+}
+
+// redactArgs masks secret values passed with -key/--key so command lines can be logged
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	for i := 1; i < len(redacted); i++ {
+		if redacted[i-1] != "-key" && redacted[i-1] != "--key" && redacted[i-1] != "-k" {
+			continue
+		}
+		key, _, found := strings.Cut(redacted[i], "=")
+		if found && isSecretKey(key) {
+			redacted[i] = key + "=" + redactedValue
+		}
+	}
+	return redacted
+}
+
+// isSecretKey reports whether a recipe variable name looks like it holds a credential
+func isSecretKey(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range []string{"TOKEN", "PASSWORD", "SECRET"} {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+// hash_list.go
+package autopkg
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Lists a hash can be on
+const (
+	HashAllowed = "allow" // Known good, security scans are skipped
+	HashDenied  = "deny"  // Known bad, the recipe fails
+)
+
+// HashListEntry is an artifact SHA256 on the allowlist or denylist
+type HashListEntry struct {
+	SHA256  string    `json:"sha256"`
+	List    string    `json:"list"`           // HashAllowed or HashDenied
+	Name    string    `json:"name,omitempty"` // What the hash is of, e.g. Firefox-128.0.pkg
+	AddedBy string    `json:"added_by"`
+	Reason  string    `json:"reason"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// HashList is the allowlist and denylist of artifact hashes, kept in one JSON
+// file. When it's signed, the detached base64 ed25519 signature is written
+// next to it as <name>.sig, as with the artifact manifest.
+type HashList struct {
+	Entries []*HashListEntry `json:"entries"`
+
+	path string
+}
+
+// LoadHashList reads a hash list, empty when the file doesn't exist yet. With
+// a public key, a PEM encoded ed25519 key as written by `openssl pkey -pubout`,
+// the list must carry a valid signature from its private key.
+func LoadHashList(path string, publicKeyPath string) (*HashList, error) {
+	list := &HashList{Entries: []*HashListEntry{}, path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash list: %w", err)
+	}
+
+	if publicKeyPath != "" {
+		if err := verifyHashListSignature(path, data, publicKeyPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(data, list); err != nil {
+		return nil, fmt.Errorf("failed to parse hash list %s: %w", path, err)
+	}
+	return list, nil
+}
+
+// Save writes the hash list back to its file, signing it when a signing key
+// is given. Saving unsigned removes a stale signature, so verification fails
+// rather than trusting an edited list.
+func (l *HashList) Save(signingKeyPath string) error {
+	sort.Slice(l.Entries, func(i, j int) bool {
+		if l.Entries[i].List != l.Entries[j].List {
+			return l.Entries[i].List < l.Entries[j].List
+		}
+		return l.Entries[i].SHA256 < l.Entries[j].SHA256
+	})
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal hash list: %w", err)
+	}
+	data = append(data, '\n')
+
+	var signingKey ed25519.PrivateKey
+	if signingKeyPath != "" {
+		if signingKey, err = loadManifestSigningKey(signingKeyPath); err != nil {
+			return err
+		}
+	}
+
+	if dir := filepath.Dir(l.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create hash list directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(l.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write hash list: %w", err)
+	}
+
+	if signingKey == nil {
+		if err := os.Remove(l.path + ".sig"); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale hash list signature: %w", err)
+		}
+		return nil
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(signingKey, data))
+	if err := os.WriteFile(l.path+".sig", []byte(signature+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write hash list signature: %w", err)
+	}
+	return nil
+}
+
+// Add puts a hash on a list, replacing an existing entry for the hash
+func (l *HashList) Add(entry HashListEntry) (*HashListEntry, error) {
+	checksum, err := normalizeHash(entry.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	if entry.List != HashAllowed && entry.List != HashDenied {
+		return nil, fmt.Errorf("invalid hash list %q: use %s or %s", entry.List, HashAllowed, HashDenied)
+	}
+	if entry.Reason == "" || entry.AddedBy == "" {
+		return nil, fmt.Errorf("who lists %s and why is required", checksum)
+	}
+	entry.SHA256 = checksum
+	if entry.AddedAt.IsZero() {
+		entry.AddedAt = time.Now().UTC()
+	}
+
+	l.Remove(checksum)
+	l.Entries = append(l.Entries, &entry)
+	return &entry, nil
+}
+
+// Remove takes a hash off whichever list it's on, returning the removed entry or nil
+func (l *HashList) Remove(checksum string) *HashListEntry {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	for i, entry := range l.Entries {
+		if entry.SHA256 == checksum {
+			l.Entries = append(l.Entries[:i], l.Entries[i+1:]...)
+			return entry
+		}
+	}
+	return nil
+}
+
+// Lookup returns the entry for a hash, or nil when it's on neither list
+func (l *HashList) Lookup(checksum string) *HashListEntry {
+	if l == nil {
+		return nil
+	}
+	checksum = strings.ToLower(checksum)
+	for _, entry := range l.Entries {
+		if entry.SHA256 == checksum {
+			return entry
+		}
+	}
+	return nil
+}
+
+// LookupFile hashes a file and returns its entry, or nil when it's on neither list
+func (l *HashList) LookupFile(path string) (*HashListEntry, error) {
+	checksum, _, err := fileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	return l.Lookup(checksum), nil
+}
+
+// HashListTarget returns the SHA256 a hash list command names: the hash
+// itself, or that of the file at the path along with the file's name
+func HashListTarget(value string) (string, string, error) {
+	if info, err := os.Stat(value); err == nil && !info.IsDir() {
+		checksum, _, err := fileSHA256(value)
+		return checksum, filepath.Base(value), err
+	}
+	checksum, err := normalizeHash(value)
+	return checksum, "", err
+}
+
+// checkRunHashList looks up the packages and disk images a recipe produced.
+// A denylisted artifact fails the recipe. When every artifact is allowlisted
+// the result is marked so, and the notarization check and artifact diff,
+// which only look for problems, skip it.
+func checkRunHashList(result *RecipeBatchResult, list *HashList) {
+	if result.Status == "failed" || result.Status == "skipped" || result.Status == StatusBlocked {
+		return
+	}
+
+	checked, allowed := 0, 0
+	var denied []string
+	for _, artifact := range result.Artifacts {
+		if artifact.Type != "pkg" && artifact.Type != "dmg" {
+			continue
+		}
+		entry, err := list.LookupFile(artifact.Path)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to look up %s on the hash list: %v", filepath.Base(artifact.Path), err), logger.LogWarning)
+			continue
+		}
+		checked++
+		switch {
+		case entry == nil:
+		case entry.List == HashDenied:
+			denied = append(denied, fmt.Sprintf("%s (%s)", filepath.Base(artifact.Path), entry.Reason))
+		case entry.List == HashAllowed:
+			allowed++
+		}
+	}
+
+	if len(denied) > 0 {
+		result.Status = "failed"
+		result.ExecutionError = fmt.Errorf("denylisted: %s", strings.Join(denied, ", "))
+		result.FailureKind = FailureKindDenylisted
+		logger.Logger(fmt.Sprintf("❌ Recipe %s produced denylisted artifacts: %s", result.Recipe, strings.Join(denied, ", ")), logger.LogError)
+		return
+	}
+	if checked > 0 && allowed == checked {
+		result.Allowlisted = true
+		logger.Logger(fmt.Sprintf("✅ Artifacts of %s are allowlisted, skipping security checks", result.Recipe), logger.LogInfo)
+	}
+}
+
+// verifyHashListSignature checks the detached signature of a hash list
+func verifyHashListSignature(path string, data []byte, publicKeyPath string) error {
+	keyData, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read hash list public key: %w", err)
+	}
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return fmt.Errorf("hash list public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse hash list public key: %w", err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("hash list public key must be an ed25519 public key")
+	}
+
+	encoded, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		return fmt.Errorf("hash list %s is not signed: %w", path, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("failed to decode hash list signature: %w", err)
+	}
+	if !ed25519.Verify(publicKey, data, signature) {
+		return fmt.Errorf("hash list %s doesn't match its signature", path)
+	}
+	return nil
+}
+
+// normalizeHash lower-cases a hex SHA256 and checks its length
+func normalizeHash(checksum string) (string, error) {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != 32 {
+		return "", fmt.Errorf("invalid SHA256 %q", checksum)
+	}
+	return checksum, nil
+}
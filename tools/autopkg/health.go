@@ -0,0 +1,306 @@
+// health.go
+package autopkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Pipeline health alert kinds
+const (
+	HealthAlertDuration    = "duration"
+	HealthAlertFailureRate = "failure_rate"
+	HealthAlertNoUpdates   = "no_updates"
+	HealthAlertDownload    = "download_spike"
+)
+
+// HealthOptions configures the thresholds of the pipeline health analyzer
+type HealthOptions struct {
+	BaselineRuns      int           // Number of previous runs forming the rolling baseline, defaults to 10
+	MinBaselineRuns   int           // Don't compare against fewer previous runs than this, defaults to 3
+	DurationIncrease  float64       // Alert when the run takes this much longer than the baseline, defaults to 0.5 (+50%)
+	FailureRateFactor float64       // Alert when the failure rate is this multiple of the baseline, defaults to 2
+	NoUpdatesWindow   time.Duration // Alert when no recipe updated for this long, defaults to a week
+	DownloadFactor    float64       // Alert when a recipe downloads this multiple of its baseline, defaults to 4
+	DownloadMinBytes  int64         // Don't alert on downloads smaller than this, defaults to 1 GiB
+}
+
+// HealthAlert is a pipeline-level regression, as opposed to an individual recipe failure
+type HealthAlert struct {
+	Kind     string  `json:"kind"`
+	Message  string  `json:"message"`
+	Current  float64 `json:"current"`
+	Baseline float64 `json:"baseline"`
+}
+
+// withDefaults returns a copy of the options with unset thresholds filled in
+func (o *HealthOptions) withDefaults() HealthOptions {
+	options := HealthOptions{}
+	if o != nil {
+		options = *o
+	}
+	if options.BaselineRuns <= 0 {
+		options.BaselineRuns = 10
+	}
+	if options.MinBaselineRuns <= 0 {
+		options.MinBaselineRuns = 3
+	}
+	if options.DurationIncrease <= 0 {
+		options.DurationIncrease = 0.5
+	}
+	if options.FailureRateFactor <= 0 {
+		options.FailureRateFactor = 2
+	}
+	if options.NoUpdatesWindow <= 0 {
+		options.NoUpdatesWindow = 7 * 24 * time.Hour
+	}
+	if options.DownloadFactor <= 0 {
+		options.DownloadFactor = 4
+	}
+	if options.DownloadMinBytes <= 0 {
+		options.DownloadMinBytes = 1 << 30
+	}
+	return options
+}
+
+// AnalyzeRunHealth compares a run with the rolling baseline of the runs before
+// it and returns alerts for slowdowns, rising failure rates and stalled updates
+func AnalyzeRunHealth(current *RunRecord, previous []*RunRecord, options *HealthOptions) []HealthAlert {
+	thresholds := options.withDefaults()
+
+	// Chaos runs have synthetic failures and check only runs stop before
+	// packaging, so either would poison the baseline
+	var history []*RunRecord
+	for _, record := range previous {
+		if record.Chaos || record.CheckOnly || record.RunID == current.RunID || !record.StartTime.Before(current.StartTime) {
+			continue
+		}
+		history = append(history, record)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].StartTime.After(history[j].StartTime)
+	})
+
+	baseline := history
+	if len(baseline) > thresholds.BaselineRuns {
+		baseline = baseline[:thresholds.BaselineRuns]
+	}
+
+	var alerts []HealthAlert
+	if len(baseline) >= thresholds.MinBaselineRuns {
+		if alert := checkDurationHealth(current, baseline, thresholds); alert != nil {
+			alerts = append(alerts, *alert)
+		}
+		if alert := checkFailureRateHealth(current, baseline, thresholds); alert != nil {
+			alerts = append(alerts, *alert)
+		}
+		alerts = append(alerts, checkDownloadHealth(current, baseline, thresholds)...)
+	}
+	if alert := checkUpdateHealth(current, history, thresholds); alert != nil {
+		alerts = append(alerts, *alert)
+	}
+
+	return alerts
+}
+
+// checkDurationHealth alerts when the run took much longer than the baseline average
+func checkDurationHealth(current *RunRecord, baseline []*RunRecord, thresholds HealthOptions) *HealthAlert {
+	var total time.Duration
+	for _, record := range baseline {
+		total += record.EndTime.Sub(record.StartTime)
+	}
+	average := total / time.Duration(len(baseline))
+	duration := current.EndTime.Sub(current.StartTime)
+
+	if average <= 0 || float64(duration) <= float64(average)*(1+thresholds.DurationIncrease) {
+		return nil
+	}
+
+	increase := (float64(duration)/float64(average) - 1) * 100
+	return &HealthAlert{
+		Kind:     HealthAlertDuration,
+		Message:  i18n.T("health.duration", duration.Round(time.Second), increase, average.Round(time.Second), len(baseline)),
+		Current:  duration.Seconds(),
+		Baseline: average.Seconds(),
+	}
+}
+
+// checkFailureRateHealth alerts when the share of failed recipes rose sharply
+func checkFailureRateHealth(current *RunRecord, baseline []*RunRecord, thresholds HealthOptions) *HealthAlert {
+	var failed, total int
+	for _, record := range baseline {
+		recordFailed, recordTotal := runFailureCounts(record)
+		failed += recordFailed
+		total += recordTotal
+	}
+
+	currentFailed, currentTotal := runFailureCounts(current)
+	if total == 0 || currentTotal == 0 {
+		return nil
+	}
+
+	baselineRate := float64(failed) / float64(total)
+	currentRate := float64(currentFailed) / float64(currentTotal)
+
+	// A clean baseline can't double; single failures are already alerted per recipe
+	if baselineRate == 0 || currentRate < baselineRate*thresholds.FailureRateFactor {
+		return nil
+	}
+
+	return &HealthAlert{
+		Kind:     HealthAlertFailureRate,
+		Message:  i18n.T("health.failure_rate", currentRate*100, currentRate/baselineRate, baselineRate*100, len(baseline)),
+		Current:  currentRate,
+		Baseline: baselineRate,
+	}
+}
+
+// checkUpdateHealth alerts when no recipe produced a new version within the
+// window, once the pipeline has been running for longer than the window
+func checkUpdateHealth(current *RunRecord, history []*RunRecord, thresholds HealthOptions) *HealthAlert {
+	windowStart := current.StartTime.Add(-thresholds.NoUpdatesWindow)
+
+	coversWindow := false
+	updated := runUpdatedCount(current)
+	for _, record := range history {
+		if record.StartTime.After(windowStart) {
+			updated += runUpdatedCount(record)
+		} else {
+			coversWindow = true
+		}
+	}
+
+	if !coversWindow || updated > 0 {
+		return nil
+	}
+
+	days := int(thresholds.NoUpdatesWindow.Hours() / 24)
+	return &HealthAlert{
+		Kind:    HealthAlertNoUpdates,
+		Message: i18n.T("health.no_updates", days),
+	}
+}
+
+// checkDownloadHealth alerts on recipes that downloaded much more than they
+// have on average in the baseline runs that measured their downloads
+func checkDownloadHealth(current *RunRecord, baseline []*RunRecord, thresholds HealthOptions) []HealthAlert {
+	downloads := make(map[string][]int64)
+	for _, record := range baseline {
+		for _, recipe := range record.Recipes {
+			if recipe.Usage != nil && recipe.Usage.DownloadedBytes > 0 {
+				downloads[recipe.Recipe] = append(downloads[recipe.Recipe], recipe.Usage.DownloadedBytes)
+			}
+		}
+	}
+
+	var alerts []HealthAlert
+	for _, recipe := range current.Recipes {
+		if recipe.Usage == nil || recipe.Usage.DownloadedBytes < thresholds.DownloadMinBytes || len(downloads[recipe.Recipe]) == 0 {
+			continue
+		}
+
+		var total int64
+		for _, bytes := range downloads[recipe.Recipe] {
+			total += bytes
+		}
+		average := float64(total) / float64(len(downloads[recipe.Recipe]))
+		downloaded := float64(recipe.Usage.DownloadedBytes)
+		if downloaded < average*thresholds.DownloadFactor {
+			continue
+		}
+
+		alerts = append(alerts, HealthAlert{
+			Kind:     HealthAlertDownload,
+			Message:  i18n.T("health.download_spike", recipe.Recipe, FormatBytes(recipe.Usage.DownloadedBytes), downloaded/average, FormatBytes(int64(average))),
+			Current:  downloaded,
+			Baseline: average,
+		})
+	}
+	return alerts
+}
+
+// runFailureCounts returns the failed and total recipe counts of a run, ignoring skipped recipes
+func runFailureCounts(record *RunRecord) (int, int) {
+	var failed, total int
+	for _, recipe := range record.Recipes {
+		if recipe.Status == "skipped" || recipe.Status == StatusBlocked {
+			continue
+		}
+		total++
+		if recipe.Status == "failed" {
+			failed++
+		}
+	}
+	return failed, total
+}
+
+// runUpdatedCount returns the number of recipes that produced a new version in a run
+func runUpdatedCount(record *RunRecord) int {
+	count := 0
+	for _, recipe := range record.Recipes {
+		if recipe.Status == "updated" {
+			count++
+		}
+	}
+	return count
+}
+
+// checkRunHealth analyzes a finished run against the stored run records and
+// sends any pipeline health alerts
+func checkRunHealth(options *RecipeBatchRunOptions, record *RunRecord) []HealthAlert {
+	previous, err := ListRunRecords(options.StateDir, time.Time{})
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to load run records for health analysis: %v", err), logger.LogWarning)
+		return nil
+	}
+
+	alerts := AnalyzeRunHealth(record, previous, options.Health)
+	if len(alerts) == 0 {
+		logger.Logger("🩺 Pipeline health is within the baseline", logger.LogDebug)
+		return nil
+	}
+
+	for _, alert := range alerts {
+		logger.Logger(fmt.Sprintf("🩺 Pipeline health: %s", alert.Message), logger.LogWarning)
+	}
+	notifyPipelineHealth(options, alerts)
+	return alerts
+}
+
+// notifyPipelineHealth sends pipeline health alerts as one notification,
+// separate from individual recipe failures
+func notifyPipelineHealth(options *RecipeBatchRunOptions, alerts []HealthAlert) {
+	var slackLines, teamsLines []string
+	for _, alert := range alerts {
+		slackLines = append(slackLines, "• "+alert.Message)
+		teamsLines = append(teamsLines, "- "+alert.Message)
+	}
+
+	title := i18n.T("notify.health.title", len(alerts))
+
+	if options.Notification.EnableSlack {
+		slackNotifier := &SlackNotifier{
+			WebhookURL: options.Notification.SlackWebhook,
+			Username:   options.Notification.SlackUsername,
+			Channel:    options.Notification.SlackChannel,
+			IconEmoji:  options.Notification.SlackIcon,
+		}
+		if err := slackNotifier.Notify(title, strings.Join(slackLines, "\n"), "warning"); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to send pipeline health alert to Slack: %v", err), logger.LogWarning)
+		}
+	}
+
+	if options.Notification.EnableTeams {
+		teamsNotifier := &MSTeamsNotifier{
+			WebhookURL: options.Notification.TeamsWebhook,
+		}
+		if err := teamsNotifier.NotifyMSTeams(title, strings.Join(teamsLines, "\n"), false, false, "", ""); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to send pipeline health alert to Teams: %v", err), logger.LogWarning)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// history.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultHistoryFile is the name of the run history database within the state directory
+const DefaultHistoryFile = "history.db"
+
+// historyKeyFormat is fixed width so keys sort chronologically
+const historyKeyFormat = "2006-01-02T15:04:05.000000000Z"
+
+// historyRecipesBucket holds one nested bucket of entries per recipe
+var historyRecipesBucket = []byte("recipes")
+
+// HistoryEntry is a single recipe run recorded in the history database
+type HistoryEntry struct {
+	RunID          string        `json:"run_id"`
+	Recipe         string        `json:"recipe"`
+	Timestamp      time.Time     `json:"timestamp"`
+	Status         string        `json:"status"`
+	Version        string        `json:"version,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	ArtifactPath   string        `json:"artifact_path,omitempty"`
+	ArtifactSHA256 string        `json:"artifact_sha256,omitempty"`
+	MinOSVersion   string        `json:"min_os_version,omitempty"`
+	Error          string        `json:"error,omitempty"`
+}
+
+// DurationTrendPoint is the average run duration of a recipe over one period
+type DurationTrendPoint struct {
+	PeriodStart     time.Time     `json:"period_start"`
+	Runs            int           `json:"runs"`
+	AverageDuration time.Duration `json:"average_duration"`
+}
+
+// History is an embedded bbolt store of every recipe run
+type History struct {
+	db *bolt.DB
+}
+
+// DefaultHistoryPath returns the history database path within a state directory
+func DefaultHistoryPath(stateDir string) string {
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+	return filepath.Join(stateDir, DefaultHistoryFile)
+}
+
+// OpenHistory opens or creates the history database. Only one process can hold
+// it open, so a concurrent run waits a few seconds before giving up.
+func OpenHistory(path string) (*History, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyRecipesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise history database: %w", err)
+	}
+
+	return &History{db: db}, nil
+}
+
+// Close releases the history database
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// Record stores history entries
+func (h *History) Record(entries ...HistoryEntry) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		recipes := tx.Bucket(historyRecipesBucket)
+		for _, entry := range entries {
+			bucket, err := recipes.CreateBucketIfNotExists([]byte(entry.Recipe))
+			if err != nil {
+				return fmt.Errorf("failed to create history bucket for %s: %w", entry.Recipe, err)
+			}
+
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return fmt.Errorf("failed to marshal history entry: %w", err)
+			}
+
+			key := entry.Timestamp.UTC().Format(historyKeyFormat) + "/" + entry.RunID
+			if err := bucket.Put([]byte(key), data); err != nil {
+				return fmt.Errorf("failed to write history entry: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Recipes returns the names of all recipes with recorded runs
+func (h *History) Recipes() ([]string, error) {
+	var recipes []string
+	err := h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyRecipesBucket).ForEach(func(name, value []byte) error {
+			if value == nil {
+				recipes = append(recipes, string(name))
+			}
+			return nil
+		})
+	})
+	return recipes, err
+}
+
+// RecipeHistory returns the runs of a recipe since a time, oldest first
+func (h *History) RecipeHistory(recipe string, since time.Time) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyRecipesBucket).Bucket([]byte(recipe))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		start := []byte(since.UTC().Format(historyKeyFormat))
+		for key, value := cursor.Seek(start); key != nil; key, value = cursor.Next() {
+			var entry HistoryEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return fmt.Errorf("failed to parse history entry %s: %w", key, err)
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Since returns the runs of every recipe since a time, oldest first
+func (h *History) Since(since time.Time) ([]HistoryEntry, error) {
+	recipes, err := h.Recipes()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []HistoryEntry
+	for _, recipe := range recipes {
+		recipeEntries, err := h.RecipeHistory(recipe, since)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, recipeEntries...)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries, nil
+}
+
+// UpdatedSince returns the latest update of every recipe that produced a new
+// version since a time, e.g. "which apps updated this week"
+func (h *History) UpdatedSince(since time.Time) ([]HistoryEntry, error) {
+	entries, err := h.Since(since)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]HistoryEntry)
+	for _, entry := range entries {
+		if entry.Status == "updated" {
+			latest[entry.Recipe] = entry
+		}
+	}
+
+	updated := make([]HistoryEntry, 0, len(latest))
+	for _, entry := range latest {
+		updated = append(updated, entry)
+	}
+	sort.Slice(updated, func(i, j int) bool {
+		return updated[i].Timestamp.After(updated[j].Timestamp)
+	})
+	return updated, nil
+}
+
+// DurationTrend returns the average duration of a recipe's runs per period,
+// ignoring skipped runs, oldest period first
+func (h *History) DurationTrend(recipe string, period time.Duration, since time.Time) ([]DurationTrendPoint, error) {
+	if period <= 0 {
+		period = 7 * 24 * time.Hour
+	}
+
+	entries, err := h.RecipeHistory(recipe, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var trend []DurationTrendPoint
+	var total time.Duration
+	for _, entry := range entries {
+		if entry.Status == "skipped" || entry.Status == StatusBlocked {
+			continue
+		}
+
+		periodStart := entry.Timestamp.UTC().Truncate(period)
+		if len(trend) == 0 || !trend[len(trend)-1].PeriodStart.Equal(periodStart) {
+			trend = append(trend, DurationTrendPoint{PeriodStart: periodStart})
+			total = 0
+		}
+
+		point := &trend[len(trend)-1]
+		point.Runs++
+		total += entry.Duration
+		point.AverageDuration = total / time.Duration(point.Runs)
+	}
+
+	return trend, nil
+}
+
+// NewHistoryEntries builds history entries from batch results. The first
+// produced artifact provides the version and checksum.
+func NewHistoryEntries(runID string, results map[string]*RecipeBatchResult, timestamp time.Time) []HistoryEntry {
+	entries := make([]HistoryEntry, 0, len(results))
+	for recipe, result := range results {
+		entry := HistoryEntry{
+			RunID:        runID,
+			Recipe:       recipe,
+			Timestamp:    timestamp,
+			Status:       result.Status,
+			Duration:     result.ExecutionTime,
+			MinOSVersion: result.MinOSVersion,
+		}
+		if result.ExecutionError != nil {
+			entry.Error = result.ExecutionError.Error()
+		} else if result.VerificationError != nil {
+			entry.Error = result.VerificationError.Error()
+		}
+
+		if len(result.Artifacts) > 0 {
+			artifact := result.Artifacts[0]
+			entry.Version = artifact.Version
+			entry.ArtifactPath = artifact.Path
+			if checksum, _, err := fileSHA256(artifact.Path); err == nil {
+				entry.ArtifactSHA256 = checksum
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// recordRunHistory appends the batch results to the history database and
+// returns the version changes since each recipe's previous successful run
+func recordRunHistory(options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult, timestamp time.Time) []VersionChange {
+	historyPath := options.HistoryPath
+	if historyPath == "" {
+		historyPath = DefaultHistoryPath(options.StateDir)
+	}
+
+	history, err := OpenHistory(historyPath)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to open run history: %v", err), logger.LogWarning)
+		return nil
+	}
+	defer history.Close()
+
+	changes, err := DetectVersionChanges(history, results, timestamp)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to detect version changes: %v", err), logger.LogWarning)
+	}
+
+	if err := history.Record(NewHistoryEntries(options.RunID, results, timestamp)...); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to record run history: %v", err), logger.LogWarning)
+		return changes
+	}
+	recordUploadReceipts(history, options, results)
+
+	logger.Logger(fmt.Sprintf("🗃️ Recorded %d recipe runs in %s", len(results), historyPath), logger.LogDebug)
+	return changes
+}
@@ -0,0 +1,189 @@
+// html_report.go
+package autopkg
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/sbom"
+)
+
+// maxHTMLReportLog is how much of a recipe's output the HTML report keeps,
+// from the end, where autopkg reports what failed
+const maxHTMLReportLog = 256 * 1024
+
+// htmlReportTemplate is a standalone page: its styles and the script sorting
+// the recipe table are inline, so the file can be attached as a CI artifact
+// and opened anywhere
+//
+//go:embed html_report.html.tmpl
+var htmlReportTemplate string
+
+// htmlReport is the data the HTML report template renders
+type htmlReport struct {
+	Record      *RunRecord
+	Generated   time.Time
+	Duration    time.Duration
+	Summary     *RecipeBatchSummary
+	Recipes     []htmlReportRecipe
+	Scans       []htmlReportScan
+	ScanIssues  int
+	HasLogs     bool
+	LogLimit    int64
+	TotalUpload int64
+}
+
+// htmlReportRecipe is a row of the recipe table with its drill-down
+type htmlReportRecipe struct {
+	RecipeRunRecord
+	Hint         string
+	Artifacts    []ProducedArtifact
+	Uploads      []UploadedArtifact
+	Diffs        []sbom.Delta
+	MinOSVersion string
+	Log          string
+	LogTruncated bool
+}
+
+// htmlReportScan is the security scan of an artifact: its signature,
+// notarization and Gatekeeper assessment
+type htmlReportScan struct {
+	Recipe string
+	notarization.Result
+}
+
+// Passed reports whether the artifact passed its scan
+func (s htmlReportScan) Passed() bool {
+	return s.Notarized && s.Accepted
+}
+
+// WriteHTMLReport writes a standalone HTML report of a run: summary cards, a
+// sortable table of its recipes that drills down into their artifacts,
+// uploads, changes since the previous version and logs, and the security scans of the artifacts. results may be
+// nil, e.g. for a run loaded from its record, leaving out what only the
+// batch knows, such as the logs.
+func WriteHTMLReport(path string, record *RunRecord, results map[string]*RecipeBatchResult) error {
+	report := newHTMLReport(record, results)
+
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"base":    filepath.Base,
+		"bytes":   FormatBytes,
+		"join":    func(values []string) string { return strings.Join(values, ", ") },
+		"seconds": func(d time.Duration) string { return fmt.Sprintf("%.3f", d.Seconds()) },
+		"round":   func(d time.Duration) time.Duration { return d.Round(time.Second) },
+		"time":    func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05 MST") },
+	}).Parse(htmlReportTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML report template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, report); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
+
+// newHTMLReport gathers the run record and, when given, the results into the report data
+func newHTMLReport(record *RunRecord, results map[string]*RecipeBatchResult) *htmlReport {
+	report := &htmlReport{
+		Record:    record,
+		Generated: time.Now(),
+		Duration:  record.EndTime.Sub(record.StartTime),
+		Summary:   recordSummary(record),
+		LogLimit:  maxHTMLReportLog,
+	}
+
+	for _, recipeRecord := range record.Recipes {
+		recipe := htmlReportRecipe{RecipeRunRecord: recipeRecord, Hint: FailureHint(recipeRecord.FailureKind)}
+		if result := results[recipeRecord.Recipe]; result != nil {
+			recipe.Artifacts = result.Artifacts
+			recipe.Uploads = result.Uploads
+			recipe.Diffs = result.ArtifactDiffs
+			recipe.MinOSVersion = result.MinOSVersion
+			recipe.Log = result.Output
+			if len(recipe.Log) > maxHTMLReportLog {
+				recipe.Log = recipe.Log[len(recipe.Log)-maxHTMLReportLog:]
+				recipe.LogTruncated = true
+			}
+			report.HasLogs = report.HasLogs || recipe.Log != ""
+			for _, upload := range result.Uploads {
+				report.TotalUpload += upload.SizeBytes
+			}
+			for _, scan := range result.Notarization {
+				report.Scans = append(report.Scans, htmlReportScan{Recipe: recipeRecord.Recipe, Result: scan})
+			}
+		}
+		report.Recipes = append(report.Recipes, recipe)
+	}
+
+	// Failed scans first, so they're what a reader sees
+	sort.SliceStable(report.Scans, func(i, j int) bool {
+		return !report.Scans[i].Passed() && report.Scans[j].Passed()
+	})
+	for _, scan := range report.Scans {
+		if !scan.Passed() {
+			report.ScanIssues++
+		}
+	}
+	return report
+}
+
+// recordSummary counts the recipes of a run record by status, as
+// NewRecipeBatchSummary does for batch results
+func recordSummary(record *RunRecord) *RecipeBatchSummary {
+	summary := &RecipeBatchSummary{TotalDuration: record.EndTime.Sub(record.StartTime), TotalRecipes: len(record.Recipes)}
+	for _, recipe := range record.Recipes {
+		switch recipe.Status {
+		case "updated":
+			summary.SuccessCount++
+			summary.UpdatedCount++
+		case "unchanged":
+			summary.SuccessCount++
+			summary.UnchangedCount++
+		case "skipped":
+			summary.SkippedCount++
+		case StatusBlocked:
+			summary.BlockedCount++
+		case "failed":
+			summary.FailedCount++
+		}
+		if recipe.Usage != nil {
+			summary.DownloadedBytes += recipe.Usage.DownloadedBytes
+		}
+	}
+	return summary
+}
+
+// HTMLReportEventSink writes the HTML report of a run when it finishes
+type HTMLReportEventSink struct {
+	Path string
+}
+
+// Name implements EventSink
+func (s *HTMLReportEventSink) Name() string { return "html report " + s.Path }
+
+// Handle implements EventSink
+func (s *HTMLReportEventSink) Handle(event Event) error {
+	if event.Type != EventRunFinished || event.Record == nil {
+		return nil
+	}
+	return WriteHTMLReport(s.Path, event.Record, event.Results)
+}
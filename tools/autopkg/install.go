@@ -10,7 +10,6 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-	"time"
 
 	"github.com/deploymenttheory/macos-autopkg-factory/tools/helpers"
 	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
@@ -21,6 +20,13 @@ type InstallConfig struct {
 	// Basic AutoPkg settings
 	ForceUpdate bool
 	UseBeta     bool
+	Version     string // Release to install, e.g. 2.7.3; an installed AutoPkg of another version is replaced. Latest, or beta, when empty
+	Backend     string // InstallBackendPkg, the default, or InstallBackendBrew when Homebrew is available
+
+	// User-space install, for runners without sudo
+	UserSpace bool   // Expand the package into Prefix instead of running the installer as root
+	Prefix    string // Directory of a user-space install, defaults to DefaultUserSpacePrefix
+	PrefsPath string // AutoPkg preferences GIT_PATH is recorded in for a user-space install
 }
 
 // RootCheck ensures the script is not running as root and logs the current user
@@ -109,6 +115,17 @@ func installGit() error {
 // - If 'ForceUpdate' is enabled, it will update AutoPkg instead of skipping.
 // - If AutoPkg is not installed, it proceeds with installation.
 func InstallAutoPkg(installConfig *InstallConfig) (string, error) {
+	backend, err := installConfig.backend()
+	if err != nil {
+		return "", err
+	}
+	if backend == InstallBackendBrew {
+		return installBrewAutoPkg(installConfig)
+	}
+	if installConfig.UserSpace {
+		return installUserSpaceAutoPkg(installConfig)
+	}
+
 	autopkgPath := "/Library/AutoPkg/autopkg"
 	autopkgSymlinkPath := "/usr/local/bin/autopkg"
 
@@ -133,46 +150,25 @@ func InstallAutoPkg(installConfig *InstallConfig) (string, error) {
 	if autopkgExists && !installConfig.ForceUpdate {
 		logger.Logger("✅ AutoPkg is already installed, checking version...", logger.LogInfo)
 
-		versionCmd := exec.Command(actualPath, "version")
-		versionOutput, err := versionCmd.Output()
+		version, err := autopkgVersionAt(actualPath)
 		if err != nil {
-			return "", fmt.Errorf("failed to get AutoPkg version: %w", err)
+			return "", err
 		}
-
-		version := strings.TrimSpace(string(versionOutput))
-		logger.Logger(fmt.Sprintf("✅ AutoPkg %s is already installed. Skipping installation.", version), logger.LogSuccess)
-		return version, nil
-	}
-
-	// If we're here, either AutoPkg is missing or a forced update is required
-	if autopkgExists {
+		if installConfig.pinned(version) {
+			logger.Logger(fmt.Sprintf("✅ AutoPkg %s is already installed. Skipping installation.", version), logger.LogSuccess)
+			return version, nil
+		}
+		logger.Logger(fmt.Sprintf("🔄 AutoPkg %s is installed but %s is pinned, replacing it...", version, installConfig.Version), logger.LogInfo)
+	} else if autopkgExists {
+		// If we're here, either AutoPkg is missing, of another version than pinned, or a forced update is required
 		logger.Logger("🔄 Force update enabled. Updating AutoPkg...", logger.LogInfo)
 	} else {
 		logger.Logger("⬇️ AutoPkg not found. Installing AutoPkg...", logger.LogInfo)
 	}
 
-	var releaseURL string
-	var err error
-
-	// Get the correct release URL (Beta or Stable)
-	if installConfig.UseBeta {
-		releaseURL, err = getBetaAutoPkgReleaseURL()
-		logger.Logger("🧪 Fetching latest Beta AutoPkg Release...", logger.LogInfo)
-	} else {
-		releaseURL, err = getLatestAutoPkgReleaseURL()
-		logger.Logger("🚀 Fetching latest Stable AutoPkg Release...", logger.LogInfo)
-	}
-
+	pkgPath, err := fetchAutoPkgInstaller(installConfig)
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve AutoPkg release URL: %w", err)
-	}
-
-	logger.Logger(fmt.Sprintf("📥 AutoPkg release URL: %s", releaseURL), logger.LogInfo)
-
-	// Proceed with downloading and installing AutoPkg
-	pkgPath := "/tmp/autopkg-latest.pkg"
-	if err := helpers.DownloadFile(releaseURL, pkgPath); err != nil {
-		return "", fmt.Errorf("failed to download AutoPkg package: %w", err)
+		return "", err
 	}
 
 	cmd := exec.Command("sudo", "installer", "-pkg", pkgPath, "-target", "/")
@@ -193,34 +189,118 @@ func InstallAutoPkg(installConfig *InstallConfig) (string, error) {
 	}
 
 	version := strings.TrimSpace(string(versionOutput))
+	if !installConfig.pinned(version) {
+		return "", fmt.Errorf("installed AutoPkg is %s, not the pinned %s", version, installConfig.Version)
+	}
 	logger.Logger(fmt.Sprintf("✅ AutoPkg %s successfully installed", version), logger.LogSuccess)
 
 	return version, nil
 }
 
-// getBetaAutoPkgReleaseURL retrieves the URL of the latest beta AutoPkg release
-func getBetaAutoPkgReleaseURL() (string, error) {
-	// Create a new request to get all releases including pre-releases
-	req, err := http.NewRequest("GET", "https://api.github.com/repos/autopkg/autopkg/releases", nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// fetchAutoPkgInstaller returns the AutoPkg installer package to install,
+// downloading the latest stable or beta release unless one is pre-seeded
+func fetchAutoPkgInstaller(installConfig *InstallConfig) (string, error) {
+	// A pre-downloaded installer package is used as is, e.g. on air-gapped runners
+	pkgPath := os.Getenv(AutoPkgInstallerEnvVar)
+	if pkgPath != "" {
+		if _, err := os.Stat(pkgPath); err != nil {
+			return "", fmt.Errorf("failed to read %s package: %w", AutoPkgInstallerEnvVar, err)
+		}
+		logger.Logger(fmt.Sprintf("📦 Installing AutoPkg from %s", pkgPath), logger.LogInfo)
+	} else {
+		if err := requireNetwork("download AutoPkg", fmt.Sprintf("set %s to a pre-downloaded installer package", AutoPkgInstallerEnvVar)); err != nil {
+			return "", err
+		}
+
+		var releaseURL string
+		var err error
+
+		// Get the correct release URL (Pinned, Beta or Stable)
+		if installConfig.Version != "" {
+			releaseURL, err = getTaggedAutoPkgReleaseURL(installConfig.Version)
+			logger.Logger(fmt.Sprintf("📌 Fetching pinned AutoPkg Release %s...", installConfig.Version), logger.LogInfo)
+		} else if installConfig.UseBeta {
+			releaseURL, err = getBetaAutoPkgReleaseURL()
+			logger.Logger("🧪 Fetching latest Beta AutoPkg Release...", logger.LogInfo)
+		} else {
+			releaseURL, err = getLatestAutoPkgReleaseURL()
+			logger.Logger("🚀 Fetching latest Stable AutoPkg Release...", logger.LogInfo)
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve AutoPkg release URL: %w", err)
+		}
+
+		logger.Logger(fmt.Sprintf("📥 AutoPkg release URL: %s", releaseURL), logger.LogInfo)
+
+		// Proceed with downloading and installing AutoPkg
+		pkgPath = "/tmp/autopkg-latest.pkg"
+		if err := helpers.DownloadFile(releaseURL, pkgPath); err != nil {
+			return "", fmt.Errorf("failed to download AutoPkg package: %w", err)
+		}
 	}
+	return pkgPath, nil
+}
+
+// pinned reports whether a version satisfies the pinned version, which any
+// version does when none is pinned. A leading v is ignored, so v2.7.3 pins 2.7.3.
+func (c *InstallConfig) pinned(version string) bool {
+	if c.Version == "" {
+		return true
+	}
+	return strings.TrimPrefix(strings.TrimSpace(version), "v") == strings.TrimPrefix(strings.TrimSpace(c.Version), "v")
+}
+
+// getTaggedAutoPkgReleaseURL retrieves the URL of the package of an AutoPkg
+// release by version. Releases are tagged v2.7.3, a bare tag is tried as well.
+func getTaggedAutoPkgReleaseURL(version string) (string, error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	for _, tag := range []string{"v" + version, version} {
+		resp, err := githubGet("https://api.github.com/repos/autopkg/autopkg/releases/tags/" + tag)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return "", fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+		}
+
+		var release struct {
+			TagName string `json:"tag_name"`
+			Assets  []struct {
+				Name               string `json:"name"`
+				BrowserDownloadURL string `json:"browser_download_url"`
+			} `json:"assets"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&release)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to parse GitHub API response: %w", err)
+		}
 
-	// Add GitHub token for authentication if available
-	githubToken := os.Getenv("GITHUB_TOKEN")
-	if githubToken != "" {
-		req.Header.Set("Authorization", "token "+githubToken)
+		for _, asset := range release.Assets {
+			if strings.HasSuffix(asset.Name, ".pkg") {
+				logger.Logger(fmt.Sprintf("🔍 Found release %s with package %s", release.TagName, asset.Name), logger.LogInfo)
+				return asset.BrowserDownloadURL, nil
+			}
+		}
+		return "", fmt.Errorf("no pkg asset found in release %s", release.TagName)
 	}
 
-	// Add headers to identify our client
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "AutoPkgGitHubActions/1.0")
+	return "", fmt.Errorf("no AutoPkg release %s found", version)
+}
 
-	// Make the request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+// getBetaAutoPkgReleaseURL retrieves the URL of the latest beta AutoPkg release
+func getBetaAutoPkgReleaseURL() (string, error) {
+	// Get all releases including pre-releases
+	resp, err := githubGet("https://api.github.com/repos/autopkg/autopkg/releases")
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to GitHub API: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -259,25 +339,9 @@ func getBetaAutoPkgReleaseURL() (string, error) {
 
 // getLatestAutoPkgReleaseURL retrieves the URL of the latest AutoPkg release
 func getLatestAutoPkgReleaseURL() (string, error) {
-
-	req, err := http.NewRequest("GET", "https://api.github.com/repos/autopkg/autopkg/releases/latest", nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Add GitHub token for authentication if available
-	githubToken := os.Getenv("GITHUB_TOKEN")
-	if githubToken != "" {
-		req.Header.Set("Authorization", "token "+githubToken)
-	}
-
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "AutoPkgGitHubActions/1.0")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := githubGet("https://api.github.com/repos/autopkg/autopkg/releases/latest")
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to GitHub API: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
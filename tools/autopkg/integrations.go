@@ -0,0 +1,231 @@
+// integrations.go
+package autopkg
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// MDMIntegration is an MDM that upload recipes publish to. An integration
+// declares the preferences its uploader needs, how to validate them, which
+// tenant they point at and how to verify a run's uploads, so the factory
+// doesn't hardcode each MDM it supports.
+type MDMIntegration interface {
+	Name() string                                  // Recipe type and upload destination, e.g. "jamf"
+	DisplayName() string                           // Human readable name, e.g. "Jamf Pro"
+	SummaryKey() string                            // AutoPkg report summary key written by the uploader
+	RequiredPrefs() []string                       // Preference keys the uploader needs, alternatives separated by "|"
+	Enabled(prefs map[string]interface{}) bool     // Whether the preferences configure this MDM
+	Validate(prefs map[string]interface{}) []error // Problems with the configured preferences
+	Tenant(prefs map[string]interface{}) string    // Tenant uploads go to, empty when not configured
+	VerifyUpload(result *RecipeBatchResult) error  // Checks a recipe of this type uploaded what it built
+}
+
+var (
+	integrationsMu sync.RWMutex
+	integrations   = builtinIntegrations()
+)
+
+// RegisterIntegration adds an MDM integration, replacing any with the same name
+func RegisterIntegration(integration MDMIntegration) {
+	integrationsMu.Lock()
+	defer integrationsMu.Unlock()
+	integrations[integration.Name()] = integration
+}
+
+// Integration returns the integration with a name, or nil if none is registered
+func Integration(name string) MDMIntegration {
+	integrationsMu.RLock()
+	defer integrationsMu.RUnlock()
+	return integrations[name]
+}
+
+// Integrations returns every registered integration, sorted by name
+func Integrations() []MDMIntegration {
+	integrationsMu.RLock()
+	defer integrationsMu.RUnlock()
+
+	list := make([]MDMIntegration, 0, len(integrations))
+	for _, integration := range integrations {
+		list = append(list, integration)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// IntegrationStatus is the validation outcome of one integration against a preferences file
+type IntegrationStatus struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Enabled     bool     `json:"enabled"`
+	Tenant      string   `json:"tenant,omitempty"`
+	Problems    []string `json:"problems,omitempty"`
+}
+
+// ValidateIntegrations checks every integration the preferences enable
+func ValidateIntegrations(prefsPath string) ([]IntegrationStatus, error) {
+	prefs, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []IntegrationStatus
+	for _, integration := range Integrations() {
+		status := IntegrationStatus{
+			Name:        integration.Name(),
+			DisplayName: integration.DisplayName(),
+			Enabled:     integration.Enabled(prefs),
+		}
+		if status.Enabled {
+			status.Tenant = integration.Tenant(prefs)
+			for _, problem := range integration.Validate(prefs) {
+				status.Problems = append(status.Problems, problem.Error())
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// verifyIntegrationUploads checks the uploads of every upload recipe in the
+// batch with its integration. Uploaders skip packages the MDM already has, so
+// a failed check is a warning rather than a recipe failure.
+func verifyIntegrationUploads(options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult) {
+	// Uploads are only known from the report
+	if options.ReportPlist == "" {
+		return
+	}
+	for recipe, result := range results {
+		integration := Integration(recipeUploadType(recipe))
+		if integration == nil || result.ExecutionError != nil {
+			continue
+		}
+		if err := integration.VerifyUpload(result); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ %s upload check for %s: %v", integration.DisplayName(), recipe, err), logger.LogWarning)
+		}
+	}
+}
+
+// recipeUploadType returns the integration name of an upload recipe, e.g.
+// "jamf" for Firefox.jamf.recipe, or "" for recipes that don't upload
+func recipeUploadType(recipe string) string {
+	name := recipeBaseName(recipe)
+	for _, integration := range Integrations() {
+		if strings.HasSuffix(name, "."+integration.Name()) {
+			return integration.Name()
+		}
+	}
+	return ""
+}
+
+// recipeBaseName returns a recipe's name without its directory and file extension
+func recipeBaseName(recipe string) string {
+	name := recipe
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, ext := range []string{".recipe.yaml", ".recipe.plist", ".recipe"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// prefsIntegration is an MDM integration described by its preference keys
+type prefsIntegration struct {
+	name        string
+	displayName string
+	summaryKey  string
+	enableKeys  []string                                   // Any of these being set enables the integration
+	required    []string                                   // Required keys, alternatives separated by "|"
+	urlKeys     []string                                   // Keys that must hold https URLs when set
+	tenantKeys  []string                                   // Keys identifying the tenant, first set wins
+	tenant      func(prefs map[string]interface{}) string  // Replaces tenantKeys when set
+	validate    func(prefs map[string]interface{}) []error // Extra checks, may be nil
+}
+
+func (p *prefsIntegration) Name() string            { return p.name }
+func (p *prefsIntegration) DisplayName() string     { return p.displayName }
+func (p *prefsIntegration) SummaryKey() string      { return p.summaryKey }
+func (p *prefsIntegration) RequiredPrefs() []string { return p.required }
+
+// Enabled implements MDMIntegration
+func (p *prefsIntegration) Enabled(prefs map[string]interface{}) bool {
+	for _, key := range p.enableKeys {
+		if prefString(prefs, key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate implements MDMIntegration
+func (p *prefsIntegration) Validate(prefs map[string]interface{}) []error {
+	var problems []error
+	for _, requirement := range p.required {
+		alternatives := strings.Split(requirement, "|")
+		found := false
+		for _, key := range alternatives {
+			if prefString(prefs, key) != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Errorf("%s is not set", strings.Join(alternatives, " or ")))
+		}
+	}
+	for _, key := range p.urlKeys {
+		if value := prefString(prefs, key); value != "" {
+			if err := ValidateHTTPSURL(key, value); err != nil {
+				problems = append(problems, err)
+			}
+		}
+	}
+	if p.validate != nil {
+		problems = append(problems, p.validate(prefs)...)
+	}
+	return problems
+}
+
+// Tenant implements MDMIntegration, naming the tenant by the host of a URL key or the key's value
+func (p *prefsIntegration) Tenant(prefs map[string]interface{}) string {
+	if p.tenant != nil {
+		return p.tenant(prefs)
+	}
+	for _, key := range p.tenantKeys {
+		value := prefString(prefs, key)
+		if value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(value); err == nil && parsed.Host != "" {
+			return p.name + ":" + parsed.Host
+		}
+		return p.name + ":" + value
+	}
+	return ""
+}
+
+// VerifyUpload implements MDMIntegration, flagging recipes that report a new
+// version without the uploader recording an upload to this MDM
+func (p *prefsIntegration) VerifyUpload(result *RecipeBatchResult) error {
+	if result.Status != "updated" {
+		return nil
+	}
+	for _, upload := range result.Uploads {
+		if upload.Destination == p.name {
+			return nil
+		}
+	}
+	return fmt.Errorf("recipe reported a new version but no upload was recorded in %s", p.summaryKey)
+}
+
+// prefString returns a string preference, or "" when unset or not a string
+func prefString(prefs map[string]interface{}, key string) string {
+	value, _ := prefs[key].(string)
+	return strings.TrimSpace(value)
+}
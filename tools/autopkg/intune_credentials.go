@@ -0,0 +1,197 @@
+// intune_credentials.go
+package autopkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntuneRequiredPermission is the Microsoft Graph application permission
+// IntuneAppUploader needs to create and update apps
+const IntuneRequiredPermission = "DeviceManagementApps.ReadWrite.All"
+
+// Microsoft identity platform and Graph endpoints, variables so sovereign
+// clouds can point elsewhere
+var (
+	IntuneLoginURL = "https://login.microsoftonline.com"
+	IntuneGraphURL = "https://graph.microsoft.com"
+)
+
+// IntuneCredentialCheck is the outcome of checking the Intune credentials in
+// a preferences file
+type IntuneCredentialCheck struct {
+	TenantID           string        `json:"tenant_id"`
+	ClientID           string        `json:"client_id"`
+	TokenExpires       time.Time     `json:"token_expires"`
+	Roles              []string      `json:"roles,omitempty"`                // Application permissions consented for the app
+	PermissionGranted  bool          `json:"permission_granted"`             // Whether IntuneRequiredPermission is consented
+	Throttled          bool          `json:"throttled"`                      // Whether Graph answered the probe with 429
+	RetryAfter         time.Duration `json:"retry_after,omitempty"`          // Wait Graph asked for when throttled
+	ThrottleLimitUsage float64       `json:"throttle_limit_usage,omitempty"` // Share of the throttling limit used, only reported by Graph above 0.8
+}
+
+// ThrottleHeadroom describes how close the app is to being throttled by Intune
+func (c *IntuneCredentialCheck) ThrottleHeadroom() string {
+	switch {
+	case c.Throttled && c.RetryAfter > 0:
+		return fmt.Sprintf("throttled, retry after %s", c.RetryAfter)
+	case c.Throttled:
+		return "throttled"
+	case c.ThrottleLimitUsage > 0:
+		return fmt.Sprintf("%.0f%% of the throttling limit used", c.ThrottleLimitUsage*100)
+	default:
+		return "under 80% of the throttling limit used"
+	}
+}
+
+// CheckIntuneCredentials gets a Microsoft Graph token with the app
+// credentials in the preferences the way IntuneAppUploader does, checks
+// IntuneRequiredPermission is among the roles consented for the app, and
+// probes the Intune apps endpoint for throttling. It fails when the token
+// can't be issued; a missing permission only leaves PermissionGranted false.
+func CheckIntuneCredentials(prefs map[string]interface{}) (*IntuneCredentialCheck, error) {
+	check := &IntuneCredentialCheck{
+		TenantID: firstPrefString(prefs, "INTUNE_TENANT_ID", "TENANT_ID"),
+		ClientID: firstPrefString(prefs, "INTUNE_CLIENT_ID", "CLIENT_ID"),
+	}
+	secret := firstPrefString(prefs, "INTUNE_CLIENT_SECRET", "CLIENT_SECRET")
+	if check.TenantID == "" || check.ClientID == "" || secret == "" {
+		return nil, fmt.Errorf("no Intune credentials, set TENANT_ID, CLIENT_ID and CLIENT_SECRET of an app registration")
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	token, err := check.graphToken(client, secret)
+	if err != nil {
+		return nil, err
+	}
+	check.Roles = tokenRoles(token)
+	for _, role := range check.Roles {
+		if strings.EqualFold(role, IntuneRequiredPermission) {
+			check.PermissionGranted = true
+		}
+	}
+
+	if err := check.probeApps(client, token); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// graphToken gets a Microsoft Graph access token for the app with the client
+// credentials grant
+func (c *IntuneCredentialCheck) graphToken(client *http.Client, secret string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {secret},
+		"scope":         {IntuneGraphURL + "/.default"},
+	}
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", IntuneLoginURL, url.PathEscape(c.TenantID))
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Graph token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse Graph token response: %w", err)
+	}
+	switch {
+	case body.Error == "invalid_client" || body.Error == "unauthorized_client":
+		return "", fmt.Errorf("tenant %s rejected app %s, check CLIENT_ID and CLIENT_SECRET and that the secret hasn't expired", c.TenantID, c.ClientID)
+	case body.Error == "invalid_request" && strings.Contains(body.ErrorDescription, "AADSTS90002"):
+		return "", fmt.Errorf("tenant %s not found, check TENANT_ID", c.TenantID)
+	case body.Error != "":
+		return "", fmt.Errorf("tenant %s refused a Graph token for app %s: %s", c.TenantID, c.ClientID, strings.TrimSpace(strings.SplitN(body.ErrorDescription, "\n", 2)[0]))
+	case resp.StatusCode != http.StatusOK || body.AccessToken == "":
+		return "", fmt.Errorf("tenant %s returned status %d for a Graph token", c.TenantID, resp.StatusCode)
+	}
+	c.TokenExpires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return body.AccessToken, nil
+}
+
+// probeApps lists one Intune app, reading the throttling state Graph reports
+// in its response headers. A refusal marks the permission as not granted even
+// when the token claims it, as consent can be revoked after issue.
+func (c *IntuneCredentialCheck) probeApps(client *http.Client, token string) error {
+	req, err := http.NewRequest(http.MethodGet, IntuneGraphURL+"/beta/deviceAppManagement/mobileApps?$top=1&$select=id", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Graph request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if usage, err := strconv.ParseFloat(resp.Header.Get("x-ms-throttle-limit-percentage"), 64); err == nil {
+		c.ThrottleLimitUsage = usage
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusUnauthorized:
+		c.PermissionGranted = false
+	case http.StatusTooManyRequests:
+		c.Throttled = true
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			c.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	default:
+		return fmt.Errorf("Graph returned status %d listing Intune apps", resp.StatusCode)
+	}
+	return nil
+}
+
+// tokenRoles reads the roles claim of a JWT access token without verifying
+// it, returning nil when the token can't be decoded
+func tokenRoles(token string) []string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+	var claims struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims.Roles
+}
+
+// firstPrefString returns the first of the keys set in the preferences
+func firstPrefString(prefs map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value := prefString(prefs, key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,176 @@
+// isolation.go
+package autopkg
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"howett.net/plist"
+)
+
+// isolatedEnv is the environment an isolated batch runs autopkg in: its own
+// HOME, a copy of the preferences pointing at its own cache and a snapshot of
+// the override directories, so batches running side by side on one runner,
+// e.g. for two tenants, can't see each other's downloads or trust updates.
+// Recipe repos are shared, since runs only read them.
+type isolatedEnv struct {
+	dir          string
+	home         string
+	prefsPath    string // Copy of the batch preferences
+	sourcePrefs  string // Preferences the copy was made from
+	cacheDir     string
+	overrideDirs []string // Snapshots of the override directories, in search order
+}
+
+// newIsolatedEnv creates the isolated environment of a batch in a new temporary directory
+func newIsolatedEnv(options *RecipeBatchRunOptions) (*isolatedEnv, error) {
+	dir, err := os.MkdirTemp("", fmt.Sprintf("autopkgctl-isolated-%s-", options.RunID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create isolated environment: %w", err)
+	}
+
+	env := &isolatedEnv{
+		dir:         dir,
+		home:        filepath.Join(dir, "home"),
+		sourcePrefs: options.PrefsPath,
+		cacheDir:    filepath.Join(dir, "Cache"),
+	}
+	env.prefsPath = filepath.Join(env.home, "Library", "Preferences", "com.github.autopkg.plist")
+
+	if err := env.create(options); err != nil {
+		env.remove()
+		return nil, err
+	}
+
+	logger.Logger(fmt.Sprintf("🧱 Running batch isolated in %s", dir), logger.LogInfo)
+	return env, nil
+}
+
+// create copies the preferences and snapshots the override directories
+func (e *isolatedEnv) create(options *RecipeBatchRunOptions) error {
+	for _, subdir := range []string{filepath.Dir(e.prefsPath), e.cacheDir} {
+		if err := os.MkdirAll(subdir, 0755); err != nil {
+			return fmt.Errorf("failed to create isolated environment: %w", err)
+		}
+	}
+
+	// Later copies of an override directory listed twice would only shadow the first
+	seen := make(map[string]bool)
+	for _, source := range append(append([]string{}, options.OverrideDirs...), recipeOverrideDirs(options.PrefsPath)...) {
+		source = expandTilde(source)
+		if seen[source] {
+			continue
+		}
+		seen[source] = true
+
+		snapshot := filepath.Join(e.dir, "RecipeOverrides", fmt.Sprintf("%d-%s", len(e.overrideDirs), filepath.Base(source)))
+		if err := copyTree(source, snapshot); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to snapshot overrides %s: %w", source, err)
+		}
+		e.overrideDirs = append(e.overrideDirs, snapshot)
+	}
+
+	prefs, err := GetAutoPkgPreferences(options.PrefsPath)
+	if err != nil {
+		prefs = make(map[string]interface{})
+	}
+	prefs["CACHE_DIR"] = e.cacheDir
+	overrideDirs := []interface{}{}
+	for _, dir := range e.overrideDirs {
+		overrideDirs = append(overrideDirs, dir)
+	}
+	prefs["RECIPE_OVERRIDE_DIRS"] = overrideDirs
+	// Repos are found where they are, not under the isolated HOME
+	if _, set := prefs["RECIPE_REPO_DIR"]; !set {
+		prefs["RECIPE_REPO_DIR"] = recipeRepoDir(options.PrefsPath)
+	}
+
+	data, err := plist.MarshalIndent(prefs, plist.XMLFormat, "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode isolated preferences: %w", err)
+	}
+	if err := os.WriteFile(e.prefsPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write isolated preferences: %w", err)
+	}
+	return nil
+}
+
+// apply points a recipe run at the isolated environment. Recipes with
+// preferences of their own, from RecipeOverrides, still run with HOME isolated.
+func (e *isolatedEnv) apply(runOpts *RunOptions) {
+	if e == nil {
+		return
+	}
+	runOpts.Home = e.home
+	if runOpts.PrefsPath == e.sourcePrefs {
+		runOpts.PrefsPath = e.prefsPath
+		runOpts.OverrideDirs = e.overrideDirs
+	}
+}
+
+// prefsPathFor returns the preferences a run with prefsPath uses in the isolated environment
+func (e *isolatedEnv) prefsPathFor(prefsPath string) string {
+	if e == nil || prefsPath != e.sourcePrefs {
+		return prefsPath
+	}
+	return e.prefsPath
+}
+
+// overrideDirsFor returns the override directories a run with prefsPath uses in the isolated environment
+func (e *isolatedEnv) overrideDirsFor(prefsPath string, overrideDirs []string) []string {
+	if e == nil || prefsPath != e.prefsPath {
+		return overrideDirs
+	}
+	return e.overrideDirs
+}
+
+// remove deletes the isolated environment
+func (e *isolatedEnv) remove() {
+	if err := os.RemoveAll(e.dir); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to remove isolated environment %s: %v", e.dir, err), logger.LogWarning)
+	}
+}
+
+// copyTree copies a directory's files, skipping hidden directories such as .git
+func copyTree(source string, target string) error {
+	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		destination := filepath.Join(target, rel)
+
+		if entry.IsDir() {
+			if path != source && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(destination, 0755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(destination)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
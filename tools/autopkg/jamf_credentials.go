@@ -0,0 +1,294 @@
+// jamf_credentials.go
+package autopkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// JamfRequiredPrivileges are the Jamf Pro privileges JamfUploader needs to
+// upload packages and point policies at them
+var JamfRequiredPrivileges = []string{"Create Packages", "Update Packages", "Create Policies", "Update Policies"}
+
+// Jamf Pro authentication methods
+const (
+	JamfAuthAPIClient = "api-client"
+	JamfAuthBasic     = "basic"
+	JamfAuthClassic   = "classic"
+)
+
+// JamfCredentialCheck is the outcome of checking the Jamf Pro credentials in
+// a preferences file
+type JamfCredentialCheck struct {
+	Server            string    `json:"server"`
+	AuthMethod        string    `json:"auth_method"`                  // JamfAuthAPIClient, JamfAuthBasic or JamfAuthClassic
+	Account           string    `json:"account"`                      // API user or API client, e.g. "API user autopkg"
+	TokenExpires      time.Time `json:"token_expires,omitempty"`      // Expiry of the token issued, zero for classic auth
+	PrivilegesChecked bool      `json:"privileges_checked"`           // Whether Jamf Pro told us the account's privileges
+	MissingPrivileges []string  `json:"missing_privileges,omitempty"` // JamfRequiredPrivileges the account doesn't have
+}
+
+// jamfCredentials are the Jamf Pro server and credentials JamfUploader reads from the preferences
+type jamfCredentials struct {
+	server       string
+	username     string
+	password     string
+	clientID     string
+	clientSecret string
+	clientKeys   [2]string
+}
+
+// CheckJamfCredentials signs in to Jamf Pro with the credentials in the
+// preferences the way JamfUploader does, with an API client or an API user
+// token, falling back to classic API basic auth on servers without the token
+// endpoint, and reads which of JamfRequiredPrivileges the account lacks.
+// It fails when Jamf Pro can't be reached or rejects the credentials; a
+// server that doesn't say what the account may do only leaves
+// PrivilegesChecked false.
+func CheckJamfCredentials(prefs map[string]interface{}) (*JamfCredentialCheck, error) {
+	creds, err := newJamfCredentials(prefs)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	check := &JamfCredentialCheck{Server: creds.server}
+
+	var token string
+	if creds.clientID != "" {
+		check.AuthMethod = JamfAuthAPIClient
+		check.Account = "API client " + creds.clientID
+		token, check.TokenExpires, err = creds.clientToken(client)
+	} else {
+		check.AuthMethod = JamfAuthBasic
+		check.Account = "API user " + creds.username
+		token, check.TokenExpires, err = creds.userToken(client)
+		if err == errJamfTokenUnsupported {
+			check.AuthMethod = JamfAuthClassic
+			err = creds.classicPrivileges(client, check)
+			return check, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	creds.tokenPrivileges(client, token, check)
+	return check, nil
+}
+
+// newJamfCredentials reads the Jamf Pro server and credentials from the
+// preferences, preferring an API client over an API user like JamfUploader
+func newJamfCredentials(prefs map[string]interface{}) (*jamfCredentials, error) {
+	server := prefString(prefs, "JSS_URL")
+	if server == "" {
+		server = prefString(prefs, "JAMFPRO_URL")
+	}
+	if server == "" {
+		return nil, fmt.Errorf("JSS_URL isn't set, set the Jamf Pro URL with configure --jss-url")
+	}
+
+	creds := &jamfCredentials{
+		server:       strings.TrimRight(server, "/"),
+		username:     prefString(prefs, "API_USERNAME"),
+		password:     prefString(prefs, "API_PASSWORD"),
+		clientID:     prefString(prefs, "JAMFPRO_CLIENT_ID"),
+		clientSecret: prefString(prefs, "JAMFPRO_CLIENT_SECRET"),
+		clientKeys:   [2]string{"JAMFPRO_CLIENT_ID", "JAMFPRO_CLIENT_SECRET"},
+	}
+	// CLIENT_ID and CLIENT_SECRET belong to Intune when a tenant is set
+	intune := prefString(prefs, "TENANT_ID") != "" || prefString(prefs, "INTUNE_TENANT_ID") != ""
+	if creds.clientID == "" && !intune {
+		creds.clientID = prefString(prefs, "CLIENT_ID")
+		creds.clientSecret = prefString(prefs, "CLIENT_SECRET")
+		creds.clientKeys = [2]string{"CLIENT_ID", "CLIENT_SECRET"}
+	}
+
+	switch {
+	case creds.clientID != "" && creds.clientSecret != "":
+	case creds.username != "" && creds.password != "":
+		creds.clientID = ""
+	default:
+		return nil, fmt.Errorf("no Jamf Pro credentials, set an API client with configure --client-id and --client-secret or an API user with --api-username and --api-password")
+	}
+	return creds, nil
+}
+
+// errJamfTokenUnsupported is returned for servers older than the Jamf Pro API token endpoint
+var errJamfTokenUnsupported = errors.New("Jamf Pro API token endpoint not found")
+
+// clientToken gets an access token for an API client
+func (c *jamfCredentials) clientToken(client *http.Client) (string, time.Time, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.clientID},
+		"client_secret": {c.clientSecret},
+	}
+	req, err := http.NewRequest(http.MethodPost, c.server+"/api/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create Jamf Pro token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	status, err := jamfDo(client, req, &body)
+	switch {
+	case err != nil:
+		return "", time.Time{}, err
+	case status == http.StatusUnauthorized || status == http.StatusBadRequest:
+		return "", time.Time{}, fmt.Errorf("Jamf Pro %s rejected the API client, check %s and %s and that the client is enabled", c.server, c.clientKeys[0], c.clientKeys[1])
+	case status != http.StatusOK || body.AccessToken == "":
+		return "", time.Time{}, fmt.Errorf("Jamf Pro %s returned status %d for an API client token", c.server, status)
+	}
+	return body.AccessToken, time.Now().Add(time.Duration(body.ExpiresIn) * time.Second), nil
+}
+
+// userToken gets a Jamf Pro API token for an API user
+func (c *jamfCredentials) userToken(client *http.Client) (string, time.Time, error) {
+	req, err := http.NewRequest(http.MethodPost, c.server+"/api/v1/auth/token", nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create Jamf Pro token request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	var body struct {
+		Token   string    `json:"token"`
+		Expires time.Time `json:"expires"`
+	}
+	status, err := jamfDo(client, req, &body)
+	switch {
+	case err != nil:
+		return "", time.Time{}, err
+	case status == http.StatusNotFound:
+		return "", time.Time{}, errJamfTokenUnsupported
+	case status == http.StatusUnauthorized:
+		return "", time.Time{}, fmt.Errorf("Jamf Pro %s rejected API user %s, check API_USERNAME and API_PASSWORD", c.server, c.username)
+	case status != http.StatusOK || body.Token == "":
+		return "", time.Time{}, fmt.Errorf("Jamf Pro %s returned status %d for an API token", c.server, status)
+	}
+	return body.Token, body.Expires, nil
+}
+
+// tokenPrivileges reads the privileges of the account a token was issued to
+func (c *jamfCredentials) tokenPrivileges(client *http.Client, token string, check *JamfCredentialCheck) {
+	req, err := http.NewRequest(http.MethodGet, c.server+"/api/v1/auth", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var body struct {
+		Account struct {
+			PrivilegeSet     string              `json:"privilegeSet"`
+			PrivilegesBySite map[string][]string `json:"privilegesBySite"`
+		} `json:"account"`
+	}
+	if status, err := jamfDo(client, req, &body); err != nil || status != http.StatusOK {
+		return
+	}
+	// API clients get their privileges from API roles, which aren't listed here
+	if body.Account.PrivilegeSet == "" && len(body.Account.PrivilegesBySite) == 0 {
+		return
+	}
+
+	check.PrivilegesChecked = true
+	if strings.EqualFold(body.Account.PrivilegeSet, "ADMINISTRATOR") {
+		return
+	}
+	var privileges []string
+	for _, site := range body.Account.PrivilegesBySite {
+		privileges = append(privileges, site...)
+	}
+	check.MissingPrivileges = missingJamfPrivileges(privileges)
+}
+
+// classicPrivileges checks an API user with basic auth against the classic
+// API, reading the account's privileges
+func (c *jamfCredentials) classicPrivileges(client *http.Client, check *JamfCredentialCheck) error {
+	req, err := http.NewRequest(http.MethodGet, c.server+"/JSSResource/accounts/username/"+url.PathEscape(c.username), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Jamf Pro account request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	var body struct {
+		Account struct {
+			PrivilegeSet string `json:"privilege_set"`
+			Privileges   struct {
+				JSSObjects []interface{} `json:"jss_objects"`
+			} `json:"privileges"`
+		} `json:"account"`
+	}
+	status, err := jamfDo(client, req, &body)
+	switch {
+	case err != nil:
+		return err
+	case status == http.StatusUnauthorized:
+		return fmt.Errorf("Jamf Pro %s rejected API user %s, check API_USERNAME and API_PASSWORD", c.server, c.username)
+	case status != http.StatusOK:
+		// Accounts without the Read Accounts privilege can still upload
+		return nil
+	}
+
+	check.PrivilegesChecked = true
+	if strings.EqualFold(body.Account.PrivilegeSet, "Administrator") {
+		return nil
+	}
+	// The classic API lists privileges as strings or as {"privilege": name}
+	var privileges []string
+	for _, object := range body.Account.Privileges.JSSObjects {
+		switch value := object.(type) {
+		case string:
+			privileges = append(privileges, value)
+		case map[string]interface{}:
+			if name, ok := value["privilege"].(string); ok {
+				privileges = append(privileges, name)
+			}
+		}
+	}
+	check.MissingPrivileges = missingJamfPrivileges(privileges)
+	return nil
+}
+
+// missingJamfPrivileges returns the required privileges not in a list
+func missingJamfPrivileges(privileges []string) []string {
+	have := make(map[string]bool, len(privileges))
+	for _, privilege := range privileges {
+		have[strings.ToLower(privilege)] = true
+	}
+	var missing []string
+	for _, required := range JamfRequiredPrivileges {
+		if !have[strings.ToLower(required)] {
+			missing = append(missing, required)
+		}
+	}
+	return missing
+}
+
+// jamfDo sends a Jamf Pro request, decoding a successful JSON response into
+// body, and returns the response status
+func jamfDo(client *http.Client, req *http.Request, body interface{}) (int, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to Jamf Pro %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to parse Jamf Pro response from %s: %w", req.URL.Path, err)
+	}
+	return resp.StatusCode, nil
+}
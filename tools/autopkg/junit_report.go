@@ -0,0 +1,192 @@
+// junit_report.go
+package autopkg
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxJUnitOutput is how much of a recipe's output a JUnit test case keeps,
+// from the end; CI servers store the report with every build
+const maxJUnitOutput = 64 * 1024
+
+// junitTestSuites is the root of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite is a run, with a test case per recipe
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Hostname   string          `xml:"hostname,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+// junitProperty is a name and value describing a run
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase is the outcome of a recipe
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitMessage is the failure or skip of a test case
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes a run as a JUnit XML report with a test case per
+// recipe, so CI servers such as Jenkins, GitLab and Azure Pipelines show
+// recipe failures in their test UI and track them across builds. Failed
+// recipes are failures carrying their error and failure hint, skipped and
+// blocked recipes are skipped. results may be nil, e.g. for a run loaded
+// from its record, leaving out the recipes' output.
+func WriteJUnitReport(path string, record *RunRecord, results map[string]*RecipeBatchResult) error {
+	data, err := xml.MarshalIndent(newJUnitReport(record, results), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JUnit report: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
+
+// newJUnitReport converts a run record and, when given, its results into a JUnit report
+func newJUnitReport(record *RunRecord, results map[string]*RecipeBatchResult) *junitTestSuites {
+	duration := junitSeconds(record.EndTime.Sub(record.StartTime))
+	suite := junitTestSuite{
+		Name:      "autopkg run " + record.RunID,
+		Time:      duration,
+		Timestamp: record.StartTime.UTC().Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{Name: "run_id", Value: record.RunID},
+			{Name: "status", Value: record.Status},
+		},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		suite.Hostname = hostname
+	}
+	if record.Chaos {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "chaos", Value: "true"})
+	}
+	if record.CheckOnly {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "check_only", Value: "true"})
+	}
+
+	for _, recipe := range record.Recipes {
+		testCase := junitTestCase{
+			Name:      recipe.Recipe,
+			ClassName: junitClassName(recipe.Recipe),
+			Time:      junitSeconds(recipe.Duration),
+		}
+
+		switch recipe.Status {
+		case "failed":
+			text := recipe.Error
+			if hint := FailureHint(recipe.FailureKind); hint != "" {
+				text += "\n\n" + hint
+			}
+			if recipe.Attempts > 1 {
+				text += fmt.Sprintf("\n\nFailed after %d attempts", recipe.Attempts)
+			}
+			testCase.Failure = &junitMessage{Message: recipe.Error, Type: recipe.FailureKind, Text: strings.TrimSpace(text)}
+			if recipe.ChaosFault != "" {
+				testCase.Failure.Type = "chaos:" + recipe.ChaosFault
+			}
+			suite.Failures++
+		case "skipped", StatusBlocked:
+			message := recipe.SkipReason
+			if message == "" {
+				message = recipe.Error
+			}
+			testCase.Skipped = &junitMessage{Message: message, Type: recipe.Status}
+			suite.Skipped++
+		}
+
+		if result := results[recipe.Recipe]; result != nil {
+			output := result.Output
+			if len(output) > maxJUnitOutput {
+				output = "...\n" + output[len(output)-maxJUnitOutput:]
+			}
+			testCase.SystemOut = output
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Tests = len(suite.Cases)
+
+	return &junitTestSuites{
+		Name:     "autopkg",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     duration,
+		Suites:   []junitTestSuite{suite},
+	}
+}
+
+// junitClassName groups a recipe's test case by its type, e.g. "autopkg.jamf"
+// for Firefox.jamf.recipe, which CI servers show as the package of the test
+func junitClassName(recipe string) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(recipe, ".yaml"), ".recipe")
+	if i := strings.LastIndex(name, "."); i >= 0 && i < len(name)-1 {
+		return "autopkg." + name[i+1:]
+	}
+	return "autopkg"
+}
+
+// junitSeconds formats a duration as JUnit's seconds with millisecond precision
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// JUnitReportEventSink writes the JUnit XML report of a run when it finishes
+type JUnitReportEventSink struct {
+	Path string
+}
+
+// Name implements EventSink
+func (s *JUnitReportEventSink) Name() string { return "junit report " + s.Path }
+
+// Handle implements EventSink
+func (s *JUnitReportEventSink) Handle(event Event) error {
+	if event.Type != EventRunFinished || event.Record == nil {
+		return nil
+	}
+	return WriteJUnitReport(s.Path, event.Record, event.Results)
+}
@@ -0,0 +1,85 @@
+// latest.go
+package autopkg
+
+import (
+	"strings"
+	"time"
+)
+
+// LatestBuild answers "what is the newest version of this app we built, and
+// where did it go", so other automation can ask the history instead of an MDM console
+type LatestBuild struct {
+	App            string          `json:"app"`
+	Recipe         string          `json:"recipe"`
+	Version        string          `json:"version"`
+	BuiltAt        time.Time       `json:"built_at"`
+	RunID          string          `json:"run_id"`
+	ArtifactPath   string          `json:"artifact_path,omitempty"`
+	ArtifactSHA256 string          `json:"artifact_sha256,omitempty"`
+	Destinations   []UploadReceipt `json:"destinations"`
+}
+
+// Latest returns the newest successful build of an app, or nil if none was
+// recorded. The app is matched against the exact recipe name or the app part
+// of recipe names, so "Firefox" covers Firefox.pkg and Firefox.jamf alike.
+func (h *History) Latest(app string) (*LatestBuild, error) {
+	recipes, err := h.Recipes()
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *HistoryEntry
+	for _, recipe := range recipes {
+		if !recipeMatchesApp(recipe, app) {
+			continue
+		}
+		entry, err := h.LastSuccessful(recipe, time.Now().Add(time.Minute))
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil && (newest == nil || entry.Timestamp.After(newest.Timestamp)) {
+			newest = entry
+		}
+	}
+
+	if newest == nil {
+		return nil, nil
+	}
+
+	build := &LatestBuild{
+		App:            app,
+		Recipe:         newest.Recipe,
+		Version:        newest.Version,
+		BuiltAt:        newest.Timestamp,
+		RunID:          newest.RunID,
+		ArtifactPath:   newest.ArtifactPath,
+		ArtifactSHA256: newest.ArtifactSHA256,
+		Destinations:   []UploadReceipt{},
+	}
+
+	// Uploads are often done by a sibling recipe, e.g. Firefox.jamf uploads what Firefox.pkg built
+	receipts, err := h.Receipts()
+	if err != nil {
+		return nil, err
+	}
+	for _, receipt := range receipts {
+		if receipt.Version == newest.Version && recipeMatchesApp(receipt.Recipe, app) {
+			build.Destinations = append(build.Destinations, receipt)
+		}
+	}
+
+	return build, nil
+}
+
+// recipeMatchesApp reports whether a recipe name refers to an app, ignoring case
+func recipeMatchesApp(recipe string, app string) bool {
+	name := recipe
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if strings.EqualFold(name, app) || normalizeCatalogRecipeName(name) == normalizeCatalogRecipeName(app) {
+		return true
+	}
+	appName, _, _ := strings.Cut(name, ".")
+	return strings.EqualFold(appName, app)
+}
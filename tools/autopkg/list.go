@@ -2,12 +2,17 @@ package autopkg
 
 import (
 	"fmt"
-	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
 )
 
+// DefaultValidateConcurrency is the number of overrides ValidateRecipeList
+// verifies or updates at once when the batched verification can't settle them
+const DefaultValidateConcurrency = 8
+
 // ValidateRecipeListOptions contains options for validating a recipe list
 type ValidateRecipeListOptions struct {
 	PrefsPath            string
@@ -16,6 +21,10 @@ type ValidateRecipeListOptions struct {
 	VerifyTrust          bool
 	UpdateTrustOnFailure bool
 	AllowNonExistent     bool
+	StateDir             string // Directory of the history database holding the trust cache, defaults to DefaultStateDir()
+	HistoryPath          string // History database holding the trust cache, defaults to history.db in StateDir
+	NoTrustCache         bool   // Verify every override, even those unchanged since they last verified
+	Concurrency          int    // Overrides verified at once, defaults to DefaultValidateConcurrency
 }
 
 // ValidateRecipeListResult contains the result of a recipe list validation
@@ -26,7 +35,11 @@ type ValidateRecipeListResult struct {
 	MissingRecipes     []string
 }
 
-// ValidateRecipeList checks if all recipes in a list exist and are accessible
+// ValidateRecipeList checks if all recipes in a list exist and are accessible.
+// Recipes are looked up in a single structured listing. Overrides unchanged
+// since they last verified are taken from the trust cache, the rest are
+// verified in one autopkg run, and those it can't settle, or that need their
+// trust info updated, are handled by concurrent workers.
 func ValidateRecipeList(recipes []string, options *ValidateRecipeListOptions) (*ValidateRecipeListResult, error) {
 	if options == nil {
 		options = &ValidateRecipeListOptions{
@@ -37,6 +50,7 @@ func ValidateRecipeList(recipes []string, options *ValidateRecipeListOptions) (*
 	}
 
 	logger.Logger(fmt.Sprintf("🔍 Validating %d recipes", len(recipes)), logger.LogInfo)
+	startTime := time.Now()
 
 	result := &ValidateRecipeListResult{
 		ValidRecipes:       []string{},
@@ -45,34 +59,78 @@ func ValidateRecipeList(recipes []string, options *ValidateRecipeListOptions) (*
 		MissingRecipes:     []string{},
 	}
 
-	// Get list of all available recipes
-	listCmd := exec.Command("autopkg", "list-recipes")
-	if options.PrefsPath != "" {
-		listCmd.Args = append(listCmd.Args, "--prefs", options.PrefsPath)
+	// Get every available recipe, with identifiers and paths, in one listing
+	listed, err := ListRecipeInfo(&ListRecipeOptions{
+		PrefsPath:    options.PrefsPath,
+		SearchDirs:   options.SearchDirs,
+		OverrideDirs: options.OverrideDirs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list available recipes: %w", err)
 	}
-	for _, dir := range options.SearchDirs {
-		listCmd.Args = append(listCmd.Args, "--search-dir", dir)
+	availableRecipes := make(map[string]*RecipeInfo, len(listed))
+	for i := range listed {
+		availableRecipes[listed[i].Name] = &listed[i]
+		if _, taken := availableRecipes[listed[i].Identifier]; !taken {
+			availableRecipes[listed[i].Identifier] = &listed[i]
+		}
 	}
-	for _, dir := range options.OverrideDirs {
-		listCmd.Args = append(listCmd.Args, "--override-dir", dir)
+
+	var cache *trustCache
+	if options.VerifyTrust && !options.NoTrustCache {
+		cache, err = newTrustCache(&RecipeBatchRunOptions{
+			PrefsPath:    options.PrefsPath,
+			SearchDirs:   options.SearchDirs,
+			OverrideDirs: options.OverrideDirs,
+			StateDir:     options.StateDir,
+			HistoryPath:  options.HistoryPath,
+		})
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Trust cache unavailable, verifying every override: %v", err), logger.LogWarning)
+		}
 	}
 
-	listOutput, err := listCmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list available recipes: %w", err)
+	// Sort the recipes into missing ones and overrides still to verify
+	missing := make(map[string]bool)
+	trusted := make(map[string]bool)
+	var overrides []string
+	for _, recipe := range recipes {
+		recipe = strings.TrimSpace(recipe)
+		if recipe == "" {
+			continue
+		}
+
+		info := availableRecipes[strings.TrimSuffix(recipe, ".recipe")]
+		if info == nil {
+			missing[recipe] = true
+			continue
+		}
+		if !options.VerifyTrust || !(info.IsOverride || strings.HasSuffix(recipe, ".override")) {
+			trusted[recipe] = true
+			continue
+		}
+		if _, queued := trusted[recipe]; queued {
+			continue
+		}
+		if cache != nil && cache.lookup(recipe) {
+			logger.Logger(fmt.Sprintf("🔐 Trust for %s unchanged since last verified", recipe), logger.LogDebug)
+			trusted[recipe] = true
+			continue
+		}
+		trusted[recipe] = false
+		overrides = append(overrides, recipe)
 	}
 
-	// Parse the available recipes
-	availableRecipes := map[string]bool{}
-	lines := strings.Split(string(listOutput), "\n")
-	for _, line := range lines {
-		recipeName := strings.TrimSpace(line)
-		if recipeName != "" {
-			availableRecipes[recipeName] = true
+	if len(overrides) > 0 {
+		for recipe, passed := range verifyRecipeListTrust(overrides, options) {
+			trusted[recipe] = passed
+			if passed && cache != nil {
+				cache.record(recipe)
+			}
 		}
 	}
 
-	// Check each recipe in the list
+	// Check each recipe in the list, in list order
 	for _, recipe := range recipes {
 		recipe = strings.TrimSpace(recipe)
 		if recipe == "" {
@@ -80,7 +138,7 @@ func ValidateRecipeList(recipes []string, options *ValidateRecipeListOptions) (*
 		}
 
 		// Check if the recipe exists
-		if !availableRecipes[recipe] {
+		if missing[recipe] {
 			result.MissingRecipes = append(result.MissingRecipes, recipe)
 			if !options.AllowNonExistent {
 				result.InvalidRecipes = append(result.InvalidRecipes, recipe)
@@ -88,62 +146,123 @@ func ValidateRecipeList(recipes []string, options *ValidateRecipeListOptions) (*
 			continue
 		}
 
-		// If it's an override and trust verification is enabled, verify it
-		if options.VerifyTrust && strings.HasSuffix(recipe, ".override") {
-			verifyOptions := &VerifyTrustInfoOptions{
-				PrefsPath:    options.PrefsPath,
-				SearchDirs:   options.SearchDirs,
-				OverrideDirs: options.OverrideDirs,
-			}
-
-			success, _, verifyOutput, err := VerifyTrustInfoForRecipes([]string{recipe}, verifyOptions)
-			logger.Logger(fmt.Sprintf("🔍 Trust verification for %s:\n%s", recipe, verifyOutput), logger.LogDebug)
-
-			if err != nil || !success {
-				if options.UpdateTrustOnFailure {
-					// Try to update trust info
-					updateOptions := &UpdateTrustInfoOptions{
-						PrefsPath:    options.PrefsPath,
-						SearchDirs:   options.SearchDirs,
-						OverrideDirs: options.OverrideDirs,
-					}
-
-					updateOutput, updateErr := UpdateTrustInfoForRecipes([]string{recipe}, updateOptions)
-					logger.Logger(fmt.Sprintf("🔄 Trust update output for %s:\n%s", recipe, updateOutput), logger.LogDebug)
-
-					if updateErr != nil {
-						logger.Logger(fmt.Sprintf("⚠️ Failed to update trust info for %s: %v\n%s", recipe, updateErr, updateOutput), logger.LogWarning)
-						result.TrustFailedRecipes = append(result.TrustFailedRecipes, recipe)
-						result.InvalidRecipes = append(result.InvalidRecipes, recipe)
-						continue
-					}
-
-					// Verify again after update
-					success, _, secondVerifyOutput, verifyErr := VerifyTrustInfoForRecipes([]string{recipe}, verifyOptions)
-					logger.Logger(fmt.Sprintf("🔍 Second trust verification for %s:\n%s", recipe, secondVerifyOutput), logger.LogDebug)
-
-					if verifyErr != nil || !success {
-						logger.Logger(fmt.Sprintf("⚠️ Failed to verify trust info for %s even after update:\n%s", recipe, secondVerifyOutput), logger.LogWarning)
-						result.TrustFailedRecipes = append(result.TrustFailedRecipes, recipe)
-						result.InvalidRecipes = append(result.InvalidRecipes, recipe)
-						continue
-					}
-				} else {
-					logger.Logger(fmt.Sprintf("⚠️ Trust verification failed for %s:\n%s", recipe, verifyOutput), logger.LogWarning)
-					result.TrustFailedRecipes = append(result.TrustFailedRecipes, recipe)
-					result.InvalidRecipes = append(result.InvalidRecipes, recipe)
-					continue
-				}
-			}
+		if !trusted[recipe] {
+			result.TrustFailedRecipes = append(result.TrustFailedRecipes, recipe)
+			result.InvalidRecipes = append(result.InvalidRecipes, recipe)
+			continue
 		}
 
 		// If we got here, the recipe is valid
 		result.ValidRecipes = append(result.ValidRecipes, recipe)
 	}
 
-	logger.Logger(fmt.Sprintf("✅ Validation complete: %d valid, %d invalid, %d trust failed, %d missing",
-		len(result.ValidRecipes), len(result.InvalidRecipes), len(result.TrustFailedRecipes), len(result.MissingRecipes)),
+	if cache != nil {
+		if err := cache.save(); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to save trust cache: %v", err), logger.LogWarning)
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("✅ Validation complete in %s: %d valid, %d invalid, %d trust failed, %d missing",
+		time.Since(startTime).Round(time.Millisecond), len(result.ValidRecipes), len(result.InvalidRecipes), len(result.TrustFailedRecipes), len(result.MissingRecipes)),
 		logger.LogSuccess)
 
 	return result, nil
 }
+
+// verifyRecipeListTrust verifies overrides in one autopkg run, then settles
+// the overrides that run couldn't, and updates the trust info of those that
+// failed, Concurrency at a time. It returns whether each override is trusted.
+func verifyRecipeListTrust(overrides []string, options *ValidateRecipeListOptions) map[string]bool {
+	verifyOptions := &VerifyTrustInfoOptions{
+		PrefsPath:    options.PrefsPath,
+		SearchDirs:   options.SearchDirs,
+		OverrideDirs: options.OverrideDirs,
+	}
+
+	var batchTrust map[string]*TrustVerification
+	if len(overrides) > 1 {
+		var err error
+		batchTrust, err = VerifyTrustInfoBatch(overrides, verifyOptions)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ %v, verifying overrides one at a time", err), logger.LogWarning)
+		}
+	}
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultValidateConcurrency
+	}
+
+	results := make([]bool, len(overrides))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = verifyRecipeListOverride(overrides[i], batchTrust[overrides[i]], verifyOptions, options)
+			}
+		}()
+	}
+
+	for i := range overrides {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	trusted := make(map[string]bool, len(overrides))
+	for i, recipe := range overrides {
+		trusted[recipe] = results[i]
+	}
+	return trusted
+}
+
+// verifyRecipeListOverride settles the trust of a single override, verifying
+// it on its own when the batched verification has no outcome for it, and
+// updating and verifying it again when it fails and updates are allowed
+func verifyRecipeListOverride(recipe string, verified *TrustVerification, verifyOptions *VerifyTrustInfoOptions, options *ValidateRecipeListOptions) bool {
+	var success bool
+	var verifyOutput string
+	var err error
+	if verified != nil {
+		success = verified.Passed
+		verifyOutput = strings.Join(verified.Reasons, "\n")
+	} else {
+		success, _, verifyOutput, err = VerifyTrustInfoForRecipes([]string{recipe}, verifyOptions)
+		logger.Logger(fmt.Sprintf("🔍 Trust verification for %s:\n%s", recipe, verifyOutput), logger.LogDebug)
+	}
+	if err == nil && success {
+		return true
+	}
+
+	if !options.UpdateTrustOnFailure {
+		logger.Logger(fmt.Sprintf("⚠️ Trust verification failed for %s:\n%s", recipe, verifyOutput), logger.LogWarning)
+		return false
+	}
+
+	// Try to update trust info
+	updateOutput, updateErr := UpdateTrustInfoForRecipes([]string{recipe}, &UpdateTrustInfoOptions{
+		PrefsPath:    options.PrefsPath,
+		SearchDirs:   options.SearchDirs,
+		OverrideDirs: options.OverrideDirs,
+	})
+	logger.Logger(fmt.Sprintf("🔄 Trust update output for %s:\n%s", recipe, updateOutput), logger.LogDebug)
+
+	if updateErr != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to update trust info for %s: %v\n%s", recipe, updateErr, updateOutput), logger.LogWarning)
+		return false
+	}
+
+	// Verify again after update
+	success, _, secondVerifyOutput, verifyErr := VerifyTrustInfoForRecipes([]string{recipe}, verifyOptions)
+	logger.Logger(fmt.Sprintf("🔍 Second trust verification for %s:\n%s", recipe, secondVerifyOutput), logger.LogDebug)
+
+	if verifyErr != nil || !success {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to verify trust info for %s even after update:\n%s", recipe, secondVerifyOutput), logger.LogWarning)
+		return false
+	}
+	return true
+}
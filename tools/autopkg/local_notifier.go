@@ -0,0 +1,36 @@
+// local_notifier.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localNotificationPath returns the file a file:// webhook URL points to, letting
+// notifications be written locally, e.g. in the sandbox or to inspect payloads
+func localNotificationPath(webhookURL string) (string, bool) {
+	if !strings.HasPrefix(webhookURL, "file://") {
+		return "", false
+	}
+	return strings.TrimPrefix(webhookURL, "file://"), true
+}
+
+// appendLocalNotification appends a notification payload as one JSON line
+func appendLocalNotification(path string, payload []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create notification directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(payload, '\n')); err != nil {
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+	return nil
+}
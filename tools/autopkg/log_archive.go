@@ -0,0 +1,463 @@
+// log_archive.go
+package autopkg
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// DefaultLogDirName is the directory of archived recipe logs within the state directory
+const DefaultLogDirName = "logs"
+
+// DefaultLogRetention is how long the logs of a run are kept by default
+const DefaultLogRetention = 30 * 24 * time.Hour
+
+// Archived recipe log file extensions
+const (
+	RecipeLogExtension           = ".log"
+	CompressedRecipeLogExtension = ".log.gz"
+)
+
+// LogArchiveOptions configures the archive of full per-recipe autopkg output.
+// Each run gets a directory named after its run ID holding a log per recipe,
+// written while the recipe runs.
+type LogArchiveOptions struct {
+	Dir       string        // Directory of the run log directories, defaults to DefaultLogDir(StateDir)
+	Compress  bool          // Gzip a recipe's log once the recipe finished
+	Retention time.Duration // Remove the logs of runs older than this when a run starts, 0 keeps them
+	KeepRuns  int           // Keep the logs of at most this many runs, 0 keeps every run
+}
+
+// DefaultLogDir returns the log archive directory within a state directory
+func DefaultLogDir(stateDir string) string {
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+	return filepath.Join(stateDir, DefaultLogDirName)
+}
+
+// RecipeLogName returns the file name, without extension, a recipe's log is archived under
+func RecipeLogName(recipe string) string {
+	name := strings.TrimSuffix(filepath.Base(recipe), ".recipe")
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' || r == os.PathSeparator || r == ':' {
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+// logArchive writes the recipe logs of a running batch
+type logArchive struct {
+	dir      string // Directory of the run's logs
+	compress bool
+
+	mu    sync.Mutex
+	files map[string]*recipeLogFile
+}
+
+// recipeLogFile is a recipe log being written. Upload recipes fanned out to
+// several targets write to it at once, so writes are serialized.
+type recipeLogFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Write implements io.Writer
+func (f *recipeLogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// openLogArchive prunes the archive by its retention settings and creates
+// the log directory of a run
+func (o *RecipeBatchRunOptions) openLogArchive() (*logArchive, error) {
+	dir := o.LogArchive.Dir
+	if dir == "" {
+		dir = DefaultLogDir(o.StateDir)
+	}
+	if err := pruneLogArchive(dir, o.RunID, o.LogArchive.Retention, o.LogArchive.KeepRuns, o.LogArchive.Compress); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to prune log archive %s: %v", dir, err), logger.LogWarning)
+	}
+
+	runDir := filepath.Join(dir, o.RunID)
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	logger.Logger(fmt.Sprintf("🗄️ Archiving recipe logs to %s", runDir), logger.LogDebug)
+	return &logArchive{dir: runDir, compress: o.LogArchive.Compress, files: make(map[string]*recipeLogFile)}, nil
+}
+
+// writer returns the log a recipe's output is written to as it runs, or nil
+// without an archive. Retries append to the same log.
+func (a *logArchive) writer(recipe string) io.Writer {
+	if a == nil || recipe == "" {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if log, ok := a.files[recipe]; ok {
+		return log
+	}
+	path := filepath.Join(a.dir, RecipeLogName(recipe)+RecipeLogExtension)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to create log for %s: %v", recipe, err), logger.LogWarning)
+		return nil
+	}
+	log := &recipeLogFile{file: file}
+	a.files[recipe] = log
+	return log
+}
+
+// finish closes a finished recipe's log, compressing it if configured, and
+// records its path on the result. Recipes whose output wasn't streamed, such
+// as those of a list file run, get their output written now.
+func (a *logArchive) finish(recipe string, result *RecipeBatchResult) {
+	if a == nil || result == nil {
+		return
+	}
+	a.mu.Lock()
+	log, ok := a.files[recipe]
+	delete(a.files, recipe)
+	a.mu.Unlock()
+
+	path := filepath.Join(a.dir, RecipeLogName(recipe)+RecipeLogExtension)
+	switch {
+	case ok:
+		if err := log.file.Close(); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to close log for %s: %v", recipe, err), logger.LogWarning)
+		}
+	case result.LogPath == "" && result.Output != "":
+		if err := os.WriteFile(path, []byte(result.Output), 0644); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to write log for %s: %v", recipe, err), logger.LogWarning)
+			return
+		}
+	default:
+		return
+	}
+
+	result.LogPath = path
+	if a.compress {
+		compressed, err := compressLog(path)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to compress log for %s: %v", recipe, err), logger.LogWarning)
+			return
+		}
+		result.LogPath = compressed
+	}
+}
+
+// close finishes the logs of recipes that never reported finishing
+func (a *logArchive) close(results map[string]*RecipeBatchResult) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	recipes := make([]string, 0, len(a.files))
+	for recipe := range a.files {
+		recipes = append(recipes, recipe)
+	}
+	a.mu.Unlock()
+
+	for _, recipe := range recipes {
+		result := results[recipe]
+		if result == nil {
+			result = &RecipeBatchResult{Recipe: recipe}
+		}
+		a.finish(recipe, result)
+	}
+}
+
+// compressLog gzips a log next to itself and removes the original. The
+// package phase of a two-phase run appends to its download phase's
+// compressed log as another gzip member, which readers see as one stream.
+// The log is moved aside first, so a reader following it never sees its
+// output both compressed and not.
+func compressLog(path string) (string, error) {
+	compressing := path + ".compressing"
+	if err := os.Rename(path, compressing); err != nil {
+		return "", err
+	}
+	source, err := os.Open(compressing)
+	if err != nil {
+		os.Rename(compressing, path)
+		return "", err
+	}
+	defer source.Close()
+
+	compressedPath := strings.TrimSuffix(path, RecipeLogExtension) + CompressedRecipeLogExtension
+	target, err := os.OpenFile(compressedPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		os.Rename(compressing, path)
+		return "", err
+	}
+	info, err := target.Stat()
+	if err != nil {
+		target.Close()
+		os.Rename(compressing, path)
+		return "", err
+	}
+	// Drop a partly written member, keeping what earlier phases compressed
+	discard := func(err error) (string, error) {
+		target.Truncate(info.Size())
+		target.Close()
+		os.Rename(compressing, path)
+		return "", err
+	}
+
+	writer := gzip.NewWriter(target)
+	if _, err := io.Copy(writer, source); err != nil {
+		return discard(err)
+	}
+	if err := writer.Close(); err != nil {
+		return discard(err)
+	}
+	if err := target.Close(); err != nil {
+		return discard(err)
+	}
+	source.Close()
+	return compressedPath, os.Remove(compressing)
+}
+
+// liveRunLogWindow is how recently a run's logs must have been written for
+// the run to be taken as still running
+const liveRunLogWindow = time.Hour
+
+// pruneLogArchive removes the log directories of runs older than the
+// retention, then all but the newest keepRuns. The current run's directory,
+// e.g. from its download phase, is kept, as are those of runs still writing
+// their logs, such as concurrent runs of the server. With compression, a run
+// with a log not yet compressed hasn't finished and only expires.
+func pruneLogArchive(dir string, runID string, retention time.Duration, keepRuns int, compress bool) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	type runLogs struct {
+		path     string
+		modTime  time.Time
+		finished bool
+	}
+	var runs []runLogs
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == runID {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		modTime, writing := lastLogWrite(path, info.ModTime())
+		runs = append(runs, runLogs{path: path, modTime: modTime, finished: !compress || !writing})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].modTime.After(runs[j].modTime) })
+
+	removed := 0
+	for i, run := range runs {
+		if time.Since(run.modTime) < liveRunLogWindow {
+			continue
+		}
+		expired := retention > 0 && time.Since(run.modTime) > retention
+		// The run starting now gets a directory of its own, so keep one less
+		surplus := keepRuns > 0 && i >= keepRuns-1 && run.finished
+		if !expired && !surplus {
+			continue
+		}
+		if err := os.RemoveAll(run.path); err != nil {
+			return err
+		}
+		removed++
+	}
+	if removed > 0 {
+		logger.Logger(fmt.Sprintf("🧹 Removed the logs of %d old runs from %s", removed, dir), logger.LogInfo)
+	}
+	return nil
+}
+
+// lastLogWrite returns when a run's log directory or any log in it was last
+// modified, starting from the directory's own modification time, and
+// whether it holds an uncompressed log
+func lastLogWrite(runDir string, modTime time.Time) (time.Time, bool) {
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		return modTime, false
+	}
+	uncompressed := false
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), RecipeLogExtension) {
+			uncompressed = true
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, uncompressed
+}
+
+// notificationLogField returns the log line of a notification message, or
+// an empty string when the recipe has no archived log
+func notificationLogField(path string, lineBreak string) string {
+	if path == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s**%s:** %s", lineBreak, i18n.T("field.log"), path)
+}
+
+// ArchivedRun is a run with archived recipe logs
+type ArchivedRun struct {
+	RunID   string    `json:"run_id"`
+	Dir     string    `json:"dir"`
+	Recipes []string  `json:"recipes"` // Log names of the recipes, see RecipeLogName
+	ModTime time.Time `json:"modified"`
+}
+
+// RunLogDir returns the directory of a run's archived logs
+func RunLogDir(logDir string, runID string) string {
+	if logDir == "" {
+		logDir = DefaultLogDir("")
+	}
+	return filepath.Join(logDir, runID)
+}
+
+// ListArchivedRuns returns the runs with archived logs, newest first
+func ListArchivedRuns(logDir string) ([]*ArchivedRun, error) {
+	if logDir == "" {
+		logDir = DefaultLogDir("")
+	}
+	entries, err := os.ReadDir(logDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log archive: %w", err)
+	}
+
+	var runs []*ArchivedRun
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(logDir, entry.Name())
+		recipes, err := RecipeLogNames(dir)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, &ArchivedRun{RunID: entry.Name(), Dir: dir, Recipes: recipes, ModTime: info.ModTime()})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].RunID > runs[j].RunID })
+	return runs, nil
+}
+
+// RecipeLogNames returns the names of the recipe logs in a run's log
+// directory, compressed or still being written
+func RecipeLogNames(runDir string) ([]string, error) {
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case entry.IsDir():
+			continue
+		case strings.HasSuffix(name, CompressedRecipeLogExtension):
+			name = strings.TrimSuffix(name, CompressedRecipeLogExtension)
+		case strings.HasSuffix(name, RecipeLogExtension):
+			name = strings.TrimSuffix(name, RecipeLogExtension)
+		default:
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// OpenRecipeLog opens a recipe's archived log in a run's log directory,
+// reading its compressed part, from an earlier phase or a finished recipe,
+// before the part still being written. It returns an os.ErrNotExist error
+// when the recipe has no log.
+func OpenRecipeLog(runDir string, name string) (io.ReadCloser, error) {
+	base := filepath.Join(runDir, name)
+	var readers []io.Reader
+	var closers []io.Closer
+	closeAll := func() error {
+		var firstErr error
+		for _, closer := range closers {
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+
+	compressed, err := os.Open(base + CompressedRecipeLogExtension)
+	switch {
+	case err == nil:
+		closers = append(closers, compressed)
+		gzipReader, err := gzip.NewReader(compressed)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to read compressed log %s: %w", compressed.Name(), err)
+		}
+		readers = append(readers, gzipReader)
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	plain, err := os.Open(base + RecipeLogExtension)
+	switch {
+	case err == nil:
+		closers = append(closers, plain)
+		readers = append(readers, plain)
+	case !os.IsNotExist(err):
+		closeAll()
+		return nil, err
+	}
+
+	if len(readers) == 0 {
+		return nil, fmt.Errorf("no log for %s: %w", name, os.ErrNotExist)
+	}
+	return &recipeLogReader{Reader: io.MultiReader(readers...), close: closeAll}, nil
+}
+
+// recipeLogReader reads the parts of an archived recipe log as one
+type recipeLogReader struct {
+	io.Reader
+	close func() error
+}
+
+// Close implements io.Closer
+func (r *recipeLogReader) Close() error {
+	return r.close()
+}
@@ -0,0 +1,179 @@
+// manifest.go
+package autopkg
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+const (
+	manifestJSONName = "manifest.json"
+	manifestSumsName = "SHA256SUMS"
+)
+
+// ArtifactManifest lists every artifact produced by a batch run with its checksum
+type ArtifactManifest struct {
+	RunID       string          `json:"run_id"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Artifacts   []ManifestEntry `json:"artifacts"`
+}
+
+// ManifestEntry describes a single produced artifact
+type ManifestEntry struct {
+	Recipe    string `json:"recipe"`
+	App       string `json:"app"`
+	Version   string `json:"version,omitempty"`
+	FileName  string `json:"file_name"`
+	Path      string `json:"path"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+// BuildArtifactManifest hashes every artifact recorded in the batch results
+func BuildArtifactManifest(runID string, results map[string]*RecipeBatchResult) (*ArtifactManifest, error) {
+	manifest := &ArtifactManifest{
+		RunID:       runID,
+		GeneratedAt: time.Now().UTC(),
+		Artifacts:   []ManifestEntry{},
+	}
+
+	seen := make(map[string]bool)
+	for _, result := range results {
+		for _, artifact := range result.Artifacts {
+			if seen[artifact.Path] {
+				continue
+			}
+			seen[artifact.Path] = true
+
+			checksum, size, err := fileSHA256(artifact.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			manifest.Artifacts = append(manifest.Artifacts, ManifestEntry{
+				Recipe:    artifact.Recipe,
+				App:       artifact.App,
+				Version:   artifact.Version,
+				FileName:  filepath.Base(artifact.Path),
+				Path:      artifact.Path,
+				SizeBytes: size,
+				SHA256:    checksum,
+			})
+		}
+	}
+
+	sort.Slice(manifest.Artifacts, func(i, j int) bool {
+		return manifest.Artifacts[i].FileName < manifest.Artifacts[j].FileName
+	})
+
+	return manifest, nil
+}
+
+// WriteArtifactManifest writes manifest.json and SHA256SUMS to a directory. When
+// a signing key is given, detached base64 ed25519 signatures are written next
+// to each file as <name>.sig. Returns the written file paths.
+func WriteArtifactManifest(outputDir string, manifest *ArtifactManifest, signingKeyPath string) ([]string, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	jsonData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	// SHA256SUMS uses the format understood by `shasum -a 256 -c`
+	var sums strings.Builder
+	for _, entry := range manifest.Artifacts {
+		sums.WriteString(fmt.Sprintf("%s  %s\n", entry.SHA256, entry.FileName))
+	}
+
+	files := map[string][]byte{
+		manifestJSONName: append(jsonData, '\n'),
+		manifestSumsName: []byte(sums.String()),
+	}
+
+	var signingKey ed25519.PrivateKey
+	if signingKeyPath != "" {
+		if signingKey, err = loadManifestSigningKey(signingKeyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var written []string
+	for _, name := range []string{manifestJSONName, manifestSumsName} {
+		path := filepath.Join(outputDir, name)
+		if err := os.WriteFile(path, files[name], 0644); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		written = append(written, path)
+
+		if signingKey != nil {
+			signature := base64.StdEncoding.EncodeToString(ed25519.Sign(signingKey, files[name]))
+			if err := os.WriteFile(path+".sig", []byte(signature+"\n"), 0644); err != nil {
+				return written, fmt.Errorf("failed to write signature for %s: %w", name, err)
+			}
+			written = append(written, path+".sig")
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("🧾 Wrote checksum manifest for %d artifacts to %s", len(manifest.Artifacts), outputDir), logger.LogSuccess)
+	return written, nil
+}
+
+// loadManifestSigningKey reads a PKCS#8 PEM encoded ed25519 private key, as
+// generated by `openssl genpkey -algorithm ed25519`
+func loadManifestSigningKey(keyPath string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key must be an ed25519 private key")
+	}
+
+	return signingKey, nil
+}
+
+// fileSHA256 returns the hex SHA256 checksum and size of a file
+func fileSHA256(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
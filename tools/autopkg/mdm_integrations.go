@@ -0,0 +1,86 @@
+// mdm_integrations.go
+package autopkg
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Preference keys read by the Kandji uploader in .kandji recipes
+const (
+	KandjiAPIURLKey = "KANDJI_API_URL"
+	KandjiTokenKey  = "KANDJI_TOKEN"
+)
+
+// builtinIntegrations returns the MDM integrations shipped with the factory
+func builtinIntegrations() map[string]MDMIntegration {
+	builtin := []MDMIntegration{
+		&prefsIntegration{
+			name:        "jamf",
+			displayName: "Jamf Pro",
+			summaryKey:  "jamfpackageuploader_summary_result",
+			enableKeys:  []string{"JSS_URL", "JAMFPRO_URL"},
+			required:    []string{"JSS_URL|JAMFPRO_URL", "API_USERNAME|CLIENT_ID|JAMFPRO_CLIENT_ID", "API_PASSWORD|CLIENT_SECRET|JAMFPRO_CLIENT_SECRET"},
+			urlKeys:     []string{"JSS_URL", "JAMFPRO_URL"},
+			tenantKeys:  []string{"JSS_URL", "JAMFPRO_URL"},
+		},
+		&prefsIntegration{
+			name:        "intune",
+			displayName: "Microsoft Intune",
+			summaryKey:  "intuneappuploader_summary_result",
+			enableKeys:  []string{"INTUNE_TENANT_ID", "TENANT_ID"},
+			required:    []string{"INTUNE_TENANT_ID|TENANT_ID", "INTUNE_CLIENT_ID|CLIENT_ID", "INTUNE_CLIENT_SECRET|CLIENT_SECRET"},
+			tenantKeys:  []string{"INTUNE_TENANT_ID", "TENANT_ID"},
+		},
+		&prefsIntegration{
+			name:        "ws1",
+			displayName: "Workspace ONE UEM",
+			summaryKey:  "ws1_importer_summary_result",
+			enableKeys:  []string{WS1APIURLKey},
+			required:    []string{WS1APIURLKey, WS1OAuthClientIDKey, WS1OAuthClientSecretKey, WS1GroupIDKey},
+			urlKeys:     []string{WS1APIURLKey, WS1ConsoleURLKey, WS1OAuthTokenURLKey},
+			tenant:      workspaceOneTenant,
+			validate: func(prefs map[string]interface{}) []error {
+				if groupID := prefString(prefs, WS1GroupIDKey); groupID != "" {
+					if _, err := strconv.Atoi(groupID); err != nil {
+						return []error{fmt.Errorf("%s must be numeric, got %q", WS1GroupIDKey, groupID)}
+					}
+				}
+				return nil
+			},
+		},
+		&prefsIntegration{
+			name:        "kandji",
+			displayName: "Kandji",
+			summaryKey:  "kandji_uploader_summary_result",
+			enableKeys:  []string{KandjiAPIURLKey},
+			required:    []string{KandjiAPIURLKey, KandjiTokenKey},
+			urlKeys:     []string{KandjiAPIURLKey},
+			tenantKeys:  []string{KandjiAPIURLKey},
+		},
+	}
+
+	integrations := make(map[string]MDMIntegration, len(builtin))
+	for _, integration := range builtin {
+		integrations[integration.Name()] = integration
+	}
+	return integrations
+}
+
+// workspaceOneTenant names a Workspace ONE tenant by API host and organization
+// group, since one UEM server hosts many groups
+func workspaceOneTenant(prefs map[string]interface{}) string {
+	apiURL := prefString(prefs, WS1APIURLKey)
+	if apiURL == "" {
+		return ""
+	}
+	host := apiURL
+	if parsed, err := url.Parse(apiURL); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+	if groupID := prefString(prefs, WS1GroupIDKey); groupID != "" {
+		return "ws1:" + host + "/" + groupID
+	}
+	return "ws1:" + host
+}
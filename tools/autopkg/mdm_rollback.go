@@ -0,0 +1,293 @@
+// mdm_rollback.go
+package autopkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jamfPolicyPackage is a package of a Jamf Pro policy, as read from and
+// written to the classic API
+type jamfPolicyPackage struct {
+	ID     int    `json:"id" xml:"id"`
+	Name   string `json:"name" xml:"name"`
+	Action string `json:"action" xml:"action"`
+}
+
+// jamfPolicyPackages is the classic API policy update replacing its packages
+type jamfPolicyPackages struct {
+	XMLName  xml.Name            `xml:"policy"`
+	Packages []jamfPolicyPackage `xml:"package_configuration>packages>package"`
+}
+
+// rollbackJamf points the Jamf Pro policy JamfPolicyUploader deployed the
+// current package with at the package of the version rolled back to, which
+// JamfPackageUploader left on the server
+func rollbackJamf(prefs map[string]interface{}, plan *RollbackPlan, dryRun bool) (string, error) {
+	if plan.To.Package == "" {
+		return "", fmt.Errorf("no package recorded for %s %s, it was uploaded before packages were recorded", plan.App, plan.To.Version)
+	}
+	policyName := plan.From.Policy
+	if policyName == "" {
+		policyName = plan.To.Policy
+	}
+	if policyName == "" {
+		return "", fmt.Errorf("no policy recorded for %s, only policies updated by JamfPolicyUploader can be rolled back", plan.App)
+	}
+
+	creds, err := newJamfCredentials(prefs)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	authorize, err := creds.authorize(client)
+	if err != nil {
+		return "", err
+	}
+
+	var pkg struct {
+		Package jamfPolicyPackage `json:"package"`
+	}
+	if err := creds.classicGet(client, authorize, "packages/name/"+url.PathEscape(plan.To.Package), &pkg); err != nil {
+		return "", fmt.Errorf("package %s: %w", plan.To.Package, err)
+	}
+
+	var policy struct {
+		Policy struct {
+			General struct {
+				ID int `json:"id"`
+			} `json:"general"`
+			PackageConfiguration struct {
+				Packages []jamfPolicyPackage `json:"packages"`
+			} `json:"package_configuration"`
+		} `json:"policy"`
+	}
+	if err := creds.classicGet(client, authorize, "policies/name/"+url.PathEscape(policyName), &policy); err != nil {
+		return "", fmt.Errorf("policy %s: %w", policyName, err)
+	}
+
+	// Swap the current package for the earlier one, keeping any other packages
+	// of the policy and the action it installs with
+	packages := policy.Policy.PackageConfiguration.Packages
+	var deployed []string
+	swapped := false
+	for i, current := range packages {
+		deployed = append(deployed, current.Name)
+		if current.Name == plan.From.Package || (len(packages) == 1 && !swapped) {
+			packages[i] = jamfPolicyPackage{ID: pkg.Package.ID, Name: pkg.Package.Name, Action: current.Action}
+			swapped = true
+		}
+	}
+	if !swapped {
+		return strings.Join(deployed, ", "), fmt.Errorf("policy %s doesn't install %s", policyName, plan.From.Package)
+	}
+	if dryRun {
+		return strings.Join(deployed, ", "), nil
+	}
+
+	payload, err := xml.Marshal(jamfPolicyPackages{Packages: packages})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal policy %s: %w", policyName, err)
+	}
+	endpoint := fmt.Sprintf("%s/JSSResource/policies/id/%d", creds.server, policy.Policy.General.ID)
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Jamf Pro request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to Jamf Pro %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Jamf Pro %s returned status %d updating policy %s", creds.server, resp.StatusCode, policyName)
+	}
+	return strings.Join(deployed, ", "), nil
+}
+
+// authorize signs in to Jamf Pro the way CheckJamfCredentials does, returning
+// a function that authorizes requests with the token, or with basic auth on
+// servers without the token endpoint
+func (c *jamfCredentials) authorize(client *http.Client) (func(*http.Request), error) {
+	var token string
+	var err error
+	if c.clientID != "" {
+		token, _, err = c.clientToken(client)
+	} else {
+		token, _, err = c.userToken(client)
+		if err == errJamfTokenUnsupported {
+			return func(req *http.Request) { req.SetBasicAuth(c.username, c.password) }, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }, nil
+}
+
+// classicGet reads a classic API resource, e.g. "policies/name/Firefox"
+func (c *jamfCredentials) classicGet(client *http.Client, authorize func(*http.Request), resource string, body interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.server+"/JSSResource/"+resource, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Jamf Pro request: %w", err)
+	}
+	authorize(req)
+
+	status, err := jamfDo(client, req, body)
+	switch {
+	case err != nil:
+		return err
+	case status == http.StatusNotFound:
+		return fmt.Errorf("not found on Jamf Pro %s", c.server)
+	case status != http.StatusOK:
+		return fmt.Errorf("Jamf Pro %s returned status %d", c.server, status)
+	}
+	return nil
+}
+
+// intuneApp is the part of an Intune macOS app a rollback reads
+type intuneApp struct {
+	ID                      string `json:"id"`
+	Type                    string `json:"@odata.type"`
+	DisplayName             string `json:"displayName"`
+	CommittedContentVersion string `json:"committedContentVersion"`
+}
+
+// rollbackIntune commits the content version of the Intune app that
+// IntuneAppUploader uploaded the version rolled back to as. Content versions
+// aren't labelled with the app version, so the version is found by counting
+// back one content version per version deployed since.
+func rollbackIntune(prefs map[string]interface{}, plan *RollbackPlan, dryRun bool) (string, error) {
+	check := &IntuneCredentialCheck{
+		TenantID: firstPrefString(prefs, "INTUNE_TENANT_ID", "TENANT_ID"),
+		ClientID: firstPrefString(prefs, "INTUNE_CLIENT_ID", "CLIENT_ID"),
+	}
+	secret := firstPrefString(prefs, "INTUNE_CLIENT_SECRET", "CLIENT_SECRET")
+	if check.TenantID == "" || check.ClientID == "" || secret == "" {
+		return "", fmt.Errorf("no Intune credentials, set TENANT_ID, CLIENT_ID and CLIENT_SECRET of an app registration")
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	token, err := check.graphToken(client, secret)
+	if err != nil {
+		return "", err
+	}
+
+	name := plan.From.Package
+	if name == "" {
+		name = plan.App
+	}
+	var apps struct {
+		Value []intuneApp `json:"value"`
+	}
+	filter := url.QueryEscape(fmt.Sprintf("displayName eq '%s'", strings.ReplaceAll(name, "'", "''")))
+	if err := graphDo(client, http.MethodGet, "/beta/deviceAppManagement/mobileApps?$filter="+filter, token, nil, &apps); err != nil {
+		return "", err
+	}
+	var app *intuneApp
+	for i := range apps.Value {
+		if strings.Contains(apps.Value[i].Type, "macOS") {
+			app = &apps.Value[i]
+			break
+		}
+	}
+	if app == nil {
+		return "", fmt.Errorf("no macOS app named %s in Intune", name)
+	}
+
+	var contentVersions struct {
+		Value []struct {
+			ID string `json:"id"`
+		} `json:"value"`
+	}
+	path := fmt.Sprintf("/beta/deviceAppManagement/mobileApps/%s/%s/contentVersions", app.ID, strings.TrimPrefix(app.Type, "#"))
+	if err := graphDo(client, http.MethodGet, path, token, nil, &contentVersions); err != nil {
+		return "", err
+	}
+	var ids []int
+	for _, version := range contentVersions.Value {
+		if id, err := strconv.Atoi(version.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	deployed := "content version " + app.CommittedContentVersion
+
+	committed, err := strconv.Atoi(app.CommittedContentVersion)
+	if err != nil {
+		return deployed, fmt.Errorf("app %s has no committed content version", name)
+	}
+	versions := map[string]bool{}
+	for _, receipt := range append(plan.skipped, plan.From) {
+		versions[receipt.Version] = true
+	}
+	index := sort.SearchInts(ids, committed) - len(versions)
+	if index < 0 || index >= len(ids) {
+		return deployed, fmt.Errorf("app %s has no content version left for %s", name, plan.To.Version)
+	}
+	if dryRun {
+		return deployed, nil
+	}
+
+	patch := map[string]interface{}{
+		"@odata.type":             app.Type,
+		"committedContentVersion": strconv.Itoa(ids[index]),
+	}
+	if err := graphDo(client, http.MethodPatch, "/beta/deviceAppManagement/mobileApps/"+app.ID, token, patch, nil); err != nil {
+		return deployed, err
+	}
+	return deployed, nil
+}
+
+// graphDo sends a Microsoft Graph request with a JSON payload, decoding the
+// response into body when given
+func graphDo(client *http.Client, method, path, token string, payload interface{}, body interface{}) error {
+	var reader io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Graph request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, IntuneGraphURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create Graph request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("Graph returned status %d for %s %s", resp.StatusCode, method, req.URL.Path)
+	}
+	if body == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+		return fmt.Errorf("failed to parse Graph response from %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
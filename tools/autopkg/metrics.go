@@ -0,0 +1,117 @@
+// metrics.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// runMetric is a gauge in the Prometheus metrics of a run
+type runMetric struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample is a single labelled value of a metric
+type metricSample struct {
+	labels string
+	value  float64
+}
+
+// WriteRunMetrics writes the metrics of a batch in the Prometheus text format,
+// for node_exporter's textfile collector or a push to a Pushgateway. The file
+// is replaced in one rename, so a scrape never reads it half written.
+func WriteRunMetrics(path string, runID string, results map[string]*RecipeBatchResult, startTime time.Time) error {
+	summary := NewRecipeBatchSummary(results, startTime)
+
+	recipes := make([]string, 0, len(results))
+	for recipe := range results {
+		recipes = append(recipes, recipe)
+	}
+	sort.Strings(recipes)
+
+	statuses := []metricSample{}
+	for _, status := range []struct {
+		name  string
+		count int
+	}{
+		{"updated", summary.UpdatedCount},
+		{"unchanged", summary.UnchangedCount},
+		{"skipped", summary.SkippedCount},
+		{StatusBlocked, summary.BlockedCount},
+		{"failed", summary.FailedCount},
+	} {
+		statuses = append(statuses, metricSample{fmt.Sprintf(`status="%s"`, status.name), float64(status.count)})
+	}
+
+	var durations, downloaded, cacheGrowth, peakDisk []metricSample
+	for _, recipe := range recipes {
+		result := results[recipe]
+		labels := fmt.Sprintf(`recipe="%s"`, escapeMetricLabel(recipe))
+		durations = append(durations, metricSample{labels, result.ExecutionTime.Seconds()})
+		if result.Usage == nil {
+			continue
+		}
+		downloaded = append(downloaded, metricSample{labels, float64(result.Usage.DownloadedBytes)})
+		cacheGrowth = append(cacheGrowth, metricSample{labels, float64(result.Usage.CacheGrowthBytes)})
+		peakDisk = append(peakDisk, metricSample{labels, float64(result.Usage.PeakDiskBytes)})
+	}
+
+	// The run ID is only on the info metric, so every run updates the same series
+	metrics := []runMetric{
+		{"autopkgctl_run_info", "Run the metrics are from", []metricSample{{fmt.Sprintf(`run_id="%s"`, escapeMetricLabel(runID)), 1}}},
+		{"autopkgctl_run_timestamp_seconds", "Time the run finished", []metricSample{{"", float64(time.Now().Unix())}}},
+		{"autopkgctl_run_duration_seconds", "Duration of the run", []metricSample{{"", summary.TotalDuration.Seconds()}}},
+		{"autopkgctl_run_recipes", "Recipes in the run by status", statuses},
+		{"autopkgctl_run_downloaded_bytes", "Bytes downloaded by the run", []metricSample{{"", float64(summary.DownloadedBytes)}}},
+		{"autopkgctl_run_cache_growth_bytes", "Net change in size of the AutoPkg cache", []metricSample{{"", float64(summary.CacheGrowthBytes)}}},
+		{"autopkgctl_run_peak_disk_bytes", "Most disk space used by a single recipe", []metricSample{{"", float64(summary.PeakDiskBytes)}}},
+		{"autopkgctl_recipe_duration_seconds", "Duration of each recipe", durations},
+		{"autopkgctl_recipe_downloaded_bytes", "Bytes downloaded by each recipe", downloaded},
+		{"autopkgctl_recipe_cache_growth_bytes", "Change in size of the AutoPkg cache by each recipe", cacheGrowth},
+		{"autopkgctl_recipe_peak_disk_bytes", "Most disk space used by each recipe", peakDisk},
+	}
+
+	var out strings.Builder
+	for _, metric := range metrics {
+		if len(metric.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s gauge\n", metric.name, metric.help, metric.name)
+		for _, sample := range metric.samples {
+			if sample.labels == "" {
+				fmt.Fprintf(&out, "%s %s\n", metric.name, strconv.FormatFloat(sample.value, 'f', -1, 64))
+				continue
+			}
+			fmt.Fprintf(&out, "%s{%s} %s\n", metric.name, sample.labels, strconv.FormatFloat(sample.value, 'f', -1, 64))
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create metrics directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(out.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("📈 Run metrics written to %s", path), logger.LogInfo)
+	return nil
+}
+
+// escapeMetricLabel escapes a Prometheus label value
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
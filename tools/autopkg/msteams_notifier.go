@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
 )
 
 // MSTeamsNotifier is responsible for sending notifications to Microsoft Teams.
@@ -128,6 +130,10 @@ func (n *MSTeamsNotifier) NotifyMSTeams(title, message string, error, imported b
 		return fmt.Errorf("failed to marshal Teams message: %w", err)
 	}
 
+	if path, ok := localNotificationPath(n.WebhookURL); ok {
+		return appendLocalNotification(path, jsonData)
+	}
+
 	// Send HTTP POST request
 	resp, err := http.Post(n.WebhookURL, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
@@ -159,9 +165,9 @@ func (n *MSTeamsNotifier) NotifyTeams(recipe *RecipeLifecycle, opts *RecipeBatch
 	}
 
 	if recipe.Verified != nil && !*recipe.Verified {
-		n.NotifyMSTeams(fmt.Sprintf("❌ %s failed trust verification", recipe.Name), "Update trust verification manually", true, false, "", jamfPkgID)
+		n.NotifyMSTeams(i18n.T("notify.trust_failed.title", recipe.Name), i18n.T("notify.trust_failed.message")+notificationLogField(recipe.LogPath, "\r\n\r\n"), true, false, "", jamfPkgID)
 	} else if recipe.Error {
-		message := "Unknown error"
+		message := i18n.T("notify.unknown_error")
 		if failed, ok := recipe.Results["failed"].([]interface{}); ok && len(failed) > 0 {
 			if first, ok := failed[0].(map[string]interface{}); ok {
 				if msg, exists := first["message"].(string); exists {
@@ -169,23 +175,25 @@ func (n *MSTeamsNotifier) NotifyTeams(recipe *RecipeLifecycle, opts *RecipeBatch
 				}
 			}
 		}
-		n.NotifyMSTeams(fmt.Sprintf("❌ %s failed", recipe.Name), message, true, false, "", jamfPkgID)
+		message += notificationLogField(recipe.LogPath, "\r\n\r\n")
+		n.NotifyMSTeams(i18n.T("notify.failed.title", recipe.Name), message, true, false, "", jamfPkgID)
 	}
 
 	if recipe.Updated {
-		title := fmt.Sprintf("✅ Imported %s %s", recipe.Name, recipe.UpdatedVersion)
-		message := fmt.Sprintf("**Name:** %s\r\n\r\n", recipe.Name)
+		title := i18n.T("notify.imported.title", recipe.Name, recipe.UpdatedVersion)
+		message := fmt.Sprintf("**%s:** %s\r\n\r\n", i18n.T("field.name"), recipe.Name)
 
 		// Include Intune App ID if available
 		if appID != "" {
-			message += fmt.Sprintf("**Intune App ID:** %s\r\n\r\n", appID)
+			message += fmt.Sprintf("**%s:** %s\r\n\r\n", i18n.T("field.intune_app_id"), appID)
 		}
 
 		// Include Jamf Package ID if available
 		if jamfPkgID != "" {
-			message += fmt.Sprintf("**Jamf Package ID:** %s\r\n\r\n", jamfPkgID)
+			message += fmt.Sprintf("**%s:** %s\r\n\r\n", i18n.T("field.jamf_package_id"), jamfPkgID)
 		}
 
+		message += notificationLogField(recipe.LogPath, "")
 		n.NotifyMSTeams(title, message, false, true, appID, jamfPkgID)
 	}
 }
@@ -193,12 +201,12 @@ func (n *MSTeamsNotifier) NotifyTeams(recipe *RecipeLifecycle, opts *RecipeBatch
 // ErrorAlerts sends error-related packaging alerts to ms teams.
 func (n *MSTeamsNotifier) ErrorAlerts(recipe *RecipeLifecycle) {
 	if recipe.Verified != nil && !*recipe.Verified {
-		title := fmt.Sprintf("❌ %s failed trust verification", recipe.Name)
-		message := "Update trust verification manually"
+		title := i18n.T("notify.trust_failed.title", recipe.Name)
+		message := i18n.T("notify.trust_failed.message")
 		n.NotifyMSTeams(title, message, true, false, "", "")
 	} else if recipe.Error {
-		title := fmt.Sprintf("❌ %s failed", recipe.Name)
-		message := "Unknown error"
+		title := i18n.T("notify.failed.title", recipe.Name)
+		message := i18n.T("notify.unknown_error")
 		if failed, ok := recipe.Results["failed"].([]interface{}); ok && len(failed) > 0 {
 			if first, ok := failed[0].(map[string]interface{}); ok {
 				if msg, exists := first["message"].(string); exists {
@@ -213,7 +221,7 @@ func (n *MSTeamsNotifier) ErrorAlerts(recipe *RecipeLifecycle) {
 // UpdatedAlerts sends mdm service package update-related alerts to ms teams.
 func (n *MSTeamsNotifier) UpdatedAlerts(recipe *RecipeLifecycle) {
 	if recipe.Updated {
-		title := fmt.Sprintf("✅ Imported %s %s", recipe.Name, recipe.UpdatedVersion)
+		title := i18n.T("notify.imported.title", recipe.Name, recipe.UpdatedVersion)
 		var message, appID, jamfPkgID string
 
 		// Extract Intune App ID and Content Version if available
@@ -224,8 +232,10 @@ func (n *MSTeamsNotifier) UpdatedAlerts(recipe *RecipeLifecycle) {
 				recipeName, _ := first["name"].(string)
 
 				message = fmt.Sprintf(
-					"**Name:** %s\r\n\r\n**Intune App ID:** %s\r\n\r\n**Content Version ID:** %s\r\n\r\n",
-					recipeName, appID, contentVersion,
+					"**%s:** %s\r\n\r\n**%s:** %s\r\n\r\n**%s:** %s\r\n\r\n",
+					i18n.T("field.name"), recipeName,
+					i18n.T("field.intune_app_id"), appID,
+					i18n.T("field.content_version_id"), contentVersion,
 				)
 			}
 		}
@@ -234,7 +244,7 @@ func (n *MSTeamsNotifier) UpdatedAlerts(recipe *RecipeLifecycle) {
 		if pkgInfo, ok := recipe.Results["jamf"].(map[string]interface{}); ok {
 			if pkgID, exists := pkgInfo["package_id"].(string); exists {
 				jamfPkgID = pkgID
-				message += fmt.Sprintf("**Jamf Package ID:** %s\r\n\r\n", jamfPkgID)
+				message += fmt.Sprintf("**%s:** %s\r\n\r\n", i18n.T("field.jamf_package_id"), jamfPkgID)
 			}
 		}
 
@@ -245,7 +255,7 @@ func (n *MSTeamsNotifier) UpdatedAlerts(recipe *RecipeLifecycle) {
 // RemovedAlerts sends mdm service cleanup-related alerts to ms teams.
 func (n *MSTeamsNotifier) RemovedAlerts(recipe *RecipeLifecycle, opts *RecipeBatchRunOptions) {
 	if opts != nil && opts.Notification.EnableTeams && recipe.Removed {
-		title := fmt.Sprintf("🗑 Removed old versions of %s", recipe.Name)
+		title := i18n.T("notify.removed.title", recipe.Name)
 		var message, jamfPkgID string
 
 		// Extract removal details
@@ -255,8 +265,10 @@ func (n *MSTeamsNotifier) RemovedAlerts(recipe *RecipeLifecycle, opts *RecipeBat
 				removedVersions := first["removed versions"]
 				keepCount := first["keep count"]
 				message = fmt.Sprintf(
-					"**Remove Count:** %v\r\n\r\n**Removed Versions:** %v\r\n\r\n**Keep Count:** %v\r\n\r\n",
-					removedCount, removedVersions, keepCount,
+					"**%s:** %v\r\n\r\n**%s:** %v\r\n\r\n**%s:** %v\r\n\r\n",
+					i18n.T("field.remove_count"), removedCount,
+					i18n.T("field.removed_versions"), removedVersions,
+					i18n.T("field.keep_count"), keepCount,
 				)
 			}
 		}
@@ -265,7 +277,7 @@ func (n *MSTeamsNotifier) RemovedAlerts(recipe *RecipeLifecycle, opts *RecipeBat
 		if pkgInfo, ok := recipe.Results["jamf"].(map[string]interface{}); ok {
 			if pkgID, exists := pkgInfo["package_id"].(string); exists {
 				jamfPkgID = pkgID
-				message += fmt.Sprintf("**Jamf Package ID:** %s\r\n\r\n", jamfPkgID)
+				message += fmt.Sprintf("**%s:** %s\r\n\r\n", i18n.T("field.jamf_package_id"), jamfPkgID)
 			}
 		}
 
@@ -276,15 +288,16 @@ func (n *MSTeamsNotifier) RemovedAlerts(recipe *RecipeLifecycle, opts *RecipeBat
 // PromotedAlerts sends promotion-related alerts to ms teams.
 func (n *MSTeamsNotifier) PromotedAlerts(recipe *RecipeLifecycle, opts *RecipeBatchRunOptions) {
 	if opts != nil && opts.Notification.EnableTeams && recipe.Promoted {
-		title := fmt.Sprintf("🚀 Promoted %s", recipe.Name)
+		title := i18n.T("notify.promoted.title", recipe.Name)
 		var message string
 		if promoted, ok := recipe.Results["promoted"].([]interface{}); ok && len(promoted) > 0 {
 			if first, ok := promoted[0].(map[string]interface{}); ok {
 				promotions := first["promotions"]
 				blacklistedVersions := first["blacklisted versions"]
 				message = fmt.Sprintf(
-					"**Promotions:** %v\r\n\r\n**Blacklisted Versions:** %v",
-					promotions, blacklistedVersions,
+					"**%s:** %v\r\n\r\n**%s:** %v",
+					i18n.T("field.promotions"), promotions,
+					i18n.T("field.blacklisted_versions"), blacklistedVersions,
 				)
 			}
 		}
@@ -0,0 +1,73 @@
+// munki_imports.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/munki"
+	"howett.net/plist"
+)
+
+// munkiImporterSummaryKey is the report summary of items MunkiImporter added to the repo
+const munkiImporterSummaryKey = "munki_importer_summary_result"
+
+// CollectMunkiImports returns the items a recipe imported into a Munki repo,
+// as listed in an AutoPkg report plist
+func CollectMunkiImports(reportPath string, recipe string) ([]munki.Import, error) {
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report file: %w", err)
+	}
+	var reportData map[string]interface{}
+	if _, err := plist.Unmarshal(data, &reportData); err != nil {
+		return nil, fmt.Errorf("failed to decode report plist: %w", err)
+	}
+
+	summaryResults, _ := reportData["summary_results"].(map[string]interface{})
+	var imports []munki.Import
+	for _, row := range reportDataRows(summaryResults[munkiImporterSummaryKey]) {
+		item := munki.Import{Recipe: recipe}
+		item.Name, _ = row["name"].(string)
+		item.Version, _ = row["version"].(string)
+		item.PkginfoPath, _ = row["pkginfo_path"].(string)
+		item.PkgPath, _ = row["pkg_repo_path"].(string)
+
+		// MunkiImporter joins the catalogs with commas
+		switch catalogs := row["catalogs"].(type) {
+		case string:
+			for _, catalog := range strings.Split(catalogs, ",") {
+				if catalog = strings.TrimSpace(catalog); catalog != "" {
+					item.Catalogs = append(item.Catalogs, catalog)
+				}
+			}
+		case []interface{}:
+			for _, catalog := range catalogs {
+				if name, ok := catalog.(string); ok {
+					item.Catalogs = append(item.Catalogs, name)
+				}
+			}
+		}
+
+		if item.Name != "" && item.PkginfoPath != "" {
+			imports = append(imports, item)
+		}
+	}
+	return imports, nil
+}
+
+// collectRunMunkiImports returns the Munki imports listed in the latest report for a recipe
+func collectRunMunkiImports(options *RecipeBatchRunOptions, recipe string) []munki.Import {
+	if options.ReportPlist == "" {
+		return nil
+	}
+
+	imports, err := CollectMunkiImports(options.ReportPlist, recipe)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to read Munki imports from report: %v", err), logger.LogWarning)
+		return nil
+	}
+	return imports
+}
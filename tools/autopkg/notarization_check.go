@@ -0,0 +1,71 @@
+// notarization_check.go
+package autopkg
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+)
+
+// checkRunNotarization checks the notarization of the pkgs, dmgs and apps a
+// recipe produced and records it on the result. With RequireNotarization set,
+// recipes that upload to an MDM fail unless their software is notarized:
+// the apps found in the cache when there are any, since vendors often ship
+// notarized apps in unsigned dmgs and AutoPkg builds unsigned pkgs around
+// them, or else the packages and disk images themselves. Software that
+// couldn't be checked, e.g. on a runner that isn't a Mac, fails it too.
+// Upload recipes are checked on their package parent's build before they
+// upload, see gateUpload; this check after the run can only fail a recipe
+// that has already uploaded.
+func checkRunNotarization(result *RecipeBatchResult, options *RecipeBatchRunOptions) {
+	if result.Status == "failed" || result.Status == "skipped" || result.Status == StatusBlocked {
+		return
+	}
+
+	var apps, others []string // Artifacts that aren't notarized or couldn't be checked
+	hasApps := false
+	for _, artifact := range DiscoverArtifacts(result) {
+		if notarization.ArtifactType(artifact.Path) == "" {
+			continue
+		}
+		hasApps = hasApps || artifact.Type == "app"
+
+		notarized := false
+		checked, err := notarization.Check(artifact.Path, &notarization.Options{Staple: options.StapleNotarization})
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to check notarization for %s: %v", result.Recipe, err), logger.LogWarning)
+		} else {
+			result.Notarization = append(result.Notarization, *checked)
+			notarized = checked.Notarized
+		}
+
+		if !notarized && artifact.Type == "app" {
+			apps = append(apps, filepath.Base(artifact.Path))
+		} else if !notarized {
+			others = append(others, filepath.Base(artifact.Path))
+		}
+		if errors.Is(err, notarization.ErrUnsupported) {
+			break
+		}
+	}
+
+	if !options.RequireNotarization || (!isUploadRecipe(result.Recipe) && len(result.Uploads) == 0) {
+		return
+	}
+	unnotarized := others
+	if hasApps {
+		unnotarized = apps
+	}
+	if len(unnotarized) == 0 {
+		return
+	}
+
+	result.Status = "failed"
+	result.ExecutionError = fmt.Errorf("not notarized: %s", strings.Join(unnotarized, ", "))
+	result.FailureKind = FailureKindNotNotarized
+	logger.Logger(fmt.Sprintf("❌ Recipe %s produced software that isn't notarized: %s", result.Recipe, strings.Join(unnotarized, ", ")), logger.LogError)
+}
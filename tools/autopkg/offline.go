@@ -0,0 +1,118 @@
+// offline.go
+package autopkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// AutoPkgInstallerEnvVar names a pre-downloaded AutoPkg installer package,
+// installed instead of downloading the latest release from GitHub
+const AutoPkgInstallerEnvVar = "AUTOPKG_INSTALLER_PKG"
+
+// ErrOffline is wrapped by the errors of operations that offline mode refuses
+var ErrOffline = errors.New("network access is disabled in offline mode")
+
+var offline atomic.Bool
+
+// SetOffline turns offline mode on or off. In offline mode nothing reaches
+// the network: GitHub API calls and searches are refused, repos must already
+// be present, for example from repo-cache import, AutoPkg is installed from
+// AUTOPKG_INSTALLER_PKG and recipes run against downloads already in the
+// AutoPkg cache. Anything that would need the network fails straight away.
+func SetOffline(enabled bool) {
+	offline.Store(enabled)
+	if enabled {
+		logger.Logger("✈️ Offline mode: using local caches only", logger.LogInfo)
+	}
+}
+
+// Offline reports whether offline mode is on
+func Offline() bool {
+	return offline.Load()
+}
+
+// requireNetwork returns an error naming the action and how to do without the
+// network when offline mode is on, and nil otherwise
+func requireNetwork(action string, remedy string) error {
+	if !Offline() {
+		return nil
+	}
+	if remedy == "" {
+		return fmt.Errorf("%s: %w", action, ErrOffline)
+	}
+	return fmt.Errorf("%s: %w, %s", action, ErrOffline, remedy)
+}
+
+// resolveOfflineDownloads finds the cached download of every recipe, to pass
+// to autopkg run --pkg in offline mode so the download step is skipped.
+// Recipes without one are logged here and fail when they are run.
+func (o *RecipeBatchRunOptions) resolveOfflineDownloads(recipes []string) {
+	o.offlineDownloads = make(map[string]string)
+	indexes := make(map[string]*recipeIndex)
+	for _, recipe := range recipes {
+		prefsPath := o.prefsPathFor(recipe)
+		if indexes[prefsPath] == nil {
+			indexes[prefsPath] = newRecipeIndex(prefsPath, o.SearchDirs, o.OverrideDirs)
+		}
+
+		download, err := offlineDownload(recipe, indexes[prefsPath], autopkgCacheDir(prefsPath))
+		if err != nil {
+			logger.Logger(fmt.Sprintf("❌ %v", err), logger.LogError)
+			continue
+		}
+		o.offlineDownloads[recipe] = download
+	}
+}
+
+// offlineDownload returns the newest package or disk image cached for a
+// recipe. AutoPkg caches downloads under CACHE_DIR/<recipe identifier>/downloads,
+// which is searched for the recipe and then each of its parents.
+func offlineDownload(recipe string, index *recipeIndex, cacheDir string) (string, error) {
+	definition := index.definition(recipe)
+	if definition == nil {
+		return "", fmt.Errorf("offline: recipe %s not found in the local repos or overrides", recipe)
+	}
+
+	chain := append([]*recipeDefinition{definition}, index.parents(definition)...)
+	for _, candidate := range chain {
+		downloadsDir := filepath.Join(cacheDir, candidate.Identifier, "downloads")
+		entries, err := os.ReadDir(downloadsDir)
+		if err != nil {
+			continue
+		}
+
+		newest, newestTime := "", time.Time{}
+		for _, entry := range entries {
+			if entry.IsDir() || !isOfflineDownload(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if newest == "" || info.ModTime().After(newestTime) {
+				newest, newestTime = filepath.Join(downloadsDir, entry.Name()), info.ModTime()
+			}
+		}
+		if newest != "" {
+			logger.Logger(fmt.Sprintf("✈️ Using cached download %s for %s", newest, recipe), logger.LogDebug)
+			return newest, nil
+		}
+	}
+
+	return "", fmt.Errorf("offline: no cached download for %s in %s, run it online once or seed the AutoPkg cache", recipe, cacheDir)
+}
+
+// isOfflineDownload reports whether a cached file is a download autopkg run --pkg accepts
+func isOfflineDownload(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".pkg" || ext == ".dmg"
+}
@@ -0,0 +1,139 @@
+// os_gate.go
+package autopkg
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	sp "github.com/deploymenttheory/macos-autopkg-factory/tools/suspicious_package"
+)
+
+// SkipReasonOSIncompatible marks recipes skipped because they need a newer macOS than the runner
+const SkipReasonOSIncompatible = "os-incompatible"
+
+// RunnerOSVersion returns the macOS version of the runner, or an empty string
+// when it can't be determined, e.g. on other platforms
+func RunnerOSVersion() string {
+	if runtime.GOOS != "darwin" {
+		return ""
+	}
+	output, err := exec.Command("sw_vers", "-productVersion").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// CompareOSVersions compares dotted version strings numerically, returning
+// -1, 0 or 1. Missing components count as zero, so 14 equals 14.0.
+func CompareOSVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimSpace(a), ".")
+	bParts := strings.Split(strings.TrimSpace(b), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aNum, bNum int
+		if i < len(aParts) {
+			aNum, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bNum, _ = strconv.Atoi(bParts[i])
+		}
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// MinOSVersion returns the minimum macOS version a recipe is tagged with in the catalog, or an empty string
+func (c *Catalog) MinOSVersion(recipe string) string {
+	if entry := c.Entry(recipe); entry != nil {
+		return strings.TrimSpace(entry.MinOSVersion)
+	}
+	return ""
+}
+
+// recipeMinOSVersion returns the highest of the catalog requirement and the
+// requirement found in the package of the recipe's last successful run
+func recipeMinOSVersion(options *RecipeBatchRunOptions, history *History, recipe string) string {
+	required := options.Catalog.MinOSVersion(recipe)
+	if history == nil {
+		return required
+	}
+
+	last, err := history.LastSuccessful(recipe, time.Now().Add(time.Minute))
+	if err != nil || last == nil || last.MinOSVersion == "" {
+		return required
+	}
+	if required == "" || CompareOSVersions(last.MinOSVersion, required) > 0 {
+		return last.MinOSVersion
+	}
+	return required
+}
+
+// skipIncompatibleOSRecipes removes recipes that need a newer macOS than the
+// runner, recording them as skipped rather than letting them fail mid-run
+func skipIncompatibleOSRecipes(recipes []string, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult) []string {
+	if options.RunnerOSVersion == "" {
+		return recipes
+	}
+
+	historyPath := options.HistoryPath
+	if historyPath == "" {
+		historyPath = DefaultHistoryPath(options.StateDir)
+	}
+	history, err := OpenHistory(historyPath)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to open run history for macOS requirements: %v", err), logger.LogWarning)
+		history = nil
+	} else {
+		defer history.Close()
+	}
+
+	var remaining []string
+	for _, recipe := range recipes {
+		required := recipeMinOSVersion(options, history, recipe)
+		if required == "" || CompareOSVersions(options.RunnerOSVersion, required) >= 0 {
+			remaining = append(remaining, recipe)
+			continue
+		}
+
+		logger.Logger(fmt.Sprintf("⏩ Skipping %s: requires macOS %s, runner is %s", recipe, required, options.RunnerOSVersion), logger.LogWarning)
+		results[recipe] = &RecipeBatchResult{
+			Recipe:     recipe,
+			Output:     fmt.Sprintf("requires macOS %s, runner is %s", required, options.RunnerOSVersion),
+			Status:     "skipped",
+			SkipReason: SkipReasonOSIncompatible,
+		}
+	}
+	return remaining
+}
+
+// scanArtifactMinOSVersion returns the highest minimum macOS version required
+// by the executables in a run's packages, using Suspicious Package
+func scanArtifactMinOSVersion(artifacts []ProducedArtifact) string {
+	highest := ""
+	for _, artifact := range artifacts {
+		if artifact.Type != "pkg" {
+			continue
+		}
+		requirements, err := sp.GetMacOSMinimumVersionRequirements(artifact.Path)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to read macOS requirements of %s: %v", artifact.Path, err), logger.LogWarning)
+			continue
+		}
+		for _, requirement := range requirements {
+			if highest == "" || CompareOSVersions(requirement.Version, highest) > 0 {
+				highest = requirement.Version
+			}
+		}
+	}
+	return highest
+}
@@ -0,0 +1,312 @@
+// override_catalog.go
+package autopkg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+	"howett.net/plist"
+)
+
+// OverrideTemplate holds the Input keys written into the override of every
+// catalog entry with a target. Values are Go templates rendered with the
+// entry, e.g. "{{ .Name }}" or "Apps - {{ .Name }}".
+type OverrideTemplate struct {
+	Input map[string]string `yaml:"input"`
+}
+
+// MakeOverridesOptions contains options for MakeOverridesFromCatalog
+type MakeOverridesOptions struct {
+	PrefsPath         string
+	SearchDirs        []string
+	OverrideDirs      []string // Directories to look for existing overrides in, the first receives new ones
+	Pull              bool
+	IgnoreDeprecation bool
+	SkipTrustUpdate   bool // Do not run update-trust-info on the written overrides
+}
+
+// OverrideResult contains the outcome of generating a single override
+type OverrideResult struct {
+	Recipe  string
+	Path    string
+	Created bool     // Override was created rather than updated
+	Input   []string // Input keys written
+	Error   error
+}
+
+// overrideTemplateData is the data catalog Input templates are rendered with
+type overrideTemplateData struct {
+	Name   string
+	Recipe string
+	Target string
+	Tags   []string
+}
+
+// MakeOverridesFromCatalog creates or updates a YAML override for every
+// catalog entry, writes its templated Input keys and updates trust info, so
+// onboarding an app is a catalog change rather than a sequence of manual edits.
+func MakeOverridesFromCatalog(catalog *Catalog, options *MakeOverridesOptions) ([]OverrideResult, error) {
+	if options == nil {
+		options = &MakeOverridesOptions{}
+	}
+	if catalog == nil || len(catalog.Recipes) == 0 {
+		return nil, fmt.Errorf("catalog contains no recipes")
+	}
+
+	overrideDirs := options.OverrideDirs
+	if len(overrideDirs) == 0 {
+		overrideDirs = recipeOverrideDirs(options.PrefsPath)
+	}
+
+	logger.Logger(fmt.Sprintf("🏭 Generating overrides for %d catalog recipes", len(catalog.Recipes)), logger.LogInfo)
+
+	var results []OverrideResult
+	var written []string
+	var failed []string
+
+	for _, entry := range catalog.Recipes {
+		result := makeCatalogOverride(catalog, entry, overrideDirs, options)
+		results = append(results, result)
+
+		if result.Error != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to generate override for %s: %v", entry.Recipe, result.Error), logger.LogError)
+			failed = append(failed, entry.Recipe)
+			continue
+		}
+
+		action := "Updated"
+		if result.Created {
+			action = "Created"
+		}
+		logger.Logger(fmt.Sprintf("✅ %s %s with %d Input keys", action, result.Path, len(result.Input)), logger.LogSuccess)
+		written = append(written, overrideRecipeName(filepath.Base(result.Path)))
+	}
+
+	if !options.SkipTrustUpdate && len(written) > 0 {
+		_, err := UpdateTrustInfoForRecipes(written, &UpdateTrustInfoOptions{
+			PrefsPath:    options.PrefsPath,
+			SearchDirs:   options.SearchDirs,
+			OverrideDirs: options.OverrideDirs,
+		})
+		if err != nil {
+			return results, fmt.Errorf("failed to update trust info: %w", err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("failed to generate %d overrides: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// makeCatalogOverride creates or updates the override of a single catalog entry
+func makeCatalogOverride(catalog *Catalog, entry CatalogEntry, overrideDirs []string, options *MakeOverridesOptions) OverrideResult {
+	result := OverrideResult{Recipe: entry.Recipe}
+
+	input, err := renderOverrideInput(catalog, entry)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	name := overrideFileName(entry.Recipe)
+	path := findOverrideFile(overrideDirs, name)
+
+	// Overrides are always YAML, so an existing plist override is recreated and its Input carried over
+	var previousInput map[string]interface{}
+	if path != "" && !strings.HasSuffix(path, ".yaml") {
+		if previousInput, err = readPlistOverrideInput(path); err != nil {
+			result.Error = err
+			return result
+		}
+	}
+
+	if path == "" || previousInput != nil {
+		_, err := MakeOverride(entry.Recipe, &MakeOverrideOptions{
+			PrefsPath:         options.PrefsPath,
+			SearchDirs:        options.SearchDirs,
+			OverrideDirs:      options.OverrideDirs,
+			Force:             path != "",
+			Pull:              options.Pull,
+			IgnoreDeprecation: options.IgnoreDeprecation,
+			Format:            "yaml",
+		})
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		if path != "" {
+			if err := os.Remove(path); err != nil {
+				result.Error = fmt.Errorf("failed to remove plist override %s: %w", path, err)
+				return result
+			}
+			logger.Logger(fmt.Sprintf("🔁 Converted %s to YAML", path), logger.LogInfo)
+		}
+
+		result.Created = path == ""
+		if path = findOverrideFile(overrideDirs, name); path == "" || !strings.HasSuffix(path, ".yaml") {
+			result.Error = fmt.Errorf("autopkg did not write %s.recipe.yaml to %s", name, strings.Join(overrideDirs, ", "))
+			return result
+		}
+	}
+
+	result.Path = path
+	result.Input, result.Error = writeOverrideInput(path, previousInput, input)
+	return result
+}
+
+// renderOverrideInput renders the target template and the entry's own Input keys
+func renderOverrideInput(catalog *Catalog, entry CatalogEntry) (map[string]string, error) {
+	data := overrideTemplateData{
+		Name:   entry.Name,
+		Recipe: entry.Recipe,
+		Target: entry.Target,
+		Tags:   entry.Tags,
+	}
+	if data.Name == "" {
+		data.Name, _, _ = strings.Cut(filepath.Base(entry.Recipe), ".")
+	}
+
+	values := make(map[string]string)
+	if entry.Target != "" {
+		for key, value := range catalog.OverrideTemplates[entry.Target].Input {
+			values[key] = value
+		}
+	}
+	for key, value := range entry.Input {
+		values[key] = value
+	}
+
+	rendered := make(map[string]string, len(values))
+	for key, value := range values {
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for Input %s: %w", key, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render Input %s: %w", key, err)
+		}
+		rendered[key] = buf.String()
+	}
+	return rendered, nil
+}
+
+// writeOverrideInput merges Input keys into a YAML override, keeping the
+// order and any keys the catalog does not manage
+func writeOverrideInput(path string, previousInput map[string]interface{}, input map[string]string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read override: %w", err)
+	}
+
+	var override yaml.MapSlice
+	if err := yaml.Unmarshal(data, &override); err != nil {
+		return nil, fmt.Errorf("failed to parse override %s: %w", path, err)
+	}
+
+	inputIndex := -1
+	for i, item := range override {
+		if item.Key == "Input" {
+			inputIndex = i
+		}
+	}
+	if inputIndex < 0 {
+		override = append(override, yaml.MapItem{Key: "Input", Value: yaml.MapSlice{}})
+		inputIndex = len(override) - 1
+	}
+	existing, _ := override[inputIndex].Value.(yaml.MapSlice)
+
+	updates := make(map[string]interface{}, len(previousInput)+len(input))
+	for key, value := range previousInput {
+		updates[key] = value
+	}
+	for key, value := range input {
+		updates[key] = value
+	}
+
+	for i, item := range existing {
+		if key, ok := item.Key.(string); ok {
+			if value, found := updates[key]; found {
+				existing[i].Value = value
+				delete(updates, key)
+			}
+		}
+	}
+
+	newKeys := make([]string, 0, len(updates))
+	for key := range updates {
+		newKeys = append(newKeys, key)
+	}
+	sort.Strings(newKeys)
+	for _, key := range newKeys {
+		existing = append(existing, yaml.MapItem{Key: key, Value: updates[key]})
+	}
+	override[inputIndex].Value = existing
+
+	output, err := yaml.Marshal(override)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal override: %w", err)
+	}
+	if err := os.WriteFile(path, output, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write override: %w", err)
+	}
+
+	keys := make([]string, 0, len(input))
+	for key := range input {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// readPlistOverrideInput returns the Input dictionary of a plist override
+func readPlistOverrideInput(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read override: %w", err)
+	}
+
+	var override struct {
+		Input map[string]interface{} `plist:"Input"`
+	}
+	if _, err := plist.Unmarshal(data, &override); err != nil {
+		return nil, fmt.Errorf("failed to parse override %s: %w", path, err)
+	}
+	if override.Input == nil {
+		override.Input = make(map[string]interface{})
+	}
+	return override.Input, nil
+}
+
+// overrideFileName returns the file name autopkg gives an override of a
+// recipe, without extension, e.g. Firefox.jamf for Firefox.jamf.recipe
+func overrideFileName(recipe string) string {
+	name := filepath.Base(recipe)
+	for _, ext := range []string{".recipe.yaml", ".recipe.plist", ".recipe"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// findOverrideFile returns the path of an existing override in the override
+// directories, or an empty string if there is none
+func findOverrideFile(overrideDirs []string, name string) string {
+	for _, dir := range overrideDirs {
+		for _, ext := range []string{".recipe.yaml", ".recipe.plist", ".recipe"} {
+			path := filepath.Join(expandTilde(dir), name+ext)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,235 @@
+// phases.go
+package autopkg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Phases of a two-phase run, see RecipeBatchRunOptions.Phase
+const (
+	PhaseDownload = "download" // Run the .download parents of the recipes, several at once
+	PhasePackage  = "package"  // Run the recipes whose .download parent found a new download
+)
+
+// DefaultDownloadConcurrency is the number of download recipes the download phase runs at once
+const DefaultDownloadConcurrency = 4
+
+// Skip reasons of recipes left out of the package phase
+const (
+	SkipReasonDownloadUnchanged = "download-unchanged"
+	SkipReasonDownloadFailed    = "download-failed"
+)
+
+// PhasePlan is the phase graph of a batch, built from the recipes' parent chains
+type PhasePlan struct {
+	Downloads  []string          // Download recipes the recipes build on, run in the download phase
+	DownloadOf map[string]string // Download recipe of each recipe that has one, itself for .download recipes
+	Standalone []string          // Recipes without a .download parent, always run in the package phase
+}
+
+// PlanPhases finds the .download recipe in the parent chain of each recipe,
+// e.g. Firefox.download for Firefox.jamf, through Firefox.pkg
+func PlanPhases(recipes []string, options *RecipeBatchRunOptions) *PhasePlan {
+	plan := &PhasePlan{DownloadOf: make(map[string]string)}
+	index := newRecipeIndex(options.PrefsPath, options.SearchDirs, options.OverrideDirs)
+
+	seen := make(map[string]bool)
+	for _, recipe := range recipes {
+		download := downloadParent(recipe, index)
+		if download == "" {
+			plan.Standalone = append(plan.Standalone, recipe)
+			continue
+		}
+		plan.DownloadOf[recipe] = download
+		if !seen[download] {
+			seen[download] = true
+			plan.Downloads = append(plan.Downloads, download)
+		}
+	}
+
+	sort.Strings(plan.Downloads)
+	return plan
+}
+
+// downloadParent returns the name of the .download recipe in a recipe's
+// parent chain, the recipe itself included, or "" when there is none
+func downloadParent(recipe string, index *recipeIndex) string {
+	definition := index.definition(recipe)
+	if definition == nil {
+		return ""
+	}
+
+	chain := append([]*recipeDefinition{definition}, index.parents(definition)...)
+	for _, candidate := range chain {
+		name := overrideRecipeName(filepath.Base(candidate.path))
+		if recipeTypeFromName(name) == "download" {
+			return name
+		}
+	}
+	return ""
+}
+
+// downloadPhaseRecipes returns the download recipes of the recipes to run in
+// the download phase. Trust is verified for the recipes themselves, whose
+// trust info covers their parents, and downloads only wanted by recipes that
+// fail it aren't run.
+func (o *RecipeBatchRunOptions) downloadPhaseRecipes(recipes []string, results map[string]*RecipeBatchResult) []string {
+	if o.VerifyTrust {
+		o.verifyTrustBatch(recipes)
+		var trusted []string
+		for _, recipe := range recipes {
+			if skip, _ := verifyTrustForRecipe(recipe, o, results, time.Now()); !skip {
+				trusted = append(trusted, recipe)
+			}
+		}
+		recipes = trusted
+	}
+
+	plan := PlanPhases(recipes, o)
+	if len(plan.Standalone) > 0 {
+		logger.Logger(fmt.Sprintf("ℹ️ %d recipes have no .download parent and run in the package phase", len(plan.Standalone)), logger.LogInfo)
+	}
+	return plan.Downloads
+}
+
+// packagePhaseRecipes returns the recipes to run in the package phase: those
+// whose download changed, or wasn't run, and those without a download recipe.
+// The rest are recorded as skipped, and .download recipes take the result
+// they had in the download phase.
+func (o *RecipeBatchRunOptions) packagePhaseRecipes(recipes []string, results map[string]*RecipeBatchResult) ([]string, error) {
+	if o.Downloads == nil {
+		return nil, fmt.Errorf("the package phase needs the results of the download phase")
+	}
+
+	plan := PlanPhases(recipes, o)
+	var remaining []string
+	for _, recipe := range recipes {
+		download, hasDownload := plan.DownloadOf[recipe]
+		downloadResult := o.Downloads[download]
+		if !hasDownload || downloadResult == nil {
+			remaining = append(remaining, recipe)
+			continue
+		}
+
+		switch {
+		case download == recipe:
+			results[recipe] = downloadResult
+		case downloadResult.Status == "updated":
+			remaining = append(remaining, recipe)
+		case downloadResult.ExecutionError != nil || downloadResult.Status == "failed":
+			logger.Logger(fmt.Sprintf("⏩ Skipping %s: %s failed", recipe, download), logger.LogWarning)
+			results[recipe] = &RecipeBatchResult{
+				Recipe:     recipe,
+				Output:     fmt.Sprintf("%s failed in the download phase", download),
+				Status:     "skipped",
+				SkipReason: SkipReasonDownloadFailed,
+			}
+		default:
+			logger.Logger(fmt.Sprintf("⏩ Skipping %s: %s found no new download", recipe, download), logger.LogInfo)
+			results[recipe] = &RecipeBatchResult{
+				Recipe:        recipe,
+				Output:        fmt.Sprintf("%s found no new download", download),
+				TrustVerified: true,
+				Status:        "skipped",
+				SkipReason:    SkipReasonDownloadUnchanged,
+			}
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("📦 Package phase runs %d of %d recipes", len(remaining), len(recipes)), logger.LogInfo)
+	return remaining, nil
+}
+
+// processDownloadPhase runs download recipes, DownloadConcurrency at a time.
+// Each writes its own report next to ReportPlist, since they run at once.
+func processDownloadPhase(downloads []string, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult, batchStartTime time.Time) error {
+	concurrency := options.DownloadConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+	logger.Logger(fmt.Sprintf("⬇️ Running %d download recipes, %d at a time", len(downloads), concurrency), logger.LogInfo)
+
+	var mu sync.Mutex
+	var firstError error
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, recipe := range downloads {
+		wg.Add(1)
+		go func(recipe string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			ctx, cancel := context.WithCancel(options.batchContext())
+			defer cancel()
+			if ctx.Err() != nil {
+				return
+			}
+
+			mu.Lock()
+			options.reportRecipeStarted(recipe, cancel)
+			mu.Unlock()
+
+			result := runDownloadRecipe(ctx, recipe, options)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[recipe] = result
+			options.reportRecipeFinished(recipe, results)
+			if result.ExecutionError != nil && firstError == nil {
+				firstError = result.ExecutionError
+			}
+		}(recipe)
+	}
+	wg.Wait()
+
+	LogRecipeBatchSummary(results, batchStartTime)
+	return firstError
+}
+
+// runDownloadRecipe runs a single download recipe of the download phase
+func runDownloadRecipe(ctx context.Context, recipe string, options *RecipeBatchRunOptions) *RecipeBatchResult {
+	logger.Logger(fmt.Sprintf("🚀 Running download recipe: %s", recipe), logger.LogInfo)
+	startTime := time.Now()
+
+	runOpts := createRunOptions(options, "", recipe)
+	runOpts.Context = ctx
+	runOpts.ReportPlist = targetReportPath(options.ReportPlist, recipeBaseName(recipe))
+
+	output, attempts, runErr := options.runWithRetry(ctx, recipe, func() (string, error) {
+		return RunRecipe(recipe, runOpts)
+	})
+	if runErr != nil && ctx.Err() != nil {
+		runErr = fmt.Errorf("recipe cancelled: %w", runErr)
+	}
+
+	result := createRecipeResult(recipe, output, runErr, time.Since(startTime), true, false)
+	result.Attempts = attempts
+	if runOpts.ReportPlist != "" {
+		artifacts, err := CollectProducedArtifacts(runOpts.ReportPlist, recipe)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to collect produced artifacts: %v", err), logger.LogWarning)
+		}
+		result.Artifacts = artifacts
+		result.CacheDir = recipeCacheDir(autopkgCacheDir(options.prefsPathFor(recipe)), artifacts)
+
+		// Downloads run side by side, so only what each report lists is theirs alone
+		if downloaded, ok := reportDownloadedBytes(runOpts.ReportPlist, recipe); ok {
+			result.Usage = &RecipeUsage{DownloadedBytes: downloaded}
+		}
+	}
+
+	if runErr != nil {
+		logger.Logger(fmt.Sprintf("❌ Download recipe %s failed after %s: %v", recipe, result.ExecutionTime, runErr), logger.LogError)
+	} else {
+		logger.Logger(fmt.Sprintf("✅ Download recipe %s %s in %s", recipe, result.Status, result.ExecutionTime), logger.LogSuccess)
+	}
+	return result
+}
@@ -0,0 +1,151 @@
+// prefs_dirs.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"howett.net/plist"
+)
+
+// Preference keys holding directory lists
+const (
+	searchDirsPrefsKey   = "RECIPE_SEARCH_DIRS"
+	overrideDirsPrefsKey = "RECIPE_OVERRIDE_DIRS"
+)
+
+// AddSearchDir appends a directory to RECIPE_SEARCH_DIRS, unless it's listed already
+func AddSearchDir(prefsPath string, dir string) error {
+	return addPreferenceDir(prefsPath, searchDirsPrefsKey, dir)
+}
+
+// RemoveSearchDir removes a directory from RECIPE_SEARCH_DIRS
+func RemoveSearchDir(prefsPath string, dir string) error {
+	return removePreferenceDir(prefsPath, searchDirsPrefsKey, dir)
+}
+
+// AddOverrideDir appends a directory to RECIPE_OVERRIDE_DIRS, unless it's listed already
+func AddOverrideDir(prefsPath string, dir string) error {
+	return addPreferenceDir(prefsPath, overrideDirsPrefsKey, dir)
+}
+
+// RemoveOverrideDir removes a directory from RECIPE_OVERRIDE_DIRS
+func RemoveOverrideDir(prefsPath string, dir string) error {
+	return removePreferenceDir(prefsPath, overrideDirsPrefsKey, dir)
+}
+
+// preferenceDirs returns a directory list preference, which AutoPkg accepts
+// as an array or, from older tooling, as a single string
+func preferenceDirs(prefs map[string]interface{}, key string) []string {
+	var dirs []string
+	switch value := prefs[key].(type) {
+	case string:
+		if value != "" {
+			dirs = append(dirs, value)
+		}
+	case []interface{}:
+		for _, dir := range value {
+			if dirStr, ok := dir.(string); ok && dirStr != "" {
+				dirs = append(dirs, dirStr)
+			}
+		}
+	}
+	return dirs
+}
+
+// normalizePreferenceDir expands a leading ~ and cleans a directory, so the
+// same directory written two ways is only listed once
+func normalizePreferenceDir(dir string) string {
+	return filepath.Clean(expandTilde(dir))
+}
+
+// addPreferenceDir appends an existing directory to a directory list preference,
+// rewriting a single string value as an array and dropping duplicate entries
+func addPreferenceDir(prefsPath string, key string, dir string) error {
+	if dir == "" {
+		return fmt.Errorf("no directory given for %s", key)
+	}
+	dir = normalizePreferenceDir(dir)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to %s: %w", dir, key, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("failed to add %s to %s: not a directory", dir, key)
+	}
+
+	return updatePreferenceDirs(prefsPath, key, func(dirs []string) []string {
+		return append(dirs, dir)
+	})
+}
+
+// removePreferenceDir removes every entry of a directory from a directory list preference
+func removePreferenceDir(prefsPath string, key string, dir string) error {
+	if dir == "" {
+		return fmt.Errorf("no directory given for %s", key)
+	}
+	dir = normalizePreferenceDir(dir)
+
+	return updatePreferenceDirs(prefsPath, key, func(dirs []string) []string {
+		var kept []string
+		for _, existing := range dirs {
+			if existing != dir {
+				kept = append(kept, existing)
+			}
+		}
+		return kept
+	})
+}
+
+// updatePreferenceDirs rewrites a directory list preference as a deduplicated
+// array of expanded paths. It writes the preferences itself rather than with
+// UpdateAutoPkgPreferences, whose environment variables would replace the
+// array with a single string.
+func updatePreferenceDirs(prefsPath string, key string, update func([]string) []string) error {
+	if prefsPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get user home directory: %w", err)
+		}
+		prefsPath = filepath.Join(homeDir, "Library/Preferences/com.github.autopkg.plist")
+	}
+
+	prefs, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		if _, statErr := os.Stat(prefsPath); statErr == nil {
+			return err
+		}
+		prefs = make(map[string]interface{})
+	}
+
+	var current []string
+	for _, dir := range preferenceDirs(prefs, key) {
+		current = append(current, normalizePreferenceDir(dir))
+	}
+
+	seen := make(map[string]bool)
+	dirs := []interface{}{}
+	for _, dir := range update(current) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	prefs[key] = dirs
+
+	data, err := plist.MarshalIndent(prefs, plist.XMLFormat, "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plist: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(prefsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create preferences directory: %w", err)
+	}
+	if err := os.WriteFile(prefsPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write preferences file: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("✅ %s now lists %d directories", key, len(dirs)), logger.LogSuccess)
+	return nil
+}
@@ -0,0 +1,277 @@
+// prefs_sync.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+	"howett.net/plist"
+)
+
+// Preference file formats for export and import
+const (
+	PrefsFormatYAML  = "yaml"
+	PrefsFormatJSON  = "json"
+	PrefsFormatPlist = "plist"
+)
+
+// Preference diff changes
+const (
+	PrefsAdded   = "added"
+	PrefsRemoved = "removed"
+	PrefsChanged = "changed"
+)
+
+// PreferenceDiff is a preference that differs between two preference files
+type PreferenceDiff struct {
+	Key    string      `json:"key" yaml:"key"`
+	Change string      `json:"change" yaml:"change"`
+	Old    interface{} `json:"old,omitempty" yaml:"old,omitempty"`
+	New    interface{} `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// PrefsImportOptions contains options for ImportPreferences
+type PrefsImportOptions struct {
+	Replace bool // Drop preferences the imported file doesn't set, rather than merging into them
+	DryRun  bool // Report the changes without writing them
+}
+
+// isSecretPreference reports whether a preference holds a credential, which
+// includes webhook URLs, since they carry their own token
+func isSecretPreference(key string) bool {
+	upper := strings.ToUpper(key)
+	return isSecretKey(key) || strings.Contains(upper, "WEBHOOK") || strings.HasSuffix(upper, "_KEY")
+}
+
+// MaskPreferences returns a copy of preferences with credentials masked
+func MaskPreferences(prefs map[string]interface{}) map[string]interface{} {
+	masked := make(map[string]interface{}, len(prefs))
+	for key, value := range prefs {
+		if isSecretPreference(key) && value != "" {
+			value = redactedValue
+		}
+		masked[key] = value
+	}
+	return masked
+}
+
+// ExportPreferences reads preferences for export, with credentials masked unless includeSecrets is set
+func ExportPreferences(prefsPath string, includeSecrets bool) (map[string]interface{}, error) {
+	prefs, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		return nil, err
+	}
+	if includeSecrets {
+		return prefs, nil
+	}
+	return MaskPreferences(prefs), nil
+}
+
+// MarshalPreferences encodes preferences as YAML, JSON or a plist, with keys sorted
+func MarshalPreferences(prefs map[string]interface{}, format string) ([]byte, error) {
+	switch format {
+	case PrefsFormatYAML:
+		keys := make([]string, 0, len(prefs))
+		for key := range prefs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		ordered := make(yaml.MapSlice, 0, len(keys))
+		for _, key := range keys {
+			ordered = append(ordered, yaml.MapItem{Key: key, Value: prefs[key]})
+		}
+		return yaml.Marshal(ordered)
+	case PrefsFormatJSON:
+		data, err := json.MarshalIndent(prefs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case PrefsFormatPlist:
+		return plist.MarshalIndent(prefs, plist.XMLFormat, "  ")
+	default:
+		return nil, fmt.Errorf("unknown preferences format %q, expected yaml, json or plist", format)
+	}
+}
+
+// LoadPreferencesFile reads preferences from a plist, or from a YAML or JSON
+// export, telling the format from the file extension
+func LoadPreferencesFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preferences file: %w", err)
+	}
+
+	prefs := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse preferences %s: %w", path, err)
+		}
+		for key, value := range raw {
+			prefs[key] = yamlPreferenceValue(value)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &prefs); err != nil {
+			return nil, fmt.Errorf("failed to parse preferences %s: %w", path, err)
+		}
+	default:
+		if _, err := plist.Unmarshal(data, &prefs); err != nil {
+			return nil, fmt.Errorf("failed to parse preferences %s: %w", path, err)
+		}
+	}
+	return prefs, nil
+}
+
+// yamlPreferenceValue converts the maps yaml.v2 decodes into string-keyed
+// maps, which plists can encode
+func yamlPreferenceValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = yamlPreferenceValue(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = yamlPreferenceValue(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+// ImportPreferences merges preferences from a file into prefsPath, or replaces
+// them with Replace. Masked credentials in an export keep the value already
+// set. It returns the changes made, in key order.
+func ImportPreferences(prefsPath string, path string, options *PrefsImportOptions) ([]PreferenceDiff, error) {
+	if options == nil {
+		options = &PrefsImportOptions{}
+	}
+
+	imported, err := LoadPreferencesFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		current = make(map[string]interface{})
+	}
+
+	updated := make(map[string]interface{})
+	if !options.Replace {
+		for key, value := range current {
+			updated[key] = value
+		}
+	}
+	for key, value := range imported {
+		if value == redactedValue {
+			if existing, set := current[key]; set {
+				updated[key] = existing
+			} else {
+				logger.Logger(fmt.Sprintf("⚠️ %s is masked in %s and not set yet, set it with configure", key, path), logger.LogWarning)
+			}
+			continue
+		}
+		updated[key] = value
+	}
+
+	changes := DiffPreferences(current, updated)
+	if options.DryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	data, err := plist.MarshalIndent(updated, plist.XMLFormat, "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal plist: %w", err)
+	}
+	if prefsPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		}
+		prefsPath = filepath.Join(homeDir, "Library/Preferences/com.github.autopkg.plist")
+	}
+	if err := os.WriteFile(prefsPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write preferences file: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("✅ Imported %d preference changes from %s", len(changes), path), logger.LogSuccess)
+	return changes, nil
+}
+
+// DiffPreferences compares two sets of preferences, returning the keys added,
+// removed or changed from old to new, in key order. Values are compared by
+// their JSON form, so an integer read from a plist equals the same number
+// read from YAML.
+func DiffPreferences(old map[string]interface{}, new map[string]interface{}) []PreferenceDiff {
+	keys := make(map[string]bool)
+	for key := range old {
+		keys[key] = true
+	}
+	for key := range new {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	diffs := []PreferenceDiff{}
+	for _, key := range sorted {
+		oldValue, inOld := old[key]
+		newValue, inNew := new[key]
+		switch {
+		case !inOld:
+			diffs = append(diffs, PreferenceDiff{Key: key, Change: PrefsAdded, New: newValue})
+		case !inNew:
+			diffs = append(diffs, PreferenceDiff{Key: key, Change: PrefsRemoved, Old: oldValue})
+		case !reflect.DeepEqual(canonicalPreference(oldValue), canonicalPreference(newValue)):
+			diffs = append(diffs, PreferenceDiff{Key: key, Change: PrefsChanged, Old: oldValue, New: newValue})
+		}
+	}
+	return diffs
+}
+
+// MaskPreferenceDiffs masks the credential values of preference differences
+func MaskPreferenceDiffs(diffs []PreferenceDiff) []PreferenceDiff {
+	masked := make([]PreferenceDiff, len(diffs))
+	for i, diff := range diffs {
+		if isSecretPreference(diff.Key) {
+			if diff.Old != nil {
+				diff.Old = redactedValue
+			}
+			if diff.New != nil {
+				diff.New = redactedValue
+			}
+		}
+		masked[i] = diff
+	}
+	return masked
+}
+
+// canonicalPreference returns a preference value in its JSON form
+func canonicalPreference(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var canonical interface{}
+	if err := json.Unmarshal(data, &canonical); err != nil {
+		return value
+	}
+	return canonical
+}
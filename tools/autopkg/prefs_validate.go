@@ -0,0 +1,186 @@
+// prefs_validate.go
+package autopkg
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Jcds2ModePrefsKey enables JamfUploader's JCDS2 package uploads
+const Jcds2ModePrefsKey = "jcds2_mode"
+
+// ConfigValidationError lists every problem found in a configuration, each
+// saying what to change
+type ConfigValidationError struct {
+	Source   string // Preferences or config file validated
+	Problems []string
+}
+
+// Error implements error
+func (e *ConfigValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration in %s:\n  - %s", e.Source, strings.Join(e.Problems, "\n  - "))
+}
+
+// PreferencesData is a set of AutoPkg preferences, as read from the plist
+type PreferencesData map[string]interface{}
+
+// LoadPreferencesData reads the preferences to validate
+func LoadPreferencesData(prefsPath string) (PreferencesData, error) {
+	prefs, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		return nil, err
+	}
+	return PreferencesData(prefs), nil
+}
+
+// Validate checks the preferences for settings autopkg and the uploaders
+// would only reject mid-run: the problems of every MDM integration they
+// enable, Jamf Pro credentials given both ways or half given, malformed
+// URLs, JCDS2 mode without what it needs, and a GitHub token file others can
+// read. It returns a *ConfigValidationError listing every problem found.
+func (p PreferencesData) Validate() error {
+	problems := p.problems()
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ConfigValidationError{Source: "AutoPkg preferences", Problems: problems}
+}
+
+// problems returns what's wrong with the preferences
+func (p PreferencesData) problems() []string {
+	prefs := map[string]interface{}(p)
+	var problems []string
+
+	for _, integration := range Integrations() {
+		if !integration.Enabled(prefs) {
+			continue
+		}
+		for _, problem := range integration.Validate(prefs) {
+			problems = append(problems, fmt.Sprintf("%s: %v", integration.DisplayName(), problem))
+		}
+	}
+
+	problems = append(problems, p.jamfCredentialProblems()...)
+	problems = append(problems, p.smbProblems()...)
+	problems = append(problems, p.jcds2Problems()...)
+
+	for _, webhook := range []struct{ key, service string }{{"SLACK_WEBHOOK", "Slack"}, {"TEAMS_WEBHOOK", "Teams"}} {
+		if value := prefString(prefs, webhook.key); value != "" {
+			if err := ValidateHTTPSURL(webhook.key, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%v, copy the incoming webhook URL from %s", err, webhook.service))
+			}
+		}
+	}
+
+	if tokenPath := prefString(prefs, "GITHUB_TOKEN_PATH"); tokenPath != "" {
+		if problem := tokenFileProblem(expandTilde(tokenPath)); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	return problems
+}
+
+// jamfCredentialProblems checks Jamf Pro is given either an API user or an API
+// client, and both halves of whichever it is. CLIENT_ID and CLIENT_SECRET
+// belong to Intune when a tenant is set.
+func (p PreferencesData) jamfCredentialProblems() []string {
+	prefs := map[string]interface{}(p)
+	if prefString(prefs, "JSS_URL") == "" && prefString(prefs, "JAMFPRO_URL") == "" {
+		return nil
+	}
+
+	intune := prefString(prefs, "TENANT_ID") != "" || prefString(prefs, "INTUNE_TENANT_ID") != ""
+	basic := [2]string{prefString(prefs, "API_USERNAME"), prefString(prefs, "API_PASSWORD")}
+	client := [2]string{prefString(prefs, "JAMFPRO_CLIENT_ID"), prefString(prefs, "JAMFPRO_CLIENT_SECRET")}
+	clientKeys := [2]string{"JAMFPRO_CLIENT_ID", "JAMFPRO_CLIENT_SECRET"}
+	if client[0] == "" && client[1] == "" && !intune {
+		client = [2]string{prefString(prefs, "CLIENT_ID"), prefString(prefs, "CLIENT_SECRET")}
+		clientKeys = [2]string{"CLIENT_ID", "CLIENT_SECRET"}
+	}
+
+	var problems []string
+	hasBasic := basic[0] != "" || basic[1] != ""
+	hasClient := client[0] != "" || client[1] != ""
+	if hasBasic && hasClient {
+		problems = append(problems, fmt.Sprintf("Jamf Pro: both API_USERNAME/API_PASSWORD and %s/%s are set, keep only one of them, preferably the API client", clientKeys[0], clientKeys[1]))
+	}
+	if (basic[0] == "") != (basic[1] == "") {
+		problems = append(problems, "Jamf Pro: API_USERNAME and API_PASSWORD must be set together, set the missing one with configure --api-username or --api-password")
+	}
+	if (client[0] == "") != (client[1] == "") {
+		problems = append(problems, fmt.Sprintf("Jamf Pro: %s and %s must be set together, set the missing one with configure --client-id or --client-secret", clientKeys[0], clientKeys[1]))
+	}
+	return problems
+}
+
+// smbProblems checks SMB_URL is an smb://server/share URL with credentials
+func (p PreferencesData) smbProblems() []string {
+	prefs := map[string]interface{}(p)
+	smbURL := prefString(prefs, "SMB_URL")
+	if smbURL == "" {
+		return nil
+	}
+
+	var problems []string
+	if err := ValidateSMBURL("SMB_URL", smbURL); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if prefString(prefs, "SMB_USERNAME") == "" || prefString(prefs, "SMB_PASSWORD") == "" {
+		problems = append(problems, "SMB_URL is set without SMB_USERNAME and SMB_PASSWORD, set them with configure --smb-username and --smb-password")
+	}
+	return problems
+}
+
+// jcds2Problems checks JCDS2 mode has a Jamf Pro server to upload to and no
+// SMB distribution point it would ignore
+func (p PreferencesData) jcds2Problems() []string {
+	prefs := map[string]interface{}(p)
+	enabled := false
+	switch value := prefs[Jcds2ModePrefsKey].(type) {
+	case bool:
+		enabled = value
+	case string:
+		enabled, _ = strconv.ParseBool(value)
+	}
+	if !enabled {
+		return nil
+	}
+
+	var problems []string
+	if prefString(prefs, "JSS_URL") == "" && prefString(prefs, "JAMFPRO_URL") == "" {
+		problems = append(problems, "jcds2_mode is enabled without JSS_URL, set the Jamf Pro URL with configure --jss-url or disable it with --jcds2-mode=false")
+	}
+	if prefString(prefs, "SMB_URL") != "" {
+		problems = append(problems, "jcds2_mode uploads to the cloud distribution point, so SMB_URL would be ignored, remove SMB_URL or disable jcds2_mode")
+	}
+	return problems
+}
+
+// ValidateSMBURL checks a distribution point URL has the smb://server/share
+// shape JamfUploader expects, without credentials in it
+func ValidateSMBURL(name string, value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "smb" || parsed.Host == "" || strings.Trim(parsed.Path, "/") == "" {
+		return fmt.Errorf("%s must look like smb://server.example.com/share, got %q", name, value)
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("%s must not contain credentials, give them as the SMB username and password instead", name)
+	}
+	return nil
+}
+
+// tokenFileProblem checks a token file exists and only its owner can read it
+func tokenFileProblem(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Sprintf("GITHUB_TOKEN_PATH %s can't be read (%v), write it with configure --github-token", path, err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Sprintf("GitHub token file %s is readable by other users (mode %04o), run chmod 600 %s", path, info.Mode().Perm(), path)
+	}
+	return ""
+}
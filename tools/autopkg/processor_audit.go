@@ -0,0 +1,328 @@
+// processor_audit.go
+package autopkg
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+	"howett.net/plist"
+)
+
+// Processor kinds reported by the audit
+const (
+	ProcessorCore    = "core"    // Ships with AutoPkg
+	ProcessorShared  = "shared"  // Referenced as <recipe identifier>/<name> and provided by another recipe's directory
+	ProcessorLocal   = "local"   // Lives next to the recipe or one of its parents
+	ProcessorMissing = "missing" // Could not be found in any scanned directory
+)
+
+// coreProcessors lists the processors bundled with AutoPkg
+var coreProcessors = map[string]bool{
+	"AppDmgVersioner": true, "AppPkgCreator": true, "BrewCaskInfoProvider": true,
+	"ChocolateyPackager": true, "CodeSignatureVerifier": true, "Copier": true,
+	"CURLDownloader": true, "CURLTextSearcher": true, "DeprecationWarning": true,
+	"DmgCreator": true, "DmgMounter": true, "EndOfCheckPhase": true,
+	"FileCreator": true, "FileFinder": true, "FileMover": true,
+	"FlatPkgPacker": true, "FlatPkgUnpacker": true, "GitHubReleasesInfoProvider": true,
+	"Installer": true, "InstallFromDMG": true, "MunkiCatalogBuilder": true,
+	"MunkiImporter": true, "MunkiInfoCreator": true, "MunkiInstallsItemsCreator": true,
+	"MunkiOptionalReceiptEditor": true, "MunkiPkginfoMerger": true, "MunkiSetDefaultCatalog": true,
+	"PackageRequired": true, "PathDeleter": true, "PkgCopier": true,
+	"PkgCreator": true, "PkgExtractor": true, "PkgInfoCreator": true,
+	"PkgPayloadUnpacker": true, "PkgRootCreator": true, "PlistEditor": true,
+	"PlistReader": true, "SignToolVerifier": true, "SparkleUpdateInfoProvider": true,
+	"StopProcessingIf": true, "Symlinker": true, "Unarchiver": true,
+	"URLDownloader": true, "URLDownloaderPython": true, "URLGetter": true,
+	"URLTextSearcher": true, "Versioner": true,
+}
+
+// ProcessorAuditOptions contains options for AuditProcessors
+type ProcessorAuditOptions struct {
+	PrefsPath    string
+	SearchDirs   []string            // Added to RECIPE_SEARCH_DIRS and the recipe repo directory
+	OverrideDirs []string            // Defaults to RECIPE_OVERRIDE_DIRS or ~/Library/AutoPkg/RecipeOverrides
+	InfoCache    *ProcessorInfoCache // Attaches the processor info cached by DescribeProcessor, without running autopkg
+}
+
+// ProcessorUsage describes one processor referenced by the recipe set
+type ProcessorUsage struct {
+	Name       string         `json:"name"`
+	Kind       string         `json:"kind"`
+	ProvidedBy []string       `json:"provided_by,omitempty"` // Repos or directories containing the processor
+	UsedBy     []string       `json:"used_by"`               // Identifiers of the recipes referencing it
+	Info       *ProcessorInfo `json:"info,omitempty"`        // Variable documentation, when cached
+}
+
+// ProcessorAudit is the processor inventory of a recipe set
+type ProcessorAudit struct {
+	RecipesScanned    int               `json:"recipes_scanned"`
+	Processors        []ProcessorUsage  `json:"processors"`
+	Missing           []ProcessorUsage  `json:"missing,omitempty"`
+	UnresolvedParents map[string]string `json:"unresolved_parents,omitempty"` // Recipe identifier -> missing parent identifier
+}
+
+// recipeDefinition holds the parts of a recipe or override the audit needs
+type recipeDefinition struct {
+	Identifier            string                    `plist:"Identifier" yaml:"Identifier"`
+	ParentRecipe          string                    `plist:"ParentRecipe" yaml:"ParentRecipe"`
+	MinimumVersion        string                    `plist:"MinimumVersion" yaml:"MinimumVersion"`
+	Process               []recipeProcessStep       `plist:"Process" yaml:"Process"`
+	Input                 map[string]interface{}    `plist:"Input" yaml:"Input"`
+	ParentRecipeTrustInfo *recipeTrustInfoReference `plist:"ParentRecipeTrustInfo" yaml:"ParentRecipeTrustInfo"`
+
+	path string // Recipe file path
+	repo string // Repo or scan root the recipe was found in
+}
+
+// recipeProcessStep is a single step of a recipe's Process array
+type recipeProcessStep struct {
+	Processor string `plist:"Processor" yaml:"Processor"`
+}
+
+// recipeTrustInfoReference is the part of an override's trust info listing
+// the parent recipes and non-core processors it was made against
+type recipeTrustInfoReference struct {
+	ParentRecipes map[string]struct {
+		Path string `plist:"path" yaml:"path"`
+	} `plist:"parent_recipes" yaml:"parent_recipes"`
+	NonCoreProcessors map[string]struct {
+		Path string `plist:"path" yaml:"path"`
+	} `plist:"non_core_processors" yaml:"non_core_processors"`
+}
+
+// AuditProcessors walks every recipe and override in the search, repo and
+// override directories, and reports each processor referenced, where it is
+// provided from and which references can't be resolved before run time
+func AuditProcessors(options *ProcessorAuditOptions) (*ProcessorAudit, error) {
+	if options == nil {
+		options = &ProcessorAuditOptions{}
+	}
+
+	recipes := make(map[string]*recipeDefinition)
+	var overrides []*recipeDefinition
+
+	repoDir := recipeRepoDir(options.PrefsPath)
+	for _, root := range processorAuditRoots(options, repoDir) {
+		found, err := scanRecipeDefinitions(root, repoDir)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Could not scan %s: %v", root, err), logger.LogWarning)
+			continue
+		}
+		for _, recipe := range found {
+			if recipe.Identifier == "" {
+				continue
+			}
+			// The first definition wins, matching AutoPkg's search order
+			if _, exists := recipes[recipe.Identifier]; !exists {
+				recipes[recipe.Identifier] = recipe
+			}
+		}
+	}
+
+	overrideDirs := options.OverrideDirs
+	if len(overrideDirs) == 0 {
+		overrideDirs = recipeOverrideDirs(options.PrefsPath)
+	}
+	for _, dir := range overrideDirs {
+		found, err := scanRecipeDefinitions(expandTilde(dir), repoDir)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Could not scan override directory %s: %v", dir, err), logger.LogWarning)
+			continue
+		}
+		overrides = append(overrides, found...)
+	}
+
+	audit := &ProcessorAudit{
+		RecipesScanned:    len(recipes) + len(overrides),
+		UnresolvedParents: make(map[string]string),
+	}
+	usages := make(map[string]*ProcessorUsage)
+
+	addUsage := func(name string, kind string, provider string, recipe string) {
+		usage, exists := usages[name]
+		if !exists {
+			usage = &ProcessorUsage{Name: name, Kind: kind}
+			usages[name] = usage
+		}
+		// A processor found for one recipe may be unresolvable from another's directory
+		if usage.Kind == ProcessorMissing && kind != ProcessorMissing {
+			usage.Kind = kind
+		}
+		if provider != "" {
+			usage.ProvidedBy = appendUnique(usage.ProvidedBy, provider)
+		}
+		usage.UsedBy = appendUnique(usage.UsedBy, recipe)
+	}
+
+	for _, recipe := range recipes {
+		for _, step := range recipe.Process {
+			if step.Processor == "" {
+				continue
+			}
+			kind, provider := resolveProcessor(step.Processor, recipe, recipes)
+			addUsage(step.Processor, kind, provider, recipe.Identifier)
+		}
+		if recipe.ParentRecipe != "" && recipes[recipe.ParentRecipe] == nil {
+			audit.UnresolvedParents[recipe.Identifier] = recipe.ParentRecipe
+		}
+	}
+
+	// Overrides pin the non-core processors of their parent chain in their trust info
+	for _, override := range overrides {
+		if override.ParentRecipe != "" && recipes[override.ParentRecipe] == nil {
+			audit.UnresolvedParents[override.Identifier] = override.ParentRecipe
+		}
+		if override.ParentRecipeTrustInfo == nil {
+			continue
+		}
+		for name, processor := range override.ParentRecipeTrustInfo.NonCoreProcessors {
+			kind, provider := resolveProcessor(name, override, recipes)
+			if kind == ProcessorMissing && processor.Path != "" {
+				if _, err := os.Stat(expandTilde(processor.Path)); err == nil {
+					kind, provider = ProcessorShared, processorProvider(expandTilde(processor.Path), repoDir)
+				}
+			}
+			addUsage(name, kind, provider, override.Identifier)
+		}
+	}
+
+	for _, usage := range usages {
+		usage.Info = options.InfoCache.Lookup(usage.Name)
+		sort.Strings(usage.ProvidedBy)
+		sort.Strings(usage.UsedBy)
+		audit.Processors = append(audit.Processors, *usage)
+		if usage.Kind == ProcessorMissing {
+			audit.Missing = append(audit.Missing, *usage)
+		}
+	}
+	sort.Slice(audit.Processors, func(i, j int) bool {
+		return audit.Processors[i].Name < audit.Processors[j].Name
+	})
+	sort.Slice(audit.Missing, func(i, j int) bool {
+		return audit.Missing[i].Name < audit.Missing[j].Name
+	})
+
+	logger.Logger(fmt.Sprintf("🔬 Audited %d processors across %d recipes, %d missing", len(audit.Processors), audit.RecipesScanned, len(audit.Missing)), logger.LogInfo)
+	return audit, nil
+}
+
+// processorAuditRoots returns the directories recipes are searched in
+func processorAuditRoots(options *ProcessorAuditOptions, repoDir string) []string {
+	var roots []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		dir = expandTilde(dir)
+		if dir != "" && !seen[dir] {
+			seen[dir] = true
+			roots = append(roots, dir)
+		}
+	}
+
+	for _, dir := range options.SearchDirs {
+		add(dir)
+	}
+	if prefs, err := GetAutoPkgPreferences(options.PrefsPath); err == nil {
+		for _, dir := range preferenceDirs(prefs, searchDirsPrefsKey) {
+			add(dir)
+		}
+	}
+	add(repoDir)
+	return roots
+}
+
+// scanRecipeDefinitions parses every recipe file below a directory
+func scanRecipeDefinitions(root string, repoDir string) ([]*recipeDefinition, error) {
+	var definitions []*recipeDefinition
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if overrideRecipeName(entry.Name()) == "" {
+			return nil
+		}
+
+		definition, err := parseRecipeDefinition(path)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Skipping unreadable recipe %s: %v", path, err), logger.LogDebug)
+			return nil
+		}
+		definition.repo = processorProvider(path, repoDir)
+		definitions = append(definitions, definition)
+		return nil
+	})
+	return definitions, err
+}
+
+// parseRecipeDefinition reads a plist or YAML recipe
+func parseRecipeDefinition(path string) (*recipeDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	definition := &recipeDefinition{path: path}
+	if strings.HasSuffix(path, ".yaml") {
+		err = yaml.Unmarshal(data, definition)
+	} else {
+		_, err = plist.Unmarshal(data, definition)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+// resolveProcessor classifies a processor reference and finds where it is provided from
+func resolveProcessor(reference string, recipe *recipeDefinition, recipes map[string]*recipeDefinition) (string, string) {
+	// Shared processors are referenced as <identifier of a recipe in the providing directory>/<name>
+	if identifier, name, shared := strings.Cut(reference, "/"); shared {
+		provider := recipes[identifier]
+		if provider == nil {
+			return ProcessorMissing, ""
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(provider.path), name+".py")); err != nil {
+			return ProcessorMissing, ""
+		}
+		return ProcessorShared, provider.repo
+	}
+
+	if coreProcessors[reference] {
+		return ProcessorCore, ""
+	}
+
+	// AutoPkg looks for other processors next to the recipe and each of its parents
+	seen := make(map[string]bool)
+	for current := recipe; current != nil && !seen[current.Identifier]; current = recipes[current.ParentRecipe] {
+		seen[current.Identifier] = true
+		if current.path == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(current.path), reference+".py")); err == nil {
+			return ProcessorLocal, current.repo
+		}
+	}
+	return ProcessorMissing, ""
+}
+
+// processorProvider names the repo a path belongs to, or its directory when it
+// is outside the recipe repo directory
+func processorProvider(path string, repoDir string) string {
+	if rel, err := filepath.Rel(repoDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		if repo, _, found := strings.Cut(filepath.ToSlash(rel), "/"); found {
+			return repo
+		}
+	}
+	return filepath.Dir(path)
+}
@@ -0,0 +1,228 @@
+// processor_info.go
+package autopkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// ProcessorInfo is the parsed output of autopkg processor-info
+type ProcessorInfo struct {
+	Name        string              `json:"name" yaml:"name"`
+	Reference   string              `json:"reference" yaml:"reference"`               // As recipes reference it, e.g. com.github.homebysix.FindAndReplace/FindAndReplace
+	Recipe      string              `json:"recipe,omitempty" yaml:"recipe,omitempty"` // Recipe the processor was resolved from, if any
+	Description string              `json:"description,omitempty" yaml:"description,omitempty"`
+	Input       []ProcessorVariable `json:"input_variables" yaml:"input_variables"`
+	Output      []ProcessorVariable `json:"output_variables" yaml:"output_variables"`
+	CachedAt    time.Time           `json:"cached_at" yaml:"cached_at"`
+}
+
+// ProcessorVariable documents an input or output variable of a processor
+type ProcessorVariable struct {
+	Name        string `json:"name" yaml:"name"`
+	Required    bool   `json:"required,omitempty" yaml:"required,omitempty"`
+	Default     string `json:"default,omitempty" yaml:"default,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// ResolveProcessorReference splits a processor reference into the processor
+// name and the recipe autopkg processor-info has to look it up from. Shared
+// processors are referenced as <recipe identifier>/<name>, and are found
+// from that recipe; others are found from recipe, or are core processors.
+func ResolveProcessorReference(reference string, recipe string) (string, string) {
+	if identifier, name, shared := strings.Cut(reference, "/"); shared {
+		return name, identifier
+	}
+	if coreProcessors[reference] {
+		return reference, ""
+	}
+	return reference, recipe
+}
+
+// DescribeProcessor returns the parsed processor-info of a processor,
+// resolving shared processor references to the recipe providing them. Results
+// are taken from and added to cache, when one is given.
+func DescribeProcessor(reference string, options *ProcessorInfoOptions, cache *ProcessorInfoCache) (*ProcessorInfo, error) {
+	infoOptions := ProcessorInfoOptions{}
+	if options != nil {
+		infoOptions = *options
+	}
+
+	name, recipe := ResolveProcessorReference(reference, infoOptions.Recipe)
+	if info := cache.Get(name, recipe); info != nil {
+		logger.Logger(fmt.Sprintf("📚 Using cached info for processor %s", reference), logger.LogDebug)
+		return info, nil
+	}
+
+	infoOptions.Recipe = recipe
+	output, err := GetProcessorInfo(name, &infoOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	info := ParseProcessorInfo(name, output)
+	info.Reference = reference
+	info.Recipe = recipe
+	info.CachedAt = time.Now()
+	cache.Put(info)
+	return info, nil
+}
+
+// ParseProcessorInfo parses the output of autopkg processor-info: the
+// description, then each input and output variable followed by its
+// indented required, default and description attributes
+func ParseProcessorInfo(name string, output string) *ProcessorInfo {
+	info := &ProcessorInfo{Name: name, Input: []ProcessorVariable{}, Output: []ProcessorVariable{}}
+
+	section := ""
+	var variable *ProcessorVariable
+	var attribute *string // Attribute continued on the following lines
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		switch {
+		case strings.HasPrefix(trimmed, "Description:") && indent <= 2:
+			section = "description"
+			info.Description = strings.TrimSpace(strings.TrimPrefix(trimmed, "Description:"))
+			attribute = &info.Description
+			continue
+		case trimmed == "Input variables:":
+			section, variable, attribute = "input", nil, nil
+			continue
+		case trimmed == "Output variables:":
+			section, variable, attribute = "output", nil, nil
+			continue
+		}
+
+		key, value, labelled := strings.Cut(trimmed, ":")
+		switch {
+		case (section == "input" || section == "output") && labelled && indent <= 4 && strings.TrimSpace(value) == "":
+			if section == "input" {
+				info.Input = append(info.Input, ProcessorVariable{Name: key})
+				variable = &info.Input[len(info.Input)-1]
+			} else {
+				info.Output = append(info.Output, ProcessorVariable{Name: key})
+				variable = &info.Output[len(info.Output)-1]
+			}
+			attribute = nil
+		case variable != nil && labelled && key == "required":
+			variable.Required = strings.EqualFold(strings.TrimSpace(value), "true")
+			attribute = nil
+		case variable != nil && labelled && key == "default":
+			variable.Default = strings.TrimSpace(value)
+			attribute = &variable.Default
+		case variable != nil && labelled && key == "description":
+			variable.Description = strings.TrimSpace(value)
+			attribute = &variable.Description
+		case attribute != nil:
+			*attribute = strings.TrimSpace(*attribute + " " + trimmed)
+		}
+	}
+
+	return info
+}
+
+// ProcessorInfoCache keeps parsed processor info in the state directory, so
+// processor-info and the processor audit don't run autopkg for processors
+// already described
+type ProcessorInfoCache struct {
+	path    string
+	entries map[string]*ProcessorInfo
+	changed bool
+}
+
+// ProcessorInfoCachePath returns the processor info cache file in a state directory
+func ProcessorInfoCachePath(stateDir string) string {
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+	return filepath.Join(stateDir, "processor-info.json")
+}
+
+// LoadProcessorInfoCache reads the processor info cache, starting an empty
+// one when the file doesn't exist yet
+func LoadProcessorInfoCache(path string) (*ProcessorInfoCache, error) {
+	cache := &ProcessorInfoCache{path: path, entries: make(map[string]*ProcessorInfo)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processor info cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse processor info cache: %w", err)
+	}
+	return cache, nil
+}
+
+// processorInfoKey returns the cache key of a processor found from a recipe
+func processorInfoKey(name string, recipe string) string {
+	if recipe == "" {
+		return name
+	}
+	return recipe + "/" + name
+}
+
+// Get returns the cached info of a processor, or nil. A nil cache has no entries.
+func (c *ProcessorInfoCache) Get(name string, recipe string) *ProcessorInfo {
+	if c == nil {
+		return nil
+	}
+	return c.entries[processorInfoKey(name, recipe)]
+}
+
+// Lookup returns the cached info of a processor as recipes reference it
+func (c *ProcessorInfoCache) Lookup(reference string) *ProcessorInfo {
+	return c.Get(ResolveProcessorReference(reference, ""))
+}
+
+// Put adds a processor's info to the cache
+func (c *ProcessorInfoCache) Put(info *ProcessorInfo) {
+	if c == nil {
+		return
+	}
+	c.entries[processorInfoKey(info.Name, info.Recipe)] = info
+	c.changed = true
+}
+
+// Forget removes a processor from the cache, so it's described again
+func (c *ProcessorInfoCache) Forget(name string, recipe string) {
+	if c == nil {
+		return
+	}
+	delete(c.entries, processorInfoKey(name, recipe))
+	c.changed = true
+}
+
+// Save writes the cache if entries were added or removed
+func (c *ProcessorInfoCache) Save() error {
+	if c == nil || !c.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode processor info cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write processor info cache: %w", err)
+	}
+	c.changed = false
+	return nil
+}
@@ -0,0 +1,244 @@
+// processor_repos.go
+package autopkg
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// ProcessorRepo declares a shared processor repository the recipes depend on,
+// e.g. grahampugh/jamf-upload for the JamfUploader processors
+type ProcessorRepo struct {
+	Repo       string   `yaml:"repo"`          // owner/name shorthand or clone URL
+	Ref        string   `yaml:"ref,omitempty"` // Tag, branch or commit to pin, empty keeps the default branch
+	Processors []string `yaml:"processors"`    // Processors that must exist, by name or path without .py
+}
+
+// ProcessorReposOptions contains options for vendoring shared processor repositories
+type ProcessorReposOptions struct {
+	PrefsPath       string
+	RepoDir         string // Directory to clone into, defaults to RECIPE_REPO_DIR or ~/Library/AutoPkg/RecipeRepos
+	SkipPrefsUpdate bool   // Do not register the repos in RECIPE_REPOS
+}
+
+// ProcessorRepoResult contains the outcome of vendoring a single processor repository
+type ProcessorRepoResult struct {
+	Repo    string
+	Path    string
+	Ref     string
+	Commit  string
+	Missing []string // Declared processors without a matching file
+	Error   error
+}
+
+// LoadProcessorRepos reads processor repository declarations from a YAML file
+// with a processor_repos list
+func LoadProcessorRepos(path string) ([]ProcessorRepo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processor repos file: %w", err)
+	}
+
+	var config struct {
+		ProcessorRepos []ProcessorRepo `yaml:"processor_repos"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse processor repos file: %w", err)
+	}
+
+	for _, repo := range config.ProcessorRepos {
+		if repo.Repo == "" {
+			return nil, fmt.Errorf("processor repo entry without repo in %s", path)
+		}
+		if len(repo.Processors) == 0 {
+			return nil, fmt.Errorf("processor repo %s declares no processors in %s", repo.Repo, path)
+		}
+	}
+
+	return config.ProcessorRepos, nil
+}
+
+// EnsureProcessorRepos clones every declared processor repository, checks out
+// its pinned ref and verifies the declared processor files exist, so a missing
+// processor fails setup instead of a recipe run hours later.
+func EnsureProcessorRepos(repos []ProcessorRepo, options *ProcessorReposOptions) ([]ProcessorRepoResult, error) {
+	if options == nil {
+		options = &ProcessorReposOptions{}
+	}
+
+	if options.RepoDir == "" {
+		options.RepoDir = recipeRepoDir(options.PrefsPath)
+	}
+
+	if err := os.MkdirAll(options.RepoDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recipe repo directory: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("🧩 Vendoring %d shared processor repositories", len(repos)), logger.LogInfo)
+
+	var results []ProcessorRepoResult
+	var problems []string
+	recipeRepos := make(map[string]interface{})
+	var searchDirs []string
+
+	for _, repo := range repos {
+		result := ensureProcessorRepo(repo, options)
+		results = append(results, result)
+
+		if result.Error != nil {
+			logger.Logger(fmt.Sprintf("❌ %s: %v", repo.Repo, result.Error), logger.LogError)
+			problems = append(problems, fmt.Sprintf("%s: %v", repo.Repo, result.Error))
+			continue
+		}
+
+		recipeRepos[result.Path] = map[string]interface{}{"URL": ResolveRepoURL(repo.Repo)}
+		searchDirs = append(searchDirs, result.Path)
+
+		if len(result.Missing) > 0 {
+			logger.Logger(fmt.Sprintf("❌ %s at %s is missing processors: %s", repo.Repo, processorRepoRevision(result), strings.Join(result.Missing, ", ")), logger.LogError)
+			problems = append(problems, fmt.Sprintf("%s at %s does not provide %s; check the processor names or pin a ref that contains them",
+				repo.Repo, processorRepoRevision(result), strings.Join(result.Missing, ", ")))
+			continue
+		}
+
+		logger.Logger(fmt.Sprintf("✅ %s at %s provides %d processors", repo.Repo, processorRepoRevision(result), len(repo.Processors)), logger.LogSuccess)
+	}
+
+	if !options.SkipPrefsUpdate && len(recipeRepos) > 0 {
+		if err := registerRecipeRepos(options.PrefsPath, recipeRepos, searchDirs); err != nil {
+			return results, err
+		}
+	}
+
+	if len(problems) > 0 {
+		return results, fmt.Errorf("shared processor check failed:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return results, nil
+}
+
+// ensureProcessorRepo clones and pins a single processor repository and checks its processors
+func ensureProcessorRepo(repo ProcessorRepo, options *ProcessorReposOptions) ProcessorRepoResult {
+	// A pinned ref may be anywhere in the history, so shallow clones are only used for the default branch
+	clone := cloneRepo(repo.Repo, &CloneReposOptions{
+		RepoDir:   options.RepoDir,
+		FullClone: repo.Ref != "",
+	})
+
+	result := ProcessorRepoResult{
+		Repo: repo.Repo,
+		Path: clone.Path,
+		Ref:  repo.Ref,
+	}
+	if clone.Error != nil {
+		result.Error = fmt.Errorf("%w (check the repo name and that it is reachable)", clone.Error)
+		return result
+	}
+
+	if repo.Ref != "" {
+		commit, err := resolveRepoRef(clone.Path, repo.Ref)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		if err := restoreRepo(RepoLockEntry{Path: clone.Path, URL: clone.URL, Commit: commit}, clone.Path); err != nil {
+			result.Error = fmt.Errorf("failed to check out %s: %w", repo.Ref, err)
+			return result
+		}
+	}
+
+	if output, err := exec.Command("git", "-C", clone.Path, "rev-parse", "HEAD").Output(); err == nil {
+		result.Commit = strings.TrimSpace(string(output))
+	}
+
+	found, err := findProcessorFiles(clone.Path)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	for _, processor := range repo.Processors {
+		if !found[strings.TrimSuffix(processor, ".py")] {
+			result.Missing = append(result.Missing, processor)
+		}
+	}
+
+	return result
+}
+
+// resolveRepoRef resolves a tag, branch or commit to a commit SHA, fetching
+// from origin when the ref is not known locally
+func resolveRepoRef(repoDir string, ref string) (string, error) {
+	resolve := func() (string, bool) {
+		for _, candidate := range []string{ref, "origin/" + ref} {
+			output, err := exec.Command("git", "-C", repoDir, "rev-parse", "--verify", "--quiet", candidate+"^{commit}").Output()
+			if err == nil {
+				return strings.TrimSpace(string(output)), true
+			}
+		}
+		return "", false
+	}
+
+	if commit, ok := resolve(); ok {
+		return commit, nil
+	}
+
+	if err := requireNetwork(fmt.Sprintf("fetch ref %s", ref), "it isn't in the local clone"); err != nil {
+		return "", err
+	}
+	if output, err := exec.Command("git", "-C", repoDir, "fetch", "--quiet", "--tags", "origin").CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git fetch failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if commit, ok := resolve(); ok {
+		return commit, nil
+	}
+	return "", fmt.Errorf("ref %s not found (check that the tag, branch or commit exists on the remote)", ref)
+}
+
+// findProcessorFiles indexes the Python files of a repository by file name and
+// by path relative to the repository, both without the .py extension
+func findProcessorFiles(repoDir string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	err := filepath.WalkDir(repoDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(entry.Name(), ".py") {
+			return nil
+		}
+
+		found[strings.TrimSuffix(entry.Name(), ".py")] = true
+		if rel, err := filepath.Rel(repoDir, path); err == nil {
+			found[strings.TrimSuffix(filepath.ToSlash(rel), ".py")] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan processor repo: %w", err)
+	}
+	return found, nil
+}
+
+// processorRepoRevision describes the checked out revision of a processor repo for messages
+func processorRepoRevision(result ProcessorRepoResult) string {
+	if result.Ref != "" {
+		return fmt.Sprintf("%s (%s)", result.Ref, shortSHA(result.Commit))
+	}
+	if result.Commit != "" {
+		return shortSHA(result.Commit)
+	}
+	return "HEAD"
+}
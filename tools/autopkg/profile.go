@@ -0,0 +1,208 @@
+// profile.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+	"howett.net/plist"
+)
+
+// Profile is a named set of AutoPkg preferences, override directory and
+// credentials, so one runner can serve several MDM tenants without their
+// settings leaking into each other. Credentials live in the profile's own
+// preferences file, written with configure --profile.
+type Profile struct {
+	Name        string    `json:"name" yaml:"name"`
+	Description string    `json:"description,omitempty" yaml:"description,omitempty"`
+	PrefsPath   string    `json:"prefs" yaml:"prefs"`
+	OverrideDir string    `json:"override_dir" yaml:"override_dir"`
+	Created     time.Time `json:"created" yaml:"created"`
+}
+
+// ProfileOptions contains options for creating a profile
+type ProfileOptions struct {
+	Description string
+	FromPrefs   string // Preferences file to copy settings from, defaults to an empty file
+	OverrideDir string // Defaults to the overrides directory within the profile
+	Production  bool   // Flag the profile's preferences as targeting production
+}
+
+// profileNamePattern restricts profile names to safe directory names
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// profilesDir returns the directory holding profiles within the state directory
+func profilesDir(stateDir string) string {
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+	return filepath.Join(stateDir, "profiles")
+}
+
+// profilePath returns the path of a profile's definition file
+func profilePath(stateDir string, name string) string {
+	return filepath.Join(profilesDir(stateDir), name, "profile.yaml")
+}
+
+// currentProfilePath returns the path of the file naming the current profile
+func currentProfilePath(stateDir string) string {
+	return filepath.Join(profilesDir(stateDir), "current")
+}
+
+// CreateProfile creates a named profile with its own preferences file and
+// override directory. Settings copied from another preferences file keep their
+// credentials, but the override directory always points at the profile's own.
+func CreateProfile(stateDir string, name string, options *ProfileOptions) (*Profile, error) {
+	if options == nil {
+		options = &ProfileOptions{}
+	}
+	if !profileNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid profile name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	if _, err := os.Stat(profilePath(stateDir, name)); err == nil {
+		return nil, fmt.Errorf("profile %s already exists", name)
+	}
+
+	dir := filepath.Join(profilesDir(stateDir), name)
+	profile := &Profile{
+		Name:        name,
+		Description: options.Description,
+		PrefsPath:   filepath.Join(dir, "com.github.autopkg.plist"),
+		OverrideDir: options.OverrideDir,
+		Created:     time.Now().UTC(),
+	}
+	if profile.OverrideDir == "" {
+		profile.OverrideDir = filepath.Join(dir, "RecipeOverrides")
+	} else {
+		profile.OverrideDir = expandTilde(profile.OverrideDir)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	if err := os.MkdirAll(profile.OverrideDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create override directory: %w", err)
+	}
+
+	prefs := make(map[string]interface{})
+	if options.FromPrefs != "" {
+		existing, err := GetAutoPkgPreferences(expandTilde(options.FromPrefs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read preferences to copy: %w", err)
+		}
+		for key, value := range existing {
+			prefs[key] = value
+		}
+		delete(prefs, ProductionPrefsKey)
+	}
+	prefs[overrideDirsPrefsKey] = []interface{}{profile.OverrideDir}
+	if options.Production {
+		prefs[ProductionPrefsKey] = true
+	}
+
+	// The preferences hold the profile's credentials, so only the owner can read them
+	data, err := plist.MarshalIndent(prefs, plist.XMLFormat, "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal plist: %w", err)
+	}
+	if err := os.WriteFile(profile.PrefsPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write preferences file: %w", err)
+	}
+	if err := saveProfile(stateDir, profile); err != nil {
+		return nil, err
+	}
+
+	logger.Logger(fmt.Sprintf("✅ Created profile %s with preferences %s", name, profile.PrefsPath), logger.LogSuccess)
+	return profile, nil
+}
+
+// saveProfile writes a profile's definition file
+func saveProfile(stateDir string, profile *Profile) error {
+	data, err := yaml.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile: %w", err)
+	}
+	path := profilePath(stateDir, profile.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	return nil
+}
+
+// LoadProfile reads a named profile
+func LoadProfile(stateDir string, name string) (*Profile, error) {
+	data, err := os.ReadFile(profilePath(stateDir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("profile %s does not exist, create it with autopkgctl profile create", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile %s: %w", name, err)
+	}
+
+	var profile Profile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %s: %w", name, err)
+	}
+	return &profile, nil
+}
+
+// ListProfiles returns every profile, sorted by name
+func ListProfiles(stateDir string) ([]*Profile, error) {
+	entries, err := os.ReadDir(profilesDir(stateDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles directory: %w", err)
+	}
+
+	var profiles []*Profile
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		profile, err := LoadProfile(stateDir, entry.Name())
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Skipping profile %s: %v", entry.Name(), err), logger.LogWarning)
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// SwitchProfile makes a profile the one used when --profile and --prefs aren't given
+func SwitchProfile(stateDir string, name string) (*Profile, error) {
+	profile, err := LoadProfile(stateDir, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(currentProfilePath(stateDir), []byte(name+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to switch profile: %w", err)
+	}
+	return profile, nil
+}
+
+// CurrentProfile returns the name of the profile switched to, or an empty string for none
+func CurrentProfile(stateDir string) (string, error) {
+	data, err := os.ReadFile(currentProfilePath(stateDir))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read current profile: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
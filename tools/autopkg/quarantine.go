@@ -0,0 +1,453 @@
+// quarantine.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// SkipReasonQuarantined marks upload recipes whose build was held in
+// quarantine for approval instead of being uploaded
+const SkipReasonQuarantined = "quarantined"
+
+// Statuses of a quarantine entry
+const (
+	QuarantinePending  = "pending"
+	QuarantineReleased = "released"
+	QuarantineRejected = "rejected"
+)
+
+// QuarantinedArtifact is an artifact staged in the quarantine directory
+type QuarantinedArtifact struct {
+	Path   string `json:"path"`   // Staged copy, passed to the upload recipe on release
+	Source string `json:"source"` // Where the package recipe built it
+	Type   string `json:"type"`
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// QuarantineEntry is a build of an upload recipe held for approval. Its
+// package recipe ran and its artifacts were staged, and the upload recipe
+// runs with them when the entry is released.
+type QuarantineEntry struct {
+	ID            string                `json:"id"` // App==version, as passed to release --approve
+	App           string                `json:"app"`
+	Version       string                `json:"version"`
+	Recipe        string                `json:"recipe"`         // Upload recipe run on release
+	PackageRecipe string                `json:"package_recipe"` // Parent recipe that built the artifacts
+	RunID         string                `json:"run_id"`
+	StagedAt      time.Time             `json:"staged_at"`
+	Artifacts     []QuarantinedArtifact `json:"artifacts"`
+	Status        string                `json:"status"`               // QuarantinePending, QuarantineReleased or QuarantineRejected
+	DecidedBy     string                `json:"decided_by,omitempty"` // Who released or rejected the entry
+	DecidedAt     time.Time             `json:"decided_at,omitempty"`
+	ReleaseRunID  string                `json:"release_run_id,omitempty"`
+
+	ApprovalRequest   string    `json:"approval_request,omitempty"` // Where approval was asked for, e.g. owner/name#123 for GitHubApproval
+	ApprovalRequested time.Time `json:"approval_requested,omitempty"`
+}
+
+// QuarantineManifest lists the builds held in quarantine and what became of them
+type QuarantineManifest struct {
+	Entries []*QuarantineEntry `json:"entries"`
+
+	path string
+}
+
+// QuarantineDir returns the directory builds are staged to within the state directory
+func QuarantineDir(stateDir string) string {
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+	return filepath.Join(stateDir, "quarantine")
+}
+
+// QuarantineID returns the entry ID of an app version, e.g. Firefox==128.0
+func QuarantineID(app, version string) string {
+	return app + "==" + version
+}
+
+// LoadQuarantine reads the quarantine manifest of a state directory, empty
+// when nothing was ever quarantined
+func LoadQuarantine(stateDir string) (*QuarantineManifest, error) {
+	manifest := &QuarantineManifest{path: filepath.Join(QuarantineDir(stateDir), "quarantine.json")}
+	data, err := os.ReadFile(manifest.path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse quarantine manifest %s: %w", manifest.path, err)
+	}
+	return manifest, nil
+}
+
+// Save writes the quarantine manifest back to its state directory
+func (m *QuarantineManifest) Save() error {
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantine manifest: %w", err)
+	}
+	if err := os.WriteFile(m.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write quarantine manifest: %w", err)
+	}
+	return nil
+}
+
+// Pending returns the entries awaiting a decision, oldest first
+func (m *QuarantineManifest) Pending() []*QuarantineEntry {
+	var pending []*QuarantineEntry
+	for _, entry := range m.Entries {
+		if entry.Status == QuarantinePending {
+			pending = append(pending, entry)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].StagedAt.Before(pending[j].StagedAt) })
+	return pending
+}
+
+// Find returns the pending entry with an ID, matching the app name case
+// insensitively. An app name alone matches its only pending version.
+func (m *QuarantineManifest) Find(id string) (*QuarantineEntry, error) {
+	app, version, versioned := strings.Cut(id, "==")
+	var matches []*QuarantineEntry
+	for _, entry := range m.Pending() {
+		if strings.EqualFold(entry.App, strings.TrimSpace(app)) && (!versioned || entry.Version == strings.TrimSpace(version)) {
+			matches = append(matches, entry)
+		}
+	}
+
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) == 0:
+		return nil, fmt.Errorf("nothing pending in quarantine for %s", id)
+	default:
+		versions := make([]string, len(matches))
+		for i, entry := range matches {
+			versions[i] = entry.ID
+		}
+		return nil, fmt.Errorf("%s has %d versions pending, pick one of %s", id, len(matches), strings.Join(versions, ", "))
+	}
+}
+
+// stage copies a package recipe's artifacts into the quarantine directory as
+// a pending entry for an upload recipe, replacing a pending entry of the same
+// version
+func (m *QuarantineManifest) stage(recipe, packageRecipe, runID string, artifacts []ProducedArtifact) (*QuarantineEntry, error) {
+	app, version := artifactAppName(recipe, "", ""), ""
+	for _, artifact := range artifacts {
+		if artifact.Version != "" {
+			version = artifact.Version
+			break
+		}
+	}
+	if version == "" {
+		version = runID
+	}
+
+	entry := &QuarantineEntry{
+		ID:            QuarantineID(app, version),
+		App:           app,
+		Version:       version,
+		Recipe:        recipe,
+		PackageRecipe: packageRecipe,
+		RunID:         runID,
+		StagedAt:      time.Now().UTC(),
+		Status:        QuarantinePending,
+	}
+
+	dir := filepath.Join(filepath.Dir(m.path), sanitizeListName(app), sanitizeListName(version))
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to clear %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	for _, artifact := range artifacts {
+		staged := QuarantinedArtifact{
+			Path:   filepath.Join(dir, filepath.Base(artifact.Path)),
+			Source: artifact.Path,
+			Type:   artifact.Type,
+		}
+		if err := copyTree(artifact.Path, staged.Path); err != nil {
+			return nil, fmt.Errorf("failed to stage %s: %w", artifact.Path, err)
+		}
+		// Bundle packages are directories, which aren't checksummed
+		if info, err := os.Stat(staged.Path); err == nil && !info.IsDir() {
+			if staged.SHA256, staged.Size, err = fileSHA256(staged.Path); err != nil {
+				return nil, err
+			}
+		}
+		entry.Artifacts = append(entry.Artifacts, staged)
+	}
+
+	kept := m.Entries[:0]
+	for _, existing := range m.Entries {
+		if existing.ID != entry.ID || existing.Status != QuarantinePending {
+			kept = append(kept, existing)
+		}
+	}
+	m.Entries = append(kept, entry)
+	return entry, nil
+}
+
+// releasePackage returns the staged artifact the upload recipe is run with,
+// checking it wasn't changed while it waited for approval
+func (e *QuarantineEntry) releasePackage() (string, error) {
+	var chosen *QuarantinedArtifact
+	for i, artifact := range e.Artifacts {
+		if artifact.Type == "pkg" || (chosen == nil && artifact.Type == "dmg") {
+			chosen = &e.Artifacts[i]
+		}
+	}
+	if chosen == nil {
+		return "", fmt.Errorf("%s has no staged pkg or dmg to upload", e.ID)
+	}
+
+	if chosen.SHA256 != "" {
+		checksum, _, err := fileSHA256(chosen.Path)
+		if err != nil {
+			return "", err
+		}
+		if checksum != chosen.SHA256 {
+			return "", fmt.Errorf("%s changed in quarantine, its SHA256 is %s instead of %s", chosen.Path, checksum, chosen.SHA256)
+		}
+	}
+	return chosen.Path, nil
+}
+
+// removeStaged deletes the staged copies of an entry's artifacts
+func (e *QuarantineEntry) removeStaged() {
+	if len(e.Artifacts) == 0 {
+		return
+	}
+	dir := filepath.Dir(e.Artifacts[0].Path)
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to remove quarantined artifacts of %s: %v", e.ID, err), logger.LogWarning)
+	}
+}
+
+// quarantines reports whether an upload recipe's builds are held for approval
+func (o *RecipeBatchRunOptions) quarantines(recipe string) bool {
+	if recipeUploadType(recipe) == "" || o.releases[recipe] != "" {
+		return false
+	}
+	if o.Quarantine {
+		return true
+	}
+	overrides := o.recipeOverrides(recipe)
+	return overrides != nil && overrides.Quarantine
+}
+
+// quarantineRecipes swaps the upload recipes of a batch that are held for
+// approval for the recipe building their package, e.g. Firefox.pkg for
+// Firefox.jamf, which stageQuarantine stages after the batch. Upload recipes
+// without a package parent fail rather than upload unapproved.
+func (o *RecipeBatchRunOptions) quarantineRecipes(recipes []string, results map[string]*RecipeBatchResult) []string {
+	resolver := &recipeParentResolver{options: o}
+	o.quarantined = make(map[string]string)
+
+	var swapped []string
+	seen := make(map[string]bool)
+	for _, recipe := range recipes {
+		if !o.quarantines(recipe) {
+			if !seen[recipe] {
+				seen[recipe] = true
+				swapped = append(swapped, recipe)
+			}
+			continue
+		}
+
+		packageRecipe := packageParent(resolver.parents(recipe))
+		if packageRecipe == "" {
+			err := fmt.Errorf("%s is quarantined but has no package recipe in its parent chain to build with", recipe)
+			logger.Logger(fmt.Sprintf("❌ %v", err), logger.LogError)
+			results[recipe] = &RecipeBatchResult{Recipe: recipe, Output: err.Error(), ExecutionError: err, Status: "failed"}
+			continue
+		}
+
+		logger.Logger(fmt.Sprintf("🧪 %s is quarantined, running %s and holding what it builds for approval", recipe, packageRecipe), logger.LogInfo)
+		o.quarantined[recipe] = packageRecipe
+		if !seen[packageRecipe] {
+			seen[packageRecipe] = true
+			swapped = append(swapped, packageRecipe)
+		}
+	}
+	return swapped
+}
+
+// packageParent returns the parent recipe that builds the package of an
+// upload recipe: the nearest .pkg recipe, or else the nearest parent that
+// doesn't upload
+func packageParent(parents []string) string {
+	for _, parent := range parents {
+		if recipeTypeFromName(recipeBaseName(parent)) == "pkg" {
+			return normalizeRecipeNames([]string{parent})[0]
+		}
+	}
+	for _, parent := range parents {
+		if recipeUploadType(parent) == "" {
+			return normalizeRecipeNames([]string{parent})[0]
+		}
+	}
+	return ""
+}
+
+// stageQuarantine stages the builds of the package recipes run for
+// quarantined upload recipes, recording each upload recipe as skipped with
+// the entry awaiting approval
+func (o *RecipeBatchRunOptions) stageQuarantine(results map[string]*RecipeBatchResult) {
+	if len(o.quarantined) == 0 {
+		return
+	}
+	manifest, err := LoadQuarantine(o.StateDir)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ %v", err), logger.LogWarning)
+		return
+	}
+
+	staged := 0
+	for recipe, packageRecipe := range o.quarantined {
+		result := &RecipeBatchResult{Recipe: recipe, TrustVerified: true, Status: "skipped", SkipReason: SkipReasonQuarantined}
+		results[recipe] = result
+
+		built := results[packageRecipe]
+		switch {
+		case built == nil || built.Status != "updated":
+			result.Output = fmt.Sprintf("%s built nothing new to hold", packageRecipe)
+			continue
+		case len(built.Artifacts) == 0:
+			result.Output = fmt.Sprintf("%s reported no artifacts to hold", packageRecipe)
+			logger.Logger(fmt.Sprintf("⚠️ %s built a new version but its report lists no artifacts, run with --report to quarantine %s", packageRecipe, recipe), logger.LogWarning)
+			continue
+		}
+
+		entry, err := manifest.stage(recipe, packageRecipe, o.RunID, built.Artifacts)
+		if err != nil {
+			result.Status = "failed"
+			result.ExecutionError = fmt.Errorf("failed to quarantine %s: %w", recipe, err)
+			result.Output = result.ExecutionError.Error()
+			logger.Logger(fmt.Sprintf("❌ %v", result.ExecutionError), logger.LogError)
+			continue
+		}
+		staged++
+		result.Artifacts = built.Artifacts
+		result.Output = fmt.Sprintf("%s held in quarantine, release with: autopkgctl release --approve %s", entry.ID, entry.ID)
+		logger.Logger(fmt.Sprintf("🧪 %s", result.Output), logger.LogInfo)
+	}
+
+	if staged == 0 {
+		return
+	}
+	if err := manifest.Save(); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ %v", err), logger.LogWarning)
+	}
+}
+
+// ReleaseQuarantined runs the upload recipes of pending quarantine entries
+// with their staged artifacts, passed to autopkg with --pkg. Approvals map
+// entry IDs to who approved them. Entries whose upload recipe succeeds are
+// marked released and their staged copies removed; the rest stay pending.
+func ReleaseQuarantined(approvals map[string]string, options *RecipeBatchRunOptions) (map[string]*RecipeBatchResult, error) {
+	if options == nil {
+		options = &RecipeBatchRunOptions{}
+	}
+	manifest, err := LoadQuarantine(options.StateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	options.releases = make(map[string]string)
+	entries := make(map[string]*QuarantineEntry)
+	approvers := make(map[string]string)
+	var recipes []string
+	for _, id := range decisionIDs(approvals) {
+		entry, err := manifest.Find(id)
+		if err != nil {
+			return nil, err
+		}
+		if entries[entry.Recipe] != nil {
+			return nil, fmt.Errorf("%s and %s both release %s, approve one at a time", entries[entry.Recipe].ID, entry.ID, entry.Recipe)
+		}
+		pkg, err := entry.releasePackage()
+		if err != nil {
+			return nil, err
+		}
+		logger.Logger(fmt.Sprintf("🔓 Releasing %s from run %s with %s", entry.ID, entry.RunID, entry.Recipe), logger.LogInfo)
+		options.releases[entry.Recipe] = pkg
+		entries[entry.Recipe] = entry
+		approvers[entry.Recipe] = approvals[id]
+		recipes = append(recipes, entry.Recipe)
+	}
+
+	results, runErr := RunRecipeBatch(strings.Join(recipes, ","), options)
+	for recipe, entry := range entries {
+		result := results[recipe]
+		if result == nil || result.ExecutionError != nil || result.Status == "skipped" || result.Status == StatusBlocked {
+			logger.Logger(fmt.Sprintf("⚠️ %s wasn't uploaded and stays in quarantine", entry.ID), logger.LogWarning)
+			continue
+		}
+		entry.Status = QuarantineReleased
+		entry.DecidedBy = approvers[recipe]
+		entry.DecidedAt = time.Now().UTC()
+		entry.ReleaseRunID = options.RunID
+		entry.removeStaged()
+	}
+	if err := manifest.Save(); err != nil {
+		return results, err
+	}
+	return results, runErr
+}
+
+// RejectQuarantined drops pending quarantine entries without uploading them,
+// removing their staged artifacts. Rejections map entry IDs to who rejected them.
+func RejectQuarantined(stateDir string, rejections map[string]string) ([]*QuarantineEntry, error) {
+	manifest, err := LoadQuarantine(stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var rejected []*QuarantineEntry
+	for _, id := range decisionIDs(rejections) {
+		entry, err := manifest.Find(id)
+		if err != nil {
+			return nil, err
+		}
+		entry.Status = QuarantineRejected
+		entry.DecidedBy = rejections[id]
+		entry.DecidedAt = time.Now().UTC()
+		rejected = append(rejected, entry)
+	}
+
+	if err := manifest.Save(); err != nil {
+		return nil, err
+	}
+	for _, entry := range rejected {
+		entry.removeStaged()
+		logger.Logger(fmt.Sprintf("🗑️ Rejected %s", entry.ID), logger.LogInfo)
+	}
+	return rejected, nil
+}
+
+// decisionIDs returns the entry IDs of approvals or rejections, sorted
+func decisionIDs(decisions map[string]string) []string {
+	ids := make([]string, 0, len(decisions))
+	for id := range decisions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
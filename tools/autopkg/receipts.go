@@ -0,0 +1,381 @@
+// receipts.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Upload phases a receipt can be issued for
+const (
+	ReceiptPhaseMDM      = "mdm"
+	ReceiptPhaseArtifact = "artifact"
+)
+
+// SkipReasonReceipted marks upload recipes whose version already has a receipt
+// for every tenant they upload to
+const SkipReasonReceipted = "receipted"
+
+// historyReceiptsBucket holds upload receipts keyed by ReceiptKey
+var historyReceiptsBucket = []byte("receipts")
+
+// UploadReceipt records that a recipe version was uploaded to a tenant, so a
+// re-run of the same batch can skip work that already reached its destination
+type UploadReceipt struct {
+	Key        string    `json:"key"`
+	Phase      string    `json:"phase"`
+	Recipe     string    `json:"recipe"`
+	Version    string    `json:"version"`
+	Tenant     string    `json:"tenant"`
+	RunID      string    `json:"run_id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Location   string    `json:"location,omitempty"`    // Object key for artifact uploads
+	Package    string    `json:"package,omitempty"`     // Package or app name in the MDM, for MDM uploads
+	Policy     string    `json:"policy,omitempty"`      // Jamf Pro policy deploying the package
+	RolledBack bool      `json:"rolled_back,omitempty"` // Whether the tenant was rolled back from this version
+}
+
+// ReceiptKey returns the idempotency key for a (phase, tenant, recipe, version) tuple
+func ReceiptKey(phase, tenant, recipe, version string) string {
+	return strings.Join([]string{phase, tenant, recipe, version}, "|")
+}
+
+// RecordReceipt stores an upload receipt, replacing any receipt with the same key
+func (h *History) RecordReceipt(receipt UploadReceipt) error {
+	receipt.Key = ReceiptKey(receipt.Phase, receipt.Tenant, receipt.Recipe, receipt.Version)
+	if receipt.Timestamp.IsZero() {
+		receipt.Timestamp = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return fmt.Errorf("failed to marshal receipt: %w", err)
+	}
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(historyReceiptsBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create receipts bucket: %w", err)
+		}
+		return bucket.Put([]byte(receipt.Key), data)
+	})
+}
+
+// Receipt returns the receipt for a (phase, tenant, recipe, version) tuple, or nil if none was issued
+func (h *History) Receipt(phase, tenant, recipe, version string) (*UploadReceipt, error) {
+	var receipt *UploadReceipt
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyReceiptsBucket)
+		if bucket == nil {
+			return nil
+		}
+		data := bucket.Get([]byte(ReceiptKey(phase, tenant, recipe, version)))
+		if data == nil {
+			return nil
+		}
+		receipt = &UploadReceipt{}
+		return json.Unmarshal(data, receipt)
+	})
+	return receipt, err
+}
+
+// RunReceipts returns every receipt issued during a run
+func (h *History) RunReceipts(runID string) ([]UploadReceipt, error) {
+	var receipts []UploadReceipt
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyReceiptsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var receipt UploadReceipt
+			if err := json.Unmarshal(value, &receipt); err != nil {
+				return fmt.Errorf("failed to parse receipt %s: %w", key, err)
+			}
+			if receipt.RunID == runID {
+				receipts = append(receipts, receipt)
+			}
+			return nil
+		})
+	})
+	return receipts, err
+}
+
+// UploadTenant identifies the MDM tenant an upload destination refers to,
+// using the integration's tenant preferences, e.g. the Jamf Pro URL
+func UploadTenant(prefsPath string, destination string) string {
+	integration := Integration(destination)
+	if integration == nil {
+		return destination
+	}
+	prefs, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		return destination
+	}
+	if tenant := integration.Tenant(prefs); tenant != "" {
+		return tenant
+	}
+	return destination
+}
+
+// recordUploadReceipts issues a receipt for every MDM upload in the batch
+// results, against the tenant of each target for recipes fanned out to targets
+func recordUploadReceipts(history *History, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult) {
+	type upload struct {
+		UploadedArtifact
+		prefsPath string
+	}
+
+	tenants := make(map[string]string)
+	for recipe, result := range results {
+		var uploads []upload
+		if len(result.Targets) > 0 {
+			for _, target := range result.Targets {
+				for _, artifact := range target.Uploads {
+					uploads = append(uploads, upload{artifact, target.PrefsPath})
+				}
+			}
+		} else {
+			for _, artifact := range result.Uploads {
+				uploads = append(uploads, upload{artifact, options.prefsPathFor(recipe)})
+			}
+		}
+
+		for _, upload := range uploads {
+			if upload.Version == "" {
+				continue
+			}
+
+			prefsPath := upload.prefsPath
+			tenantKey := prefsPath + "|" + upload.Destination
+			tenant, ok := tenants[tenantKey]
+			if !ok {
+				tenant = UploadTenant(prefsPath, upload.Destination)
+				tenants[tenantKey] = tenant
+			}
+
+			err := history.RecordReceipt(UploadReceipt{
+				Phase:   ReceiptPhaseMDM,
+				Recipe:  recipe,
+				Version: upload.Version,
+				Tenant:  tenant,
+				RunID:   options.RunID,
+				Package: upload.Package,
+				Policy:  upload.Policy,
+			})
+			if err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Failed to record upload receipt for %s: %v", recipe, err), logger.LogWarning)
+			}
+		}
+	}
+}
+
+// receiptedRecipes returns the recipes whose MDM uploads in a previous run
+// already have receipts for the tenants configured in their preferences
+func receiptedRecipes(options *RecipeBatchRunOptions, runID string) (map[string]UploadReceipt, error) {
+	historyPath := options.HistoryPath
+	if historyPath == "" {
+		historyPath = DefaultHistoryPath(options.StateDir)
+	}
+
+	history, err := OpenHistory(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer history.Close()
+
+	receipts, err := history.RunReceipts(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	byRecipe := make(map[string][]UploadReceipt)
+	for _, receipt := range receipts {
+		if receipt.Phase == ReceiptPhaseMDM {
+			byRecipe[receipt.Recipe] = append(byRecipe[receipt.Recipe], receipt)
+		}
+	}
+
+	// Recipes with their own preferences may upload to a different tenant, and
+	// recipes fanned out to targets count only once every target has a receipt
+	receipted := make(map[string]UploadReceipt)
+	for recipe, recipeReceipts := range byRecipe {
+		prefsPaths := options.uploadPrefsPaths(recipe)
+		var matched []UploadReceipt
+		for _, prefsPath := range prefsPaths {
+			tenants := make(map[string]bool)
+			for _, integration := range Integrations() {
+				tenants[UploadTenant(prefsPath, integration.Name())] = true
+			}
+			for _, receipt := range recipeReceipts {
+				if tenants[receipt.Tenant] {
+					matched = append(matched, receipt)
+					break
+				}
+			}
+		}
+		if len(matched) > 0 && len(matched) == len(prefsPaths) {
+			receipted[recipe] = matched[0]
+		}
+	}
+	return receipted, nil
+}
+
+// loadUploadReceipts marks the upload recipes of a batch that were uploaded
+// in an earlier run, which gateUpload checks before they upload again. Recipes never uploaded have nothing to check, so they aren't built
+// ahead of their upload.
+func (o *RecipeBatchRunOptions) loadUploadReceipts(recipes []string) {
+	o.receipted = nil
+
+	var uploads []string
+	for _, recipe := range recipes {
+		if recipeUploadType(recipe) != "" && o.releases[recipe] == "" {
+			uploads = append(uploads, recipe)
+		}
+	}
+	if len(uploads) == 0 {
+		return
+	}
+
+	historyPath := o.HistoryPath
+	if historyPath == "" {
+		historyPath = DefaultHistoryPath(o.StateDir)
+	}
+	history, err := OpenHistory(historyPath)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Upload receipts unavailable, uploading without checking them: %v", err), logger.LogWarning)
+		return
+	}
+	defer history.Close()
+
+	receipts, err := history.Receipts()
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Upload receipts unavailable, uploading without checking them: %v", err), logger.LogWarning)
+		return
+	}
+	uploaded := make(map[string]bool)
+	for _, receipt := range receipts {
+		if receipt.Phase == ReceiptPhaseMDM {
+			uploaded[receipt.Recipe] = true
+		}
+	}
+
+	for _, recipe := range uploads {
+		if uploaded[recipe] {
+			if o.receipted == nil {
+				o.receipted = make(map[string]bool)
+			}
+			o.receipted[recipe] = true
+		}
+	}
+}
+
+// skipReceiptedUpload returns a skipped result for an upload recipe when the
+// version its package parent built, or else last built, has a receipt for
+// every tenant the recipe uploads to, and nil when the recipe should upload
+func (o *RecipeBatchRunOptions) skipReceiptedUpload(recipe string, artifacts []ProducedArtifact) *RecipeBatchResult {
+	historyPath := o.HistoryPath
+	if historyPath == "" {
+		historyPath = DefaultHistoryPath(o.StateDir)
+	}
+	history, err := OpenHistory(historyPath)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to check upload receipts of %s: %v", recipe, err), logger.LogWarning)
+		return nil
+	}
+	defer history.Close()
+
+	version := uploadVersion(history, recipe, artifacts)
+	if version == "" {
+		return nil
+	}
+
+	var receipts []*UploadReceipt
+	for _, prefsPath := range o.uploadPrefsPaths(recipe) {
+		var found *UploadReceipt
+		for _, integration := range Integrations() {
+			receipt, err := history.Receipt(ReceiptPhaseMDM, UploadTenant(prefsPath, integration.Name()), recipe, version)
+			if err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Failed to check upload receipts of %s: %v", recipe, err), logger.LogWarning)
+				return nil
+			}
+			if receipt != nil {
+				found = receipt
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		receipts = append(receipts, found)
+	}
+	if len(receipts) == 0 {
+		return nil
+	}
+
+	receipt := receipts[0]
+	logger.Logger(fmt.Sprintf("🧾 Skipping %s: version %s already uploaded to %s in run %s", recipe, version, receipt.Tenant, receipt.RunID), logger.LogInfo)
+	// Carrying the upload forward re-issues the receipt under this run, so a re-run of it skips the recipe too
+	return &RecipeBatchResult{
+		Recipe:        recipe,
+		Output:        fmt.Sprintf("version %s already uploaded to %s in run %s", version, receipt.Tenant, receipt.RunID),
+		TrustVerified: true,
+		Status:        "skipped",
+		SkipReason:    SkipReasonReceipted,
+		Uploads:       []UploadedArtifact{{Recipe: recipe, Version: version, Destination: recipeUploadType(recipe)}},
+	}
+}
+
+// uploadVersion returns the version an upload recipe would upload: that of
+// what its package parent built. A package parent that built nothing new
+// leaves the package of the recipe's last build in place, so that build's
+// version is used.
+func uploadVersion(history *History, recipe string, artifacts []ProducedArtifact) string {
+	for _, artifact := range artifacts {
+		if artifact.Version != "" {
+			return artifact.Version
+		}
+	}
+
+	entries, err := history.RecipeHistory(recipe, time.Time{})
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to read the history of %s: %v", recipe, err), logger.LogWarning)
+		return ""
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Version != "" {
+			return entries[i].Version
+		}
+	}
+	return ""
+}
+
+// Receipts returns every receipt in the history, oldest first
+func (h *History) Receipts() ([]UploadReceipt, error) {
+	var receipts []UploadReceipt
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyReceiptsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var receipt UploadReceipt
+			if err := json.Unmarshal(value, &receipt); err != nil {
+				return fmt.Errorf("failed to parse receipt %s: %w", key, err)
+			}
+			receipts = append(receipts, receipt)
+			return nil
+		})
+	})
+
+	sort.Slice(receipts, func(i, j int) bool {
+		return receipts[i].Timestamp.Before(receipts[j].Timestamp)
+	})
+	return receipts, err
+}
@@ -0,0 +1,105 @@
+// recipe_audit.go
+package autopkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// RecipeAudit is the outcome of autopkg audit for a single recipe
+type RecipeAudit struct {
+	Recipe string             `json:"recipe" yaml:"recipe"` // Recipe file path, as autopkg audit reports it
+	Issues []RecipeAuditIssue `json:"issues" yaml:"issues"`
+}
+
+// RecipeAuditIssue is a single check a recipe failed, e.g. missing_code_signature_verification
+type RecipeAuditIssue struct {
+	Check   string   `json:"check" yaml:"check"`
+	Details []string `json:"details,omitempty" yaml:"details,omitempty"` // E.g. the insecure URLs or non-core processors found
+}
+
+// AuditRecipes runs autopkg audit with plist output and returns the recipes
+// with issues, sorted by recipe. Recipes that pass every check aren't listed.
+func AuditRecipes(recipes []string, options *AuditOptions) ([]RecipeAudit, error) {
+	auditOptions := AuditOptions{}
+	if options != nil {
+		auditOptions = *options
+	}
+	auditOptions.PlistOutput = true
+
+	output, err := AuditRecipe(recipes, &auditOptions)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRecipeAudit(output)
+}
+
+// ParseRecipeAudit parses the plist autopkg audit --plist prints: a dict of
+// recipe paths to the checks each failed. A check's value is true, or the
+// findings behind it as a string, array or dict.
+func ParseRecipeAudit(output string) ([]RecipeAudit, error) {
+	// autopkg may log warnings before the plist
+	start := strings.Index(output, "<?xml")
+	if start < 0 {
+		start = strings.Index(output, "<plist")
+	}
+	if start < 0 {
+		if strings.TrimSpace(output) == "" {
+			return []RecipeAudit{}, nil
+		}
+		return nil, fmt.Errorf("failed to parse audit output: no plist found")
+	}
+
+	var issues map[string]map[string]interface{}
+	if _, err := plist.Unmarshal([]byte(output[start:]), &issues); err != nil {
+		return nil, fmt.Errorf("failed to parse audit output: %w", err)
+	}
+
+	audits := []RecipeAudit{}
+	for recipe, checks := range issues {
+		audit := RecipeAudit{Recipe: recipe, Issues: []RecipeAuditIssue{}}
+		for check, value := range checks {
+			if failed, ok := value.(bool); ok && !failed {
+				continue
+			}
+			audit.Issues = append(audit.Issues, RecipeAuditIssue{Check: check, Details: auditDetails(value)})
+		}
+		if len(audit.Issues) == 0 {
+			continue
+		}
+		sort.Slice(audit.Issues, func(i, j int) bool { return audit.Issues[i].Check < audit.Issues[j].Check })
+		audits = append(audits, audit)
+	}
+
+	sort.Slice(audits, func(i, j int) bool { return audits[i].Recipe < audits[j].Recipe })
+	return audits, nil
+}
+
+// auditDetails flattens the findings behind a failed check into strings
+func auditDetails(value interface{}) []string {
+	switch value := value.(type) {
+	case bool:
+		return nil
+	case []interface{}:
+		var details []string
+		for _, item := range value {
+			details = append(details, auditDetails(item)...)
+		}
+		return details
+	case map[string]interface{}:
+		var details []string
+		for key, item := range value {
+			if itemDetails := auditDetails(item); len(itemDetails) > 0 {
+				key = fmt.Sprintf("%s: %s", key, strings.Join(itemDetails, ", "))
+			}
+			details = append(details, key)
+		}
+		sort.Strings(details)
+		return details
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
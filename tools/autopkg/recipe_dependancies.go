@@ -5,6 +5,8 @@ package autopkg
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -184,29 +186,37 @@ func FetchRecipeIndex(useToken bool) (*RecipeIndex, error) {
 		return recipeIndexCache, nil
 	}
 
+	if err := requireNetwork("fetch the AutoPkg recipe index", "resolve dependencies from the local repos instead"); err != nil {
+		return nil, err
+	}
+
 	indexURL := "https://raw.githubusercontent.com/autopkg/index/refs/heads/main/index.json"
 
 	logger.Logger("🔄 Fetching AutoPkg recipe index", logger.LogDebug)
 
-	var cmd *exec.Cmd
+	var resp *http.Response
+	var err error
 	if useToken {
-		token := os.Getenv("GITHUB_TOKEN")
-		if token != "" {
-			cmd = exec.Command("curl", "-sL", "-H", fmt.Sprintf("Authorization: token %s", token), indexURL)
+		if len(GitHubTokens()) > 0 {
 			logger.Logger("🔐 Using GitHub token for authentication", logger.LogDebug)
 		} else {
 			logger.Logger("⚠️ GitHub token requested but not found in environment", logger.LogWarning)
-			cmd = exec.Command("curl", "-sL", indexURL)
 		}
+		resp, err = githubGet(indexURL)
 	} else {
-		cmd = exec.Command("curl", "-sL", indexURL)
+		resp, err = http.Get(indexURL)
 	}
-
-	output, err := cmd.CombinedOutput()
 	if err != nil {
 		logger.Logger("❌ Failed to fetch AutoPkg index", logger.LogError)
 		return nil, fmt.Errorf("failed to fetch index: %w", err)
 	}
+	defer resp.Body.Close()
+
+	output, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		logger.Logger("❌ Failed to fetch AutoPkg index", logger.LogError)
+		return nil, fmt.Errorf("failed to fetch index: status %d: %v", resp.StatusCode, err)
+	}
 
 	var index map[string]json.RawMessage
 	if err := json.Unmarshal(output, &index); err != nil {
@@ -370,10 +380,16 @@ func VerifyRepoExists(repoName string, useToken bool) bool {
 	repoURL := fmt.Sprintf("https://github.com/%s", repoName)
 	logger.Logger(fmt.Sprintf("🔍 Verifying repository: %s", repoURL), logger.LogDebug)
 
+	// Offline, only a repo already cloned locally counts as existing
+	if Offline() {
+		_, err := os.Stat(filepath.Join(recipeRepoDir(""), RepoDirName(ResolveRepoURL(repoName)), ".git"))
+		return err == nil
+	}
+
 	var cmd *exec.Cmd
 
 	if useToken {
-		token := os.Getenv("GITHUB_TOKEN")
+		token := gitHubTokens().token()
 		if token != "" {
 			// For git operations with token, we need to format it as https://token@github.com/...
 			authRepoURL := fmt.Sprintf("https://%s@github.com/%s", token, repoName)
@@ -0,0 +1,85 @@
+// recipe_index.go
+package autopkg
+
+import (
+	"path/filepath"
+)
+
+// recipeIndex holds the definitions of the overrides and recipes AutoPkg can
+// see with a set of preferences, so a recipe name can be resolved to its
+// file, identifier and parent chain without running autopkg
+type recipeIndex struct {
+	overrides map[string]*recipeDefinition // Override definitions by recipe name, e.g. Firefox.jamf.recipe
+	recipes   map[string]*recipeDefinition // Recipe definitions by identifier
+	names     map[string]*recipeDefinition // Recipe definitions by recipe name
+}
+
+// newRecipeIndex scans the search, repo and override directories of the preferences
+func newRecipeIndex(prefsPath string, searchDirs []string, overrideDirs []string) *recipeIndex {
+	index := &recipeIndex{
+		overrides: make(map[string]*recipeDefinition),
+		recipes:   make(map[string]*recipeDefinition),
+		names:     make(map[string]*recipeDefinition),
+	}
+
+	repoDir := recipeRepoDir(prefsPath)
+	for _, root := range processorAuditRoots(&ProcessorAuditOptions{PrefsPath: prefsPath, SearchDirs: searchDirs}, repoDir) {
+		found, err := scanRecipeDefinitions(root, repoDir)
+		if err != nil {
+			continue
+		}
+		for _, recipe := range found {
+			if _, exists := index.recipes[recipe.Identifier]; recipe.Identifier != "" && !exists {
+				index.recipes[recipe.Identifier] = recipe
+			}
+			name := overrideRecipeName(filepath.Base(recipe.path))
+			if _, exists := index.names[name]; !exists {
+				index.names[name] = recipe
+			}
+		}
+	}
+
+	dirs := append(append([]string{}, overrideDirs...), recipeOverrideDirs(prefsPath)...)
+	for _, dir := range dirs {
+		found, err := scanRecipeDefinitions(expandTilde(dir), repoDir)
+		if err != nil {
+			continue
+		}
+		for _, override := range found {
+			if override.ParentRecipe == "" {
+				continue
+			}
+			name := overrideRecipeName(filepath.Base(override.path))
+			// The first override found wins, matching AutoPkg's search order
+			if _, exists := index.overrides[name]; !exists {
+				index.overrides[name] = override
+			}
+		}
+	}
+
+	return index
+}
+
+// override returns the override of a recipe, or nil when it has none
+func (i *recipeIndex) override(recipe string) *recipeDefinition {
+	return i.overrides[recipeBaseName(recipe)+".recipe"]
+}
+
+// definition returns the definition AutoPkg runs for a recipe, preferring its override
+func (i *recipeIndex) definition(recipe string) *recipeDefinition {
+	if override := i.override(recipe); override != nil {
+		return override
+	}
+	return i.names[recipeBaseName(recipe)+".recipe"]
+}
+
+// parents returns the parent chain of a definition, stopping at a missing parent or a loop
+func (i *recipeIndex) parents(definition *recipeDefinition) []*recipeDefinition {
+	var parents []*recipeDefinition
+	seen := make(map[string]bool)
+	for parent := i.recipes[definition.ParentRecipe]; parent != nil && !seen[parent.Identifier]; parent = i.recipes[parent.ParentRecipe] {
+		seen[parent.Identifier] = true
+		parents = append(parents, parent)
+	}
+	return parents
+}
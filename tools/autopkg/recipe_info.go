@@ -0,0 +1,141 @@
+// recipe_info.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DescribeRecipe runs autopkg info for a recipe and returns it as a
+// RecipeInfo. The processors it runs, its input variables and the repo it
+// comes from are read from the recipe files in the parent chain autopkg info
+// lists, merged the way AutoPkg does: parents first, nearer recipes winning.
+func DescribeRecipe(recipe string, options *InfoOptions) (*RecipeInfo, error) {
+	if options == nil {
+		options = &InfoOptions{}
+	}
+
+	output, err := GetRecipeInfo(recipe, options)
+	if err != nil {
+		return nil, err
+	}
+	info := ParseRecipeInfo(recipe, output)
+	if info.Identifier == "" && info.Path == "" {
+		return nil, fmt.Errorf("failed to parse autopkg info output for %s", recipe)
+	}
+
+	info.IsOverride = isRecipeOverride(info.Identifier, info.Path)
+	if fileInfo, err := os.Stat(info.Path); err == nil {
+		info.ModTime = fileInfo.ModTime()
+	}
+
+	chain := recipeInfoChain(info)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, step := range chain[i].Process {
+			info.Processors = append(info.Processors, step.Processor)
+		}
+		for key, value := range chain[i].Input {
+			if info.Input == nil {
+				info.Input = make(map[string]string)
+			}
+			info.Input[key] = inputValueString(value)
+		}
+	}
+
+	// An override's repo of origin is the repo of the recipe it overrides
+	repoDir := recipeRepoDir(options.PrefsPath)
+	for _, definition := range chain {
+		if !isRecipeOverride(definition.Identifier, definition.path) {
+			info.Repo = processorProvider(definition.path, repoDir)
+			break
+		}
+	}
+
+	return info, nil
+}
+
+// recipeInfoChain reads the recipe files of a RecipeInfo, nearest first,
+// following ParentRecipe identifiers and falling back to the order autopkg
+// info listed them in when an identifier can't be matched
+func recipeInfoChain(info *RecipeInfo) []*recipeDefinition {
+	definition, err := parseRecipeDefinition(info.Path)
+	if err != nil {
+		return nil
+	}
+
+	parents := make(map[string]*recipeDefinition)
+	var listed []*recipeDefinition
+	for _, path := range info.ParentRecipes {
+		if parent, err := parseRecipeDefinition(path); err == nil {
+			parents[parent.Identifier] = parent
+			listed = append(listed, parent)
+		}
+	}
+
+	chain := []*recipeDefinition{definition}
+	for parent := parents[definition.ParentRecipe]; parent != nil && len(chain) <= len(listed); parent = parents[parent.ParentRecipe] {
+		chain = append(chain, parent)
+	}
+	if len(chain)-1 != len(listed) {
+		chain = append([]*recipeDefinition{definition}, listed...)
+	}
+	return chain
+}
+
+// inputValueString formats an input variable, keeping strings as they are
+func inputValueString(value interface{}) string {
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+// ParseRecipeInfo parses the output of GetRecipeInfo into a RecipeInfo.
+// Fields are read from their labels, and the parent recipe files, which
+// autopkg info lists one per line, from the indented lines following
+// "Parent recipe(s):".
+func ParseRecipeInfo(recipe string, output string) *RecipeInfo {
+	info := &RecipeInfo{Name: recipeBaseName(recipe), Type: knownRecipeType(recipeBaseName(recipe))}
+
+	field := ""
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		label, value, labelled := strings.Cut(trimmed, ":")
+		if labelled && line[0] != ' ' && line[0] != '\t' {
+			field = label
+			trimmed = strings.TrimSpace(value)
+		} else if field != "Parent recipe(s)" {
+			continue
+		}
+
+		switch field {
+		case "Description":
+			info.Description = trimmed
+		case "Identifier":
+			info.Identifier = trimmed
+		case "Recipe file path":
+			info.Path = trimmed
+		case "Parent recipe(s)":
+			if trimmed != "" {
+				info.ParentRecipes = append(info.ParentRecipes, trimmed)
+			}
+		}
+	}
+
+	return info
+}
+
+// ParentNames returns the names of the parent recipes, e.g. Firefox.download.recipe
+func (i *RecipeInfo) ParentNames() []string {
+	var names []string
+	for _, parent := range i.ParentRecipes {
+		names = append(names, recipeBaseName(filepath.Base(parent))+".recipe")
+	}
+	return names
+}
@@ -0,0 +1,174 @@
+// recipe_map.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// RecipeMapOptions contains options for generating recipe list files from override directories
+type RecipeMapOptions struct {
+	PrefsPath    string
+	OverrideDirs []string // Defaults to RECIPE_OVERRIDE_DIRS or ~/Library/AutoPkg/RecipeOverrides
+	OutputDir    string   // Directory the list files are written to
+	Catalog      *Catalog // Optional catalog used to group recipes by tag
+}
+
+// RecipeMap groups the recipes found in override directories
+type RecipeMap struct {
+	All    []string
+	ByType map[string][]string // Recipe type (download, pkg, jamf, intune...) -> recipes
+	ByTag  map[string][]string // Catalog tag -> recipes
+}
+
+// recipeOverrideExtensions lists the file suffixes recognised as recipe overrides
+var recipeOverrideExtensions = []string{".recipe.yaml", ".recipe.plist", ".recipe", ".yaml", ".plist"}
+
+// BuildRecipeMap scans the override directories and groups every override by
+// recipe type and, when a catalog is provided, by catalog tag.
+func BuildRecipeMap(options *RecipeMapOptions) (*RecipeMap, error) {
+	if options == nil {
+		options = &RecipeMapOptions{}
+	}
+
+	overrideDirs := options.OverrideDirs
+	if len(overrideDirs) == 0 {
+		overrideDirs = recipeOverrideDirs(options.PrefsPath)
+	}
+
+	recipeMap := &RecipeMap{
+		All:    []string{},
+		ByType: make(map[string][]string),
+		ByTag:  make(map[string][]string),
+	}
+	seen := make(map[string]bool)
+
+	for _, dir := range overrideDirs {
+		dir = expandTilde(dir)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Could not read override directory %s: %v", dir, err), logger.LogWarning)
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			recipe := overrideRecipeName(entry.Name())
+			if recipe == "" || seen[recipe] {
+				continue
+			}
+			seen[recipe] = true
+
+			recipeMap.All = append(recipeMap.All, recipe)
+			if recipeType := recipeTypeFromName(recipe); recipeType != "" {
+				recipeMap.ByType[recipeType] = append(recipeMap.ByType[recipeType], recipe)
+			}
+			if catalogEntry := options.Catalog.Entry(recipe); catalogEntry != nil {
+				for _, tag := range catalogEntry.Tags {
+					recipeMap.ByTag[tag] = append(recipeMap.ByTag[tag], recipe)
+				}
+			}
+		}
+	}
+
+	sort.Strings(recipeMap.All)
+	for _, recipes := range recipeMap.ByType {
+		sort.Strings(recipes)
+	}
+	for _, recipes := range recipeMap.ByTag {
+		sort.Strings(recipes)
+	}
+
+	logger.Logger(fmt.Sprintf("🗺️ Mapped %d overrides into %d types and %d tags", len(recipeMap.All), len(recipeMap.ByType), len(recipeMap.ByTag)), logger.LogInfo)
+	return recipeMap, nil
+}
+
+// WriteRecipeMap writes all.txt, type-<type>.txt and tag-<tag>.txt recipe list
+// files that can be passed to run --recipe-list. Stale list files from a
+// previous generation are removed. Returns the written file paths.
+func WriteRecipeMap(recipeMap *RecipeMap, outputDir string) ([]string, error) {
+	if outputDir == "" {
+		return nil, fmt.Errorf("output directory is required")
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	for _, pattern := range []string{"type-*.txt", "tag-*.txt"} {
+		stale, _ := filepath.Glob(filepath.Join(outputDir, pattern))
+		for _, path := range stale {
+			os.Remove(path)
+		}
+	}
+
+	lists := map[string][]string{"all.txt": recipeMap.All}
+	for recipeType, recipes := range recipeMap.ByType {
+		lists["type-"+recipeType+".txt"] = recipes
+	}
+	for tag, recipes := range recipeMap.ByTag {
+		lists["tag-"+sanitizeListName(tag)+".txt"] = recipes
+	}
+
+	var written []string
+	for name, recipes := range lists {
+		path := filepath.Join(outputDir, name)
+		content := "# Generated by autopkgctl recipe-map from recipe overrides, do not edit\n" + strings.Join(recipes, "\n") + "\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return written, fmt.Errorf("failed to write recipe list %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+
+	sort.Strings(written)
+	logger.Logger(fmt.Sprintf("✅ Wrote %d recipe lists to %s", len(written), outputDir), logger.LogSuccess)
+	return written, nil
+}
+
+// overrideRecipeName converts an override file name into the recipe name used
+// in recipe lists, e.g. Firefox.pkg.recipe.yaml becomes Firefox.pkg.recipe.
+func overrideRecipeName(fileName string) string {
+	for _, ext := range recipeOverrideExtensions {
+		if strings.HasSuffix(fileName, ext) {
+			return strings.TrimSuffix(fileName, ext) + ".recipe"
+		}
+	}
+	return ""
+}
+
+// recipeTypeFromName returns the type segment of a recipe name, e.g. "pkg" for Firefox.pkg.recipe
+func recipeTypeFromName(recipe string) string {
+	name := strings.TrimSuffix(recipe, ".recipe")
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		return strings.ToLower(name[idx+1:])
+	}
+	return ""
+}
+
+// recipeOverrideDirs returns RECIPE_OVERRIDE_DIRS from the preferences or the AutoPkg default
+func recipeOverrideDirs(prefsPath string) []string {
+	if prefs, err := GetAutoPkgPreferences(prefsPath); err == nil {
+		if overrideDirs := preferenceDirs(prefs, overrideDirsPrefsKey); len(overrideDirs) > 0 {
+			return overrideDirs
+		}
+	}
+	return []string{"~/Library/AutoPkg/RecipeOverrides"}
+}
+
+// sanitizeListName makes a tag safe for use in a file name
+func sanitizeListName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' || r == os.PathSeparator {
+			return '-'
+		}
+		return r
+	}, strings.ToLower(name))
+}
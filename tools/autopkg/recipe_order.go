@@ -0,0 +1,162 @@
+// recipe_order.go
+package autopkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// SkipReasonRunByChild is the skip reason of a parent recipe left out of a
+// batch because a child in the same batch runs it
+const SkipReasonRunByChild = "run-by-child"
+
+// recipeParentCache holds the parent chains resolved with autopkg info, so
+// each recipe is looked up once however many batches or children share it
+var recipeParentCache = struct {
+	sync.Mutex
+	chains map[string][]string
+}{chains: make(map[string][]string)}
+
+// recipeParentResolver resolves the parent chains of a batch's recipes
+type recipeParentResolver struct {
+	options *RecipeBatchRunOptions
+	index   *recipeIndex // Built on the first recipe autopkg info can't resolve
+}
+
+// parents returns the names of a recipe's parent recipes, nearest first. They
+// are read from autopkg info, or from the recipes in the search and override
+// directories when autopkg info can't resolve the recipe.
+func (r *recipeParentResolver) parents(recipe string) []string {
+	prefsPath := r.options.prefsPathFor(recipe)
+	key := strings.Join(append(append([]string{prefsPath, recipe}, r.options.SearchDirs...), r.options.OverrideDirs...), "\x00")
+
+	recipeParentCache.Lock()
+	chain, cached := recipeParentCache.chains[key]
+	recipeParentCache.Unlock()
+	if cached {
+		return chain
+	}
+
+	output, err := GetRecipeInfo(recipe, &InfoOptions{
+		PrefsPath:    prefsPath,
+		SearchDirs:   r.options.SearchDirs,
+		OverrideDirs: r.options.OverrideDirs,
+	})
+	if info := ParseRecipeInfo(recipe, output); err == nil && info.Identifier != "" {
+		chain = info.ParentNames()
+	} else {
+		logger.Logger(fmt.Sprintf("⚠️ autopkg info couldn't resolve %s, reading its parents from the recipe files", recipe), logger.LogDebug)
+		chain = r.indexParents(recipe)
+	}
+
+	recipeParentCache.Lock()
+	recipeParentCache.chains[key] = chain
+	recipeParentCache.Unlock()
+	return chain
+}
+
+// indexParents returns a recipe's parent chain from the recipe index
+func (r *recipeParentResolver) indexParents(recipe string) []string {
+	if r.index == nil {
+		r.index = newRecipeIndex(r.options.PrefsPath, r.options.SearchDirs, r.options.OverrideDirs)
+	}
+
+	definition := r.index.definition(recipe)
+	if definition == nil {
+		return []string{}
+	}
+	chain := []string{}
+	for _, parent := range r.index.parents(definition) {
+		chain = append(chain, overrideRecipeName(filepath.Base(parent.path)))
+	}
+	return chain
+}
+
+// orderRecipes orders a batch by its recipes' parent chains. AutoPkg runs a
+// recipe's whole parent chain, so a parent listed with one of its children is
+// left out and recorded as skipped rather than run twice. The rest are grouped
+// by the download they share, so it's cached when the next one runs, with
+// recipes nearer the download first. It reports whether the batch changed.
+func (o *RecipeBatchRunOptions) orderRecipes(recipes []string, results map[string]*RecipeBatchResult) ([]string, bool) {
+	if len(recipes) < 2 {
+		return recipes, false
+	}
+
+	resolver := &recipeParentResolver{options: o}
+	chains := make(map[string][]string, len(recipes))
+	batch := make(map[string]string, len(recipes)) // Recipes by base name
+	for _, recipe := range recipes {
+		chains[recipe] = resolver.parents(recipe)
+		batch[recipeBaseName(recipe)] = recipe
+	}
+
+	// A parent is run by the first child listing it in its chain
+	runBy := make(map[string]string)
+	for _, child := range recipes {
+		for _, parent := range chains[child] {
+			if recipe, listed := batch[recipeBaseName(parent)]; listed && recipe != child && runBy[recipe] == "" {
+				runBy[recipe] = child
+			}
+		}
+	}
+
+	var ordered []string
+	family := make(map[string]int) // Position of the first recipe of each family
+	for _, recipe := range recipes {
+		if child, covered := runBy[recipe]; covered {
+			// The child may itself run as part of a grandchild
+			for seen := map[string]bool{recipe: true}; runBy[child] != "" && !seen[runBy[child]]; {
+				seen[child] = true
+				child = runBy[child]
+			}
+			logger.Logger(fmt.Sprintf("🔗 %s runs as part of %s, not on its own", recipe, child), logger.LogInfo)
+			results[recipe] = &RecipeBatchResult{
+				Recipe:     recipe,
+				Output:     fmt.Sprintf("Ran as part of %s", child),
+				Status:     "skipped",
+				SkipReason: SkipReasonRunByChild,
+			}
+			continue
+		}
+		if _, seen := family[recipeFamily(recipe, chains[recipe])]; !seen {
+			family[recipeFamily(recipe, chains[recipe])] = len(family)
+		}
+		ordered = append(ordered, recipe)
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		familyI, familyJ := family[recipeFamily(ordered[i], chains[ordered[i]])], family[recipeFamily(ordered[j], chains[ordered[j]])]
+		if familyI != familyJ {
+			return familyI < familyJ
+		}
+		return len(chains[ordered[i]]) < len(chains[ordered[j]])
+	})
+
+	changed := len(ordered) != len(recipes)
+	for i := range ordered {
+		changed = changed || ordered[i] != recipes[i]
+	}
+	if changed {
+		logger.Logger(fmt.Sprintf("🔗 Ordered %d recipes by their parent chains, %d run as part of a child", len(ordered), len(recipes)-len(ordered)), logger.LogInfo)
+	}
+	return ordered, changed
+}
+
+// recipeFamily returns the recipe a recipe's chain starts from: its .download
+// parent, else its furthest parent, else the recipe itself
+func recipeFamily(recipe string, chain []string) string {
+	for _, parent := range chain {
+		if recipeTypeFromName(parent) == "download" {
+			return recipeBaseName(parent)
+		}
+	}
+	if len(chain) > 0 {
+		return recipeBaseName(chain[len(chain)-1])
+	}
+	return recipeBaseName(recipe)
+}
@@ -0,0 +1,118 @@
+// recipe_overrides.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// RecipeOverrides changes how a single recipe in a batch is run, so one batch
+// can mix recipes with different targets, e.g. Intune and Jamf uploads
+type RecipeOverrides struct {
+	PrefsPath       string            `yaml:"prefs_path,omitempty"`        // Dedicated AutoPkg preferences file for this recipe
+	Variables       map[string]string `yaml:"variables,omitempty"`         // Extra variables, merged over the batch variables
+	VerboseLevel    *int              `yaml:"verbose,omitempty"`           // Verbosity for this recipe, nil keeps the batch level
+	PreProcessors   []string          `yaml:"pre_processors,omitempty"`    // Replaces the batch pre-processors when not nil
+	PostProcessors  []string          `yaml:"post_processors,omitempty"`   // Replaces the batch post-processors when not nil
+	NoDownloadProxy bool              `yaml:"no_download_proxy,omitempty"` // Download directly, without the batch download proxy and mirrors
+	Quarantine      bool              `yaml:"quarantine,omitempty"`        // Hold what the recipe builds for approval instead of uploading it
+}
+
+// LoadRecipeOverrides reads per-recipe overrides from a YAML file mapping
+// recipe names to their overrides
+func LoadRecipeOverrides(path string) (map[string]RecipeOverrides, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipe overrides file: %w", err)
+	}
+
+	overrides := make(map[string]RecipeOverrides)
+	if err := yaml.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse recipe overrides file: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("🎛️ Loaded overrides for %d recipes", len(overrides)), logger.LogDebug)
+	return overrides, nil
+}
+
+// recipeOverrides returns the overrides for a recipe, matched by the exact
+// name or path used in the batch, or by recipe name without extension
+func (o *RecipeBatchRunOptions) recipeOverrides(recipe string) *RecipeOverrides {
+	if len(o.PerRecipe) == 0 || recipe == "" {
+		return nil
+	}
+	if overrides, ok := o.PerRecipe[recipe]; ok {
+		return &overrides
+	}
+
+	name := filepath.Base(recipe)
+	for _, ext := range []string{".recipe.yaml", ".recipe.plist", ".recipe"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if overrides, ok := o.PerRecipe[name]; ok {
+		return &overrides
+	}
+	return nil
+}
+
+// prefsPathFor returns the preferences file a recipe runs with
+func (o *RecipeBatchRunOptions) prefsPathFor(recipe string) string {
+	if overrides := o.recipeOverrides(recipe); overrides != nil && overrides.PrefsPath != "" {
+		return overrides.PrefsPath
+	}
+	return o.isolation.prefsPathFor(o.PrefsPath)
+}
+
+// overrideDirsFor returns the override directories to search with a recipe's preferences
+func (o *RecipeBatchRunOptions) overrideDirsFor(prefsPath string) []string {
+	return o.isolation.overrideDirsFor(prefsPath, o.OverrideDirs)
+}
+
+// hasRecipeOverrides reports whether any of the recipes has overrides
+func (o *RecipeBatchRunOptions) hasRecipeOverrides(recipes []string) bool {
+	for _, recipe := range recipes {
+		if o.recipeOverrides(recipe) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRecipeOverrides updates the run options of a single recipe with its overrides
+func applyRecipeOverrides(runOpts *RunOptions, recipe string, overrides *RecipeOverrides) {
+	if overrides == nil {
+		return
+	}
+	logger.Logger(fmt.Sprintf("🎛️ Applying per-recipe overrides to %s", recipe), logger.LogDebug)
+
+	if overrides.PrefsPath != "" {
+		runOpts.PrefsPath = overrides.PrefsPath
+	}
+
+	if len(overrides.Variables) > 0 {
+		variables := make(map[string]string, len(runOpts.Variables)+len(overrides.Variables))
+		for key, value := range runOpts.Variables {
+			variables[key] = value
+		}
+		for key, value := range overrides.Variables {
+			variables[key] = value
+		}
+		runOpts.Variables = variables
+	}
+
+	if overrides.VerboseLevel != nil {
+		runOpts.VerboseLevel = *overrides.VerboseLevel
+	}
+
+	if overrides.PreProcessors != nil {
+		runOpts.PreProcessors = append([]string{}, overrides.PreProcessors...)
+	}
+	if overrides.PostProcessors != nil {
+		runOpts.PostProcessors = append([]string{}, overrides.PostProcessors...)
+	}
+}
@@ -0,0 +1,179 @@
+// recipe_policy.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// StatusBlocked is the status of recipes a RecipePolicy refused to run
+const StatusBlocked = "blocked"
+
+// RecipePolicy is a central list of recipes that must not run, checked before
+// anything in a batch is executed. For example, a rule denying *.jamf except
+// on main stops feature branches from uploading to the production Jamf tenant.
+type RecipePolicy struct {
+	Deny []RecipePolicyRule `yaml:"deny"`
+}
+
+// RecipePolicyRule denies the recipes matching a pattern
+type RecipePolicyRule struct {
+	Recipe         string   `yaml:"recipe"`                    // Pattern matched against the recipe name and the identifiers of it and its parents, e.g. *.jamf or com.github.autopkg.*
+	Branches       []string `yaml:"branches,omitempty"`        // Branch patterns the rule applies on, empty applies on every branch
+	ExceptBranches []string `yaml:"except_branches,omitempty"` // Branch patterns the rule doesn't apply on, e.g. main
+	Reason         string   `yaml:"reason,omitempty"`          // Shown with the blocked recipe
+}
+
+// LoadRecipePolicy reads a recipe policy from a YAML file
+func LoadRecipePolicy(path string) (*RecipePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipe policy file: %w", err)
+	}
+
+	var policy RecipePolicy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse recipe policy file: %w", err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid recipe policy file %s: %w", path, err)
+	}
+
+	logger.Logger(fmt.Sprintf("🛡️ Loaded recipe policy with %d deny rules", len(policy.Deny)), logger.LogDebug)
+	return &policy, nil
+}
+
+// validate checks every rule has a well-formed recipe pattern and branch patterns
+func (p *RecipePolicy) validate() error {
+	for i, rule := range p.Deny {
+		if rule.Recipe == "" {
+			return fmt.Errorf("deny rule %d has no recipe pattern", i+1)
+		}
+		patterns := append(append([]string{rule.Recipe}, rule.Branches...), rule.ExceptBranches...)
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("deny rule %d has invalid pattern %q: %w", i+1, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Denied returns the first rule denying a recipe on a branch, or nil when the
+// recipe may run. The identifiers are those of the recipe and its parents, as
+// far as they are known.
+func (p *RecipePolicy) Denied(recipe string, identifiers []string, branch string) *RecipePolicyRule {
+	if p == nil {
+		return nil
+	}
+
+	name := recipeBaseName(recipe)
+	for i, rule := range p.Deny {
+		if !matchPolicyPattern(rule.Recipe, name) && !matchPolicyValues(rule.Recipe, identifiers) {
+			continue
+		}
+		if len(rule.Branches) > 0 && !matchAnyPolicyPattern(rule.Branches, branch) {
+			continue
+		}
+		if matchAnyPolicyPattern(rule.ExceptBranches, branch) {
+			continue
+		}
+		return &p.Deny[i]
+	}
+	return nil
+}
+
+// matchPolicyPattern matches a value against a glob pattern, case insensitively
+func matchPolicyPattern(pattern string, value string) bool {
+	if value == "" {
+		return false
+	}
+	matched, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return matched
+}
+
+// matchAnyPolicyPattern reports whether a value matches any of the patterns
+func matchAnyPolicyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matchPolicyPattern(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPolicyValues reports whether any of the values matches a pattern
+func matchPolicyValues(pattern string, values []string) bool {
+	for _, value := range values {
+		if matchPolicyPattern(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentBranch returns the branch the run is for: the pull request's source
+// branch or pushed branch in GitHub Actions, otherwise the checked out branch
+func CurrentBranch() string {
+	for _, name := range []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME"} {
+		if branch := os.Getenv(name); branch != "" {
+			return branch
+		}
+	}
+	output, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// blockDeniedRecipes records a blocked result for every recipe the policy
+// denies and returns the recipes that may run
+func blockDeniedRecipes(recipes []string, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult) []string {
+	if options.Policy == nil || len(options.Policy.Deny) == 0 {
+		return recipes
+	}
+	if options.Branch == "" {
+		options.Branch = CurrentBranch()
+	}
+
+	indexes := make(map[string]*recipeIndex)
+	var remaining []string
+	for _, recipe := range recipes {
+		prefsPath := options.prefsPathFor(recipe)
+		if indexes[prefsPath] == nil {
+			indexes[prefsPath] = newRecipeIndex(prefsPath, options.SearchDirs, options.OverrideDirs)
+		}
+		var identifiers []string
+		if definition := indexes[prefsPath].definition(recipe); definition != nil {
+			identifiers = append(identifiers, definition.Identifier)
+			for _, parent := range indexes[prefsPath].parents(definition) {
+				identifiers = append(identifiers, parent.Identifier)
+			}
+		}
+
+		rule := options.Policy.Denied(recipe, identifiers, options.Branch)
+		if rule == nil {
+			remaining = append(remaining, recipe)
+			continue
+		}
+
+		reason := fmt.Sprintf("denied by recipe policy rule %s", rule.Recipe)
+		if rule.Reason != "" {
+			reason += ": " + rule.Reason
+		}
+		logger.Logger(fmt.Sprintf("🛡️ Blocking %s on branch %s, %s", recipe, options.Branch, reason), logger.LogWarning)
+		results[recipe] = &RecipeBatchResult{
+			Recipe: recipe,
+			Output: reason,
+			Status: StatusBlocked,
+		}
+	}
+	return remaining
+}
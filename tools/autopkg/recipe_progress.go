@@ -0,0 +1,103 @@
+// recipe_progress.go
+package autopkg
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// RecipeProgress receives live progress of a batch run, e.g. to drive the TUI.
+// Methods are called from the goroutine running the batch.
+type RecipeProgress interface {
+	// RecipeStarted is called before autopkg runs a recipe, cancel stops that recipe only
+	RecipeStarted(recipe string, cancel func())
+	// RecipeProcessor is called when autopkg reports the processor it is running
+	RecipeProcessor(recipe string, processor string)
+	// RecipeFinished is called once a recipe has a result, including skipped recipes
+	RecipeFinished(recipe string, result *RecipeBatchResult)
+}
+
+// processorLinePattern matches the processor names autopkg prints in verbose
+// mode, e.g. URLDownloader or com.github.grahampugh.jamf-upload.processors/JamfPackageUploader
+var processorLinePattern = regexp.MustCompile(`^(?:[\w.-]+/)?[A-Z][A-Za-z0-9]*$`)
+
+// processorFromOutputLine returns the processor an autopkg output line announces, if any
+func processorFromOutputLine(line string) string {
+	line = strings.TrimSpace(line)
+	if !processorLinePattern.MatchString(line) {
+		return ""
+	}
+	return line
+}
+
+// lineWriter calls onLine for every complete line written to it
+type lineWriter struct {
+	onLine  func(string)
+	pending []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.onLine(string(w.pending[:i]))
+		w.pending = w.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// reportRecipeStarted tells the progress receiver, if any, and the event bus
+// that autopkg is about to run a recipe
+func (o *RecipeBatchRunOptions) reportRecipeStarted(recipe string, cancel func()) {
+	if o.Progress != nil {
+		o.Progress.RecipeStarted(recipe, cancel)
+	}
+	o.startRecipeSpan(recipe)
+	o.publish(Event{Type: EventRecipeStarted, Recipe: recipe})
+}
+
+// reportRecipeProcessor passes the processor a recipe is running to the
+// progress receiver, if any, and the tracer. run is the recipe, or
+// "recipe on target" for a recipe fanned out to targets.
+func (o *RecipeBatchRunOptions) reportRecipeProcessor(recipe, run, processor string) {
+	if o.Progress != nil {
+		label := processor
+		if run != recipe {
+			label = strings.TrimPrefix(run, recipe+" on ") + ": " + processor
+		}
+		o.Progress.RecipeProcessor(recipe, label)
+	}
+	o.traceProcessor(recipe, run, processor)
+}
+
+// reportRecipeFinished passes a recipe's result to the progress receiver, if
+// any, and publishes it with the artifacts it produced
+func (o *RecipeBatchRunOptions) reportRecipeFinished(recipe string, results map[string]*RecipeBatchResult) {
+	if recipe == "" {
+		return
+	}
+	result := results[recipe]
+	if result == nil {
+		return
+	}
+	o.logs.finish(recipe, result)
+	if o.Progress != nil {
+		o.Progress.RecipeFinished(recipe, result)
+	}
+	o.endRecipeSpan(recipe, result)
+
+	for i := range result.Artifacts {
+		o.publish(Event{Type: EventArtifactProduced, Recipe: recipe, Artifact: &result.Artifacts[i]})
+	}
+	event := Event{Type: EventRecipeFinished, Recipe: recipe, Status: result.Status, Result: result}
+	if result.ExecutionError != nil {
+		event.Error = result.ExecutionError.Error()
+	} else if result.VerificationError != nil {
+		event.Error = result.VerificationError.Error()
+	}
+	o.publish(event)
+}
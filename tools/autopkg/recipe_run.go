@@ -2,12 +2,19 @@
 package autopkg
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/munki"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/sbom"
 )
 
 // RecipeBatchRunOptions contains options for processing a batch of recipes through multiple steps
@@ -25,6 +32,64 @@ type RecipeBatchRunOptions struct {
 	PostProcessors       []string
 	StopOnFirstError     bool
 	Notification         NotificationOptions
+	RunID                string                        // Identifier for this batch run, generated if empty
+	StorageLedgerPath    string                        // Path to the JSON ledger recording uploaded artifact sizes
+	Catalog              *Catalog                      // Recipe catalog used to apply per-recipe feature flags
+	StateDir             string                        // Directory for run records, defaults to DefaultStateDir()
+	HistoryPath          string                        // Run history database, defaults to history.db in StateDir
+	ManifestDir          string                        // Directory to write the artifact checksum manifest to
+	ManifestSigningKey   string                        // Optional ed25519 PEM key used to sign the manifest
+	SBOMFormat           string                        // Generate an SBOM per pkg/dmg artifact: "cyclonedx" or "spdx"
+	SBOMDir              string                        // Directory for SBOM files, defaults to next to each artifact
+	Chaos                *ChaosOptions                 // Inject synthetic failures instead of running some recipes
+	RerunOf              string                        // Run ID of a partially failed batch; recipes it already uploaded are skipped
+	NoTokenFile          bool                          // Pass GITHUB_TOKEN from the environment to autopkg instead of relying on a token file
+	PerRecipe            map[string]RecipeOverrides    // Overrides for specific recipes, keyed by recipe name or path
+	Health               *HealthOptions                // Pipeline health alert thresholds, nil uses the defaults
+	Webhooks             []WebhookSubscription         // Outbound webhooks for recipe and run events
+	RunnerArch           string                        // Runner architecture for catalog arch requirements, detected when empty
+	RunnerOSVersion      string                        // Runner macOS version for minimum OS requirements, detected when empty
+	ScanPackageOS        bool                          // Record the minimum macOS of built packages with Suspicious Package, gating later runs
+	CheckNotarization    bool                          // Record whether the pkgs, dmgs and apps produced are notarized
+	RequireNotarization  bool                          // Fail MDM upload recipes whose software isn't notarized, implies CheckNotarization. Their package parent's build is checked before they upload; software only seen after the run fails the recipe once it has uploaded.
+	StapleNotarization   bool                          // Staple tickets to notarized artifacts that don't have one when checking
+	DiffArtifacts        bool                          // Diff the pkgs and dmgs of updated recipes against the previous version they produced
+	HashList             *HashList                     // Known good and bad artifact hashes: denylisted artifacts fail their recipe, allowlisted ones skip the security checks. Upload recipes are checked on what their package parent builds before they upload; artifacts only seen after the run fail the recipe once it has uploaded.
+	Context              context.Context               // Stops the running recipe and the rest of the batch when cancelled
+	Progress             RecipeProgress                // Receives live recipe progress, e.g. for the TUI
+	Targets              *TargetSet                    // MDM tenants upload recipes fan out to, nil runs them once with PrefsPath
+	NoTrustCache         bool                          // Run verify-trust-info for every recipe, even when its override and parents are unchanged
+	RetryPolicy          *RetryPolicy                  // Retries recipes that fail transiently, nil never retries
+	Policy               *RecipePolicy                 // Recipes denied from running, reported as blocked
+	Branch               string                        // Branch the run is for, matched by policy rules, detected when empty
+	CheckOnly            bool                          // Only check for new downloads, stopping recipes before they package or upload, see NewCheckPlan
+	Phase                string                        // PhaseDownload or PhasePackage for a two-phase run, see PlanPhases; "" runs the recipes as they are
+	DownloadConcurrency  int                           // Download recipes the download phase runs at once, defaults to DefaultDownloadConcurrency
+	Downloads            map[string]*RecipeBatchResult // Results of the download phase, by download recipe, read by the package phase
+	Isolate              bool                          // Run autopkg with its own HOME, cache and snapshot of the overrides, see isolatedEnv
+	KeepSandbox          bool                          // Keep the isolated environment after the batch instead of removing it
+	DownloadProxy        *DownloadProxy                // Proxy and mirrors recipe downloads go through, unless a recipe opts out
+	MetricsPath          string                        // Prometheus text file the run's metrics are written to, see WriteRunMetrics
+	SkipPreflight        bool                          // Don't check the MDM credentials of upload recipes before the batch, see preflightCredentials
+	Quarantine           bool                          // Hold what upload recipes build for approval instead of uploading it, see ReleaseQuarantined
+	EventSinks           []EventSink                   // Receive the events of the batch, alongside the notification, metrics and webhook sinks
+	Tracer               *Tracer                       // Records spans of the batch, its recipes, trust verification and processors, nil doesn't trace
+	TraceParent          *Span                         // Span the batch span is a child of, e.g. a workflow step
+	LogArchive           *LogArchiveOptions            // Archive each recipe's full output to a log file, nil keeps it in memory only
+
+	trustCache *trustCache                   // Trust verifications from earlier runs, loaded when VerifyTrust is set
+	isolation  *isolatedEnv                  // Environment of an isolated batch, set while it runs
+	proxyRun   *downloadProxyRun             // Download proxy of the batch, set while it runs
+	trustBatch map[string]*TrustVerification // Trust verified for the whole batch up front, by recipe
+
+	offlineDownloads map[string]string // Cached downloads recipes run with in offline mode, by recipe
+	quarantined      map[string]string // Package recipes run for quarantined upload recipes, by upload recipe
+	releases         map[string]string // Staged packages released upload recipes run with, by recipe
+	receipted        map[string]bool   // Upload recipes with receipts from earlier runs, checked before they upload
+	events           *EventBus         // Bus the events of the batch are published on, set while it runs
+	batchSpan        *Span             // Span of the batch, set while it runs
+	spans            *recipeSpans      // Spans of the recipes running, set while the batch runs
+	logs             *logArchive       // Recipe logs of the batch, set while it runs with a log archive
 }
 
 type NotificationOptions struct {
@@ -35,6 +100,7 @@ type NotificationOptions struct {
 	SlackUsername string
 	SlackChannel  string
 	SlackIcon     string
+	ChangesOnly   bool // Only alert on failures, and send new versions since the previous run as one summary
 }
 
 // RecipeBatchResult contains the results of a batch operation
@@ -47,7 +113,23 @@ type RecipeBatchResult struct {
 	VerificationError error
 	ExecutionError    error
 	ExecutionTime     time.Duration
-	Status            string // "updated", "unchanged", "skipped", "failed"
+	Status            string                // "updated", "unchanged", "skipped", "blocked", "failed"
+	Artifacts         []ProducedArtifact    // Packages and disk images produced by the run
+	SBOMs             []string              // SBOM files generated for the artifacts
+	ChaosFault        string                // Synthetic fault injected by chaos mode, if any
+	Uploads           []UploadedArtifact    // Versions uploaded to Jamf or Intune by the run
+	SkipReason        string                // Why a skipped recipe was not run, e.g. "arch-mismatch"
+	MinOSVersion      string                // Minimum macOS required by the built packages, when scanned
+	Targets           []TargetResult        // Per-target outcomes of an upload recipe fanned out to a TargetSet
+	FailureKind       string                // Why the recipe failed, e.g. "checksum-mismatch", see ClassifyFailure
+	Attempts          int                   // Times the recipe was run, more than once when retried
+	CacheDir          string                // AutoPkg cache directory the recipe wrote to, see DiscoverArtifacts
+	Notarization      []notarization.Result // Notarization of the produced artifacts, when checked
+	Usage             *RecipeUsage          // Bytes downloaded and disk used by the run, nil when not measured
+	MunkiImports      []munki.Import        // Items the run imported into a Munki repo
+	ArtifactDiffs     []sbom.Delta          // What changed since the previous version's artifact, when diffed
+	Allowlisted       bool                  // Every pkg and dmg produced is on the hash allowlist, so security checks skipped it
+	LogPath           string                // Archived log of the recipe's full output, when the batch archives logs
 }
 
 // RecipeBatchSummary contains aggregated metrics from a batch run
@@ -57,23 +139,60 @@ type RecipeBatchSummary struct {
 	SuccessCount     int
 	FailedCount      int
 	SkippedCount     int
+	BlockedCount     int
 	UpdatedCount     int
 	UnchangedCount   int
 	UpdatedRecipes   []string
 	UnchangedRecipes []string
 	SkippedRecipes   []string
+	BlockedRecipes   []string
 	FailedRecipes    []string
+	DownloadedBytes  int64  // Downloaded by all recipes
+	CacheGrowthBytes int64  // Net change in size of the AutoPkg cache
+	PeakDiskBytes    int64  // Most disk space used by a single recipe
+	PeakDiskRecipe   string // Recipe that used PeakDiskBytes
 }
 
 // RunRecipeBatch executes parsed recipes using appropriate flags and notifications.
-func RunRecipeBatch(recipeInput string, options *RecipeBatchRunOptions) (map[string]*RecipeBatchResult, error) {
+func RunRecipeBatch(recipeInput string, options *RecipeBatchRunOptions) (results map[string]*RecipeBatchResult, err error) {
 	batchStartTime := time.Now()
 
 	if options == nil {
 		options = &RecipeBatchRunOptions{}
 	}
 
-	results := make(map[string]*RecipeBatchResult)
+	if options.RunID == "" {
+		options.RunID = NewRunID(batchStartTime)
+	} else if err := ValidateRunID(options.RunID); err != nil {
+		return nil, err
+	}
+	logger.Logger(fmt.Sprintf("🆔 Run ID: %s", options.RunID), logger.LogInfo)
+
+	options.events = options.newEventBus()
+	defer func() { options.events = nil }()
+
+	options.batchSpan = options.Tracer.StartSpan(options.TraceParent, "batch")
+	options.batchSpan.SetAttribute("autopkg.run_id", options.RunID)
+	options.spans = &recipeSpans{recipes: map[string]*Span{}, processors: map[string]*Span{}}
+	defer func() {
+		options.batchSpan.SetAttribute("autopkg.recipes", len(results))
+		options.batchSpan.End(err)
+		options.batchSpan = nil
+	}()
+
+	results = make(map[string]*RecipeBatchResult)
+	if options.LogArchive != nil {
+		logs, err := options.openLogArchive()
+		if err != nil {
+			return nil, err
+		}
+		options.logs = logs
+		defer func() {
+			logs.close(results)
+			options.logs = nil
+		}()
+	}
+
 	parser := ParseRecipeInput(recipeInput)
 	recipes, err := parser.Parse()
 	if err != nil {
@@ -81,15 +200,195 @@ func RunRecipeBatch(recipeInput string, options *RecipeBatchRunOptions) (map[str
 		return nil, err
 	}
 
+	if options.Isolate {
+		env, err := newIsolatedEnv(options)
+		if err != nil {
+			return nil, err
+		}
+		options.isolation = env
+		defer func() {
+			options.isolation = nil
+			if options.KeepSandbox {
+				logger.Logger(fmt.Sprintf("🧱 Kept isolated environment %s", env.dir), logger.LogInfo)
+				return
+			}
+			env.remove()
+		}()
+	}
+
+	if !options.DownloadProxy.IsZero() {
+		downloads, err := newDownloadProxyRun(options)
+		if err != nil {
+			return nil, err
+		}
+		options.proxyRun = downloads
+		defer func() {
+			options.proxyRun = nil
+			downloads.remove()
+		}()
+	}
+
+	var chaos *chaosInjector
+	if options.Chaos != nil {
+		if chaos, err = newChaosInjector(options.Chaos); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.NoTokenFile && len(GitHubTokens()) == 0 {
+		logger.Logger(fmt.Sprintf("⚠️ GitHub token file disabled but %s and %s are empty, GitHub requests will be unauthenticated", GitHubTokenEnvVar, GitHubTokensEnvVar), logger.LogWarning)
+	}
+
+	if options.RerunOf != "" {
+		if recipes, err = skipReceiptedRecipes(recipes, options, results); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.RunnerArch == "" {
+		options.RunnerArch = RunnerArch()
+	}
+	if options.RunnerOSVersion == "" {
+		options.RunnerOSVersion = RunnerOSVersion()
+	}
+
+	// Recipes blocked by policy or skipped for their macOS requirement can't be
+	// left in a list file run
+	planned := len(recipes)
+	recipes = blockDeniedRecipes(recipes, options, results)
+	recipes = skipIncompatibleOSRecipes(recipes, options, results)
+	filtered := len(recipes) < planned
+
 	isRecipeListFile := strings.HasSuffix(strings.ToLower(recipeInput), ".txt")
 
-	// Choose processing path based on input type
-	if isRecipeListFile {
+	if options.VerifyTrust && !options.NoTrustCache {
+		cache, cacheErr := newTrustCache(options)
+		if cacheErr != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Trust cache unavailable, verifying every recipe: %v", cacheErr), logger.LogWarning)
+		}
+		options.trustCache = cache
+	}
+
+	// Two-phase runs swap the recipes for their downloads, or for the recipes whose download changed
+	switch options.Phase {
+	case "":
+	case PhaseDownload:
+		recipes = options.downloadPhaseRecipes(recipes, results)
+	case PhasePackage:
+		if recipes, err = options.packagePhaseRecipes(recipes, results); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown phase %q, expected %s or %s", options.Phase, PhaseDownload, PhasePackage)
+	}
+
+	// Parents listed with a child only run as part of it, so the list file can't be run as it is
+	if options.Phase != PhaseDownload {
+		var reordered bool
+		recipes, reordered = options.orderRecipes(recipes, results)
+		filtered = filtered || reordered
+	}
+
+	// Quarantined upload recipes only build, their uploads wait for release
+	if !options.CheckOnly && options.Phase != PhaseDownload {
+		recipes = options.quarantineRecipes(recipes, results)
+		filtered = filtered || len(options.quarantined) > 0
+	}
+
+	// Credentials are only needed by recipes that get as far as uploading
+	uploads := !options.CheckOnly && options.Phase != PhaseDownload && (options.Chaos == nil || !options.Chaos.Simulate)
+	if uploads {
+		options.loadUploadReceipts(recipes)
+	}
+
+	// Receipts are issued for what the report lists as uploaded, so upload
+	// recipes always run with one, in a temporary directory when none was asked for
+	if uploads && options.ReportPlist == "" && hasUploadRecipes(recipes) {
+		reportDir, err := os.MkdirTemp("", "autopkg-report-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a report directory for upload receipts: %w", err)
+		}
+		options.ReportPlist = filepath.Join(reportDir, "report.plist")
+		defer func() {
+			options.ReportPlist = ""
+			os.RemoveAll(reportDir)
+		}()
+	}
+	if uploads && !options.SkipPreflight && !Offline() {
+		span := options.Tracer.StartSpan(options.batchSpan, "preflight-credentials")
+		err := options.preflightCredentials(recipes)
+		span.End(err)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for recipe := range results {
+		options.reportRecipeFinished(recipe, results)
+	}
+
+	// Choose processing path based on input type. Faults are injected, receipts
+	// and builds checked, overrides and feature processors applied,
+	// architectures planned, uploads fanned out, failures retried, cached
+	// downloads passed offline and progress reported per recipe, so those modes
+	// run a list file one recipe at a time. The download phase runs its
+	// download recipes side by side.
+	retries := options.RetryPolicy != nil && options.RetryPolicy.MaxRetries > 0
+	if Offline() {
+		options.resolveOfflineDownloads(recipes)
+	}
+	if options.Phase == PhaseDownload {
+		err = processDownloadPhase(recipes, options, results, batchStartTime)
+	} else if isRecipeListFile && options.Phase == "" && chaos == nil && options.RerunOf == "" && len(options.receipted) == 0 && options.HashList == nil && !options.RequireNotarization && options.Progress == nil && !retries && !Offline() && !filtered && !options.hasRecipeOverrides(recipes) && !options.hasCatalogFeatures(recipes) && !options.hasArchRequirements(recipes) && !options.hasTargetFanOut(recipes) {
 		err = processRecipeListFile(recipeInput, options, results, batchStartTime)
 	} else {
-		err = processIndividualRecipes(recipes, options, results, batchStartTime)
+		err = processIndividualRecipes(recipes, options, results, batchStartTime, chaos)
+	}
+	options.logs.close(results)
+
+	span := options.Tracer.StartSpan(options.batchSpan, "verify-uploads")
+	verifyIntegrationUploads(options, results)
+	span.End(nil)
+	options.stageQuarantine(results)
+
+	if options.trustCache != nil {
+		if saveErr := options.trustCache.save(); saveErr != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to save trust cache: %v", saveErr), logger.LogWarning)
+		}
+	}
+
+	if options.SBOMFormat != "" {
+		generateRunSBOMs(options, results)
 	}
 
+	if options.ManifestDir != "" {
+		writeRunManifest(options, results)
+	}
+
+	// Before the run is recorded, so the previous successful run is the one before this
+	if options.DiffArtifacts && chaos == nil && !options.CheckOnly {
+		diffRunArtifacts(options, results, batchStartTime)
+	}
+
+	// Synthetic results would skew duration trends and update queries, and a
+	// check only run finds new downloads without building their versions
+	var changes []VersionChange
+	if chaos == nil && !options.CheckOnly {
+		changes = recordRunHistory(options, results, batchStartTime)
+	}
+	record := NewRunRecord(options.RunID, results, batchStartTime)
+	record.Chaos = chaos != nil
+	record.CheckOnly = options.CheckOnly
+	record.Changes = changes
+	if chaos == nil && !options.CheckOnly {
+		record.Health = checkRunHealth(options, record)
+	}
+	if saveErr := SaveRunRecord(options.StateDir, record); saveErr != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to save run record: %v", saveErr), logger.LogWarning)
+	}
+
+	options.publish(Event{Type: EventRunFinished, Status: record.Status, Record: record, Results: results})
+
 	return results, err
 }
 
@@ -112,11 +411,13 @@ func processRecipeListFile(recipeInput string, options *RecipeBatchRunOptions, r
 		skippedRecipes := make(map[string]bool)
 		var verifyErr error
 
+		options.verifyTrustBatch(recipeNames)
 		for _, recipe := range recipeNames {
 			startTime := time.Now()
 			skip, err := verifyTrustForRecipe(recipe, options, results, startTime)
 			if skip {
 				skippedRecipes[recipe] = true
+				options.reportRecipeFinished(recipe, results)
 			}
 			if err != nil && verifyErr == nil {
 				verifyErr = err
@@ -140,6 +441,7 @@ func processRecipeListFile(recipeInput string, options *RecipeBatchRunOptions, r
 
 	// Create results for each recipe in the list
 	populateResultsFromRecipeList(recipeNames, recipeInput, output, err, executionTime, options, results)
+	recordRunStorage(options, "")
 
 	// Log execution status
 	if err != nil {
@@ -155,13 +457,53 @@ func processRecipeListFile(recipeInput string, options *RecipeBatchRunOptions, r
 }
 
 // processIndividualRecipes handles execution of individual recipes
-func processIndividualRecipes(recipes []string, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult, batchStartTime time.Time) error {
+func processIndividualRecipes(recipes []string, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult, batchStartTime time.Time, chaos *chaosInjector) error {
 	var firstError error
 
+	// Chaos faults are picked as recipes run, so which recipes need verifying isn't known up front
+	if options.VerifyTrust && chaos == nil {
+		options.verifyTrustBatch(recipes)
+	}
+
+	// Every iteration ends in a result or none, so the previous recipe is reported when the next starts
+	current := ""
 	for _, recipe := range recipes {
+		options.reportRecipeFinished(current, results)
+		current = recipe
+
+		if options.Context != nil && options.Context.Err() != nil {
+			logger.Logger(fmt.Sprintf("🛑 Batch cancelled, skipping %s and the remaining recipes", recipe), logger.LogWarning)
+			current = ""
+			break
+		}
+
 		logger.Logger(fmt.Sprintf("🚀 Running recipe: %s", recipe), logger.LogInfo)
 		startTime := time.Now()
 
+		// Chaos mode replaces the run before anything touches trust info or AutoPkg
+		if chaos != nil {
+			if fault := chaos.pick(); fault != "" {
+				result := chaos.result(recipe, fault)
+				results[recipe] = result
+				if firstError == nil {
+					firstError = result.ExecutionError
+				}
+				if options.StopOnFirstError {
+					break
+				}
+				continue
+			}
+			if chaos.options.Simulate {
+				results[recipe] = chaos.simulatedResult(recipe)
+				continue
+			}
+		}
+
+		if _, skip := options.recipeArchPlan(recipe); skip {
+			results[recipe] = archMismatchResult(recipe, options.Catalog.RequiredArch(recipe), options.RunnerArch)
+			continue
+		}
+
 		// Perform trust verification if enabled
 		if options.VerifyTrust {
 			skipRecipe, err := verifyTrustForRecipe(recipe, options, results, startTime)
@@ -175,14 +517,72 @@ func processIndividualRecipes(recipes []string, options *RecipeBatchRunOptions,
 		}
 
 		// Run the recipe
-		runOpts := createRunOptions(options, "", recipe)
-		output, err := RunRecipe(recipe, runOpts)
-		executionTime := time.Since(startTime)
+		ctx, cancel := context.WithCancel(options.batchContext())
+		options.reportRecipeStarted(recipe, cancel)
+
+		// Upload recipes with checks to pass build first, so a denied build or a version already uploaded doesn't upload
+		if gated := options.gateUpload(ctx, recipe); gated != nil {
+			cancel()
+			results[recipe] = gated
+			if gated.ExecutionError != nil {
+				if firstError == nil {
+					firstError = gated.ExecutionError
+				}
+				if options.StopOnFirstError {
+					break
+				}
+			}
+			continue
+		}
+
+		meter := startUsageMeter(autopkgCacheDir(options.prefsPathFor(recipe)))
+		usageReport := options.ReportPlist
 
-		// Create and store the result
-		result := createRecipeResult(recipe, output, err, executionTime, true, false)
+		var result *RecipeBatchResult
+		if options.fansOut(recipe) {
+			usageReport = ""
+			result = runRecipeOnTargets(ctx, recipe, options, startTime)
+		} else {
+			runOpts := createRunOptions(options, "", recipe)
+			runOpts.Context = ctx
+			if options.Progress != nil || options.Tracer != nil {
+				runOpts.OutputLine = func(line string) {
+					if processor := processorFromOutputLine(line); processor != "" {
+						options.reportRecipeProcessor(recipe, recipe, processor)
+					}
+				}
+			}
+			output, attempts, runErr := options.runWithRetry(ctx, recipe, func() (string, error) {
+				return RunRecipe(recipe, runOpts)
+			})
+			if runErr != nil && ctx.Err() != nil {
+				runErr = fmt.Errorf("recipe cancelled: %w", runErr)
+			}
+
+			result = createRecipeResult(recipe, output, runErr, time.Since(startTime), true, false)
+			result.Attempts = attempts
+			result.Artifacts = collectRunArtifacts(options, recipe)
+			result.CacheDir = recipeCacheDir(autopkgCacheDir(options.prefsPathFor(recipe)), result.Artifacts)
+			result.Uploads = collectRunUploads(options, recipe)
+			result.MunkiImports = collectRunMunkiImports(options, recipe)
+			recordRunStorage(options, recipe)
+		}
+		result.Usage = meter.finish(usageReport, recipe)
+		cancel()
+		if options.HashList != nil {
+			checkRunHashList(result, options.HashList)
+		}
+		if (options.CheckNotarization || options.RequireNotarization) && !result.Allowlisted {
+			checkRunNotarization(result, options)
+		}
+		err := result.ExecutionError
+		executionTime := result.ExecutionTime
+
+		// Store the result
+		if options.ScanPackageOS {
+			result.MinOSVersion = scanArtifactMinOSVersion(result.Artifacts)
+		}
 		results[recipe] = result
-		handleNotifications(result, options)
 
 		// Handle errors and logging
 		if err != nil {
@@ -198,31 +598,66 @@ func processIndividualRecipes(recipes []string, options *RecipeBatchRunOptions,
 		}
 	}
 
+	options.reportRecipeFinished(current, results)
+
 	// Generate summary
 	LogRecipeBatchSummary(results, batchStartTime)
 
 	return firstError
 }
 
+// batchContext returns the context recipes of the batch run under
+func (o *RecipeBatchRunOptions) batchContext() context.Context {
+	if o.Context != nil {
+		return o.Context
+	}
+	return context.Background()
+}
+
+// SkipReasonTrustFailed marks recipes skipped because trust verification failed
+const SkipReasonTrustFailed = "trust-failed"
+
 // verifyTrustForRecipe performs trust verification for a single recipe
 // Returns true if the recipe should be skipped, and any error that occurred
 func verifyTrustForRecipe(recipe string, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult, startTime time.Time) (bool, error) {
-	verifyOpts := &VerifyTrustInfoOptions{
-		PrefsPath:    options.PrefsPath,
-		SearchDirs:   options.SearchDirs,
-		OverrideDirs: options.OverrideDirs,
+	if options.trustCache != nil && options.trustCache.lookup(recipe) {
+		logger.Logger(fmt.Sprintf("🔐 Trust for %s unchanged since last verified, skipping verify-trust-info", recipe), logger.LogDebug)
+		return false, nil
 	}
 
-	success, _, _, verifyErr := VerifyTrustInfoForRecipes([]string{recipe}, verifyOpts)
+	var success bool
+	var verifyErr error
+	if verified := options.trustBatch[recipe]; verified != nil {
+		success = verified.Passed
+		if !success {
+			verifyErr = fmt.Errorf("trust verification failed: %s", strings.Join(verified.Reasons, "; "))
+		}
+	} else {
+		verifyOpts := &VerifyTrustInfoOptions{
+			PrefsPath:    options.prefsPathFor(recipe),
+			SearchDirs:   options.SearchDirs,
+			OverrideDirs: options.overrideDirsFor(options.prefsPathFor(recipe)),
+		}
+		span := options.Tracer.StartSpan(options.batchSpan, "verify-trust")
+		span.SetAttribute("autopkg.recipe", recipe)
+		success, _, _, verifyErr = VerifyTrustInfoForRecipes([]string{recipe}, verifyOpts)
+		span.SetAttribute("autopkg.trust_passed", success)
+		span.End(verifyErr)
+	}
 	if verifyErr != nil || !success {
 		logger.Logger(fmt.Sprintf("⚠️ Trust verification failed for recipe %s: %v", recipe, verifyErr), logger.LogWarning)
+		event := Event{Type: EventTrustFailed, Recipe: recipe}
+		if verifyErr != nil {
+			event.Error = verifyErr.Error()
+		}
+		options.publish(event)
 
 		trustUpdated := false
 		if options.UpdateTrustOnFailure {
 			_, updateErr := UpdateTrustInfoForRecipes([]string{recipe}, &UpdateTrustInfoOptions{
-				PrefsPath:    options.PrefsPath,
+				PrefsPath:    options.prefsPathFor(recipe),
 				SearchDirs:   options.SearchDirs,
-				OverrideDirs: options.OverrideDirs,
+				OverrideDirs: options.overrideDirsFor(options.prefsPathFor(recipe)),
 			})
 			if updateErr == nil {
 				logger.Logger(fmt.Sprintf("✅ Trust info updated for recipe %s", recipe), logger.LogSuccess)
@@ -241,16 +676,226 @@ func verifyTrustForRecipe(recipe string, options *RecipeBatchRunOptions, results
 				TrustUpdated:      trustUpdated,
 				ExecutionTime:     executionTime,
 				Status:            "skipped",
+				SkipReason:        SkipReasonTrustFailed,
+				FailureKind:       FailureKindTrust,
 			}
 			results[recipe] = result
-			handleNotifications(result, options)
 			return true, verifyErr
 		}
+		return false, nil
 	}
 
+	if options.trustCache != nil {
+		options.trustCache.record(recipe)
+	}
 	return false, nil
 }
 
+// verifyTrustBatch verifies the recipes that need it with one verify-trust-info
+// run per preferences file, rather than one per recipe, leaving the outcomes
+// for verifyTrustForRecipe. Recipes the batch can't settle are verified alone.
+func (o *RecipeBatchRunOptions) verifyTrustBatch(recipes []string) {
+	groups := make(map[string][]string)
+	var prefsPaths []string
+	for _, recipe := range recipes {
+		if o.trustCache != nil && o.trustCache.fresh(recipe) {
+			continue
+		}
+		if _, skip := o.recipeArchPlan(recipe); skip {
+			continue
+		}
+		prefsPath := o.prefsPathFor(recipe)
+		if _, exists := groups[prefsPath]; !exists {
+			prefsPaths = append(prefsPaths, prefsPath)
+		}
+		groups[prefsPath] = append(groups[prefsPath], recipe)
+	}
+
+	o.trustBatch = make(map[string]*TrustVerification)
+	for _, prefsPath := range prefsPaths {
+		// A lone recipe gains nothing from batching
+		if len(groups[prefsPath]) < 2 {
+			continue
+		}
+		span := o.Tracer.StartSpan(o.batchSpan, "verify-trust-batch")
+		span.SetAttribute("autopkg.recipes", len(groups[prefsPath]))
+		verified, err := VerifyTrustInfoBatch(groups[prefsPath], &VerifyTrustInfoOptions{
+			PrefsPath:    prefsPath,
+			SearchDirs:   o.SearchDirs,
+			OverrideDirs: o.overrideDirsFor(prefsPath),
+		})
+		span.End(err)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ %v, verifying recipes one at a time", err), logger.LogWarning)
+		}
+		for recipe, verification := range verified {
+			o.trustBatch[recipe] = verification
+		}
+	}
+}
+
+// NewRunID generates a sortable identifier for a batch run. The random
+// suffix keeps runs started in the same second apart, e.g. runs on different
+// preferences, which the run lock lets overlap.
+func NewRunID(startTime time.Time) string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return startTime.UTC().Format("20060102T150405.000000000Z")
+	}
+	return startTime.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// collectRunArtifacts returns the artifacts listed in the latest report for a recipe
+func collectRunArtifacts(options *RecipeBatchRunOptions, recipe string) []ProducedArtifact {
+	if options.ReportPlist == "" {
+		return nil
+	}
+
+	artifacts, err := CollectProducedArtifacts(options.ReportPlist, recipe)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to collect produced artifacts: %v", err), logger.LogWarning)
+		return nil
+	}
+	return artifacts
+}
+
+// collectRunUploads returns the MDM uploads listed in the latest report for a recipe
+func collectRunUploads(options *RecipeBatchRunOptions, recipe string) []UploadedArtifact {
+	if options.ReportPlist == "" {
+		return nil
+	}
+
+	usage, err := EstimateStorageUsage(options.ReportPlist, recipe)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to read uploads from report: %v", err), logger.LogWarning)
+		return nil
+	}
+	return usage.Artifacts
+}
+
+// hasUploadRecipes reports whether any of the recipes uploads to an MDM
+func hasUploadRecipes(recipes []string) bool {
+	for _, recipe := range recipes {
+		if isUploadRecipe(recipe) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipReceiptedRecipes removes recipes whose uploads in the run being re-run
+// already have receipts, recording them as skipped
+func skipReceiptedRecipes(recipes []string, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult) ([]string, error) {
+	receipted, err := receiptedRecipes(options, options.RerunOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload receipts for run %s: %w", options.RerunOf, err)
+	}
+
+	var remaining []string
+	for _, recipe := range recipes {
+		receipt, ok := receipted[recipe]
+		if !ok {
+			remaining = append(remaining, recipe)
+			continue
+		}
+
+		logger.Logger(fmt.Sprintf("🧾 Skipping %s: version %s already uploaded to %s in run %s", recipe, receipt.Version, receipt.Tenant, receipt.RunID), logger.LogInfo)
+		// Carrying the upload forward re-issues the receipt under this run, so a re-run of it skips the recipe too
+		destination, _, _ := strings.Cut(receipt.Tenant, ":")
+		results[recipe] = &RecipeBatchResult{
+			Recipe:        recipe,
+			Output:        fmt.Sprintf("version %s already uploaded to %s in run %s", receipt.Version, receipt.Tenant, receipt.RunID),
+			Executed:      false,
+			TrustVerified: true,
+			Status:        "skipped",
+			SkipReason:    SkipReasonReceipted,
+			Uploads:       []UploadedArtifact{{Recipe: recipe, Version: receipt.Version, Destination: destination}},
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("🔁 Re-running %d of %d recipes from run %s", len(remaining), len(recipes), options.RerunOf), logger.LogInfo)
+	return remaining, nil
+}
+
+// matchListArtifacts attributes artifacts from a recipe list report to a recipe by app name.
+// A list run writes one report for every recipe, so the file name is the only link back.
+func matchListArtifacts(artifacts []ProducedArtifact, recipe string) []ProducedArtifact {
+	var matched []ProducedArtifact
+	app := artifactAppName(recipe, "", "")
+	for _, artifact := range artifacts {
+		if strings.Contains(strings.ToLower(filepath.Base(artifact.Path)), strings.ToLower(app)) {
+			artifact.Recipe = recipe
+			artifact.App = app
+			matched = append(matched, artifact)
+		}
+	}
+	return matched
+}
+
+// writeRunManifest writes the checksum manifest for every artifact produced by the batch
+func writeRunManifest(options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult) {
+	manifest, err := BuildArtifactManifest(options.RunID, results)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to build artifact manifest: %v", err), logger.LogWarning)
+		return
+	}
+
+	if _, err := WriteArtifactManifest(options.ManifestDir, manifest, options.ManifestSigningKey); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to write artifact manifest: %v", err), logger.LogWarning)
+	}
+}
+
+// generateRunSBOMs writes an SBOM for every package and disk image produced by the batch
+func generateRunSBOMs(options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult) {
+	sbomOptions := &sbom.Options{
+		Format:    options.SBOMFormat,
+		OutputDir: options.SBOMDir,
+	}
+
+	generated := make(map[string]string)
+	for _, result := range results {
+		for _, artifact := range result.Artifacts {
+			if artifact.Type != "pkg" && artifact.Type != "dmg" {
+				continue
+			}
+
+			sbomPath, done := generated[artifact.Path]
+			if !done {
+				sbomOptions.Name = artifact.App
+				sbomOptions.Version = artifact.Version
+
+				var err error
+				if sbomPath, err = sbom.Generate(artifact.Path, sbomOptions); err != nil {
+					logger.Logger(fmt.Sprintf("⚠️ Failed to generate SBOM for %s: %v", filepath.Base(artifact.Path), err), logger.LogWarning)
+				}
+				generated[artifact.Path] = sbomPath
+			}
+
+			if sbomPath != "" {
+				result.SBOMs = appendUnique(result.SBOMs, sbomPath)
+			}
+		}
+	}
+}
+
+// recordRunStorage estimates the MDM storage consumed by the latest report and records it in the ledger
+func recordRunStorage(options *RecipeBatchRunOptions, recipe string) {
+	if options.StorageLedgerPath == "" || options.ReportPlist == "" {
+		return
+	}
+
+	usage, err := EstimateStorageUsage(options.ReportPlist, recipe)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to estimate storage usage: %v", err), logger.LogWarning)
+		return
+	}
+	usage.RunID = options.RunID
+
+	if err := RecordStorageUsage(options.StorageLedgerPath, usage); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to record storage usage: %v", err), logger.LogWarning)
+	}
+}
+
 // extractRecipeNamesFromFile reads a recipe list file and returns the recipe names
 func extractRecipeNamesFromFile(filePath string) ([]string, error) {
 	fileData, err := os.ReadFile(filePath)
@@ -276,10 +921,10 @@ func extractRecipeNamesFromFile(filePath string) ([]string, error) {
 
 // createRunOptions creates RunOptions from RecipeBatchRunOptions
 func createRunOptions(options *RecipeBatchRunOptions, recipeList string, recipe string) *RunOptions {
-	return &RunOptions{
+	runOpts := &RunOptions{
 		PrefsPath:      options.PrefsPath,
-		PreProcessors:  options.PreProcessors,
-		PostProcessors: options.PostProcessors,
+		PreProcessors:  append([]string{}, options.PreProcessors...),
+		PostProcessors: append([]string{}, options.PostProcessors...),
 		Variables:      options.Variables,
 		ReportPlist:    options.ReportPlist,
 		VerboseLevel:   options.VerboseLevel,
@@ -287,29 +932,80 @@ func createRunOptions(options *RecipeBatchRunOptions, recipeList string, recipe
 		OverrideDirs:   options.OverrideDirs,
 		RecipeList:     recipeList,
 		UpdateTrust:    options.UpdateTrustOnFailure,
+		CheckOnly:      options.CheckOnly,
+		Log:            options.logs.writer(recipe),
 	}
+
+	// Offline runs skip the download step with the recipe's cached download
+	if Offline() {
+		runOpts.PkgOrDmgPath = options.offlineDownloads[recipe]
+	}
+	if pkg := options.releases[recipe]; pkg != "" {
+		runOpts.PkgOrDmgPath = pkg
+	}
+
+	// Each recipe run takes the next token in rotation, spreading the rate limit across them
+	if options.NoTokenFile {
+		runOpts.GitHubToken = gitHubTokens().token()
+	}
+
+	// Overrides replace the batch settings, feature processors are still added on top
+	overrides := options.recipeOverrides(recipe)
+	applyRecipeOverrides(runOpts, recipe, overrides)
+	options.isolation.apply(runOpts)
+	if overrides == nil || !overrides.NoDownloadProxy {
+		options.proxyRun.apply(runOpts)
+	}
+
+	// Intel-only recipes on Apple silicon run under Rosetta
+	if recipe != "" {
+		if runArch, _ := options.recipeArchPlan(recipe); runArch != "" {
+			logger.Logger(fmt.Sprintf("🧬 Running %s as %s under Rosetta", recipe, runArch), logger.LogInfo)
+			runOpts.Arch = runArch
+		}
+	}
+
+	// Feature flags are opt-in per recipe, so they only apply when a single recipe is run
+	if recipe != "" && options.Catalog != nil {
+		featurePre, featurePost := options.Catalog.FeatureProcessors(recipe)
+		if len(featurePre) > 0 || len(featurePost) > 0 {
+			logger.Logger(fmt.Sprintf("🧪 Applying features %s to recipe %s", strings.Join(options.Catalog.EnabledFeatures(recipe), ", "), recipe), logger.LogInfo)
+		}
+		runOpts.PreProcessors = appendUnique(runOpts.PreProcessors, featurePre...)
+		runOpts.PostProcessors = appendUnique(runOpts.PostProcessors, featurePost...)
+	}
+
+	return runOpts
 }
 
 // populateResultsFromRecipeList creates results for each recipe in a list file
 func populateResultsFromRecipeList(recipeNames []string, recipeInput string, output string, err error, executionTime time.Duration, options *RecipeBatchRunOptions, results map[string]*RecipeBatchResult) {
+	listArtifacts := collectRunArtifacts(options, "")
+
 	if len(recipeNames) > 0 {
 		// Create result for each recipe
 		for _, recipeName := range recipeNames {
 			status := determineRecipeStatus(output, recipeName, err)
 			result := createRecipeResult(recipeName, output, err, executionTime, true, options.UpdateTrustOnFailure)
 			result.Status = status
+			result.Artifacts = matchListArtifacts(listArtifacts, recipeName)
+			result.CacheDir = recipeCacheDir(autopkgCacheDir(options.prefsPathFor("")), result.Artifacts)
+			if options.CheckNotarization || options.RequireNotarization {
+				checkRunNotarization(result, options)
+			}
 
 			results[recipeName] = result
-			handleNotifications(result, options)
+			options.reportRecipeFinished(recipeName, results)
 		}
 	} else {
 		// Fallback if no recipes were found in the file
 		status := determineRecipeStatus(output, "", err)
 		result := createRecipeResult(recipeInput, output, err, executionTime, true, options.UpdateTrustOnFailure)
 		result.Status = status
+		result.Artifacts = listArtifacts
 
 		results[recipeInput] = result
-		handleNotifications(result, options)
+		options.reportRecipeFinished(recipeInput, results)
 	}
 }
 
@@ -326,6 +1022,7 @@ func createRecipeResult(recipe string, output string, err error, executionTime t
 		TrustUpdated:   trustUpdated,
 		ExecutionTime:  executionTime,
 		Status:         status,
+		FailureKind:    ClassifyFailure(output, err),
 	}
 }
 
@@ -381,15 +1078,15 @@ func extractRecipeOutput(fullOutput, recipeName string) string {
 	return strings.Join(recipeOutput, "\n")
 }
 
-// LogRecipeBatchSummary logs a summary of the recipe batch execution
-func LogRecipeBatchSummary(results map[string]*RecipeBatchResult, startTime time.Time) {
-	// Calculate summary metrics
+// NewRecipeBatchSummary aggregates the results of a batch
+func NewRecipeBatchSummary(results map[string]*RecipeBatchResult, startTime time.Time) *RecipeBatchSummary {
 	summary := &RecipeBatchSummary{
 		TotalDuration:    time.Since(startTime),
 		TotalRecipes:     len(results),
 		UpdatedRecipes:   make([]string, 0),
 		UnchangedRecipes: make([]string, 0),
 		SkippedRecipes:   make([]string, 0),
+		BlockedRecipes:   make([]string, 0),
 		FailedRecipes:    make([]string, 0),
 	}
 
@@ -407,12 +1104,31 @@ func LogRecipeBatchSummary(results map[string]*RecipeBatchResult, startTime time
 		case "skipped":
 			summary.SkippedCount++
 			summary.SkippedRecipes = append(summary.SkippedRecipes, recipe)
+		case StatusBlocked:
+			summary.BlockedCount++
+			summary.BlockedRecipes = append(summary.BlockedRecipes, recipe)
 		case "failed":
 			summary.FailedCount++
 			summary.FailedRecipes = append(summary.FailedRecipes, recipe)
 		}
+
+		if usage := result.Usage; usage != nil {
+			summary.DownloadedBytes += usage.DownloadedBytes
+			summary.CacheGrowthBytes += usage.CacheGrowthBytes
+			if usage.PeakDiskBytes > summary.PeakDiskBytes {
+				summary.PeakDiskBytes = usage.PeakDiskBytes
+				summary.PeakDiskRecipe = recipe
+			}
+		}
 	}
 
+	return summary
+}
+
+// LogRecipeBatchSummary logs a summary of the recipe batch execution
+func LogRecipeBatchSummary(results map[string]*RecipeBatchResult, startTime time.Time) {
+	summary := NewRecipeBatchSummary(results, startTime)
+
 	// Log the summary
 	logger.Logger("\n🚀 Pipeline Execution Summary", logger.LogInfo)
 	logger.Logger(fmt.Sprintf("Total execution time: %s", summary.TotalDuration), logger.LogInfo)
@@ -421,7 +1137,16 @@ func LogRecipeBatchSummary(results map[string]*RecipeBatchResult, startTime time
 	logger.Logger(fmt.Sprintf("  - Updated: %d", summary.UpdatedCount), logger.LogSuccess)
 	logger.Logger(fmt.Sprintf("  - Unchanged: %d", summary.UnchangedCount), logger.LogInfo)
 	logger.Logger(fmt.Sprintf("⏩ Skipped: %d", summary.SkippedCount), logger.LogInfo)
+	if summary.BlockedCount > 0 {
+		logger.Logger(fmt.Sprintf("🛡️ Blocked: %d", summary.BlockedCount), logger.LogWarning)
+	}
 	logger.Logger(fmt.Sprintf("❌ Failed: %d", summary.FailedCount), logger.LogError)
+	if summary.DownloadedBytes > 0 || summary.PeakDiskBytes > 0 {
+		logger.Logger(fmt.Sprintf("📶 Downloaded: %s, cache change: %s", FormatBytes(summary.DownloadedBytes), formatSignedBytes(summary.CacheGrowthBytes)), logger.LogInfo)
+		if summary.PeakDiskRecipe != "" {
+			logger.Logger(fmt.Sprintf("💽 Peak disk use: %s (%s)", FormatBytes(summary.PeakDiskBytes), summary.PeakDiskRecipe), logger.LogInfo)
+		}
+	}
 
 	// Log detailed recipe lists by category
 	if len(summary.UpdatedRecipes) > 0 {
@@ -441,17 +1166,37 @@ func LogRecipeBatchSummary(results map[string]*RecipeBatchResult, startTime time
 	if len(summary.SkippedRecipes) > 0 {
 		logger.Logger("\n⏩ Skipped Recipes:", logger.LogInfo)
 		for _, recipe := range summary.SkippedRecipes {
+			if reason := results[recipe].SkipReason; reason != "" {
+				logger.Logger(fmt.Sprintf("  • %s (%s)", recipe, reason), logger.LogInfo)
+				continue
+			}
 			logger.Logger(fmt.Sprintf("  • %s", recipe), logger.LogInfo)
 		}
 	}
 
+	if len(summary.BlockedRecipes) > 0 {
+		logger.Logger("\n🛡️ Blocked Recipes:", logger.LogWarning)
+		for _, recipe := range summary.BlockedRecipes {
+			logger.Logger(fmt.Sprintf("  • %s (%s)", recipe, results[recipe].Output), logger.LogWarning)
+		}
+	}
+
 	if len(summary.FailedRecipes) > 0 {
 		logger.Logger("\n❌ Failed Recipes:", logger.LogError)
 		for _, recipe := range summary.FailedRecipes {
+			if kind := results[recipe].FailureKind; kind != "" {
+				logger.Logger(fmt.Sprintf("  • %s (%s)", recipe, kind), logger.LogError)
+				if hint := FailureHint(kind); hint != "" {
+					logger.Logger(fmt.Sprintf("    ↳ %s", hint), logger.LogInfo)
+				}
+				continue
+			}
 			logger.Logger(fmt.Sprintf("  • %s", recipe), logger.LogError)
 		}
 	}
 
+	logTargetSummary(results)
+
 	// Final summary
 	if summary.FailedCount > 0 {
 		logger.Logger("🚨 Pipeline status: FAILURE - Some recipes failed.", logger.LogError)
@@ -462,6 +1207,11 @@ func LogRecipeBatchSummary(results map[string]*RecipeBatchResult, startTime time
 
 // Helper function to handle notification
 func handleNotifications(result *RecipeBatchResult, options *RecipeBatchRunOptions) {
+	// Successful recipes are covered by the version change summary at the end of the batch
+	if options.Notification.ChangesOnly && result.ExecutionError == nil && result.VerificationError == nil {
+		return
+	}
+
 	if options.VerboseLevel <= 1 {
 		if options.Notification.EnableTeams {
 			teamsNotifier := &MSTeamsNotifier{
@@ -473,7 +1223,8 @@ func handleNotifications(result *RecipeBatchResult, options *RecipeBatchRunOptio
 				Error:    result.ExecutionError != nil,
 				Updated:  result.TrustUpdated,
 				Verified: &result.TrustVerified,
-				Results:  map[string]interface{}{}, // Populate if necessary
+				Results:  notificationResults(result),
+				LogPath:  result.LogPath,
 			}
 
 			teamsNotifier.NotifyTeams(recipeLifecycle, options)
@@ -492,10 +1243,30 @@ func handleNotifications(result *RecipeBatchResult, options *RecipeBatchRunOptio
 				Error:    result.ExecutionError != nil,
 				Updated:  result.TrustUpdated,
 				Verified: &result.TrustVerified,
-				Results:  map[string]interface{}{}, // Populate if necessary
+				Results:  notificationResults(result),
+				LogPath:  result.LogPath,
 			}
 
 			slackNotifier.NotifySlack(recipeLifecycle)
 		}
 	}
 }
+
+// notificationResults passes the execution error to the notifiers, which
+// otherwise report an unknown error, led by the failure kind and its remedy
+func notificationResults(result *RecipeBatchResult) map[string]interface{} {
+	results := map[string]interface{}{}
+	if result.ExecutionError != nil {
+		message := result.ExecutionError.Error()
+		if result.FailureKind != "" && result.FailureKind != FailureKindUnknown {
+			message = fmt.Sprintf("[%s] %s", result.FailureKind, message)
+			if hint := FailureHint(result.FailureKind); hint != "" {
+				message += "\n" + hint
+			}
+		}
+		results["failed"] = []interface{}{
+			map[string]interface{}{"message": message},
+		}
+	}
+	return results
+}
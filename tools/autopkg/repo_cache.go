@@ -0,0 +1,434 @@
+// repo_cache.go
+package autopkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	repoCacheReposPrefix    = "RecipeRepos"
+	repoCacheDownloadPrefix = "Cache"
+	repoCacheManifestName   = "repo-cache.json"
+)
+
+// RepoCacheOptions contains options for exporting and importing a warm repo cache
+type RepoCacheOptions struct {
+	PrefsPath        string
+	IncludeDownloads bool // Include the AutoPkg downloads cache (CACHE_DIR)
+}
+
+// repoCacheManifest records the RECIPE_REPOS entries packaged in a cache archive,
+// keyed by directory name relative to RECIPE_REPO_DIR.
+type repoCacheManifest struct {
+	CreatedAt        time.Time         `json:"created_at"`
+	Repos            map[string]string `json:"repos"` // directory name -> URL
+	IncludeDownloads bool              `json:"include_downloads"`
+}
+
+// ExportRepoCache packages RECIPE_REPO_DIR, and optionally the downloads cache,
+// into a compressed tarball. The compression is chosen from the archive
+// extension: .tar.zst (zstd) or .tar.gz (gzip).
+func ExportRepoCache(archivePath string, options *RepoCacheOptions) error {
+	if options == nil {
+		options = &RepoCacheOptions{}
+	}
+
+	repoDir := recipeRepoDir(options.PrefsPath)
+	if _, err := os.Stat(repoDir); err != nil {
+		return fmt.Errorf("recipe repo directory not found: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("📦 Exporting repo cache from %s to %s", repoDir, archivePath), logger.LogInfo)
+	startTime := time.Now()
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer file.Close()
+
+	compressor, err := newArchiveWriter(archivePath, file)
+	if err != nil {
+		return err
+	}
+	tarWriter := tar.NewWriter(compressor)
+
+	manifest := repoCacheManifest{
+		CreatedAt:        time.Now().UTC(),
+		Repos:            make(map[string]string),
+		IncludeDownloads: options.IncludeDownloads,
+	}
+	if prefs, err := GetAutoPkgPreferences(options.PrefsPath); err == nil {
+		if recipeRepos, ok := prefs["RECIPE_REPOS"].(map[string]interface{}); ok {
+			for repoPath, repoData := range recipeRepos {
+				repoURL := ""
+				if repoMap, ok := repoData.(map[string]interface{}); ok {
+					repoURL, _ = repoMap["URL"].(string)
+				}
+				manifest.Repos[filepath.Base(repoPath)] = repoURL
+			}
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache manifest: %w", err)
+	}
+	if err := tarWriter.WriteHeader(&tar.Header{
+		Name:    repoCacheManifestName,
+		Mode:    0644,
+		Size:    int64(len(manifestData)),
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return fmt.Errorf("failed to write cache manifest: %w", err)
+	}
+	if _, err := tarWriter.Write(manifestData); err != nil {
+		return fmt.Errorf("failed to write cache manifest: %w", err)
+	}
+
+	if err := addDirToArchive(tarWriter, repoDir, repoCacheReposPrefix); err != nil {
+		return err
+	}
+
+	if options.IncludeDownloads {
+		cacheDir := autopkgCacheDir(options.PrefsPath)
+		if _, err := os.Stat(cacheDir); err == nil {
+			if err := addDirToArchive(tarWriter, cacheDir, repoCacheDownloadPrefix); err != nil {
+				return err
+			}
+		} else {
+			logger.Logger(fmt.Sprintf("⚠️ Downloads cache %s not found, skipping", cacheDir), logger.LogWarning)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("failed to finalize compression: %w", err)
+	}
+
+	if info, err := file.Stat(); err == nil {
+		logger.Logger(fmt.Sprintf("✅ Exported %d repositories (%s) in %s", len(manifest.Repos), FormatBytes(info.Size()), time.Since(startTime).Round(time.Millisecond)), logger.LogSuccess)
+	}
+	return nil
+}
+
+// ImportRepoCache restores a repo cache archive into RECIPE_REPO_DIR (and the
+// downloads cache if present) and registers the repos in the AutoPkg preferences.
+func ImportRepoCache(archivePath string, options *RepoCacheOptions) error {
+	if options == nil {
+		options = &RepoCacheOptions{}
+	}
+
+	repoDir := recipeRepoDir(options.PrefsPath)
+	cacheDir := autopkgCacheDir(options.PrefsPath)
+
+	logger.Logger(fmt.Sprintf("📦 Importing repo cache from %s into %s", archivePath, repoDir), logger.LogInfo)
+	startTime := time.Now()
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	decompressor, err := newArchiveReader(archivePath, file)
+	if err != nil {
+		return err
+	}
+	defer decompressor.Close()
+
+	var manifest repoCacheManifest
+	tarReader := tar.NewReader(decompressor)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if header.Name == repoCacheManifestName {
+			if err := json.NewDecoder(tarReader).Decode(&manifest); err != nil {
+				return fmt.Errorf("failed to parse cache manifest: %w", err)
+			}
+			continue
+		}
+
+		var target string
+		switch {
+		case strings.HasPrefix(header.Name, repoCacheReposPrefix+"/"):
+			target, err = safeArchivePath(repoDir, strings.TrimPrefix(header.Name, repoCacheReposPrefix+"/"))
+		case strings.HasPrefix(header.Name, repoCacheDownloadPrefix+"/"):
+			if !options.IncludeDownloads {
+				continue
+			}
+			target, err = safeArchivePath(cacheDir, strings.TrimPrefix(header.Name, repoCacheDownloadPrefix+"/"))
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		destination := repoDir
+		if strings.HasPrefix(header.Name, repoCacheDownloadPrefix+"/") {
+			destination = cacheDir
+		}
+		if err := extractArchiveEntry(tarReader, header, destination, target); err != nil {
+			return err
+		}
+	}
+
+	recipeRepos := make(map[string]interface{})
+	var searchDirs []string
+	for name, repoURL := range manifest.Repos {
+		if err := validateRepoCacheName(name); err != nil {
+			return err
+		}
+		repoPath := filepath.Join(repoDir, name)
+		if _, err := os.Stat(repoPath); err != nil {
+			continue
+		}
+		recipeRepos[repoPath] = map[string]interface{}{"URL": repoURL}
+		searchDirs = append(searchDirs, repoPath)
+	}
+
+	if len(recipeRepos) > 0 {
+		if err := registerRecipeRepos(options.PrefsPath, recipeRepos, searchDirs); err != nil {
+			return err
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("✅ Imported %d repositories in %s", len(recipeRepos), time.Since(startTime).Round(time.Millisecond)), logger.LogSuccess)
+	return nil
+}
+
+// newArchiveWriter returns a compressing writer based on the archive extension
+func newArchiveWriter(archivePath string, w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(archivePath, ".zst"):
+		encoder, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		return encoder, nil
+	case strings.HasSuffix(archivePath, ".gz"), strings.HasSuffix(archivePath, ".tgz"):
+		return gzip.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported archive extension for %s, use .tar.zst or .tar.gz", archivePath)
+	}
+}
+
+// newArchiveReader returns a decompressing reader based on the archive extension
+func newArchiveReader(archivePath string, r io.Reader) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(archivePath, ".zst"):
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return decoder.IOReadCloser(), nil
+	case strings.HasSuffix(archivePath, ".gz"), strings.HasSuffix(archivePath, ".tgz"):
+		reader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return reader, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive extension for %s, use .tar.zst or .tar.gz", archivePath)
+	}
+}
+
+// addDirToArchive walks a directory and writes its contents under prefix in the tarball
+func addDirToArchive(tarWriter *tar.Writer, dir string, prefix string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return fmt.Errorf("failed to read symlink %s: %w", path, err)
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("failed to create header for %s: %w", path, err)
+		}
+		header.Name = filepath.ToSlash(filepath.Join(prefix, relPath))
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write header for %s: %w", path, err)
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(tarWriter, file); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// extractArchiveEntry writes a single tar entry to disk. Symlinks must point
+// inside the destination, and nothing is written through a symlink an
+// earlier entry planted, so an archive can't write outside the destination.
+func extractArchiveEntry(tarReader *tar.Reader, header *tar.Header, destination string, target string) error {
+	switch header.Typeflag {
+	case tar.TypeDir, tar.TypeSymlink, tar.TypeReg:
+	default:
+		return nil
+	}
+	if err := checkInsideDestination(destination, filepath.Dir(target)); err != nil {
+		return fmt.Errorf("archive entry %s: %w", header.Name, err)
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %s replaces a symlink with a directory", header.Name)
+		}
+		return os.MkdirAll(target, os.FileMode(header.Mode)|0700)
+	case tar.TypeSymlink:
+		linkTarget := header.Linkname
+		if !filepath.IsAbs(linkTarget) {
+			linkTarget = filepath.Join(filepath.Dir(target), linkTarget)
+		}
+		if !withinDir(filepath.Clean(destination), filepath.Clean(linkTarget)) {
+			return fmt.Errorf("archive entry %s links to %s outside the destination directory", header.Name, header.Linkname)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", target, err)
+		}
+		os.Remove(target)
+		return os.Symlink(header.Linkname, target)
+	default:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", target, err)
+		}
+		// Replace a symlink rather than writing through it
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return fmt.Errorf("failed to replace symlink %s: %w", target, err)
+			}
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", target, err)
+		}
+		defer file.Close()
+		if _, err := io.Copy(file, tarReader); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", target, err)
+		}
+		return os.Chtimes(target, header.ModTime, header.ModTime)
+	}
+}
+
+// safeArchivePath joins an archive entry name to a destination, rejecting entries that escape it
+func safeArchivePath(destination string, name string) (string, error) {
+	target := filepath.Join(destination, filepath.FromSlash(name))
+	if !withinDir(filepath.Clean(destination), target) {
+		return "", fmt.Errorf("archive entry %s escapes destination directory", name)
+	}
+	return target, nil
+}
+
+// checkInsideDestination resolves the symlinks of a directory an entry is
+// written to, as far as it exists, and checks it is still inside the destination
+func checkInsideDestination(destination string, dir string) error {
+	resolvedDestination, err := resolveExistingPath(destination)
+	if err != nil {
+		return err
+	}
+	resolvedDir, err := resolveExistingPath(dir)
+	if err != nil {
+		return err
+	}
+	if !withinDir(resolvedDestination, resolvedDir) {
+		return fmt.Errorf("%s resolves outside the destination directory", dir)
+	}
+	return nil
+}
+
+// resolveExistingPath evaluates the symlinks of the longest existing part of
+// a path and appends the rest
+func resolveExistingPath(path string) (string, error) {
+	path = filepath.Clean(path)
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append(missing, filepath.Base(path))
+		path = parent
+	}
+}
+
+// withinDir reports whether a clean path is a directory or inside it
+func withinDir(dir string, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// validateRepoCacheName rejects manifest repo names that aren't a single
+// directory name within the repo directory
+func validateRepoCacheName(name string) error {
+	if name == "" || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("cache manifest has invalid repo name %q", name)
+	}
+	return nil
+}
+
+// autopkgCacheDir returns the AutoPkg downloads cache directory
+func autopkgCacheDir(prefsPath string) string {
+	if prefs, err := GetAutoPkgPreferences(prefsPath); err == nil {
+		if dir, ok := prefs["CACHE_DIR"].(string); ok && dir != "" {
+			return expandTilde(dir)
+		}
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "Library/AutoPkg/Cache")
+}
@@ -0,0 +1,333 @@
+// repo_clone.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// DefaultCloneConcurrency is the number of parallel clone workers used until
+// autopkgctl repo-add --benchmark has measured the runner. It isn't backed
+// by a measurement; the recorded benchmark picks the value once there is one.
+const DefaultCloneConcurrency = 8
+
+// CloneReposOptions contains options for cloning recipe repositories natively with git
+type CloneReposOptions struct {
+	PrefsPath         string
+	RepoDir           string // Directory to clone into, defaults to RECIPE_REPO_DIR or ~/Library/AutoPkg/RecipeRepos
+	Concurrency       int    // Number of parallel clone workers, defaults to the benchmarked level or DefaultCloneConcurrency
+	StateDir          string // State directory the clone benchmark is recorded in
+	FullClone         bool   // Clone full history instead of --depth 1
+	FallbackToRepoAdd bool   // Retry failed clones with autopkg repo-add
+	SkipPrefsUpdate   bool   // Do not register cloned repos in RECIPE_REPOS
+}
+
+// CloneResult contains the outcome of cloning a single repository
+type CloneResult struct {
+	Repo     string
+	URL      string
+	Path     string
+	Existing bool // Repository was already present and not re-cloned
+	Fallback bool // Repository was added with autopkg repo-add after the native clone failed
+	Duration time.Duration
+	Error    error
+}
+
+// CloneRepos clones recipe repositories in parallel with shallow git clones and
+// registers them directly in RECIPE_REPOS and RECIPE_SEARCH_DIRS.
+func CloneRepos(repos []string, options *CloneReposOptions) ([]CloneResult, error) {
+	if options == nil {
+		options = &CloneReposOptions{}
+	}
+
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultCloneConcurrency
+		if benchmarked, ok := BenchmarkedCloneConcurrency(options.StateDir); ok {
+			options.Concurrency = benchmarked
+		}
+	}
+
+	if options.RepoDir == "" {
+		options.RepoDir = recipeRepoDir(options.PrefsPath)
+	}
+
+	if err := os.MkdirAll(options.RepoDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recipe repo directory: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("📦 Cloning %d recipe repositories with %d workers", len(repos), options.Concurrency), logger.LogInfo)
+	startTime := time.Now()
+
+	results := make([]CloneResult, len(repos))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < options.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = cloneRepo(repos[i], options)
+			}
+		}()
+	}
+
+	for i := range repos {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var failed []string
+	recipeRepos := make(map[string]interface{})
+	var searchDirs []string
+
+	for i := range results {
+		result := &results[i]
+		if result.Error != nil && options.FallbackToRepoAdd {
+			logger.Logger(fmt.Sprintf("🔁 Falling back to autopkg repo-add for %s: %v", result.Repo, result.Error), logger.LogWarning)
+			if _, err := AddRepo([]string{result.URL}, options.PrefsPath); err != nil {
+				result.Error = fmt.Errorf("%w; autopkg repo-add failed: %v", result.Error, err)
+			} else if _, err := os.Stat(filepath.Join(result.Path, ".git")); err != nil {
+				// autopkg repo-add registers the repo itself, so only confirm it landed on disk
+				result.Error = fmt.Errorf("%w; autopkg repo-add didn't clone it to %s", result.Error, result.Path)
+			} else {
+				result.Error = nil
+				result.Fallback = true
+				continue
+			}
+		}
+
+		if result.Error != nil {
+			logger.Logger(fmt.Sprintf("❌ Failed to clone %s: %v", result.Repo, result.Error), logger.LogError)
+			failed = append(failed, result.Repo)
+			continue
+		}
+
+		recipeRepos[result.Path] = map[string]interface{}{"URL": result.URL}
+		searchDirs = append(searchDirs, result.Path)
+	}
+
+	if !options.SkipPrefsUpdate && len(recipeRepos) > 0 {
+		if err := registerRecipeRepos(options.PrefsPath, recipeRepos, searchDirs); err != nil {
+			return results, err
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("✅ Cloned %d/%d repositories in %s", len(repos)-len(failed), len(repos), time.Since(startTime).Round(time.Millisecond)), logger.LogSuccess)
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("failed to clone %d repositories: %s", len(failed), strings.Join(failed, ", "))
+	}
+
+	return results, nil
+}
+
+// cloneRepo clones a single repository unless it is already present
+func cloneRepo(repo string, options *CloneReposOptions) CloneResult {
+	startTime := time.Now()
+	repoURL := ResolveRepoURL(repo)
+	result := CloneResult{
+		Repo: repo,
+		URL:  repoURL,
+		Path: filepath.Join(options.RepoDir, RepoDirName(repoURL)),
+	}
+
+	if _, err := os.Stat(filepath.Join(result.Path, ".git")); err == nil {
+		logger.Logger(fmt.Sprintf("⏭️ Repository %s already present at %s", repo, result.Path), logger.LogDebug)
+		result.Existing = true
+		result.Duration = time.Since(startTime)
+		return result
+	}
+
+	if err := requireNetwork(fmt.Sprintf("clone %s", repo), "seed it with repo-cache import first"); err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime)
+		return result
+	}
+
+	args := []string{"clone", "--quiet"}
+	if !options.FullClone {
+		args = append(args, "--depth", "1")
+	}
+	args = append(args, repoURL, result.Path)
+
+	logger.Logger(fmt.Sprintf("🖥️  Running command: git %s", strings.Join(args, " ")), logger.LogDebug)
+
+	if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		os.RemoveAll(result.Path)
+		result.Error = fmt.Errorf("git clone failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	result.Duration = time.Since(startTime)
+	return result
+}
+
+// ResolveRepoURL expands an AutoPkg repo shorthand into a clone URL the same
+// way autopkg repo-add does: "recipes" becomes autopkg/recipes and "owner/name"
+// becomes a GitHub URL.
+func ResolveRepoURL(repo string) string {
+	if strings.Contains(repo, "://") || strings.HasPrefix(repo, "git@") {
+		return repo
+	}
+	if !strings.Contains(repo, "/") {
+		repo = "autopkg/" + repo
+	}
+	return fmt.Sprintf("https://github.com/%s.git", strings.TrimSuffix(repo, ".git"))
+}
+
+// RepoDirName returns the local directory name autopkg uses for a repo URL,
+// e.g. https://github.com/autopkg/recipes.git becomes com.github.autopkg.recipes.
+func RepoDirName(repoURL string) string {
+	host, path := "", repoURL
+
+	if parsed, err := url.Parse(repoURL); err == nil && parsed.Host != "" {
+		host, path = parsed.Hostname(), parsed.Path
+	} else if strings.HasPrefix(repoURL, "git@") {
+		parts := strings.SplitN(strings.TrimPrefix(repoURL, "git@"), ":", 2)
+		host = parts[0]
+		if len(parts) == 2 {
+			path = parts[1]
+		}
+	}
+
+	hostParts := strings.Split(host, ".")
+	for i, j := 0, len(hostParts)-1; i < j; i, j = i+1, j-1 {
+		hostParts[i], hostParts[j] = hostParts[j], hostParts[i]
+	}
+
+	pathParts := strings.Split(strings.Trim(strings.TrimSuffix(path, ".git"), "/"), "/")
+
+	var nameParts []string
+	for _, part := range append(hostParts, pathParts...) {
+		if part != "" {
+			nameParts = append(nameParts, part)
+		}
+	}
+	return strings.Join(nameParts, ".")
+}
+
+// recipeRepoDir returns the directory AutoPkg clones recipe repos into
+func recipeRepoDir(prefsPath string) string {
+	if prefs, err := GetAutoPkgPreferences(prefsPath); err == nil {
+		if dir, ok := prefs["RECIPE_REPO_DIR"].(string); ok && dir != "" {
+			return expandTilde(dir)
+		}
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "Library/AutoPkg/RecipeRepos")
+}
+
+// CloneBenchmarkResult contains the wall time taken to clone a repo set at one concurrency level
+type CloneBenchmarkResult struct {
+	Concurrency int
+	Duration    time.Duration
+	Failed      int
+}
+
+// BenchmarkRepoClone clones the given repos into throwaway directories at each
+// concurrency level and reports the wall time. Record the results with
+// SaveCloneBenchmark so later clones use the fastest level.
+func BenchmarkRepoClone(repos []string, levels []int) ([]CloneBenchmarkResult, error) {
+	var benchmarks []CloneBenchmarkResult
+
+	for _, level := range levels {
+		tempDir, err := os.MkdirTemp("", "autopkg-clone-bench-")
+		if err != nil {
+			return benchmarks, fmt.Errorf("failed to create benchmark directory: %w", err)
+		}
+
+		startTime := time.Now()
+		results, _ := CloneRepos(repos, &CloneReposOptions{
+			RepoDir:         tempDir,
+			Concurrency:     level,
+			SkipPrefsUpdate: true,
+		})
+		benchmark := CloneBenchmarkResult{
+			Concurrency: level,
+			Duration:    time.Since(startTime),
+		}
+		for _, result := range results {
+			if result.Error != nil {
+				benchmark.Failed++
+			}
+		}
+		benchmarks = append(benchmarks, benchmark)
+		os.RemoveAll(tempDir)
+
+		logger.Logger(fmt.Sprintf("⏱️ Concurrency %d: %s (%d failed)", level, benchmark.Duration.Round(time.Millisecond), benchmark.Failed), logger.LogInfo)
+	}
+
+	return benchmarks, nil
+}
+
+// cloneBenchmarkFile is the clone benchmark record within the state directory
+const cloneBenchmarkFile = "clone-benchmark.json"
+
+// CloneBenchmarkRecord is the latest clone benchmark of a runner
+type CloneBenchmarkRecord struct {
+	RecordedAt time.Time              `json:"recorded_at"`
+	Repos      int                    `json:"repos"`
+	Results    []CloneBenchmarkResult `json:"results"`
+}
+
+// SaveCloneBenchmark records clone benchmark results in the state directory
+func SaveCloneBenchmark(stateDir string, repos int, results []CloneBenchmarkResult) error {
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(CloneBenchmarkRecord{RecordedAt: time.Now().UTC(), Repos: repos, Results: results}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal clone benchmark: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, cloneBenchmarkFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write clone benchmark: %w", err)
+	}
+	return nil
+}
+
+// BenchmarkedCloneConcurrency returns the fastest concurrency level of the
+// recorded clone benchmark that cloned every repo, false without one
+func BenchmarkedCloneConcurrency(stateDir string) (int, bool) {
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+	data, err := os.ReadFile(filepath.Join(stateDir, cloneBenchmarkFile))
+	if err != nil {
+		return 0, false
+	}
+	var record CloneBenchmarkRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return 0, false
+	}
+	return fastestCloneConcurrency(record.Results)
+}
+
+// fastestCloneConcurrency returns the level of the fastest benchmark without failures
+func fastestCloneConcurrency(results []CloneBenchmarkResult) (int, bool) {
+	best := -1
+	for i, result := range results {
+		if result.Failed > 0 || result.Concurrency <= 0 {
+			continue
+		}
+		if best < 0 || result.Duration < results[best].Duration {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	return results[best].Concurrency, true
+}
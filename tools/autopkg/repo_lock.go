@@ -0,0 +1,237 @@
+// repo_lock.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// DefaultRepoLockfile is the default name of the recipe repo lockfile
+const DefaultRepoLockfile = "autopkg.lock"
+
+// RepoLockEntry records the exact revision of a single recipe repository
+type RepoLockEntry struct {
+	Path   string `json:"path"`
+	URL    string `json:"url"`
+	Commit string `json:"commit"`
+}
+
+// RepoLockfile records the revisions of every repository in RECIPE_REPOS
+type RepoLockfile struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Repos       []RepoLockEntry `json:"repos"`
+}
+
+// FreezeRepos reads RECIPE_REPOS from the AutoPkg preferences and records the
+// URL and current commit SHA of every repository.
+func FreezeRepos(prefsPath string) (*RepoLockfile, error) {
+	prefs, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	recipeRepos, ok := prefs["RECIPE_REPOS"].(map[string]interface{})
+	if !ok || len(recipeRepos) == 0 {
+		return nil, fmt.Errorf("no RECIPE_REPOS found in preferences")
+	}
+
+	lock := &RepoLockfile{
+		GeneratedAt: time.Now().UTC(),
+		Repos:       []RepoLockEntry{},
+	}
+
+	for repoPath, repoData := range recipeRepos {
+		repoURL := ""
+		if repoMap, ok := repoData.(map[string]interface{}); ok {
+			repoURL, _ = repoMap["URL"].(string)
+		}
+
+		// A repo left out would stay unpinned while the lockfile looks complete
+		output, err := exec.Command("git", "-C", expandTilde(repoPath), "rev-parse", "HEAD").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit for repo %s: %w", repoPath, err)
+		}
+
+		lock.Repos = append(lock.Repos, RepoLockEntry{
+			Path:   repoPath,
+			URL:    repoURL,
+			Commit: strings.TrimSpace(string(output)),
+		})
+	}
+
+	sort.Slice(lock.Repos, func(i, j int) bool {
+		return lock.Repos[i].Path < lock.Repos[j].Path
+	})
+
+	logger.Logger(fmt.Sprintf("🔒 Froze %d recipe repositories", len(lock.Repos)), logger.LogSuccess)
+	return lock, nil
+}
+
+// WriteRepoLockfile writes a repo lockfile to disk as JSON
+func WriteRepoLockfile(lockPath string, lock *RepoLockfile) error {
+	if lockPath == "" {
+		lockPath = DefaultRepoLockfile
+	}
+
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+
+	if err := os.WriteFile(lockPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("📝 Wrote repo lockfile to %s", lockPath), logger.LogSuccess)
+	return nil
+}
+
+// ReadRepoLockfile reads a repo lockfile from disk
+func ReadRepoLockfile(lockPath string) (*RepoLockfile, error) {
+	if lockPath == "" {
+		lockPath = DefaultRepoLockfile
+	}
+
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	var lock RepoLockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile: %w", err)
+	}
+
+	return &lock, nil
+}
+
+// RestoreRepos clones any missing repository in the lockfile and resets every
+// repository to its locked commit, then registers them in the AutoPkg preferences.
+func RestoreRepos(lock *RepoLockfile, prefsPath string) error {
+	if lock == nil || len(lock.Repos) == 0 {
+		return fmt.Errorf("lockfile contains no repositories")
+	}
+
+	recipeRepos := make(map[string]interface{})
+	var searchDirs []string
+
+	// Stop at the first repo that can't be pinned rather than registering a
+	// partial set whose missing repos drift
+	for _, entry := range lock.Repos {
+		repoDir := expandTilde(entry.Path)
+
+		if entry.Commit == "" {
+			return fmt.Errorf("lockfile has no commit for repo %s", entry.Path)
+		}
+		if err := restoreRepo(entry, repoDir); err != nil {
+			return fmt.Errorf("failed to restore repo %s: %w", entry.Path, err)
+		}
+
+		recipeRepos[entry.Path] = map[string]interface{}{"URL": entry.URL}
+		searchDirs = append(searchDirs, entry.Path)
+		logger.Logger(fmt.Sprintf("✅ Restored %s at %s", entry.Path, shortSHA(entry.Commit)), logger.LogSuccess)
+	}
+
+	if len(recipeRepos) > 0 {
+		if err := registerRecipeRepos(prefsPath, recipeRepos, searchDirs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreRepo clones a repository if needed and resets it to the locked commit
+func restoreRepo(entry RepoLockEntry, repoDir string) error {
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); os.IsNotExist(err) {
+		if entry.URL == "" {
+			return fmt.Errorf("repository is missing and has no URL to clone from")
+		}
+		if err := requireNetwork("clone "+entry.URL, "seed it with repo-cache import first"); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(repoDir), 0755); err != nil {
+			return fmt.Errorf("failed to create repo parent directory: %w", err)
+		}
+		if output, err := exec.Command("git", "clone", entry.URL, repoDir).CombinedOutput(); err != nil {
+			return fmt.Errorf("git clone failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	// Only fetch when the locked commit is not already present locally
+	if err := exec.Command("git", "-C", repoDir, "cat-file", "-e", entry.Commit+"^{commit}").Run(); err != nil {
+		if err := requireNetwork(fmt.Sprintf("fetch locked commit %s", entry.Commit), "seed a cache that contains it with repo-cache import"); err != nil {
+			return err
+		}
+		if output, err := exec.Command("git", "-C", repoDir, "fetch", "origin").CombinedOutput(); err != nil {
+			return fmt.Errorf("git fetch failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+		if err := exec.Command("git", "-C", repoDir, "cat-file", "-e", entry.Commit+"^{commit}").Run(); err != nil {
+			if output, err := exec.Command("git", "-C", repoDir, "fetch", "origin", entry.Commit).CombinedOutput(); err != nil {
+				return fmt.Errorf("locked commit %s not found on remote: %w: %s", entry.Commit, err, strings.TrimSpace(string(output)))
+			}
+		}
+	}
+
+	if output, err := exec.Command("git", "-C", repoDir, "reset", "--hard", entry.Commit).CombinedOutput(); err != nil {
+		return fmt.Errorf("git reset failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// registerRecipeRepos merges recipe repositories into RECIPE_REPOS and
+// appends their directories to RECIPE_SEARCH_DIRS, keeping it an array
+func registerRecipeRepos(prefsPath string, recipeRepos map[string]interface{}, searchDirs []string) error {
+	prefs, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		prefs = make(map[string]interface{})
+	}
+
+	if existing, ok := prefs["RECIPE_REPOS"].(map[string]interface{}); ok {
+		for path, data := range existing {
+			if _, restored := recipeRepos[path]; !restored {
+				recipeRepos[path] = data
+			}
+		}
+	}
+
+	if err := UpdateAutoPkgPreferences(prefsPath, map[string]interface{}{
+		"RECIPE_REPOS": recipeRepos,
+	}); err != nil {
+		return err
+	}
+
+	return updatePreferenceDirs(prefsPath, searchDirsPrefsKey, func(dirs []string) []string {
+		for _, dir := range searchDirs {
+			dirs = append(dirs, normalizePreferenceDir(dir))
+		}
+		return dirs
+	})
+}
+
+// expandTilde expands a leading ~/ to the current user's home directory
+func expandTilde(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
+
+// shortSHA abbreviates a commit SHA for logging
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -4,6 +4,8 @@ package autopkg
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"howett.net/plist"
 )
@@ -48,3 +50,87 @@ func parseReport(reportPath string) (map[string]interface{}, error) {
 
 	return parsedResults, nil
 }
+
+// ProducedArtifact describes a package or disk image produced by a recipe run
+type ProducedArtifact struct {
+	Recipe   string `json:"recipe"`
+	App      string `json:"app"`
+	Version  string `json:"version,omitempty"`
+	Path     string `json:"path"`
+	Type     string `json:"type"`                // "pkg", "dmg", "zip", or "app" when found by DiscoverArtifacts
+	BundleID string `json:"bundle_id,omitempty"` // Bundle ID of the app, see DiscoverArtifacts
+}
+
+// producedArtifactSources maps report summary keys to the data row key holding an artifact path
+var producedArtifactSources = []struct {
+	summaryKey string
+	pathKey    string
+}{
+	{"pkg_creator_summary_result", "pkg_path"},
+	{"pkg_copier_summary_result", "pkg_path"},
+	{"dmg_creator_summary_result", "dmg_path"},
+	{"url_downloader_summary_result", "download_path"},
+}
+
+// CollectProducedArtifacts reads an AutoPkg report plist and returns the
+// pkgs, dmgs and zips produced during the run that still exist on disk.
+func CollectProducedArtifacts(reportPath string, recipe string) ([]ProducedArtifact, error) {
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report file: %w", err)
+	}
+
+	var reportData map[string]interface{}
+	if _, err := plist.Unmarshal(data, &reportData); err != nil {
+		return nil, fmt.Errorf("failed to decode report plist: %w", err)
+	}
+
+	artifacts := []ProducedArtifact{}
+	summaryResults, ok := reportData["summary_results"].(map[string]interface{})
+	if !ok {
+		return artifacts, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, source := range producedArtifactSources {
+		for _, row := range reportDataRows(summaryResults[source.summaryKey]) {
+			path, _ := row[source.pathKey].(string)
+			artifactType := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+			if path == "" || seen[path] || (artifactType != "pkg" && artifactType != "dmg" && artifactType != "zip") {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			seen[path] = true
+
+			artifact := ProducedArtifact{
+				Recipe: recipe,
+				Path:   path,
+				Type:   artifactType,
+			}
+			artifact.Version, _ = row["version"].(string)
+			artifact.App = artifactAppName(recipe, path, artifact.Version)
+			artifacts = append(artifacts, artifact)
+		}
+	}
+
+	return artifacts, nil
+}
+
+// artifactAppName derives an app name from the recipe name, falling back to the artifact file name
+func artifactAppName(recipe string, path string, version string) string {
+	if recipe != "" {
+		name := filepath.Base(recipe)
+		if idx := strings.Index(name, "."); idx > 0 {
+			return name[:idx]
+		}
+		return name
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if version != "" {
+		name = strings.TrimSuffix(strings.TrimSuffix(name, version), "-")
+	}
+	return name
+}
@@ -0,0 +1,83 @@
+// retry.go
+package autopkg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// RetryPolicy re-runs recipes whose failure is transient, such as a network
+// timeout, a 5xx from a CDN or a GitHub rate limit. Deterministic failures,
+// e.g. a checksum mismatch, fail the same way every time and are never retried.
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt, 0 disables retrying
+	Backoff    time.Duration // Delay before the first retry, doubled for each one after, defaults to 30s
+	MaxBackoff time.Duration // Longest delay between attempts, defaults to 5m
+}
+
+// withDefaults returns a copy of the policy with unset delays filled in
+func (p *RetryPolicy) withDefaults() RetryPolicy {
+	policy := RetryPolicy{}
+	if p != nil {
+		policy = *p
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = 30 * time.Second
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 5 * time.Minute
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = policy.Backoff
+	}
+	return policy
+}
+
+// delay returns how long to wait before a retry, starting from 1
+func (p RetryPolicy) delay(retry int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// runWithRetry runs a recipe attempt, retrying it with backoff while it fails
+// transiently and the policy allows, and returns the last attempt's output,
+// the number of attempts made and the last attempt's error
+func (o *RecipeBatchRunOptions) runWithRetry(ctx context.Context, recipe string, attempt func() (string, error)) (string, int, error) {
+	output, err := attempt()
+	if o.RetryPolicy == nil || o.RetryPolicy.MaxRetries <= 0 {
+		return output, 1, err
+	}
+
+	policy := o.RetryPolicy.withDefaults()
+	attempts := 1
+	for retry := 1; err != nil && retry <= policy.MaxRetries; retry++ {
+		kind := ClassifyFailure(output, err)
+		if !IsTransientFailure(kind) {
+			break
+		}
+
+		delay := policy.delay(retry)
+		logger.Logger(fmt.Sprintf("🔁 %s failed with %s, retrying in %s (retry %d of %d)", recipe, kind, delay, retry, policy.MaxRetries), logger.LogWarning)
+		select {
+		case <-ctx.Done():
+			return output, attempts, err
+		case <-time.After(delay):
+		}
+
+		output, err = attempt()
+		attempts++
+	}
+	if err == nil && attempts > 1 {
+		logger.Logger(fmt.Sprintf("✅ %s succeeded on attempt %d", recipe, attempts), logger.LogSuccess)
+	}
+	return output, attempts, err
+}
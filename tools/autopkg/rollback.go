@@ -0,0 +1,161 @@
+// rollback.go
+package autopkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// RollbackOptions choose the app, tenant and version to roll back to
+type RollbackOptions struct {
+	App         string // App name, e.g. "Firefox", matched against the recipes of the receipts
+	PrefsPath   string // Preferences of the tenant to roll back
+	StateDir    string
+	HistoryPath string // Defaults to history.db in StateDir
+	ToVersion   string // Version to roll back to, defaults to the one deployed before the current one
+	DryRun      bool   // Plan the rollback without changing the MDM
+}
+
+// RollbackPlan is the rollback of an app on one MDM tenant, from the version
+// last deployed to an earlier one
+type RollbackPlan struct {
+	App         string        `json:"app"`
+	Destination string        `json:"destination"` // MDM integration name, e.g. "jamf"
+	Tenant      string        `json:"tenant"`
+	From        UploadReceipt `json:"from"`
+	To          UploadReceipt `json:"to"`
+	Deployed    string        `json:"deployed,omitempty"` // What the MDM reported deployed before the rollback
+	RolledBack  bool          `json:"rolled_back"`
+	Error       string        `json:"error,omitempty"`
+	skipped     []UploadReceipt
+}
+
+// mdmRollbacks re-point an MDM tenant at the package of an earlier receipt,
+// returning what the MDM had deployed, by integration name
+var mdmRollbacks = map[string]func(prefs map[string]interface{}, plan *RollbackPlan, dryRun bool) (string, error){
+	"jamf":   rollbackJamf,
+	"intune": rollbackIntune,
+}
+
+// Rollback re-points the MDM tenants configured in the preferences at the
+// version of an app deployed before the current one, as recorded by the
+// upload receipts in the history. The receipts rolled back from are marked so
+// another rollback goes further back. Nothing stops the next run of the
+// upload recipe from deploying the newer version again.
+func Rollback(options *RollbackOptions) ([]*RollbackPlan, error) {
+	prefs, err := GetAutoPkgPreferences(options.PrefsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	historyPath := options.HistoryPath
+	if historyPath == "" {
+		historyPath = DefaultHistoryPath(options.StateDir)
+	}
+	history, err := OpenHistory(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer history.Close()
+
+	receipts, err := history.Receipts()
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []*RollbackPlan
+	var problems []string
+	for _, integration := range Integrations() {
+		rollback := mdmRollbacks[integration.Name()]
+		tenant := integration.Tenant(prefs)
+		if rollback == nil || tenant == "" {
+			continue
+		}
+
+		plan, err := planRollback(receipts, options.App, tenant, options.ToVersion)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", integration.DisplayName(), err))
+			continue
+		}
+		if plan == nil {
+			continue
+		}
+		plan.Destination = integration.Name()
+		plans = append(plans, plan)
+
+		plan.Deployed, err = rollback(prefs, plan, options.DryRun)
+		if err != nil {
+			plan.Error = err.Error()
+			logger.Logger(fmt.Sprintf("❌ Failed to roll back %s on %s: %v", plan.App, tenant, err), logger.LogError)
+			continue
+		}
+		if options.DryRun {
+			logger.Logger(fmt.Sprintf("🔍 Would roll back %s on %s from %s to %s", plan.App, tenant, plan.From.Version, plan.To.Version), logger.LogInfo)
+			continue
+		}
+
+		plan.RolledBack = true
+		for _, receipt := range append(plan.skipped, plan.From) {
+			receipt.RolledBack = true
+			if err := history.RecordReceipt(receipt); err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Failed to mark receipt %s as rolled back: %v", receipt.Key, err), logger.LogWarning)
+			}
+		}
+		logger.Logger(fmt.Sprintf("⏪ Rolled back %s on %s from %s to %s", plan.App, tenant, plan.From.Version, plan.To.Version), logger.LogSuccess)
+		logger.Logger(fmt.Sprintf("⚠️ The next run of %s will deploy %s again unless it's excluded from the batch", plan.From.Recipe, plan.From.Version), logger.LogWarning)
+	}
+
+	if len(plans) == 0 && len(problems) == 0 {
+		return nil, fmt.Errorf("no uploads of %s recorded for the Jamf Pro or Intune tenants in %s", options.App, options.PrefsPath)
+	}
+	if len(problems) > 0 {
+		err = fmt.Errorf("can't roll back %s:\n  - %s", options.App, strings.Join(problems, "\n  - "))
+	}
+	for _, plan := range plans {
+		if plan.Error != "" && err == nil {
+			err = fmt.Errorf("failed to roll back %s on %s: %s", plan.App, plan.Tenant, plan.Error)
+		}
+	}
+	return plans, err
+}
+
+// planRollback finds the current and previous versions of an app deployed to
+// a tenant from the MDM receipts not yet rolled back, returning nil when the
+// app was never uploaded to the tenant
+func planRollback(receipts []UploadReceipt, app, tenant, toVersion string) (*RollbackPlan, error) {
+	var deployed []UploadReceipt
+	for _, receipt := range receipts {
+		if receipt.Phase != ReceiptPhaseMDM || receipt.Tenant != tenant || receipt.RolledBack {
+			continue
+		}
+		if strings.EqualFold(artifactAppName(receipt.Recipe, "", ""), app) {
+			deployed = append(deployed, receipt)
+		}
+	}
+	if len(deployed) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(deployed, func(i, j int) bool {
+		return deployed[i].Timestamp.Before(deployed[j].Timestamp)
+	})
+
+	plan := &RollbackPlan{App: app, Tenant: tenant, From: deployed[len(deployed)-1]}
+	for i := len(deployed) - 2; i >= 0; i-- {
+		receipt := deployed[i]
+		if receipt.Version == plan.From.Version {
+			continue
+		}
+		if toVersion == "" || receipt.Version == toVersion {
+			plan.To = receipt
+			plan.skipped = deployed[i+1 : len(deployed)-1]
+			return plan, nil
+		}
+	}
+	if toVersion != "" {
+		return nil, fmt.Errorf("%s %s was never deployed to %s before %s", app, toVersion, tenant, plan.From.Version)
+	}
+	return nil, fmt.Errorf("only %s %s was deployed to %s, there's nothing to roll back to", app, plan.From.Version, tenant)
+}
@@ -0,0 +1,117 @@
+// run_lock.go
+package autopkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// ErrRunInProgress is returned when another autopkgctl run holds the lock on the same preferences
+var ErrRunInProgress = errors.New("another run is in progress")
+
+// runLockPollInterval is how often a waiting run retries the lock
+const runLockPollInterval = 500 * time.Millisecond
+
+// RunLock is an advisory lock on a set of AutoPkg preferences, held while a
+// run or cleanup uses their cache so overlapping scheduled runs don't corrupt
+// it or upload twice. The lock is released when the process exits.
+type RunLock struct {
+	Path string
+	file *os.File
+}
+
+// RunLockPath returns the lock file of a preferences file, in the temporary
+// directory and named after a hash of its absolute path
+func RunLockPath(prefsPath string) string {
+	if prefsPath == "" {
+		homeDir, _ := os.UserHomeDir()
+		prefsPath = filepath.Join(homeDir, "Library/Preferences/com.github.autopkg.plist")
+	}
+	if abs, err := filepath.Abs(expandTilde(prefsPath)); err == nil {
+		prefsPath = abs
+	}
+
+	sum := sha256.Sum256([]byte(prefsPath))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("autopkgctl-%s.lock", hex.EncodeToString(sum[:])[:16]))
+}
+
+// AcquireRunLock takes the run lock of a preferences file. When another run
+// holds it, it waits up to timeout for that run to finish, or fails straight
+// away with ErrRunInProgress when timeout is 0. A negative timeout waits
+// for as long as it takes.
+func AcquireRunLock(prefsPath string, command string, timeout time.Duration) (*RunLock, error) {
+	path := RunLockPath(prefsPath)
+	prefs := prefsPath
+	if prefs == "" {
+		prefs = "the default preferences"
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run lock %s: %w", path, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		holder := runLockHolder(path)
+		if timeout == 0 || (timeout > 0 && time.Now().After(deadline)) {
+			file.Close()
+			if timeout > 0 {
+				return nil, fmt.Errorf("%w on %s (%s), gave up after waiting %s", ErrRunInProgress, prefs, holder, timeout)
+			}
+			return nil, fmt.Errorf("%w on %s (%s), pass --wait or --lock-timeout to wait for it", ErrRunInProgress, prefs, holder)
+		}
+		if !waiting {
+			logger.Logger(fmt.Sprintf("⏳ Waiting for another run to finish (%s)", holder), logger.LogInfo)
+			waiting = true
+		}
+		time.Sleep(runLockPollInterval)
+	}
+
+	// Record the holder for the error other runs report
+	holder := fmt.Sprintf("%s, pid %d, started %s", command, os.Getpid(), time.Now().Format(time.RFC3339))
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(holder+"\n"), 0)
+	}
+
+	logger.Logger(fmt.Sprintf("🔒 Acquired run lock %s", path), logger.LogDebug)
+	return &RunLock{Path: path, file: file}, nil
+}
+
+// runLockHolder describes the run holding a lock, as it recorded itself
+func runLockHolder(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) == "" {
+		return "holder unknown"
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Release gives up the run lock. The file is left in place, since removing it
+// could let a waiting run and a new one lock different files.
+func (l *RunLock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+	l.file = nil
+}
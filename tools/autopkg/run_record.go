@@ -0,0 +1,233 @@
+// run_record.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// RunRecord is the persisted record of a single batch run
+type RunRecord struct {
+	RunID       string            `json:"run_id"`
+	StartTime   time.Time         `json:"start_time"`
+	EndTime     time.Time         `json:"end_time"`
+	Status      string            `json:"status"` // "success" or "failure"
+	Chaos       bool              `json:"chaos,omitempty"`
+	CheckOnly   bool              `json:"check_only,omitempty"`
+	Recipes     []RecipeRunRecord `json:"recipes"`
+	Changes     []VersionChange   `json:"changes,omitempty"`
+	Health      []HealthAlert     `json:"health,omitempty"`
+	Annotations []RunAnnotation   `json:"annotations,omitempty"`
+}
+
+// RecipeRunRecord is the persisted outcome of one recipe within a batch run
+type RecipeRunRecord struct {
+	Recipe      string        `json:"recipe"`
+	Status      string        `json:"status"`
+	Duration    time.Duration `json:"duration"`
+	Error       string        `json:"error,omitempty"`
+	SBOMs       []string      `json:"sboms,omitempty"`
+	ChaosFault  string        `json:"chaos_fault,omitempty"`
+	SkipReason  string        `json:"skip_reason,omitempty"`
+	FailureKind string        `json:"failure_kind,omitempty"`
+	Attempts    int           `json:"attempts,omitempty"`
+	Usage       *RecipeUsage  `json:"usage,omitempty"`
+	LogPath     string        `json:"log_path,omitempty"` // Archived log of the recipe's output
+}
+
+// RunAnnotation is a note attached to a run by an operator
+type RunAnnotation struct {
+	Author    string    `json:"author,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Note      string    `json:"note"`
+}
+
+// DefaultStateDir returns the directory used for run records and other persisted state
+func DefaultStateDir() string {
+	if stateDir := os.Getenv("AUTOPKGCTL_STATE_DIR"); stateDir != "" {
+		return stateDir
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "Library/AutoPkg/autopkgctl")
+}
+
+// runIDPattern is what a run ID must look like, so it can't escape the
+// directories run records and logs are kept in
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateRunID checks that a run ID can be used as a file name within the state directory
+func ValidateRunID(runID string) error {
+	if !runIDPattern.MatchString(runID) {
+		return fmt.Errorf("invalid run ID %q: use letters, digits, '.', '_' and '-', starting with a letter or digit", runID)
+	}
+	return nil
+}
+
+// runRecordPath returns the path of a run record within the state directory
+func runRecordPath(stateDir string, runID string) (string, error) {
+	if err := ValidateRunID(runID); err != nil {
+		return "", err
+	}
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+	return filepath.Join(stateDir, "runs", runID+".json"), nil
+}
+
+// NewRunRecord builds a run record from batch results
+func NewRunRecord(runID string, results map[string]*RecipeBatchResult, startTime time.Time) *RunRecord {
+	record := &RunRecord{
+		RunID:     runID,
+		StartTime: startTime,
+		EndTime:   time.Now(),
+		Status:    "success",
+		Recipes:   []RecipeRunRecord{},
+	}
+
+	for recipe, result := range results {
+		recipeRecord := RecipeRunRecord{
+			Recipe:      recipe,
+			Status:      result.Status,
+			Duration:    result.ExecutionTime,
+			SBOMs:       result.SBOMs,
+			ChaosFault:  result.ChaosFault,
+			SkipReason:  result.SkipReason,
+			FailureKind: result.FailureKind,
+			Attempts:    result.Attempts,
+			Usage:       result.Usage,
+			LogPath:     result.LogPath,
+		}
+		if result.ExecutionError != nil {
+			recipeRecord.Error = result.ExecutionError.Error()
+		} else if result.VerificationError != nil {
+			recipeRecord.Error = result.VerificationError.Error()
+		}
+		if result.Status == "failed" {
+			record.Status = "failure"
+		}
+		record.Recipes = append(record.Recipes, recipeRecord)
+	}
+
+	sort.Slice(record.Recipes, func(i, j int) bool {
+		return record.Recipes[i].Recipe < record.Recipes[j].Recipe
+	})
+
+	return record
+}
+
+// SaveRunRecord writes a run record to the state directory
+func SaveRunRecord(stateDir string, record *RunRecord) error {
+	recordPath, err := runRecordPath(stateDir, record.RunID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(recordPath), 0755); err != nil {
+		return fmt.Errorf("failed to create run record directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run record: %w", err)
+	}
+
+	if err := os.WriteFile(recordPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write run record: %w", err)
+	}
+
+	return nil
+}
+
+// LoadRunRecord reads a single run record from the state directory
+func LoadRunRecord(stateDir string, runID string) (*RunRecord, error) {
+	recordPath, err := runRecordPath(stateDir, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(recordPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run %s not found", runID)
+		}
+		return nil, fmt.Errorf("failed to read run record: %w", err)
+	}
+
+	var record RunRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse run record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// ListRunRecords returns run records started at or after since, newest first.
+// A zero since returns every record.
+func ListRunRecords(stateDir string, since time.Time) ([]*RunRecord, error) {
+	if stateDir == "" {
+		stateDir = DefaultStateDir()
+	}
+
+	entries, err := os.ReadDir(filepath.Join(stateDir, "runs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*RunRecord{}, nil
+		}
+		return nil, fmt.Errorf("failed to read run records: %w", err)
+	}
+
+	records := []*RunRecord{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		record, err := LoadRunRecord(stateDir, strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Skipping unreadable run record %s: %v", entry.Name(), err), logger.LogWarning)
+			continue
+		}
+		if !since.IsZero() && record.StartTime.Before(since) {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].StartTime.After(records[j].StartTime)
+	})
+
+	return records, nil
+}
+
+// AnnotateRun attaches a note to an existing run record
+func AnnotateRun(stateDir string, runID string, author string, note string) (*RunRecord, error) {
+	if strings.TrimSpace(note) == "" {
+		return nil, fmt.Errorf("annotation note is required")
+	}
+
+	record, err := LoadRunRecord(stateDir, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Annotations = append(record.Annotations, RunAnnotation{
+		Author:    author,
+		Timestamp: time.Now().UTC(),
+		Note:      note,
+	})
+
+	if err := SaveRunRecord(stateDir, record); err != nil {
+		return nil, err
+	}
+
+	logger.Logger(fmt.Sprintf("📝 Annotated run %s", runID), logger.LogSuccess)
+	return record, nil
+}
@@ -0,0 +1,105 @@
+// safety.go
+package autopkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// ProductionPrefsKey marks an AutoPkg preferences file as targeting production MDM tenants
+const ProductionPrefsKey = "AUTOPKGCTL_PRODUCTION"
+
+// ciEnvironmentVariables are set by the CI systems we treat as trusted runners
+var ciEnvironmentVariables = []string{
+	"GITHUB_ACTIONS",
+	"GITLAB_CI",
+	"JENKINS_URL",
+	"BUILDKITE",
+	"CIRCLECI",
+	"TF_BUILD",
+	"TEAMCITY_VERSION",
+	"BITBUCKET_BUILD_NUMBER",
+	"CI",
+}
+
+// IsProductionPrefs reports whether a preferences file is flagged as production
+func IsProductionPrefs(prefsPath string) bool {
+	prefs, err := GetAutoPkgPreferences(prefsPath)
+	if err != nil {
+		return false
+	}
+
+	switch value := prefs[ProductionPrefsKey].(type) {
+	case bool:
+		return value
+	case string:
+		return strings.EqualFold(value, "true") || value == "1"
+	}
+	return false
+}
+
+// DetectCIEnvironment returns the CI environment variable that is set, if any
+func DetectCIEnvironment() (string, bool) {
+	for _, name := range ciEnvironmentVariables {
+		if value := os.Getenv(name); value != "" && !strings.EqualFold(value, "false") {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// ConfirmProductionRun guards against running against production preferences
+// from a developer machine. Runs in a recognised CI environment, or with
+// confirmed set (--confirm-prod), are allowed. Otherwise an interactive
+// terminal is asked to type "production", and non-interactive runs are refused.
+func ConfirmProductionRun(prefsPath string, confirmed bool, in io.Reader, out io.Writer) error {
+	if !IsProductionPrefs(prefsPath) {
+		return nil
+	}
+
+	if ciVar, ok := DetectCIEnvironment(); ok {
+		logger.Logger(fmt.Sprintf("🏭 Production preferences in CI environment (%s)", ciVar), logger.LogDebug)
+		return nil
+	}
+
+	if confirmed {
+		logger.Logger("⚠️ Running against production preferences outside CI (confirmed with --confirm-prod)", logger.LogWarning)
+		return nil
+	}
+
+	if !isInteractive(in) {
+		return fmt.Errorf("preferences are flagged production and this is not a CI environment; re-run with --confirm-prod to proceed")
+	}
+
+	fmt.Fprintln(out, "⚠️  These preferences are flagged as PRODUCTION and this does not look like a CI runner.")
+	fmt.Fprint(out, "Type 'production' to continue: ")
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	if strings.TrimSpace(answer) != "production" {
+		return fmt.Errorf("production run not confirmed")
+	}
+
+	return nil
+}
+
+// isInteractive reports whether the reader is a terminal
+func isInteractive(in io.Reader) bool {
+	file, ok := in.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// /dev/null is a character device too, but nobody can answer a prompt on it
+	if devNull, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, devNull) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+// sandbox.go
+package autopkg
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// sandboxRepo is a fake recipe repo whose recipes "download" and "upload" with
+// stub processors, so the pipeline can be exercised without network access,
+// credentials or real MDM tenants
+//
+//go:embed sandbox
+var sandboxRepo embed.FS
+
+// Sandbox is a self-contained AutoPkg environment for trying out the pipeline
+type Sandbox struct {
+	Dir               string
+	PrefsPath         string
+	RepoDir           string // The bundled fake recipe repo
+	StateDir          string // Run records and history, kept apart from real runs
+	ReportPath        string
+	NotificationsPath string // Slack and Teams notifications are written here instead of sent
+	UploadsPath       string // Stub uploaders record their uploads here
+	Recipes           []string
+}
+
+// DefaultSandboxDir returns the directory the sandbox is created in by default
+func DefaultSandboxDir() string {
+	return filepath.Join(os.TempDir(), "autopkgctl-sandbox")
+}
+
+// PrepareSandbox writes the bundled recipe repo and a credential-free AutoPkg
+// preferences file into a directory, reusing it when it already exists so
+// repeated runs show unchanged recipes and history
+func PrepareSandbox(dir string) (*Sandbox, error) {
+	if dir == "" {
+		dir = DefaultSandboxDir()
+	}
+
+	sandbox := &Sandbox{
+		Dir:               dir,
+		PrefsPath:         filepath.Join(dir, "com.github.autopkg.plist"),
+		RepoDir:           filepath.Join(dir, "RecipeRepos", "com.github.autopkgctl.sandbox"),
+		StateDir:          filepath.Join(dir, "state"),
+		ReportPath:        filepath.Join(dir, "report.plist"),
+		NotificationsPath: filepath.Join(dir, "notifications.jsonl"),
+		UploadsPath:       filepath.Join(dir, "uploads.jsonl"),
+	}
+
+	err := fs.WalkDir(sandboxRepo, "sandbox", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		data, err := sandboxRepo.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(sandbox.RepoDir, strings.TrimPrefix(path, "sandbox/"))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(entry.Name(), ".recipe") {
+			sandbox.Recipes = append(sandbox.Recipes, entry.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write sandbox recipe repo: %w", err)
+	}
+
+	for _, subdir := range []string{"RecipeOverrides", "Cache", "state"} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+		}
+	}
+
+	err = UpdateAutoPkgPreferences(sandbox.PrefsPath, map[string]interface{}{
+		"CACHE_DIR":            filepath.Join(dir, "Cache"),
+		"RECIPE_REPO_DIR":      filepath.Join(dir, "RecipeRepos"),
+		"RECIPE_OVERRIDE_DIRS": []interface{}{filepath.Join(dir, "RecipeOverrides")},
+		"RECIPE_SEARCH_DIRS":   []interface{}{".", sandbox.RepoDir},
+		"RECIPE_REPOS": map[string]interface{}{
+			sandbox.RepoDir: map[string]interface{}{"URL": "sandbox"},
+		},
+		"SANDBOX_UPLOADS_FILE": sandbox.UploadsPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write sandbox preferences: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("🧪 Sandbox ready in %s with %d recipes", dir, len(sandbox.Recipes)), logger.LogInfo)
+	return sandbox, nil
+}
+
+// NotificationsURL returns the webhook URL that makes notifiers write to the sandbox notifications file
+func (s *Sandbox) NotificationsURL() string {
+	return "file://" + s.NotificationsPath
+}
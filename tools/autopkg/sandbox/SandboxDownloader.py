@@ -0,0 +1,60 @@
+#!/usr/local/autopkg/python
+"""Sandbox stand-in for URLDownloader that writes a fake archive instead of
+fetching one, so the pipeline can run without network access."""
+
+import os
+
+from autopkglib import Processor, ProcessorError
+
+__all__ = ["SandboxDownloader"]
+
+
+class SandboxDownloader(Processor):
+    """Writes a fake download for a sandbox app."""
+
+    description = __doc__
+    input_variables = {
+        "NAME": {"required": True, "description": "Name of the sandbox app."},
+        "version": {"required": True, "description": "Version to pretend to download."},
+        "fail": {
+            "required": False,
+            "default": False,
+            "description": "Fail on purpose to exercise failure handling.",
+        },
+    }
+    output_variables = {
+        "pathname": {"description": "Path to the fake download."},
+        "version": {"description": "Version of the fake download."},
+        "download_changed": {"description": "True if a new version was written."},
+        "url_downloader_summary_result": {"description": "Summary of the download."},
+    }
+
+    def main(self):
+        if self.env.get("fail"):
+            raise ProcessorError(f"Sandbox download of {self.env['NAME']} failed on purpose")
+
+        name = self.env["NAME"]
+        version = self.env["version"]
+        download_dir = os.path.join(self.env["RECIPE_CACHE_DIR"], "downloads")
+        os.makedirs(download_dir, exist_ok=True)
+        path = os.path.join(download_dir, f"{name}-{version}.zip")
+
+        changed = not os.path.exists(path)
+        if changed:
+            with open(path, "w") as download:
+                download.write(f"{name} {version}\n")
+            self.output(f"Downloaded new version {version} to {path}", verbose_level=0)
+            self.env["url_downloader_summary_result"] = {
+                "summary_text": "The following new items were downloaded:",
+                "data_rows": [{"download_path": path, "version": version}],
+            }
+        else:
+            self.output(f"{name} {version} is already downloaded")
+
+        self.env["pathname"] = path
+        self.env["download_changed"] = changed
+
+
+if __name__ == "__main__":
+    PROCESSOR = SandboxDownloader()
+    PROCESSOR.execute_shell()
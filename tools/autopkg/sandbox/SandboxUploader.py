@@ -0,0 +1,70 @@
+#!/usr/local/autopkg/python
+"""Sandbox stand-in for JamfPackageUploader and IntuneAppUploader that records
+the upload in a local file instead of contacting an MDM."""
+
+import json
+import os
+from datetime import datetime, timezone
+
+from autopkglib import Processor, ProcessorError
+
+__all__ = ["SandboxUploader"]
+
+SUMMARY_KEYS = {
+    "jamf": "jamfpackageuploader_summary_result",
+    "intune": "intuneappuploader_summary_result",
+}
+
+
+class SandboxUploader(Processor):
+    """Records a fake upload to Jamf Pro or Intune."""
+
+    description = __doc__
+    input_variables = {
+        "destination": {"required": True, "description": "jamf or intune."},
+        "NAME": {"required": True, "description": "Name of the sandbox app."},
+        "version": {"required": True, "description": "Version being uploaded."},
+        "pathname": {"required": True, "description": "Path to the artifact."},
+        "SANDBOX_UPLOADS_FILE": {
+            "required": True,
+            "description": "JSON lines file the uploads are recorded in.",
+        },
+    }
+    output_variables = {
+        "jamfpackageuploader_summary_result": {"description": "Summary of a Jamf upload."},
+        "intuneappuploader_summary_result": {"description": "Summary of an Intune upload."},
+    }
+
+    def main(self):
+        destination = self.env["destination"]
+        if destination not in SUMMARY_KEYS:
+            raise ProcessorError(f"Unknown sandbox destination {destination}")
+
+        if not self.env.get("download_changed", True):
+            self.output(f"Nothing new to upload to {destination}")
+            return
+
+        upload = {
+            "destination": destination,
+            "name": self.env["NAME"],
+            "version": self.env["version"],
+            "pkg_path": self.env["pathname"],
+            "timestamp": datetime.now(timezone.utc).isoformat(),
+        }
+        uploads_file = self.env["SANDBOX_UPLOADS_FILE"]
+        os.makedirs(os.path.dirname(uploads_file), exist_ok=True)
+        with open(uploads_file, "a") as uploads:
+            uploads.write(json.dumps(upload) + "\n")
+
+        self.output(f"Pretended to upload {upload['name']} {upload['version']} to {destination}", verbose_level=0)
+        self.env[SUMMARY_KEYS[destination]] = {
+            "summary_text": f"The following packages were uploaded to the {destination} sandbox:",
+            "data_rows": [
+                {"name": upload["name"], "version": upload["version"], "pkg_path": upload["pkg_path"]}
+            ],
+        }
+
+
+if __name__ == "__main__":
+    PROCESSOR = SandboxUploader()
+    PROCESSOR.execute_shell()
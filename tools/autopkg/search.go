@@ -0,0 +1,126 @@
+// search.go
+package autopkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// RecipeSearchResult is a single recipe found by autopkg search
+type RecipeSearchResult struct {
+	Name  string   `json:"name"`
+	Repo  string   `json:"repo"`
+	Path  string   `json:"path"`
+	Terms []string `json:"terms"` // Search terms that matched the recipe
+}
+
+// SearchRecipeResults searches GitHub for each term and merges the results,
+// ranking recipes that match more of the terms first
+func SearchRecipeResults(terms []string, options *SearchOptions) ([]RecipeSearchResult, error) {
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search term is required")
+	}
+
+	searchOpts := &SearchOptions{}
+	if options != nil {
+		*searchOpts = *options
+	}
+	// Paths only output drops the name and repo columns the results are parsed from
+	searchOpts.PathOnly = false
+
+	var results []RecipeSearchResult
+	index := make(map[string]int)
+
+	for _, term := range terms {
+		output, err := SearchRecipes(term, searchOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range ParseSearchOutput(output) {
+			key := result.Repo + "/" + result.Path
+			if i, found := index[key]; found {
+				results[i].Terms = appendUnique(results[i].Terms, term)
+				continue
+			}
+			result.Terms = []string{term}
+			index[key] = len(results)
+			results = append(results, result)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return len(results[i].Terms) > len(results[j].Terms)
+	})
+
+	logger.Logger(fmt.Sprintf("🔍 Found %d recipes matching %s", len(results), strings.Join(terms, ", ")), logger.LogInfo)
+	return results, nil
+}
+
+// ParseSearchOutput parses the Name/Repo/Path table printed by autopkg search.
+// Columns are located from the header, as recipe paths may contain spaces.
+func ParseSearchOutput(output string) []RecipeSearchResult {
+	var results []RecipeSearchResult
+	repoCol, pathCol := -1, -1
+
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if repoCol < 0 {
+			if strings.HasPrefix(trimmed, "Name") && strings.Contains(line, "Repo") && strings.Contains(line, "Path") {
+				repoCol = strings.Index(line, "Repo")
+				pathCol = strings.Index(line, "Path")
+			}
+			continue
+		}
+
+		// The table ends at the first blank line, followed by repo-add hints
+		if trimmed == "" {
+			if len(results) > 0 {
+				break
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "----") || len(line) <= pathCol {
+			continue
+		}
+
+		result := RecipeSearchResult{
+			Name: strings.TrimSpace(line[:repoCol]),
+			Repo: strings.TrimSpace(line[repoCol:pathCol]),
+			Path: strings.TrimSpace(line[pathCol:]),
+		}
+		if result.Name == "" || result.Repo == "" {
+			continue
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// OfferRepoAdd asks an interactive terminal whether to add the repository of
+// a search result, and adds it when confirmed. Non-interactive runs are never
+// prompted and add nothing.
+func OfferRepoAdd(result RecipeSearchResult, prefsPath string, in io.Reader, out io.Writer) (bool, error) {
+	if !isInteractive(in) {
+		logger.Logger(fmt.Sprintf("ℹ️ Not a terminal, not offering to add %s", result.Repo), logger.LogInfo)
+		return false, nil
+	}
+
+	fmt.Fprintf(out, "Add repo %s for %s? [y/N]: ", result.Repo, result.Name)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return false, nil
+	}
+
+	if _, err := AddRepo([]string{result.Repo}, prefsPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
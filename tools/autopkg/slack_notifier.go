@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
 )
 
 // RecipeLifecycle represents an AutoPkg recipe and its state.
@@ -19,6 +21,7 @@ type RecipeLifecycle struct {
 	Promoted       bool                   // Indicates if the recipe was promoted to production
 	Verified       *bool                  // Indicates if the recipe passed verification
 	Results        map[string]interface{} // Additional details about the recipe execution
+	LogPath        string                 // Archived log of the recipe's output, if any
 }
 
 // SlackNotifier is responsible for sending notifications to Slack.
@@ -70,6 +73,10 @@ func (s *SlackNotifier) Notify(title, message, color string) error {
 		return fmt.Errorf("failed to marshal Slack payload: %w", err)
 	}
 
+	if path, ok := localNotificationPath(s.WebhookURL); ok {
+		return appendLocalNotification(path, jsonData)
+	}
+
 	resp, err := http.Post(s.WebhookURL, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to send Slack notification: %w", err)
@@ -89,12 +96,13 @@ func (s *SlackNotifier) NotifySlack(recipe *RecipeLifecycle) {
 	var title, message, color string
 
 	if recipe.Verified != nil && !*recipe.Verified {
-		title = fmt.Sprintf("❌ %s failed trust verification", recipe.Name)
-		message = "Update trust verification manually."
+		title = i18n.T("notify.trust_failed.title", recipe.Name)
+		message = i18n.T("notify.trust_failed.message")
+		message += notificationLogField(recipe.LogPath, "\n\n")
 		color = "warning"
 	} else if recipe.Error {
-		title = fmt.Sprintf("❌ %s failed", recipe.Name)
-		message = "Unknown error"
+		title = i18n.T("notify.failed.title", recipe.Name)
+		message = i18n.T("notify.unknown_error")
 		if failed, ok := recipe.Results["failed"].([]interface{}); ok && len(failed) > 0 {
 			if first, ok := failed[0].(map[string]interface{}); ok {
 				if msg, exists := first["message"].(string); exists {
@@ -105,20 +113,22 @@ func (s *SlackNotifier) NotifySlack(recipe *RecipeLifecycle) {
 		if strings.Contains(message, "No releases found for repo") {
 			return
 		}
+		message += notificationLogField(recipe.LogPath, "\n\n")
 		color = "danger"
 	} else if recipe.Updated {
-		title = fmt.Sprintf("✅ Imported %s %s", recipe.Name, recipe.UpdatedVersion)
-		message = fmt.Sprintf("**Name:** %s\n\n", recipe.Name)
+		title = i18n.T("notify.imported.title", recipe.Name, recipe.UpdatedVersion)
+		message = fmt.Sprintf("**%s:** %s\n\n", i18n.T("field.name"), recipe.Name)
 		if imported, ok := recipe.Results["imported"].([]interface{}); ok && len(imported) > 0 {
 			if first, ok := imported[0].(map[string]interface{}); ok {
 				if appID, exists := first["intune_app_id"].(string); exists {
-					message += fmt.Sprintf("**Intune App ID:** %s\n\n", appID)
+					message += fmt.Sprintf("**%s:** %s\n\n", i18n.T("field.intune_app_id"), appID)
 				}
 				if contentVersion, exists := first["content_version_id"].(string); exists {
-					message += fmt.Sprintf("**Content Version ID:** %s\n\n", contentVersion)
+					message += fmt.Sprintf("**%s:** %s\n\n", i18n.T("field.content_version_id"), contentVersion)
 				}
 			}
 		}
+		message += notificationLogField(recipe.LogPath, "")
 		color = "good"
 	} else {
 		return
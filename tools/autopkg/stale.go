@@ -0,0 +1,105 @@
+// stale.go
+package autopkg
+
+import (
+	"sort"
+	"time"
+
+	versionoracle "github.com/deploymenttheory/macos-autopkg-factory/tools/version_oracle"
+)
+
+// StaleOptions configures FindStaleRecipes
+type StaleOptions struct {
+	Window  time.Duration // Recipes without a new version for this long are stale, defaults to 180 days
+	Catalog *Catalog      // Catalog entries with a version_url are checked against the vendor's latest version
+}
+
+// StaleRecipe is a recipe that keeps running without producing a new
+// version, which is either a slow vendor or a dead download URL that
+// "succeeds" with the version it found long ago
+type StaleRecipe struct {
+	Recipe          string    `json:"recipe"`
+	Version         string    `json:"version,omitempty"` // Last version the recipe built
+	LastUpdated     time.Time `json:"last_updated"`      // When it built that version, or first ran if it never updated
+	DaysSinceUpdate int       `json:"days_since_update"`
+	LastRun         time.Time `json:"last_run"`
+	LastStatus      string    `json:"last_status"`
+	VendorVersion   string    `json:"vendor_version,omitempty"` // Latest version the vendor lists, if the catalog says where
+	VendorError     string    `json:"vendor_error,omitempty"`
+	Behind          bool      `json:"behind"` // The vendor lists a newer version than the recipe built
+}
+
+// FindStaleRecipes returns the recipes in the run history that still run
+// but haven't produced a new version within the window. Recipes that
+// haven't run within the window are retired rather than stale and left out.
+// Recipes behind the version their vendor lists come first, then the
+// longest stale.
+func FindStaleRecipes(history *History, options StaleOptions) ([]StaleRecipe, error) {
+	if options.Window <= 0 {
+		options.Window = 180 * 24 * time.Hour
+	}
+	now := time.Now()
+	cutoff := now.Add(-options.Window)
+
+	recipes, err := history.Recipes()
+	if err != nil {
+		return nil, err
+	}
+
+	stale := []StaleRecipe{}
+	for _, recipe := range recipes {
+		entries, err := history.RecipeHistory(recipe, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 || entries[len(entries)-1].Timestamp.Before(cutoff) {
+			continue
+		}
+
+		last := entries[len(entries)-1]
+		candidate := StaleRecipe{
+			Recipe:      recipe,
+			LastUpdated: entries[0].Timestamp,
+			LastRun:     last.Timestamp,
+			LastStatus:  last.Status,
+		}
+		for _, entry := range entries {
+			if entry.Status == "updated" {
+				candidate.LastUpdated = entry.Timestamp
+			}
+			if entry.Version != "" && entry.Status != "failed" {
+				candidate.Version = entry.Version
+			}
+		}
+		if candidate.LastUpdated.After(cutoff) {
+			continue
+		}
+		candidate.DaysSinceUpdate = int(now.Sub(candidate.LastUpdated).Hours() / 24)
+
+		if entry := options.Catalog.Entry(recipe); entry != nil && entry.VersionURL != "" {
+			vendorVersion, err := VendorLatestVersion(entry)
+			if err != nil {
+				candidate.VendorError = err.Error()
+			} else {
+				candidate.VendorVersion = vendorVersion
+				candidate.Behind = candidate.Version != "" && versionoracle.Compare(vendorVersion, candidate.Version) > 0
+			}
+		}
+
+		stale = append(stale, candidate)
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].Behind != stale[j].Behind {
+			return stale[i].Behind
+		}
+		return stale[i].LastUpdated.Before(stale[j].LastUpdated)
+	})
+	return stale, nil
+}
+
+// VendorLatestVersion fetches the version_url of a catalog entry and returns
+// the first group of its version_pattern, or the first dotted version
+func VendorLatestVersion(entry *CatalogEntry) (string, error) {
+	return (&versionoracle.VendorURL{}).Latest(versionoracle.Query{App: entry.Recipe, URL: entry.VersionURL, Pattern: entry.VersionPattern})
+}
@@ -0,0 +1,329 @@
+// storage.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"howett.net/plist"
+)
+
+// UploadedArtifact describes a single artifact uploaded to an MDM service during a run
+type UploadedArtifact struct {
+	Recipe      string `json:"recipe"`
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Destination string `json:"destination"` // MDM integration name, e.g. "jamf" or "intune"
+	SizeBytes   int64  `json:"size_bytes"`
+	Package     string `json:"package,omitempty"` // Package name in the MDM, e.g. Firefox-128.0.pkg in Jamf Pro
+	Policy      string `json:"policy,omitempty"`  // Jamf Pro policy JamfPolicyUploader pointed at the package
+}
+
+// StorageUsage contains the estimated MDM storage consumed by a single run
+type StorageUsage struct {
+	RunID         string             `json:"run_id"`
+	Timestamp     time.Time          `json:"timestamp"`
+	Artifacts     []UploadedArtifact `json:"artifacts"`
+	TotalBytes    int64              `json:"total_bytes"`
+	ByDestination map[string]int64   `json:"by_destination"`
+}
+
+// MonthlyStorage contains aggregated storage usage for a calendar month
+type MonthlyStorage struct {
+	Month         string           `json:"month"` // YYYY-MM
+	Runs          int              `json:"runs"`
+	TotalBytes    int64            `json:"total_bytes"`
+	ByDestination map[string]int64 `json:"by_destination"`
+	ByApp         map[string]int64 `json:"by_app"`
+}
+
+// EstimateStorageUsage reads an AutoPkg report plist and sums the size of every
+// artifact uploaded to Jamf Cloud or Intune by the recipe that produced it.
+func EstimateStorageUsage(reportPath string, recipe string) (*StorageUsage, error) {
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report file: %w", err)
+	}
+
+	var reportData map[string]interface{}
+	if _, err := plist.Unmarshal(data, &reportData); err != nil {
+		return nil, fmt.Errorf("failed to decode report plist: %w", err)
+	}
+
+	usage := &StorageUsage{
+		Timestamp:     time.Now(),
+		Artifacts:     []UploadedArtifact{},
+		ByDestination: make(map[string]int64),
+	}
+
+	summaryResults, ok := reportData["summary_results"].(map[string]interface{})
+	if !ok {
+		return usage, nil
+	}
+
+	// Intune uploader rows do not carry the package path, so fall back to the
+	// packages created earlier in the same run.
+	createdPkgs := collectReportPaths(summaryResults["pkg_creator_summary_result"], "pkg_path")
+	policies := collectReportPaths(summaryResults["jamfpolicyuploader_summary_result"], "policy")
+
+	for _, integration := range Integrations() {
+		destination := integration.Name()
+		rows := reportDataRows(summaryResults[integration.SummaryKey()])
+		for _, row := range rows {
+			artifact := UploadedArtifact{
+				Recipe:      recipe,
+				Destination: destination,
+			}
+			artifact.Name, _ = row["name"].(string)
+			artifact.Version, _ = row["version"].(string)
+			artifact.Path = firstReportPath(row)
+
+			if artifact.Path == "" && len(createdPkgs) > 0 {
+				artifact.Path = matchCreatedPackage(createdPkgs, artifact.Name)
+			}
+
+			if artifact.Path != "" {
+				if info, err := os.Stat(artifact.Path); err == nil {
+					artifact.SizeBytes = info.Size()
+				} else {
+					logger.Logger(fmt.Sprintf("⚠️ Could not stat uploaded artifact %s: %v", artifact.Path, err), logger.LogWarning)
+				}
+			}
+
+			if artifact.Name == "" {
+				artifact.Name = strings.TrimSuffix(filepath.Base(artifact.Path), filepath.Ext(artifact.Path))
+			}
+			artifact.Package, _ = row["pkg_name"].(string)
+			if artifact.Package == "" && destination == "jamf" && artifact.Path != "" {
+				artifact.Package = filepath.Base(artifact.Path)
+			}
+			if artifact.Package == "" {
+				artifact.Package = artifact.Name
+			}
+			if destination == "jamf" && len(policies) > 0 {
+				artifact.Policy = policies[0]
+			}
+
+			usage.Artifacts = append(usage.Artifacts, artifact)
+			usage.TotalBytes += artifact.SizeBytes
+			usage.ByDestination[destination] += artifact.SizeBytes
+		}
+	}
+
+	return usage, nil
+}
+
+// reportDataRows extracts the data_rows list from an AutoPkg summary result
+func reportDataRows(summary interface{}) []map[string]interface{} {
+	var rows []map[string]interface{}
+	summaryMap, ok := summary.(map[string]interface{})
+	if !ok {
+		return rows
+	}
+	dataRows, ok := summaryMap["data_rows"].([]interface{})
+	if !ok {
+		return rows
+	}
+	for _, row := range dataRows {
+		if rowMap, ok := row.(map[string]interface{}); ok {
+			rows = append(rows, rowMap)
+		}
+	}
+	return rows
+}
+
+// collectReportPaths returns the values of a path key for each row in a summary result
+func collectReportPaths(summary interface{}, key string) []string {
+	var paths []string
+	for _, row := range reportDataRows(summary) {
+		if path, ok := row[key].(string); ok && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// firstReportPath returns the first absolute path found in a summary data row
+func firstReportPath(row map[string]interface{}) string {
+	for _, key := range []string{"pkg_path", "path", "dmg_path"} {
+		if path, ok := row[key].(string); ok && strings.HasPrefix(path, "/") {
+			return path
+		}
+	}
+	for key, value := range row {
+		if strings.Contains(strings.ToLower(key), "path") {
+			if path, ok := value.(string); ok && strings.HasPrefix(path, "/") {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// matchCreatedPackage picks the created package that matches an uploaded app
+// name, or "" when none does, rather than charge another app's package to it
+func matchCreatedPackage(paths []string, name string) string {
+	if name == "" {
+		return ""
+	}
+	for _, path := range paths {
+		if strings.Contains(strings.ToLower(filepath.Base(path)), strings.ToLower(name)) {
+			return path
+		}
+	}
+	return ""
+}
+
+// RecordStorageUsage appends a run's storage usage to the JSON storage ledger
+func RecordStorageUsage(ledgerPath string, usage *StorageUsage) error {
+	if ledgerPath == "" || usage == nil {
+		return nil
+	}
+
+	ledger, err := LoadStorageLedger(ledgerPath)
+	if err != nil {
+		return err
+	}
+
+	// Merge usage recorded for the same run so that individually executed
+	// recipes in one batch end up as a single ledger entry.
+	merged := false
+	for i := range ledger {
+		if usage.RunID != "" && ledger[i].RunID == usage.RunID {
+			ledger[i].Artifacts = append(ledger[i].Artifacts, usage.Artifacts...)
+			ledger[i].TotalBytes += usage.TotalBytes
+			if ledger[i].ByDestination == nil {
+				ledger[i].ByDestination = make(map[string]int64)
+			}
+			for destination, size := range usage.ByDestination {
+				ledger[i].ByDestination[destination] += size
+			}
+			merged = true
+			break
+		}
+	}
+	if !merged {
+		ledger = append(ledger, *usage)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ledgerPath), 0755); err != nil {
+		return fmt.Errorf("failed to create storage ledger directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal storage ledger: %w", err)
+	}
+
+	if err := os.WriteFile(ledgerPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write storage ledger: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("💾 Recorded %s of uploaded artifacts for run %s", FormatBytes(usage.TotalBytes), usage.RunID), logger.LogInfo)
+	return nil
+}
+
+// LoadStorageLedger reads the storage ledger, returning an empty ledger if it does not exist
+func LoadStorageLedger(ledgerPath string) ([]StorageUsage, error) {
+	ledger := []StorageUsage{}
+
+	data, err := os.ReadFile(ledgerPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ledger, nil
+		}
+		return nil, fmt.Errorf("failed to read storage ledger: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("failed to parse storage ledger: %w", err)
+	}
+
+	return ledger, nil
+}
+
+// BuildStorageDigest aggregates ledger entries into monthly totals, newest month first.
+// If months is greater than zero only the most recent months are returned.
+func BuildStorageDigest(ledger []StorageUsage, months int) []MonthlyStorage {
+	byMonth := make(map[string]*MonthlyStorage)
+
+	for _, usage := range ledger {
+		month := usage.Timestamp.Format("2006-01")
+		aggregate, exists := byMonth[month]
+		if !exists {
+			aggregate = &MonthlyStorage{
+				Month:         month,
+				ByDestination: make(map[string]int64),
+				ByApp:         make(map[string]int64),
+			}
+			byMonth[month] = aggregate
+		}
+
+		aggregate.Runs++
+		aggregate.TotalBytes += usage.TotalBytes
+		for destination, size := range usage.ByDestination {
+			aggregate.ByDestination[destination] += size
+		}
+		for _, artifact := range usage.Artifacts {
+			app := artifact.Name
+			if app == "" {
+				app = artifact.Recipe
+			}
+			aggregate.ByApp[app] += artifact.SizeBytes
+		}
+	}
+
+	digest := make([]MonthlyStorage, 0, len(byMonth))
+	for _, aggregate := range byMonth {
+		digest = append(digest, *aggregate)
+	}
+	sort.Slice(digest, func(i, j int) bool {
+		return digest[i].Month > digest[j].Month
+	})
+
+	if months > 0 && len(digest) > months {
+		digest = digest[:months]
+	}
+
+	return digest
+}
+
+// TopStorageApps returns the apps with the largest storage footprint in a
+// month, apps of the same size by name
+func TopStorageApps(month MonthlyStorage, limit int) []string {
+	apps := make([]string, 0, len(month.ByApp))
+	for app := range month.ByApp {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if month.ByApp[apps[i]] != month.ByApp[apps[j]] {
+			return month.ByApp[apps[i]] > month.ByApp[apps[j]]
+		}
+		return apps[i] < apps[j]
+	})
+	if limit > 0 && len(apps) > limit {
+		apps = apps[:limit]
+	}
+	return apps
+}
+
+// FormatBytes renders a byte count in a human readable form
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
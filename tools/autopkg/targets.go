@@ -0,0 +1,324 @@
+// targets.go
+package autopkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// Target is an MDM tenant that upload recipes are run against, with its own
+// preferences holding the tenant's URL and credentials
+type Target struct {
+	Name      string            `yaml:"name"`
+	Profile   string            `yaml:"profile,omitempty"`    // Profile whose preferences are used, see CreateProfile
+	PrefsPath string            `yaml:"prefs_path,omitempty"` // Preferences file, when not using a profile
+	Variables map[string]string `yaml:"variables,omitempty"`  // Extra variables, merged over the batch and recipe variables
+}
+
+// TargetSet is the set of tenants a batch fans its upload recipes out to.
+// Packaging recipes run once, while every upload recipe runs once per target:
+// first against one target, which builds the package into the shared AutoPkg
+// cache, then against the others in parallel, reusing the cached package.
+type TargetSet struct {
+	Targets     []Target `yaml:"targets"`
+	Concurrency int      `yaml:"concurrency,omitempty"` // Targets uploaded to at once, defaults to all of them
+}
+
+// TargetResult is the outcome of an upload recipe on a single target
+type TargetResult struct {
+	Target         string
+	PrefsPath      string
+	Status         string // "updated", "unchanged" or "failed"
+	Output         string
+	ExecutionError error
+	ExecutionTime  time.Duration
+	Uploads        []UploadedArtifact
+	FailureKind    string
+	Attempts       int
+}
+
+// LoadTargetSet reads a target set from a YAML file
+func LoadTargetSet(path string) (*TargetSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %w", err)
+	}
+
+	var targets TargetSet
+	if err := yaml.UnmarshalStrict(data, &targets); err != nil {
+		return nil, fmt.Errorf("failed to parse targets file: %w", err)
+	}
+	if err := targets.validate(); err != nil {
+		return nil, fmt.Errorf("invalid targets file %s: %w", path, err)
+	}
+
+	logger.Logger(fmt.Sprintf("🎯 Loaded %d upload targets", len(targets.Targets)), logger.LogDebug)
+	return &targets, nil
+}
+
+// validate checks every target has a unique name and exactly one source of preferences
+func (s *TargetSet) validate() error {
+	if len(s.Targets) == 0 {
+		return fmt.Errorf("no targets defined")
+	}
+	seen := make(map[string]bool)
+	for i, target := range s.Targets {
+		if target.Name == "" {
+			return fmt.Errorf("target %d has no name", i+1)
+		}
+		if seen[target.Name] {
+			return fmt.Errorf("target %s is defined more than once", target.Name)
+		}
+		seen[target.Name] = true
+		if (target.Profile == "") == (target.PrefsPath == "") {
+			return fmt.Errorf("target %s needs either a profile or a prefs_path", target.Name)
+		}
+	}
+	if s.Concurrency < 0 {
+		return fmt.Errorf("concurrency can't be negative")
+	}
+	return nil
+}
+
+// prefsPath returns the preferences file of a target, resolving its profile
+func (t Target) prefsPath(stateDir string) (string, error) {
+	if t.PrefsPath != "" {
+		return expandTilde(t.PrefsPath), nil
+	}
+	profile, err := LoadProfile(stateDir, t.Profile)
+	if err != nil {
+		return "", err
+	}
+	return profile.PrefsPath, nil
+}
+
+// TargetPrefsPath returns the preferences file of the named target
+func (s *TargetSet) TargetPrefsPath(name string, stateDir string) (string, error) {
+	for _, target := range s.Targets {
+		if target.Name == name {
+			return target.prefsPath(stateDir)
+		}
+	}
+	return "", fmt.Errorf("no target named %s", name)
+}
+
+// isUploadRecipe reports whether a recipe uploads to an MDM tenant, e.g. Firefox.jamf
+func isUploadRecipe(recipe string) bool {
+	return recipeUploadType(recipe) != ""
+}
+
+// fansOut reports whether a recipe runs once per target
+func (o *RecipeBatchRunOptions) fansOut(recipe string) bool {
+	return o.Targets != nil && len(o.Targets.Targets) > 0 && isUploadRecipe(recipe)
+}
+
+// hasTargetFanOut reports whether any of the recipes runs once per target
+func (o *RecipeBatchRunOptions) hasTargetFanOut(recipes []string) bool {
+	for _, recipe := range recipes {
+		if o.fansOut(recipe) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadPrefsPaths returns the preferences files a recipe uploads with, one
+// per target for recipes that fan out
+func (o *RecipeBatchRunOptions) uploadPrefsPaths(recipe string) []string {
+	if !o.fansOut(recipe) {
+		return []string{o.prefsPathFor(recipe)}
+	}
+	var paths []string
+	for _, target := range o.Targets.Targets {
+		if path, err := target.prefsPath(o.StateDir); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// targetReportPath returns the report plist of a target, so parallel runs don't overwrite each other's report
+func targetReportPath(reportPlist string, target string) string {
+	if reportPlist == "" {
+		return ""
+	}
+	ext := filepath.Ext(reportPlist)
+	return strings.TrimSuffix(reportPlist, ext) + "-" + target + ext
+}
+
+// runRecipeOnTargets runs an upload recipe against every target and combines
+// the per-target outcomes into one result, failed if any target failed
+func runRecipeOnTargets(ctx context.Context, recipe string, options *RecipeBatchRunOptions, startTime time.Time) *RecipeBatchResult {
+	targets := options.Targets.Targets
+	targetResults := make([]*TargetResult, len(targets))
+
+	concurrency := options.Targets.Concurrency
+	if concurrency <= 0 || concurrency > len(targets) {
+		concurrency = len(targets)
+	}
+	logger.Logger(fmt.Sprintf("🎯 Fanning %s out to %d targets", recipe, len(targets)), logger.LogInfo)
+
+	// The first target builds the package, so the rest find it in the cache
+	targetResults[0] = runRecipeOnTarget(ctx, recipe, targets[0], options)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for i := 1; i < len(targets); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			targetResults[i] = runRecipeOnTarget(ctx, recipe, targets[i], options)
+		}(i)
+	}
+	wg.Wait()
+
+	result := &RecipeBatchResult{
+		Recipe:        recipe,
+		Executed:      true,
+		TrustVerified: true,
+		ExecutionTime: time.Since(startTime),
+		Status:        "unchanged",
+	}
+	if report := targetReportPath(options.ReportPlist, targets[0].Name); report != "" {
+		artifacts, err := CollectProducedArtifacts(report, recipe)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to collect produced artifacts: %v", err), logger.LogWarning)
+		}
+		result.Artifacts = artifacts
+		result.CacheDir = recipeCacheDir(autopkgCacheDir(options.prefsPathFor(recipe)), artifacts)
+	}
+
+	var outputs, failed []string
+	for _, targetResult := range targetResults {
+		result.Targets = append(result.Targets, *targetResult)
+		result.Uploads = append(result.Uploads, targetResult.Uploads...)
+		outputs = append(outputs, fmt.Sprintf("=== %s ===\n%s", targetResult.Target, targetResult.Output))
+
+		switch targetResult.Status {
+		case "failed":
+			failed = append(failed, fmt.Sprintf("%s: %v", targetResult.Target, targetResult.ExecutionError))
+			if result.FailureKind == "" {
+				result.FailureKind = targetResult.FailureKind
+			}
+		case "updated":
+			result.Status = "updated"
+		}
+	}
+	result.Output = strings.Join(outputs, "\n")
+	if len(failed) > 0 {
+		result.Status = "failed"
+		result.ExecutionError = fmt.Errorf("failed on %d of %d targets: %s", len(failed), len(targets), strings.Join(failed, "; "))
+	}
+
+	return result
+}
+
+// runRecipeOnTarget runs an upload recipe with a target's preferences and variables
+func runRecipeOnTarget(ctx context.Context, recipe string, target Target, options *RecipeBatchRunOptions) *TargetResult {
+	startTime := time.Now()
+	result := &TargetResult{Target: target.Name}
+
+	prefsPath, err := target.prefsPath(options.StateDir)
+	if err != nil {
+		result.Status = "failed"
+		result.ExecutionError = fmt.Errorf("failed to resolve preferences: %w", err)
+		result.FailureKind = FailureKindUnknown
+		return result
+	}
+	result.PrefsPath = prefsPath
+
+	runOpts := createRunOptions(options, "", recipe)
+	runOpts.Context = ctx
+	runOpts.PrefsPath = prefsPath
+	runOpts.ReportPlist = targetReportPath(options.ReportPlist, target.Name)
+	if len(target.Variables) > 0 {
+		variables := make(map[string]string, len(runOpts.Variables)+len(target.Variables))
+		for key, value := range runOpts.Variables {
+			variables[key] = value
+		}
+		for key, value := range target.Variables {
+			variables[key] = value
+		}
+		runOpts.Variables = variables
+	}
+	if options.Progress != nil || options.Tracer != nil {
+		runOpts.OutputLine = func(line string) {
+			if processor := processorFromOutputLine(line); processor != "" {
+				options.reportRecipeProcessor(recipe, recipe+" on "+target.Name, processor)
+			}
+		}
+	}
+
+	logger.Logger(fmt.Sprintf("🎯 Running %s against target %s", recipe, target.Name), logger.LogInfo)
+	output, attempts, err := options.runWithRetry(ctx, recipe+" on "+target.Name, func() (string, error) {
+		return RunRecipe(recipe, runOpts)
+	})
+	result.Attempts = attempts
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("recipe cancelled: %w", err)
+	}
+
+	result.Output = output
+	result.ExecutionError = err
+	result.ExecutionTime = time.Since(startTime)
+	result.Status = determineRecipeStatus(output, recipe, err)
+	result.FailureKind = ClassifyFailure(output, err)
+
+	if runOpts.ReportPlist != "" {
+		if usage, usageErr := EstimateStorageUsage(runOpts.ReportPlist, recipe); usageErr == nil {
+			result.Uploads = usage.Artifacts
+			if options.StorageLedgerPath != "" {
+				usage.RunID = options.RunID
+				if ledgerErr := RecordStorageUsage(options.StorageLedgerPath, usage); ledgerErr != nil {
+					logger.Logger(fmt.Sprintf("⚠️ Failed to record storage usage: %v", ledgerErr), logger.LogWarning)
+				}
+			}
+		} else {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to read uploads from report for target %s: %v", target.Name, usageErr), logger.LogWarning)
+		}
+	}
+
+	if err != nil {
+		logger.Logger(fmt.Sprintf("❌ Recipe %s failed on target %s after %s: %v", recipe, target.Name, result.ExecutionTime, err), logger.LogError)
+	} else {
+		logger.Logger(fmt.Sprintf("✅ Recipe %s succeeded on target %s in %s", recipe, target.Name, result.ExecutionTime), logger.LogSuccess)
+	}
+	return result
+}
+
+// logTargetSummary logs the per-target outcome of every recipe fanned out to targets
+func logTargetSummary(results map[string]*RecipeBatchResult) {
+	var recipes []string
+	for recipe, result := range results {
+		if len(result.Targets) > 0 {
+			recipes = append(recipes, recipe)
+		}
+	}
+	if len(recipes) == 0 {
+		return
+	}
+	sort.Strings(recipes)
+
+	logger.Logger("\n🎯 Per-target Results:", logger.LogInfo)
+	for _, recipe := range recipes {
+		logger.Logger(fmt.Sprintf("  • %s", recipe), logger.LogInfo)
+		for _, target := range results[recipe].Targets {
+			if target.ExecutionError != nil {
+				logger.Logger(fmt.Sprintf("    - %s: %s (%v)", target.Target, target.Status, target.ExecutionError), logger.LogError)
+				continue
+			}
+			logger.Logger(fmt.Sprintf("    - %s: %s in %s", target.Target, target.Status, target.ExecutionTime.Round(time.Second)), logger.LogInfo)
+		}
+	}
+}
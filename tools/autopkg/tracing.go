@@ -0,0 +1,415 @@
+// tracing.go
+package autopkg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Environment variables read by NewTracer, as defined by OpenTelemetry
+const (
+	OTLPEndpointEnvVar       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	OTLPTracesEndpointEnvVar = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	OTLPHeadersEnvVar        = "OTEL_EXPORTER_OTLP_HEADERS"
+	OTelServiceNameEnvVar    = "OTEL_SERVICE_NAME"
+	TraceParentEnvVar        = "TRACEPARENT" // W3C trace context a CI system started the run under
+)
+
+// tracerScope names the instrumentation in exported spans
+const tracerScope = "github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+
+// maxBufferedSpans is how many finished spans are held before they're exported
+const maxBufferedSpans = 512
+
+// TracingOptions configure where spans are exported to. Empty fields are read
+// from the standard OTEL_* environment variables.
+type TracingOptions struct {
+	Endpoint    string            // OTLP/HTTP endpoint, e.g. http://tempo:4318, /v1/traces is added when missing
+	Headers     map[string]string // Sent with every export, e.g. an API key
+	ServiceName string            // service.name of the spans, defaults to autopkgctl
+}
+
+// Tracer records OpenTelemetry spans and exports them with OTLP over HTTP in
+// its JSON encoding, which Grafana Tempo, Jaeger and the OpenTelemetry
+// Collector accept. Spans are buffered and exported in batches; call Shutdown
+// to export the rest. A nil *Tracer records nothing, so callers needn't check.
+type Tracer struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+
+	remoteTrace [16]byte // Trace and span of TRACEPARENT, parent of root spans
+	remoteSpan  [8]byte
+
+	mu       sync.Mutex
+	finished []*Span
+}
+
+// Span is a timed operation in a trace
+type Span struct {
+	tracer     *Tracer
+	name       string
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+	mu         sync.Mutex
+}
+
+// NewTracer creates a tracer exporting to the endpoint of the options or the
+// environment, returning nil when neither names one
+func NewTracer(options TracingOptions) (*Tracer, error) {
+	endpoint := options.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv(OTLPTracesEndpointEnvVar)
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv(OTLPEndpointEnvVar)
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q, expected a URL such as http://localhost:4318", endpoint)
+	}
+	if !strings.HasSuffix(parsed.Path, "/v1/traces") {
+		parsed.Path = strings.TrimRight(parsed.Path, "/") + "/v1/traces"
+	}
+
+	tracer := &Tracer{
+		endpoint:    parsed.String(),
+		headers:     parseOTLPHeaders(os.Getenv(OTLPHeadersEnvVar)),
+		serviceName: options.ServiceName,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	for key, value := range options.Headers {
+		tracer.headers[key] = value
+	}
+	if tracer.serviceName == "" {
+		tracer.serviceName = os.Getenv(OTelServiceNameEnvVar)
+	}
+	if tracer.serviceName == "" {
+		tracer.serviceName = "autopkgctl"
+	}
+	tracer.remoteTrace, tracer.remoteSpan = parseTraceParent(os.Getenv(TraceParentEnvVar))
+	return tracer, nil
+}
+
+// StartSpan starts a span, a child of parent, or a root span of a new trace
+// or of the TRACEPARENT trace when parent is nil
+func (t *Tracer) StartSpan(parent *Span, name string) *Span {
+	if t == nil {
+		return nil
+	}
+	span := &Span{tracer: t, name: name, start: time.Now(), attributes: map[string]interface{}{}}
+	rand.Read(span.spanID[:])
+	switch {
+	case parent != nil:
+		span.traceID, span.parentID = parent.traceID, parent.spanID
+	case t.remoteTrace != [16]byte{}:
+		span.traceID, span.parentID = t.remoteTrace, t.remoteSpan
+	default:
+		rand.Read(span.traceID[:])
+	}
+	return span
+}
+
+// SetAttribute sets an attribute of the span: a string, bool, int, int64,
+// float64 or time.Duration, which is recorded in seconds
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// End ends the span, marking it failed with err when not nil. Spans are only
+// ended once.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	s.tracer.finished = append(s.tracer.finished, s)
+	full := len(s.tracer.finished) >= maxBufferedSpans
+	s.tracer.mu.Unlock()
+	if full {
+		s.tracer.Flush()
+	}
+}
+
+// TraceParent returns the W3C traceparent header of the span, for passing the
+// trace on to other processes
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// Flush exports the finished spans, logging rather than failing when the
+// endpoint can't take them, as tracing mustn't fail a run
+func (t *Tracer) Flush() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	if err := t.export(spans); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to export %d trace spans: %v", len(spans), err), logger.LogWarning)
+		return
+	}
+	logger.Logger(fmt.Sprintf("🔭 Exported %d trace spans to %s", len(spans), t.endpoint), logger.LogDebug)
+}
+
+// Shutdown exports the spans still buffered
+func (t *Tracer) Shutdown() {
+	t.Flush()
+}
+
+// export posts spans to the OTLP/HTTP endpoint in the JSON encoding
+func (t *Tracer) export(spans []*Span) error {
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		otlpSpans = append(otlpSpans, span.otlp())
+	}
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": t.serviceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": tracerScope},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OTLP endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// otlp returns the span in the OTLP JSON encoding
+func (s *Span) otlp() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := map[string]interface{}{
+		"traceId":           hex.EncodeToString(s.traceID[:]),
+		"spanId":            hex.EncodeToString(s.spanID[:]),
+		"name":              s.name,
+		"kind":              1, // SPAN_KIND_INTERNAL
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.attributes),
+		"status":            map[string]interface{}{"code": 1}, // STATUS_CODE_OK
+	}
+	if s.parentID != [8]byte{} {
+		span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != nil {
+		span["status"] = map[string]interface{}{"code": 2, "message": s.err.Error()} // STATUS_CODE_ERROR
+	}
+	return span
+}
+
+// otlpAttributes converts attributes to OTLP key values
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	values := make([]interface{}, 0, len(attributes))
+	for key, value := range attributes {
+		var otlpValue map[string]interface{}
+		switch v := value.(type) {
+		case string:
+			otlpValue = map[string]interface{}{"stringValue": v}
+		case bool:
+			otlpValue = map[string]interface{}{"boolValue": v}
+		case int:
+			otlpValue = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			otlpValue = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			otlpValue = map[string]interface{}{"doubleValue": v}
+		case time.Duration:
+			otlpValue = map[string]interface{}{"doubleValue": v.Seconds()}
+		default:
+			otlpValue = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		values = append(values, map[string]interface{}{"key": key, "value": otlpValue})
+	}
+	return values
+}
+
+// parseOTLPHeaders parses OTEL_EXPORTER_OTLP_HEADERS, e.g. "api-key=abc,tenant=ops"
+func parseOTLPHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(val)); err == nil {
+			val = unescaped
+		}
+		headers[strings.TrimSpace(key)] = val
+	}
+	return headers
+}
+
+// parseTraceParent reads the trace and span of a W3C traceparent, returning
+// zero ids when it's empty or malformed
+func parseTraceParent(value string) ([16]byte, [8]byte) {
+	var traceID [16]byte
+	var spanID [8]byte
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return [16]byte{}, [8]byte{}
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return [16]byte{}, [8]byte{}
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return [16]byte{}, [8]byte{}
+	}
+	return traceID, spanID
+}
+
+// recipeSpans tracks the spans of the recipes a batch is running and of the
+// processor each is in, which may be running side by side
+type recipeSpans struct {
+	mu         sync.Mutex
+	recipes    map[string]*Span
+	processors map[string]*Span // By recipe, or "recipe on target" for fanned out uploads
+}
+
+// startRecipeSpan starts the span of a recipe under the batch span
+func (o *RecipeBatchRunOptions) startRecipeSpan(recipe string) {
+	if o.Tracer == nil {
+		return
+	}
+	span := o.Tracer.StartSpan(o.batchSpan, "recipe "+recipe)
+	span.SetAttribute("autopkg.recipe", recipe)
+	o.spans.mu.Lock()
+	defer o.spans.mu.Unlock()
+	o.spans.recipes[recipe] = span
+}
+
+// endRecipeSpan ends the span of a recipe, and that of its last processor,
+// with its result
+func (o *RecipeBatchRunOptions) endRecipeSpan(recipe string, result *RecipeBatchResult) {
+	if o.Tracer == nil {
+		return
+	}
+	o.spans.mu.Lock()
+	span := o.spans.recipes[recipe]
+	delete(o.spans.recipes, recipe)
+	var processors []*Span
+	for key, processor := range o.spans.processors {
+		if key == recipe || strings.HasPrefix(key, recipe+" on ") {
+			processors = append(processors, processor)
+			delete(o.spans.processors, key)
+		}
+	}
+	o.spans.mu.Unlock()
+	if span == nil {
+		return
+	}
+
+	err := result.ExecutionError
+	if err == nil {
+		err = result.VerificationError
+	}
+	for _, processor := range processors {
+		processor.End(err)
+	}
+	span.SetAttribute("autopkg.status", result.Status)
+	span.SetAttribute("autopkg.attempts", result.Attempts)
+	if result.FailureKind != "" {
+		span.SetAttribute("autopkg.failure_kind", result.FailureKind)
+	}
+	if result.SkipReason != "" {
+		span.SetAttribute("autopkg.skip_reason", result.SkipReason)
+	}
+	span.End(err)
+}
+
+// traceProcessor ends the span of the processor a recipe was in and starts
+// one for the processor autopkg announced, e.g. JamfPackageUploader. key
+// tells apart the runs of a recipe fanned out to targets.
+func (o *RecipeBatchRunOptions) traceProcessor(recipe, key, processor string) {
+	if o.Tracer == nil {
+		return
+	}
+	o.spans.mu.Lock()
+	defer o.spans.mu.Unlock()
+	o.spans.processors[key].End(nil)
+
+	parent := o.spans.recipes[recipe]
+	if parent == nil {
+		parent = o.batchSpan
+	}
+	span := o.Tracer.StartSpan(parent, "processor "+processor)
+	span.SetAttribute("autopkg.recipe", recipe)
+	span.SetAttribute("autopkg.processor", processor)
+	if key != recipe {
+		span.SetAttribute("autopkg.target", strings.TrimPrefix(key, recipe+" on "))
+	}
+	o.spans.processors[key] = span
+}
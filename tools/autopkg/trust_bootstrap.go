@@ -0,0 +1,295 @@
+// trust_bootstrap.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// DefaultTrustBootstrapConcurrency is the number of overrides trust-bootstrap verifies at once
+const DefaultTrustBootstrapConcurrency = 8
+
+// TrustBootstrapOptions contains options for BootstrapTrust
+type TrustBootstrapOptions struct {
+	PrefsPath    string
+	SearchDirs   []string
+	OverrideDirs []string // Defaults to RECIPE_OVERRIDE_DIRS or ~/Library/AutoPkg/RecipeOverrides
+	SkipPull     bool     // Don't clone the parent repos, only report the missing ones
+	Concurrency  int      // Overrides verified at once, defaults to DefaultTrustBootstrapConcurrency
+}
+
+// TrustBootstrapRepo is a recipe repo the overrides' parent recipes or processors come from
+type TrustBootstrapRepo struct {
+	Repo       string   `json:"repo"`
+	Path       string   `json:"path,omitempty"`
+	Existing   bool     `json:"existing"` // Already present before the bootstrap
+	Error      string   `json:"error,omitempty"`
+	RequiredBy []string `json:"required_by"` // Overrides with parents or processors in the repo
+}
+
+// TrustBootstrapIssue is an override that needs a human to review its trust
+type TrustBootstrapIssue struct {
+	Override string   `json:"override"`
+	Path     string   `json:"path"`
+	Reasons  []string `json:"reasons"`
+}
+
+// TrustBootstrapReport is the outcome of bootstrapping trust on a runner
+type TrustBootstrapReport struct {
+	Overrides      int                   `json:"overrides"`
+	Repos          []TrustBootstrapRepo  `json:"repos"`
+	Trusted        []string              `json:"trusted"`
+	NeedsAttention []TrustBootstrapIssue `json:"needs_attention"`
+}
+
+// BootstrapTrust prepares a fresh checkout of an overrides repo: it clones the
+// repos the overrides' trust info says their parent recipes and processors come
+// from, verifies the trust of every override in parallel and reports the
+// overrides that failed, or can't be verified, for a human to review. Trust
+// info is never updated, since a failing override may be a parent that changed.
+func BootstrapTrust(options *TrustBootstrapOptions) (*TrustBootstrapReport, error) {
+	if options == nil {
+		options = &TrustBootstrapOptions{}
+	}
+
+	overrideDirs := options.OverrideDirs
+	if len(overrideDirs) == 0 {
+		overrideDirs = recipeOverrideDirs(options.PrefsPath)
+	}
+
+	repoDir := recipeRepoDir(options.PrefsPath)
+	var overrides []*recipeDefinition
+	for _, dir := range overrideDirs {
+		found, err := scanRecipeDefinitions(expandTilde(dir), repoDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan override directory %s: %w", dir, err)
+		}
+		overrides = append(overrides, found...)
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].path < overrides[j].path
+	})
+
+	logger.Logger(fmt.Sprintf("🔐 Bootstrapping trust for %d overrides", len(overrides)), logger.LogInfo)
+
+	report := &TrustBootstrapReport{
+		Overrides:      len(overrides),
+		Repos:          []TrustBootstrapRepo{},
+		Trusted:        []string{},
+		NeedsAttention: []TrustBootstrapIssue{},
+	}
+
+	// Overrides without trust info, or with parents from nowhere known, can't be verified
+	unverifiable := make(map[string][]string)
+	requiredBy := make(map[string][]string)
+	for _, override := range overrides {
+		name := strings.TrimSuffix(overrideRecipeName(filepath.Base(override.path)), ".recipe")
+		if override.ParentRecipeTrustInfo == nil {
+			unverifiable[override.path] = []string{"override has no trust info, review its parent recipes and run update-trust-info"}
+			continue
+		}
+		repos, unresolved := trustInfoRepos(override.ParentRecipeTrustInfo)
+		for _, repo := range repos {
+			requiredBy[repo] = append(requiredBy[repo], name)
+		}
+		for _, path := range unresolved {
+			unverifiable[override.path] = append(unverifiable[override.path], fmt.Sprintf("%s is missing and isn't in a known recipe repo", path))
+		}
+	}
+
+	report.Repos = pullTrustBootstrapRepos(requiredBy, options, repoDir)
+
+	verifyOptions := &VerifyTrustInfoOptions{
+		PrefsPath:    options.PrefsPath,
+		SearchDirs:   options.SearchDirs,
+		OverrideDirs: options.OverrideDirs,
+	}
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultTrustBootstrapConcurrency
+	}
+
+	reasons := make([][]string, len(overrides))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reasons[i] = verifyBootstrapOverride(overrides[i].path, verifyOptions)
+			}
+		}()
+	}
+
+	for i, override := range overrides {
+		if _, skip := unverifiable[override.path]; skip {
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, override := range overrides {
+		name := strings.TrimSuffix(overrideRecipeName(filepath.Base(override.path)), ".recipe")
+		issues := append(unverifiable[override.path], reasons[i]...)
+		if len(issues) == 0 {
+			report.Trusted = append(report.Trusted, name)
+			continue
+		}
+		report.NeedsAttention = append(report.NeedsAttention, TrustBootstrapIssue{
+			Override: name,
+			Path:     override.path,
+			Reasons:  issues,
+		})
+	}
+
+	logger.Logger(fmt.Sprintf("🔐 %d overrides trusted, %d need attention", len(report.Trusted), len(report.NeedsAttention)), logger.LogInfo)
+	return report, nil
+}
+
+// trustInfoRepos returns the repos, as owner/name, that the parent recipes
+// and processors pinned in trust info come from, and the pinned files that are
+// missing and aren't in a recipe repo
+func trustInfoRepos(trustInfo *recipeTrustInfoReference) ([]string, []string) {
+	var paths []string
+	for _, parent := range trustInfo.ParentRecipes {
+		paths = append(paths, parent.Path)
+	}
+	for _, processor := range trustInfo.NonCoreProcessors {
+		paths = append(paths, processor.Path)
+	}
+	sort.Strings(paths)
+
+	seen := make(map[string]bool)
+	var repos, unresolved []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		repo := repoFromRecipePath(path)
+		if repo == "" {
+			if _, err := os.Stat(expandTilde(path)); err != nil {
+				unresolved = append(unresolved, path)
+			}
+			continue
+		}
+		if !seen[repo] {
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+	return repos, unresolved
+}
+
+// repoFromRecipePath returns the GitHub repo, as owner/name, of a recipe
+// repo checkout a path lies in, e.g. autopkg/recipes for
+// ~/Library/AutoPkg/RecipeRepos/com.github.autopkg.recipes/Firefox/Firefox.download.recipe
+func repoFromRecipePath(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i, part := range parts {
+		if part != "RecipeRepos" || i+1 >= len(parts) {
+			continue
+		}
+		name := strings.Split(parts[i+1], ".")
+		if len(name) < 4 || name[0] != "com" || name[1] != "github" {
+			return ""
+		}
+		return name[2] + "/" + strings.Join(name[3:], ".")
+	}
+	return ""
+}
+
+// pullTrustBootstrapRepos clones the repos the overrides need, unless SkipPull is set
+func pullTrustBootstrapRepos(requiredBy map[string][]string, options *TrustBootstrapOptions, repoDir string) []TrustBootstrapRepo {
+	var names []string
+	for repo := range requiredBy {
+		names = append(names, repo)
+	}
+	sort.Strings(names)
+
+	repos := make([]TrustBootstrapRepo, 0, len(names))
+	if options.SkipPull {
+		for _, name := range names {
+			repo := TrustBootstrapRepo{
+				Repo:       name,
+				Path:       filepath.Join(repoDir, RepoDirName(ResolveRepoURL(name))),
+				RequiredBy: requiredBy[name],
+			}
+			if _, err := os.Stat(repo.Path); err == nil {
+				repo.Existing = true
+			} else {
+				repo.Error = "not cloned, pull skipped"
+			}
+			repos = append(repos, repo)
+		}
+		return repos
+	}
+	if len(names) == 0 {
+		return repos
+	}
+
+	results, err := CloneRepos(names, &CloneReposOptions{PrefsPath: options.PrefsPath, RepoDir: repoDir})
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ %v", err), logger.LogWarning)
+	}
+	for _, result := range results {
+		repo := TrustBootstrapRepo{
+			Repo:       result.Repo,
+			Path:       result.Path,
+			Existing:   result.Existing,
+			RequiredBy: requiredBy[result.Repo],
+		}
+		if result.Error != nil {
+			repo.Error = result.Error.Error()
+		}
+		repos = append(repos, repo)
+	}
+	return repos
+}
+
+// verifyBootstrapOverride verifies a single override, returning why it failed
+func verifyBootstrapOverride(path string, verifyOptions *VerifyTrustInfoOptions) []string {
+	success, _, output, err := VerifyTrustInfoForRecipes([]string{path}, verifyOptions)
+	if err == nil && success {
+		return nil
+	}
+
+	_, failureReasons, _ := parseVerifyTrustOutput(output)
+	var reasons []string
+	for _, recipeReasons := range failureReasons {
+		reasons = append(reasons, recipeReasons...)
+	}
+	if len(reasons) == 0 {
+		reasons = []string{fmt.Sprintf("verify-trust-info failed: %v", err)}
+	}
+	return reasons
+}
+
+// WriteTrustBootstrapReport writes a trust bootstrap report as JSON
+func WriteTrustBootstrapReport(path string, report *TrustBootstrapReport) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal trust bootstrap report: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write trust bootstrap report: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("📝 Wrote trust bootstrap report to %s", path), logger.LogInfo)
+	return nil
+}
@@ -0,0 +1,207 @@
+// trust_cache.go
+package autopkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+// historyTrustBucket holds trust verification results keyed by recipe name
+var historyTrustBucket = []byte("trust")
+
+// TrustCacheEntry records a successful trust verification of an override.
+// The verification holds for as long as the override file and its parent
+// recipes, including the processors its trust info lists, are unchanged.
+type TrustCacheEntry struct {
+	Recipe       string    `json:"recipe"`
+	OverrideHash string    `json:"override_sha256"`
+	ParentHash   string    `json:"parent_sha256"`
+	VerifiedAt   time.Time `json:"verified_at"`
+}
+
+// trustCache skips verify-trust-info for overrides that verified before and
+// haven't changed since. Entries are read when the batch starts and written
+// when it ends, so the history database isn't held open during the run.
+type trustCache struct {
+	historyPath string
+	index       *recipeIndex
+	entries     map[string]TrustCacheEntry
+	verified    map[string]TrustCacheEntry // Entries to write at the end of the batch
+	hits        int
+}
+
+// newTrustCache indexes the overrides and recipes the batch can see and loads the cached verifications
+func newTrustCache(options *RecipeBatchRunOptions) (*trustCache, error) {
+	historyPath := options.HistoryPath
+	if historyPath == "" {
+		historyPath = DefaultHistoryPath(options.StateDir)
+	}
+
+	cache := &trustCache{
+		historyPath: historyPath,
+		index:       newRecipeIndex(options.PrefsPath, options.SearchDirs, options.OverrideDirs),
+		entries:     make(map[string]TrustCacheEntry),
+		verified:    make(map[string]TrustCacheEntry),
+	}
+
+	history, err := OpenHistory(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer history.Close()
+
+	err = history.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyTrustBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var entry TrustCacheEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return fmt.Errorf("failed to parse trust cache entry %s: %w", key, err)
+			}
+			cache.entries[entry.Recipe] = entry
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Logger(fmt.Sprintf("🔐 Trust cache has %d verified overrides", len(cache.entries)), logger.LogDebug)
+	return cache, nil
+}
+
+// fingerprint returns the hashes of a recipe's override and of its parent
+// recipe chain, or false when the recipe has no override to fingerprint
+func (c *trustCache) fingerprint(recipe string) (string, string, bool) {
+	override := c.index.override(recipe)
+	if override == nil {
+		return "", "", false
+	}
+
+	overrideHash, err := hashFiles([]string{override.path})
+	if err != nil {
+		return "", "", false
+	}
+
+	// Parent recipes, followed until the chain ends or loops, and the processors the trust info pins
+	var files []string
+	for _, parent := range c.index.parents(override) {
+		files = append(files, parent.path)
+	}
+	if override.ParentRecipe != "" && len(files) == 0 {
+		// An unresolved parent can't be fingerprinted, so autopkg has to check it
+		return "", "", false
+	}
+	if override.ParentRecipeTrustInfo != nil {
+		var processors []string
+		for _, processor := range override.ParentRecipeTrustInfo.NonCoreProcessors {
+			processors = append(processors, expandTilde(processor.Path))
+		}
+		sort.Strings(processors)
+		files = append(files, processors...)
+	}
+
+	parentHash, err := hashFiles(files)
+	if err != nil {
+		return "", "", false
+	}
+	return overrideHash, parentHash, true
+}
+
+// lookup reports whether a recipe verified before with an unchanged override
+// and parents, counting the verification it saves
+func (c *trustCache) lookup(recipe string) bool {
+	if !c.fresh(recipe) {
+		return false
+	}
+	c.hits++
+	return true
+}
+
+// fresh reports whether a recipe verified before with an unchanged override and parents
+func (c *trustCache) fresh(recipe string) bool {
+	overrideHash, parentHash, ok := c.fingerprint(recipe)
+	if !ok {
+		return false
+	}
+	entry, ok := c.entries[recipeBaseName(recipe)]
+	return ok && entry.OverrideHash == overrideHash && entry.ParentHash == parentHash
+}
+
+// record remembers a successful verification, to be written by save
+func (c *trustCache) record(recipe string) {
+	overrideHash, parentHash, ok := c.fingerprint(recipe)
+	if !ok {
+		return
+	}
+	name := recipeBaseName(recipe)
+	c.verified[name] = TrustCacheEntry{
+		Recipe:       name,
+		OverrideHash: overrideHash,
+		ParentHash:   parentHash,
+		VerifiedAt:   time.Now().UTC(),
+	}
+}
+
+// save writes the verifications recorded during the batch to the history database
+func (c *trustCache) save() error {
+	if c.hits > 0 {
+		logger.Logger(fmt.Sprintf("🔐 Skipped trust verification for %d unchanged overrides", c.hits), logger.LogInfo)
+	}
+	if len(c.verified) == 0 {
+		return nil
+	}
+
+	history, err := OpenHistory(c.historyPath)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	return history.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(historyTrustBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create trust bucket: %w", err)
+		}
+		for name, entry := range c.verified {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return fmt.Errorf("failed to marshal trust cache entry: %w", err)
+			}
+			if err := bucket.Put([]byte(name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// hashFiles returns the SHA-256 of the paths and contents of files in order
+func hashFiles(paths []string) (string, error) {
+	hash := sha256.New()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\x00", path)
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,93 @@
+// upload_gate.go
+package autopkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// gatesUpload reports whether an upload recipe builds its package with its
+// package parent before it uploads, so the build can be checked first
+func (o *RecipeBatchRunOptions) gatesUpload(recipe string) bool {
+	if o.CheckOnly || recipeUploadType(recipe) == "" || o.releases[recipe] != "" {
+		return false
+	}
+	return o.receipted[recipe] || o.HashList != nil || o.RequireNotarization
+}
+
+// gateUpload builds the package of an upload recipe with its package parent,
+// the way quarantine does, and returns a result in place of running the
+// recipe when the build is denylisted, isn't notarized while notarization is
+// required, or its version already has a receipt for every tenant. It returns nil when the recipe should run, including when
+// it has no package parent or the parent fails, which the recipe then reports.
+func (o *RecipeBatchRunOptions) gateUpload(ctx context.Context, recipe string) *RecipeBatchResult {
+	if !o.gatesUpload(recipe) {
+		return nil
+	}
+	packageRecipe := packageParent((&recipeParentResolver{options: o}).parents(recipe))
+	if packageRecipe == "" {
+		return nil
+	}
+
+	artifacts, built := o.buildPackageParent(ctx, recipe, packageRecipe)
+	if !built {
+		return nil
+	}
+
+	checked := &RecipeBatchResult{
+		Recipe:        recipe,
+		TrustVerified: true,
+		Status:        "updated",
+		Artifacts:     artifacts,
+		CacheDir:      recipeCacheDir(autopkgCacheDir(o.prefsPathFor(recipe)), artifacts),
+	}
+	if o.HashList != nil {
+		checkRunHashList(checked, o.HashList)
+	}
+	if o.RequireNotarization && checked.ExecutionError == nil && !checked.Allowlisted {
+		checkRunNotarization(checked, o)
+	}
+	if checked.ExecutionError != nil {
+		checked.Output = fmt.Sprintf("%s, built by %s and not uploaded", checked.ExecutionError, packageRecipe)
+		return checked
+	}
+
+	if o.receipted[recipe] {
+		return o.skipReceiptedUpload(recipe, artifacts)
+	}
+	return nil
+}
+
+// buildPackageParent runs the package recipe of an upload recipe and returns
+// the artifacts it built, none when it built nothing new. It reports false
+// when the package recipe couldn't run.
+func (o *RecipeBatchRunOptions) buildPackageParent(ctx context.Context, recipe, packageRecipe string) ([]ProducedArtifact, bool) {
+	runOpts := createRunOptions(o, "", packageRecipe)
+	runOpts.Context = ctx
+	runOpts.ReportPlist = targetReportPath(o.ReportPlist, recipeBaseName(packageRecipe))
+	if runOpts.ReportPlist == "" {
+		report, err := os.CreateTemp("", "autopkg-gate-*.plist")
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to create a report for %s, running %s unchecked: %v", packageRecipe, recipe, err), logger.LogWarning)
+			return nil, false
+		}
+		report.Close()
+		defer os.Remove(report.Name())
+		runOpts.ReportPlist = report.Name()
+	}
+
+	logger.Logger(fmt.Sprintf("🔍 Building %s to check it before %s uploads", packageRecipe, recipe), logger.LogInfo)
+	if _, err := RunRecipe(packageRecipe, runOpts); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ %s failed, running %s unchecked: %v", packageRecipe, recipe, err), logger.LogWarning)
+		return nil, false
+	}
+
+	artifacts, err := CollectProducedArtifacts(runOpts.ReportPlist, packageRecipe)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to collect produced artifacts: %v", err), logger.LogWarning)
+	}
+	return artifacts, true
+}
@@ -0,0 +1,157 @@
+// usage.go
+package autopkg
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"howett.net/plist"
+)
+
+// usageSampleInterval is how often free disk space is sampled while a recipe runs
+const usageSampleInterval = time.Second
+
+// RecipeUsage is the network and disk use of a recipe run, for right-sizing
+// runner disks and spotting recipes that suddenly download much more
+type RecipeUsage struct {
+	DownloadedBytes  int64 `json:"downloaded_bytes"`             // New downloads listed in the report, or the cache growth without one
+	CacheGrowthBytes int64 `json:"cache_growth_bytes,omitempty"` // Change in size of the AutoPkg cache, negative when the recipe cleaned up
+	PeakDiskBytes    int64 `json:"peak_disk_bytes,omitempty"`    // Most disk space used beyond the start of the run, including files removed before it ended
+}
+
+// usageMeter measures the usage of a recipe run between start and finish,
+// sampling free disk space in the background to catch temporary files
+type usageMeter struct {
+	cacheRoot   string
+	cacheBefore int64
+	freeBefore  uint64
+	minFree     uint64
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// startUsageMeter starts measuring the usage of a recipe run against an AutoPkg cache
+func startUsageMeter(cacheRoot string) *usageMeter {
+	m := &usageMeter{
+		cacheRoot:   cacheRoot,
+		cacheBefore: dirSize(cacheRoot),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	m.freeBefore, _ = freeDiskBytes(cacheRoot)
+	m.minFree = m.freeBefore
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(usageSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.sample()
+			}
+		}
+	}()
+	return m
+}
+
+// sample records the free disk space if it's the lowest seen
+func (m *usageMeter) sample() {
+	if free, ok := freeDiskBytes(m.cacheRoot); ok && free < m.minFree {
+		m.minFree = free
+	}
+}
+
+// finish stops measuring and returns the usage, with downloads taken from the
+// recipe's report when there is one
+func (m *usageMeter) finish(reportPath string, recipe string) *RecipeUsage {
+	close(m.stop)
+	<-m.done
+	m.sample()
+
+	usage := &RecipeUsage{CacheGrowthBytes: dirSize(m.cacheRoot) - m.cacheBefore}
+	if m.freeBefore > m.minFree {
+		usage.PeakDiskBytes = int64(m.freeBefore - m.minFree)
+	}
+	if usage.PeakDiskBytes < usage.CacheGrowthBytes {
+		usage.PeakDiskBytes = usage.CacheGrowthBytes
+	}
+
+	if downloaded, ok := reportDownloadedBytes(reportPath, recipe); ok {
+		usage.DownloadedBytes = downloaded
+	} else if usage.CacheGrowthBytes > 0 {
+		usage.DownloadedBytes = usage.CacheGrowthBytes
+	}
+	return usage
+}
+
+// reportDownloadedBytes sums the size of the files URLDownloader reports as
+// newly downloaded. Unchanged downloads aren't listed, so they count as nothing.
+func reportDownloadedBytes(reportPath string, recipe string) (int64, bool) {
+	if reportPath == "" {
+		return 0, false
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return 0, false
+	}
+	var reportData map[string]interface{}
+	if _, err := plist.Unmarshal(data, &reportData); err != nil {
+		return 0, false
+	}
+
+	summaryResults, _ := reportData["summary_results"].(map[string]interface{})
+	var total int64
+	for _, path := range collectReportPaths(summaryResults["url_downloader_summary_result"], "download_path") {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total, true
+}
+
+// dirSize returns the total size of the regular files under a directory, 0 when it doesn't exist
+func dirSize(root string) int64 {
+	var total int64
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// freeDiskBytes returns the space available on the volume holding path, or
+// its nearest existing parent, since the cache may not exist yet
+func freeDiskBytes(path string) (uint64, bool) {
+	for {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(path, &stat); err == nil {
+			return uint64(stat.Bavail) * uint64(stat.Bsize), true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, false
+		}
+		path = parent
+	}
+}
+
+// formatSignedBytes renders a byte count that may be negative, e.g. a cache that shrank
+func formatSignedBytes(size int64) string {
+	if size < 0 {
+		return "-" + FormatBytes(-size)
+	}
+	return "+" + FormatBytes(size)
+}
@@ -0,0 +1,194 @@
+// user_install.go
+package autopkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// DefaultUserSpacePrefix is where a user-space install goes, relative to the home directory
+const DefaultUserSpacePrefix = ".local/autopkg"
+
+// bundledPythonPath is the Python framework the AutoPkg package ships,
+// relative to the install root
+var bundledPythonPath = filepath.Join("Library", "ManagedFrameworks", "Python", "Python3.framework", "Versions", "Current", "bin", "python3")
+
+// UserSpacePrefix returns the directory of a user-space install, expanding a
+// leading ~ and defaulting to DefaultUserSpacePrefix in the home directory
+func UserSpacePrefix(prefix string) (string, error) {
+	if prefix != "" && !strings.HasPrefix(prefix, "~") {
+		return filepath.Abs(prefix)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory for a user-space install: %w", err)
+	}
+	if prefix == "" {
+		return filepath.Join(home, DefaultUserSpacePrefix), nil
+	}
+	return filepath.Join(home, strings.TrimPrefix(strings.TrimPrefix(prefix, "~"), "/")), nil
+}
+
+// UserSpaceBinDir returns the directory holding the autopkg command of a
+// user-space install, which goes on PATH
+func UserSpaceBinDir(prefix string) string {
+	return filepath.Join(prefix, "bin")
+}
+
+// installUserSpaceAutoPkg installs AutoPkg without root: the installer
+// package is expanded with pkgutil and its payloads copied into the prefix,
+// and a wrapper in <prefix>/bin runs AutoPkg with the Python the package
+// ships. The wrapper's directory is put first on PATH, and the git it finds
+// recorded as GIT_PATH, since AutoPkg otherwise looks for git where the
+// system installer would have put it.
+func installUserSpaceAutoPkg(installConfig *InstallConfig) (string, error) {
+	prefix, err := UserSpacePrefix(installConfig.Prefix)
+	if err != nil {
+		return "", err
+	}
+	wrapperPath := filepath.Join(UserSpaceBinDir(prefix), "autopkg")
+
+	if _, err := os.Stat(wrapperPath); err == nil && !installConfig.ForceUpdate {
+		logger.Logger(fmt.Sprintf("✅ AutoPkg is already installed in %s, checking version...", prefix), logger.LogInfo)
+		version, err := autopkgVersionAt(wrapperPath)
+		if err != nil {
+			return "", err
+		}
+		if installConfig.pinned(version) {
+			if err := useUserSpaceInstall(prefix, installConfig.PrefsPath); err != nil {
+				return "", err
+			}
+			logger.Logger(fmt.Sprintf("✅ AutoPkg %s is already installed. Skipping installation.", version), logger.LogSuccess)
+			return version, nil
+		}
+		logger.Logger(fmt.Sprintf("🔄 AutoPkg %s is installed but %s is pinned, replacing it...", version, installConfig.Version), logger.LogInfo)
+	}
+
+	logger.Logger(fmt.Sprintf("⬇️ Installing AutoPkg in user space at %s...", prefix), logger.LogInfo)
+
+	pkgPath, err := fetchAutoPkgInstaller(installConfig)
+	if err != nil {
+		return "", err
+	}
+
+	expandDir, err := os.MkdirTemp("", "autopkg-expand-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create expand directory: %w", err)
+	}
+	defer os.RemoveAll(expandDir)
+
+	// pkgutil wants a destination that doesn't exist yet
+	expandedPath := filepath.Join(expandDir, "pkg")
+	if output, err := exec.Command("pkgutil", "--expand-full", pkgPath, expandedPath).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to expand AutoPkg package: %w; output: %s", err, string(output))
+	}
+
+	// A distribution package has a Payload per component package, a
+	// component package a single one; each is laid out relative to /
+	var payloads []string
+	err = filepath.WalkDir(expandedPath, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == "Payload" {
+			payloads = append(payloads, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read expanded AutoPkg package: %w", err)
+	}
+	if len(payloads) == 0 {
+		return "", fmt.Errorf("no payload found in AutoPkg package %s", pkgPath)
+	}
+
+	// Replace an installed copy rather than merging into it
+	if _, err := os.Stat(wrapperPath); err == nil {
+		if err := os.RemoveAll(filepath.Join(prefix, "Library", "AutoPkg")); err != nil {
+			return "", fmt.Errorf("failed to remove installed AutoPkg: %w", err)
+		}
+	}
+	if err := os.MkdirAll(prefix, 0755); err != nil {
+		return "", fmt.Errorf("failed to create install prefix: %w", err)
+	}
+	for _, payload := range payloads {
+		if output, err := exec.Command("ditto", payload, prefix).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("failed to copy AutoPkg payload: %w; output: %s", err, string(output))
+		}
+	}
+
+	autopkgScript := filepath.Join(prefix, "Library", "AutoPkg", "autopkg")
+	if _, err := os.Stat(autopkgScript); err != nil {
+		return "", fmt.Errorf("AutoPkg package has no Library/AutoPkg/autopkg: %w", err)
+	}
+
+	// Prefer the Python framework the package ships, as the system install does
+	python := filepath.Join(prefix, bundledPythonPath)
+	if _, err := os.Stat(python); err != nil {
+		if python, err = exec.LookPath("python3"); err != nil {
+			return "", fmt.Errorf("AutoPkg package ships no Python and python3 isn't on PATH")
+		}
+		logger.Logger(fmt.Sprintf("⚠️ AutoPkg package ships no Python, using %s", python), logger.LogWarning)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(wrapperPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(wrapperPath), err)
+	}
+	wrapper := fmt.Sprintf("#!/bin/sh\n# AutoPkg installed in user space by autopkgctl setup --user-space\nexec %q %q \"$@\"\n", python, autopkgScript)
+	if err := os.WriteFile(wrapperPath, []byte(wrapper), 0755); err != nil {
+		return "", fmt.Errorf("failed to write autopkg wrapper: %w", err)
+	}
+
+	version, err := autopkgVersionAt(wrapperPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AutoPkg version after installation: %w", err)
+	}
+	if !installConfig.pinned(version) {
+		return "", fmt.Errorf("installed AutoPkg is %s, not the pinned %s", version, installConfig.Version)
+	}
+	if err := useUserSpaceInstall(prefix, installConfig.PrefsPath); err != nil {
+		return "", err
+	}
+
+	logger.Logger(fmt.Sprintf("✅ AutoPkg %s successfully installed in %s", version, prefix), logger.LogSuccess)
+	return version, nil
+}
+
+// useUserSpaceInstall puts the install's bin directory first on PATH, so
+// autopkg resolves to it for the rest of the run, and records the git on
+// PATH as GIT_PATH in the preferences
+func useUserSpaceInstall(prefix string, prefsPath string) error {
+	binDir := UserSpaceBinDir(prefix)
+	path := os.Getenv("PATH")
+	if !strings.HasPrefix(path, binDir+string(os.PathListSeparator)) && path != binDir {
+		if err := os.Setenv("PATH", binDir+string(os.PathListSeparator)+path); err != nil {
+			return fmt.Errorf("failed to add %s to PATH: %w", binDir, err)
+		}
+	}
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		logger.Logger("⚠️ git not found on PATH, GIT_PATH is not set", logger.LogWarning)
+		return nil
+	}
+	if err := UpdateAutoPkgPreferences(prefsPath, map[string]interface{}{"GIT_PATH": gitPath}); err != nil {
+		return fmt.Errorf("failed to set GIT_PATH: %w", err)
+	}
+	logger.Logger(fmt.Sprintf("🔧 GIT_PATH set to %s", gitPath), logger.LogInfo)
+	return nil
+}
+
+// autopkgVersionAt runs an autopkg command for its version
+func autopkgVersionAt(path string) (string, error) {
+	output, err := exec.Command(path, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get AutoPkg version: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
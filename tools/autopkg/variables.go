@@ -24,12 +24,17 @@ var (
 	// Uploader variables
 	USE_JAMF_UPLOADER     bool
 	USE_INTUNE_UPLOADER   bool
+	USE_WS1_UPLOADER      bool
 	JAMFPRO_URL           string
 	JAMFPRO_CLIENT_ID     string
 	JAMFPRO_CLIENT_SECRET string
 	INTUNE_TENANT_ID      string
 	INTUNE_CLIENT_ID      string
 	INTUNE_CLIENT_SECRET  string
+	WS1_API_URL           string
+	WS1_CLIENT_ID         string
+	WS1_CLIENT_SECRET     string
+	WS1_GROUP_ID          string
 	//AUTOPKG_REPOS         []string
 	RECIPE_LISTS      []string
 	PRIVATE_REPO_URL  string
@@ -116,6 +121,16 @@ func LoadEnvironmentVariables() {
 	INTUNE_CLIENT_ID = os.Getenv("INTUNE_CLIENT_ID")
 	INTUNE_CLIENT_SECRET = os.Getenv("INTUNE_CLIENT_SECRET")
 
+	// Workspace ONE settings
+	useWS1Str := os.Getenv("USE_WS1_UPLOADER")
+	if useWS1Str != "" {
+		USE_WS1_UPLOADER, _ = strconv.ParseBool(useWS1Str)
+	}
+	WS1_API_URL = os.Getenv("WS1_API_URL")
+	WS1_CLIENT_ID = os.Getenv("WS1_OAUTH_CLIENT_ID")
+	WS1_CLIENT_SECRET = os.Getenv("WS1_OAUTH_CLIENT_SECRET")
+	WS1_GROUP_ID = os.Getenv("WS1_GROUPID")
+
 	// Recipe lists
 	listsStr := os.Getenv("RECIPE_LISTS")
 	if listsStr != "" {
@@ -0,0 +1,74 @@
+// version_compat.go
+package autopkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// AutoPkgVersionRequirement is a recipe needing a newer AutoPkg than installed
+type AutoPkgVersionRequirement struct {
+	Recipe         string `json:"recipe"`
+	MinimumVersion string `json:"minimum_version"`
+	DeclaredBy     string `json:"declared_by"` // Recipe file declaring it, the recipe's own or a parent's
+}
+
+// CheckAutoPkgCompatibility compares the MinimumVersion each recipe, or a
+// parent in its chain, declares with an installed AutoPkg version, and warns
+// about and returns the recipes needing a newer one. Recipes that can't be
+// found or read are left to the run to report.
+func CheckAutoPkgCompatibility(recipes []string, installed string, options *ListRecipeOptions) ([]AutoPkgVersionRequirement, error) {
+	listed, err := ListRecipeInfo(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list available recipes: %w", err)
+	}
+	byName := make(map[string]string, len(listed))
+	byIdentifier := make(map[string]string, len(listed))
+	for _, info := range listed {
+		byName[info.Name] = info.Path
+		if _, taken := byIdentifier[info.Identifier]; !taken {
+			byIdentifier[info.Identifier] = info.Path
+		}
+	}
+
+	var requirements []AutoPkgVersionRequirement
+	for _, recipe := range recipes {
+		recipe = strings.TrimSpace(recipe)
+		if recipe == "" {
+			continue
+		}
+		path := byName[strings.TrimSuffix(recipe, ".recipe")]
+		if path == "" {
+			path = byIdentifier[strings.TrimSuffix(recipe, ".recipe")]
+		}
+
+		// Follow the parent chain, keeping the highest minimum declared
+		required := AutoPkgVersionRequirement{Recipe: recipe}
+		seen := make(map[string]bool)
+		for path != "" && !seen[path] {
+			seen[path] = true
+			definition, err := parseRecipeDefinition(path)
+			if err != nil {
+				break
+			}
+			if definition.MinimumVersion != "" && CompareOSVersions(definition.MinimumVersion, required.MinimumVersion) > 0 {
+				required.MinimumVersion = strings.TrimSpace(definition.MinimumVersion)
+				required.DeclaredBy = path
+			}
+			path = byIdentifier[definition.ParentRecipe]
+		}
+
+		if required.MinimumVersion != "" && CompareOSVersions(required.MinimumVersion, installed) > 0 {
+			requirements = append(requirements, required)
+		}
+	}
+
+	sort.Slice(requirements, func(i, j int) bool { return requirements[i].Recipe < requirements[j].Recipe })
+	for _, required := range requirements {
+		logger.Logger(fmt.Sprintf("⚠️ %s needs AutoPkg %s or newer, %s is installed (declared in %s)", required.Recipe, required.MinimumVersion, installed, required.DeclaredBy), logger.LogWarning)
+	}
+	return requirements, nil
+}
@@ -0,0 +1,239 @@
+// version_lag.go
+package autopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	versionoracle "github.com/deploymenttheory/macos-autopkg-factory/tools/version_oracle"
+	bolt "go.etcd.io/bbolt"
+)
+
+// historyOracleBucket holds, per app, the newer version an oracle listed and
+// when it was first seen, to tell a lagging recipe from a fresh release
+var historyOracleBucket = []byte("oracle")
+
+// VersionLagOptions configures CheckVersionLag
+type VersionLagOptions struct {
+	Apps    []string               // Apps to check, defaults to every app in the history
+	Catalog *Catalog               // Cask tokens, vendor version URLs and app names of recipes
+	Sources []versionoracle.Source // Defaults to the catalog's vendor URLs, then the Homebrew cask API
+	Grace   time.Duration          // How long an oracle may list a newer version before it's significant, defaults to 3 days
+}
+
+// VersionLag compares the newest version of an app we built with the newest
+// version an oracle outside AutoPkg lists
+type VersionLag struct {
+	App         string                 `json:"app"`
+	Recipe      string                 `json:"recipe"`
+	Version     string                 `json:"version"` // Newest version we built
+	BuiltAt     time.Time              `json:"built_at"`
+	Latest      string                 `json:"latest,omitempty"` // Newest version an oracle lists
+	Source      string                 `json:"source,omitempty"` // Oracle listing it
+	Answers     []versionoracle.Answer `json:"answers"`
+	Behind      bool                   `json:"behind"`
+	Since       time.Time              `json:"since,omitempty"` // When Latest was first seen newer than Version
+	Lag         time.Duration          `json:"lag,omitempty"`
+	Significant bool                   `json:"significant"` // Behind for longer than the grace period
+}
+
+// oracleSighting is a newer version an oracle listed and when it was first seen
+type oracleSighting struct {
+	Version   string    `json:"version"`
+	Source    string    `json:"source"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// CheckVersionLag looks up the latest version of every app in the run
+// history from oracles outside AutoPkg and compares it with the newest
+// version we built. A recipe whose download URL or version regex broke keeps
+// "succeeding" with an old version, which only an outside source reveals.
+// How long an app has lagged is measured from the first check that saw the
+// newer version, so it's as precise as the checks are frequent.
+func CheckVersionLag(history *History, options VersionLagOptions) ([]VersionLag, error) {
+	if options.Grace <= 0 {
+		options.Grace = 3 * 24 * time.Hour
+	}
+	if len(options.Sources) == 0 {
+		options.Sources = []versionoracle.Source{&versionoracle.VendorURL{}, &versionoracle.HomebrewCask{}}
+	}
+	now := time.Now()
+
+	apps := options.Apps
+	if len(apps) == 0 {
+		recipes, err := history.Recipes()
+		if err != nil {
+			return nil, err
+		}
+		apps = historyApps(recipes)
+	}
+
+	lags := []VersionLag{}
+	for _, app := range apps {
+		build, err := history.Latest(app)
+		if err != nil {
+			return nil, err
+		}
+		if build == nil || build.Version == "" {
+			logger.Logger(fmt.Sprintf("ℹ️ No built version of %s to compare", app), logger.LogDebug)
+			continue
+		}
+
+		lag := VersionLag{App: app, Recipe: build.Recipe, Version: build.Version, BuiltAt: build.BuiltAt}
+		lag.Answers = versionoracle.Lookup(oracleQuery(options.Catalog, app), options.Sources...)
+		if lag.Answers == nil {
+			lag.Answers = []versionoracle.Answer{}
+		}
+		if newest := versionoracle.Newest(lag.Answers); newest != nil {
+			lag.Latest = newest.Version
+			lag.Source = newest.Source
+			lag.Behind = versionoracle.Compare(newest.Version, build.Version) > 0
+		}
+
+		sighting, err := history.recordOracleSighting(app, &lag, now)
+		if err != nil {
+			return nil, err
+		}
+		if sighting != nil {
+			lag.Since = sighting.FirstSeen
+			lag.Lag = now.Sub(sighting.FirstSeen)
+			lag.Significant = lag.Lag >= options.Grace
+		}
+
+		lags = append(lags, lag)
+	}
+
+	sort.SliceStable(lags, func(i, j int) bool {
+		if lags[i].Significant != lags[j].Significant {
+			return lags[i].Significant
+		}
+		if lags[i].Behind != lags[j].Behind {
+			return lags[i].Behind
+		}
+		return lags[i].Lag > lags[j].Lag
+	})
+	return lags, nil
+}
+
+// historyApps returns the apps of recipes, e.g. Firefox for Firefox.download
+// and Firefox.jamf, in the order first seen
+func historyApps(recipes []string) []string {
+	seen := make(map[string]bool)
+	var apps []string
+	for _, recipe := range recipes {
+		app := artifactAppName(recipe, "", "")
+		if !seen[strings.ToLower(app)] {
+			seen[strings.ToLower(app)] = true
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// oracleQuery builds the oracle query of an app from the catalog entries of
+// its recipes: the first cask, version URL and name any of them set
+func oracleQuery(catalog *Catalog, app string) versionoracle.Query {
+	query := versionoracle.Query{App: app}
+	if catalog == nil {
+		return query
+	}
+	for _, entry := range catalog.Recipes {
+		if !recipeMatchesApp(entry.Recipe, app) {
+			continue
+		}
+		if query.Cask == "" {
+			query.Cask = entry.Cask
+		}
+		if query.URL == "" && entry.VersionURL != "" {
+			query.URL = entry.VersionURL
+			query.Pattern = entry.VersionPattern
+		}
+		if entry.Name != "" {
+			query.App = entry.Name
+		}
+	}
+	return query
+}
+
+// recordOracleSighting remembers when an app was first seen behind the
+// version an oracle lists, keeping the first sighting while the oracle lists
+// the same version, and forgets it once the app caught up. It returns the
+// sighting of an app that's behind.
+func (h *History) recordOracleSighting(app string, lag *VersionLag, now time.Time) (*oracleSighting, error) {
+	var sighting *oracleSighting
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(historyOracleBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create oracle bucket: %w", err)
+		}
+		key := []byte(strings.ToLower(app))
+
+		if !lag.Behind {
+			return bucket.Delete(key)
+		}
+
+		if data := bucket.Get(key); data != nil {
+			previous := &oracleSighting{}
+			if err := json.Unmarshal(data, previous); err == nil && previous.Version == lag.Latest {
+				sighting = previous
+				return nil
+			}
+		}
+
+		sighting = &oracleSighting{Version: lag.Latest, Source: lag.Source, FirstSeen: now.UTC()}
+		data, err := json.Marshal(sighting)
+		if err != nil {
+			return fmt.Errorf("failed to marshal oracle sighting: %w", err)
+		}
+		return bucket.Put(key, data)
+	})
+	return sighting, err
+}
+
+// NotifyVersionLag sends the apps lagging significantly behind their oracles
+// as one Slack and Teams alert
+func NotifyVersionLag(notification NotificationOptions, lags []VersionLag) error {
+	var lines []string
+	for _, lag := range lags {
+		if lag.Significant {
+			lines = append(lines, i18n.T("notify.version_lag", lag.App, lag.Version, lag.Source, lag.Latest, int(lag.Lag.Hours()/24)))
+		}
+	}
+	if len(lines) == 0 || (!notification.EnableSlack && !notification.EnableTeams) {
+		return nil
+	}
+	title := i18n.T("notify.version_lag.title", len(lines))
+
+	var errs []string
+	if notification.EnableSlack {
+		slackNotifier := &SlackNotifier{
+			WebhookURL: notification.SlackWebhook,
+			Username:   notification.SlackUsername,
+			Channel:    notification.SlackChannel,
+			IconEmoji:  notification.SlackIcon,
+		}
+		if err := slackNotifier.Notify(title, "• "+strings.Join(lines, "\n• "), "warning"); err != nil {
+			errs = append(errs, fmt.Sprintf("Slack: %v", err))
+		}
+	}
+
+	if notification.EnableTeams {
+		teamsNotifier := &MSTeamsNotifier{
+			WebhookURL: notification.TeamsWebhook,
+		}
+		if err := teamsNotifier.NotifyMSTeams(title, "- "+strings.Join(lines, "\n- "), false, false, "", ""); err != nil {
+			errs = append(errs, fmt.Sprintf("Teams: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send version lag alert: %s", strings.Join(errs, "; "))
+	}
+	logger.Logger(fmt.Sprintf("🔮 Sent version lag alert for %d apps", len(lines)), logger.LogSuccess)
+	return nil
+}
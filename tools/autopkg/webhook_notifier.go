@@ -0,0 +1,259 @@
+// webhook_notifier.go
+package autopkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// Webhook event types
+const (
+	WebhookRecipeUpdated = "recipe.updated"
+	WebhookRecipeFailed  = "recipe.failed"
+	WebhookRunCompleted  = "run.completed"
+)
+
+// Webhook request headers
+const (
+	WebhookSignatureHeader = "X-AutoPkg-Signature" // "sha256=" + hex HMAC-SHA256 of the body
+	WebhookEventHeader     = "X-AutoPkg-Event"
+	WebhookDeliveryHeader  = "X-AutoPkg-Delivery"
+)
+
+// WebhookSubscription sends the selected events to an endpoint, so downstream
+// systems such as a CMDB or patch dashboard only receive what they need
+type WebhookSubscription struct {
+	URL       string   `yaml:"url"`
+	Events    []string `yaml:"events"`               // Event types to send, empty sends every event
+	Secret    string   `yaml:"secret,omitempty"`     // HMAC signing secret
+	SecretEnv string   `yaml:"secret_env,omitempty"` // Environment variable holding the signing secret, keeps it out of the file
+}
+
+// WebhookPayload is the JSON body of a webhook delivery
+type WebhookPayload struct {
+	Event     string           `json:"event"`
+	RunID     string           `json:"run_id"`
+	Timestamp time.Time        `json:"timestamp"`
+	Chaos     bool             `json:"chaos,omitempty"`
+	Recipe    *WebhookRecipe   `json:"recipe,omitempty"`
+	Run       *WebhookRunStats `json:"run,omitempty"`
+}
+
+// WebhookRecipe describes the recipe a recipe.* event is about
+type WebhookRecipe struct {
+	Name        string             `json:"name"`
+	Status      string             `json:"status"`
+	Duration    float64            `json:"duration_seconds"`
+	Error       string             `json:"error,omitempty"`
+	FailureKind string             `json:"failure_kind,omitempty"`
+	Artifacts   []ProducedArtifact `json:"artifacts,omitempty"`
+	LogPath     string             `json:"log_path,omitempty"` // Archived log on the runner
+}
+
+// WebhookRunStats summarises a batch for run.completed events
+type WebhookRunStats struct {
+	Status    string          `json:"status"`
+	Recipes   int             `json:"recipes"`
+	Updated   int             `json:"updated"`
+	Failed    int             `json:"failed"`
+	Duration  float64         `json:"duration_seconds"`
+	Changes   []VersionChange `json:"changes,omitempty"`
+	Health    []HealthAlert   `json:"health,omitempty"`
+	StartTime time.Time       `json:"start_time"`
+}
+
+// LoadWebhookSubscriptions reads webhook subscriptions from a YAML file
+// containing a list of subscriptions
+func LoadWebhookSubscriptions(path string) ([]WebhookSubscription, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook file: %w", err)
+	}
+
+	var subscriptions []WebhookSubscription
+	if err := yaml.Unmarshal(data, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook file: %w", err)
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.URL == "" {
+			return nil, fmt.Errorf("webhook subscription without url")
+		}
+		for _, event := range subscription.Events {
+			if event != WebhookRecipeUpdated && event != WebhookRecipeFailed && event != WebhookRunCompleted {
+				return nil, fmt.Errorf("unknown webhook event %q for %s", event, subscription.URL)
+			}
+		}
+	}
+
+	return subscriptions, nil
+}
+
+// wants reports whether the subscription includes an event type
+func (s WebhookSubscription) wants(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range s.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// secret returns the signing secret, preferring the environment variable
+func (s WebhookSubscription) secret() string {
+	if s.SecretEnv != "" {
+		if value := os.Getenv(s.SecretEnv); value != "" {
+			return value
+		}
+	}
+	return s.Secret
+}
+
+// SignWebhookPayload returns the signature header value for a body
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send delivers a payload to the subscription's endpoint
+func (s WebhookSubscription) Send(payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	if path, ok := localNotificationPath(s.URL); ok {
+		return appendLocalNotification(path, body)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, payload.Event)
+	req.Header.Set(WebhookDeliveryHeader, newDeliveryID())
+	if secret := s.secret(); secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, body))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// newDeliveryID returns a random identifier for a webhook delivery, letting receivers drop retries
+func newDeliveryID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// sendRunWebhooks delivers recipe.updated and recipe.failed events for each
+// recipe of the batch, followed by run.completed, to a subscription
+func sendRunWebhooks(subscription WebhookSubscription, runID string, results map[string]*RecipeBatchResult, record *RunRecord) {
+	now := time.Now().UTC()
+
+	recipes := make([]string, 0, len(results))
+	for recipe := range results {
+		recipes = append(recipes, recipe)
+	}
+	sort.Strings(recipes)
+
+	stats := &WebhookRunStats{
+		Status:    record.Status,
+		Recipes:   len(results),
+		Duration:  record.EndTime.Sub(record.StartTime).Seconds(),
+		Changes:   record.Changes,
+		Health:    record.Health,
+		StartTime: record.StartTime,
+	}
+
+	var payloads []WebhookPayload
+	for _, recipe := range recipes {
+		result := results[recipe]
+
+		event := ""
+		switch result.Status {
+		case "updated":
+			event = WebhookRecipeUpdated
+			stats.Updated++
+		case "failed":
+			event = WebhookRecipeFailed
+			stats.Failed++
+		default:
+			continue
+		}
+
+		webhookRecipe := &WebhookRecipe{
+			Name:        recipe,
+			Status:      result.Status,
+			Duration:    result.ExecutionTime.Seconds(),
+			FailureKind: result.FailureKind,
+			Artifacts:   result.Artifacts,
+			LogPath:     result.LogPath,
+		}
+		if result.ExecutionError != nil {
+			webhookRecipe.Error = result.ExecutionError.Error()
+		} else if result.VerificationError != nil {
+			webhookRecipe.Error = result.VerificationError.Error()
+		}
+
+		payloads = append(payloads, WebhookPayload{
+			Event:     event,
+			RunID:     runID,
+			Timestamp: now,
+			Chaos:     record.Chaos,
+			Recipe:    webhookRecipe,
+		})
+	}
+
+	payloads = append(payloads, WebhookPayload{
+		Event:     WebhookRunCompleted,
+		RunID:     runID,
+		Timestamp: now,
+		Chaos:     record.Chaos,
+		Run:       stats,
+	})
+
+	sent := 0
+	for _, payload := range payloads {
+		if !subscription.wants(payload.Event) {
+			continue
+		}
+		if err := subscription.Send(payload); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to deliver %s webhook to %s: %v", payload.Event, subscription.URL, err), logger.LogWarning)
+			continue
+		}
+		sent++
+	}
+	logger.Logger(fmt.Sprintf("📡 Delivered %d webhook events to %s", sent, subscription.URL), logger.LogDebug)
+}
@@ -0,0 +1,141 @@
+// workspace_one.go
+package autopkg
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Preference keys read by the Workspace ONE importer in .ws1 recipes
+const (
+	WS1APIURLKey            = "WS1_API_URL"
+	WS1ConsoleURLKey        = "WS1_CONSOLE_URL"
+	WS1OAuthClientIDKey     = "WS1_OAUTH_CLIENT_ID"
+	WS1OAuthClientSecretKey = "WS1_OAUTH_CLIENT_SECRET"
+	WS1OAuthTokenURLKey     = "WS1_OAUTH_TOKEN_URL"
+	WS1GroupIDKey           = "WS1_GROUPID"
+	WS1SmartGroupKey        = "WS1_SMART_GROUP_NAME"
+	WS1PushModeKey          = "WS1_PUSH_MODE"
+)
+
+// DefaultWS1TokenURL is the Workspace ONE Access token endpoint for the North America region
+const DefaultWS1TokenURL = "https://na.uemauth.vmwservices.com/connect/token"
+
+// WorkspaceOneOptions contains the Workspace ONE UEM settings used by .ws1 recipes
+type WorkspaceOneOptions struct {
+	APIURL            string // UEM REST API server, e.g. https://as1234.awmdm.com
+	ConsoleURL        string // UEM console, used for links in reports, defaults to the API URL
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthTokenURL     string // Regional token endpoint, defaults to DefaultWS1TokenURL
+	GroupID           string // Numeric ID of the organization group apps are imported into
+	SmartGroup        string // Smart group new apps are assigned to by default
+	PushMode          string // Assignment push mode: "Auto" or "OnDemand", defaults to OnDemand
+}
+
+// ConfigureWorkspaceOne validates the Workspace ONE settings and writes them to
+// the AutoPkg preferences. Settings not given keep their configured values, so
+// a single setting such as the smart group can be changed on its own.
+func ConfigureWorkspaceOne(prefsPath string, options *WorkspaceOneOptions) error {
+	if options == nil {
+		return fmt.Errorf("no Workspace ONE settings given")
+	}
+	merged := *options
+	if existing, err := GetAutoPkgPreferences(prefsPath); err == nil {
+		for _, setting := range []struct {
+			value *string
+			key   string
+		}{
+			{&merged.APIURL, WS1APIURLKey},
+			{&merged.ConsoleURL, WS1ConsoleURLKey},
+			{&merged.OAuthClientID, WS1OAuthClientIDKey},
+			{&merged.OAuthClientSecret, WS1OAuthClientSecretKey},
+			{&merged.OAuthTokenURL, WS1OAuthTokenURLKey},
+			{&merged.GroupID, WS1GroupIDKey},
+			{&merged.SmartGroup, WS1SmartGroupKey},
+			{&merged.PushMode, WS1PushModeKey},
+		} {
+			if configured, ok := existing[setting.key].(string); ok && *setting.value == "" {
+				*setting.value = configured
+			}
+		}
+	}
+
+	prefs, err := WorkspaceOnePreferences(&merged)
+	if err != nil {
+		return err
+	}
+	if err := UpdateAutoPkgPreferences(prefsPath, prefs); err != nil {
+		return err
+	}
+
+	logger.Logger(fmt.Sprintf("✅ Workspace ONE configured for organization group %s", merged.GroupID), logger.LogSuccess)
+	return nil
+}
+
+// WorkspaceOnePreferences validates the Workspace ONE settings and returns the
+// preference keys to set, with defaults filled in
+func WorkspaceOnePreferences(options *WorkspaceOneOptions) (map[string]interface{}, error) {
+	if options == nil {
+		return nil, fmt.Errorf("no Workspace ONE settings given")
+	}
+
+	if err := ValidateHTTPSURL("Workspace ONE API URL", options.APIURL); err != nil {
+		return nil, err
+	}
+	if options.OAuthClientID == "" || options.OAuthClientSecret == "" {
+		return nil, fmt.Errorf("Workspace ONE needs both an OAuth client ID and client secret")
+	}
+	if _, err := strconv.Atoi(options.GroupID); err != nil {
+		return nil, fmt.Errorf("Workspace ONE organization group ID must be numeric, got %q", options.GroupID)
+	}
+
+	consoleURL := options.ConsoleURL
+	if consoleURL == "" {
+		consoleURL = options.APIURL
+	} else if err := ValidateHTTPSURL("Workspace ONE console URL", consoleURL); err != nil {
+		return nil, err
+	}
+
+	tokenURL := options.OAuthTokenURL
+	if tokenURL == "" {
+		tokenURL = DefaultWS1TokenURL
+	} else if err := ValidateHTTPSURL("Workspace ONE OAuth token URL", tokenURL); err != nil {
+		return nil, err
+	}
+
+	pushMode := options.PushMode
+	switch pushMode {
+	case "":
+		pushMode = "OnDemand"
+	case "Auto", "OnDemand":
+	default:
+		return nil, fmt.Errorf("Workspace ONE push mode must be Auto or OnDemand, got %q", pushMode)
+	}
+
+	prefs := map[string]interface{}{
+		WS1APIURLKey:            options.APIURL,
+		WS1ConsoleURLKey:        consoleURL,
+		WS1OAuthClientIDKey:     options.OAuthClientID,
+		WS1OAuthClientSecretKey: options.OAuthClientSecret,
+		WS1OAuthTokenURLKey:     tokenURL,
+		WS1GroupIDKey:           options.GroupID,
+		WS1PushModeKey:          pushMode,
+	}
+	if options.SmartGroup != "" {
+		prefs[WS1SmartGroupKey] = options.SmartGroup
+	}
+	return prefs, nil
+}
+
+// ValidateHTTPSURL checks a setting is an absolute https URL
+func ValidateHTTPSURL(name string, value string) error {
+	parsed, err := url.Parse(value)
+	if value == "" || err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%s must be an https URL, got %q", name, value)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Package i18n translates the user-facing strings in notifications and reports.
+// Log and debug output stays in English so it can be searched and shared.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is used when no locale is configured or a string has no translation
+const DefaultLocale = "en"
+
+// LocaleEnvVar selects the locale when no --locale flag is given
+const LocaleEnvVar = "AUTOPKGCTL_LOCALE"
+
+// Global locale setting with thread-safe access
+var (
+	currentLocale = DefaultLocale
+	localeMutex   sync.RWMutex
+)
+
+// SetLocale sets the locale used by T. Region and encoding suffixes such as
+// de_DE.UTF-8 are accepted and reduced to the language code.
+func SetLocale(locale string) error {
+	language := normalizeLocale(locale)
+	if language == "" {
+		language = DefaultLocale
+	}
+	if _, ok := catalogs[language]; !ok {
+		return fmt.Errorf("unsupported locale %q (available: %s)", locale, strings.Join(AvailableLocales(), ", "))
+	}
+
+	localeMutex.Lock()
+	defer localeMutex.Unlock()
+	currentLocale = language
+	return nil
+}
+
+// GetLocale returns the current locale
+func GetLocale() string {
+	localeMutex.RLock()
+	defer localeMutex.RUnlock()
+	return currentLocale
+}
+
+// LocaleFromEnv returns the locale configured through AUTOPKGCTL_LOCALE
+func LocaleFromEnv() string {
+	return os.Getenv(LocaleEnvVar)
+}
+
+// AvailableLocales returns the supported locale codes
+func AvailableLocales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// T returns the message for a key in the current locale, formatted with args.
+// Missing translations fall back to English, and unknown keys to the key itself.
+func T(key string, args ...interface{}) string {
+	format, ok := catalogs[GetLocale()][key]
+	if !ok {
+		if format, ok = catalogs[DefaultLocale][key]; !ok {
+			format = key
+		}
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// normalizeLocale reduces a locale such as de_DE.UTF-8 or de-AT to its language code
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if index := strings.IndexAny(locale, "_-.@"); index >= 0 {
+		locale = locale[:index]
+	}
+	return locale
+}
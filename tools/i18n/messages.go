@@ -0,0 +1,99 @@
+// messages.go
+package i18n
+
+// catalogs maps locale codes to message formats. English is the reference
+// catalog; every key should exist there.
+var catalogs = map[string]map[string]string{
+	"en": {
+		// Recipe notifications
+		"notify.trust_failed.title":   "❌ %s failed trust verification",
+		"notify.trust_failed.message": "Update trust verification manually",
+		"notify.failed.title":         "❌ %s failed",
+		"notify.unknown_error":        "Unknown error",
+		"notify.imported.title":       "✅ Imported %s %s",
+		"notify.removed.title":        "🗑 Removed old versions of %s",
+		"notify.promoted.title":       "🚀 Promoted %s",
+		"notify.artifacts_published":  "📦 %d artifacts published",
+		"notify.version_changes":      "🆕 %d new versions since the last run",
+		"notify.version_changed":      "%s: %s → %s (%s)",
+		"notify.version_new":          "%s: %s, first build (%s)",
+		"notify.health.title":         "🩺 Pipeline health: %d alerts",
+		"notify.flaky.title":          "🎲 %d flaky recipes",
+		"notify.flaky_recipe":         "%s: flakiness %.0f%%, %d flips, %d of %d runs failed",
+		"notify.version_lag.title":    "🔮 %d apps behind upstream",
+		"notify.version_lag":          "%s: built %s, %s lists %s for %d days",
+
+		// Pipeline health alerts
+		"health.duration":       "Run took %s, %.0f%% longer than the %s average of the last %d runs",
+		"health.failure_rate":   "%.0f%% of recipes failed, %.1fx the %.0f%% baseline of the last %d runs",
+		"health.no_updates":     "No recipe produced a new version in the last %d days",
+		"health.download_spike": "%s downloaded %s, %.1fx its %s average",
+
+		// Notification field labels
+		"field.name":                 "Name",
+		"field.intune_app_id":        "Intune App ID",
+		"field.content_version_id":   "Content Version ID",
+		"field.jamf_package_id":      "Jamf Package ID",
+		"field.remove_count":         "Remove Count",
+		"field.removed_versions":     "Removed Versions",
+		"field.keep_count":           "Keep Count",
+		"field.promotions":           "Promotions",
+		"field.blacklisted_versions": "Blacklisted Versions",
+		"field.log":                  "Log",
+
+		// Reports
+		"report.nothing_recorded": "ℹ️ Nothing recorded yet",
+		"report.storage_heading":  "💾 MDM storage consumed by uploaded artifacts",
+		"report.storage_month":    "📅 %s: %s across %d runs",
+		"report.estimated_cost":   "Estimated cost: %.2f",
+		"report.annotated_runs":   "📝 Annotated runs",
+		"report.run_recipes":      "%d recipes",
+		"report.changes":          "🆕 New versions",
+	},
+	"de": {
+		// Recipe notifications
+		"notify.trust_failed.title":   "❌ Vertrauensprüfung für %s fehlgeschlagen",
+		"notify.trust_failed.message": "Vertrauensinformationen bitte manuell aktualisieren",
+		"notify.failed.title":         "❌ %s fehlgeschlagen",
+		"notify.unknown_error":        "Unbekannter Fehler",
+		"notify.imported.title":       "✅ %s %s importiert",
+		"notify.removed.title":        "🗑 Alte Versionen von %s entfernt",
+		"notify.promoted.title":       "🚀 %s freigegeben",
+		"notify.artifacts_published":  "📦 %d Artefakte veröffentlicht",
+		"notify.version_changes":      "🆕 %d neue Versionen seit dem letzten Lauf",
+		"notify.version_changed":      "%s: %s → %s (%s)",
+		"notify.version_new":          "%s: %s, erster Build (%s)",
+		"notify.health.title":         "🩺 Pipeline-Zustand: %d Warnungen",
+		"notify.flaky.title":          "🎲 %d instabile Rezepte",
+		"notify.flaky_recipe":         "%s: Instabilität %.0f%%, %d Wechsel, %d von %d Läufen fehlgeschlagen",
+		"notify.version_lag.title":    "🔮 %d Apps hinter der aktuellen Version",
+		"notify.version_lag":          "%s: %s gebaut, %s listet seit %[5]d Tagen %[4]s",
+
+		// Pipeline health alerts
+		"health.duration":       "Lauf dauerte %s, %.0f%% länger als der Durchschnitt von %s der letzten %d Läufe",
+		"health.failure_rate":   "%.0f%% der Rezepte fehlgeschlagen, %.1f-mal die Basis von %.0f%% der letzten %d Läufe",
+		"health.no_updates":     "Kein Rezept hat in den letzten %d Tagen eine neue Version erzeugt",
+		"health.download_spike": "%s hat %s heruntergeladen, %.1f-mal den Durchschnitt von %s",
+
+		// Notification field labels
+		"field.name":                 "Name",
+		"field.intune_app_id":        "Intune-App-ID",
+		"field.content_version_id":   "Inhaltsversions-ID",
+		"field.jamf_package_id":      "Jamf-Paket-ID",
+		"field.remove_count":         "Anzahl entfernt",
+		"field.removed_versions":     "Entfernte Versionen",
+		"field.keep_count":           "Anzahl behalten",
+		"field.promotions":           "Freigaben",
+		"field.blacklisted_versions": "Gesperrte Versionen",
+		"field.log":                  "Protokoll",
+
+		// Reports
+		"report.nothing_recorded": "ℹ️ Noch nichts aufgezeichnet",
+		"report.storage_heading":  "💾 MDM-Speicherverbrauch durch hochgeladene Artefakte",
+		"report.storage_month":    "📅 %s: %s in %d Läufen",
+		"report.estimated_cost":   "Geschätzte Kosten: %.2f",
+		"report.annotated_runs":   "📝 Kommentierte Läufe",
+		"report.run_recipes":      "%d Rezepte",
+		"report.changes":          "🆕 Neue Versionen",
+	},
+}
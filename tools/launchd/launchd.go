@@ -0,0 +1,187 @@
+// launchd.go
+package launchd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"howett.net/plist"
+)
+
+// Job is a launchd job, the LaunchAgent property list keys autopkgctl writes
+type Job struct {
+	Label                 string             `plist:"Label"`
+	ProgramArguments      []string           `plist:"ProgramArguments"`
+	WorkingDirectory      string             `plist:"WorkingDirectory,omitempty"`
+	EnvironmentVariables  map[string]string  `plist:"EnvironmentVariables,omitempty"`
+	StartInterval         int                `plist:"StartInterval,omitempty"` // Seconds between runs
+	StartCalendarInterval []CalendarInterval `plist:"StartCalendarInterval,omitempty"`
+	StandardOutPath       string             `plist:"StandardOutPath,omitempty"`
+	StandardErrorPath     string             `plist:"StandardErrorPath,omitempty"`
+	ProcessType           string             `plist:"ProcessType,omitempty"`
+}
+
+// CalendarInterval starts a job every day at a time
+type CalendarInterval struct {
+	Hour   int `plist:"Hour"`
+	Minute int `plist:"Minute"`
+}
+
+// Status is what launchd reports about a loaded job
+type Status struct {
+	Loaded       bool   `json:"loaded"`
+	Domain       string `json:"domain,omitempty"`
+	State        string `json:"state,omitempty"` // e.g. "running" or "not running"
+	PID          int    `json:"pid,omitempty"`
+	Runs         int    `json:"runs"`
+	LastExitCode string `json:"last_exit_code,omitempty"`
+}
+
+// ParseTimeOfDay parses an HH:MM time of day
+func ParseTimeOfDay(value string) (CalendarInterval, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return CalendarInterval{}, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return CalendarInterval{Hour: t.Hour(), Minute: t.Minute()}, nil
+}
+
+// String formats the interval as HH:MM
+func (c CalendarInterval) String() string {
+	return fmt.Sprintf("%02d:%02d", c.Hour, c.Minute)
+}
+
+// UserAgentPath returns the path of the current user's LaunchAgent for a label
+func UserAgentPath(label string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+}
+
+// WriteJob writes a job's property list
+func WriteJob(path string, job *Job) error {
+	data, err := plist.MarshalIndent(job, plist.XMLFormat, "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal launchd job: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write launchd job: %w", err)
+	}
+	return nil
+}
+
+// ReadJob reads a job's property list
+func ReadJob(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if _, err := plist.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to parse launchd job %s: %w", path, err)
+	}
+	return &job, nil
+}
+
+// Bootstrap loads a job into the current user's launchd domain, replacing
+// the loaded job of the same label
+func Bootstrap(path string, label string) error {
+	domain, err := userDomain()
+	if err != nil {
+		return err
+	}
+	// Not loaded yet is fine
+	_ = exec.Command("launchctl", "bootout", domain+"/"+label).Run()
+	if output, err := exec.Command("launchctl", "bootstrap", domain, path).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to load %s into %s: %v: %s", label, domain, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Bootout unloads a job from the current user's launchd domain, doing
+// nothing when it isn't loaded
+func Bootout(label string) error {
+	domain, err := userDomain()
+	if err != nil {
+		return err
+	}
+	if exec.Command("launchctl", "print", domain+"/"+label).Run() != nil {
+		return nil
+	}
+	if output, err := exec.Command("launchctl", "bootout", domain+"/"+label).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unload %s from %s: %v: %s", label, domain, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Print returns what launchd reports about a job, not loaded when it has no such job
+func Print(label string) (*Status, error) {
+	domain, err := userDomain()
+	if err != nil {
+		return nil, err
+	}
+	output, err := exec.Command("launchctl", "print", domain+"/"+label).Output()
+	if err != nil {
+		return &Status{Domain: domain}, nil
+	}
+	return parsePrint(domain, string(output)), nil
+}
+
+// parsePrint reads the top level "key = value" lines of launchctl print
+func parsePrint(domain string, output string) *Status {
+	status := &Status{Loaded: true, Domain: domain}
+	for _, line := range strings.Split(output, "\n") {
+		// Top level keys are indented by a single tab
+		if !strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "\t\t") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " = ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "state":
+			status.State = value
+		case "pid":
+			status.PID, _ = strconv.Atoi(value)
+		case "runs":
+			status.Runs, _ = strconv.Atoi(value)
+		case "last exit code":
+			status.LastExitCode = value
+		}
+	}
+	return status
+}
+
+// Available returns an error unless launchd is there to load jobs into
+func Available() error {
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("launchd schedules need macOS")
+	}
+	return nil
+}
+
+// userDomain returns the launchd domain of the current user: the GUI session
+// when the user is logged in, otherwise the background user domain, as on
+// runners only reached over SSH
+func userDomain() (string, error) {
+	if err := Available(); err != nil {
+		return "", err
+	}
+	uid := strconv.Itoa(os.Getuid())
+	if exec.Command("launchctl", "print", "gui/"+uid).Run() == nil {
+		return "gui/" + uid, nil
+	}
+	return "user/" + uid, nil
+}
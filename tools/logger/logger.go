@@ -2,6 +2,8 @@ package logger
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"sync"
 )
 
@@ -16,7 +18,8 @@ const (
 
 // Global log level setting with thread-safe access
 var (
-	currentLogLevel = LogInfo
+	currentLogLevel           = LogInfo
+	logOutput       io.Writer = os.Stdout
 	logMutex        sync.RWMutex
 )
 
@@ -27,6 +30,13 @@ func SetLogLevel(level int) {
 	currentLogLevel = level
 }
 
+// SetOutput sets where log messages are written, e.g. to keep them out of a full-screen UI
+func SetOutput(w io.Writer) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+	logOutput = w
+}
+
 // GetLogLevel returns the current log level
 func GetLogLevel() int {
 	logMutex.RLock()
@@ -38,6 +48,7 @@ func GetLogLevel() int {
 func Logger(message string, level int) {
 	logMutex.RLock()
 	shouldLog := level >= currentLogLevel
+	output := logOutput
 	logMutex.RUnlock()
 
 	if !shouldLog {
@@ -59,7 +70,7 @@ func Logger(message string, level int) {
 	default:
 		prefix = "[LOG] "
 	}
-	fmt.Println(prefix + message)
+	fmt.Fprintln(output, prefix+message)
 }
 
 // Debug logs a debug message
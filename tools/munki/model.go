@@ -0,0 +1,29 @@
+// Package munki maintains a Munki repo after .munki recipes import into it:
+// rebuilding the catalogs, adding new items to catalogs and manifests, and
+// checking the imported pkginfo made it into the catalogs.
+package munki
+
+// DefaultMakeCatalogsPath is where the Munki tools install makecatalogs
+const DefaultMakeCatalogsPath = "/usr/local/munki/makecatalogs"
+
+// DefaultManifestSection is the manifest section new items are added to
+const DefaultManifestSection = "managed_installs"
+
+// Import is an item MunkiImporter added to the repo, as its report summary lists it
+type Import struct {
+	Recipe      string   `json:"recipe"`
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Catalogs    []string `json:"catalogs,omitempty"`
+	PkginfoPath string   `json:"pkginfo_path"`       // Relative to the repo's pkgsinfo directory
+	PkgPath     string   `json:"pkg_path,omitempty"` // Relative to the repo's pkgs directory
+}
+
+// Result is what a repo update did with an import
+type Result struct {
+	Import
+	AddedCatalogs []string `json:"added_catalogs,omitempty"` // Catalogs the pkginfo was added to
+	Manifests     []string `json:"manifests,omitempty"`      // Manifests the item was added to
+	Verified      bool     `json:"verified"`                 // The pkginfo landed in every catalog it's in
+	Problems      []string `json:"problems,omitempty"`
+}
@@ -0,0 +1,184 @@
+// repo.go
+package munki
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"howett.net/plist"
+)
+
+// Repo is a Munki repo on a local or mounted file system
+type Repo struct {
+	Path             string
+	MakeCatalogsPath string // Defaults to DefaultMakeCatalogsPath
+}
+
+// MakeCatalogs rebuilds the repo's catalogs from its pkginfo files
+func (r *Repo) MakeCatalogs() error {
+	makeCatalogs := r.MakeCatalogsPath
+	if makeCatalogs == "" {
+		makeCatalogs = DefaultMakeCatalogsPath
+	}
+	if _, err := exec.LookPath(makeCatalogs); err != nil {
+		return fmt.Errorf("makecatalogs not found at %s, install the Munki tools: %w", makeCatalogs, err)
+	}
+
+	logger.Logger(fmt.Sprintf("📚 Rebuilding catalogs of %s", r.Path), logger.LogInfo)
+	var output bytes.Buffer
+	cmd := exec.Command(makeCatalogs, r.Path)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("makecatalogs failed: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// AddToCatalogs adds an imported item's pkginfo to catalogs it isn't in yet,
+// e.g. testing, and returns the catalogs it was added to
+func (r *Repo) AddToCatalogs(item Import, catalogs []string) ([]string, error) {
+	path := filepath.Join(r.Path, "pkgsinfo", item.PkginfoPath)
+	pkginfo, format, err := readPlist(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pkginfo of %s %s: %w", item.Name, item.Version, err)
+	}
+
+	current := stringValues(pkginfo["catalogs"])
+	var added []string
+	for _, catalog := range catalogs {
+		if !containsString(current, catalog) {
+			current = append(current, catalog)
+			added = append(added, catalog)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	pkginfo["catalogs"] = current
+	if err := writePlist(path, pkginfo, format); err != nil {
+		return nil, fmt.Errorf("failed to write pkginfo of %s %s: %w", item.Name, item.Version, err)
+	}
+	return added, nil
+}
+
+// AddToManifest adds an item to a section of an existing manifest, reporting
+// whether it had to be added
+func (r *Repo) AddToManifest(manifest string, section string, name string) (bool, error) {
+	if section == "" {
+		section = DefaultManifestSection
+	}
+	path := filepath.Join(r.Path, "manifests", manifest)
+	contents, format, err := readPlist(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read manifest %s: %w", manifest, err)
+	}
+
+	items := stringValues(contents[section])
+	if containsString(items, name) {
+		return false, nil
+	}
+	contents[section] = append(items, name)
+	if err := writePlist(path, contents, format); err != nil {
+		return false, fmt.Errorf("failed to write manifest %s: %w", manifest, err)
+	}
+	return true, nil
+}
+
+// Verify checks an imported item's pkginfo and package are in the repo and
+// that the item is in the all catalog and every catalog its pkginfo lists,
+// returning the problems found
+func (r *Repo) Verify(item Import) []string {
+	var problems []string
+
+	pkginfo, _, err := readPlist(filepath.Join(r.Path, "pkgsinfo", item.PkginfoPath))
+	if err != nil {
+		return []string{fmt.Sprintf("pkginfo %s is missing: %v", item.PkginfoPath, err)}
+	}
+	if item.PkgPath != "" {
+		if _, err := os.Stat(filepath.Join(r.Path, "pkgs", item.PkgPath)); err != nil {
+			problems = append(problems, fmt.Sprintf("package %s is missing from pkgs", item.PkgPath))
+		}
+	}
+
+	for _, catalog := range append([]string{"all"}, stringValues(pkginfo["catalogs"])...) {
+		found, err := r.catalogContains(catalog, item.Name, item.Version)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to read catalog %s: %v", catalog, err))
+			continue
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s %s is not in catalog %s", item.Name, item.Version, catalog))
+		}
+	}
+	return problems
+}
+
+// catalogContains reports whether a catalog lists a version of an item
+func (r *Repo) catalogContains(catalog string, name string, version string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(r.Path, "catalogs", catalog))
+	if err != nil {
+		return false, err
+	}
+	var items []map[string]interface{}
+	if _, err := plist.Unmarshal(data, &items); err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if item["name"] == name && item["version"] == version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readPlist reads a pkginfo or manifest, returning the format to write it back in
+func readPlist(path string) (map[string]interface{}, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var contents map[string]interface{}
+	format, err := plist.Unmarshal(data, &contents)
+	if err != nil {
+		return nil, 0, err
+	}
+	return contents, format, nil
+}
+
+// writePlist writes a pkginfo or manifest back in the format it was read in
+func writePlist(path string, contents map[string]interface{}, format int) error {
+	data, err := plist.MarshalIndent(contents, format, "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// stringValues returns the strings of a plist array
+func stringValues(value interface{}) []string {
+	values, _ := value.([]interface{})
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// containsString reports whether a slice holds a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
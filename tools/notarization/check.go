@@ -0,0 +1,127 @@
+// check.go
+package notarization
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// assessmentTypes maps artifact types to the spctl assessment that applies to them
+var assessmentTypes = map[string][]string{
+	"pkg": {"--type", "install"},
+	"app": {"--type", "execute"},
+	"dmg": {"--type", "open", "--context", "context:primary-signature"},
+}
+
+// ArtifactType returns the artifact type of a path, or "" when its
+// notarization can't be checked
+func ArtifactType(path string) string {
+	artifactType := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if artifactType == "mpkg" {
+		artifactType = "pkg"
+	}
+	if _, ok := assessmentTypes[artifactType]; !ok {
+		return ""
+	}
+	return artifactType
+}
+
+// Check validates an artifact's stapled ticket with `xcrun stapler validate`
+// and assesses it with `spctl --assess`, which also asks Apple about tickets
+// that aren't stapled. With Staple set, notarized artifacts without a stapled
+// ticket have it stapled.
+func Check(path string, options *Options) (*Result, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	if runtime.GOOS != "darwin" {
+		return nil, ErrUnsupported
+	}
+
+	artifactType := ArtifactType(path)
+	if artifactType == "" {
+		return nil, fmt.Errorf("can't check the notarization of %s: not a pkg, dmg or app", filepath.Base(path))
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	result := &Result{
+		Path:      path,
+		Type:      artifactType,
+		Stapled:   stapled(path),
+		CheckedAt: time.Now().UTC(),
+	}
+	if err := assess(result, path); err != nil {
+		return nil, err
+	}
+
+	if options.Staple && result.Notarized && !result.Stapled {
+		if output, err := exec.Command("xcrun", "stapler", "staple", path).CombinedOutput(); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to staple the notarization ticket to %s: %s", filepath.Base(path), strings.TrimSpace(string(output))), logger.LogWarning)
+		} else {
+			result.Stapled = stapled(path)
+			logger.Logger(fmt.Sprintf("📎 Stapled the notarization ticket to %s", filepath.Base(path)), logger.LogInfo)
+		}
+	}
+
+	switch {
+	case result.Notarized:
+		logger.Logger(fmt.Sprintf("✅ %s is notarized (stapled: %t)", filepath.Base(path), result.Stapled), logger.LogSuccess)
+	case result.Accepted:
+		logger.Logger(fmt.Sprintf("⚠️ %s is accepted by Gatekeeper but not notarized (%s)", filepath.Base(path), result.Source), logger.LogWarning)
+	default:
+		logger.Logger(fmt.Sprintf("❌ %s is rejected by Gatekeeper (%s)", filepath.Base(path), result.Source), logger.LogWarning)
+	}
+	return result, nil
+}
+
+// stapled reports whether a notarization ticket is stapled to an artifact
+func stapled(path string) bool {
+	return exec.Command("xcrun", "stapler", "validate", "-q", path).Run() == nil
+}
+
+// assess runs the Gatekeeper assessment of the artifact at path. spctl exits
+// non-zero for rejected artifacts, so the verdict is read from its output instead.
+func assess(result *Result, path string) error {
+	args := append([]string{"--assess", "-vv"}, assessmentTypes[result.Type]...)
+	cmd := exec.Command("spctl", append(args, path)...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	runErr := cmd.Run()
+
+	verdict := ""
+	for _, line := range strings.Split(out.String(), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasSuffix(line, ": accepted"):
+			verdict = "accepted"
+		case strings.HasSuffix(line, ": rejected"):
+			verdict = "rejected"
+		case strings.HasPrefix(line, "source="):
+			result.Source = strings.TrimPrefix(line, "source=")
+		case strings.HasPrefix(line, "origin="):
+			result.Origin = strings.TrimPrefix(line, "origin=")
+		}
+	}
+	if verdict == "" {
+		if runErr != nil {
+			return fmt.Errorf("failed to assess %s with spctl: %w: %s", filepath.Base(result.Path), runErr, strings.TrimSpace(out.String()))
+		}
+		return fmt.Errorf("failed to assess %s with spctl: unexpected output %q", filepath.Base(result.Path), strings.TrimSpace(out.String()))
+	}
+
+	result.Accepted = verdict == "accepted"
+	// Gatekeeper only reports a notarized source for accepted artifacts with a ticket
+	result.Notarized = result.Accepted && strings.Contains(result.Source, "Notarized")
+	return nil
+}
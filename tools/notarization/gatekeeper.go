@@ -0,0 +1,81 @@
+// gatekeeper.go
+package notarization
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// quarantineAttribute is the extended attribute macOS sets on downloaded files
+const quarantineAttribute = "com.apple.quarantine"
+
+// quarantineAgent is recorded as the app that downloaded the quarantined copy
+const quarantineAgent = "autopkgctl"
+
+// SimulateQuarantine copies an artifact to a temporary directory, sets the
+// quarantine attribute a browser download gets and asks Gatekeeper whether it
+// would open or install it on this Mac. Signing and notarization problems
+// that only show up on managed Macs, which receive packages quarantined, are
+// caught this way before the package is uploaded to an MDM.
+func SimulateQuarantine(path string) (*Result, error) {
+	if runtime.GOOS != "darwin" {
+		return nil, ErrUnsupported
+	}
+
+	artifactType := ArtifactType(path)
+	if artifactType == "" {
+		return nil, fmt.Errorf("can't assess %s with Gatekeeper: not a pkg, dmg or app", filepath.Base(path))
+	}
+
+	tempDir, err := os.MkdirTemp("", "autopkgctl-gatekeeper-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// ditto copies bundle-style packages and apps with their signatures intact
+	quarantined := filepath.Join(tempDir, filepath.Base(path))
+	if output, err := exec.Command("ditto", path, quarantined).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to copy %s: %w: %s", filepath.Base(path), err, strings.TrimSpace(string(output)))
+	}
+
+	value := fmt.Sprintf("0081;%x;%s;", time.Now().Unix(), quarantineAgent)
+	if output, err := exec.Command("xattr", "-w", quarantineAttribute, value, quarantined).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to quarantine %s: %w: %s", filepath.Base(path), err, strings.TrimSpace(string(output)))
+	}
+
+	result := &Result{
+		Path:        path,
+		Type:        artifactType,
+		Stapled:     stapled(quarantined),
+		Quarantined: true,
+		OSVersion:   runnerOSVersion(),
+		CheckedAt:   time.Now().UTC(),
+	}
+	if err := assess(result, quarantined); err != nil {
+		return nil, err
+	}
+
+	if result.Accepted {
+		logger.Logger(fmt.Sprintf("✅ Gatekeeper on macOS %s accepts quarantined %s (%s)", result.OSVersion, filepath.Base(path), result.Source), logger.LogSuccess)
+	} else {
+		logger.Logger(fmt.Sprintf("❌ Gatekeeper on macOS %s rejects quarantined %s (%s)", result.OSVersion, filepath.Base(path), result.Source), logger.LogWarning)
+	}
+	return result, nil
+}
+
+// runnerOSVersion returns the macOS version of this Mac, or "" when unknown
+func runnerOSVersion() string {
+	output, err := exec.Command("sw_vers", "-productVersion").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
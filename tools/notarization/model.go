@@ -0,0 +1,30 @@
+// Package notarization checks whether packages, disk images and apps are
+// notarized by Apple, using stapler and Gatekeeper's spctl assessment.
+package notarization
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned when notarization or Gatekeeper can't be checked on this platform
+var ErrUnsupported = errors.New("notarization and Gatekeeper checks require macOS with the Xcode command line tools")
+
+// Result is the notarization status of a single artifact
+type Result struct {
+	Path        string    `json:"path"`
+	Type        string    `json:"type"`                  // "pkg", "dmg" or "app"
+	Notarized   bool      `json:"notarized"`             // Apple issued a notarization ticket for it
+	Stapled     bool      `json:"stapled"`               // The ticket is stapled, so Macs can verify it offline
+	Accepted    bool      `json:"accepted"`              // Gatekeeper accepts it
+	Source      string    `json:"source,omitempty"`      // Gatekeeper assessment source, e.g. "Notarized Developer ID"
+	Origin      string    `json:"origin,omitempty"`      // Signing identity, e.g. "Developer ID Installer: Vendor (TEAMID)"
+	Quarantined bool      `json:"quarantined,omitempty"` // Assessed as a quarantined download, see SimulateQuarantine
+	OSVersion   string    `json:"os_version,omitempty"`  // macOS version of the Mac that assessed it, when quarantined
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// Options controls notarization checks
+type Options struct {
+	Staple bool // Staple the ticket to notarized artifacts that don't have one yet
+}
@@ -0,0 +1,219 @@
+package orchestrator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/artifacts"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/i18n"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// ArtifactUploadStepOptions contains options for an artifact upload step
+type ArtifactUploadStepOptions struct {
+	Storage        *artifacts.Config
+	OnlyUpdated    bool   // Only upload artifacts from recipes with status "updated"
+	IncludeReports bool   // Also upload the AutoPkg report plists from earlier steps
+	Notify         bool   // Send the download URLs to the configured Slack/Teams webhooks
+	Idempotent     bool   // Skip artifacts whose recipe version already has an upload receipt for this bucket
+	HistoryPath    string // History database holding upload receipts, defaults to autopkg.DefaultHistoryPath
+}
+
+// AddArtifactUploadStep appends a step that publishes the pkgs and dmgs produced
+// by earlier run recipes steps to S3, Azure Blob or GCS.
+func (w *Workflow) AddArtifactUploadStep(name string, options *ArtifactUploadStepOptions) *Workflow {
+	return w.AddStep(WorkflowStep{
+		Name:    name,
+		Type:    StepTypeArtifactUpload,
+		Options: options,
+	})
+}
+
+// executeArtifactUploadStep uploads produced artifacts and records their URLs in the context
+func executeArtifactUploadStep(ctx *WorkflowContext, step WorkflowStep) error {
+	options, ok := step.Options.(*ArtifactUploadStepOptions)
+	if !ok || options == nil || options.Storage == nil {
+		return fmt.Errorf("invalid options for artifact upload step")
+	}
+
+	publisher, err := artifacts.NewPublisher(options.Storage)
+	if err != nil {
+		return err
+	}
+
+	var toUpload []artifacts.Artifact
+	for _, result := range ctx.RecipeResults {
+		if options.OnlyUpdated && result.Status != "updated" {
+			continue
+		}
+		for _, produced := range autopkg.DiscoverArtifacts(result) {
+			// App bundles are directories, they ship inside the pkgs and dmgs
+			if produced.Type == "app" {
+				continue
+			}
+			toUpload = append(toUpload, artifacts.Artifact{
+				Path:    produced.Path,
+				App:     produced.App,
+				Version: produced.Version,
+				Recipe:  produced.Recipe,
+			})
+		}
+		// SBOMs are keyed alongside the artifacts they describe
+		for _, sbomPath := range result.SBOMs {
+			described := sbomArtifact(result.Artifacts, sbomPath)
+			toUpload = append(toUpload, artifacts.Artifact{
+				Path:    sbomPath,
+				App:     described.App,
+				Version: described.Version,
+				Recipe:  result.Recipe,
+			})
+		}
+	}
+
+	if options.IncludeReports {
+		for _, reportPath := range ctx.ReportPaths {
+			toUpload = append(toUpload, artifacts.Artifact{
+				Path:    reportPath,
+				App:     "reports",
+				Version: ctx.RunID,
+			})
+		}
+	}
+
+	if len(toUpload) == 0 {
+		logger.Logger("ℹ️ No artifacts to upload", logger.LogInfo)
+		return nil
+	}
+
+	var history *autopkg.History
+	if options.Idempotent {
+		historyPath := options.HistoryPath
+		if historyPath == "" {
+			historyPath = autopkg.DefaultHistoryPath("")
+		}
+		if history, err = autopkg.OpenHistory(historyPath); err != nil {
+			return err
+		}
+		defer history.Close()
+
+		var receipted []artifacts.UploadResult
+		toUpload, receipted = filterReceiptedUploads(history, publisher, toUpload)
+		ctx.Uploads = append(ctx.Uploads, receipted...)
+	}
+
+	uploads, err := publisher.Publish(toUpload, ctx.RunID)
+	ctx.Uploads = append(ctx.Uploads, uploads...)
+
+	if history != nil {
+		recordUploadReceipts(history, publisher, uploads, ctx.RunID)
+	}
+
+	if options.Notify {
+		notifyArtifactLinks(ctx.Notification, uploads)
+	}
+
+	return err
+}
+
+// filterReceiptedUploads splits off artifacts that were already uploaded to the
+// publisher's bucket, returning fresh download links for them instead
+func filterReceiptedUploads(history *autopkg.History, publisher *artifacts.Publisher, toUpload []artifacts.Artifact) ([]artifacts.Artifact, []artifacts.UploadResult) {
+	var remaining []artifacts.Artifact
+	var receipted []artifacts.UploadResult
+	for _, artifact := range toUpload {
+		if artifact.Recipe == "" || artifact.Version == "" {
+			remaining = append(remaining, artifact)
+			continue
+		}
+
+		receipt, err := history.Receipt(autopkg.ReceiptPhaseArtifact, publisher.Target(), artifact.Recipe, receiptVersion(artifact))
+		if err != nil || receipt == nil {
+			remaining = append(remaining, artifact)
+			continue
+		}
+
+		logger.Logger(fmt.Sprintf("🧾 Skipping %s: already uploaded as %s in run %s", filepath.Base(artifact.Path), receipt.Location, receipt.RunID), logger.LogInfo)
+		url, _ := publisher.URL(receipt.Location)
+		receipted = append(receipted, artifacts.UploadResult{Artifact: artifact, Key: receipt.Location, URL: url})
+	}
+	return remaining, receipted
+}
+
+// recordUploadReceipts issues a receipt for every successful upload with a known recipe version
+func recordUploadReceipts(history *autopkg.History, publisher *artifacts.Publisher, uploads []artifacts.UploadResult, runID string) {
+	for _, upload := range uploads {
+		if upload.Error != nil || upload.Artifact.Recipe == "" || upload.Artifact.Version == "" {
+			continue
+		}
+		err := history.RecordReceipt(autopkg.UploadReceipt{
+			Phase:    autopkg.ReceiptPhaseArtifact,
+			Recipe:   upload.Artifact.Recipe,
+			Version:  receiptVersion(upload.Artifact),
+			Tenant:   publisher.Target(),
+			RunID:    runID,
+			Location: upload.Key,
+		})
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to record upload receipt for %s: %v", upload.Key, err), logger.LogWarning)
+		}
+	}
+}
+
+// receiptVersion distinguishes the files uploaded for one recipe version, such as a pkg and its SBOM
+func receiptVersion(artifact artifacts.Artifact) string {
+	return artifact.Version + "/" + filepath.Base(artifact.Path)
+}
+
+// sbomArtifact returns the produced artifact an SBOM file was generated for
+func sbomArtifact(produced []autopkg.ProducedArtifact, sbomPath string) autopkg.ProducedArtifact {
+	for _, artifact := range produced {
+		if strings.HasPrefix(filepath.Base(sbomPath), filepath.Base(artifact.Path)+".") {
+			return artifact
+		}
+	}
+	return autopkg.ProducedArtifact{App: "sbom"}
+}
+
+// notifyArtifactLinks sends the download URLs of uploaded artifacts to Slack and Teams
+func notifyArtifactLinks(notification autopkg.NotificationOptions, uploads []artifacts.UploadResult) {
+	var slackLines, teamsLines []string
+	for _, upload := range uploads {
+		if upload.Error != nil || upload.URL == "" {
+			continue
+		}
+		label := filepath.Base(upload.Artifact.Path)
+		if upload.Artifact.Version != "" && upload.Artifact.App != "reports" {
+			label = fmt.Sprintf("%s %s", upload.Artifact.App, upload.Artifact.Version)
+		}
+		slackLines = append(slackLines, fmt.Sprintf("• <%s|%s>", upload.URL, label))
+		teamsLines = append(teamsLines, fmt.Sprintf("- [%s](%s)", label, upload.URL))
+	}
+	if len(slackLines) == 0 {
+		return
+	}
+
+	title := i18n.T("notify.artifacts_published", len(slackLines))
+
+	if notification.EnableSlack {
+		slackNotifier := &autopkg.SlackNotifier{
+			WebhookURL: notification.SlackWebhook,
+			Username:   notification.SlackUsername,
+			Channel:    notification.SlackChannel,
+			IconEmoji:  notification.SlackIcon,
+		}
+		if err := slackNotifier.Notify(title, strings.Join(slackLines, "\n"), "good"); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to send artifact links to Slack: %v", err), logger.LogWarning)
+		}
+	}
+
+	if notification.EnableTeams {
+		teamsNotifier := &autopkg.MSTeamsNotifier{
+			WebhookURL: notification.TeamsWebhook,
+		}
+		if err := teamsNotifier.NotifyMSTeams(title, strings.Join(teamsLines, "\n"), false, false, "", ""); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to send artifact links to Teams: %v", err), logger.LogWarning)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/artifacts"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/munki"
+)
+
+// Checkpoint is the progress of a workflow, saved after every step and every
+// recipe so a run that crashed or failed can be resumed where it stopped
+type Checkpoint struct {
+	Workflow       string                       `json:"workflow"`
+	RunID          string                       `json:"run_id"`
+	UpdatedAt      time.Time                    `json:"updated_at"`
+	CompletedSteps []string                     `json:"completed_steps"` // Steps that succeeded or were skipped
+	Recipes        map[string]*CheckpointRecipe `json:"recipes"`         // Recipes processed so far, by recipe
+	ReportPaths    []string                     `json:"report_paths,omitempty"`
+	Uploads        []artifacts.UploadResult     `json:"uploads,omitempty"`
+}
+
+// CheckpointRecipe is the saved outcome of a recipe
+type CheckpointRecipe struct {
+	Step         string                     `json:"step"` // Step that ran the recipe
+	Status       string                     `json:"status"`
+	Error        string                     `json:"error,omitempty"`
+	FailureKind  string                     `json:"failure_kind,omitempty"`
+	Artifacts    []autopkg.ProducedArtifact `json:"artifacts,omitempty"`
+	SBOMs        []string                   `json:"sboms,omitempty"`
+	Uploads      []autopkg.UploadedArtifact `json:"uploads,omitempty"`
+	CacheDir     string                     `json:"cache_dir,omitempty"`
+	MunkiImports []munki.Import             `json:"munki_imports,omitempty"`
+}
+
+// WithCheckpoint saves the workflow's progress to a state file as it runs.
+// With resume set, the progress saved by an earlier run is loaded first: its
+// run ID is reused, completed steps are skipped and recipes that already
+// succeeded aren't run again. The file is removed once the workflow succeeds.
+func WithCheckpoint(path string, resume bool) WorkflowOption {
+	return func(w *Workflow) {
+		w.checkpointPath = path
+		w.resume = resume
+	}
+}
+
+// checkpointer saves a workflow's progress, guarding it against concurrent recipe updates
+type checkpointer struct {
+	mu         sync.Mutex
+	path       string
+	checkpoint *Checkpoint
+}
+
+// LoadCheckpoint reads a saved workflow checkpoint
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if checkpoint.Recipes == nil {
+		checkpoint.Recipes = make(map[string]*CheckpointRecipe)
+	}
+	return &checkpoint, nil
+}
+
+// newCheckpointer starts a checkpoint for the workflow, resuming the saved one
+// when asked to and restoring its progress into the context
+func (w *Workflow) newCheckpointer(ctx *WorkflowContext) (*checkpointer, error) {
+	c := &checkpointer{
+		path:       w.checkpointPath,
+		checkpoint: &Checkpoint{Workflow: w.Name, RunID: ctx.RunID, Recipes: make(map[string]*CheckpointRecipe)},
+	}
+	if !w.resume {
+		return c, nil
+	}
+
+	saved, err := LoadCheckpoint(w.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Logger(fmt.Sprintf("ℹ️ No checkpoint at %s, starting workflow %s from the beginning", w.checkpointPath, w.Name), logger.LogInfo)
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if saved.Workflow != w.Name {
+		return nil, fmt.Errorf("checkpoint %s is for workflow %s, not %s", w.checkpointPath, saved.Workflow, w.Name)
+	}
+
+	c.checkpoint = saved
+	ctx.RunID = saved.RunID
+	ctx.ReportPaths = append(ctx.ReportPaths, saved.ReportPaths...)
+	ctx.Uploads = append(ctx.Uploads, saved.Uploads...)
+	for recipe, saved := range saved.Recipes {
+		ctx.RecipeResults[recipe] = saved.result(recipe)
+	}
+
+	logger.Logger(fmt.Sprintf("⏯️ Resuming workflow %s run %s: %d steps completed, %d recipes processed", w.Name, saved.RunID, len(saved.CompletedSteps), len(saved.Recipes)), logger.LogInfo)
+	return c, nil
+}
+
+// completed reports whether a step finished in the run being resumed
+func (c *checkpointer) completed(step string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range c.checkpoint.CompletedSteps {
+		if name == step {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingRecipes returns the recipes of a step's recipe input that the step
+// hasn't run successfully yet, or the input unchanged when it ran none
+func (c *checkpointer) pendingRecipes(step string, recipeInput string) (string, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ran := false
+	for _, saved := range c.checkpoint.Recipes {
+		ran = ran || saved.Step == step
+	}
+	if !ran {
+		return recipeInput, 0, nil
+	}
+
+	recipes, err := autopkg.ParseRecipeInput(recipeInput).Parse()
+	if err != nil {
+		return "", 0, err
+	}
+	var pending []string
+	for _, recipe := range recipes {
+		if saved, done := c.checkpoint.Recipes[recipe]; done && saved.Step == step && saved.Status != "failed" {
+			continue
+		}
+		pending = append(pending, recipe)
+	}
+	return strings.Join(pending, ","), len(recipes) - len(pending), nil
+}
+
+// recordRecipe saves the outcome of a recipe run by a step
+func (c *checkpointer) recordRecipe(step string, recipe string, result *autopkg.RecipeBatchResult) {
+	c.mu.Lock()
+	c.checkpoint.Recipes[recipe] = newCheckpointRecipe(step, result)
+	c.mu.Unlock()
+	c.save()
+}
+
+// recordStep saves the context after a step, marking it completed unless it failed
+func (c *checkpointer) recordStep(ctx *WorkflowContext, result StepResult) {
+	c.mu.Lock()
+	if result.Error == nil {
+		c.checkpoint.CompletedSteps = append(c.checkpoint.CompletedSteps, result.Name)
+	}
+	// Batch results are final once the step ends, e.g. with verified uploads and SBOMs
+	for recipe, recipeResult := range ctx.RecipeResults {
+		step := result.Name
+		if saved, exists := c.checkpoint.Recipes[recipe]; exists && saved.Step != "" {
+			step = saved.Step
+		}
+		c.checkpoint.Recipes[recipe] = newCheckpointRecipe(step, recipeResult)
+	}
+	c.checkpoint.ReportPaths = ctx.ReportPaths
+	c.checkpoint.Uploads = ctx.Uploads
+	c.mu.Unlock()
+	c.save()
+}
+
+// save writes the checkpoint, replacing the file atomically so a crash mid-write leaves the last one intact
+func (c *checkpointer) save() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkpoint.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(c.checkpoint, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(c.path+".tmp", data, 0644)
+	}
+	if err == nil {
+		err = os.Rename(c.path+".tmp", c.path)
+	}
+	if err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to save workflow checkpoint: %v", err), logger.LogWarning)
+	}
+}
+
+// remove deletes the checkpoint once the workflow has succeeded
+func (c *checkpointer) remove() {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to remove workflow checkpoint: %v", err), logger.LogWarning)
+	}
+}
+
+// newCheckpointRecipe saves the outcome of a recipe from its batch result
+func newCheckpointRecipe(step string, result *autopkg.RecipeBatchResult) *CheckpointRecipe {
+	return &CheckpointRecipe{
+		Step:         step,
+		Status:       result.Status,
+		Error:        errorMessage(result.ExecutionError),
+		FailureKind:  result.FailureKind,
+		Artifacts:    result.Artifacts,
+		SBOMs:        result.SBOMs,
+		Uploads:      result.Uploads,
+		CacheDir:     result.CacheDir,
+		MunkiImports: result.MunkiImports,
+	}
+}
+
+// result rebuilds the batch result of a saved recipe
+func (r *CheckpointRecipe) result(recipe string) *autopkg.RecipeBatchResult {
+	result := &autopkg.RecipeBatchResult{
+		Recipe:       recipe,
+		Status:       r.Status,
+		Executed:     r.Status != "skipped" && r.Status != autopkg.StatusBlocked,
+		FailureKind:  r.FailureKind,
+		Artifacts:    r.Artifacts,
+		SBOMs:        r.SBOMs,
+		Uploads:      r.Uploads,
+		CacheDir:     r.CacheDir,
+		MunkiImports: r.MunkiImports,
+	}
+	if r.Error != "" {
+		result.ExecutionError = errors.New(r.Error)
+	}
+	return result
+}
+
+// errorMessage returns an error's message, or an empty string for nil
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// checkpointProgress saves every recipe's outcome as the batch runs, passing
+// progress on to the receiver the step's options already had
+type checkpointProgress struct {
+	step         string
+	checkpointer *checkpointer
+	next         autopkg.RecipeProgress
+}
+
+func (p *checkpointProgress) RecipeStarted(recipe string, cancel func()) {
+	if p.next != nil {
+		p.next.RecipeStarted(recipe, cancel)
+	}
+}
+
+func (p *checkpointProgress) RecipeProcessor(recipe string, processor string) {
+	if p.next != nil {
+		p.next.RecipeProcessor(recipe, processor)
+	}
+}
+
+func (p *checkpointProgress) RecipeFinished(recipe string, result *autopkg.RecipeBatchResult) {
+	p.checkpointer.recordRecipe(p.step, recipe, result)
+	if p.next != nil {
+		p.next.RecipeFinished(recipe, result)
+	}
+}
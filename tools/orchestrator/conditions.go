@@ -0,0 +1,463 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Values returns the workflow context as the map step conditions are evaluated against:
+//
+//	recipes_total, recipes_updated, recipes_unchanged, recipes_failed,
+//	recipes_skipped, recipes_blocked   number of recipes run so far with each status
+//	uploads, steps_failed              artifacts uploaded and steps failed so far
+//	gatekeeper_rejected                packages Gatekeeper rejected in gatekeeper steps
+//	security_tripped                   artifacts that tripped security gate steps
+//	munki_imported                     items imported into Munki by the recipes run so far
+//	always, no_failures                true, and whether no step has failed
+//	previous_succeeded, previous_failed outcome of the last step that ran
+//	step:<name>.success, .failed, .skipped, .ran, .duration, .error
+//	                                   outcome of an earlier step, duration in seconds
+func (ctx *WorkflowContext) Values() map[string]interface{} {
+	values := map[string]interface{}{
+		"always":        true,
+		"recipes_total": float64(len(ctx.RecipeResults)),
+		"uploads":       float64(len(ctx.Uploads)),
+	}
+
+	rejected := 0
+	for _, assessed := range ctx.Gatekeeper {
+		if !assessed.Accepted {
+			rejected++
+		}
+	}
+	values["gatekeeper_rejected"] = float64(rejected)
+
+	tripped := 0
+	for _, scanned := range ctx.SecurityScans {
+		if scanned.Tripped {
+			tripped++
+		}
+	}
+	values["security_tripped"] = float64(tripped)
+
+	imported := 0
+	for _, result := range ctx.RecipeResults {
+		imported += len(result.MunkiImports)
+	}
+	values["munki_imported"] = float64(imported)
+
+	statuses := map[string]string{
+		"updated":             "recipes_updated",
+		"unchanged":           "recipes_unchanged",
+		"failed":              "recipes_failed",
+		"skipped":             "recipes_skipped",
+		autopkg.StatusBlocked: "recipes_blocked",
+	}
+	for _, name := range statuses {
+		values[name] = float64(0)
+	}
+	for _, result := range ctx.RecipeResults {
+		if name, known := statuses[result.Status]; known {
+			values[name] = values[name].(float64) + 1
+		}
+	}
+
+	failed := 0
+	for _, result := range ctx.StepResults {
+		if result.Error != nil {
+			failed++
+		}
+		prefix := "step:" + result.Name + "."
+		values[prefix+"success"] = !result.Skipped && result.Error == nil
+		values[prefix+"failed"] = result.Error != nil
+		values[prefix+"skipped"] = result.Skipped
+		values[prefix+"ran"] = true
+		values[prefix+"duration"] = result.Duration.Seconds()
+		values[prefix+"error"] = errorMessage(result.Error)
+	}
+	values["steps_failed"] = float64(failed)
+	values["no_failures"] = failed == 0
+
+	previous := previousStepResult(ctx)
+	values["previous_succeeded"] = previous != nil && previous.Error == nil
+	values["previous_failed"] = previous != nil && previous.Error != nil
+
+	return values
+}
+
+// stepValueFields are the fields of step:<name>.<field> references, with the
+// value they have for steps that haven't run
+var stepValueFields = map[string]interface{}{
+	"success":  false,
+	"failed":   false,
+	"skipped":  false,
+	"ran":      false,
+	"duration": float64(0),
+	"error":    "",
+}
+
+// ParseCondition parses a step condition expression evaluated against the
+// workflow context Values, e.g. "recipes_updated > 0" or
+// "step:verify.success == true && !recipes_failed". Expressions compare values
+// with == != > >= < <=, combine them with && || and !, and group them with
+// parentheses. Literals are numbers, true, false and quoted strings. A value
+// on its own is true when it is true, non-zero or a non-empty string.
+func ParseCondition(expression string) (func(ctx *WorkflowContext) bool, error) {
+	tokens, err := tokenizeCondition(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expression, err)
+	}
+	parser := &conditionParser{tokens: tokens}
+	node, err := parser.parseOr()
+	if err == nil && parser.pos < len(parser.tokens) {
+		err = fmt.Errorf("unexpected %q", parser.tokens[parser.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expression, err)
+	}
+
+	return func(ctx *WorkflowContext) bool {
+		value, err := node.eval(ctx.Values())
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Condition %q could not be evaluated, treating it as false: %v", expression, err), logger.LogWarning)
+			return false
+		}
+		return truthy(value)
+	}, nil
+}
+
+// previousStepResult returns the result of the last step that ran, or nil
+func previousStepResult(ctx *WorkflowContext) *StepResult {
+	for i := len(ctx.StepResults) - 1; i >= 0; i-- {
+		if !ctx.StepResults[i].Skipped {
+			return &ctx.StepResults[i]
+		}
+	}
+	return nil
+}
+
+// conditionToken is a lexical token of a condition expression
+type conditionToken struct {
+	kind string // "op", "ident", "number", "string" or "bool"
+	text string
+}
+
+// conditionOperators are the two character operators of condition expressions
+var conditionOperators = map[string]bool{"==": true, "!=": true, "<=": true, ">=": true, "&&": true, "||": true}
+
+// tokenizeCondition splits a condition expression into tokens
+func tokenizeCondition(expression string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("()", r):
+			tokens = append(tokens, conditionToken{kind: "op", text: string(r)})
+			i++
+		case strings.ContainsRune("=!<>&|", r):
+			op := string(r)
+			if i+1 < len(runes) && conditionOperators[string(runes[i:i+2])] {
+				op = string(runes[i : i+2])
+			}
+			if op == "=" || op == "&" || op == "|" {
+				return nil, fmt.Errorf("unknown operator %q", op)
+			}
+			tokens = append(tokens, conditionToken{kind: "op", text: op})
+			i += len(op)
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, conditionToken{kind: "string", text: string(runes[i+1 : end])})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, conditionToken{kind: "number", text: string(runes[i:end])})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || strings.ContainsRune("_.:-", runes[end])) {
+				end++
+			}
+			word := string(runes[i:end])
+			kind := "ident"
+			if word == "true" || word == "false" {
+				kind = "bool"
+			}
+			tokens = append(tokens, conditionToken{kind: kind, text: word})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return tokens, nil
+}
+
+// conditionNode is a node of a parsed condition expression
+type conditionNode interface {
+	eval(values map[string]interface{}) (interface{}, error)
+}
+
+// conditionParser is a recursive descent parser of condition expressions
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+// peek returns the text of the next operator token, or an empty string
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == "op" {
+		return p.tokens[p.pos].text
+	}
+	return ""
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var right conditionNode
+		if right, err = p.parseAnd(); err == nil {
+			left = logicalNode{op: "||", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var right conditionNode
+		if right, err = p.parseUnary(); err == nil {
+			left = logicalNode{op: "&&", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) parseUnary() (conditionNode, error) {
+	if p.peek() == "!" {
+		p.pos++
+		operand, err := p.parseUnary()
+		return notNode{operand: operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *conditionParser) parseComparison() (conditionNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", ">", ">=", "<", "<=":
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseOperand() (conditionNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case "number":
+		number, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token.text)
+		}
+		return literalNode{value: number}, nil
+	case "string":
+		return literalNode{value: token.text}, nil
+	case "bool":
+		return literalNode{value: token.text == "true"}, nil
+	case "ident":
+		return newValueNode(token.text)
+	}
+
+	if token.text == "(" {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// literalNode is a number, string or boolean literal
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+// valueNode looks a name up in the context values
+type valueNode struct {
+	name     string
+	fallback interface{} // Value of step references to steps that haven't run
+}
+
+// newValueNode checks a name refers to a context value, see WorkflowContext.Values
+func newValueNode(name string) (conditionNode, error) {
+	if strings.HasPrefix(name, "step:") {
+		dot := strings.LastIndex(name, ".")
+		if dot <= len("step:") {
+			return nil, fmt.Errorf("step reference %q needs a field, e.g. step:<name>.success", name)
+		}
+		fallback, known := stepValueFields[name[dot+1:]]
+		if !known {
+			return nil, fmt.Errorf("unknown step field %q in %s", name[dot+1:], name)
+		}
+		return valueNode{name: name, fallback: fallback}, nil
+	}
+
+	if _, known := (&WorkflowContext{}).Values()[name]; !known {
+		return nil, fmt.Errorf("unknown value %q", name)
+	}
+	return valueNode{name: name}, nil
+}
+
+func (n valueNode) eval(values map[string]interface{}) (interface{}, error) {
+	if value, exists := values[n.name]; exists {
+		return value, nil
+	}
+	if n.fallback != nil {
+		return n.fallback, nil
+	}
+	return nil, fmt.Errorf("unknown value %q", n.name)
+}
+
+// notNode negates the truth of its operand
+type notNode struct {
+	operand conditionNode
+}
+
+func (n notNode) eval(values map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+// logicalNode combines the truth of two operands, short-circuiting
+type logicalNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (n logicalNode) eval(values map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !truthy(left) {
+		return false, nil
+	}
+	if n.op == "||" && truthy(left) {
+		return true, nil
+	}
+	right, err := n.right.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(right), nil
+}
+
+// compareNode compares two values of the same type
+type compareNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (n compareNode) eval(values map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(values)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("can't compare number %v with %v", l, right)
+		}
+		switch n.op {
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		case "<":
+			return l < r, nil
+		default:
+			return l <= r, nil
+		}
+	case bool, string:
+		if fmt.Sprintf("%T", left) != fmt.Sprintf("%T", right) {
+			return nil, fmt.Errorf("can't compare %v with %v", left, right)
+		}
+		switch n.op {
+		case "==":
+			return left == right, nil
+		case "!=":
+			return left != right, nil
+		}
+		return nil, fmt.Errorf("%s only compares numbers", n.op)
+	}
+	return nil, fmt.Errorf("can't compare %v", left)
+}
+
+// truthy reports whether a value counts as true on its own
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return false
+}
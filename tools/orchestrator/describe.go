@@ -0,0 +1,93 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StepDescription is a static description of a workflow step
+type StepDescription struct {
+	Name            string   `json:"name"`
+	Type            StepType `json:"type"`
+	Condition       string   `json:"condition,omitempty"`
+	ContinueOnError bool     `json:"continue_on_error"`
+}
+
+// Describe returns the configured steps with their conditions and error policies
+func (w *Workflow) Describe() []StepDescription {
+	descriptions := make([]StepDescription, 0, len(w.Steps))
+	for _, step := range w.Steps {
+		description := StepDescription{
+			Name:            step.Name,
+			Type:            step.Type,
+			ContinueOnError: step.ContinueOnError,
+		}
+		if step.Condition != nil {
+			description.Condition = step.ConditionLabel
+			if description.Condition == "" {
+				description.Condition = "custom condition"
+			}
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
+
+// Mermaid renders the workflow as a Mermaid flowchart. Conditional steps get a
+// decision node, and failing steps either continue to the next step or end the
+// workflow depending on their error policy.
+func (w *Workflow) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	b.WriteString(fmt.Sprintf("    start([%s])\n", mermaidLabel(w.Name)))
+
+	steps := w.Describe()
+	failNode := false
+	previous := "start"
+
+	for i, step := range steps {
+		stepNode := fmt.Sprintf("step%d", i+1)
+		next := "done"
+		if i+1 < len(steps) {
+			next = fmt.Sprintf("step%d", i+2)
+			if steps[i+1].Condition != "" {
+				next = fmt.Sprintf("cond%d", i+2)
+			}
+		}
+
+		entry := stepNode
+		if step.Condition != "" {
+			entry = fmt.Sprintf("cond%d", i+1)
+			b.WriteString(fmt.Sprintf("    %s{%s}\n", entry, mermaidLabel(step.Condition)))
+		}
+		b.WriteString(fmt.Sprintf("    %s --> %s\n", previous, entry))
+		if step.Condition != "" {
+			b.WriteString(fmt.Sprintf("    %s -- yes --> %s\n", entry, stepNode))
+			b.WriteString(fmt.Sprintf("    %s -- no --> %s\n", entry, next))
+		}
+
+		b.WriteString(fmt.Sprintf("    %s[%s]\n", stepNode, mermaidLabel(fmt.Sprintf("%s<br/><small>%s</small>", step.Name, step.Type))))
+		if step.ContinueOnError {
+			b.WriteString(fmt.Sprintf("    %s -. on error .-> %s\n", stepNode, next))
+		} else {
+			b.WriteString(fmt.Sprintf("    %s -- on error --> failed\n", stepNode))
+			failNode = true
+		}
+
+		// Success flows into the next step, or its decision node
+		previous = stepNode
+	}
+
+	b.WriteString(fmt.Sprintf("    %s --> done\n", previous))
+	b.WriteString("    done([Done])\n")
+	if failNode {
+		b.WriteString("    failed([Workflow failed])\n")
+	}
+
+	return b.String()
+}
+
+// mermaidLabel quotes a node label, escaping characters Mermaid would parse
+func mermaidLabel(label string) string {
+	return `"` + strings.ReplaceAll(label, `"`, "#quot;") + `"`
+}
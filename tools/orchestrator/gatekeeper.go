@@ -0,0 +1,92 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+)
+
+// GatekeeperStepOptions contains options for a Gatekeeper step
+type GatekeeperStepOptions struct {
+	OnlyUpdated bool // Only check packages from recipes with status "updated"
+}
+
+// AddGatekeeperStep appends a step that installs nothing but asks Gatekeeper
+// whether each package built by earlier run recipes steps would pass once it
+// arrives quarantined on a managed Mac running the runner's macOS version.
+// Recipes with a rejected package are marked failed, so later upload steps
+// with only_updated leave them out.
+func (w *Workflow) AddGatekeeperStep(name string, options *GatekeeperStepOptions) *Workflow {
+	return w.AddStep(WorkflowStep{
+		Name:    name,
+		Type:    StepTypeGatekeeper,
+		Options: options,
+	})
+}
+
+// executeGatekeeperStep assesses quarantined copies of the built packages
+func executeGatekeeperStep(ctx *WorkflowContext, step WorkflowStep) error {
+	options, ok := step.Options.(*GatekeeperStepOptions)
+	if !ok || options == nil {
+		return fmt.Errorf("invalid options for gatekeeper step")
+	}
+
+	recipes := make([]string, 0, len(ctx.RecipeResults))
+	for recipe := range ctx.RecipeResults {
+		recipes = append(recipes, recipe)
+	}
+	sort.Strings(recipes)
+
+	var rejected []string
+	checked := 0
+	for _, recipe := range recipes {
+		result := ctx.RecipeResults[recipe]
+		if result.Status == "failed" || (options.OnlyUpdated && result.Status != "updated") {
+			continue
+		}
+
+		var recipeRejected []string
+		for _, artifact := range autopkg.DiscoverArtifacts(result) {
+			if artifact.Type != "pkg" {
+				continue
+			}
+			assessed, err := notarization.SimulateQuarantine(artifact.Path)
+			if errors.Is(err, notarization.ErrUnsupported) {
+				return err
+			}
+			checked++
+			if err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Failed to assess %s: %v", filepath.Base(artifact.Path), err), logger.LogWarning)
+				recipeRejected = append(recipeRejected, filepath.Base(artifact.Path))
+				continue
+			}
+			ctx.Gatekeeper = append(ctx.Gatekeeper, *assessed)
+			if !assessed.Accepted {
+				recipeRejected = append(recipeRejected, filepath.Base(artifact.Path))
+			}
+		}
+
+		if len(recipeRejected) > 0 {
+			result.Status = "failed"
+			result.ExecutionError = fmt.Errorf("rejected by Gatekeeper: %s", strings.Join(recipeRejected, ", "))
+			result.FailureKind = autopkg.FailureKindGatekeeperRejected
+			rejected = append(rejected, recipeRejected...)
+		}
+	}
+
+	if checked == 0 {
+		logger.Logger("ℹ️ No packages to assess with Gatekeeper", logger.LogInfo)
+		return nil
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("%d of %d packages would be rejected by Gatekeeper: %s", len(rejected), checked, strings.Join(rejected, ", "))
+	}
+	logger.Logger(fmt.Sprintf("🛡️ Gatekeeper accepts all %d quarantined packages", checked), logger.LogSuccess)
+	return nil
+}
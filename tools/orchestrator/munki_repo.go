@@ -0,0 +1,107 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/munki"
+)
+
+// MunkiRepoStepOptions contains options for a Munki repo step
+type MunkiRepoStepOptions struct {
+	Repo            string   // Path of the Munki repo the .munki recipes import into
+	MakeCatalogs    string   // makecatalogs binary, defaults to munki.DefaultMakeCatalogsPath
+	Catalogs        []string // Catalogs to add new items to, e.g. testing
+	Manifests       []string // Existing manifests to add new items to
+	ManifestSection string   // Manifest section new items are added to, defaults to munki.DefaultManifestSection
+}
+
+// AddMunkiRepoStep appends a step that finishes the imports of earlier run
+// recipes steps into a Munki repo: new items are added to the given catalogs
+// and manifests, the catalogs are rebuilt with makecatalogs and every
+// imported pkginfo is checked to have landed in its catalogs.
+func (w *Workflow) AddMunkiRepoStep(name string, options *MunkiRepoStepOptions) *Workflow {
+	return w.AddStep(WorkflowStep{
+		Name:    name,
+		Type:    StepTypeMunkiRepo,
+		Options: options,
+	})
+}
+
+// executeMunkiRepoStep updates the Munki repo with the imported items and records the results in the context
+func executeMunkiRepoStep(ctx *WorkflowContext, step WorkflowStep) error {
+	options, ok := step.Options.(*MunkiRepoStepOptions)
+	if !ok || options == nil || options.Repo == "" {
+		return fmt.Errorf("invalid options for munki repo step")
+	}
+
+	recipes := make([]string, 0, len(ctx.RecipeResults))
+	for recipe := range ctx.RecipeResults {
+		recipes = append(recipes, recipe)
+	}
+	sort.Strings(recipes)
+
+	var results []munki.Result
+	for _, recipe := range recipes {
+		if ctx.RecipeResults[recipe].Status == "failed" {
+			continue
+		}
+		for _, item := range ctx.RecipeResults[recipe].MunkiImports {
+			results = append(results, munki.Result{Import: item})
+		}
+	}
+	if len(results) == 0 {
+		logger.Logger("ℹ️ No items imported into Munki", logger.LogInfo)
+		return nil
+	}
+
+	repo := &munki.Repo{Path: options.Repo, MakeCatalogsPath: options.MakeCatalogs}
+	for i := range results {
+		result := &results[i]
+		if len(options.Catalogs) > 0 {
+			added, err := repo.AddToCatalogs(result.Import, options.Catalogs)
+			if err != nil {
+				result.Problems = append(result.Problems, err.Error())
+			}
+			result.AddedCatalogs = added
+		}
+		for _, manifest := range options.Manifests {
+			added, err := repo.AddToManifest(manifest, options.ManifestSection, result.Name)
+			if err != nil {
+				result.Problems = append(result.Problems, err.Error())
+				continue
+			}
+			if added {
+				result.Manifests = append(result.Manifests, manifest)
+			}
+		}
+	}
+
+	if err := repo.MakeCatalogs(); err != nil {
+		ctx.Munki = append(ctx.Munki, results...)
+		return err
+	}
+
+	var failed []string
+	for i := range results {
+		result := &results[i]
+		problems := repo.Verify(result.Import)
+		result.Verified = len(problems) == 0
+		result.Problems = append(result.Problems, problems...)
+		if len(result.Problems) > 0 {
+			failed = append(failed, fmt.Sprintf("%s %s", result.Name, result.Version))
+			for _, problem := range result.Problems {
+				logger.Logger(fmt.Sprintf("⚠️ %s %s: %s", result.Name, result.Version, problem), logger.LogWarning)
+			}
+		}
+	}
+	ctx.Munki = append(ctx.Munki, results...)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d Munki imports weren't verified or added to their catalogs and manifests: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	logger.Logger(fmt.Sprintf("📚 All %d Munki imports are in the catalogs", len(results)), logger.LogSuccess)
+	return nil
+}
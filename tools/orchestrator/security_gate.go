@@ -0,0 +1,203 @@
+package orchestrator
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	securityscan "github.com/deploymenttheory/macos-autopkg-factory/tools/security_scan"
+)
+
+// SecurityGatePolicy contains the options for a security gate step
+type SecurityGatePolicy struct {
+	Threshold   string               // Severity that trips the gate, defaults to high
+	Quarantine  bool                 // Hold recipes that trip the gate as skipped instead of failing the workflow
+	OnlyUpdated bool                 // Only scan artifacts from recipes with status "updated"
+	Checks      securityscan.Options // Checks run on each artifact, Suspicious Package only when none are set
+	Allow       []SecurityAllowance  // Findings ignored for known-noisy vendors
+	HashList    *autopkg.HashList    // Allowlisted artifacts aren't scanned, denylisted ones always trip the gate
+}
+
+// SecurityAllowance ignores findings of recipes matching a glob, e.g. an
+// agent that always ships a kernel extension
+type SecurityAllowance struct {
+	Recipes []string       // Recipe name globs, matched case-insensitively
+	Checks  []string       // Checks the allowance covers, all when empty
+	Pattern *regexp.Regexp // Matched against finding messages, all findings when nil
+	Reason  string         // Why the findings are expected, logged when they are ignored
+}
+
+// SecurityGateResult is the scan of one artifact by a security gate step
+type SecurityGateResult struct {
+	Recipe  string               `json:"recipe"`
+	Report  *securityscan.Report `json:"report"`
+	Allowed int                  `json:"allowed"` // Findings ignored by allowances
+	Tripped bool                 `json:"tripped"` // Whether the findings left reach the threshold
+}
+
+// AddSecurityGateStep appends a step that scans the artifacts built by earlier
+// run recipes steps and compares the findings, less those the policy allows,
+// against its severity threshold. Recipes with an artifact at or above it are
+// marked failed and fail the step or, with Quarantine, are marked skipped as
+// quarantined so later upload steps with only_updated leave them out.
+func (w *Workflow) AddSecurityGateStep(name string, policy *SecurityGatePolicy) *Workflow {
+	return w.AddStep(WorkflowStep{
+		Name:    name,
+		Type:    StepTypeSecurityGate,
+		Options: policy,
+	})
+}
+
+// executeSecurityGateStep scans the built artifacts and gates recipes on their findings
+func executeSecurityGateStep(ctx *WorkflowContext, step WorkflowStep) error {
+	policy, ok := step.Options.(*SecurityGatePolicy)
+	if !ok || policy == nil {
+		return fmt.Errorf("invalid options for security gate step")
+	}
+	threshold := policy.Threshold
+	if threshold == "" {
+		threshold = securityscan.SeverityHigh
+	}
+	checks := policy.Checks
+	if !checks.SuspiciousPackage && !checks.Codesign && !checks.VirusTotal && !checks.Scripts && len(checks.Reputation) == 0 {
+		checks.SuspiciousPackage = true
+	}
+
+	recipes := make([]string, 0, len(ctx.RecipeResults))
+	for recipe := range ctx.RecipeResults {
+		recipes = append(recipes, recipe)
+	}
+	sort.Strings(recipes)
+
+	var failed, quarantined []string
+	scanned := 0
+	for _, recipe := range recipes {
+		result := ctx.RecipeResults[recipe]
+		if result.Status == "failed" || result.Status == "skipped" || result.Allowlisted || (policy.OnlyUpdated && result.Status != "updated") {
+			continue
+		}
+
+		var tripped []string
+		for _, artifact := range autopkg.DiscoverArtifacts(result) {
+			if artifact.Type != "pkg" && artifact.Type != "dmg" {
+				continue
+			}
+			if policy.HashList != nil {
+				entry, err := policy.HashList.LookupFile(artifact.Path)
+				if err == nil && entry != nil && entry.List == autopkg.HashDenied {
+					tripped = append(tripped, fmt.Sprintf("%s (denylisted: %s)", filepath.Base(artifact.Path), entry.Reason))
+					continue
+				}
+				if err == nil && entry != nil {
+					logger.Logger(fmt.Sprintf("✅ %s is allowlisted, not scanning it", filepath.Base(artifact.Path)), logger.LogInfo)
+					continue
+				}
+			}
+			report, err := securityscan.Scan(artifact.Path, checks)
+			scanned++
+			if err != nil {
+				logger.Logger(fmt.Sprintf("⚠️ Failed to scan %s: %v", filepath.Base(artifact.Path), err), logger.LogWarning)
+				tripped = append(tripped, filepath.Base(artifact.Path))
+				continue
+			}
+
+			gated := SecurityGateResult{Recipe: recipe, Report: report}
+			gated.Allowed = policy.allow(recipe, report)
+			gated.Tripped = report.Exceeds(threshold)
+			ctx.SecurityScans = append(ctx.SecurityScans, gated)
+			if gated.Tripped {
+				tripped = append(tripped, fmt.Sprintf("%s (%s)", filepath.Base(artifact.Path), report.Severity))
+			}
+		}
+		if len(tripped) == 0 {
+			continue
+		}
+
+		if policy.Quarantine {
+			result.Status = "skipped"
+			result.SkipReason = autopkg.SkipReasonQuarantined
+			result.Output = fmt.Sprintf("held by the security gate: %s", strings.Join(tripped, ", "))
+			logger.Logger(fmt.Sprintf("🔒 Quarantined %s: %s", recipe, strings.Join(tripped, ", ")), logger.LogWarning)
+			quarantined = append(quarantined, recipe)
+			continue
+		}
+		result.Status = "failed"
+		result.ExecutionError = fmt.Errorf("failed the security gate at %s: %s", threshold, strings.Join(tripped, ", "))
+		result.FailureKind = autopkg.FailureKindSecurityScan
+		failed = append(failed, recipe)
+	}
+
+	if scanned == 0 {
+		logger.Logger("ℹ️ No artifacts to scan for the security gate", logger.LogInfo)
+		return nil
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d recipes have artifacts with %s or worse findings: %s", len(failed), threshold, strings.Join(failed, ", "))
+	}
+	if len(quarantined) > 0 {
+		logger.Logger(fmt.Sprintf("🔒 Security gate quarantined %d recipes: %s", len(quarantined), strings.Join(quarantined, ", ")), logger.LogWarning)
+		return nil
+	}
+	logger.Logger(fmt.Sprintf("🛡️ All %d scanned artifacts are below the %s threshold", scanned, threshold), logger.LogSuccess)
+	return nil
+}
+
+// allow drops the findings of a report its allowances cover for a recipe,
+// recomputing the report's severity, and returns how many were dropped
+func (p *SecurityGatePolicy) allow(recipe string, report *securityscan.Report) int {
+	var allowances []SecurityAllowance
+	for _, allowance := range p.Allow {
+		for _, pattern := range allowance.Recipes {
+			if matched, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(recipe)); matched {
+				allowances = append(allowances, allowance)
+				break
+			}
+		}
+	}
+	if len(allowances) == 0 {
+		return 0
+	}
+
+	kept := make([]securityscan.Finding, 0, len(report.Findings))
+	for _, finding := range report.Findings {
+		allowance := findAllowance(allowances, finding)
+		if allowance == nil {
+			kept = append(kept, finding)
+			continue
+		}
+		logger.Logger(fmt.Sprintf("ℹ️ Allowed %s finding for %s: %s (%s)", finding.Severity, recipe, finding.Message, allowance.Reason), logger.LogDebug)
+	}
+	allowed := len(report.Findings) - len(kept)
+
+	// Findings stay sorted most severe first
+	report.Findings = kept
+	report.Severity = securityscan.SeverityNone
+	if len(kept) > 0 {
+		report.Severity = kept[0].Severity
+	}
+	return allowed
+}
+
+// findAllowance returns the first allowance covering a finding, or nil
+func findAllowance(allowances []SecurityAllowance, finding securityscan.Finding) *SecurityAllowance {
+	for i, allowance := range allowances {
+		if len(allowance.Checks) > 0 {
+			covered := false
+			for _, check := range allowance.Checks {
+				covered = covered || check == finding.Check
+			}
+			if !covered {
+				continue
+			}
+		}
+		if allowance.Pattern != nil && !allowance.Pattern.MatchString(finding.Message) {
+			continue
+		}
+		return &allowances[i]
+	}
+	return nil
+}
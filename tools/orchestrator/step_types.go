@@ -0,0 +1,163 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	securityscan "github.com/deploymenttheory/macos-autopkg-factory/tools/security_scan"
+)
+
+// StepExecutor implements a workflow step type. Custom step types, e.g.
+// "notarize" or "upload-to-s3", are added with RegisterStepType and then run
+// like the built-in ones: they are validated before the workflow starts, are
+// recorded in the step results and follow the step's ContinueOnError.
+type StepExecutor interface {
+	// Validate checks a step's options before the workflow runs any step
+	Validate(step WorkflowStep) error
+	// Execute runs the step, reading and updating the shared workflow context
+	Execute(ctx *WorkflowContext, step WorkflowStep) error
+}
+
+var (
+	stepExecutorsMu sync.RWMutex
+	stepExecutors   = map[StepType]StepExecutor{
+		StepTypeRunRecipes:     runRecipesExecutor{},
+		StepTypeArtifactUpload: artifactUploadExecutor{},
+		StepTypeGatekeeper:     gatekeeperExecutor{},
+		StepTypeMunkiRepo:      munkiRepoExecutor{},
+		StepTypeSecurityGate:   securityGateExecutor{},
+	}
+)
+
+// RegisterStepType adds a custom step type. Built-in and already registered
+// step types can't be replaced.
+func RegisterStepType(name StepType, executor StepExecutor) error {
+	if name == "" {
+		return fmt.Errorf("step type name is required")
+	}
+	if executor == nil {
+		return fmt.Errorf("step type %s has no executor", name)
+	}
+
+	stepExecutorsMu.Lock()
+	defer stepExecutorsMu.Unlock()
+	if _, exists := stepExecutors[name]; exists {
+		return fmt.Errorf("step type %s is already registered", name)
+	}
+	stepExecutors[name] = executor
+	return nil
+}
+
+// StepTypes returns the names of the built-in and registered step types
+func StepTypes() []StepType {
+	stepExecutorsMu.RLock()
+	defer stepExecutorsMu.RUnlock()
+
+	types := make([]StepType, 0, len(stepExecutors))
+	for name := range stepExecutors {
+		types = append(types, name)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// stepExecutor returns the executor of a step type
+func stepExecutor(name StepType) (StepExecutor, error) {
+	stepExecutorsMu.RLock()
+	defer stepExecutorsMu.RUnlock()
+
+	executor, exists := stepExecutors[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown step type: %s", name)
+	}
+	return executor, nil
+}
+
+// Validate checks every step has a known type and valid options
+func (w *Workflow) Validate() error {
+	for _, step := range w.Steps {
+		executor, err := stepExecutor(step.Type)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if err := executor.Validate(step); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+	}
+	return nil
+}
+
+// runRecipesExecutor runs a batch of recipes
+type runRecipesExecutor struct{}
+
+func (runRecipesExecutor) Validate(step WorkflowStep) error {
+	if options, ok := step.Options.(*RunRecipesStepOptions); !ok || options == nil {
+		return fmt.Errorf("invalid options for run recipes step")
+	}
+	return nil
+}
+
+func (runRecipesExecutor) Execute(ctx *WorkflowContext, step WorkflowStep) error {
+	return ctx.workflow.executeRunRecipesStep(ctx, step)
+}
+
+// artifactUploadExecutor publishes produced artifacts to object storage
+type artifactUploadExecutor struct{}
+
+func (artifactUploadExecutor) Validate(step WorkflowStep) error {
+	if options, ok := step.Options.(*ArtifactUploadStepOptions); !ok || options == nil || options.Storage == nil {
+		return fmt.Errorf("invalid options for artifact upload step")
+	}
+	return nil
+}
+
+func (artifactUploadExecutor) Execute(ctx *WorkflowContext, step WorkflowStep) error {
+	return executeArtifactUploadStep(ctx, step)
+}
+
+// gatekeeperExecutor assesses quarantined copies of built packages with Gatekeeper
+type gatekeeperExecutor struct{}
+
+func (gatekeeperExecutor) Validate(step WorkflowStep) error {
+	if options, ok := step.Options.(*GatekeeperStepOptions); !ok || options == nil {
+		return fmt.Errorf("invalid options for gatekeeper step")
+	}
+	return nil
+}
+
+func (gatekeeperExecutor) Execute(ctx *WorkflowContext, step WorkflowStep) error {
+	return executeGatekeeperStep(ctx, step)
+}
+
+// securityGateExecutor scans built artifacts and gates recipes on the severity of the findings
+type securityGateExecutor struct{}
+
+func (securityGateExecutor) Validate(step WorkflowStep) error {
+	policy, ok := step.Options.(*SecurityGatePolicy)
+	if !ok || policy == nil {
+		return fmt.Errorf("invalid options for security gate step")
+	}
+	if policy.Threshold != "" && !securityscan.ValidSeverity(policy.Threshold) {
+		return fmt.Errorf("invalid security gate threshold %q", policy.Threshold)
+	}
+	return nil
+}
+
+func (securityGateExecutor) Execute(ctx *WorkflowContext, step WorkflowStep) error {
+	return executeSecurityGateStep(ctx, step)
+}
+
+// munkiRepoExecutor rebuilds Munki catalogs and adds imported items to catalogs and manifests
+type munkiRepoExecutor struct{}
+
+func (munkiRepoExecutor) Validate(step WorkflowStep) error {
+	if options, ok := step.Options.(*MunkiRepoStepOptions); !ok || options == nil || options.Repo == "" {
+		return fmt.Errorf("invalid options for munki repo step")
+	}
+	return nil
+}
+
+func (munkiRepoExecutor) Execute(ctx *WorkflowContext, step WorkflowStep) error {
+	return executeMunkiRepoStep(ctx, step)
+}
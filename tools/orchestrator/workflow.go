@@ -0,0 +1,430 @@
+// Package orchestrator composes AutoPkg batch runs and post-run steps into workflows
+package orchestrator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/artifacts"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/munki"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+)
+
+// StepType identifies what a workflow step does
+type StepType string
+
+// Built-in step types, more can be added with RegisterStepType
+const (
+	StepTypeRunRecipes     StepType = "run-recipes"
+	StepTypeArtifactUpload StepType = "artifact-upload"
+	StepTypeGatekeeper     StepType = "gatekeeper"
+	StepTypeMunkiRepo      StepType = "munki-repo"
+	StepTypeSecurityGate   StepType = "security-gate"
+)
+
+// WorkflowStep is a single unit of work in a workflow
+type WorkflowStep struct {
+	Name            string
+	Type            StepType
+	Condition       func(ctx *WorkflowContext) bool               // Step is skipped when this returns false
+	ConditionLabel  string                                        // Human readable form of Condition, used by Describe
+	ContinueOnError bool                                          // Keep executing later steps if this step fails
+	Options         interface{}                                   // Step type specific options
+	OnSuccess       func(ctx *WorkflowContext, result StepResult) // Called after the step completes without error
+	OnFailure       func(ctx *WorkflowContext, result StepResult) // Called after the step fails, before the workflow stops or continues
+}
+
+// StepResult records the outcome of a workflow step
+type StepResult struct {
+	Name     string
+	Type     StepType
+	Skipped  bool
+	Resumed  bool // Skipped because it completed in the run being resumed
+	Error    error
+	Duration time.Duration
+}
+
+// WorkflowContext carries state between workflow steps
+type WorkflowContext struct {
+	RunID         string
+	RecipeResults map[string]*autopkg.RecipeBatchResult
+	ReportPaths   []string
+	Uploads       []artifacts.UploadResult
+	Gatekeeper    []notarization.Result // Gatekeeper verdicts on quarantined packages
+	Munki         []munki.Result        // Items munki repo steps added to catalogs and manifests and verified
+	SecurityScans []SecurityGateResult  // Artifacts scanned by security gate steps
+	Notification  autopkg.NotificationOptions
+	StepResults   []StepResult
+
+	workflow   *Workflow
+	checkpoint *checkpointer
+	span       *autopkg.Span // Span of the step running, when tracing
+}
+
+// Workflow is an ordered list of steps executed against a shared context
+type Workflow struct {
+	Name  string
+	Steps []WorkflowStep
+
+	runID        string
+	notification *autopkg.NotificationOptions
+	policy       *autopkg.RecipePolicy
+	beforeStep   StepHook
+	afterStep    StepHook
+	eventSinks   []autopkg.EventSink
+	tracer       *autopkg.Tracer
+
+	checkpointPath string
+	resume         bool
+}
+
+// StepHook is called around workflow steps, e.g. to record metrics or open
+// tickets, without changing how the steps themselves execute
+type StepHook func(step WorkflowStep, result StepResult)
+
+// WorkflowOption configures a workflow
+type WorkflowOption func(*Workflow)
+
+// WithRunID sets the run identifier shared by every step, generated if unset
+func WithRunID(runID string) WorkflowOption {
+	return func(w *Workflow) {
+		w.runID = runID
+	}
+}
+
+// WithNotifications sets the notification targets used by steps that notify,
+// overriding those of the run recipes step
+func WithNotifications(notification autopkg.NotificationOptions) WorkflowOption {
+	return func(w *Workflow) {
+		w.notification = &notification
+	}
+}
+
+// WithRecipePolicy sets a recipe policy enforced by every run recipes step,
+// on top of any policy the step's own batch options set
+func WithRecipePolicy(policy *autopkg.RecipePolicy) WorkflowOption {
+	return func(w *Workflow) {
+		w.policy = policy
+	}
+}
+
+// WithStepHooks sets hooks called for every step. before is called just before
+// a step runs, with a result holding only its name and type, and after is
+// called once it finishes or is skipped. Either may be nil.
+func WithStepHooks(before StepHook, after StepHook) WorkflowOption {
+	return func(w *Workflow) {
+		w.beforeStep = before
+		w.afterStep = after
+	}
+}
+
+// WithEventSinks sets sinks receiving the events of every run recipes step and
+// the workflow.finished event once the workflow ends
+func WithEventSinks(sinks ...autopkg.EventSink) WorkflowOption {
+	return func(w *Workflow) {
+		w.eventSinks = append(w.eventSinks, sinks...)
+	}
+}
+
+// WithTracer records a span for the workflow and each of its steps, with the
+// batches of run recipes steps traced under their step
+func WithTracer(tracer *autopkg.Tracer) WorkflowOption {
+	return func(w *Workflow) {
+		w.tracer = tracer
+	}
+}
+
+// NewWorkflow creates an empty workflow
+func NewWorkflow(name string, opts ...WorkflowOption) *Workflow {
+	w := &Workflow{
+		Name:  name,
+		Steps: []WorkflowStep{},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// AddStep appends a step to the workflow
+func (w *Workflow) AddStep(step WorkflowStep) *Workflow {
+	w.Steps = append(w.Steps, step)
+	return w
+}
+
+// RunRecipesStepOptions contains options for a run recipes step
+type RunRecipesStepOptions struct {
+	RecipeInput  string
+	BatchOptions *autopkg.RecipeBatchRunOptions
+}
+
+// AddRunRecipesStep appends a step that runs a batch of recipes
+func (w *Workflow) AddRunRecipesStep(name string, recipeInput string, options *autopkg.RecipeBatchRunOptions) *Workflow {
+	return w.AddStep(WorkflowStep{
+		Name: name,
+		Type: StepTypeRunRecipes,
+		Options: &RunRecipesStepOptions{
+			RecipeInput:  recipeInput,
+			BatchOptions: options,
+		},
+	})
+}
+
+// AddTwoPhaseRunSteps appends the steps of a two-phase run: "<name>-download"
+// runs the .download parents of the recipes side by side, then
+// "<name>-package" runs only the recipes whose download changed. The phase
+// graph is built from the recipes' parent chains, see autopkg.PlanPhases.
+// A failed download only holds back the recipes that build on it.
+func (w *Workflow) AddTwoPhaseRunSteps(name string, recipeInput string, options *autopkg.RecipeBatchRunOptions) *Workflow {
+	if options == nil {
+		options = &autopkg.RecipeBatchRunOptions{}
+	}
+	downloadOptions, packageOptions := *options, *options
+	downloadOptions.Phase = autopkg.PhaseDownload
+	packageOptions.Phase = autopkg.PhasePackage
+
+	w.AddStep(WorkflowStep{
+		Name:            name + "-download",
+		Type:            StepTypeRunRecipes,
+		ContinueOnError: true,
+		Options:         &RunRecipesStepOptions{RecipeInput: recipeInput, BatchOptions: &downloadOptions},
+	})
+	return w.AddRunRecipesStep(name+"-package", recipeInput, &packageOptions)
+}
+
+// Execute runs each step in order and returns the final context
+func (w *Workflow) Execute() (*WorkflowContext, error) {
+	ctx := &WorkflowContext{
+		RunID:         w.runID,
+		RecipeResults: make(map[string]*autopkg.RecipeBatchResult),
+		workflow:      w,
+	}
+	if ctx.RunID == "" {
+		ctx.RunID = autopkg.NewRunID(time.Now())
+	}
+	if w.notification != nil {
+		ctx.Notification = *w.notification
+	}
+
+	// Invalid steps fail the workflow before anything has run
+	if err := w.Validate(); err != nil {
+		return ctx, fmt.Errorf("invalid workflow %s: %w", w.Name, err)
+	}
+
+	if w.checkpointPath != "" {
+		checkpoint, err := w.newCheckpointer(ctx)
+		if err != nil {
+			return ctx, err
+		}
+		ctx.checkpoint = checkpoint
+	}
+
+	logger.Logger(fmt.Sprintf("🧭 Starting workflow %s (%d steps)", w.Name, len(w.Steps)), logger.LogInfo)
+	workflowStart := time.Now()
+	workflowSpan := w.tracer.StartSpan(nil, "workflow "+w.Name)
+	workflowSpan.SetAttribute("autopkg.run_id", ctx.RunID)
+
+	var firstError error
+	for _, step := range w.Steps {
+		result := StepResult{Name: step.Name, Type: step.Type}
+
+		if ctx.checkpoint != nil && ctx.checkpoint.completed(step.Name) {
+			logger.Logger(fmt.Sprintf("⏭️ Skipping step %s: completed in run %s", step.Name, ctx.RunID), logger.LogInfo)
+			result.Skipped = true
+			result.Resumed = true
+			ctx.StepResults = append(ctx.StepResults, result)
+			continue
+		}
+
+		if step.Condition != nil && !step.Condition(ctx) {
+			logger.Logger(fmt.Sprintf("⏭️ Skipping step %s: condition not met", step.Name), logger.LogInfo)
+			result.Skipped = true
+			ctx.StepResults = append(ctx.StepResults, result)
+			if ctx.checkpoint != nil {
+				ctx.checkpoint.recordStep(ctx, result)
+			}
+			if w.afterStep != nil {
+				w.afterStep(step, result)
+			}
+			continue
+		}
+
+		if w.beforeStep != nil {
+			w.beforeStep(step, result)
+		}
+
+		logger.Logger(fmt.Sprintf("▶️ Running step %s", step.Name), logger.LogInfo)
+		startTime := time.Now()
+		ctx.span = w.tracer.StartSpan(workflowSpan, "step "+step.Name)
+		ctx.span.SetAttribute("autopkg.step_type", string(step.Type))
+
+		if executor, err := stepExecutor(step.Type); err != nil {
+			result.Error = err
+		} else {
+			result.Error = executor.Execute(ctx, step)
+		}
+
+		ctx.span.End(result.Error)
+		ctx.span = nil
+		result.Duration = time.Since(startTime)
+		ctx.StepResults = append(ctx.StepResults, result)
+		if ctx.checkpoint != nil {
+			ctx.checkpoint.recordStep(ctx, result)
+		}
+
+		if result.Error == nil && step.OnSuccess != nil {
+			step.OnSuccess(ctx, result)
+		}
+		if result.Error != nil && step.OnFailure != nil {
+			step.OnFailure(ctx, result)
+		}
+		if w.afterStep != nil {
+			w.afterStep(step, result)
+		}
+
+		if result.Error == nil {
+			logger.Logger(fmt.Sprintf("✅ Step %s completed in %s", step.Name, result.Duration.Round(time.Millisecond)), logger.LogSuccess)
+			continue
+		}
+
+		logger.Logger(fmt.Sprintf("❌ Step %s failed: %v", step.Name, result.Error), logger.LogError)
+		if firstError == nil {
+			firstError = fmt.Errorf("step %s failed: %w", step.Name, result.Error)
+		}
+		if !step.ContinueOnError {
+			break
+		}
+	}
+
+	if ctx.checkpoint != nil && firstError == nil {
+		ctx.checkpoint.remove()
+	}
+
+	workflowSpan.End(firstError)
+	w.publishFinished(ctx, firstError, time.Since(workflowStart))
+	return ctx, firstError
+}
+
+// publishFinished publishes workflow.finished to the workflow's event sinks
+func (w *Workflow) publishFinished(ctx *WorkflowContext, err error, duration time.Duration) {
+	if len(w.eventSinks) == 0 {
+		return
+	}
+
+	event := autopkg.Event{
+		Type:     autopkg.EventWorkflowFinished,
+		RunID:    ctx.RunID,
+		Status:   "success",
+		Workflow: &autopkg.WorkflowEvent{Name: w.Name, Steps: len(ctx.StepResults), Duration: duration.Seconds()},
+		Results:  ctx.RecipeResults,
+	}
+	if err != nil {
+		event.Status = "failure"
+		event.Error = err.Error()
+	}
+	for _, result := range ctx.StepResults {
+		if result.Error != nil {
+			event.Workflow.Failed++
+		}
+		if result.Skipped {
+			event.Workflow.Skipped++
+		}
+	}
+	autopkg.NewEventBus(w.eventSinks...).Publish(event)
+}
+
+// containsString reports whether a slice holds a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// executeRunRecipesStep runs a recipe batch and merges its results into the context
+func (w *Workflow) executeRunRecipesStep(ctx *WorkflowContext, step WorkflowStep) error {
+	options, ok := step.Options.(*RunRecipesStepOptions)
+	if !ok || options == nil {
+		return fmt.Errorf("invalid options for run recipes step")
+	}
+
+	batchOptions := options.BatchOptions
+	if batchOptions == nil {
+		batchOptions = &autopkg.RecipeBatchRunOptions{}
+	}
+	batchOptions.RunID = ctx.RunID
+
+	// The workflow's policy can't be loosened by a step. The step's options
+	// are copied so executing the workflow again doesn't add the rules twice.
+	if w.policy != nil {
+		policy := &autopkg.RecipePolicy{Deny: append([]autopkg.RecipePolicyRule{}, w.policy.Deny...)}
+		if batchOptions.Policy != nil {
+			policy.Deny = append(policy.Deny, batchOptions.Policy.Deny...)
+		}
+		stepOptions := *batchOptions
+		stepOptions.Policy = policy
+		batchOptions = &stepOptions
+	}
+
+	if w.notification == nil {
+		ctx.Notification = batchOptions.Notification
+	}
+
+	if w.tracer != nil {
+		stepOptions := *batchOptions
+		stepOptions.Tracer = w.tracer
+		stepOptions.TraceParent = ctx.span
+		batchOptions = &stepOptions
+	}
+
+	if len(w.eventSinks) > 0 {
+		stepOptions := *batchOptions
+		stepOptions.EventSinks = append(append([]autopkg.EventSink{}, batchOptions.EventSinks...), w.eventSinks...)
+		batchOptions = &stepOptions
+	}
+
+	// The package phase of a two-phase run reads the downloads earlier steps ran
+	if batchOptions.Phase == autopkg.PhasePackage && batchOptions.Downloads == nil {
+		stepOptions := *batchOptions
+		stepOptions.Downloads = make(map[string]*autopkg.RecipeBatchResult, len(ctx.RecipeResults))
+		for recipe, result := range ctx.RecipeResults {
+			stepOptions.Downloads[recipe] = result
+		}
+		batchOptions = &stepOptions
+	}
+
+	// Resumed runs leave out recipes that already succeeded, and every run
+	// checkpoints recipes as they finish
+	recipeInput := options.RecipeInput
+	if ctx.checkpoint != nil {
+		pending, done, err := ctx.checkpoint.pendingRecipes(step.Name, recipeInput)
+		if err != nil {
+			return err
+		}
+		if done > 0 {
+			logger.Logger(fmt.Sprintf("⏯️ Skipping %d recipes processed in run %s", done, ctx.RunID), logger.LogInfo)
+		}
+		if pending == "" {
+			return nil
+		}
+		recipeInput = pending
+
+		stepOptions := *batchOptions
+		stepOptions.Progress = &checkpointProgress{step: step.Name, checkpointer: ctx.checkpoint, next: batchOptions.Progress}
+		batchOptions = &stepOptions
+	}
+
+	results, err := autopkg.RunRecipeBatch(recipeInput, batchOptions)
+	for recipe, result := range results {
+		ctx.RecipeResults[recipe] = result
+	}
+	if batchOptions.ReportPlist != "" && !containsString(ctx.ReportPaths, batchOptions.ReportPlist) {
+		ctx.ReportPaths = append(ctx.ReportPaths, batchOptions.ReportPlist)
+	}
+
+	return err
+}
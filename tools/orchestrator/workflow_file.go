@@ -0,0 +1,503 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/artifacts"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	securityscan "github.com/deploymenttheory/macos-autopkg-factory/tools/security_scan"
+	"gopkg.in/yaml.v2"
+)
+
+// WorkflowFile is a workflow declared in YAML, so pipelines can be version
+// controlled without writing Go. String values may reference environment
+// variables as ${NAME}, which keeps credentials out of the file.
+type WorkflowFile struct {
+	Name          string             `yaml:"name"`
+	RunID         string             `yaml:"run_id,omitempty"`
+	Notifications *NotificationsFile `yaml:"notifications,omitempty"` // Overrides the notifications of run recipes steps
+	RecipePolicy  string             `yaml:"recipe_policy,omitempty"` // Recipe policy enforced by every run recipes step
+	Steps         []WorkflowStepFile `yaml:"steps"`
+}
+
+// WorkflowStepFile is a step of a YAML workflow
+type WorkflowStepFile struct {
+	Name            string                 `yaml:"name"`
+	Type            StepType               `yaml:"type"`
+	Condition       string                 `yaml:"condition,omitempty"` // See ParseCondition
+	ContinueOnError bool                   `yaml:"continue_on_error,omitempty"`
+	Options         map[string]interface{} `yaml:"options,omitempty"` // Step type specific, passed as is to custom step types
+}
+
+// NotificationsFile holds the Slack and Teams settings of a YAML workflow
+type NotificationsFile struct {
+	SlackWebhook  string `yaml:"slack_webhook,omitempty"`
+	SlackChannel  string `yaml:"slack_channel,omitempty"`
+	SlackUsername string `yaml:"slack_username,omitempty"`
+	SlackIcon     string `yaml:"slack_icon,omitempty"`
+	TeamsWebhook  string `yaml:"teams_webhook,omitempty"`
+	ChangesOnly   bool   `yaml:"changes_only,omitempty"`
+}
+
+// LogArchiveFile holds the recipe log archive settings of a run-recipes step
+type LogArchiveFile struct {
+	Dir        string `yaml:"dir,omitempty"`
+	Retention  string `yaml:"retention,omitempty"` // Go duration, e.g. 720h
+	KeepRuns   int    `yaml:"keep_runs,omitempty"`
+	NoCompress bool   `yaml:"no_compress,omitempty"`
+	Disabled   bool   `yaml:"disabled,omitempty"`
+}
+
+// RunRecipesFileOptions are the options of a run-recipes step in YAML
+type RunRecipesFileOptions struct {
+	Recipes              []string           `yaml:"recipes,omitempty"`
+	RecipeList           string             `yaml:"recipe_list,omitempty"` // Used when recipes is empty
+	Prefs                string             `yaml:"prefs,omitempty"`
+	SearchDirs           []string           `yaml:"search_dirs,omitempty"`
+	OverrideDirs         []string           `yaml:"override_dirs,omitempty"`
+	VerifyTrust          bool               `yaml:"verify_trust,omitempty"`
+	UpdateTrustOnFailure bool               `yaml:"update_trust_on_failure,omitempty"`
+	IgnoreVerifyFailures bool               `yaml:"ignore_verify_failures,omitempty"`
+	Report               string             `yaml:"report,omitempty"`
+	Verbose              int                `yaml:"verbose,omitempty"`
+	Variables            map[string]string  `yaml:"variables,omitempty"`
+	PreProcessors        []string           `yaml:"pre_processors,omitempty"`
+	PostProcessors       []string           `yaml:"post_processors,omitempty"`
+	StopOnFirstError     bool               `yaml:"stop_on_first_error,omitempty"`
+	StateDir             string             `yaml:"state_dir,omitempty"`
+	Catalog              string             `yaml:"catalog,omitempty"`
+	Targets              string             `yaml:"targets,omitempty"`
+	RecipeOverrides      string             `yaml:"recipe_overrides,omitempty"`
+	RecipePolicy         string             `yaml:"recipe_policy,omitempty"`
+	Webhooks             string             `yaml:"webhooks,omitempty"`
+	Retries              int                `yaml:"retries,omitempty"`
+	RetryBackoff         string             `yaml:"retry_backoff,omitempty"` // Go duration, e.g. 30s
+	Phase                string             `yaml:"phase,omitempty"`         // download or package, for the steps of a two-phase run
+	DownloadConcurrency  int                `yaml:"download_concurrency,omitempty"`
+	Notifications        *NotificationsFile `yaml:"notifications,omitempty"`
+	Logs                 *LogArchiveFile    `yaml:"logs,omitempty"` // Archives recipe logs to the state directory when unset
+}
+
+// ArtifactUploadFileOptions are the options of an artifact-upload step in YAML
+type ArtifactUploadFileOptions struct {
+	Storage struct {
+		Backend       string `yaml:"backend"`
+		Bucket        string `yaml:"bucket"`
+		Region        string `yaml:"region,omitempty"`
+		Endpoint      string `yaml:"endpoint,omitempty"`
+		Account       string `yaml:"account,omitempty"`
+		KeyTemplate   string `yaml:"key_template,omitempty"`
+		Public        bool   `yaml:"public,omitempty"`
+		PresignExpiry string `yaml:"presign_expiry,omitempty"` // Go duration, e.g. 24h
+	} `yaml:"storage"`
+	OnlyUpdated    bool   `yaml:"only_updated,omitempty"`
+	IncludeReports bool   `yaml:"include_reports,omitempty"`
+	Notify         bool   `yaml:"notify,omitempty"`
+	Idempotent     bool   `yaml:"idempotent,omitempty"`
+	HistoryPath    string `yaml:"history_path,omitempty"`
+}
+
+// GatekeeperFileOptions are the options of a gatekeeper step in YAML
+type GatekeeperFileOptions struct {
+	OnlyUpdated bool `yaml:"only_updated,omitempty"`
+}
+
+// SecurityGateFileOptions are the options of a security-gate step in YAML
+type SecurityGateFileOptions struct {
+	Threshold   string   `yaml:"threshold,omitempty"` // none, info, low, medium, high or critical
+	Quarantine  bool     `yaml:"quarantine,omitempty"`
+	OnlyUpdated bool     `yaml:"only_updated,omitempty"`
+	Checks      []string `yaml:"checks,omitempty"`                 // suspicious_package, codesign, virustotal, malwarebazaar or scripts
+	AuthKey     string   `yaml:"malwarebazaar_auth_key,omitempty"` // abuse.ch Auth-Key for the malwarebazaar check
+	HashList    string   `yaml:"hash_list,omitempty"`
+	PublicKey   string   `yaml:"hash_list_public_key,omitempty"` // The hash list must be signed with its private key
+	Allow       []struct {
+		Recipes []string `yaml:"recipes"`
+		Checks  []string `yaml:"checks,omitempty"`
+		Pattern string   `yaml:"pattern,omitempty"` // Regular expression matched against finding messages
+		Reason  string   `yaml:"reason"`
+	} `yaml:"allow,omitempty"`
+}
+
+// MunkiRepoFileOptions are the options of a munki-repo step in YAML
+type MunkiRepoFileOptions struct {
+	Repo            string   `yaml:"repo"`
+	MakeCatalogs    string   `yaml:"makecatalogs,omitempty"`
+	Catalogs        []string `yaml:"catalogs,omitempty"`
+	Manifests       []string `yaml:"manifests,omitempty"`
+	ManifestSection string   `yaml:"manifest_section,omitempty"`
+}
+
+// workflowEnvReference matches ${NAME} environment variable references
+var workflowEnvReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadWorkflow reads a workflow from a YAML file and builds it, validating
+// every step before anything runs
+func LoadWorkflow(path string, opts ...WorkflowOption) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow file: %w", err)
+	}
+
+	data = workflowEnvReference.ReplaceAllFunc(data, func(reference []byte) []byte {
+		return []byte(os.Getenv(string(workflowEnvReference.FindSubmatch(reference)[1])))
+	})
+
+	var file WorkflowFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow file: %w", err)
+	}
+
+	workflow, err := file.Build(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workflow file %s: %w", path, err)
+	}
+	return workflow, nil
+}
+
+// Build creates the workflow the file declares. Options given here are
+// applied after those from the file.
+func (f *WorkflowFile) Build(opts ...WorkflowOption) (*Workflow, error) {
+	if f.Name == "" {
+		return nil, fmt.Errorf("workflow has no name")
+	}
+	if len(f.Steps) == 0 {
+		return nil, fmt.Errorf("workflow has no steps")
+	}
+
+	var fileOpts []WorkflowOption
+	if f.RunID != "" {
+		fileOpts = append(fileOpts, WithRunID(f.RunID))
+	}
+	if f.Notifications != nil {
+		fileOpts = append(fileOpts, WithNotifications(f.Notifications.options()))
+	}
+	if f.RecipePolicy != "" {
+		policy, err := autopkg.LoadRecipePolicy(f.RecipePolicy)
+		if err != nil {
+			return nil, err
+		}
+		fileOpts = append(fileOpts, WithRecipePolicy(policy))
+	}
+
+	workflow := NewWorkflow(f.Name, append(fileOpts, opts...)...)
+	seen := make(map[string]bool)
+	for i, stepFile := range f.Steps {
+		if stepFile.Name == "" {
+			return nil, fmt.Errorf("step %d has no name", i+1)
+		}
+		if seen[stepFile.Name] {
+			return nil, fmt.Errorf("step %s is defined more than once", stepFile.Name)
+		}
+		seen[stepFile.Name] = true
+
+		step, err := stepFile.build()
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", stepFile.Name, err)
+		}
+		workflow.AddStep(step)
+	}
+
+	if err := workflow.Validate(); err != nil {
+		return nil, err
+	}
+	return workflow, nil
+}
+
+// build creates the workflow step, decoding the options of built-in step types
+func (s WorkflowStepFile) build() (WorkflowStep, error) {
+	step := WorkflowStep{
+		Name:            s.Name,
+		Type:            s.Type,
+		ContinueOnError: s.ContinueOnError,
+		Options:         s.Options,
+	}
+
+	if s.Condition != "" {
+		condition, err := ParseCondition(s.Condition)
+		if err != nil {
+			return step, err
+		}
+		step.Condition = condition
+		step.ConditionLabel = s.Condition
+	}
+
+	switch s.Type {
+	case StepTypeRunRecipes:
+		var options RunRecipesFileOptions
+		if err := decodeStepOptions(s.Options, &options); err != nil {
+			return step, err
+		}
+		runOptions, err := options.build()
+		if err != nil {
+			return step, err
+		}
+		step.Options = runOptions
+	case StepTypeArtifactUpload:
+		var options ArtifactUploadFileOptions
+		if err := decodeStepOptions(s.Options, &options); err != nil {
+			return step, err
+		}
+		uploadOptions, err := options.build()
+		if err != nil {
+			return step, err
+		}
+		step.Options = uploadOptions
+	case StepTypeGatekeeper:
+		var options GatekeeperFileOptions
+		if err := decodeStepOptions(s.Options, &options); err != nil {
+			return step, err
+		}
+		step.Options = &GatekeeperStepOptions{OnlyUpdated: options.OnlyUpdated}
+	case StepTypeSecurityGate:
+		var options SecurityGateFileOptions
+		if err := decodeStepOptions(s.Options, &options); err != nil {
+			return step, err
+		}
+		policy, err := options.build()
+		if err != nil {
+			return step, err
+		}
+		step.Options = policy
+	case StepTypeMunkiRepo:
+		var options MunkiRepoFileOptions
+		if err := decodeStepOptions(s.Options, &options); err != nil {
+			return step, err
+		}
+		if options.Repo == "" {
+			return step, fmt.Errorf("munki-repo needs a repo")
+		}
+		step.Options = &MunkiRepoStepOptions{
+			Repo:            options.Repo,
+			MakeCatalogs:    options.MakeCatalogs,
+			Catalogs:        options.Catalogs,
+			Manifests:       options.Manifests,
+			ManifestSection: options.ManifestSection,
+		}
+	}
+	return step, nil
+}
+
+// decodeStepOptions decodes a step's options into the options type of its step type
+func decodeStepOptions(raw map[string]interface{}, options interface{}) error {
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("failed to read options: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, options); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	return nil
+}
+
+// options returns the notification options the file sets
+func (n *NotificationsFile) options() autopkg.NotificationOptions {
+	return autopkg.NotificationOptions{
+		EnableTeams:   n.TeamsWebhook != "",
+		TeamsWebhook:  n.TeamsWebhook,
+		EnableSlack:   n.SlackWebhook != "",
+		SlackWebhook:  n.SlackWebhook,
+		SlackUsername: n.SlackUsername,
+		SlackChannel:  n.SlackChannel,
+		SlackIcon:     n.SlackIcon,
+		ChangesOnly:   n.ChangesOnly,
+	}
+}
+
+// options returns the log archive options the file sets, nil when disabled
+func (l *LogArchiveFile) options() (*autopkg.LogArchiveOptions, error) {
+	if l == nil {
+		return &autopkg.LogArchiveOptions{Compress: true, Retention: autopkg.DefaultLogRetention}, nil
+	}
+	if l.Disabled {
+		return nil, nil
+	}
+	if l.KeepRuns < 0 {
+		return nil, fmt.Errorf("logs keep_runs can't be negative")
+	}
+	retention := autopkg.DefaultLogRetention
+	if l.Retention != "" {
+		var err error
+		if retention, err = parseFileDuration("logs retention", l.Retention); err != nil {
+			return nil, err
+		}
+	}
+	return &autopkg.LogArchiveOptions{Dir: l.Dir, Compress: !l.NoCompress, Retention: retention, KeepRuns: l.KeepRuns}, nil
+}
+
+// build creates the run recipes step options, loading the files they point to
+func (o RunRecipesFileOptions) build() (*RunRecipesStepOptions, error) {
+	recipeInput := strings.Join(o.Recipes, ",")
+	if recipeInput == "" {
+		recipeInput = o.RecipeList
+	}
+	if recipeInput == "" {
+		return nil, fmt.Errorf("run-recipes needs recipes or a recipe_list")
+	}
+
+	batchOptions := &autopkg.RecipeBatchRunOptions{
+		PrefsPath:            o.Prefs,
+		SearchDirs:           o.SearchDirs,
+		OverrideDirs:         o.OverrideDirs,
+		VerifyTrust:          o.VerifyTrust,
+		UpdateTrustOnFailure: o.UpdateTrustOnFailure,
+		IgnoreVerifyFailures: o.IgnoreVerifyFailures,
+		ReportPlist:          o.Report,
+		VerboseLevel:         o.Verbose,
+		Variables:            o.Variables,
+		PreProcessors:        o.PreProcessors,
+		PostProcessors:       o.PostProcessors,
+		StopOnFirstError:     o.StopOnFirstError,
+		StateDir:             o.StateDir,
+		Phase:                o.Phase,
+		DownloadConcurrency:  o.DownloadConcurrency,
+	}
+	if o.Notifications != nil {
+		batchOptions.Notification = o.Notifications.options()
+	}
+
+	switch o.Phase {
+	case "", autopkg.PhaseDownload, autopkg.PhasePackage:
+	default:
+		return nil, fmt.Errorf("unknown phase %q, expected %s or %s", o.Phase, autopkg.PhaseDownload, autopkg.PhasePackage)
+	}
+	if o.DownloadConcurrency < 0 {
+		return nil, fmt.Errorf("download_concurrency can't be negative")
+	}
+
+	if o.Retries < 0 {
+		return nil, fmt.Errorf("retries can't be negative")
+	}
+	if o.Retries > 0 {
+		backoff, err := parseFileDuration("retry_backoff", o.RetryBackoff)
+		if err != nil {
+			return nil, err
+		}
+		batchOptions.RetryPolicy = &autopkg.RetryPolicy{MaxRetries: o.Retries, Backoff: backoff}
+	}
+
+	var err error
+	if batchOptions.LogArchive, err = o.Logs.options(); err != nil {
+		return nil, err
+	}
+	if o.Catalog != "" {
+		if batchOptions.Catalog, err = autopkg.LoadCatalog(o.Catalog); err != nil {
+			return nil, err
+		}
+	}
+	if o.Targets != "" {
+		if batchOptions.Targets, err = autopkg.LoadTargetSet(o.Targets); err != nil {
+			return nil, err
+		}
+	}
+	if o.RecipeOverrides != "" {
+		if batchOptions.PerRecipe, err = autopkg.LoadRecipeOverrides(o.RecipeOverrides); err != nil {
+			return nil, err
+		}
+	}
+	if o.RecipePolicy != "" {
+		if batchOptions.Policy, err = autopkg.LoadRecipePolicy(o.RecipePolicy); err != nil {
+			return nil, err
+		}
+	}
+	if o.Webhooks != "" {
+		if batchOptions.Webhooks, err = autopkg.LoadWebhookSubscriptions(o.Webhooks); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RunRecipesStepOptions{RecipeInput: recipeInput, BatchOptions: batchOptions}, nil
+}
+
+// build creates the artifact upload step options
+func (o ArtifactUploadFileOptions) build() (*ArtifactUploadStepOptions, error) {
+	if o.Storage.Backend == "" || o.Storage.Bucket == "" {
+		return nil, fmt.Errorf("artifact-upload needs a storage backend and bucket")
+	}
+	expiry, err := parseFileDuration("presign_expiry", o.Storage.PresignExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArtifactUploadStepOptions{
+		Storage: &artifacts.Config{
+			Backend:       o.Storage.Backend,
+			Bucket:        o.Storage.Bucket,
+			Region:        o.Storage.Region,
+			Endpoint:      o.Storage.Endpoint,
+			Account:       o.Storage.Account,
+			KeyTemplate:   o.Storage.KeyTemplate,
+			Public:        o.Storage.Public,
+			PresignExpiry: expiry,
+		},
+		OnlyUpdated:    o.OnlyUpdated,
+		IncludeReports: o.IncludeReports,
+		Notify:         o.Notify,
+		Idempotent:     o.Idempotent,
+		HistoryPath:    o.HistoryPath,
+	}, nil
+}
+
+// build converts the YAML options of a security-gate step into its policy
+func (o SecurityGateFileOptions) build() (*SecurityGatePolicy, error) {
+	if o.Threshold != "" && !securityscan.ValidSeverity(o.Threshold) {
+		return nil, fmt.Errorf("invalid threshold %q: use none, info, low, medium, high or critical", o.Threshold)
+	}
+	policy := &SecurityGatePolicy{Threshold: o.Threshold, Quarantine: o.Quarantine, OnlyUpdated: o.OnlyUpdated}
+	for _, check := range o.Checks {
+		switch check {
+		case securityscan.CheckSuspiciousPackage:
+			policy.Checks.SuspiciousPackage = true
+		case securityscan.CheckCodesign:
+			policy.Checks.Codesign = true
+		case securityscan.CheckVirusTotal:
+			policy.Checks.VirusTotal = true
+		case securityscan.CheckScripts:
+			policy.Checks.Scripts = true
+		case securityscan.CheckMalwareBazaar:
+			policy.Checks.Reputation = append(policy.Checks.Reputation, &securityscan.MalwareBazaar{AuthKey: o.AuthKey})
+		default:
+			return nil, fmt.Errorf("unknown check %q: use suspicious_package, codesign, virustotal, malwarebazaar or scripts", check)
+		}
+	}
+
+	for _, allow := range o.Allow {
+		if len(allow.Recipes) == 0 {
+			return nil, fmt.Errorf("security gate allowances need recipes")
+		}
+		allowance := SecurityAllowance{Recipes: allow.Recipes, Checks: allow.Checks, Reason: allow.Reason}
+		if allow.Pattern != "" {
+			pattern, err := regexp.Compile(allow.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowance pattern %q: %w", allow.Pattern, err)
+			}
+			allowance.Pattern = pattern
+		}
+		policy.Allow = append(policy.Allow, allowance)
+	}
+
+	if o.HashList != "" {
+		hashList, err := autopkg.LoadHashList(o.HashList, o.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		policy.HashList = hashList
+	}
+	return policy, nil
+}
+
+// parseFileDuration parses an optional duration option, zero when unset
+func parseFileDuration(name string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return duration, nil
+}
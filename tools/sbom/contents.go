@@ -0,0 +1,173 @@
+// contents.go
+package sbom
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"howett.net/plist"
+)
+
+// launchItemDirs are the payload directories whose property lists launchd
+// loads: system-wide daemons and agents, and the helpers apps register with
+// SMAppService from inside their bundle
+var launchItemDirs = []string{
+	"Library/LaunchDaemons/",
+	"Library/LaunchAgents/",
+	"Contents/Library/LaunchDaemons/",
+	"Contents/Library/LaunchAgents/",
+	"Contents/Library/LoginItems/",
+}
+
+// signedBundleTypes are the bundle extensions whose code signature can carry entitlements
+var signedBundleTypes = map[string]bool{
+	".app":             true,
+	".appex":           true,
+	".xpc":             true,
+	".systemextension": true,
+	".plugin":          true,
+	".bundle":          true,
+}
+
+// Contents is what a security review compares between two versions of an
+// artifact: its components, every file it installs, the entitlements its
+// bundles are signed with, what it loads with launchd and its install scripts
+type Contents struct {
+	Inventory
+	Files        []string            `json:"files"`                  // Install paths of the payload's files
+	LaunchItems  []string            `json:"launch_items,omitempty"` // Install paths of launchd property lists and login items
+	Entitlements map[string][]string `json:"entitlements,omitempty"` // Entitlements by bundle install path, when codesign is available
+	Scripts      map[string]string   `json:"scripts,omitempty"`      // SHA256 of the package's install scripts by name
+}
+
+// InspectContents lists the components, files, launch items, entitlements and
+// install scripts of a .pkg, .dmg, .app or plain directory. Entitlements are
+// read with codesign, so they're only listed on macOS.
+func InspectContents(artifactPath string) (*Contents, error) {
+	info, err := os.Stat(artifactPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", artifactPath, err)
+	}
+
+	contents := &Contents{
+		Inventory: Inventory{
+			ArtifactPath: artifactPath,
+			Name:         strings.TrimSuffix(filepath.Base(artifactPath), filepath.Ext(artifactPath)),
+			InspectedAt:  time.Now().UTC(),
+		},
+		Entitlements: make(map[string][]string),
+		Scripts:      make(map[string]string),
+	}
+	if !info.IsDir() {
+		if contents.SHA256, err = fileSHA256(artifactPath); err != nil {
+			return nil, err
+		}
+	}
+
+	err = WalkArtifact(artifactPath, func(root string) error {
+		components, err := scanPayload(root)
+		if err != nil {
+			return err
+		}
+		contents.Components = append(contents.Components, components...)
+		return scanFiles(root, contents)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(contents.Files)
+	sort.Strings(contents.LaunchItems)
+	logger.Logger(fmt.Sprintf("🧬 Found %d files and %d components in %s", len(contents.Files), len(contents.Components), filepath.Base(artifactPath)), logger.LogInfo)
+	return contents, nil
+}
+
+// scanFiles records the files, launch items and install scripts under a payload root
+func scanFiles(root string, contents *Contents) error {
+	// An expanded package installs only its payloads; the rest is metadata
+	payloads, _ := filepath.Glob(filepath.Join(root, "*.pkg", "Payload"))
+	_, err := os.Stat(filepath.Join(root, "Payload"))
+	expandedPackage := err == nil || len(payloads) > 0
+
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if signedBundleTypes[strings.ToLower(filepath.Ext(path))] {
+				if entitlements := BundleEntitlements(path); len(entitlements) > 0 {
+					contents.Entitlements[PayloadPath(root, path)] = entitlements
+				}
+			}
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if expandedPackage {
+			// Payloads and scripts are at the top, or in the component packages of a product archive
+			if len(parts) > 1 && strings.HasSuffix(parts[0], ".pkg") {
+				parts = parts[1:]
+			}
+			switch {
+			case len(parts) > 1 && parts[0] == "Scripts":
+				checksum, _ := fileSHA256(path)
+				contents.Scripts[strings.Join(parts[1:], "/")] = checksum
+				return nil
+			case parts[0] != "Payload":
+				return nil
+			}
+		}
+
+		installPath := PayloadPath(root, path)
+		contents.Files = append(contents.Files, installPath)
+		for _, dir := range launchItemDirs {
+			if strings.Contains(installPath, "/"+dir) {
+				contents.LaunchItems = append(contents.LaunchItems, installPath)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list payload files: %w", err)
+	}
+	return nil
+}
+
+// BundleEntitlements returns the entitlement keys a bundle is signed with,
+// with "=false" appended to those explicitly denied, or nil when it isn't
+// signed or codesign isn't available
+func BundleEntitlements(bundlePath string) []string {
+	if runtime.GOOS != "darwin" {
+		return nil
+	}
+
+	output, err := exec.Command("codesign", "-d", "--entitlements", "-", "--xml", bundlePath).Output()
+	if err != nil || len(output) == 0 {
+		return nil
+	}
+
+	var entitlements map[string]interface{}
+	if _, err := plist.Unmarshal(output, &entitlements); err != nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(entitlements))
+	for key, value := range entitlements {
+		if enabled, ok := value.(bool); ok && !enabled {
+			key += "=false"
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
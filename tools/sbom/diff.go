@@ -0,0 +1,214 @@
+// diff.go
+package sbom
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Component change kinds
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeUpdated = "updated" // Its version changed
+	ChangeRebuilt = "rebuilt" // Same version, different binary
+)
+
+// Delta is what changed between two versions of an artifact
+type Delta struct {
+	Previous           string              `json:"previous"`
+	Current            string              `json:"current"`
+	Components         []ComponentChange   `json:"components,omitempty"`
+	AddedFiles         []string            `json:"added_files,omitempty"`
+	RemovedFiles       []string            `json:"removed_files,omitempty"`
+	PreviousFileCount  int                 `json:"previous_file_count"`
+	CurrentFileCount   int                 `json:"current_file_count"`
+	AddedLaunchItems   []string            `json:"added_launch_items,omitempty"`
+	RemovedLaunchItems []string            `json:"removed_launch_items,omitempty"`
+	Entitlements       []EntitlementChange `json:"entitlements,omitempty"`
+	AddedScripts       []string            `json:"added_scripts,omitempty"`
+	RemovedScripts     []string            `json:"removed_scripts,omitempty"`
+	ChangedScripts     []string            `json:"changed_scripts,omitempty"`
+}
+
+// ComponentChange is a component added, removed, updated or rebuilt
+type ComponentChange struct {
+	Change          string `json:"change"`
+	Type            string `json:"type"`
+	Name            string `json:"name"`
+	Path            string `json:"path"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	Version         string `json:"version,omitempty"`
+}
+
+// EntitlementChange is the entitlements a bundle gained or lost
+type EntitlementChange struct {
+	Bundle  string   `json:"bundle"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Diff compares the contents of the previous and current version of an
+// artifact. Components are matched by bundle ID, then by install path, so a
+// bundle that moved to a versioned directory is still updated rather than
+// removed and added.
+func Diff(previous, current *Contents) *Delta {
+	delta := &Delta{
+		Previous:          previous.ArtifactPath,
+		Current:           current.ArtifactPath,
+		PreviousFileCount: len(previous.Files),
+		CurrentFileCount:  len(current.Files),
+	}
+
+	delta.Components = diffComponents(previous.Components, current.Components)
+	delta.AddedFiles, delta.RemovedFiles = diffStrings(previous.Files, current.Files)
+	delta.AddedLaunchItems, delta.RemovedLaunchItems = diffStrings(previous.LaunchItems, current.LaunchItems)
+
+	var bundles []string
+	for bundle := range current.Entitlements {
+		bundles = append(bundles, bundle)
+	}
+	for bundle := range previous.Entitlements {
+		if _, exists := current.Entitlements[bundle]; !exists {
+			bundles = append(bundles, bundle)
+		}
+	}
+	sort.Strings(bundles)
+	for _, bundle := range bundles {
+		added, removed := diffStrings(previous.Entitlements[bundle], current.Entitlements[bundle])
+		if len(added) > 0 || len(removed) > 0 {
+			delta.Entitlements = append(delta.Entitlements, EntitlementChange{Bundle: bundle, Added: added, Removed: removed})
+		}
+	}
+
+	for _, script := range sortedKeys(current.Scripts) {
+		checksum, existed := previous.Scripts[script]
+		switch {
+		case !existed:
+			delta.AddedScripts = append(delta.AddedScripts, script)
+		case checksum != current.Scripts[script]:
+			delta.ChangedScripts = append(delta.ChangedScripts, script)
+		}
+	}
+	for _, script := range sortedKeys(previous.Scripts) {
+		if _, exists := current.Scripts[script]; !exists {
+			delta.RemovedScripts = append(delta.RemovedScripts, script)
+		}
+	}
+
+	return delta
+}
+
+// Empty reports whether nothing but the artifact itself changed
+func (d *Delta) Empty() bool {
+	return len(d.Components) == 0 && len(d.AddedFiles) == 0 && len(d.RemovedFiles) == 0 &&
+		len(d.AddedLaunchItems) == 0 && len(d.RemovedLaunchItems) == 0 && len(d.Entitlements) == 0 &&
+		len(d.AddedScripts) == 0 && len(d.RemovedScripts) == 0 && len(d.ChangedScripts) == 0
+}
+
+// Highlights lists the changes a security review should look at first: new
+// launch items, entitlements and install scripts, and added or removed components
+func (d *Delta) Highlights() []string {
+	var highlights []string
+	for _, item := range d.AddedLaunchItems {
+		highlights = append(highlights, fmt.Sprintf("new launch item %s", item))
+	}
+	for _, change := range d.Entitlements {
+		for _, entitlement := range change.Added {
+			highlights = append(highlights, fmt.Sprintf("%s gained entitlement %s", change.Bundle, entitlement))
+		}
+	}
+	for _, script := range d.AddedScripts {
+		highlights = append(highlights, fmt.Sprintf("new install script %s", script))
+	}
+	for _, script := range d.ChangedScripts {
+		highlights = append(highlights, fmt.Sprintf("changed install script %s", script))
+	}
+	for _, change := range d.Components {
+		if change.Change == ChangeAdded || change.Change == ChangeRemoved {
+			highlights = append(highlights, fmt.Sprintf("%s %s %s", change.Change, change.Type, change.Path))
+		}
+	}
+	return highlights
+}
+
+// diffComponents matches components by bundle ID, then install path, and
+// returns those that changed, ordered by path
+func diffComponents(previous, current []Component) []ComponentChange {
+	key := func(component Component) string {
+		if component.BundleID != "" {
+			return component.Type + "|" + component.BundleID
+		}
+		return component.Type + "|" + component.Path
+	}
+
+	previousByKey := make(map[string]Component, len(previous))
+	for _, component := range previous {
+		previousByKey[key(component)] = component
+	}
+
+	var changes []ComponentChange
+	seen := make(map[string]bool, len(current))
+	for _, component := range current {
+		k := key(component)
+		seen[k] = true
+		old, existed := previousByKey[k]
+		change := ComponentChange{Type: component.Type, Name: component.Name, Path: component.Path, Version: component.Version}
+		switch {
+		case !existed:
+			change.Change = ChangeAdded
+		case old.Version != component.Version:
+			change.Change = ChangeUpdated
+			change.PreviousVersion = old.Version
+		case old.SHA256 != component.SHA256:
+			change.Change = ChangeRebuilt
+			change.PreviousVersion = old.Version
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	for _, component := range previous {
+		if !seen[key(component)] {
+			changes = append(changes, ComponentChange{Change: ChangeRemoved, Type: component.Type, Name: component.Name, Path: component.Path, PreviousVersion: component.Version})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// diffStrings returns the values only in current and only in previous, sorted
+func diffStrings(previous, current []string) (added []string, removed []string) {
+	previousSet := make(map[string]bool, len(previous))
+	for _, value := range previous {
+		previousSet[value] = true
+	}
+	currentSet := make(map[string]bool, len(current))
+	for _, value := range current {
+		currentSet[value] = true
+		if !previousSet[value] {
+			added = append(added, value)
+		}
+	}
+	for _, value := range previous {
+		if !currentSet[value] {
+			removed = append(removed, value)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
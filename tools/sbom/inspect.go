@@ -0,0 +1,352 @@
+// inspect.go
+package sbom
+
+import (
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"howett.net/plist"
+)
+
+// bundleTypes maps bundle directory extensions to component types
+var bundleTypes = map[string]string{
+	".app":       ComponentApplication,
+	".framework": ComponentFramework,
+	".appex":     ComponentBundle,
+	".bundle":    ComponentBundle,
+	".plugin":    ComponentBundle,
+	".kext":      ComponentBundle,
+	".xpc":       ComponentBundle,
+}
+
+// InspectArtifact lists the software components in a .pkg, .dmg, .app or plain directory
+func InspectArtifact(artifactPath string) (*Inventory, error) {
+	info, err := os.Stat(artifactPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", artifactPath, err)
+	}
+
+	inventory := &Inventory{
+		ArtifactPath: artifactPath,
+		Name:         strings.TrimSuffix(filepath.Base(artifactPath), filepath.Ext(artifactPath)),
+		InspectedAt:  time.Now().UTC(),
+	}
+
+	// Directories such as .app bundles have no single checksum
+	if !info.IsDir() {
+		if inventory.SHA256, err = fileSHA256(artifactPath); err != nil {
+			return nil, err
+		}
+	}
+
+	components, err := inspectPath(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	inventory.Components = components
+
+	logger.Logger(fmt.Sprintf("🧬 Found %d components in %s", len(components), filepath.Base(artifactPath)), logger.LogInfo)
+	return inventory, nil
+}
+
+// inspectPath expands the artifact if needed and scans its payload
+func inspectPath(artifactPath string) ([]Component, error) {
+	var components []Component
+	err := WalkArtifact(artifactPath, func(root string) error {
+		rootComponents, err := scanPayload(root)
+		components = append(components, rootComponents...)
+		return err
+	})
+	return components, err
+}
+
+// WalkArtifact expands a flat package or mounts a disk image and calls scan
+// with the directory holding its payload, then with each package on a disk
+// image. Bundle-style packages, apps and plain directories are scanned in place.
+func WalkArtifact(artifactPath string, scan func(root string) error) error {
+	switch strings.ToLower(filepath.Ext(artifactPath)) {
+	case ".pkg", ".mpkg":
+		info, err := os.Stat(artifactPath)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", artifactPath, err)
+		}
+		// Bundle-style packages are directories and can be scanned in place
+		if info.IsDir() {
+			return scan(artifactPath)
+		}
+		return walkFlatPackage(artifactPath, scan)
+	case ".dmg":
+		return walkDiskImage(artifactPath, scan)
+	default:
+		return scan(artifactPath)
+	}
+}
+
+// walkFlatPackage expands a flat package, including its payloads, and scans it
+func walkFlatPackage(pkgPath string, scan func(root string) error) error {
+	tempDir, err := os.MkdirTemp("", "sbom_pkg_*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// pkgutil refuses to expand into an existing directory
+	expandDir := filepath.Join(tempDir, "expanded")
+	logger.Logger(fmt.Sprintf("🖥️  Running command: pkgutil --expand-full %s %s", pkgPath, expandDir), logger.LogDebug)
+	if output, err := exec.Command("pkgutil", "--expand-full", pkgPath, expandDir).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to expand package: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return scan(expandDir)
+}
+
+// walkDiskImage mounts a disk image read-only and scans it, including any packages on it
+func walkDiskImage(dmgPath string, scan func(root string) error) error {
+	mountPoint, err := os.MkdirTemp("", "sbom_dmg_*")
+	if err != nil {
+		return fmt.Errorf("failed to create mount point: %w", err)
+	}
+	defer os.RemoveAll(mountPoint)
+
+	logger.Logger(fmt.Sprintf("🖥️  Running command: hdiutil attach %s -mountpoint %s -nobrowse -readonly", dmgPath, mountPoint), logger.LogDebug)
+	if output, err := exec.Command("hdiutil", "attach", dmgPath, "-mountpoint", mountPoint, "-nobrowse", "-readonly", "-noautoopen", "-quiet").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to mount disk image: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	defer func() {
+		_ = exec.Command("hdiutil", "detach", mountPoint, "-quiet").Run()
+	}()
+
+	if err := scan(mountPoint); err != nil {
+		return err
+	}
+
+	packages, _ := filepath.Glob(filepath.Join(mountPoint, "*.pkg"))
+	for _, pkgPath := range packages {
+		if err := WalkArtifact(pkgPath, scan); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to inspect %s on disk image: %v", filepath.Base(pkgPath), err), logger.LogWarning)
+		}
+	}
+
+	return nil
+}
+
+// scanPayload walks a directory tree and records bundles and Mach-O executables
+func scanPayload(root string) ([]Component, error) {
+	var components []Component
+	bundleExecutables := make(map[string]bool)
+	var looseBinaries []string
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			componentType, isBundle := bundleTypes[strings.ToLower(filepath.Ext(path))]
+			if !isBundle {
+				return nil
+			}
+			component, executable := inspectBundle(path, componentType)
+			component.Path = PayloadPath(root, path)
+			components = append(components, component)
+			if executable != "" {
+				bundleExecutables[executable] = true
+			}
+			return nil
+		}
+
+		// Symlinks inside frameworks point at files that are visited anyway
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.Mode()&0111 != 0 && isMachO(path) {
+			looseBinaries = append(looseBinaries, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan payload: %w", err)
+	}
+
+	// Main bundle executables are described by their bundle, anything else is a CLI tool or helper
+	for _, binaryPath := range looseBinaries {
+		if bundleExecutables[binaryPath] {
+			continue
+		}
+		checksum, _ := fileSHA256(binaryPath)
+		components = append(components, Component{
+			Type:          ComponentExecutable,
+			Name:          filepath.Base(binaryPath),
+			Path:          PayloadPath(root, binaryPath),
+			SHA256:        checksum,
+			Architectures: machOArchitectures(binaryPath),
+		})
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Path < components[j].Path
+	})
+
+	return components, nil
+}
+
+// inspectBundle reads a bundle's Info.plist and describes its main executable.
+// Returns the component and the resolved path of the main executable, if any.
+func inspectBundle(bundlePath string, componentType string) (Component, string) {
+	component := Component{
+		Type: componentType,
+		Name: strings.TrimSuffix(filepath.Base(bundlePath), filepath.Ext(bundlePath)),
+	}
+
+	// Frameworks keep Info.plist in Resources, everything else in Contents
+	infoPlistPaths := []string{
+		filepath.Join(bundlePath, "Contents", "Info.plist"),
+		filepath.Join(bundlePath, "Resources", "Info.plist"),
+		filepath.Join(bundlePath, "Versions", "Current", "Resources", "Info.plist"),
+	}
+
+	var info map[string]interface{}
+	for _, infoPlistPath := range infoPlistPaths {
+		data, err := os.ReadFile(infoPlistPath)
+		if err != nil {
+			continue
+		}
+		if _, err := plist.Unmarshal(data, &info); err == nil {
+			break
+		}
+	}
+	if info == nil {
+		return component, ""
+	}
+
+	if name, ok := info["CFBundleName"].(string); ok && name != "" {
+		component.Name = name
+	}
+	component.BundleID, _ = info["CFBundleIdentifier"].(string)
+	if version, ok := info["CFBundleShortVersionString"].(string); ok && version != "" {
+		component.Version = version
+	} else {
+		component.Version, _ = info["CFBundleVersion"].(string)
+	}
+
+	executableName, _ := info["CFBundleExecutable"].(string)
+	if executableName == "" {
+		return component, ""
+	}
+
+	executablePath := filepath.Join(bundlePath, "Contents", "MacOS", executableName)
+	if componentType == ComponentFramework {
+		executablePath = filepath.Join(bundlePath, executableName)
+	}
+	resolved, err := filepath.EvalSymlinks(executablePath)
+	if err != nil {
+		return component, ""
+	}
+
+	component.SHA256, _ = fileSHA256(resolved)
+	component.Architectures = machOArchitectures(resolved)
+
+	// The walk sees paths under the unresolved root, so map back to it
+	if rootResolved, err := filepath.EvalSymlinks(bundlePath); err == nil {
+		if rel, err := filepath.Rel(rootResolved, resolved); err == nil {
+			resolved = filepath.Join(bundlePath, rel)
+		}
+	}
+	return component, resolved
+}
+
+// PayloadPath returns a path relative to the payload root, stripping pkgutil's
+// expansion directories so it matches the install location
+func PayloadPath(root string, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	rel = filepath.ToSlash(rel)
+	if index := strings.LastIndex(rel, "Payload/"); index >= 0 {
+		rel = rel[index+len("Payload/"):]
+	}
+	return "/" + rel
+}
+
+// isMachO reports whether a file starts with a Mach-O or universal binary magic number
+func isMachO(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+
+	switch hex.EncodeToString(magic) {
+	case "feedface", "feedfacf", "cefaedfe", "cffaedfe", "cafebabe", "bebafeca":
+		return true
+	}
+	return false
+}
+
+// machOArchitectures returns the CPU architectures in a thin or universal binary
+func machOArchitectures(path string) []string {
+	if fat, err := macho.OpenFat(path); err == nil {
+		defer fat.Close()
+		var architectures []string
+		for _, arch := range fat.Arches {
+			architectures = append(architectures, cpuName(arch.Cpu))
+		}
+		return architectures
+	}
+
+	file, err := macho.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	return []string{cpuName(file.Cpu)}
+}
+
+// cpuName returns the architecture name used by lipo and Apple tooling
+func cpuName(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.Cpu386:
+		return "i386"
+	case macho.CpuPpc:
+		return "ppc"
+	case macho.CpuPpc64:
+		return "ppc64"
+	}
+	return cpu.String()
+}
+
+// fileSHA256 returns the hex SHA256 checksum of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,130 @@
+// Package sbom builds software bills of materials for packages and disk images
+// produced by AutoPkg, in CycloneDX or SPDX JSON format.
+package sbom
+
+import "time"
+
+// Supported output formats
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+// Component types found inside an artifact payload
+const (
+	ComponentApplication = "application"
+	ComponentFramework   = "framework"
+	ComponentBundle      = "bundle"
+	ComponentExecutable  = "executable"
+)
+
+// Inventory is the list of software components found in a single artifact
+type Inventory struct {
+	ArtifactPath string      `json:"artifact_path"`
+	Name         string      `json:"name"`
+	Version      string      `json:"version,omitempty"`
+	SHA256       string      `json:"sha256,omitempty"`
+	Components   []Component `json:"components"`
+	InspectedAt  time.Time   `json:"inspected_at"`
+}
+
+// Component is an app bundle, framework, plug-in or command line binary in a payload
+type Component struct {
+	Type          string   `json:"type"`
+	Name          string   `json:"name"`
+	Version       string   `json:"version,omitempty"`
+	BundleID      string   `json:"bundle_id,omitempty"`
+	Path          string   `json:"path"` // Install path relative to the payload root
+	SHA256        string   `json:"sha256,omitempty"`
+	Architectures []string `json:"architectures,omitempty"`
+}
+
+// Options controls SBOM generation
+type Options struct {
+	Format    string // FormatCycloneDX (default) or FormatSPDX
+	OutputDir string // Directory for SBOM files, defaults to the artifact's directory
+	Name      string // Optional name for the top level component, defaults to the file name
+	Version   string // Optional version for the top level component
+}
+
+// cycloneDXDocument is a CycloneDX 1.5 JSON BOM
+type cycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// spdxDocument is an SPDX 2.3 JSON document
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID                string         `json:"SPDXID"`
+	Name                  string         `json:"name"`
+	VersionInfo           string         `json:"versionInfo,omitempty"`
+	PackageFileName       string         `json:"packageFileName,omitempty"`
+	DownloadLocation      string         `json:"downloadLocation"`
+	FilesAnalyzed         bool           `json:"filesAnalyzed"`
+	Checksums             []spdxChecksum `json:"checksums,omitempty"`
+	LicenseConcluded      string         `json:"licenseConcluded"`
+	LicenseDeclared       string         `json:"licenseDeclared"`
+	CopyrightText         string         `json:"copyrightText"`
+	PrimaryPackagePurpose string         `json:"primaryPackagePurpose,omitempty"`
+	Comment               string         `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
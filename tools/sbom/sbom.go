@@ -0,0 +1,232 @@
+// sbom.go
+package sbom
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// toolName identifies the generator in SBOM metadata
+const toolName = "autopkgctl"
+
+// spdxIDInvalidChars matches characters not allowed in SPDX identifiers
+var spdxIDInvalidChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// Generate inspects an artifact and writes its SBOM, returning the SBOM path
+func Generate(artifactPath string, options *Options) (string, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	inventory, err := InspectArtifact(artifactPath)
+	if err != nil {
+		return "", err
+	}
+	if options.Name != "" {
+		inventory.Name = options.Name
+	}
+	inventory.Version = options.Version
+
+	return WriteSBOM(inventory, options)
+}
+
+// WriteSBOM renders an inventory in the requested format and writes it next to
+// the artifact, or to the output directory, as <artifact>.cdx.json or <artifact>.spdx.json
+func WriteSBOM(inventory *Inventory, options *Options) (string, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	format := strings.ToLower(options.Format)
+	if format == "" {
+		format = FormatCycloneDX
+	}
+
+	var document interface{}
+	var extension string
+	switch format {
+	case FormatCycloneDX:
+		document, extension = buildCycloneDX(inventory), ".cdx.json"
+	case FormatSPDX:
+		document, extension = buildSPDX(inventory), ".spdx.json"
+	default:
+		return "", fmt.Errorf("unsupported SBOM format %q (use %s or %s)", options.Format, FormatCycloneDX, FormatSPDX)
+	}
+
+	outputDir := options.OutputDir
+	if outputDir == "" {
+		outputDir = filepath.Dir(inventory.ArtifactPath)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create SBOM directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal SBOM: %w", err)
+	}
+
+	outputPath := filepath.Join(outputDir, filepath.Base(inventory.ArtifactPath)+extension)
+	if err := os.WriteFile(outputPath, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write SBOM: %w", err)
+	}
+
+	logger.Logger(fmt.Sprintf("🧬 Wrote %s SBOM to %s", format, outputPath), logger.LogSuccess)
+	return outputPath, nil
+}
+
+// buildCycloneDX converts an inventory to a CycloneDX 1.5 BOM
+func buildCycloneDX(inventory *Inventory) *cycloneDXDocument {
+	document := &cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: inventory.InspectedAt.Format(time.RFC3339),
+			Tools: cycloneDXTools{
+				Components: []cycloneDXComponent{{Type: "application", Name: toolName}},
+			},
+			Component: cycloneDXComponent{
+				Type:    "application",
+				BOMRef:  "artifact",
+				Name:    inventory.Name,
+				Version: inventory.Version,
+				Hashes:  cycloneDXHashes(inventory.SHA256),
+				Properties: []cycloneDXProperty{
+					{Name: "macos:artifact", Value: filepath.Base(inventory.ArtifactPath)},
+				},
+			},
+		},
+		Components: []cycloneDXComponent{},
+	}
+
+	for i, component := range inventory.Components {
+		componentType := "application"
+		switch component.Type {
+		case ComponentFramework:
+			componentType = "framework"
+		case ComponentBundle:
+			componentType = "library"
+		}
+
+		properties := []cycloneDXProperty{
+			{Name: "macos:component_type", Value: component.Type},
+			{Name: "macos:path", Value: component.Path},
+		}
+		if component.BundleID != "" {
+			properties = append(properties, cycloneDXProperty{Name: "macos:bundle_id", Value: component.BundleID})
+		}
+		if len(component.Architectures) > 0 {
+			properties = append(properties, cycloneDXProperty{Name: "macos:architectures", Value: strings.Join(component.Architectures, ",")})
+		}
+
+		document.Components = append(document.Components, cycloneDXComponent{
+			Type:       componentType,
+			BOMRef:     fmt.Sprintf("component-%d", i+1),
+			Name:       component.Name,
+			Version:    component.Version,
+			Hashes:     cycloneDXHashes(component.SHA256),
+			Properties: properties,
+		})
+	}
+
+	return document
+}
+
+// buildSPDX converts an inventory to an SPDX 2.3 document
+func buildSPDX(inventory *Inventory) *spdxDocument {
+	rootID := "SPDXRef-Artifact-" + spdxIDInvalidChars.ReplaceAllString(inventory.Name, "-")
+
+	document := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              filepath.Base(inventory.ArtifactPath),
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", spdxIDInvalidChars.ReplaceAllString(inventory.Name, "-"), newUUID()),
+		CreationInfo: spdxCreationInfo{
+			Created:  inventory.InspectedAt.Format(time.RFC3339),
+			Creators: []string{"Tool: " + toolName},
+		},
+		Packages: []spdxPackage{
+			newSPDXPackage(rootID, inventory.Name, inventory.Version, inventory.SHA256, "APPLICATION", ""),
+		},
+		Relationships: []spdxRelationship{
+			{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: rootID},
+		},
+	}
+	document.Packages[0].PackageFileName = filepath.Base(inventory.ArtifactPath)
+
+	for i, component := range inventory.Components {
+		purpose := "APPLICATION"
+		switch component.Type {
+		case ComponentFramework:
+			purpose = "FRAMEWORK"
+		case ComponentBundle:
+			purpose = "LIBRARY"
+		}
+
+		comment := "path: " + component.Path
+		if component.BundleID != "" {
+			comment += "; bundle id: " + component.BundleID
+		}
+		if len(component.Architectures) > 0 {
+			comment += "; architectures: " + strings.Join(component.Architectures, ",")
+		}
+
+		componentID := fmt.Sprintf("SPDXRef-Component-%d", i+1)
+		document.Packages = append(document.Packages, newSPDXPackage(componentID, component.Name, component.Version, component.SHA256, purpose, comment))
+		document.Relationships = append(document.Relationships, spdxRelationship{
+			SPDXElementID:      rootID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: componentID,
+		})
+	}
+
+	return document
+}
+
+// newSPDXPackage creates an SPDX package entry. License and copyright data
+// can't be derived from a binary payload, so they are NOASSERTION.
+func newSPDXPackage(id, name, version, checksum, purpose, comment string) spdxPackage {
+	pkg := spdxPackage{
+		SPDXID:                id,
+		Name:                  name,
+		VersionInfo:           version,
+		DownloadLocation:      "NOASSERTION",
+		LicenseConcluded:      "NOASSERTION",
+		LicenseDeclared:       "NOASSERTION",
+		CopyrightText:         "NOASSERTION",
+		PrimaryPackagePurpose: purpose,
+		Comment:               comment,
+	}
+	if checksum != "" {
+		pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: checksum}}
+	}
+	return pkg
+}
+
+// cycloneDXHashes returns the hash list for a checksum, if there is one
+func cycloneDXHashes(checksum string) []cycloneDXHash {
+	if checksum == "" {
+		return nil
+	}
+	return []cycloneDXHash{{Algorithm: "SHA-256", Content: checksum}}
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
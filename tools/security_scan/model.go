@@ -0,0 +1,106 @@
+// Package securityscan combines the security checks of a package, disk image,
+// app or directory into one report: Suspicious Package and payload
+// inspection, codesign and notarization, VirusTotal and other reputation
+// providers, and install script rules.
+package securityscan
+
+import (
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+	sp "github.com/deploymenttheory/macos-autopkg-factory/tools/suspicious_package"
+	virustotal "github.com/deploymenttheory/macos-autopkg-factory/tools/virus_total"
+)
+
+// Finding severities, from least to most severe
+const (
+	SeverityNone     = "none"
+	SeverityInfo     = "info"
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// severityRanks orders the severities
+var severityRanks = map[string]int{
+	SeverityNone:     0,
+	SeverityInfo:     1,
+	SeverityLow:      2,
+	SeverityMedium:   3,
+	SeverityHigh:     4,
+	SeverityCritical: 5,
+}
+
+// Checks a scan can run
+const (
+	CheckSuspiciousPackage = "suspicious_package"
+	CheckPayload           = "payload"
+	CheckCodesign          = "codesign"
+	CheckVirusTotal        = "virustotal"
+	CheckScripts           = "scripts"
+	CheckMalwareBazaar     = "malwarebazaar"
+)
+
+// Options selects the checks of a scan
+type Options struct {
+	SuspiciousPackage bool                 // Scan packages with Suspicious Package on macOS, and inspect the payload of anything else
+	Codesign          bool                 // Check signatures and notarization with stapler and spctl
+	VirusTotal        bool                 // Look up packages and disk images on VirusTotal
+	VirusTotalConfig  *virustotal.Config   // Defaults to virustotal.DefaultConfig
+	Scripts           bool                 // Match install scripts against ScriptRules
+	ScriptRules       []ScriptRule         // Defaults to DefaultScriptRules
+	Reputation        []ReputationProvider // Also look packages and disk images up with these, e.g. MalwareBazaar
+}
+
+// Report is the combined result of the checks of a scan
+type Report struct {
+	Path              string                 `json:"path"`
+	ScannedAt         time.Time              `json:"scanned_at"`
+	Duration          time.Duration          `json:"duration"`
+	Checks            []string               `json:"checks"`
+	Severity          string                 `json:"severity"` // Highest severity of the findings
+	Findings          []Finding              `json:"findings"` // Most severe first
+	SuspiciousPackage *sp.SecurityScanResult `json:"suspicious_package,omitempty"`
+	Payload           *sp.PayloadInspection  `json:"payload,omitempty"` // When Suspicious Package couldn't scan the path
+	Notarization      []notarization.Result  `json:"notarization,omitempty"`
+	VirusTotal        []VirusTotalResult     `json:"virustotal,omitempty"`
+	Scripts           []ScriptMatch          `json:"scripts,omitempty"`
+	Reputation        []Reputation           `json:"reputation,omitempty"` // What the reputation providers know of each file
+	Errors            []string               `json:"errors,omitempty"`     // Checks that couldn't run
+}
+
+// Finding is something a check found worth a look
+type Finding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Path     string `json:"path,omitempty"`
+}
+
+// VirusTotalResult is what VirusTotal knows about a file
+type VirusTotalResult struct {
+	File      string `json:"file"`
+	Result    string `json:"result"` // SKIPPED, NOT_FOUND, SUBMITTED, QUEUED, ANALYZED or ERROR
+	Positives int    `json:"positives"`
+	Total     int    `json:"total"`
+	Permalink string `json:"permalink,omitempty"`
+	Cached    bool   `json:"cached,omitempty"` // From the result cache rather than asked again
+}
+
+// SeverityRank orders severities, so thresholds can be compared. Unknown
+// severities rank as none.
+func SeverityRank(severity string) int {
+	return severityRanks[severity]
+}
+
+// ValidSeverity reports whether a severity is known
+func ValidSeverity(severity string) bool {
+	_, ok := severityRanks[severity]
+	return ok
+}
+
+// Exceeds reports whether any finding is at least as severe as threshold
+func (r *Report) Exceeds(threshold string) bool {
+	return threshold != SeverityNone && SeverityRank(r.Severity) >= SeverityRank(threshold)
+}
@@ -0,0 +1,165 @@
+// reputation.go
+package securityscan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultMalwareBazaarAPI is the abuse.ch MalwareBazaar API
+const DefaultMalwareBazaarAPI = "https://mb-api.abuse.ch/api/v1/"
+
+// ReputationProvider looks files up by SHA256 in a database of known
+// malware, as a second opinion next to VirusTotal
+type ReputationProvider interface {
+	Name() string
+	Lookup(checksum string) (*Reputation, error)
+}
+
+// Reputation is what a provider knows about a file
+type Reputation struct {
+	Provider  string   `json:"provider"`
+	File      string   `json:"file"`
+	SHA256    string   `json:"sha256"`
+	Known     bool     `json:"known"`               // Whether the provider has the file
+	Malicious bool     `json:"malicious"`           // Whether the provider knows it as malware
+	Signature string   `json:"signature,omitempty"` // Malware family, e.g. AMOS
+	Tags      []string `json:"tags,omitempty"`
+	FirstSeen string   `json:"first_seen,omitempty"`
+	Link      string   `json:"link,omitempty"`
+}
+
+// MalwareBazaar looks files up in abuse.ch's MalwareBazaar, a collection of
+// malware samples shared by researchers. Every sample it has is malware, so
+// any match is.
+type MalwareBazaar struct {
+	APIURL  string // Defaults to DefaultMalwareBazaarAPI
+	AuthKey string // abuse.ch Auth-Key, required by the API
+	Client  *http.Client
+}
+
+// Name implements ReputationProvider
+func (m *MalwareBazaar) Name() string { return CheckMalwareBazaar }
+
+// Lookup implements ReputationProvider
+func (m *MalwareBazaar) Lookup(checksum string) (*Reputation, error) {
+	if m.AuthKey == "" {
+		return nil, fmt.Errorf("MalwareBazaar needs an abuse.ch Auth-Key")
+	}
+	apiURL := m.APIURL
+	if apiURL == "" {
+		apiURL = DefaultMalwareBazaarAPI
+	}
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	form := url.Values{"query": {"get_info"}, "hash": {checksum}}
+	req, err := http.NewRequest(http.MethodPost, apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MalwareBazaar request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Auth-Key", m.AuthKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query MalwareBazaar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("MalwareBazaar returned %s", resp.Status)
+	}
+
+	var response struct {
+		QueryStatus string `json:"query_status"`
+		Data        []struct {
+			Signature string   `json:"signature"`
+			Tags      []string `json:"tags"`
+			FirstSeen string   `json:"first_seen"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse MalwareBazaar response: %w", err)
+	}
+
+	reputation := &Reputation{Provider: m.Name(), SHA256: checksum}
+	switch response.QueryStatus {
+	case "ok":
+		reputation.Known = true
+		reputation.Malicious = true
+		reputation.Link = fmt.Sprintf("https://bazaar.abuse.ch/sample/%s/", checksum)
+		if len(response.Data) > 0 {
+			reputation.Signature = response.Data[0].Signature
+			reputation.Tags = response.Data[0].Tags
+			reputation.FirstSeen = response.Data[0].FirstSeen
+		}
+	case "hash_not_found", "no_results":
+	default:
+		return nil, fmt.Errorf("MalwareBazaar query failed: %s", response.QueryStatus)
+	}
+	return reputation, nil
+}
+
+// checkReputation looks up the packages and disk images with each provider.
+// A file a provider knows as malware is critical.
+func checkReputation(report *Report, path string, providers []ReputationProvider) {
+	for _, provider := range providers {
+		report.Checks = append(report.Checks, provider.Name())
+	}
+
+	for _, target := range scanTargets(path, false) {
+		checksum, err := fileSHA256(target)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("reputation: %v", err))
+			continue
+		}
+		for _, provider := range providers {
+			reputation, err := provider.Lookup(checksum)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %s: %v", provider.Name(), filepath.Base(target), err))
+				continue
+			}
+			reputation.File = target
+			report.Reputation = append(report.Reputation, *reputation)
+			if !reputation.Malicious {
+				continue
+			}
+
+			details := reputation.Signature
+			if len(reputation.Tags) > 0 {
+				details = strings.TrimPrefix(details+", "+strings.Join(reputation.Tags, ", "), ", ")
+			}
+			message := fmt.Sprintf("%s is known malware to %s", filepath.Base(target), provider.Name())
+			if details != "" {
+				message += fmt.Sprintf(" (%s)", details)
+			}
+			report.Findings = append(report.Findings, Finding{Check: provider.Name(), Severity: SeverityCritical, Path: target, Message: message})
+		}
+	}
+}
+
+// fileSHA256 returns the hex SHA256 of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
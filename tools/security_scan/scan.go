@@ -0,0 +1,214 @@
+// scan.go
+package securityscan
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/notarization"
+	sp "github.com/deploymenttheory/macos-autopkg-factory/tools/suspicious_package"
+	virustotal "github.com/deploymenttheory/macos-autopkg-factory/tools/virus_total"
+)
+
+// Scan runs the selected checks on a package, disk image, app or directory
+// and combines their findings. A check that can't run, e.g. codesign off
+// macOS, is listed in Errors rather than failing the scan. In a directory,
+// the packages, disk images and apps at its top level are checked with
+// codesign and VirusTotal.
+func Scan(path string, options Options) (*Report, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	start := time.Now()
+	logger.Logger(fmt.Sprintf("🛡️ Scanning %s", path), logger.LogInfo)
+
+	report := &Report{
+		Path:      path,
+		ScannedAt: start.UTC(),
+		Checks:    []string{},
+		Findings:  []Finding{},
+	}
+	if options.SuspiciousPackage {
+		scanPackage(report, path)
+	}
+	if options.Codesign {
+		checkCodesign(report, path)
+	}
+	if options.VirusTotal {
+		checkVirusTotal(report, path, options.VirusTotalConfig)
+	}
+	if len(options.Reputation) > 0 {
+		checkReputation(report, path, options.Reputation)
+	}
+	if options.Scripts {
+		report.Checks = append(report.Checks, CheckScripts)
+		matches, err := MatchScripts(path, options.ScriptRules)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", CheckScripts, err))
+		}
+		report.Scripts = matches
+		for _, match := range matches {
+			report.Findings = append(report.Findings, Finding{
+				Check:    CheckScripts,
+				Severity: match.Severity,
+				Message:  fmt.Sprintf("%s line %d %s: %s", match.Script, match.Line, match.Description, match.Text),
+				Path:     match.Script,
+			})
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return SeverityRank(report.Findings[i].Severity) > SeverityRank(report.Findings[j].Severity)
+	})
+	report.Severity = SeverityNone
+	if len(report.Findings) > 0 {
+		report.Severity = report.Findings[0].Severity
+	}
+	report.Duration = time.Since(start)
+
+	logger.Logger(fmt.Sprintf("🛡️ Scanned %s: %d findings, highest severity %s", filepath.Base(path), len(report.Findings), report.Severity), logger.LogInfo)
+	return report, nil
+}
+
+// scanPackage scans a flat package with Suspicious Package, which also
+// inspects its payload, and inspects the payload of anything else directly
+func scanPackage(report *Report, path string) {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".pkg") && runtime.GOOS == "darwin" {
+		report.Checks = append(report.Checks, CheckSuspiciousPackage)
+		result, err := sp.ScanPackage(sp.ScanOptions{PackagePath: path})
+		if err == nil {
+			report.SuspiciousPackage = result
+			for _, issue := range result.Issues {
+				report.Findings = append(report.Findings, packageFinding(CheckSuspiciousPackage, issue))
+			}
+			if result.Payload != nil {
+				for _, issue := range result.Payload.Findings {
+					report.Findings = append(report.Findings, packageFinding(CheckPayload, issue))
+				}
+			}
+			return
+		}
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", CheckSuspiciousPackage, err))
+	}
+
+	report.Checks = append(report.Checks, CheckPayload)
+	payload, err := sp.InspectPayload(path, nil)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", CheckPayload, err))
+		return
+	}
+	report.Payload = payload
+	for _, issue := range payload.Findings {
+		report.Findings = append(report.Findings, packageFinding(CheckPayload, issue))
+	}
+}
+
+// packageFinding converts a Suspicious Package issue, whose priority is critical or warning
+func packageFinding(check string, issue sp.PackageIssue) Finding {
+	severity := SeverityLow
+	switch issue.Priority {
+	case "critical":
+		severity = SeverityCritical
+	case "warning":
+		severity = SeverityMedium
+	}
+	return Finding{Check: check, Severity: severity, Message: issue.Details, Path: issue.Path}
+}
+
+// checkCodesign checks the signature and notarization of the artifacts
+func checkCodesign(report *Report, path string) {
+	report.Checks = append(report.Checks, CheckCodesign)
+	for _, target := range scanTargets(path, true) {
+		result, err := notarization.Check(target, nil)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", CheckCodesign, err))
+			if errors.Is(err, notarization.ErrUnsupported) {
+				return
+			}
+			continue
+		}
+		report.Notarization = append(report.Notarization, *result)
+
+		name := filepath.Base(target)
+		switch {
+		case !result.Accepted:
+			report.Findings = append(report.Findings, Finding{Check: CheckCodesign, Severity: SeverityHigh, Path: target,
+				Message: fmt.Sprintf("%s is rejected by Gatekeeper (%s)", name, result.Source)})
+		case !result.Notarized:
+			report.Findings = append(report.Findings, Finding{Check: CheckCodesign, Severity: SeverityMedium, Path: target,
+				Message: fmt.Sprintf("%s is signed but not notarized (%s)", name, result.Source)})
+		case !result.Stapled && result.Type != "app":
+			report.Findings = append(report.Findings, Finding{Check: CheckCodesign, Severity: SeverityLow, Path: target,
+				Message: fmt.Sprintf("%s is notarized but its ticket isn't stapled, so offline Macs can't verify it", name)})
+		}
+	}
+}
+
+// checkVirusTotal looks up the packages and disk images on VirusTotal, all at
+// once under the analyzer's rate limit. More
+// than a tenth of scanners detecting a file is critical, fewer is likely a
+// false positive.
+func checkVirusTotal(report *Report, path string, config *virustotal.Config) {
+	report.Checks = append(report.Checks, CheckVirusTotal)
+	analyzer := virustotal.NewAnalyzer(config)
+	for _, analysis := range analyzer.AnalyzeFiles(scanTargets(path, false), true) {
+		target, summary := analysis.FilePath, analysis.Summary
+		if analysis.Error != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s: %v", CheckVirusTotal, filepath.Base(target), analysis.Error))
+			continue
+		}
+		report.VirusTotal = append(report.VirusTotal, VirusTotalResult{
+			File:      target,
+			Result:    summary.Result,
+			Positives: summary.Positives,
+			Total:     summary.Total,
+			Permalink: summary.Permalink,
+			Cached:    summary.Cached,
+		})
+		if summary.Positives == 0 {
+			continue
+		}
+
+		severity := SeverityMedium
+		if float64(summary.Positives)/float64(summary.Total) > 0.1 {
+			severity = SeverityCritical
+		}
+		report.Findings = append(report.Findings, Finding{Check: CheckVirusTotal, Severity: severity, Path: target,
+			Message: fmt.Sprintf("%s detected by %d/%d VirusTotal scanners", filepath.Base(target), summary.Positives, summary.Total)})
+	}
+}
+
+// scanTargets returns the path when it's a package, disk image or, with
+// apps set, an app, or else those at the top level of the directory
+func scanTargets(path string, apps bool) []string {
+	target := func(candidate string) bool {
+		artifactType := notarization.ArtifactType(candidate)
+		if artifactType == "app" {
+			return apps
+		}
+		info, err := os.Stat(candidate)
+		return artifactType != "" && err == nil && !info.IsDir()
+	}
+
+	if target(path) {
+		return []string{path}
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+	var targets []string
+	for _, entry := range entries {
+		if candidate := filepath.Join(path, entry.Name()); target(candidate) {
+			targets = append(targets, candidate)
+		}
+	}
+	return targets
+}
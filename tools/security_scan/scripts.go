@@ -0,0 +1,173 @@
+// scripts.go
+package securityscan
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/sbom"
+)
+
+// maxScriptSize is the largest install script matched against the rules
+const maxScriptSize = 1 << 20
+
+// ScriptRule flags install script lines matching a pattern
+type ScriptRule struct {
+	ID          string
+	Severity    string
+	Description string
+	Pattern     *regexp.Regexp
+}
+
+// ScriptMatch is an install script line a rule flagged
+type ScriptMatch struct {
+	Script      string `json:"script"` // Path within the artifact, e.g. Scripts/postinstall
+	Line        int    `json:"line"`
+	Text        string `json:"text"`
+	Rule        string `json:"rule"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+}
+
+// DefaultScriptRules flag what install scripts shouldn't need to do:
+// weakening macOS security, running downloaded code and prompting for passwords
+var DefaultScriptRules = []ScriptRule{
+	{ID: "gatekeeper-disabled", Severity: SeverityCritical, Description: "disables Gatekeeper",
+		Pattern: regexp.MustCompile(`spctl\s+(--master-disable|--global-disable)`)},
+	{ID: "sip-disabled", Severity: SeverityCritical, Description: "disables System Integrity Protection",
+		Pattern: regexp.MustCompile(`csrutil\s+disable`)},
+	{ID: "sudoers-modified", Severity: SeverityCritical, Description: "changes the sudo configuration",
+		Pattern: regexp.MustCompile(`/etc/sudoers`)},
+	{ID: "tcc-database", Severity: SeverityCritical, Description: "edits the privacy database directly",
+		Pattern: regexp.MustCompile(`TCC\.db`)},
+	{ID: "remote-script", Severity: SeverityHigh, Description: "downloads and runs a script",
+		Pattern: regexp.MustCompile(`\b(curl|wget)\b[^|\n]*\|\s*(sudo\s+)?(/bin/|/usr/bin/)?(ba|z)?sh\b`)},
+	{ID: "world-writable", Severity: SeverityHigh, Description: "makes files writable by every user",
+		Pattern: regexp.MustCompile(`chmod\s+(-R\s+)?(0?777|a\+w|o\+w)`)},
+	{ID: "admin-group", Severity: SeverityHigh, Description: "changes admin group membership",
+		Pattern: regexp.MustCompile(`(dseditgroup\b.*\badmin\b|dscl\b.*-(create|append)\b.*\badmin\b)`)},
+	{ID: "password-prompt", Severity: SeverityHigh, Description: "asks the user for a password",
+		Pattern: regexp.MustCompile(`osascript\b.*(hidden answer|password)`)},
+	{ID: "quarantine-removed", Severity: SeverityMedium, Description: "removes the quarantine attribute",
+		Pattern: regexp.MustCompile(`xattr\b.*com\.apple\.quarantine`)},
+	{ID: "base64-decode", Severity: SeverityMedium, Description: "decodes base64 data",
+		Pattern: regexp.MustCompile(`base64\s+(-d|-D|--decode)\b`)},
+	{ID: "kext-load", Severity: SeverityMedium, Description: "loads a kernel extension",
+		Pattern: regexp.MustCompile(`\b(kextload|kmutil\s+load)\b`)},
+	{ID: "download", Severity: SeverityLow, Description: "downloads files while installing",
+		Pattern: regexp.MustCompile(`\b(curl|wget)\b`)},
+	{ID: "launchd-load", Severity: SeverityInfo, Description: "loads a launchd job",
+		Pattern: regexp.MustCompile(`launchctl\s+(load|bootstrap)\b`)},
+}
+
+// MatchScripts matches the install scripts of a package, or the scripts in a
+// directory, against rules, DefaultScriptRules when nil. Each line is
+// reported once, for the most severe rule it matches.
+func MatchScripts(artifactPath string, rules []ScriptRule) ([]ScriptMatch, error) {
+	if rules == nil {
+		rules = DefaultScriptRules
+	}
+
+	// Packages and disk images only run their install scripts, directories may hold any script
+	ext := strings.ToLower(filepath.Ext(artifactPath))
+	expanded := ext == ".pkg" || ext == ".mpkg" || ext == ".dmg"
+
+	matches := []ScriptMatch{}
+	err := sbom.WalkArtifact(artifactPath, func(root string) error {
+		return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || !entry.Type().IsRegular() {
+				return nil
+			}
+
+			name := filepath.Base(path)
+			if rel, err := filepath.Rel(root, path); err == nil && rel != "." {
+				name = filepath.ToSlash(rel)
+			}
+			if expanded && !installScript(name) {
+				return nil
+			}
+
+			data, err := readScript(path)
+			if err != nil || data == nil || (!expanded && !bytes.HasPrefix(data, []byte("#!"))) {
+				return nil
+			}
+			matches = append(matches, matchScript(name, data, rules)...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to match install scripts: %w", err)
+	}
+	return matches, nil
+}
+
+// installScript reports whether a path in an expanded package is one of its
+// scripts, at the top or in a component package of a product archive
+func installScript(rel string) bool {
+	parts := strings.Split(rel, "/")
+	if len(parts) > 1 && strings.HasSuffix(parts[0], ".pkg") {
+		parts = parts[1:]
+	}
+	return len(parts) > 1 && parts[0] == "Scripts"
+}
+
+// readScript reads a script, or returns nil for binaries and files too large to be one
+func readScript(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxScriptSize {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	head := data
+	if len(head) > 8192 {
+		head = head[:8192]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// matchScript matches each line of a script against the rules
+func matchScript(name string, data []byte, rules []ScriptRule) []ScriptMatch {
+	var matches []ScriptMatch
+	for number, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var matched *ScriptRule
+		for i := range rules {
+			if rules[i].Pattern.MatchString(text) && (matched == nil || SeverityRank(rules[i].Severity) > SeverityRank(matched.Severity)) {
+				matched = &rules[i]
+			}
+		}
+		if matched == nil {
+			continue
+		}
+		if len(text) > 200 {
+			text = text[:200] + "…"
+		}
+		matches = append(matches, ScriptMatch{
+			Script:      name,
+			Line:        number + 1,
+			Text:        text,
+			Rule:        matched.ID,
+			Severity:    matched.Severity,
+			Description: matched.Description,
+		})
+	}
+	return matches
+}
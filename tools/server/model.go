@@ -0,0 +1,86 @@
+// Package server runs autopkgctl as a long-lived daemon with an HTTP API, so
+// a portal or other automation can trigger recipe runs, follow their logs and
+// fetch their reports without a shell on the Mac running them
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DefaultAddr is the address the API listens on, local only unless configured
+const DefaultAddr = "127.0.0.1:8080"
+
+// DefaultConcurrency is how many runs the server runs at once
+const DefaultConcurrency = 1
+
+// TokensEnvVar holds comma separated API tokens, on top of configured ones
+const TokensEnvVar = "AUTOPKGCTL_API_TOKENS"
+
+// Run statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Config holds the configuration of the API server
+type Config struct {
+	// Addr is the host:port to listen on, defaults to DefaultAddr
+	Addr string
+
+	// Tokens are the bearer tokens accepted by the API. At least one is required.
+	Tokens []string
+
+	// StateDir is the autopkgctl state directory. Runs started by the server
+	// are kept in its serve directory, history is read from its run records.
+	StateDir string
+
+	// Executable is the autopkgctl binary runs are started with, defaults to the running one
+	Executable string
+
+	// GlobalArgs are passed to every run before the run command, e.g. --prefs
+	GlobalArgs []string
+
+	// Concurrency is how many runs go at once, defaults to DefaultConcurrency.
+	// Further runs wait in the queue. Runs on the same preferences also wait
+	// for each other's run lock, unless they run with --isolate.
+	Concurrency int
+
+	// Triggers map inbound webhooks to the recipes they run
+	Triggers []Trigger
+}
+
+// RunRequest is the body of a request to start a run. Either Recipes or
+// RecipeList is required.
+type RunRequest struct {
+	Recipes    []string `json:"recipes,omitempty"`
+	RecipeList string   `json:"recipe_list,omitempty"` // Recipe list file on the server
+	Args       []string `json:"args,omitempty"`        // Further autopkgctl run flags, e.g. --verify-trust=false, apart from those the server sets
+	Priority   string   `json:"priority,omitempty"`    // low, normal or high, defaults to normal
+}
+
+// Run is a recipe run started by the server
+type Run struct {
+	ID         string          `json:"id"`
+	Request    RunRequest      `json:"request"`
+	Recipes    []string        `json:"recipes,omitempty"` // Recipes the run processes, runs sharing one go one after the other
+	Priority   string          `json:"priority"`
+	Trigger    string          `json:"trigger"`            // "api", or the webhook trigger that queued the run
+	Delivery   string          `json:"delivery,omitempty"` // Webhook delivery ID, to ignore redeliveries
+	Status     string          `json:"status"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	ExitCode   int             `json:"exit_code"`
+	Error      string          `json:"error,omitempty"`
+	LogPath    string          `json:"log_path"`
+	ReportPath string          `json:"report_path"`
+	Result     json.RawMessage `json:"result,omitempty"` // Result document of autopkgctl run -o json
+}
+
+// Finished reports whether the run has ended, one way or the other
+func (r *Run) Finished() bool {
+	return r.Status == StatusSucceeded || r.Status == StatusFailed
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Run priorities, higher priorities start first, e.g. security patch runs
+// ahead of the nightly batch
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// priorityRanks orders the priorities
+var priorityRanks = map[string]int{
+	PriorityLow:    0,
+	PriorityNormal: 1,
+	PriorityHigh:   2,
+}
+
+// Queue is the state of the run queue
+type Queue struct {
+	Concurrency int          `json:"concurrency,omitempty"` // Runs started at once, when known
+	Running     []*Run       `json:"running"`
+	Queued      []QueueEntry `json:"queued"` // In the order they start
+}
+
+// QueueEntry is a queued run with its place in the queue
+type QueueEntry struct {
+	*Run
+	Position   int      `json:"position"`              // 1 is the next to start
+	WaitingFor []string `json:"waiting_for,omitempty"` // Running or earlier queued runs sharing a recipe with it
+}
+
+// validPriority reports whether a priority is known, empty meaning normal
+func validPriority(priority string) bool {
+	_, ok := priorityRanks[priority]
+	return ok || priority == ""
+}
+
+// priorityRank returns the rank of a priority, empty meaning normal
+func priorityRank(priority string) int {
+	if rank, ok := priorityRanks[priority]; ok {
+		return rank
+	}
+	return priorityRanks[PriorityNormal]
+}
+
+// requestRecipes returns the recipes a request runs, reading its recipe list,
+// so runs touching the same recipes can be kept apart
+func requestRecipes(request RunRequest) ([]string, error) {
+	recipes := request.Recipes
+	if request.RecipeList != "" {
+		var err error
+		source := &autopkg.FileRecipeSource{FilePath: request.RecipeList}
+		if recipes, err = source.GetRecipes(); err != nil {
+			return nil, fmt.Errorf("failed to read recipe list %s: %w", request.RecipeList, err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, recipe := range recipes {
+		name := strings.TrimSuffix(strings.TrimSpace(recipe), ".recipe")
+		if name != "" && !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// buildQueue splits runs into the running ones and the queued ones in the
+// order they start: highest priority first, then oldest first. A queued run
+// waits for any running or earlier queued run sharing one of its recipes, so
+// two runs never process the same recipe at once and keep their order.
+func buildQueue(runs []*Run) *Queue {
+	queue := &Queue{Running: []*Run{}, Queued: []QueueEntry{}}
+	var queued []*Run
+	for _, run := range runs {
+		switch run.Status {
+		case StatusRunning:
+			queue.Running = append(queue.Running, run)
+		case StatusQueued:
+			queued = append(queued, run)
+		}
+	}
+	sort.Slice(queue.Running, func(i, j int) bool { return queue.Running[i].ID < queue.Running[j].ID })
+	sort.Slice(queued, func(i, j int) bool {
+		if rankI, rankJ := priorityRank(queued[i].Priority), priorityRank(queued[j].Priority); rankI != rankJ {
+			return rankI > rankJ
+		}
+		if !queued[i].CreatedAt.Equal(queued[j].CreatedAt) {
+			return queued[i].CreatedAt.Before(queued[j].CreatedAt)
+		}
+		return queued[i].ID < queued[j].ID
+	})
+
+	// The runs ahead of the current one, by recipe
+	claimed := make(map[string][]string)
+	claim := func(run *Run) {
+		for _, recipe := range run.Recipes {
+			claimed[strings.ToLower(recipe)] = append(claimed[strings.ToLower(recipe)], run.ID)
+		}
+	}
+	for _, run := range queue.Running {
+		claim(run)
+	}
+	for i, run := range queued {
+		entry := QueueEntry{Run: run, Position: i + 1}
+		seen := make(map[string]bool)
+		for _, recipe := range run.Recipes {
+			for _, id := range claimed[strings.ToLower(recipe)] {
+				if !seen[id] {
+					seen[id] = true
+					entry.WaitingFor = append(entry.WaitingFor, id)
+				}
+			}
+		}
+		claim(run)
+		queue.Queued = append(queue.Queued, entry)
+	}
+	return queue
+}
+
+// loadRuns reads the runs kept in a server directory, skipping unreadable ones
+func loadRuns(dir string) ([]*Run, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "runs", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []*Run
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read run %s: %w", path, err)
+		}
+		var run Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Skipping unreadable run %s: %v", path, err), logger.LogWarning)
+			continue
+		}
+		runs = append(runs, &run)
+	}
+	return runs, nil
+}
+
+// ReadQueue reads the queue of the server using a state directory from its
+// run files, for looking at it without the API
+func ReadQueue(stateDir string) (*Queue, error) {
+	if stateDir == "" {
+		stateDir = autopkg.DefaultStateDir()
+	}
+	runs, err := loadRuns(filepath.Join(stateDir, "serve"))
+	if err != nil {
+		return nil, err
+	}
+	return buildQueue(runs), nil
+}
+
+// ReadRuns reads the runs of the server using a state directory from its run
+// files, newest first
+func ReadRuns(stateDir string) ([]*Run, error) {
+	if stateDir == "" {
+		stateDir = autopkg.DefaultStateDir()
+	}
+	runs, err := loadRuns(filepath.Join(stateDir, "serve"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].CreatedAt.After(runs[j].CreatedAt) })
+	return runs, nil
+}
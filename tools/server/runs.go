@@ -0,0 +1,385 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// runStore keeps the runs started by the server as JSON files in
+// <state dir>/serve/runs, with their logs and reports next to them, so
+// status, logs and reports outlive the process. Runs are queued and started
+// by priority, then oldest first, no more than the configured concurrency at
+// a time and one at a time per recipe.
+type runStore struct {
+	config *Config
+	dir    string
+
+	mu      sync.Mutex
+	runs    map[string]*Run
+	active  map[string]chan struct{} // Closed when the run finishes
+	running int
+	stopped bool // Set on shutdown, queued runs stay queued for the next start
+	wg      sync.WaitGroup
+}
+
+// newRunStore loads the runs of a state directory. Runs a previous process
+// left running can't be followed any more and are marked failed, those it
+// left queued are started by resume.
+func newRunStore(config *Config) (*runStore, error) {
+	stateDir := config.StateDir
+	if stateDir == "" {
+		stateDir = autopkg.DefaultStateDir()
+	}
+	store := &runStore{
+		config: config,
+		dir:    filepath.Join(stateDir, "serve"),
+		runs:   make(map[string]*Run),
+		active: make(map[string]chan struct{}),
+	}
+	for _, sub := range []string{"runs", "logs", "reports"} {
+		if err := os.MkdirAll(filepath.Join(store.dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create server state directory: %w", err)
+		}
+	}
+
+	runs, err := loadRuns(store.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if run.Status == StatusQueued {
+			store.active[run.ID] = make(chan struct{})
+		} else if !run.Finished() {
+			run.Status = StatusFailed
+			run.Error = "interrupted, the server stopped before the run finished"
+			run.FinishedAt = now()
+			if err := store.save(run); err != nil {
+				return nil, err
+			}
+		}
+		store.runs[run.ID] = run
+	}
+	return store, nil
+}
+
+// enqueue queues a run for a request and starts it when there's room. A
+// request identical to a run still queued, or a webhook delivery already
+// seen, returns that run instead, with duplicate set, raising its priority
+// to the request's when that's higher.
+func (s *runStore) enqueue(request RunRequest, trigger string, delivery string) (run *Run, duplicate bool, err error) {
+	recipes, err := requestRecipes(request)
+	if err != nil {
+		return nil, false, err
+	}
+	priority := request.Priority
+	if priority == "" {
+		priority = PriorityNormal
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := request.key()
+	for _, existing := range s.runs {
+		sameDelivery := delivery != "" && existing.Trigger == trigger && existing.Delivery == delivery
+		if !sameDelivery && (existing.Status != StatusQueued || existing.Request.key() != key) {
+			continue
+		}
+		if existing.Status == StatusQueued && priorityRank(priority) > priorityRank(existing.Priority) {
+			logger.Logger(fmt.Sprintf("⏫ Run %s raised to %s priority by %s", existing.ID, priority, trigger), logger.LogInfo)
+			existing.Priority = priority
+			if err := s.save(existing); err != nil {
+				return nil, false, err
+			}
+			s.dispatch()
+		}
+		copied := *existing
+		return &copied, true, nil
+	}
+
+	created := time.Now().UTC()
+	id := autopkg.NewRunID(created)
+	run = &Run{
+		ID:         id,
+		Request:    request,
+		Recipes:    recipes,
+		Priority:   priority,
+		Trigger:    trigger,
+		Delivery:   delivery,
+		Status:     StatusQueued,
+		CreatedAt:  created,
+		LogPath:    filepath.Join(s.dir, "logs", id+".log"),
+		ReportPath: filepath.Join(s.dir, "reports", id+".plist"),
+	}
+	if err := s.save(run); err != nil {
+		return nil, false, err
+	}
+	s.runs[id] = run
+	s.active[id] = make(chan struct{})
+	logger.Logger(fmt.Sprintf("📥 Run %s queued by %s with %s priority", id, trigger, priority), logger.LogInfo)
+
+	copied := *run
+	s.dispatch()
+	return &copied, false, nil
+}
+
+// dispatch starts queued runs in queue order while fewer than the configured
+// concurrency are running, skipping those waiting for a run sharing one of
+// their recipes. The caller holds the lock.
+func (s *runStore) dispatch() {
+	if s.stopped {
+		return
+	}
+	limit := s.config.Concurrency
+	if limit <= 0 {
+		limit = DefaultConcurrency
+	}
+
+	runs := make([]*Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	for _, entry := range buildQueue(runs).Queued {
+		if s.running >= limit {
+			return
+		}
+		if len(entry.WaitingFor) > 0 {
+			continue
+		}
+		run := entry.Run
+		s.running++
+		run.Status = StatusRunning
+		run.StartedAt = now()
+		if err := s.save(run); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to save run %s: %v", run.ID, err), logger.LogWarning)
+		}
+
+		s.wg.Add(1)
+		go func(run Run) {
+			defer s.wg.Done()
+			s.execute(&run)
+		}(*run)
+	}
+}
+
+// queue returns copies of the runs, as the queue
+func (s *runStore) queue() *Queue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]*Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		copied := *run
+		runs = append(runs, &copied)
+	}
+	queue := buildQueue(runs)
+	queue.Concurrency = s.config.Concurrency
+	if queue.Concurrency <= 0 {
+		queue.Concurrency = DefaultConcurrency
+	}
+	return queue
+}
+
+// get returns a copy of a run, or nil when there is none with the ID
+func (s *runStore) get(id string) *Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return nil
+	}
+	copied := *run
+	return &copied
+}
+
+// list returns copies of the runs, newest first
+func (s *runStore) list() []*Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]*Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		copied := *run
+		runs = append(runs, &copied)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID > runs[j].ID })
+	return runs
+}
+
+// done returns a channel closed when a run finishes, or nil when it isn't active
+func (s *runStore) done(id string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active[id]
+}
+
+// finish records how a run ended and starts the next queued ones
+func (s *runStore) finish(id string, change func(run *Run)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := s.runs[id]
+	change(run)
+	run.FinishedAt = now()
+	if err := s.save(run); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to save run %s: %v", id, err), logger.LogWarning)
+	}
+	if done, ok := s.active[id]; ok {
+		close(done)
+		delete(s.active, id)
+	}
+	s.running--
+	s.dispatch()
+}
+
+// save writes a run to its file. The caller holds the lock.
+func (s *runStore) save(run *Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	path := filepath.Join(s.dir, "runs", run.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// validate checks a run request names its recipes one way, has a known
+// priority and only passes flags
+func (r *RunRequest) validate() error {
+	switch {
+	case !validPriority(r.Priority):
+		return fmt.Errorf("unknown priority %q, expected %s, %s or %s", r.Priority, PriorityLow, PriorityNormal, PriorityHigh)
+	case len(r.Recipes) > 0 && r.RecipeList != "":
+		return fmt.Errorf("recipes and recipe_list can't be combined")
+	case len(r.Recipes) == 0 && r.RecipeList == "":
+		return fmt.Errorf("recipes or recipe_list is required")
+	}
+	if r.RecipeList != "" {
+		if _, err := os.Stat(r.RecipeList); err != nil {
+			return fmt.Errorf("recipe list %s not found on the server", r.RecipeList)
+		}
+	}
+	for _, arg := range r.Args {
+		if err := checkRunArg(arg); err != nil {
+			return fmt.Errorf("invalid run argument %q: %w", arg, err)
+		}
+	}
+	return nil
+}
+
+// reservedRunFlags are the flags runArgs sets, and --state-dir, which picks
+// where the run record the server reads is written. Requests and triggers
+// can't override them.
+var reservedRunFlags = []string{"--run-id", "--report", "--output", "--wait", "--lock-timeout", "--recipes", "--recipe-list", "--state-dir"}
+
+// checkRunArg checks a further run argument is a --flag or --flag=value the server doesn't set itself
+func checkRunArg(arg string) error {
+	if !strings.HasPrefix(arg, "--") {
+		return fmt.Errorf("only --flag or --flag=value arguments are accepted")
+	}
+	name, _, _ := strings.Cut(arg, "=")
+	for _, reserved := range reservedRunFlags {
+		if name == reserved {
+			return fmt.Errorf("%s is set by the server", reserved)
+		}
+	}
+	return nil
+}
+
+// key identifies what a request runs, regardless of recipe order and
+// priority, to find duplicates
+func (r *RunRequest) key() string {
+	recipes := append([]string{}, r.Recipes...)
+	sort.Strings(recipes)
+	return strings.Join(recipes, ",") + "|" + r.RecipeList + "|" + strings.Join(r.Args, " ")
+}
+
+// runArgs returns the autopkgctl arguments of a run: the global flags, then
+// the run command with the run ID, report and recipes. Runs wait for the run
+// lock, so runs on the same preferences go one after the other.
+func runArgs(config *Config, run *Run) []string {
+	args := append([]string{}, config.GlobalArgs...)
+	args = append(args, "--output", "json", "run", "--run-id", run.ID, "--report", run.ReportPath, "--wait")
+	if len(run.Request.Recipes) > 0 {
+		args = append(args, "--recipes", strings.Join(run.Request.Recipes, ","))
+	} else {
+		args = append(args, "--recipe-list", run.Request.RecipeList)
+	}
+	return append(args, run.Request.Args...)
+}
+
+// execute runs autopkgctl for a started run and records how it ended. Logs go
+// to the run's log file, and the result document it prints is kept with the run.
+func (s *runStore) execute(run *Run) {
+	fail := func(err error) {
+		s.finish(run.ID, func(run *Run) {
+			run.Status = StatusFailed
+			run.Error = err.Error()
+			run.ExitCode = -1
+		})
+		logger.Logger(fmt.Sprintf("❌ Run %s failed to start: %v", run.ID, err), logger.LogError)
+	}
+
+	logFile, err := os.Create(run.LogPath)
+	if err != nil {
+		fail(fmt.Errorf("failed to create run log: %w", err))
+		return
+	}
+	defer logFile.Close()
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(s.config.Executable, runArgs(s.config, run)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		fail(fmt.Errorf("failed to start autopkgctl: %w", err))
+		return
+	}
+	logger.Logger(fmt.Sprintf("🚀 Run %s started", run.ID), logger.LogInfo)
+
+	waitErr := cmd.Wait()
+	s.finish(run.ID, func(run *Run) {
+		run.ExitCode = cmd.ProcessState.ExitCode()
+		if json.Valid(stdout.Bytes()) {
+			run.Result = json.RawMessage(bytes.TrimSpace(stdout.Bytes()))
+		}
+		run.Status = StatusSucceeded
+		if waitErr != nil {
+			run.Status = StatusFailed
+			run.Error = waitErr.Error()
+		}
+	})
+	logger.Logger(fmt.Sprintf("🏁 Run %s finished with exit code %d", run.ID, cmd.ProcessState.ExitCode()), logger.LogInfo)
+}
+
+// now returns the current time for a run's timestamps
+func now() *time.Time {
+	t := time.Now().UTC()
+	return &t
+}
+
+// resume starts the runs queued before the server last stopped
+func (s *runStore) resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = false
+	s.dispatch()
+}
+
+// stop starts no more queued runs and blocks until the running ones have finished
+func (s *runStore) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.wg.Wait()
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// logPollInterval is how often a followed log is checked for new output
+const logPollInterval = 500 * time.Millisecond
+
+// maxRequestBody limits the size of request bodies
+const maxRequestBody = 1 << 20
+
+// Server serves the autopkgctl HTTP API:
+//
+//	GET  /api/v1/health                  liveness, without a token
+//	POST /api/v1/runs                    start a run from a RunRequest
+//	GET  /api/v1/runs                    runs started by the server, newest first
+//	GET  /api/v1/runs/{id}               a run, with its run record once written
+//	GET  /api/v1/runs/{id}/logs          the run's log, ?follow=true streams it until the run ends
+//	GET  /api/v1/runs/{id}/report        the run's report plist
+//	GET  /api/v1/queue                   running runs and queued runs in the order they start
+//	GET  /api/v1/history                 run records of every run, ?since=168h
+//	POST /api/v1/webhooks/{trigger}      a webhook delivery to a configured Trigger
+//
+// Webhooks are verified with their trigger's signing secret instead. Every
+// other endpoint needs an Authorization: Bearer header with one of the
+// configured tokens.
+type Server struct {
+	config *Config
+	runs   *runStore
+}
+
+// runStatus is a run together with its run record, once the run wrote one
+type runStatus struct {
+	*Run
+	Record *autopkg.RunRecord `json:"record,omitempty"`
+}
+
+// New creates a server, loading the runs of earlier server processes
+func New(config *Config) (*Server, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if env := os.Getenv(TokensEnvVar); env != "" {
+		for _, token := range strings.Split(env, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				config.Tokens = append(config.Tokens, token)
+			}
+		}
+	}
+	if len(config.Tokens) == 0 {
+		return nil, fmt.Errorf("an API token is required, configure one or set %s", TokensEnvVar)
+	}
+	if config.Addr == "" {
+		config.Addr = DefaultAddr
+	}
+	if config.Executable == "" {
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the autopkgctl executable: %w", err)
+		}
+		config.Executable = executable
+	}
+
+	runs, err := newRunStore(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{config: config, runs: runs}, nil
+}
+
+// Handler returns the API's HTTP handler
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.Handle("POST /api/v1/runs", s.authenticate(s.handleCreateRun))
+	mux.Handle("GET /api/v1/runs", s.authenticate(s.handleListRuns))
+	mux.Handle("GET /api/v1/runs/{id}", s.authenticate(s.handleGetRun))
+	mux.Handle("GET /api/v1/runs/{id}/logs", s.authenticate(s.handleRunLogs))
+	mux.Handle("GET /api/v1/runs/{id}/report", s.authenticate(s.handleRunReport))
+	mux.Handle("GET /api/v1/queue", s.authenticate(s.handleQueue))
+	mux.Handle("GET /api/v1/history", s.authenticate(s.handleHistory))
+	mux.HandleFunc("POST /api/v1/webhooks/{trigger}", s.handleWebhook)
+	return mux
+}
+
+// ListenAndServe serves the API until the context is cancelled, then stops
+// accepting requests and waits for the runs it started to finish
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	httpServer := &http.Server{
+		Addr:              s.config.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	s.runs.resume()
+	errs := make(chan error, 1)
+	go func() {
+		logger.Logger(fmt.Sprintf("🌐 autopkgctl API listening on %s", s.config.Addr), logger.LogInfo)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("API server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	logger.Logger("🛑 Shutting down, waiting for running runs to finish; queued runs start on the next start", logger.LogInfo)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := httpServer.Shutdown(shutdownCtx)
+	s.runs.stop()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down API server: %w", err)
+	}
+	return nil
+}
+
+// authenticate requires a configured bearer token
+func (s *Server) authenticate(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok {
+			for _, configured := range s.config.Tokens {
+				if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(configured)) == 1 {
+					next(w, r)
+					return
+				}
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="autopkgctl"`)
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("a valid bearer token is required"))
+	})
+}
+
+// handleCreateRun queues a run and answers with it, or with the queued run
+// it duplicates
+func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	var request RunRequest
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid run request: %w", err))
+		return
+	}
+	if err := request.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	run, duplicate, err := s.runs.enqueue(request, TriggerAPI, "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/runs/"+run.ID)
+	if duplicate {
+		writeJSON(w, http.StatusOK, run)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// handleListRuns lists the runs started by the server
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.runs.list())
+}
+
+// handleGetRun answers with a run and its run record
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run := s.lookupRun(w, r)
+	if run == nil {
+		return
+	}
+	status := runStatus{Run: run}
+	if run.Finished() {
+		if record, err := autopkg.LoadRunRecord(s.config.StateDir, run.ID); err == nil {
+			status.Record = record
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleRunLogs writes a run's log, and with follow, keeps writing what the
+// run logs until it finishes
+func (s *Server) handleRunLogs(w http.ResponseWriter, r *http.Request) {
+	run := s.lookupRun(w, r)
+	if run == nil {
+		return
+	}
+	follow := r.URL.Query().Get("follow") == "true" || r.URL.Query().Get("follow") == "1"
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := w.(http.Flusher)
+
+	// The log file is only created once the run starts
+	done := s.runs.done(run.ID)
+	logFile, err := os.Open(run.LogPath)
+	for os.IsNotExist(err) && follow && done != nil {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-done:
+			done = nil
+		case <-time.After(logPollInterval):
+		}
+		logFile, err = os.Open(run.LogPath)
+	}
+	if os.IsNotExist(err) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to open run log: %w", err))
+		return
+	}
+	defer logFile.Close()
+
+	for {
+		if _, err := io.Copy(w, logFile); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !follow || done == nil {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-done:
+			// Write what the run logged after the last read, then stop
+			done = nil
+		case <-time.After(logPollInterval):
+		}
+	}
+}
+
+// handleRunReport serves a run's report plist
+func (s *Server) handleRunReport(w http.ResponseWriter, r *http.Request) {
+	run := s.lookupRun(w, r)
+	if run == nil {
+		return
+	}
+	if _, err := os.Stat(run.ReportPath); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s has no report", run.ID))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-plist")
+	http.ServeFile(w, r, run.ReportPath)
+}
+
+// handleQueue answers with the state of the run queue
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.runs.queue())
+}
+
+// handleHistory lists the run records of every run, whether the server started it or not
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid since %q: %w", value, err))
+			return
+		}
+		since = time.Now().Add(-duration)
+	}
+	records, err := autopkg.ListRunRecords(s.config.StateDir, since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// lookupRun returns the run named in the path, answering 404 when there is none
+func (s *Server) lookupRun(w http.ResponseWriter, r *http.Request) *Run {
+	id := r.PathValue("id")
+	var run *Run
+	// A run ID in a URL mustn't escape the runs directory
+	if autopkg.ValidateRunID(id) == nil {
+		run = s.runs.get(id)
+	}
+	if run == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", id))
+	}
+	return run
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Failed to write API response: %v", err), logger.LogWarning)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,349 @@
+package server
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"gopkg.in/yaml.v2"
+)
+
+// TriggerAPI is the trigger of runs started through POST /api/v1/runs
+const TriggerAPI = "api"
+
+// Webhook trigger sources
+const (
+	SourceGitHub  = "github"  // GitHub push events, e.g. to the overrides repo
+	SourceRelease = "release" // Generic "app released" events: {"app": "Firefox", "version": "128.0"}
+)
+
+// GitHub webhook headers
+const (
+	GitHubEventHeader     = "X-GitHub-Event"
+	GitHubDeliveryHeader  = "X-GitHub-Delivery"
+	GitHubSignatureHeader = "X-Hub-Signature-256" // "sha256=" + hex HMAC-SHA256 of the body
+)
+
+// AppPlaceholder in a release trigger's recipes is replaced with the released app
+const AppPlaceholder = "{app}"
+
+// triggerNamePattern is what a trigger name must look like, as it's part of the webhook URL
+var triggerNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// recipeExtensions are the file extensions of recipes and overrides, longest first
+var recipeExtensions = []string{".recipe.plist", ".recipe.yaml", ".recipe"}
+
+// Trigger maps the webhooks posted to /api/v1/webhooks/{name} to the recipes
+// they run. GitHub triggers filter pushes by branch and changed paths, and can
+// run just the recipes whose files changed; release triggers filter by app.
+type Trigger struct {
+	Name           string   `yaml:"name"`
+	Source         string   `yaml:"source"`                    // github or release
+	Secret         string   `yaml:"secret,omitempty"`          // HMAC secret deliveries are signed with
+	SecretEnv      string   `yaml:"secret_env,omitempty"`      // Environment variable holding the secret, keeps it out of the file
+	Branches       []string `yaml:"branches,omitempty"`        // github: branch globs to act on, empty acts on every branch
+	Paths          []string `yaml:"paths,omitempty"`           // github: globs of changed files to act on, matched against the path or file name
+	ChangedRecipes bool     `yaml:"changed_recipes,omitempty"` // github: run the recipes and overrides the push added or modified
+	Apps           []string `yaml:"apps,omitempty"`            // release: app globs to act on, empty acts on every app
+	Recipes        []string `yaml:"recipes,omitempty"`         // Recipes to run, {app} is replaced with a released app
+	RecipeList     string   `yaml:"recipe_list,omitempty"`     // Recipe list file to run instead
+	Args           []string `yaml:"args,omitempty"`            // Further autopkgctl run flags
+	Priority       string   `yaml:"priority,omitempty"`        // low, normal or high, defaults to normal
+}
+
+// gitHubPush is the part of a GitHub push event payload triggers look at
+type gitHubPush struct {
+	Ref     string `json:"ref"`
+	Deleted bool   `json:"deleted"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+}
+
+// releaseEvent is the payload of a release trigger
+type releaseEvent struct {
+	App     string `json:"app"`
+	Version string `json:"version,omitempty"`
+}
+
+// LoadTriggers reads webhook triggers from a YAML file containing a list of triggers
+func LoadTriggers(path string) ([]Trigger, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read triggers file: %w", err)
+	}
+
+	var triggers []Trigger
+	if err := yaml.Unmarshal(data, &triggers); err != nil {
+		return nil, fmt.Errorf("failed to parse triggers file: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for _, trigger := range triggers {
+		if err := trigger.validate(); err != nil {
+			return nil, err
+		}
+		if names[trigger.Name] {
+			return nil, fmt.Errorf("duplicate trigger %s", trigger.Name)
+		}
+		names[trigger.Name] = true
+	}
+
+	return triggers, nil
+}
+
+// validate checks a trigger can be posted to and knows what to run
+func (t Trigger) validate() error {
+	if !triggerNamePattern.MatchString(t.Name) {
+		return fmt.Errorf("invalid trigger name %q: use letters, digits, '.', '_' and '-'", t.Name)
+	}
+	if t.Source != SourceGitHub && t.Source != SourceRelease {
+		return fmt.Errorf("unknown source %q for trigger %s, expected %s or %s", t.Source, t.Name, SourceGitHub, SourceRelease)
+	}
+	if t.secret() == "" {
+		return fmt.Errorf("trigger %s has no secret, set secret or secret_env", t.Name)
+	}
+	if t.ChangedRecipes && t.Source != SourceGitHub {
+		return fmt.Errorf("trigger %s: changed_recipes needs the %s source", t.Name, SourceGitHub)
+	}
+
+	ways := 0
+	for _, set := range []bool{len(t.Recipes) > 0, t.RecipeList != "", t.ChangedRecipes} {
+		if set {
+			ways++
+		}
+	}
+	if ways != 1 {
+		return fmt.Errorf("trigger %s needs exactly one of recipes, recipe_list or changed_recipes", t.Name)
+	}
+	if !validPriority(t.Priority) {
+		return fmt.Errorf("unknown priority %q for trigger %s, expected %s, %s or %s", t.Priority, t.Name, PriorityLow, PriorityNormal, PriorityHigh)
+	}
+	for _, arg := range t.Args {
+		if err := checkRunArg(arg); err != nil {
+			return fmt.Errorf("invalid argument %q for trigger %s: %w", arg, t.Name, err)
+		}
+	}
+	return nil
+}
+
+// secret returns the signing secret, preferring the environment variable
+func (t Trigger) secret() string {
+	if t.SecretEnv != "" {
+		if value := os.Getenv(t.SecretEnv); value != "" {
+			return value
+		}
+	}
+	return t.Secret
+}
+
+// verify checks a delivery was signed with the trigger's secret
+func (t Trigger) verify(header http.Header, body []byte) bool {
+	signatureHeader := autopkg.WebhookSignatureHeader
+	if t.Source == SourceGitHub {
+		signatureHeader = GitHubSignatureHeader
+	}
+	signature := header.Get(signatureHeader)
+	expected := autopkg.SignWebhookPayload(t.secret(), body)
+	return signature != "" && hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// request returns the run a delivery asks for, with the delivery ID used to
+// drop redeliveries. It returns a nil request and the reason when the
+// trigger's filters leave nothing to run.
+func (t Trigger) request(header http.Header, body []byte) (request *RunRequest, delivery string, reason string, err error) {
+	switch t.Source {
+	case SourceGitHub:
+		return t.gitHubRequest(header, body)
+	default:
+		return t.releaseRequest(header, body)
+	}
+}
+
+// gitHubRequest maps a GitHub push to a run
+func (t Trigger) gitHubRequest(header http.Header, body []byte) (*RunRequest, string, string, error) {
+	delivery := header.Get(GitHubDeliveryHeader)
+	if event := header.Get(GitHubEventHeader); event != "push" {
+		return nil, delivery, fmt.Sprintf("%q events aren't acted on", event), nil
+	}
+
+	var push gitHubPush
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, delivery, "", fmt.Errorf("invalid push payload: %w", err)
+	}
+	branch, ok := strings.CutPrefix(push.Ref, "refs/heads/")
+	switch {
+	case !ok:
+		return nil, delivery, fmt.Sprintf("%s isn't a branch", push.Ref), nil
+	case push.Deleted:
+		return nil, delivery, fmt.Sprintf("branch %s was deleted", branch), nil
+	case len(t.Branches) > 0 && !matchAny(t.Branches, branch):
+		return nil, delivery, fmt.Sprintf("branch %s doesn't match the trigger", branch), nil
+	}
+
+	// Files the push changed, and those it added or modified, that the paths match
+	var changed, current []string
+	matches := func(file string) bool {
+		return len(t.Paths) == 0 || matchAny(t.Paths, file) || matchAny(t.Paths, path.Base(file))
+	}
+	for _, commit := range push.Commits {
+		for _, file := range append(append([]string{}, commit.Added...), commit.Modified...) {
+			if matches(file) {
+				changed = append(changed, file)
+				current = append(current, file)
+			}
+		}
+		for _, file := range commit.Removed {
+			if matches(file) {
+				changed = append(changed, file)
+			}
+		}
+	}
+	if len(changed) == 0 {
+		return nil, delivery, "no changed files match the trigger", nil
+	}
+
+	request := &RunRequest{Recipes: t.Recipes, RecipeList: t.RecipeList, Args: t.Args, Priority: t.Priority}
+	if t.ChangedRecipes {
+		request.Recipes = changedRecipes(current)
+		if len(request.Recipes) == 0 {
+			return nil, delivery, "no recipes were added or modified", nil
+		}
+	}
+	return request, delivery, "", nil
+}
+
+// releaseRequest maps an app release to a run
+func (t Trigger) releaseRequest(header http.Header, body []byte) (*RunRequest, string, string, error) {
+	var event releaseEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, "", "", fmt.Errorf("invalid release payload: %w", err)
+	}
+	if event.App == "" {
+		return nil, "", "", fmt.Errorf("invalid release payload: app is required")
+	}
+	// The app becomes part of recipe names joined into the run's --recipes
+	if !validAppName(event.App) {
+		return nil, "", "", fmt.Errorf("invalid release payload: app %q must be a plain name without commas, slashes, .. or whitespace", event.App)
+	}
+
+	// Without a delivery ID, the same release announced twice is one delivery
+	delivery := header.Get(autopkg.WebhookDeliveryHeader)
+	if delivery == "" && event.Version != "" {
+		delivery = event.App + "@" + event.Version
+	}
+	if len(t.Apps) > 0 && !matchAny(t.Apps, event.App) {
+		return nil, delivery, fmt.Sprintf("app %s doesn't match the trigger", event.App), nil
+	}
+
+	request := &RunRequest{RecipeList: t.RecipeList, Args: t.Args, Priority: t.Priority}
+	for _, recipe := range t.Recipes {
+		request.Recipes = append(request.Recipes, strings.ReplaceAll(recipe, AppPlaceholder, event.App))
+	}
+	return request, delivery, "", nil
+}
+
+// changedRecipes returns the recipe names of the recipe and override files among paths
+func changedRecipes(paths []string) []string {
+	seen := make(map[string]bool)
+	var recipes []string
+	for _, file := range paths {
+		name := path.Base(file)
+		for _, extension := range recipeExtensions {
+			if recipe, ok := strings.CutSuffix(name, extension); ok && validAppName(recipe) {
+				if !seen[recipe] {
+					seen[recipe] = true
+					recipes = append(recipes, recipe)
+				}
+				break
+			}
+		}
+	}
+	sort.Strings(recipes)
+	return recipes
+}
+
+// validAppName reports whether a name from a webhook payload can go into a
+// recipe name: no commas separating recipes, path segments or whitespace
+func validAppName(name string) bool {
+	if name == "" || strings.Contains(name, "..") || strings.ContainsAny(name, ",/\\") {
+		return false
+	}
+	return !strings.ContainsFunc(name, unicode.IsSpace)
+}
+
+// matchAny reports whether a name matches one of the globs
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWebhook verifies a delivery to a trigger and queues the run it maps to
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	var trigger *Trigger
+	for i := range s.config.Triggers {
+		if s.config.Triggers[i].Name == r.PathValue("trigger") {
+			trigger = &s.config.Triggers[i]
+			break
+		}
+	}
+	if trigger == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("trigger %s not found", r.PathValue("trigger")))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read delivery: %w", err))
+		return
+	}
+	if !trigger.verify(r.Header, body) {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid signature"))
+		return
+	}
+	if trigger.Source == SourceGitHub && r.Header.Get(GitHubEventHeader) == "ping" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "pong"})
+		return
+	}
+
+	request, delivery, reason, err := trigger.request(r.Header, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request == nil {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "ignored", "reason": reason})
+		return
+	}
+	if err := request.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	run, duplicate, err := s.runs.enqueue(*request, trigger.Name, delivery)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/runs/"+run.ID)
+	if duplicate {
+		writeJSON(w, http.StatusOK, run)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
@@ -1,10 +1,15 @@
 package suspiciouspackage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -12,80 +17,139 @@ import (
 	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
 )
 
+// DefaultDownloadURL is the vendor's disk image of the latest Suspicious Package
+const DefaultDownloadURL = "https://mothersruin.com/software/downloads/SuspiciousPackage.dmg"
+
+// appName is the name of the Suspicious Package app bundle
+const appName = "Suspicious Package.app"
+
 // Config holds all the configuration options for AutoPkg setup operations
 type Config struct {
 	ForceUpdate bool
+	Version     string // Version to require, e.g. 4.5; an installed app of another version is replaced. Any version when empty
+	DownloadURL string // Disk image to install from, defaults to DefaultDownloadURL, which only serves the latest version
+	SHA256      string // Published SHA256 of the disk image; the install fails when the download doesn't match
+	SHA256URL   string // URL publishing the SHA256 of the disk image, used when SHA256 is empty
+	InstallDir  string // Directory the app is installed to, defaults to /Applications, or ~/Applications with UserSpace
+	UserSpace   bool   // Install to ~/Applications, for runners without sudo
+}
+
+// Installation is the Suspicious Package app the scanner uses
+type Installation struct {
+	Version   string `json:"version"`
+	AppPath   string `json:"appPath"`
+	CLIPath   string `json:"cliPath,omitempty"` // spkg command line tool in the app, empty when the version has none
+	Installed bool   `json:"installed"`         // Whether the app was installed now rather than found
 }
 
+// sha256Pattern finds a hex SHA256 in a published checksum file
+var sha256Pattern = regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`)
+
 // InstallSuspiciousPackage checks for the presence of Suspicious Package,
 // and if it's not installed (or forced update is requested), downloads and installs it.
 func InstallSuspiciousPackage(config *Config) (string, error) {
-	// Define the expected path of the Suspicious Package application
-	appPath := "/Applications/Suspicious Package.app"
+	installation, err := SetupSuspiciousPackage(config)
+	if err != nil {
+		return "", err
+	}
+	return installation.Version, nil
+}
 
-	// Only install if not present or forced update requested
+// SetupSuspiciousPackage makes sure Suspicious Package is installed in the
+// configured location, at the pinned version when there is one, downloading
+// and installing it if needed. The download is verified against the published
+// checksum before anything is installed.
+func SetupSuspiciousPackage(config *Config) (*Installation, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	installDir, err := config.installDir()
+	if err != nil {
+		return nil, err
+	}
+	appPath := filepath.Join(installDir, appName)
+
+	// Only install if not present, of another version than pinned, or forced update requested
 	if _, err := os.Stat(appPath); err == nil && !config.ForceUpdate {
-		// Try to get the version
-		version := "installed"
-		cmdVersion := exec.Command("defaults", "read", appPath+"/Contents/Info", "CFBundleShortVersionString")
-		if versionBytes, err := cmdVersion.Output(); err == nil {
-			version = strings.TrimSpace(string(versionBytes))
+		version := bundleVersion(appPath)
+		if config.Version == "" || version == config.Version {
+			logger.Logger(fmt.Sprintf("Suspicious Package %s is already installed.", version), logger.LogInfo)
+			return newInstallation(appPath, version, false), nil
 		}
-
-		logger.Logger(fmt.Sprintf("Suspicious Package %s is already installed.", version), logger.LogInfo)
-		return version, nil
+		logger.Logger(fmt.Sprintf("Suspicious Package %s is installed but %s is pinned, replacing it", version, config.Version), logger.LogInfo)
 	}
 
 	logger.Logger("⬇️ Downloading Suspicious Package", logger.LogInfo)
 
-	// Define the download URL and temporary DMG path
-	dmgURL := "https://mothersruin.com/software/downloads/SuspiciousPackage.dmg"
-	dmgPath := "/tmp/SuspiciousPackage.dmg"
+	dmgURL := config.DownloadURL
+	if dmgURL == "" {
+		dmgURL = DefaultDownloadURL
+	}
+	dmgFile, err := os.CreateTemp("", "SuspiciousPackage-*.dmg")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download file: %w", err)
+	}
+	dmgPath := dmgFile.Name()
+	dmgFile.Close()
+	defer os.Remove(dmgPath)
 
 	// Download the DMG file
 	if err := helpers.DownloadFile(dmgURL, dmgPath); err != nil {
-		return "", fmt.Errorf("failed to download Suspicious Package: %w", err)
+		return nil, fmt.Errorf("failed to download Suspicious Package: %w", err)
+	}
+	if err := config.verifyChecksum(dmgPath); err != nil {
+		return nil, err
 	}
 
-	// Mount the DMG using hdiutil.
-	// We use a fixed mount point for simplicity.
-	mountPoint := "/Volumes/SuspiciousPackage"
+	// Mount the DMG using hdiutil at a mount point of its own
+	mountPoint, err := os.MkdirTemp("", "SuspiciousPackage-mount-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mount point: %w", err)
+	}
+	defer os.Remove(mountPoint)
 	cmdMount := exec.Command("hdiutil", "attach", dmgPath, "-mountpoint", mountPoint, "-nobrowse", "-quiet")
 	if err := cmdMount.Run(); err != nil {
-		return "", fmt.Errorf("failed to mount DMG: %w", err)
+		return nil, fmt.Errorf("failed to mount DMG: %w", err)
 	}
+	detach := func() error { return exec.Command("hdiutil", "detach", mountPoint, "-quiet").Run() }
 
-	// The DMG is expected to contain "Suspicious Package.app".
-	sourceAppPath := filepath.Join(mountPoint, "Suspicious Package.app")
+	// The DMG is expected to contain "Suspicious Package.app"
+	sourceAppPath := filepath.Join(mountPoint, appName)
 	if _, err := os.Stat(sourceAppPath); os.IsNotExist(err) {
-		// Unmount if the app is not found
-		_ = exec.Command("hdiutil", "detach", mountPoint, "-quiet").Run()
-		return "", fmt.Errorf("Suspicious Package.app not found in the mounted DMG")
+		_ = detach()
+		return nil, fmt.Errorf("Suspicious Package.app not found in the mounted DMG")
+	}
+	if version := bundleVersion(sourceAppPath); config.Version != "" && version != config.Version {
+		_ = detach()
+		return nil, fmt.Errorf("downloaded Suspicious Package is %s, not the pinned %s; point DownloadURL at a copy of %s", version, config.Version, config.Version)
 	}
 
-	// Copy the Suspicious Package app to /Applications
-	cmdCopy := exec.Command("cp", "-R", sourceAppPath, "/Applications/")
+	// Replace any installed copy with the one from the DMG
+	if err := os.MkdirAll(installDir, 0755); err != nil {
+		_ = detach()
+		return nil, fmt.Errorf("failed to create install directory: %w", err)
+	}
+	if err := os.RemoveAll(appPath); err != nil {
+		_ = detach()
+		return nil, fmt.Errorf("failed to remove installed Suspicious Package: %w", err)
+	}
+	cmdCopy := exec.Command("ditto", sourceAppPath, appPath)
 	output, err := cmdCopy.CombinedOutput()
 	if err != nil {
-		// Unmount the DMG on error
-		_ = exec.Command("hdiutil", "detach", mountPoint, "-quiet").Run()
-		return "", fmt.Errorf("failed to copy Suspicious Package: %w; output: %s", err, string(output))
+		_ = detach()
+		return nil, fmt.Errorf("failed to copy Suspicious Package: %w; output: %s", err, string(output))
 	}
 
 	// Unmount the DMG
-	if err := exec.Command("hdiutil", "detach", mountPoint, "-quiet").Run(); err != nil {
-		return "", fmt.Errorf("failed to unmount DMG: %w", err)
+	if err := detach(); err != nil {
+		return nil, fmt.Errorf("failed to unmount DMG: %w", err)
 	}
 
-	// Get the installed version
-	version := "installed"
-	cmdVersion := exec.Command("defaults", "read", appPath+"/Contents/Info", "CFBundleShortVersionString")
-	if versionBytes, err := cmdVersion.Output(); err == nil {
-		version = strings.TrimSpace(string(versionBytes))
-	}
+	version := bundleVersion(appPath)
 
-	// Open and then close the application to ensure it's registered with the system
-	cmdOpen := exec.Command("open", "-a", "Suspicious Package")
+	// Open and then close the application to ensure it's registered with the
+	// system, which lets AppleScript find it outside /Applications too
+	cmdOpen := exec.Command("open", appPath)
 	if err := cmdOpen.Run(); err != nil {
 		logger.Logger(fmt.Sprintf("Warning: Failed to open Suspicious Package: %v", err), logger.LogWarning)
 	}
@@ -102,6 +166,100 @@ func InstallSuspiciousPackage(config *Config) (string, error) {
 	// Wait a moment for the app to fully close
 	time.Sleep(1 * time.Second)
 
-	logger.Logger(fmt.Sprintf("✅ Suspicious Package %s installed", version), logger.LogSuccess)
-	return version, nil
+	installation := newInstallation(appPath, version, true)
+	logger.Logger(fmt.Sprintf("✅ Suspicious Package %s installed to %s", version, appPath), logger.LogSuccess)
+	if installation.CLIPath != "" {
+		logger.Logger(fmt.Sprintf("🔧 Suspicious Package command line tool: %s", installation.CLIPath), logger.LogInfo)
+	}
+	return installation, nil
+}
+
+// installDir returns the directory the app is installed to
+func (c *Config) installDir() (string, error) {
+	if c.InstallDir != "" {
+		return c.InstallDir, nil
+	}
+	if !c.UserSpace {
+		return "/Applications", nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory for a user-space install: %w", err)
+	}
+	return filepath.Join(home, "Applications"), nil
+}
+
+// verifyChecksum compares the SHA256 of the downloaded disk image with the
+// published one, when there is one
+func (c *Config) verifyChecksum(dmgPath string) error {
+	expected := c.SHA256
+	if expected == "" && c.SHA256URL != "" {
+		published, err := fetchPublishedSHA256(c.SHA256URL)
+		if err != nil {
+			return err
+		}
+		expected = published
+	}
+	if expected == "" {
+		logger.Logger("⚠️ No published checksum to verify the Suspicious Package download against", logger.LogWarning)
+		return nil
+	}
+
+	file, err := os.Open(dmgPath)
+	if err != nil {
+		return fmt.Errorf("failed to open download: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return fmt.Errorf("failed to hash download: %w", err)
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		return fmt.Errorf("Suspicious Package download has SHA256 %s, expected %s", actual, expected)
+	}
+	logger.Logger("🔐 Suspicious Package download matches its published checksum", logger.LogInfo)
+	return nil
+}
+
+// fetchPublishedSHA256 reads the first SHA256 in a published checksum file
+func fetchPublishedSHA256(url string) (string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch published checksum: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("published checksum returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return "", fmt.Errorf("failed to read published checksum: %w", err)
+	}
+	checksum := sha256Pattern.FindString(string(body))
+	if checksum == "" {
+		return "", fmt.Errorf("no SHA256 found at %s", url)
+	}
+	return checksum, nil
+}
+
+// newInstallation describes the app at a path
+func newInstallation(appPath, version string, installed bool) *Installation {
+	installation := &Installation{Version: version, AppPath: appPath, Installed: installed}
+	if cliPath := filepath.Join(appPath, "Contents", "SharedSupport", "spkg"); helpers.FileExists(cliPath) {
+		installation.CLIPath = cliPath
+	}
+	return installation
+}
+
+// bundleVersion reads the short version of an app bundle
+func bundleVersion(appPath string) string {
+	version := "installed"
+	cmdVersion := exec.Command("defaults", "read", filepath.Join(appPath, "Contents", "Info"), "CFBundleShortVersionString")
+	if versionBytes, err := cmdVersion.Output(); err == nil {
+		version = strings.TrimSpace(string(versionBytes))
+	}
+	return version
 }
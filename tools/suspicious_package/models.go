@@ -110,3 +110,51 @@ type SandboxedApp struct {
 	ClientNetwork bool   `json:"clientNetwork"`
 	ServerNetwork bool   `json:"serverNetwork"`
 }
+
+// PayloadInspection lists what a package installs that runs with privileges
+// or needs an MDM profile to work without prompting users
+type PayloadInspection struct {
+	EntitledBundles  []EntitledBundle    `json:"entitledBundles,omitempty"`
+	LaunchItems      []PayloadLaunchItem `json:"launchItems,omitempty"`
+	KernelExtensions []ExtensionBundle   `json:"kernelExtensions,omitempty"`
+	SystemExtensions []ExtensionBundle   `json:"systemExtensions,omitempty"`
+	PrivacyNeeds     []PrivacyNeed       `json:"privacyNeeds,omitempty"`
+	Findings         []PackageIssue      `json:"findings,omitempty"` // Unusual items, and items new since the previous scan
+}
+
+// EntitledBundle represents an app, extension or helper bundle and the entitlements it's signed with
+type EntitledBundle struct {
+	Name         string   `json:"name"`
+	Path         string   `json:"path"`
+	BundleID     string   `json:"bundleID,omitempty"`
+	Entitlements []string `json:"entitlements"`
+}
+
+// PayloadLaunchItem represents a launchd daemon, agent or login item the package installs
+type PayloadLaunchItem struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Kind      string `json:"kind"` // "daemon", "agent" or "login item"
+	Label     string `json:"label,omitempty"`
+	Program   string `json:"program,omitempty"`
+	RunAtLoad bool   `json:"runAtLoad"`
+	KeepAlive bool   `json:"keepAlive"`
+}
+
+// ExtensionBundle represents a kernel or system extension the package installs
+type ExtensionBundle struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	BundleID string `json:"bundleID,omitempty"`
+	Version  string `json:"version,omitempty"`
+}
+
+// PrivacyNeed represents a privacy permission or approval a component needs,
+// and the MDM payload that grants it without prompting the user
+type PrivacyNeed struct {
+	Path     string `json:"path"`
+	BundleID string `json:"bundleID,omitempty"`
+	Service  string `json:"service"` // TCC service, or what the payload approves
+	Payload  string `json:"payload"` // MDM payload type granting it
+	Source   string `json:"source"`  // Info.plist key or entitlement that revealed it
+}
@@ -0,0 +1,390 @@
+package suspiciouspackage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/sbom"
+	"howett.net/plist"
+)
+
+// MDM payload types granting what a package's components need
+const (
+	payloadPPPC              = "com.apple.TCC.configuration-profile-policy"
+	payloadSystemExtension   = "com.apple.system-extension-policy"
+	payloadKernelExtension   = "com.apple.syspolicy.kernel-extension-policy"
+	payloadServiceManagement = "com.apple.servicemanagement"
+	payloadContentFilter     = "com.apple.webcontent-filter"
+)
+
+// usageDescriptionServices maps the usage descriptions an app declares in its
+// Info.plist to the TCC services it prompts for. Camera, microphone and
+// screen recording can only be denied by a PPPC profile, not allowed.
+var usageDescriptionServices = map[string]string{
+	"NSAppleEventsUsageDescription":          "AppleEvents",
+	"NSCameraUsageDescription":               "Camera",
+	"NSMicrophoneUsageDescription":           "Microphone",
+	"NSContactsUsageDescription":             "AddressBook",
+	"NSCalendarsUsageDescription":            "Calendar",
+	"NSRemindersUsageDescription":            "Reminders",
+	"NSPhotoLibraryUsageDescription":         "Photos",
+	"NSBluetoothAlwaysUsageDescription":      "BluetoothAlways",
+	"NSSpeechRecognitionUsageDescription":    "SpeechRecognition",
+	"NSDesktopFolderUsageDescription":        "SystemPolicyDesktopFolder",
+	"NSDocumentsFolderUsageDescription":      "SystemPolicyDocumentsFolder",
+	"NSDownloadsFolderUsageDescription":      "SystemPolicyDownloadsFolder",
+	"NSNetworkVolumesUsageDescription":       "SystemPolicyNetworkVolumes",
+	"NSRemovableVolumesUsageDescription":     "SystemPolicyRemovableVolumes",
+	"NSSystemAdministrationUsageDescription": "SystemPolicySysAdminFiles",
+}
+
+// entitlementNeeds maps entitlements to the permission or approval they need
+var entitlementNeeds = map[string]PrivacyNeed{
+	"com.apple.developer.endpoint-security.client":    {Service: "SystemPolicyAllFiles", Payload: payloadPPPC},
+	"com.apple.security.automation.apple-events":      {Service: "AppleEvents", Payload: payloadPPPC},
+	"com.apple.developer.networking.networkextension": {Service: "NetworkExtension", Payload: payloadContentFilter},
+}
+
+// unusualEntitlements are hardened runtime exceptions and debugging
+// entitlements that weaken a signed app, with why they're worth a look
+var unusualEntitlements = map[string]string{
+	"com.apple.security.get-task-allow":                          "lets other processes attach to it, usually a debug build",
+	"com.apple.security.cs.debugger":                             "can debug other processes",
+	"com.apple.security.cs.disable-library-validation":           "loads libraries signed by other teams",
+	"com.apple.security.cs.allow-dyld-environment-variables":     "honours DYLD_ environment variables",
+	"com.apple.security.cs.allow-unsigned-executable-memory":     "runs unsigned executable memory",
+	"com.apple.security.cs.disable-executable-page-protection":   "disables executable memory protection",
+	"com.apple.developer.endpoint-security.client":               "monitors every process and file on the Mac",
+	"com.apple.developer.networking.networkextension":            "can filter or tunnel network traffic",
+	"com.apple.security.temporary-exception.files.absolute-path": "reaches outside its sandbox",
+}
+
+// userWritableDirs are locations any user can write to, where a program
+// launchd runs as root could be replaced
+var userWritableDirs = []string{"/Users/", "/tmp/", "/private/tmp/", "/var/tmp/", "/private/var/tmp/"}
+
+// InspectPayload lists the entitlements of the bundles a package installs,
+// its launch daemons, agents and login items, its kernel and system
+// extensions, and the privacy permissions and approvals they need. Anything
+// unusual is reported in Findings, as is anything not in the previous
+// inspection of the package, when given. Entitlements are read with codesign,
+// so they're only listed on macOS.
+func InspectPayload(packagePath string, previous *PayloadInspection) (*PayloadInspection, error) {
+	logger.Logger(fmt.Sprintf("🔍 Inspecting payload of package: %s", packagePath), logger.LogInfo)
+
+	inspection := &PayloadInspection{}
+	err := sbom.WalkArtifact(packagePath, func(root string) error {
+		return inspectPayloadRoot(root, inspection)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect payload: %w", err)
+	}
+
+	sort.Slice(inspection.EntitledBundles, func(i, j int) bool {
+		return inspection.EntitledBundles[i].Path < inspection.EntitledBundles[j].Path
+	})
+	sort.Slice(inspection.LaunchItems, func(i, j int) bool {
+		return inspection.LaunchItems[i].Path < inspection.LaunchItems[j].Path
+	})
+	sort.Slice(inspection.PrivacyNeeds, func(i, j int) bool {
+		if inspection.PrivacyNeeds[i].Path != inspection.PrivacyNeeds[j].Path {
+			return inspection.PrivacyNeeds[i].Path < inspection.PrivacyNeeds[j].Path
+		}
+		return inspection.PrivacyNeeds[i].Service < inspection.PrivacyNeeds[j].Service
+	})
+
+	inspection.findUnusual()
+	if previous != nil {
+		inspection.findNew(previous)
+	}
+
+	logger.Logger(fmt.Sprintf("🔐 Found %d entitled bundles, %d launch items, %d kernel and %d system extensions, %d privacy needs",
+		len(inspection.EntitledBundles), len(inspection.LaunchItems), len(inspection.KernelExtensions),
+		len(inspection.SystemExtensions), len(inspection.PrivacyNeeds)), logger.LogSuccess)
+	return inspection, nil
+}
+
+// inspectPayloadRoot records the bundles, extensions and launch items under a payload root
+func inspectPayloadRoot(root string, inspection *PayloadInspection) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		installPath := sbom.PayloadPath(root, path)
+
+		if !entry.IsDir() {
+			if strings.HasSuffix(path, ".plist") && launchItemKind(installPath) != "" {
+				inspection.addLaunchItem(path, installPath)
+			}
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".kext":
+			info := readInfoPlist(path)
+			inspection.KernelExtensions = append(inspection.KernelExtensions, extensionBundle(installPath, info))
+			bundleID, _ := info["CFBundleIdentifier"].(string)
+			inspection.PrivacyNeeds = append(inspection.PrivacyNeeds, PrivacyNeed{
+				Path: installPath, BundleID: bundleID, Service: "KernelExtension", Payload: payloadKernelExtension, Source: "kernel extension",
+			})
+		case ".systemextension":
+			info := readInfoPlist(path)
+			inspection.SystemExtensions = append(inspection.SystemExtensions, extensionBundle(installPath, info))
+			bundleID, _ := info["CFBundleIdentifier"].(string)
+			inspection.PrivacyNeeds = append(inspection.PrivacyNeeds, PrivacyNeed{
+				Path: installPath, BundleID: bundleID, Service: "SystemExtension", Payload: payloadSystemExtension, Source: "system extension",
+			})
+			inspection.addBundle(path, installPath, info)
+		case ".app", ".appex", ".xpc", ".plugin", ".bundle":
+			info := readInfoPlist(path)
+			inspection.addBundle(path, installPath, info)
+			if launchItemKind(installPath) == "login item" {
+				bundleID, _ := info["CFBundleIdentifier"].(string)
+				inspection.LaunchItems = append(inspection.LaunchItems, PayloadLaunchItem{
+					Name: filepath.Base(path), Path: installPath, Kind: "login item", Label: bundleID,
+				})
+				inspection.PrivacyNeeds = append(inspection.PrivacyNeeds, PrivacyNeed{
+					Path: installPath, BundleID: bundleID, Service: "BackgroundItems", Payload: payloadServiceManagement, Source: "login item",
+				})
+			}
+		}
+		return nil
+	})
+}
+
+// addBundle records the entitlements of a signed bundle and the privacy
+// permissions its usage descriptions and entitlements ask for
+func (p *PayloadInspection) addBundle(bundlePath string, installPath string, info map[string]interface{}) {
+	bundleID, _ := info["CFBundleIdentifier"].(string)
+
+	var keys []string
+	for key := range info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if service, ok := usageDescriptionServices[key]; ok {
+			p.PrivacyNeeds = append(p.PrivacyNeeds, PrivacyNeed{Path: installPath, BundleID: bundleID, Service: service, Payload: payloadPPPC, Source: key})
+		}
+	}
+
+	entitlements := sbom.BundleEntitlements(bundlePath)
+	if len(entitlements) == 0 {
+		return
+	}
+	p.EntitledBundles = append(p.EntitledBundles, EntitledBundle{
+		Name:         filepath.Base(bundlePath),
+		Path:         installPath,
+		BundleID:     bundleID,
+		Entitlements: entitlements,
+	})
+	for _, entitlement := range entitlements {
+		if need, ok := entitlementNeeds[entitlement]; ok {
+			need.Path, need.BundleID, need.Source = installPath, bundleID, entitlement
+			p.PrivacyNeeds = append(p.PrivacyNeeds, need)
+		}
+	}
+}
+
+// addLaunchItem records a launchd property list and the background item approval it needs
+func (p *PayloadInspection) addLaunchItem(plistPath string, installPath string) {
+	item := PayloadLaunchItem{Name: filepath.Base(plistPath), Path: installPath, Kind: launchItemKind(installPath)}
+
+	var job map[string]interface{}
+	if data, err := os.ReadFile(plistPath); err == nil {
+		if _, err := plist.Unmarshal(data, &job); err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Failed to parse launchd job %s: %v", installPath, err), logger.LogWarning)
+		}
+	}
+	item.Label, _ = job["Label"].(string)
+	item.Program, _ = job["Program"].(string)
+	if arguments, ok := job["ProgramArguments"].([]interface{}); ok && item.Program == "" && len(arguments) > 0 {
+		item.Program, _ = arguments[0].(string)
+	}
+	item.RunAtLoad, _ = job["RunAtLoad"].(bool)
+	switch keepAlive := job["KeepAlive"].(type) {
+	case bool:
+		item.KeepAlive = keepAlive
+	case map[string]interface{}:
+		item.KeepAlive = true
+	}
+
+	p.LaunchItems = append(p.LaunchItems, item)
+	p.PrivacyNeeds = append(p.PrivacyNeeds, PrivacyNeed{
+		Path: installPath, BundleID: item.Label, Service: "BackgroundItems", Payload: payloadServiceManagement, Source: "launch " + item.Kind,
+	})
+}
+
+// findUnusual reports kernel extensions, weakening entitlements and launch
+// daemons running programs from user-writable locations
+func (p *PayloadInspection) findUnusual() {
+	for _, kext := range p.KernelExtensions {
+		p.Findings = append(p.Findings, PackageIssue{
+			Details:  fmt.Sprintf("Installs kernel extension %s, which is deprecated and needs reduced security on Apple silicon", kext.Name),
+			Priority: "warning",
+			Path:     kext.Path,
+		})
+	}
+
+	for _, bundle := range p.EntitledBundles {
+		for _, entitlement := range bundle.Entitlements {
+			reason, unusual := unusualEntitlements[entitlement]
+			if !unusual && strings.HasPrefix(entitlement, "com.apple.private.") {
+				reason, unusual = "claims a private entitlement only Apple can grant", true
+			}
+			if unusual {
+				p.Findings = append(p.Findings, PackageIssue{
+					Details:  fmt.Sprintf("%s has %s: %s", bundle.Name, entitlement, reason),
+					Priority: "warning",
+					Path:     bundle.Path,
+				})
+			}
+		}
+	}
+
+	for _, item := range p.LaunchItems {
+		if item.Kind != "daemon" {
+			continue
+		}
+		for _, dir := range userWritableDirs {
+			if strings.HasPrefix(item.Program, dir) {
+				p.Findings = append(p.Findings, PackageIssue{
+					Details:  fmt.Sprintf("Launch daemon %s runs %s as root from a user-writable location", item.Name, item.Program),
+					Priority: "critical",
+					Path:     item.Path,
+				})
+				break
+			}
+		}
+	}
+}
+
+// findNew reports the launch items, extensions, entitlements and privacy
+// needs that weren't in the previous inspection of the package
+func (p *PayloadInspection) findNew(previous *PayloadInspection) {
+	seen := make(map[string]bool)
+	for _, item := range previous.LaunchItems {
+		seen["launch|"+item.Path] = true
+	}
+	for _, extension := range previous.KernelExtensions {
+		seen["extension|"+extensionKey(extension)] = true
+	}
+	for _, extension := range previous.SystemExtensions {
+		seen["extension|"+extensionKey(extension)] = true
+	}
+	for _, bundle := range previous.EntitledBundles {
+		for _, entitlement := range bundle.Entitlements {
+			seen["entitlement|"+bundle.Path+"|"+entitlement] = true
+		}
+	}
+	for _, need := range previous.PrivacyNeeds {
+		seen["need|"+need.Path+"|"+need.Service] = true
+	}
+
+	newFinding := func(details string, path string) {
+		p.Findings = append(p.Findings, PackageIssue{Details: "New since the previous scan: " + details, Priority: "warning", Path: path})
+	}
+	for _, item := range p.LaunchItems {
+		if !seen["launch|"+item.Path] {
+			kind := item.Kind
+			if kind != "login item" {
+				kind = "launch " + kind
+			}
+			newFinding(fmt.Sprintf("%s %s", kind, item.Name), item.Path)
+		}
+	}
+	for _, extension := range p.KernelExtensions {
+		if !seen["extension|"+extensionKey(extension)] {
+			newFinding(fmt.Sprintf("kernel extension %s", extension.Name), extension.Path)
+		}
+	}
+	for _, extension := range p.SystemExtensions {
+		if !seen["extension|"+extensionKey(extension)] {
+			newFinding(fmt.Sprintf("system extension %s", extension.Name), extension.Path)
+		}
+	}
+	for _, bundle := range p.EntitledBundles {
+		for _, entitlement := range bundle.Entitlements {
+			if !seen["entitlement|"+bundle.Path+"|"+entitlement] {
+				newFinding(fmt.Sprintf("%s entitlement %s", bundle.Name, entitlement), bundle.Path)
+			}
+		}
+	}
+	// Launch items and extensions are reported above, privacy permissions aren't
+	for _, need := range p.PrivacyNeeds {
+		if need.Payload == payloadPPPC && !seen["need|"+need.Path+"|"+need.Service] {
+			newFinding(fmt.Sprintf("%s needs %s (%s)", filepath.Base(need.Path), need.Service, need.Source), need.Path)
+		}
+	}
+}
+
+// launchItemKind returns whether an install path is a launch daemon, agent or
+// login item, including those apps register from inside their bundle, or ""
+func launchItemKind(installPath string) string {
+	switch {
+	case strings.Contains(installPath, "/Library/LaunchDaemons/"):
+		return "daemon"
+	case strings.Contains(installPath, "/Library/LaunchAgents/"):
+		return "agent"
+	case strings.Contains(installPath, "/Contents/Library/LoginItems/") && strings.HasSuffix(installPath, ".app"):
+		return "login item"
+	}
+	return ""
+}
+
+// readInfoPlist reads the Info.plist of a bundle, or returns nil
+func readInfoPlist(bundlePath string) map[string]interface{} {
+	for _, infoPlistPath := range []string{
+		filepath.Join(bundlePath, "Contents", "Info.plist"),
+		filepath.Join(bundlePath, "Info.plist"),
+	} {
+		data, err := os.ReadFile(infoPlistPath)
+		if err != nil {
+			continue
+		}
+		var info map[string]interface{}
+		if _, err := plist.Unmarshal(data, &info); err == nil {
+			return info
+		}
+	}
+	return nil
+}
+
+// extensionBundle describes a kernel or system extension from its Info.plist
+func extensionBundle(installPath string, info map[string]interface{}) ExtensionBundle {
+	extension := ExtensionBundle{Name: filepath.Base(installPath), Path: installPath}
+	extension.BundleID, _ = info["CFBundleIdentifier"].(string)
+	if version, ok := info["CFBundleShortVersionString"].(string); ok && version != "" {
+		extension.Version = version
+	} else {
+		extension.Version, _ = info["CFBundleVersion"].(string)
+	}
+	return extension
+}
+
+// extensionKey identifies an extension by bundle ID, so moving it isn't new
+func extensionKey(extension ExtensionBundle) string {
+	if extension.BundleID != "" {
+		return extension.BundleID
+	}
+	return extension.Path
+}
+
+// loadPreviousPayload reads the payload inspection of a previous scan's JSON export
+func loadPreviousPayload(jsonPath string) (*PayloadInspection, error) {
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read previous scan results: %w", err)
+	}
+	var previous SecurityScanResult
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return nil, fmt.Errorf("failed to parse previous scan results: %w", err)
+	}
+	return previous.Payload, nil
+}
@@ -40,6 +40,8 @@ func ExportResultsToJSON(result *SecurityScanResult,
 		ComponentCount:          result.ComponentCount,
 		SandboxedApps:           result.SandboxedApps,
 		AppleSiliconSupport:     result.AppleSiliconSupport,
+		EntitledBundles:         result.EntitledBundles,
+		PayloadFindings:         result.PayloadFindings,
 		Issues:                  issues,
 		PrivilegedScriptDetails: privilegedScripts,
 		LaunchdJobDetails:       launchdJobs,
@@ -49,11 +51,14 @@ func ExportResultsToJSON(result *SecurityScanResult,
 		OSRequirements:          osRequirements,
 		IncompatibleItems:       incompatibleItems,
 		SupportedArchitectures:  supportedArchitectures,
+		Payload:                 result.Payload,
 
 		// Add scan metadata
 		ScanDate:                 time.Now(),
 		ScanDuration:             scanDuration.String(),
 		SuspiciousPackageVersion: spVersion,
+		SuspiciousPackageApp:     result.SuspiciousPackageApp,
+		SuspiciousPackageCLI:     result.SuspiciousPackageCLI,
 	}
 
 	// Create directory if it doesn't exist
@@ -2,6 +2,7 @@ package suspiciouspackage
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -29,6 +30,8 @@ type SecurityScanResult struct {
 	ComponentCount      int `json:"componentCount"`
 	SandboxedApps       int `json:"sandboxedAppsCount"`
 	AppleSiliconSupport int `json:"appleSiliconSupport"`
+	EntitledBundles     int `json:"entitledBundlesCount"`
+	PayloadFindings     int `json:"payloadFindingsCount"`
 
 	// Detailed findings
 	Issues                  []PackageIssue              `json:"issues,omitempty"`
@@ -40,11 +43,14 @@ type SecurityScanResult struct {
 	OSRequirements          []OSRequirement             `json:"osRequirements,omitempty"`
 	IncompatibleItems       []OSRequirement             `json:"incompatibleItems,omitempty"`
 	SupportedArchitectures  []string                    `json:"supportedArchitectures,omitempty"`
+	Payload                 *PayloadInspection          `json:"payload,omitempty"`
 
 	// Scan metadata
 	ScanDate                 time.Time `json:"scanDate"`
 	ScanDuration             string    `json:"scanDuration,omitempty"`
 	SuspiciousPackageVersion string    `json:"suspiciousPackageVersion,omitempty"`
+	SuspiciousPackageApp     string    `json:"suspiciousPackageApp,omitempty"`
+	SuspiciousPackageCLI     string    `json:"suspiciousPackageCLI,omitempty"` // spkg command line tool, when the version has one
 }
 
 // ScanOptions represents the options for package security scanning
@@ -54,22 +60,35 @@ type ScanOptions struct {
 	CheckTerm      string
 	CheckOSVersion string
 	JSONOutput     string
+	BaselineJSON   string  // Previous scan's JSON export to report new payload items against, defaults to JSONOutput when it exists
+	Install        *Config // How Suspicious Package is installed when missing, defaults to any version in /Applications
 }
 
 // PackageSecurityScanner scans a macOS package for security issues
 func PackageSecurityScanner(options ScanOptions) error {
+	_, err := ScanPackage(options)
+	return err
+}
+
+// ScanPackage scans a macOS package for security issues with Suspicious
+// Package, logs what it finds and returns the results with their details
+func ScanPackage(options ScanOptions) (*SecurityScanResult, error) {
 	// Record start time for duration calculation
 	startTime := time.Now()
 
 	// Setup and install Suspicious Package if needed
-	config := &Config{
-		ForceUpdate: false, // Only install if not already present
+	config := options.Install
+	if config == nil {
+		config = &Config{
+			ForceUpdate: false, // Only install if not already present
+		}
 	}
 
-	version, err := InstallSuspiciousPackage(config)
+	installation, err := SetupSuspiciousPackage(config)
 	if err != nil {
-		return fmt.Errorf("failed to set up Suspicious Package: %v", err)
+		return nil, fmt.Errorf("failed to set up Suspicious Package: %v", err)
 	}
+	version := installation.Version
 
 	logger.Logger(fmt.Sprintf("📦 Suspicious Package %s ready", version), logger.LogSuccess)
 
@@ -333,6 +352,57 @@ func PackageSecurityScanner(options ScanOptions) error {
 		osRequirements = requirements
 	}
 
+	// 12. Inspect entitlements, launch items, extensions and privacy needs, reporting what's unusual or new
+	baselinePath := options.BaselineJSON
+	if baselinePath == "" && options.JSONOutput != "" {
+		if _, err := os.Stat(options.JSONOutput); err == nil {
+			baselinePath = options.JSONOutput
+		}
+	}
+	var previousPayload *PayloadInspection
+	if baselinePath != "" {
+		previousPayload, err = loadPreviousPayload(baselinePath)
+		if err != nil {
+			logger.Logger(fmt.Sprintf("⚠️ Not reporting new payload items: %v", err), logger.LogWarning)
+		}
+	}
+	payload, err := InspectPayload(options.PackagePath, previousPayload)
+	if err != nil {
+		logger.Logger(fmt.Sprintf("❌ Failed to inspect payload: %v", err), logger.LogError)
+	} else {
+		scanResult.Payload = payload
+		scanResult.EntitledBundles = len(payload.EntitledBundles)
+		scanResult.PayloadFindings = len(payload.Findings)
+
+		for _, need := range payload.PrivacyNeeds {
+			logger.Logger(fmt.Sprintf("  • %s needs %s (%s, %s)", need.Path, need.Service, need.Source, need.Payload), logger.LogInfo)
+		}
+		for _, finding := range payload.Findings {
+			if finding.Priority == "critical" {
+				scanResult.CriticalIssues++
+				logger.Logger(fmt.Sprintf("❌ CRITICAL: %s", finding.Details), logger.LogError)
+			} else {
+				scanResult.WarningIssues++
+				logger.Logger(fmt.Sprintf("⚠️ WARNING: %s", finding.Details), logger.LogWarning)
+			}
+		}
+	}
+
+	scanResult.Issues = allIssues
+	scanResult.PrivilegedScriptDetails = privilegedScripts
+	scanResult.LaunchdJobDetails = launchdJobs
+	scanResult.NonStandardPermDetails = nonStdPerms
+	scanResult.Components = components
+	scanResult.SandboxedAppDetails = sandboxedApps
+	scanResult.OSRequirements = osRequirements
+	scanResult.IncompatibleItems = incompatibleItems
+	scanResult.SupportedArchitectures = supportedArchitectures
+	scanResult.ScanDate = time.Now()
+	scanResult.ScanDuration = time.Since(startTime).String()
+	scanResult.SuspiciousPackageVersion = version
+	scanResult.SuspiciousPackageApp = installation.AppPath
+	scanResult.SuspiciousPackageCLI = installation.CLIPath
+
 	// 13. Export results to JSON if requested
 	if options.JSONOutput != "" {
 		// Calculate scan duration
@@ -365,6 +435,7 @@ func PackageSecurityScanner(options ScanOptions) error {
 	logger.Logger(fmt.Sprintf("  • Non-standard permissions: %d", scanResult.NonStdPermissions), logger.LogInfo)
 	logger.Logger(fmt.Sprintf("  • Component packages: %d", scanResult.ComponentCount), logger.LogInfo)
 	logger.Logger(fmt.Sprintf("  • Sandboxed applications: %d", scanResult.SandboxedApps), logger.LogInfo)
+	logger.Logger(fmt.Sprintf("  • Entitled bundles: %d, payload findings: %d", scanResult.EntitledBundles, scanResult.PayloadFindings), logger.LogInfo)
 	//logger.Logger(fmt.Sprintf("  • Scan duration: %s", scanDuration), logger.LogInfo)
 
 	// Final results based on critical findings
@@ -378,5 +449,5 @@ func PackageSecurityScanner(options ScanOptions) error {
 		logger.Logger("✅ No critical security issues found in package", logger.LogSuccess)
 	}
 
-	return nil
+	return &scanResult, nil
 }
@@ -0,0 +1,168 @@
+// render.go
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// render draws the header, recipe table, selected recipe details, log pane and
+// key help into a string sized for the terminal
+func (m *model) render(height, width int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+
+	finished, failed := 0, 0
+	for _, r := range m.rows {
+		switch r.status {
+		case statusQueued, statusRunning:
+		case "failed":
+			finished++
+			failed++
+		default:
+			finished++
+		}
+	}
+
+	state := "finished"
+	if m.running {
+		state = "running"
+		if m.quitting {
+			state = "stopping"
+		}
+	}
+	writeLine(&b, width, fmt.Sprintf("%sautopkgctl%s  run %s  %s  %d/%d done  %d failed",
+		boldStyle, resetStyle, m.runID, state, finished, len(m.rows), failed))
+	b.WriteString("\n")
+
+	recipeWidth := len("RECIPE")
+	for _, r := range m.rows {
+		if len(r.recipe) > recipeWidth {
+			recipeWidth = len(r.recipe)
+		}
+	}
+	if maxWidth := width / 2; recipeWidth > maxWidth {
+		recipeWidth = maxWidth
+	}
+
+	writeLine(&b, width, fmt.Sprintf("%s  %-*s  %-10s  %8s  %s%s", dimStyle, recipeWidth, "RECIPE", "STATUS", "ELAPSED", "PROCESSOR", resetStyle))
+
+	// Rows for the table are what's left after the header, details, logs and help
+	logHeight := 6
+	tableHeight := height - logHeight - 8
+	if tableHeight < 3 {
+		tableHeight = 3
+	}
+	first := 0
+	if m.selected >= tableHeight {
+		first = m.selected - tableHeight + 1
+	}
+
+	for i := first; i < len(m.rows) && i < first+tableHeight; i++ {
+		r := m.rows[i]
+		elapsed := r.elapsed
+		if r.status == statusRunning {
+			elapsed = time.Since(r.started)
+		}
+		elapsedText := ""
+		if elapsed > 0 {
+			elapsedText = elapsed.Round(time.Second).String()
+		}
+
+		line := fmt.Sprintf("  %-*s  %s%-10s%s  %8s  %s",
+			recipeWidth, truncate(r.recipe, recipeWidth), statusStyle(r.status), r.status, resetStyle, elapsedText, r.processor)
+		if i == m.selected {
+			line = reverseStyle + ">" + resetStyle + line[1:]
+		}
+		writeLine(&b, width, line)
+	}
+	b.WriteString("\n")
+
+	if selected := m.rows[m.selected]; selected.result != nil {
+		detail := selected.result.SkipReason
+		if selected.result.ExecutionError != nil {
+			detail = selected.result.ExecutionError.Error()
+		} else if selected.result.VerificationError != nil {
+			detail = selected.result.VerificationError.Error()
+		}
+		if detail != "" {
+			writeLine(&b, width, fmt.Sprintf("%s: %s", selected.recipe, firstLine(detail)))
+		}
+	}
+	b.WriteString("\n")
+
+	logs := m.logs
+	if len(logs) > logHeight {
+		logs = logs[len(logs)-logHeight:]
+	}
+	for _, line := range logs {
+		writeLine(&b, width, dimStyle+line+resetStyle)
+	}
+	b.WriteString("\n")
+
+	help := "up/down select  c cancel recipe  r re-run failures  q quit"
+	if m.running {
+		help = "up/down select  c cancel recipe  q stop and quit"
+	}
+	writeLine(&b, width, dimStyle+help+resetStyle)
+
+	return b.String()
+}
+
+// statusStyle returns the colour of a status
+func statusStyle(status string) string {
+	switch status {
+	case "updated":
+		return greenStyle
+	case "unchanged":
+		return cyanStyle
+	case "failed":
+		return redStyle
+	case statusRunning:
+		return yellowStyle
+	default:
+		return dimStyle
+	}
+}
+
+// writeLine writes a line cut to the terminal width, not counting escape sequences
+func writeLine(b *strings.Builder, width int, line string) {
+	visible := 0
+	escape := false
+	for i, r := range line {
+		switch {
+		case r == '\033':
+			escape = true
+		case escape:
+			if r == 'm' {
+				escape = false
+			}
+		default:
+			visible++
+			if visible > width {
+				b.WriteString(line[:i])
+				b.WriteString(resetStyle + "\n")
+				return
+			}
+		}
+	}
+	b.WriteString(line + "\n")
+}
+
+// truncate shortens text to a width, marking the cut with ~
+func truncate(text string, width int) string {
+	if len(text) <= width || width < 2 {
+		return text
+	}
+	return text[:width-1] + "~"
+}
+
+// firstLine returns the first line of a multi-line message
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
@@ -0,0 +1,109 @@
+// terminal.go
+package tui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ANSI escape sequences used to draw the screen
+const (
+	enterAltScreen = "\033[?1049h"
+	exitAltScreen  = "\033[?1049l"
+	hideCursor     = "\033[?25l"
+	showCursor     = "\033[?25h"
+	clearScreen    = "\033[H\033[2J"
+	resetStyle     = "\033[0m"
+	boldStyle      = "\033[1m"
+	dimStyle       = "\033[2m"
+	reverseStyle   = "\033[7m"
+	redStyle       = "\033[31m"
+	greenStyle     = "\033[32m"
+	yellowStyle    = "\033[33m"
+	cyanStyle      = "\033[36m"
+)
+
+// Keys decoded from terminal input
+const (
+	keyUp     = "up"
+	keyDown   = "down"
+	keyCancel = "c"
+	keyRerun  = "r"
+	keyQuit   = "q"
+)
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// enableRawInput switches the terminal to unbuffered input without echo using
+// stty, returning a function that restores the previous settings
+func enableRawInput(in *os.File) (func(), error) {
+	saved, err := stty(in, "-g")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terminal settings: %w", err)
+	}
+	if _, err := stty(in, "-icanon", "-echo", "min", "1", "time", "0"); err != nil {
+		return nil, fmt.Errorf("failed to set terminal to raw input: %w", err)
+	}
+	return func() {
+		stty(in, strings.TrimSpace(saved))
+	}, nil
+}
+
+// terminalSize returns the rows and columns of the terminal, with a fallback of 24x80
+func terminalSize(in *os.File) (int, int) {
+	output, err := stty(in, "size")
+	if err == nil {
+		if fields := strings.Fields(output); len(fields) == 2 {
+			rows, rowErr := strconv.Atoi(fields[0])
+			cols, colErr := strconv.Atoi(fields[1])
+			if rowErr == nil && colErr == nil && rows > 0 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+	return 24, 80
+}
+
+// stty runs stty against the terminal
+func stty(in *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = in
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// readKeys decodes key presses from the terminal and sends them on the channel
+// until reading fails
+func readKeys(in *os.File, keys chan<- string) {
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		input := string(buf[:n])
+		switch {
+		case input == "\033[A" || input == "k":
+			keys <- keyUp
+		case input == "\033[B" || input == "j":
+			keys <- keyDown
+		case input == "c":
+			keys <- keyCancel
+		case input == "r":
+			keys <- keyRerun
+		case input == "q" || input == "\x03":
+			keys <- keyQuit
+		}
+	}
+}
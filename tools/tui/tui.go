@@ -0,0 +1,335 @@
+// Package tui shows a live table of a local batch run in the terminal, with
+// keyboard controls to cancel a recipe and re-run failures.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/autopkg"
+	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
+)
+
+// Row statuses shown before a recipe has a batch result
+const (
+	statusQueued  = "queued"
+	statusRunning = "running"
+	statusNotRun  = "not run"
+)
+
+// logLines is the number of log lines kept for the log pane
+const logLines = 200
+
+// Options contains options for running recipes in the TUI
+type Options struct {
+	Recipes         []string
+	Batch           *autopkg.RecipeBatchRunOptions // Settings for every batch, RunID, Context and Progress are set by the TUI
+	In              *os.File                       // Terminal to read keys from, defaults to os.Stdin
+	Out             io.Writer                      // Where the screen is drawn, defaults to os.Stdout
+	RefreshInterval time.Duration                  // How often elapsed times are redrawn, defaults to 250ms
+}
+
+// row is the live state of a single recipe
+type row struct {
+	recipe    string
+	status    string
+	processor string
+	started   time.Time
+	elapsed   time.Duration
+	cancel    func()
+	result    *autopkg.RecipeBatchResult
+}
+
+// model holds the screen state, updated by the batch goroutine through the
+// RecipeProgress methods and by key presses
+type model struct {
+	mu          sync.Mutex
+	rows        []*row
+	index       map[string]*row
+	selected    int
+	running     bool
+	quitting    bool
+	runID       string
+	batchCancel func()
+	logs        []string
+	pending     []byte
+}
+
+// Run runs the recipes as a batch and shows their progress until the user
+// quits, returning the latest result of every recipe
+func Run(options *Options) (map[string]*autopkg.RecipeBatchResult, error) {
+	if options == nil || len(options.Recipes) == 0 {
+		return nil, fmt.Errorf("no recipes to run")
+	}
+	if options.Batch == nil {
+		options.Batch = &autopkg.RecipeBatchRunOptions{}
+	}
+	if options.In == nil {
+		options.In = os.Stdin
+	}
+	if options.Out == nil {
+		options.Out = os.Stdout
+	}
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = 250 * time.Millisecond
+	}
+
+	if !isTerminal(options.In) {
+		return nil, fmt.Errorf("the TUI needs an interactive terminal, use the run command instead")
+	}
+
+	restore, err := enableRawInput(options.In)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	m := &model{index: make(map[string]*row)}
+	for _, recipe := range options.Recipes {
+		r := &row{recipe: recipe, status: statusQueued}
+		m.rows = append(m.rows, r)
+		m.index[recipe] = r
+	}
+
+	// Log messages would scroll the table away, so they go to the log pane
+	logger.SetOutput(m)
+	defer logger.SetOutput(os.Stdout)
+
+	fmt.Fprint(options.Out, enterAltScreen+hideCursor)
+	defer fmt.Fprint(options.Out, showCursor+exitAltScreen)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	keys := make(chan string)
+	go readKeys(options.In, keys)
+
+	done := make(chan struct{})
+	m.startBatch(options.Batch, options.Recipes, done)
+
+	ticker := time.NewTicker(options.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		rows, cols := terminalSize(options.In)
+		fmt.Fprint(options.Out, m.render(rows, cols))
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			done = nil
+			m.finishBatch()
+			if m.isQuitting() {
+				return m.results(), nil
+			}
+		case <-interrupts:
+			if m.quit() {
+				return m.results(), nil
+			}
+		case key, ok := <-keys:
+			if !ok {
+				keys = nil
+				continue
+			}
+			switch key {
+			case keyUp:
+				m.move(-1)
+			case keyDown:
+				m.move(1)
+			case keyCancel:
+				m.cancelSelected()
+			case keyRerun:
+				if failed := m.failedRecipes(); len(failed) > 0 && !m.isRunning() {
+					done = make(chan struct{})
+					m.startBatch(options.Batch, failed, done)
+				}
+			case keyQuit:
+				if m.quit() {
+					return m.results(), nil
+				}
+			}
+		}
+	}
+}
+
+// startBatch queues the recipes and runs them as a new batch in the background
+func (m *model) startBatch(template *autopkg.RecipeBatchRunOptions, recipes []string, done chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	batch := *template
+	batch.RunID = autopkg.NewRunID(time.Now())
+	batch.Context = ctx
+	batch.Progress = m
+
+	m.mu.Lock()
+	for _, recipe := range recipes {
+		if r := m.index[recipe]; r != nil {
+			*r = row{recipe: recipe, status: statusQueued}
+		}
+	}
+	m.running = true
+	m.runID = batch.RunID
+	m.batchCancel = cancel
+	m.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		autopkg.RunRecipeBatch(strings.Join(recipes, ","), &batch)
+	}()
+}
+
+// finishBatch marks recipes the batch did not get to once it has returned
+func (m *model) finishBatch() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.running = false
+	m.batchCancel = nil
+	for _, r := range m.rows {
+		if r.status == statusQueued || r.status == statusRunning {
+			r.status = statusNotRun
+			r.cancel = nil
+		}
+	}
+}
+
+// quit cancels a running batch and reports whether the TUI can exit now
+func (m *model) quit() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.running {
+		return true
+	}
+	if m.quitting {
+		// A second quit doesn't wait for autopkg to exit
+		return true
+	}
+	m.quitting = true
+	m.batchCancel()
+	return false
+}
+
+// RecipeStarted implements autopkg.RecipeProgress
+func (m *model) RecipeStarted(recipe string, cancel func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r := m.index[recipe]; r != nil {
+		r.status = statusRunning
+		r.started = time.Now()
+		r.processor = ""
+		r.cancel = cancel
+	}
+}
+
+// RecipeProcessor implements autopkg.RecipeProgress
+func (m *model) RecipeProcessor(recipe string, processor string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r := m.index[recipe]; r != nil {
+		r.processor = processor
+	}
+}
+
+// RecipeFinished implements autopkg.RecipeProgress
+func (m *model) RecipeFinished(recipe string, result *autopkg.RecipeBatchResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r := m.index[recipe]; r != nil {
+		r.status = result.Status
+		r.elapsed = result.ExecutionTime
+		r.cancel = nil
+		r.result = result
+	}
+}
+
+// Write implements io.Writer for log messages, keeping the latest lines
+func (m *model) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = append(m.pending, p...)
+	lines := strings.Split(string(m.pending), "\n")
+	m.pending = []byte(lines[len(lines)-1])
+	m.logs = append(m.logs, lines[:len(lines)-1]...)
+	if len(m.logs) > logLines {
+		m.logs = m.logs[len(m.logs)-logLines:]
+	}
+	return len(p), nil
+}
+
+// move changes the selected row
+func (m *model) move(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.selected += delta
+	if m.selected < 0 {
+		m.selected = 0
+	}
+	if m.selected >= len(m.rows) {
+		m.selected = len(m.rows) - 1
+	}
+}
+
+// cancelSelected stops the selected recipe if it is running
+func (m *model) cancelSelected() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r := m.rows[m.selected]; r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+// failedRecipes returns the recipes whose latest run failed or was not run
+func (m *model) failedRecipes() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var failed []string
+	for _, r := range m.rows {
+		if r.status == "failed" || r.status == statusNotRun {
+			failed = append(failed, r.recipe)
+		}
+	}
+	return failed
+}
+
+func (m *model) isRunning() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+func (m *model) isQuitting() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.quitting
+}
+
+// results returns the latest result of every recipe that has one
+func (m *model) results() map[string]*autopkg.RecipeBatchResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := make(map[string]*autopkg.RecipeBatchResult)
+	for _, r := range m.rows {
+		if r.result != nil {
+			results[r.recipe] = r.result
+		}
+	}
+	return results
+}
@@ -0,0 +1,74 @@
+// compare.go
+package versionoracle
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Compare compares app versions, returning -1, 0 or 1. Versions are split
+// into runs of digits and letters, compared numerically and alphabetically
+// respectively, so 128.0.10 is newer than 128.0.9 and 2.1b2 newer than 2.1b1.
+// Missing components count as zero, so 14 equals 14.0.
+func Compare(a, b string) int {
+	aParts, bParts := versionParts(a), versionParts(b)
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := "0", "0"
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+
+		aNum, aErr := strconv.Atoi(aPart)
+		bNum, bErr := strconv.Atoi(bPart)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+		case aPart != bPart:
+			// A pre-release suffix sorts before the release it precedes, so 2.1 is newer than 2.1b1
+			if aErr == nil {
+				return 1
+			}
+			if bErr == nil {
+				return -1
+			}
+			return strings.Compare(aPart, bPart)
+		}
+	}
+	return 0
+}
+
+// versionParts splits a version into runs of digits and of letters, dropping separators
+func versionParts(version string) []string {
+	var parts []string
+	var current strings.Builder
+	var currentDigits bool
+	for _, r := range strings.ToLower(strings.TrimSpace(version)) {
+		isDigit, isLetter := unicode.IsDigit(r), unicode.IsLetter(r)
+		if !isDigit && !isLetter {
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		if current.Len() > 0 && isDigit != currentDigits {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		current.WriteRune(r)
+		currentDigits = isDigit
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
@@ -0,0 +1,97 @@
+// homebrew.go
+package versionoracle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultHomebrewCaskAPI is the Homebrew cask API, serving a JSON document per cask
+const DefaultHomebrewCaskAPI = "https://formulae.brew.sh/api/cask"
+
+// HomebrewCask answers the version of an app's Homebrew cask, which the
+// Homebrew community updates within hours to days of most vendor releases
+type HomebrewCask struct {
+	APIURL string // Defaults to DefaultHomebrewCaskAPI
+	Client *http.Client
+}
+
+// Name implements Source
+func (h *HomebrewCask) Name() string { return "homebrew-cask" }
+
+// Latest implements Source
+func (h *HomebrewCask) Latest(query Query) (string, error) {
+	token := query.Cask
+	if token == "" {
+		token = CaskToken(query.App)
+	}
+	if token == "" {
+		return "", ErrUnknown
+	}
+
+	apiURL := h.APIURL
+	if apiURL == "" {
+		apiURL = DefaultHomebrewCaskAPI
+	}
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(apiURL, "/") + "/" + url.PathEscape(token) + ".json")
+	if err != nil {
+		return "", fmt.Errorf("failed to query Homebrew cask %s: %w", token, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrUnknown
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Homebrew cask API returned %s for %s", resp.Status, token)
+	}
+
+	var cask struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cask); err != nil {
+		return "", fmt.Errorf("failed to parse Homebrew cask %s: %w", token, err)
+	}
+
+	// Casks append build numbers after a comma, e.g. 5.17.11,31580, and
+	// casks that always download the latest version have none
+	version, _, _ := strings.Cut(cask.Version, ",")
+	if version == "" || version == "latest" {
+		return "", ErrUnknown
+	}
+	return version, nil
+}
+
+// CaskToken derives a Homebrew cask token from an app name the way Homebrew
+// names casks: lower case words joined by hyphens, so GoogleChrome becomes
+// google-chrome and "Visual Studio Code" visual-studio-code
+func CaskToken(app string) string {
+	var token strings.Builder
+	runes := []rune(strings.TrimSpace(app))
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			// A capital starts a word unless it continues an acronym, e.g. VLC
+			startsWord := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])))
+			if startsWord && !strings.HasSuffix(token.String(), "-") {
+				token.WriteRune('-')
+			}
+			token.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			token.WriteRune(r)
+		case token.Len() > 0 && !strings.HasSuffix(token.String(), "-"):
+			token.WriteRune('-')
+		}
+	}
+	return strings.Trim(token.String(), "-")
+}
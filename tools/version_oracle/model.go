@@ -0,0 +1,63 @@
+// Package versionoracle looks up the latest version of an app from sources
+// outside AutoPkg, such as the Homebrew cask API or a vendor's own page, so a
+// recipe whose download URL or version regex broke can be told apart from a
+// vendor that hasn't released anything.
+package versionoracle
+
+import "errors"
+
+// ErrUnknown is returned by a source that doesn't know the app
+var ErrUnknown = errors.New("app unknown to this source")
+
+// Query identifies an app to the sources
+type Query struct {
+	App     string // App name, e.g. GoogleChrome
+	Cask    string // Homebrew cask token, derived from App when empty
+	URL     string // Vendor page or API listing the latest version
+	Pattern string // Regular expression whose first group is the version in URL's response
+}
+
+// Source answers the latest version of an app
+type Source interface {
+	Name() string
+	Latest(query Query) (string, error)
+}
+
+// Answer is a source's latest version of an app, or why it has none
+type Answer struct {
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Lookup asks every source for the latest version of an app, in order.
+// Sources that don't know the app are left out.
+func Lookup(query Query, sources ...Source) []Answer {
+	var answers []Answer
+	for _, source := range sources {
+		version, err := source.Latest(query)
+		if errors.Is(err, ErrUnknown) {
+			continue
+		}
+		answer := Answer{Source: source.Name(), Version: version}
+		if err != nil {
+			answer.Error = err.Error()
+		}
+		answers = append(answers, answer)
+	}
+	return answers
+}
+
+// Newest returns the answer with the newest version, or nil if no source had one
+func Newest(answers []Answer) *Answer {
+	var newest *Answer
+	for i := range answers {
+		if answers[i].Version == "" {
+			continue
+		}
+		if newest == nil || Compare(answers[i].Version, newest.Version) > 0 {
+			newest = &answers[i]
+		}
+	}
+	return newest
+}
@@ -0,0 +1,66 @@
+// vendor.go
+package versionoracle
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// defaultVersionPattern finds the first dotted version in a vendor's response
+// when the query has no pattern
+var defaultVersionPattern = regexp.MustCompile(`(\d+(?:\.\d+)+)`)
+
+// VendorURL answers the version a vendor's page or API lists at the query's
+// URL, found with its pattern
+type VendorURL struct {
+	Client *http.Client
+}
+
+// Name implements Source
+func (v *VendorURL) Name() string { return "vendor" }
+
+// Latest implements Source
+func (v *VendorURL) Latest(query Query) (string, error) {
+	if query.URL == "" {
+		return "", ErrUnknown
+	}
+
+	pattern := defaultVersionPattern
+	if query.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(query.Pattern); err != nil {
+			return "", fmt.Errorf("invalid version pattern for %s: %w", query.App, err)
+		}
+	}
+
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Get(query.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", query.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", query.URL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", query.URL, err)
+	}
+
+	match := pattern.FindSubmatch(body)
+	switch {
+	case match == nil:
+		return "", fmt.Errorf("no version found in %s", query.URL)
+	case len(match) > 1:
+		return string(match[1]), nil
+	default:
+		return string(match[0]), nil
+	}
+}
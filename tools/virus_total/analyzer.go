@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/deploymenttheory/macos-autopkg-factory/tools/logger"
@@ -37,12 +38,19 @@ const (
 
 	// LastRunTimeEnvVar is the environment variable to track last API request time
 	LastRunTimeEnvVar = "AUTOPKG_VIRUSTOTAL_LAST_RUN_TIME"
+
+	// DefaultConcurrency is the default number of files AnalyzeFiles works on at once
+	DefaultConcurrency = 4
 )
 
 // Analyzer is the main struct for interacting with VirusTotal
 type Analyzer struct {
 	config *Config
 	client *http.Client
+	cache  *resultCache
+
+	limiter     sync.Mutex
+	nextRequest time.Time // Earliest time of the next API request
 }
 
 // NewAnalyzer creates a new VirusTotal analyzer with the given configuration
@@ -56,6 +64,7 @@ func NewAnalyzer(config *Config) *Analyzer {
 		client: &http.Client{
 			Timeout: 60 * time.Second,
 		},
+		cache: newResultCache(config),
 	}
 }
 
@@ -283,6 +292,14 @@ func (a *Analyzer) AnalyzeFile(filePath string, downloadChanged bool) (*SummaryR
 		return nil, fmt.Errorf("failed to calculate hash: %w", err)
 	}
 
+	// Use a cached analysis of the same file
+	if cached := a.cache.lookup(fileHash); cached != nil {
+		logger.Logger(fmt.Sprintf("📦 Using cached VirusTotal analysis of %s: %s", filepath.Base(filePath), cached.Ratio), logger.LogInfo)
+		cached.FileName = filepath.Base(filePath)
+		cached.Cached = true
+		return cached, nil
+	}
+
 	// Check if we need to wait before making a request
 	if err := a.checkAndSleep(); err != nil {
 		return nil, err
@@ -304,6 +321,7 @@ func (a *Analyzer) AnalyzeFile(filePath string, downloadChanged bool) (*SummaryR
 	summary := &SummaryResult{
 		FileName:  filepath.Base(filePath),
 		Permalink: result.Permalink,
+		SHA256:    fileHash,
 	}
 
 	logger.Logger(fmt.Sprintf("📊 VirusTotal response code: %d", result.ResponseCode), logger.LogInfo)
@@ -352,6 +370,8 @@ func (a *Analyzer) AnalyzeFile(filePath string, downloadChanged bool) (*SummaryR
 
 		summary.Result = "ANALYZED"
 		summary.Ratio = fmt.Sprintf("%d/%d", result.Positives, result.Total)
+		summary.Positives = result.Positives
+		summary.Total = result.Total
 
 		// Log warning or error based on detection ratio
 		if result.Positives > 0 {
@@ -384,33 +404,69 @@ func (a *Analyzer) AnalyzeFile(filePath string, downloadChanged bool) (*SummaryR
 		summary.Result = "ERROR"
 	}
 
+	if err := a.cache.store(fileHash, *summary); err != nil {
+		logger.Logger(fmt.Sprintf("⚠️ Warning: Failed to cache VirusTotal analysis: %v", err), logger.LogWarning)
+	}
 	return summary, nil
 }
 
-// checkAndSleep checks if we need to wait before making a request
-func (a *Analyzer) checkAndSleep() error {
-	// Get the last run time from the environment variable
-	lastRunTimeStr := os.Getenv(LastRunTimeEnvVar)
-	if lastRunTimeStr == "" {
-		return nil // No last run time, proceed
-	}
-
-	lastRunTime, err := strconv.ParseInt(lastRunTimeStr, 10, 64)
-	if err != nil {
-		return fmt.Errorf("failed to parse last run time: %w", err)
-	}
+// AnalyzeFiles analyzes files concurrently, up to Concurrency at once.
+// Hashing and cache lookups run in parallel while requests still wait for
+// their slot, so a nightly scan of mostly unchanged artifacts only queries
+// VirusTotal for the few that changed. Results are in the order of the paths.
+func (a *Analyzer) AnalyzeFiles(filePaths []string, downloadChanged bool) []FileAnalysis {
+	concurrency := a.config.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	results := make([]FileAnalysis, len(filePaths))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, filePath := range filePaths {
+		wg.Add(1)
+		go func(i int, filePath string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			summary, err := a.AnalyzeFile(filePath, downloadChanged)
+			results[i] = FileAnalysis{FilePath: filePath, Summary: summary, Error: err}
+		}(i, filePath)
+	}
+	wg.Wait()
+	return results
+}
 
-	if lastRunTime > 0 && a.config.SleepSeconds > 0 {
-		now := time.Now().Unix()
-		nextTime := lastRunTime + int64(a.config.SleepSeconds)
+// checkAndSleep waits for the next request slot. Slots are SleepSeconds
+// apart, shared by the goroutines of AnalyzeFiles and following the last
+// request of earlier analyzers in the process.
+func (a *Analyzer) checkAndSleep() error {
+	interval := time.Duration(a.config.SleepSeconds) * time.Second
 
-		if now < nextTime {
-			sleepTime := nextTime - now
-			logger.Logger(fmt.Sprintf("⏱️ Sleeping %d seconds before requesting VirusTotal report...", sleepTime), logger.LogInfo)
-			time.Sleep(time.Duration(sleepTime) * time.Second)
+	a.limiter.Lock()
+	if a.nextRequest.IsZero() {
+		// Get the last run time from the environment variable
+		if lastRunTimeStr := os.Getenv(LastRunTimeEnvVar); lastRunTimeStr != "" {
+			lastRunTime, err := strconv.ParseInt(lastRunTimeStr, 10, 64)
+			if err != nil {
+				a.limiter.Unlock()
+				return fmt.Errorf("failed to parse last run time: %w", err)
+			}
+			a.nextRequest = time.Unix(lastRunTime, 0).Add(interval)
 		}
 	}
+	slot := time.Now()
+	if slot.Before(a.nextRequest) {
+		slot = a.nextRequest
+	}
+	a.nextRequest = slot.Add(interval)
+	a.limiter.Unlock()
 
+	if wait := time.Until(slot); wait > 0 {
+		logger.Logger(fmt.Sprintf("⏱️ Sleeping %d seconds before requesting VirusTotal report...", int(wait.Round(time.Second).Seconds())), logger.LogInfo)
+		time.Sleep(wait)
+	}
 	return nil
 }
 
@@ -0,0 +1,114 @@
+package virustotal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a cached analysis is trusted before VirusTotal
+// is asked again, so detections added by scanners later are still picked up
+const DefaultCacheTTL = 24 * time.Hour
+
+// DefaultCachePath returns the result cache in the user's cache directory
+func DefaultCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "autopkgctl", "virustotal.json")
+}
+
+// cachedResult is an analysis in the result cache
+type cachedResult struct {
+	Summary   SummaryResult `json:"summary"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// resultCache keeps the VirusTotal analyses of files by SHA256 in a JSON
+// file. Only analyzed files are cached: unknown and queued ones are asked
+// about again on the next run.
+type resultCache struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	loaded  bool
+	results map[string]cachedResult
+}
+
+// newResultCache returns the cache of a configuration, or nil when it has no cache path
+func newResultCache(config *Config) *resultCache {
+	if config.CachePath == "" {
+		return nil
+	}
+	ttl := config.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &resultCache{path: config.CachePath, ttl: ttl}
+}
+
+// lookup returns the cached analysis of a hash, or nil when it isn't cached or has expired
+func (c *resultCache) lookup(fileHash string) *SummaryResult {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	cached, ok := c.results[fileHash]
+	if !ok || time.Since(cached.CheckedAt) > c.ttl {
+		return nil
+	}
+	summary := cached.Summary
+	return &summary
+}
+
+// store caches the analysis of a hash and writes the cache back, dropping expired entries
+func (c *resultCache) store(fileHash string, summary SummaryResult) error {
+	if c == nil || summary.Result != "ANALYZED" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	c.results[fileHash] = cachedResult{Summary: summary, CheckedAt: time.Now().UTC()}
+	for hash, cached := range c.results {
+		if time.Since(cached.CheckedAt) > c.ttl {
+			delete(c.results, hash)
+		}
+	}
+
+	data, err := json.MarshalIndent(c.results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal VirusTotal cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create VirusTotal cache directory: %w", err)
+	}
+	temp := c.path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write VirusTotal cache: %w", err)
+	}
+	return os.Rename(temp, c.path)
+}
+
+// load reads the cache file once, starting empty when it's missing or unreadable
+func (c *resultCache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	c.results = map[string]cachedResult{}
+	if data, err := os.ReadFile(c.path); err == nil {
+		if err := json.Unmarshal(data, &c.results); err != nil || c.results == nil {
+			c.results = map[string]cachedResult{}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 // Package virustotal provides functionality to analyze files using the VirusTotal API
 package virustotal
 
+import "time"
+
 // Config holds the configuration for the VirusTotal analyzer
 type Config struct {
 	// APIKey is the VirusTotal API key
@@ -20,6 +22,15 @@ type Config struct {
 
 	// Disabled allows disabling the analyzer
 	Disabled bool
+
+	// CachePath is the JSON file analyses are cached in by SHA256, no caching when empty
+	CachePath string
+
+	// CacheTTL is how long cached analyses are used, defaults to DefaultCacheTTL
+	CacheTTL time.Duration
+
+	// Concurrency is how many files AnalyzeFiles works on at once, defaults to DefaultConcurrency
+	Concurrency int
 }
 
 // AnalysisResult contains the results of a VirusTotal analysis
@@ -43,6 +54,17 @@ type SummaryResult struct {
 	Ratio     string
 	Permalink string
 	Result    string // SKIPPED, SUBMITTED, QUEUED, ANALYZED
+	Positives int    // Scanners detecting the file, when ANALYZED
+	Total     int    // Scanners that scanned it, when ANALYZED
+	SHA256    string // Hash the file was looked up by
+	Cached    bool   // Whether the analysis came from the result cache
+}
+
+// FileAnalysis is the outcome of one file of AnalyzeFiles
+type FileAnalysis struct {
+	FilePath string
+	Summary  *SummaryResult
+	Error    error
 }
 
 // DefaultConfig creates a new Config with default values
@@ -54,5 +76,7 @@ func DefaultConfig() *Config {
 		AutoSubmitMaxSize: DefaultAutoSubmitMaxSize,
 		SleepSeconds:      DefaultSleepSeconds,
 		Disabled:          false,
+		CacheTTL:          DefaultCacheTTL,
+		Concurrency:       DefaultConcurrency,
 	}
 }